@@ -340,11 +340,12 @@ class EmailServerAPI {
     }
   }
 
-  // 根据域名获取匹配的平台注册信息（用于自动填充）
-  async getPlatformRegistrationsByDomain(domain) {
+  // 根据页面网址获取匹配的平台注册信息（用于自动填充）
+  // 由服务器按可注册域名、平台的其他网址和等价域名匹配；只传域名时按域名匹配
+  async getPlatformRegistrationsByDomain(domain, pageURL) {
     await this.ensureInitialized();
 
-    console.log('🔍 根据域名获取平台注册信息:', { domain, baseURL: this.baseURL, hasToken: !!this.token });
+    console.log('🔍 根据网址获取平台注册信息:', { domain, pageURL, baseURL: this.baseURL, hasToken: !!this.token });
 
     if (!this.baseURL) {
       return { success: false, error: '请先在设置中配置服务器地址' };
@@ -356,31 +357,49 @@ class EmailServerAPI {
     }
 
     try {
-      // 先获取所有平台注册信息
-      const allRegistrationsResult = await this.getPlatformRegistrations();
+      const headers = {
+        'Authorization': `Bearer ${this.token}`,
+        'Content-Type': 'application/json'
+      };
 
-      if (!allRegistrationsResult.success) {
-        return allRegistrationsResult;
-      }
+      const response = await fetch(`${this.baseURL}/api/v1/autofill?url=${encodeURIComponent(pageURL || domain)}`, {
+        method: 'GET',
+        headers
+      });
 
-      const allRegistrations = allRegistrationsResult.data || [];
+      console.log('📨 响应状态:', response.status, response.statusText);
 
-      // 过滤匹配当前域名的注册信息
-      const matchedRegistrations = allRegistrations.filter(registration => {
-        const platformName = registration.platform_name.toLowerCase();
-        const currentDomain = domain.toLowerCase();
+      if (!response.ok) {
+        let errorMessage = `HTTP ${response.status}: ${response.statusText}`;
+        try {
+          const error = await response.json();
+          errorMessage = error.message || error.error || errorMessage;
+          console.error('❌ 服务器错误:', error);
+        } catch (parseError) {
+          console.error('❌ 解析错误响应失败:', parseError);
+        }
+        return { success: false, error: errorMessage };
+      }
 
-        // 精确匹配或包含匹配
-        return platformName === currentDomain ||
-               platformName.includes(currentDomain) ||
-               currentDomain.includes(platformName);
-      });
+      const responseData = await response.json();
+      const matches = (responseData.data && responseData.data.matches) || [];
+
+      // 转换为与平台注册列表相同的字段，密码仍在填充时单独获取
+      const matchedRegistrations = matches.map(match => ({
+        id: match.registration_id,
+        platform_id: match.platform_id,
+        platform_name: match.platform_name,
+        login_username: match.login_username,
+        email_address: match.email_address,
+        has_password: match.has_password,
+        has_totp: match.has_totp,
+        match: match.match
+      }));
 
       console.log('✅ 找到匹配的平台注册信息:', {
         domain,
-        totalRegistrations: allRegistrations.length,
         matchedCount: matchedRegistrations.length,
-        matched: matchedRegistrations.map(r => ({ id: r.id, platform: r.platform_name, username: r.login_username, email: r.email_address }))
+        matched: matchedRegistrations.map(r => ({ id: r.id, platform: r.platform_name, match: r.match }))
       });
 
       return {
@@ -389,7 +408,7 @@ class EmailServerAPI {
         count: matchedRegistrations.length
       };
     } catch (error) {
-      console.error('❌ 根据域名获取平台注册信息时发生错误:', error);
+      console.error('❌ 根据网址获取平台注册信息时发生错误:', error);
       return { success: false, error: '网络错误或服务器无响应' };
     }
   }
@@ -554,7 +573,7 @@ chrome.runtime.onMessage.addListener((request, sender, sendResponse) => {
         break;
 
       case 'getRegistrationsByDomain':
-        const getByDomainResult = await api.getPlatformRegistrationsByDomain(request.domain);
+        const getByDomainResult = await api.getPlatformRegistrationsByDomain(request.domain, request.url);
         sendResponse(getByDomainResult);
         break;
 
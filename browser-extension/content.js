@@ -247,7 +247,8 @@ class FormDetector {
     // 获取当前域名匹配的注册信息
     this.safeSendMessage({
       action: 'getRegistrationsByDomain',
-      domain: this.getPlatformName()
+      domain: this.getPlatformName(),
+      url: window.location.href
     }, (response) => {
       if (!response) {
         console.log('❌ 无法获取注册信息，可能是扩展上下文失效');
@@ -1019,7 +1020,8 @@ class FormDetector {
     // 获取当前域名匹配的注册信息
     chrome.runtime.sendMessage({
       action: 'getRegistrationsByDomain',
-      domain: this.getPlatformName()
+      domain: this.getPlatformName(),
+      url: window.location.href
     }, (response) => {
       console.log('📡 获取域名匹配注册信息响应:', response);
 
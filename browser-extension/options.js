@@ -44,6 +44,9 @@ class OptionsManager {
       if (settings.serverURL) {
         document.getElementById('server-url').value = settings.serverURL;
       }
+      if (settings.apiToken) {
+        document.getElementById('api-token').value = settings.apiToken;
+      }
       if (settings.username) {
         document.getElementById('username').value = settings.username;
       }
@@ -70,10 +73,17 @@ class OptionsManager {
       const formData = new FormData(document.getElementById('settings-form'));
       const settings = {
         serverURL: formData.get('serverURL'),
+        apiToken: (formData.get('apiToken') || '').trim(),
         username: formData.get('username'),
         password: formData.get('password')
       };
 
+      // 使用 API Token 时直接作为认证凭证，不再保存账户密码
+      if (settings.apiToken) {
+        settings.token = settings.apiToken;
+        settings.password = '';
+      }
+
       // 验证服务器地址格式
       if (settings.serverURL) {
         try {
@@ -98,8 +108,8 @@ class OptionsManager {
 
       this.showStatus('设置已保存', 'success');
 
-      // 如果提供了用户名和密码，尝试自动登录
-      if (settings.username && settings.password) {
+      // 未使用 API Token 且提供了用户名和密码时，尝试自动登录
+      if (!settings.apiToken && settings.username && settings.password) {
         this.autoLogin(settings);
       }
 
@@ -243,6 +253,7 @@ class OptionsManager {
         const newSettings = {
           ...currentSettings,
           token: '',
+          apiToken: '',
           password: '' // 可选：是否也清除保存的密码
         };
 
@@ -260,8 +271,9 @@ class OptionsManager {
 
         this.showStatus('已退出登录', 'success');
 
-        // 清空密码字段显示
+        // 清空密码和 API Token 字段显示
         document.getElementById('password').value = '';
+        document.getElementById('api-token').value = '';
 
       } catch (error) {
         this.showStatus('退出登录失败: ' + error.message, 'error');
@@ -22,4 +22,4 @@ cd src/backend
 
 # Run the main Go program
 echo "Starting backend server from Go module root ($(pwd))..."
-go run .
\ No newline at end of file
+go run -tags sqlite_fts5 .
\ No newline at end of file
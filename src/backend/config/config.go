@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -13,23 +14,171 @@ type Config struct {
 	Frontend FrontendConfig // 新增前端配置
 	Backend  BackendConfig
 	Security SecurityConfig
+	Trash    TrashConfig
+	Admin    AdminConfig
+	SMTP     SMTPConfig
+	// RateLimit 各路由组的限流规则
+	RateLimit RateLimitConfig
+	Favicon   FaviconConfig
+	// Attachment 邮件附件下载
+	Attachment AttachmentConfig
+	// ImageProxy 邮件远程图片代理
+	ImageProxy ImageProxyConfig
+	// UnifiedInbox 汇总所有邮箱账户的收件箱
+	UnifiedInbox UnifiedInboxConfig
+	// MailWatch 新邮件监听
+	MailWatch MailWatchConfig
+	// IMAP 连接超时和连接池
+	IMAP IMAPConfig
+}
+
+// UnifiedInboxConfig 统一收件箱配置
+type UnifiedInboxConfig struct {
+	// AccountTimeoutSeconds 单个邮箱账户的获取超时（秒），超时的账户在结果中报告错误
+	AccountTimeoutSeconds int
+	// Concurrency 同时获取的邮箱账户数
+	Concurrency int
+}
+
+// IMAPConfig IMAP 连接配置。收件箱、搜索、邮件操作等请求复用已登录的连接，IDLE 长连接不在连接池中
+type IMAPConfig struct {
+	// DialTimeoutSeconds 建立连接（含 TLS 握手）的超时，也是连接数达到上限时等待空闲名额的时间（秒）
+	DialTimeoutSeconds int
+	// CommandTimeoutSeconds 执行命令时服务器无响应的最长时间（秒），超时后断开连接
+	CommandTimeoutSeconds int
+	// PoolIdleTimeoutSeconds 空闲连接的保留时间（秒），<=0 时不复用连接
+	PoolIdleTimeoutSeconds int
+	// PoolMaxConnectionsPerServer 同一 IMAP 服务器同时打开的连接数上限（不含 IDLE 长连接）
+	PoolMaxConnectionsPerServer int
+	// PoolMaxIdlePerAccount 每个邮箱账户保留的空闲连接数
+	PoolMaxIdlePerAccount int
+	// PoolHealthCheckSeconds 空闲超过该时间的连接在复用前先发送 NOOP 检查（秒）
+	PoolHealthCheckSeconds int
+}
+
+// MailWatchConfig 新邮件监听配置。用户为邮箱账户开启监听后，IMAP 账户保持 IDLE 长连接，Gmail 和 Outlook 账户定期检查变更
+type MailWatchConfig struct {
+	// Enabled 为 false 时不启动监听，已开启的监听保留设置但不运行
+	Enabled bool
+	// MaxIMAPConnections 同时保持的 IMAP IDLE 连接数上限，超出的账户等待空闲名额
+	MaxIMAPConnections int
+	// PollIntervalSeconds Gmail history、Graph delta 以及不支持 IDLE 的 IMAP 服务器的检查间隔（秒）
+	PollIntervalSeconds int
+	// MaxBackoffSeconds 连接或检查失败后重试等待时间的上限（秒），等待时间从 5 秒开始倍增
+	MaxBackoffSeconds int
+	// EventRetentionDays 新邮件事件的保留天数
+	EventRetentionDays int
+	// GraphNotifications 为 Outlook 账户创建 Graph 变更通知订阅，收到通知时立即检查。
+	// 通知地址为 BACKEND_BASE_URL + /api/v1/webhooks/graph/mail，必须是公网可访问的 HTTPS 地址
+	GraphNotifications bool
+}
+
+// ImageProxyConfig 邮件远程图片代理配置。远程图片默认被阻止，用户允许后由服务器代为获取，不向发件人暴露用户的 IP
+type ImageProxyConfig struct {
+	// Enabled 为 false 时远程图片一律阻止，即使发件人在允许列表中
+	Enabled bool
+	// MaxSizeMB 单张图片的大小上限（MB）
+	MaxSizeMB int
+}
+
+// AttachmentConfig 邮件附件下载配置
+type AttachmentConfig struct {
+	// MaxSizeMB 单个附件的下载大小上限（MB），超过时返回 413
+	MaxSizeMB int
+}
+
+// FaviconConfig 服务器端获取并缓存网站图标
+type FaviconConfig struct {
+	// Enabled 为 false 时只返回已缓存的图标，不再访问第三方网站
+	Enabled bool
+	// CacheDays 图标缓存天数，过期后重新获取；获取失败的结果缓存一天
+	CacheDays int
+}
+
+// RateLimitConfig 限流规则，格式为 "次数/时间窗口"（如 "20/1m"），"off" 表示不限流
+type RateLimitConfig struct {
+	Enabled bool
+	// Auth 登录、注册、刷新 token 等认证接口，按 IP
+	Auth string
+	// Login 登录接口，按用户名
+	Login string
+	// API 需要登录的接口，按用户
+	API string
+	// Secret 查看明文密码的接口，按用户
+	Secret string
+}
+
+// SMTPConfig 发送系统邮件（如邮箱验证）使用的 SMTP 中继，Host 为空表示未配置
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string // 发件人地址，例如 "Email Server <noreply@example.com>"
+	// TLSMode 连接方式：starttls（默认，要求服务器支持 STARTTLS）、tls（隐式 TLS，一般为 465 端口）、none（仅限可信的本地中继）
+	TLSMode string
+}
+
+// AdminConfig 管理后台配置
+type AdminConfig struct {
+	// RegistrationMode 注册模式的初始值 (open / invite_only / disabled)，管理员在后台修改后以数据库中的设置为准
+	RegistrationMode string
+	// RequireEmailVerification 自助注册的用户需验证邮箱后才能使用，默认在配置了 SMTP 时开启
+	RequireEmailVerification bool
+	// UserExportDir 删除用户前导出其数据的目录
+	UserExportDir string
+}
+
+// TrashConfig 回收站配置
+type TrashConfig struct {
+	RetentionDays int    // 回收站条目保留天数，<=0 表示永不自动清除
+	PurgeCron     string // 自动清除任务的 cron 表达式
 }
 
 type SecurityConfig struct {
 	EncryptionKey string
+	// LoginLockoutThreshold 连续登录失败多少次后锁定账户，<=0 表示不锁定
+	LoginLockoutThreshold int
+	// LoginLockoutMinutes 首次锁定的时长，此后每多失败一次锁定时长翻倍
+	LoginLockoutMinutes int
+	// LoginLockoutMaxMinutes 单次锁定的最长时长
+	LoginLockoutMaxMinutes int
 }
 
 type BackendConfig struct {
 	BaseURL string
 }
 
+// 支持的数据库驱动
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+)
+
 type DatabaseConfig struct {
-	// DSN string // Kept for potential future use or other DB types
-	File string // For SQLite database file path
+	Driver string // sqlite / postgres / mysql
+	DSN    string // PostgreSQL/MySQL 连接串；SQLite 未设置时使用 File
+	File   string // For SQLite database file path
+
+	// AutoMigrate 为 true 时启动时自动执行未执行的迁移；为 false 时存在未执行的迁移将拒绝启动，
+	// 需先运行 `email_server migrate up`
+	AutoMigrate bool
+	// BackupDir SQLite 执行迁移前自动备份的目录，为空时与数据库文件同目录
+	BackupDir string
+
+	// 连接池配置，<=0 表示使用 database/sql 的默认值
+	MaxOpenConns           int
+	MaxIdleConns           int
+	ConnMaxLifetimeMinutes int
+	ConnMaxIdleTimeMinutes int
 }
 
 type ServerConfig struct {
 	Port string
+	// TrustedProxies 可信的反向代理（IP 或 CIDR）。只有来自这些地址的请求才按 X-Forwarded-For 取客户端 IP，
+	// 为空时直接使用连接的对端地址，否则任何客户端都能伪造 IP 绕过按 IP 的限流
+	TrustedProxies []string
 }
 
 type JWTConfig struct {
@@ -80,10 +229,19 @@ func Init() {
 	// This function now simply reads from the environment.
 	AppConfig = &Config{
 		Database: DatabaseConfig{
-			File: getEnv("SQLITE_FILE", "./gorm.db"),
+			Driver:                 strings.ToLower(getEnv("DB_DRIVER", DriverSQLite)),
+			DSN:                    getEnv("DB_DSN", ""),
+			File:                   getEnv("SQLITE_FILE", "./gorm.db"),
+			AutoMigrate:            getEnvBool("DB_AUTO_MIGRATE", true),
+			BackupDir:              getEnv("DB_BACKUP_DIR", ""),
+			MaxOpenConns:           getEnvInt("DB_MAX_OPEN_CONNS", 0),
+			MaxIdleConns:           getEnvInt("DB_MAX_IDLE_CONNS", 0),
+			ConnMaxLifetimeMinutes: getEnvInt("DB_CONN_MAX_LIFETIME_MINUTES", 0),
+			ConnMaxIdleTimeMinutes: getEnvInt("DB_CONN_MAX_IDLE_TIME_MINUTES", 0),
 		},
 		Server: ServerConfig{
-			Port: getEnv("BACKEND_PORT", "5555"),
+			Port:           getEnv("BACKEND_PORT", "5555"),
+			TrustedProxies: getEnvList("TRUSTED_PROXIES"),
 		},
 		JWT: JWTConfig{
 			SecretKey: getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
@@ -116,9 +274,67 @@ func Init() {
 			BaseURL: getEnv("BACKEND_BASE_URL", "http://localhost:5555"),
 		},
 		Security: SecurityConfig{
-			EncryptionKey: getEnv("ENCRYPTION_KEY", "12345678901234567890123456789012"), // Must be 32 bytes for AES-256
+			EncryptionKey:          getEnv("ENCRYPTION_KEY", "12345678901234567890123456789012"), // Must be 32 bytes for AES-256
+			LoginLockoutThreshold:  getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+			LoginLockoutMinutes:    getEnvInt("LOGIN_LOCKOUT_MINUTES", 1),
+			LoginLockoutMaxMinutes: getEnvInt("LOGIN_LOCKOUT_MAX_MINUTES", 24*60),
+		},
+		Trash: TrashConfig{
+			RetentionDays: getEnvInt("TRASH_RETENTION_DAYS", 30),
+			PurgeCron:     getEnv("TRASH_PURGE_CRON", "0 3 * * *"),
+		},
+		SMTP: SMTPConfig{
+			Host:     getEnv("SMTP_HOST", ""),
+			Port:     getEnvInt("SMTP_PORT", 587),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", ""),
+			TLSMode:  strings.ToLower(getEnv("SMTP_TLS_MODE", "starttls")),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: getEnvBool("RATE_LIMIT_ENABLED", true),
+			Auth:    getEnv("RATE_LIMIT_AUTH", "30/1m"),
+			Login:   getEnv("RATE_LIMIT_LOGIN", "10/15m"),
+			API:     getEnv("RATE_LIMIT_API", "600/1m"),
+			Secret:  getEnv("RATE_LIMIT_SECRET", "20/10m"),
+		},
+		Favicon: FaviconConfig{
+			Enabled:   getEnvBool("FAVICON_FETCH_ENABLED", true),
+			CacheDays: getEnvInt("FAVICON_CACHE_DAYS", 7),
+		},
+		Attachment: AttachmentConfig{
+			MaxSizeMB: getEnvInt("ATTACHMENT_MAX_SIZE_MB", 25),
+		},
+		ImageProxy: ImageProxyConfig{
+			Enabled:   getEnvBool("IMAGE_PROXY_ENABLED", true),
+			MaxSizeMB: getEnvInt("IMAGE_PROXY_MAX_SIZE_MB", 5),
+		},
+		UnifiedInbox: UnifiedInboxConfig{
+			AccountTimeoutSeconds: getEnvInt("UNIFIED_INBOX_ACCOUNT_TIMEOUT_SECONDS", 15),
+			Concurrency:           getEnvInt("UNIFIED_INBOX_CONCURRENCY", 8),
+		},
+		MailWatch: MailWatchConfig{
+			Enabled:             getEnvBool("MAIL_WATCH_ENABLED", true),
+			MaxIMAPConnections:  getEnvInt("MAIL_WATCH_MAX_IMAP_CONNECTIONS", 50),
+			PollIntervalSeconds: getEnvInt("MAIL_WATCH_POLL_INTERVAL_SECONDS", 60),
+			MaxBackoffSeconds:   getEnvInt("MAIL_WATCH_MAX_BACKOFF_SECONDS", 600),
+			EventRetentionDays:  getEnvInt("MAIL_WATCH_EVENT_RETENTION_DAYS", 7),
+			GraphNotifications:  getEnvBool("MAIL_WATCH_GRAPH_NOTIFICATIONS", false),
+		},
+		IMAP: IMAPConfig{
+			DialTimeoutSeconds:          getEnvInt("IMAP_DIAL_TIMEOUT_SECONDS", 15),
+			CommandTimeoutSeconds:       getEnvInt("IMAP_COMMAND_TIMEOUT_SECONDS", 60),
+			PoolIdleTimeoutSeconds:      getEnvInt("IMAP_POOL_IDLE_TIMEOUT_SECONDS", 300),
+			PoolMaxConnectionsPerServer: getEnvInt("IMAP_POOL_MAX_CONNECTIONS_PER_SERVER", 10),
+			PoolMaxIdlePerAccount:       getEnvInt("IMAP_POOL_MAX_IDLE_PER_ACCOUNT", 2),
+			PoolHealthCheckSeconds:      getEnvInt("IMAP_POOL_HEALTH_CHECK_SECONDS", 30),
 		},
 	}
+	AppConfig.Admin = AdminConfig{
+		RegistrationMode:         strings.ToLower(getEnv("REGISTRATION_MODE", "open")),
+		RequireEmailVerification: getEnvBool("REQUIRE_EMAIL_VERIFICATION", AppConfig.SMTP.Host != ""),
+		UserExportDir:            getEnv("USER_EXPORT_DIR", "./exports"),
+	}
 }
 
 func getEnv(key, defaultValue string) string {
@@ -136,3 +352,23 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList 读取逗号分隔的列表，忽略空项
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
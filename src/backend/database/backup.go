@@ -0,0 +1,67 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"email_server/config"
+
+	"gorm.io/gorm"
+)
+
+// sqliteFilePath 从 SQLite 配置中解析数据库文件路径；内存数据库返回空字符串
+func sqliteFilePath(cfg config.DatabaseConfig) string {
+	dsn := cfg.DSN
+	if dsn == "" {
+		dsn = cfg.File
+	}
+	if strings.Contains(dsn, "mode=memory") {
+		return ""
+	}
+	path := strings.TrimPrefix(dsn, "file:")
+	if idx := strings.Index(path, "?"); idx >= 0 {
+		path = path[:idx]
+	}
+	if path == "" || path == ":memory:" {
+		return ""
+	}
+	return path
+}
+
+// BackupSQLite 使用 VACUUM INTO 为 SQLite 数据库生成一致的备份文件，返回备份路径。
+// 非 SQLite、内存数据库或数据库文件尚不存在时不做任何操作，返回空路径。
+func BackupSQLite(db *gorm.DB, cfg config.DatabaseConfig, label string) (string, error) {
+	if db.Dialector.Name() != config.DriverSQLite {
+		return "", nil
+	}
+	path := sqliteFilePath(cfg)
+	if path == "" {
+		return "", nil
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		return "", nil
+	}
+
+	dir := cfg.BackupDir
+	if dir == "" {
+		dir = filepath.Dir(path)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	base := filepath.Join(dir, fmt.Sprintf("%s.%s-%s", filepath.Base(path), label, time.Now().Format("20060102-150405")))
+	backupPath := base + ".bak"
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+			break
+		}
+		backupPath = fmt.Sprintf("%s-%d.bak", base, i)
+	}
+	if err := db.Exec("VACUUM INTO ?", backupPath).Error; err != nil {
+		return "", fmt.Errorf("备份 SQLite 数据库失败: %w", err)
+	}
+	return backupPath, nil
+}
@@ -1,43 +1,52 @@
 package database
 
 import (
+	"fmt"
 	"log"
+	"time"
 
 	"email_server/config"
+	"email_server/database/migrations"
 	"email_server/models"
+	"email_server/search"
 	"email_server/utils"
 
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
-func Init(dbPath string) {
+// Init 按配置连接数据库（SQLite / PostgreSQL / MySQL）并完成迁移与初始化数据
+func Init(cfg config.DatabaseConfig) {
 	var err error
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	DB, err = Open(cfg)
 	if err != nil {
 		log.Fatal("❌ 数据库连接失败:", err)
 	}
 
-	log.Println("✅ 数据库连接成功")
-
-	// 自动迁移数据表
-	err = DB.AutoMigrate(
-		&models.User{},
-		&models.EmailAccount{},
-		&models.Platform{},
-		&models.PlatformRegistration{},
-		&models.ServiceSubscription{},
-		&models.OAuthProvider{},
-		&models.UserOAuthToken{},
-		&models.OAuth2State{},
-	)
+	log.Printf("✅ 数据库连接成功 (%s)", DB.Dialector.Name())
+
+	// 拒绝在比当前程序更新的数据库结构上运行
+	if err := migrations.CheckCompatible(DB); err != nil {
+		log.Fatal("❌ ", err)
+	}
+
+	pending, err := migrations.Pending(DB)
 	if err != nil {
-		log.Fatal("❌ 数据库表自动迁移失败:", err)
+		log.Fatal("❌ 读取迁移状态失败:", err)
+	}
+	if len(pending) > 0 {
+		if !cfg.AutoMigrate {
+			log.Fatalf("❌ 数据库有 %d 个未执行的迁移，请先运行 `email_server migrate up`（或设置 DB_AUTO_MIGRATE=true）", len(pending))
+		}
+		if _, err := MigrateUp(DB, cfg); err != nil {
+			log.Fatal("❌ 数据库迁移失败:", err)
+		}
 	}
-	log.Println("🎉 数据表自动迁移完成")
+
+	// 初始化全文搜索索引
+	search.Init(DB)
 
 	// 创建默认管理员账户
 	createDefaultAdminUser()
@@ -46,6 +55,31 @@ func Init(dbPath string) {
 	seedOAuthProviders()
 }
 
+// MigrateUp 执行所有未执行的迁移；SQLite 在执行前自动备份数据库文件
+func MigrateUp(db *gorm.DB, cfg config.DatabaseConfig) (int, error) {
+	pending, err := migrations.Pending(db)
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+	current, err := migrations.Current(db)
+	if err != nil {
+		return 0, err
+	}
+	if backupPath, err := BackupSQLite(db, cfg, fmt.Sprintf("v%d", current)); err != nil {
+		return 0, err
+	} else if backupPath != "" {
+		log.Printf("💾 迁移前已备份数据库: %s", backupPath)
+	}
+
+	applied, err := migrations.Up(db)
+	if err != nil {
+		return applied, err
+	}
+	latest, _ := migrations.Current(db)
+	log.Printf("🎉 已执行 %d 个迁移，当前数据库版本 %d", applied, latest)
+	return applied, nil
+}
+
 func createDefaultAdminUser() {
 	var adminUser models.User
 	err := DB.Where("username = ?", "admin").First(&adminUser).Error
@@ -56,12 +90,14 @@ func createDefaultAdminUser() {
 				log.Fatalf("❌ 创建默认管理员时密码哈希失败: %v", hashErr)
 				return
 			}
+			now := time.Now()
 			defaultAdmin := models.User{
-				Username: "admin",
-				Email:    "admin@example.com",
-				Password: hashedPassword,
-				Role:     models.RoleAdmin,
-				Status:   models.StatusActive,
+				Username:        "admin",
+				Email:           "admin@example.com",
+				Password:        hashedPassword,
+				Role:            models.RoleAdmin,
+				Status:          models.StatusActive,
+				EmailVerifiedAt: &now,
 			}
 			if createErr := DB.Create(&defaultAdmin).Error; createErr != nil {
 				log.Fatalf("❌ 创建默认管理员账户失败: %v", createErr)
@@ -76,7 +112,8 @@ func createDefaultAdminUser() {
 	}
 }
 
-// seedOAuthProviders 在数据库中创建或更新OAuth提供商的配置
+// seedOAuthProviders 首次启动时根据环境变量创建 Google/Microsoft 提供商。
+// 之后提供商由管理员在后台维护，已存在的记录不会被环境变量覆盖。
 func seedOAuthProviders() {
 	// 从配置中读取提供商信息
 	providers := map[string]config.ProviderConfig{
@@ -92,23 +129,39 @@ func seedOAuthProviders() {
 
 	staticData := map[string]models.OAuthProvider{
 		"google": {
-			AuthURL:    "https://accounts.google.com/o/oauth2/auth",
-			TokenURL:   "https://oauth2.googleapis.com/token",
-			Scopes:     "https://www.googleapis.com/auth/userinfo.email,https://www.googleapis.com/auth/userinfo.profile,https://www.googleapis.com/auth/gmail.readonly",
-			IMAPServer: "imap.gmail.com",
-			IMAPPort:   993,
+			DisplayName: "Google",
+			AuthURL:     "https://accounts.google.com/o/oauth2/auth",
+			TokenURL:    "https://oauth2.googleapis.com/token",
+			UserInfoURL: "https://www.googleapis.com/oauth2/v2/userinfo",
+			Scopes:      "https://www.googleapis.com/auth/userinfo.email,https://www.googleapis.com/auth/userinfo.profile,https://www.googleapis.com/auth/gmail.modify,https://mail.google.com/",
+			IMAPServer:  "imap.gmail.com",
+			IMAPPort:    993,
+			SMTPServer:  "smtp.gmail.com",
+			SMTPPort:    587,
 		},
 		"microsoft": {
-			AuthURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
-			TokenURL: "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+			DisplayName: "Microsoft",
+			AuthURL:     "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+			TokenURL:    "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+			UserInfoURL: "https://graph.microsoft.com/v1.0/me",
 			//Scopes:     "offline_access,User.Read,Mail.Send,IMAP.AccessAsUser.All",
 			Scopes:     "offline_access User.Read Mail.ReadWrite",
 			IMAPServer: "outlook.office365.com",
 			IMAPPort:   993,
+			SMTPServer: "smtp.office365.com",
+			SMTPPort:   587,
 		},
 	}
 
 	for name, config := range providers {
+		var count int64
+		if err := DB.Model(&models.OAuthProvider{}).Where("name = ?", name).Count(&count).Error; err != nil {
+			log.Printf("❌ 查询OAuth提供商 '%s' 失败: %v", name, err)
+			continue
+		}
+		if count > 0 {
+			continue
+		}
 		if config.ClientID == "" || config.ClientSecret == "" {
 			log.Printf("ℹ️ 跳过为 '%s' 播种，因为未在配置文件中提供 ClientID 或 ClientSecret。", name)
 			continue
@@ -120,19 +173,15 @@ func seedOAuthProviders() {
 			continue
 		}
 
-		providerRecord := models.OAuthProvider{
-			Name:                  name,
-			ClientID:              config.ClientID,
-			ClientSecretEncrypted: encryptedSecret,
-			AuthURL:               staticData[name].AuthURL,
-			TokenURL:              staticData[name].TokenURL,
-			Scopes:                staticData[name].Scopes,
-			IMAPServer:            staticData[name].IMAPServer,
-			IMAPPort:              staticData[name].IMAPPort,
-		}
+		providerRecord := staticData[name]
+		providerRecord.Name = name
+		providerRecord.Type = models.OAuthProviderTypeOAuth2
+		providerRecord.ClientID = config.ClientID
+		providerRecord.ClientSecretEncrypted = encryptedSecret
+		providerRecord.Enabled = true
+		providerRecord.MailboxEnabled = true
 
-		// 使用 Assign 和 FirstOrCreate 来创建或更新记录
-		if err := DB.Where(models.OAuthProvider{Name: name}).Assign(providerRecord).FirstOrCreate(&models.OAuthProvider{}).Error; err != nil {
+		if err := DB.Create(&providerRecord).Error; err != nil {
 			log.Printf("❌ 播种OAuth提供商 '%s' 失败: %v", name, err)
 		} else {
 			log.Printf("🌱 OAuth提供商 '%s' 已成功配置。", name)
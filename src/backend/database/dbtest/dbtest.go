@@ -0,0 +1,57 @@
+// Package dbtest 为测试提供数据库连接。
+// 默认使用进程内的 SQLite 内存数据库；设置 TEST_DB_DRIVER=postgres|mysql 和 TEST_DB_DSN
+// 指向本地实例后，同一套测试会在对应数据库上运行（会删除库中所有表后重新迁移，请勿指向生产库）。
+package dbtest
+
+import (
+	"os"
+	"testing"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/database/migrations"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// Driver 返回测试使用的数据库驱动
+func Driver() string {
+	if driver := os.Getenv("TEST_DB_DRIVER"); driver != "" {
+		return driver
+	}
+	return config.DriverSQLite
+}
+
+// Open 打开测试数据库并执行全部迁移，测试结束时关闭连接
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	cfg := config.DatabaseConfig{Driver: Driver(), DSN: os.Getenv("TEST_DB_DSN")}
+	if cfg.Driver == config.DriverSQLite {
+		// 每个测试独立的内存数据库，连接全部关闭后自动销毁
+		cfg.DSN = "file:" + t.Name() + "?mode=memory&cache=shared"
+	} else if cfg.DSN == "" {
+		t.Fatalf("TEST_DB_DRIVER=%s 需要同时设置 TEST_DB_DSN", cfg.Driver)
+	}
+
+	db, err := database.Open(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if cfg.Driver != config.DriverSQLite {
+		// 外部数据库在测试之间共享，先清除上一个测试留下的表
+		tables, err := db.Migrator().GetTables()
+		require.NoError(t, err)
+		for _, table := range tables {
+			require.NoError(t, db.Migrator().DropTable(table))
+		}
+	}
+	_, err = migrations.Up(db)
+	require.NoError(t, err)
+	return db
+}
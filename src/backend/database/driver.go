@@ -0,0 +1,95 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"email_server/config"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// dialectorFor 根据配置选择数据库驱动
+func dialectorFor(cfg config.DatabaseConfig) (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case "", config.DriverSQLite:
+		dsn := cfg.DSN
+		if dsn == "" {
+			dsn = cfg.File
+		}
+		return sqlite.Open(dsn), nil
+	case config.DriverPostgres:
+		if cfg.DSN == "" {
+			return nil, fmt.Errorf("DB_DRIVER=postgres 需要设置 DB_DSN")
+		}
+		return postgres.Open(cfg.DSN), nil
+	case config.DriverMySQL:
+		if cfg.DSN == "" {
+			return nil, fmt.Errorf("DB_DRIVER=mysql 需要设置 DB_DSN")
+		}
+		mysqlCfg, err := mysqldriver.ParseDSN(cfg.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("解析 MySQL DSN 失败: %w", err)
+		}
+		// 模型中的 time.Time 字段需要 parseTime
+		mysqlCfg.ParseTime = true
+		return mysql.New(mysql.Config{
+			DSN:               mysqlCfg.FormatDSN(),
+			DefaultStringSize: 256, // 未指定长度的字符串列（如带索引的用户名）使用 varchar(256)
+		}), nil
+	}
+	return nil, fmt.Errorf("不支持的数据库驱动: %s（可选 sqlite、postgres、mysql）", cfg.Driver)
+}
+
+// Open 按配置打开数据库连接并设置连接池。
+// 开启 TranslateError，使唯一约束冲突在各驱动下统一为 gorm.ErrDuplicatedKey。
+func Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	dialector, err := dialectorFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetimeMinutes > 0 {
+		sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetimeMinutes) * time.Minute)
+	}
+	if cfg.ConnMaxIdleTimeMinutes > 0 {
+		sqlDB.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTimeMinutes) * time.Minute)
+	}
+	return db, nil
+}
+
+// Size 返回数据库占用的字节数（数据与索引）
+func Size(db *gorm.DB) (int64, error) {
+	var query string
+	switch db.Dialector.Name() {
+	case config.DriverSQLite:
+		query = "SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()"
+	case config.DriverPostgres:
+		query = "SELECT pg_database_size(current_database())"
+	case config.DriverMySQL:
+		query = "SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables WHERE table_schema = DATABASE()"
+	default:
+		return 0, fmt.Errorf("不支持的数据库驱动: %s", db.Dialector.Name())
+	}
+	var size int64
+	err := db.Raw(query).Scan(&size).Error
+	return size, err
+}
@@ -0,0 +1,84 @@
+package database_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/database/dbtest"
+	"email_server/models"
+	"email_server/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen_RejectsInvalidConfig(t *testing.T) {
+	_, err := database.Open(config.DatabaseConfig{Driver: "oracle"})
+	assert.Error(t, err)
+
+	_, err = database.Open(config.DatabaseConfig{Driver: config.DriverPostgres})
+	assert.Error(t, err, "postgres 未设置 DSN 时应报错")
+
+	_, err = database.Open(config.DatabaseConfig{Driver: config.DriverMySQL})
+	assert.Error(t, err, "mysql 未设置 DSN 时应报错")
+}
+
+func TestUniqueViolationIsDetected(t *testing.T) {
+	db := dbtest.Open(t)
+
+	require.NoError(t, db.Create(&models.User{Username: "alice", Email: "alice@example.com", Password: "x"}).Error)
+	err := db.Create(&models.User{Username: "alice", Email: "other@example.com", Password: "x"}).Error
+	require.Error(t, err)
+	assert.True(t, utils.IsUniqueConstraintError(err), "unexpected error: %v", err)
+	assert.False(t, utils.IsUniqueConstraintError(assert.AnError))
+}
+
+func TestActiveUniqueIndexIgnoresDeletedRows(t *testing.T) {
+	db := dbtest.Open(t)
+
+	first := models.EmailAccount{UserID: 1, EmailAddress: "me@example.com"}
+	require.NoError(t, db.Create(&first).Error)
+	err := db.Create(&models.EmailAccount{UserID: 1, EmailAddress: "me@example.com"}).Error
+	assert.True(t, utils.IsUniqueConstraintError(err), "unexpected error: %v", err)
+
+	// 软删除后可以重新创建同名记录
+	require.NoError(t, db.Delete(&first).Error)
+	require.NoError(t, db.Create(&models.EmailAccount{UserID: 1, EmailAddress: "me@example.com"}).Error)
+}
+
+func TestBackupSQLite(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DatabaseConfig{Driver: config.DriverSQLite, File: filepath.Join(dir, "app.db"), BackupDir: filepath.Join(dir, "backups")}
+	db, err := database.Open(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	require.NoError(t, db.AutoMigrate(&models.User{}))
+	require.NoError(t, db.Create(&models.User{Username: "alice", Email: "alice@example.com", Password: "x"}).Error)
+
+	first, err := database.BackupSQLite(db, cfg, "v1")
+	require.NoError(t, err)
+	second, err := database.BackupSQLite(db, cfg, "v1")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second, "同一秒内的备份不应互相覆盖")
+	assert.Equal(t, cfg.BackupDir, filepath.Dir(first))
+
+	backup, err := database.Open(config.DatabaseConfig{Driver: config.DriverSQLite, File: first})
+	require.NoError(t, err)
+	var count int64
+	require.NoError(t, backup.Model(&models.User{}).Count(&count).Error)
+	assert.EqualValues(t, 1, count)
+	if sqlDB, err := backup.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	// 内存数据库不做备份
+	path, err := database.BackupSQLite(db, config.DatabaseConfig{Driver: config.DriverSQLite, DSN: "file:x?mode=memory"}, "v1")
+	require.NoError(t, err)
+	assert.Empty(t, path)
+}
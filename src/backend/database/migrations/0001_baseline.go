@@ -0,0 +1,298 @@
+package migrations
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 0001 基线：引入版本化迁移之前由 AutoMigrate 维护的全部表结构。
+// 这里的结构体是当时模型的快照，之后模型的变化不得修改此文件，而应新增迁移。
+// 对于已经由旧版本程序建好表的数据库，AutoMigrate 只会补齐缺失的表/列/索引，可安全重复执行。
+
+type v1User struct {
+	gorm.Model
+	Username    string  `gorm:"uniqueIndex:uq_username,priority:1;not null"`
+	Email       string  `gorm:"uniqueIndex:uq_email,priority:1;not null"`
+	Password    string  `gorm:""`
+	LinuxDoID   *int64  `gorm:"uniqueIndex:uq_linuxdo_id,priority:1"`
+	GoogleID    *string `gorm:"uniqueIndex:uq_google_id,priority:1"`
+	MicrosoftID *string `gorm:"uniqueIndex:uq_microsoft_id,priority:1"`
+	Provider    *string
+	Role        string `gorm:"default:user"`
+	Status      int    `gorm:"default:1"`
+	LastLogin   *time.Time
+}
+
+func (v1User) TableName() string { return "users" }
+
+type v1EmailAccount struct {
+	gorm.Model
+	UserID            uint   `gorm:"not null;index;uniqueIndex:uq_user_email_active,priority:1,where:deleted_at IS NULL"`
+	EmailAddress      string `gorm:"type:varchar(255);not null;uniqueIndex:uq_user_email_active,priority:2"`
+	PasswordEncrypted string `gorm:"type:varchar(255)"`
+	Provider          string `gorm:"type:varchar(100)"`
+	IMAPServer        string `gorm:"type:varchar(255)"`
+	IMAPPort          int    `gorm:"type:int"`
+	Notes             string `gorm:"type:text"`
+	PhoneNumber       string `gorm:"type:varchar(50)"`
+
+	User v1User `gorm:"foreignKey:UserID"`
+}
+
+func (v1EmailAccount) TableName() string { return "email_accounts" }
+
+type v1Platform struct {
+	gorm.Model
+	UserID     uint   `gorm:"not null;uniqueIndex:uq_user_platform_name_active,priority:1,where:deleted_at IS NULL"`
+	Name       string `gorm:"type:varchar(255);not null;uniqueIndex:uq_user_platform_name_active,priority:2"`
+	WebsiteURL string `gorm:"type:varchar(255)"`
+	Notes      string `gorm:"type:text"`
+
+	User v1User `gorm:"foreignKey:UserID"`
+}
+
+func (v1Platform) TableName() string { return "platforms" }
+
+type v1PlatformRegistration struct {
+	gorm.Model
+	UserID                 uint    `gorm:"not null;uniqueIndex:uq_user_platform_loginusername_active,priority:1,where:deleted_at IS NULL;uniqueIndex:uq_user_platform_emailaccountid_active,priority:1,where:deleted_at IS NULL"`
+	EmailAccountID         *uint   `gorm:"uniqueIndex:uq_user_platform_emailaccountid_active,priority:3;constraint:OnDelete:CASCADE"`
+	PlatformID             uint    `gorm:"not null;uniqueIndex:uq_user_platform_loginusername_active,priority:2;uniqueIndex:uq_user_platform_emailaccountid_active,priority:2;constraint:OnDelete:CASCADE"`
+	LoginUsername          *string `gorm:"type:varchar(255);uniqueIndex:uq_user_platform_loginusername_active,priority:3"`
+	LoginPasswordEncrypted string  `gorm:"type:varchar(255)"`
+	Notes                  string  `gorm:"type:text"`
+	PhoneNumber            string  `gorm:"type:varchar(50)"`
+
+	User         v1User          `gorm:"foreignKey:UserID"`
+	EmailAccount *v1EmailAccount `gorm:"foreignKey:EmailAccountID"`
+	Platform     v1Platform      `gorm:"foreignKey:PlatformID"`
+}
+
+func (v1PlatformRegistration) TableName() string { return "platform_registrations" }
+
+type v1ServiceSubscription struct {
+	gorm.Model
+	UserID                 uint   `gorm:"not null;index;uniqueIndex:uq_user_platform_service_active,priority:1,where:deleted_at IS NULL"`
+	PlatformRegistrationID uint   `gorm:"not null;index;constraint:OnDelete:CASCADE;uniqueIndex:uq_user_platform_service_active,priority:2"`
+	ServiceName            string `gorm:"type:varchar(255);not null;uniqueIndex:uq_user_platform_service_active,priority:3"`
+	Description            string `gorm:"type:text"`
+	Status                 string `gorm:"type:varchar(50)"`
+	Cost                   float64
+	BillingCycle           string     `gorm:"type:varchar(50)"`
+	NextRenewalDate        *time.Time `gorm:"type:date"`
+	PaymentMethodNotes     string     `gorm:"type:text"`
+	IsRead                 bool       `gorm:"default:false"`
+
+	User                 v1User                 `gorm:"foreignKey:UserID"`
+	PlatformRegistration v1PlatformRegistration `gorm:"foreignKey:PlatformRegistrationID"`
+}
+
+func (v1ServiceSubscription) TableName() string { return "service_subscriptions" }
+
+type v1OAuthProvider struct {
+	ID                    uint      `gorm:"primaryKey;autoIncrement"`
+	Name                  string    `gorm:"type:varchar(50);not null;unique"`
+	ClientID              string    `gorm:"type:varchar(255);not null"`
+	ClientSecretEncrypted string    `gorm:"type:varchar(512);not null"`
+	AuthURL               string    `gorm:"type:varchar(255);not null"`
+	TokenURL              string    `gorm:"type:varchar(255);not null"`
+	Scopes                string    `gorm:"type:text;not null"`
+	IMAPServer            string    `gorm:"type:varchar(255);not null;default:''"`
+	IMAPPort              int       `gorm:"not null;default:0"`
+	CreatedAt             time.Time `gorm:"autoCreateTime"`
+	UpdatedAt             time.Time `gorm:"autoUpdateTime"`
+}
+
+func (v1OAuthProvider) TableName() string { return "o_auth_providers" }
+
+type v1UserOAuthToken struct {
+	ID                    uint      `gorm:"primaryKey;autoIncrement"`
+	UserID                uint      `gorm:"not null"`
+	EmailAccountID        uint      `gorm:"not null"`
+	ProviderID            uint      `gorm:"not null"`
+	AccessTokenEncrypted  string    `gorm:"type:varchar(2048);not null"`
+	RefreshTokenEncrypted string    `gorm:"type:varchar(2048)"`
+	TokenType             string    `gorm:"type:varchar(50);default:'Bearer'"`
+	Expiry                time.Time `gorm:"not null"`
+	CreatedAt             time.Time `gorm:"autoCreateTime"`
+	UpdatedAt             time.Time `gorm:"autoUpdateTime"`
+
+	User         v1User          `gorm:"foreignKey:UserID"`
+	EmailAccount v1EmailAccount  `gorm:"foreignKey:EmailAccountID"`
+	Provider     v1OAuthProvider `gorm:"foreignKey:ProviderID"`
+}
+
+func (v1UserOAuthToken) TableName() string { return "user_o_auth_tokens" }
+
+type v1OAuth2State struct {
+	State        string `gorm:"primaryKey"`
+	UserID       uint
+	AccountID    uint
+	PKCEVerifier string `gorm:"type:text"`
+	ExpiresAt    time.Time
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+func (v1OAuth2State) TableName() string { return "o_auth2_states" }
+
+type v1RevisionHistory struct {
+	gorm.Model
+	UserID            uint   `gorm:"not null;index"`
+	EntityType        string `gorm:"type:varchar(50);not null;index:idx_revision_entity,priority:1"`
+	EntityID          uint   `gorm:"not null;index:idx_revision_entity,priority:2"`
+	Action            string `gorm:"type:varchar(20);not null;default:'update'"`
+	ChangedByID       uint   `gorm:"not null"`
+	ChangedByUsername string `gorm:"type:varchar(255)"`
+	ChangedFields     string `gorm:"type:text"`
+	Snapshot          string `gorm:"type:text"`
+}
+
+func (v1RevisionHistory) TableName() string { return "revision_histories" }
+
+type v1SearchDocument struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"not null;index"`
+	EntityType     string `gorm:"type:varchar(50);not null;uniqueIndex:uq_search_entity,priority:1"`
+	EntityID       uint   `gorm:"not null;uniqueIndex:uq_search_entity,priority:2"`
+	PlatformID     uint   `gorm:"index"`
+	EmailAccountID uint   `gorm:"index"`
+	Title          string `gorm:"type:text"`
+	Body           string `gorm:"type:text"`
+	Platform       string `gorm:"type:text"`
+	Tags           string `gorm:"type:text"`
+	Sender         string `gorm:"type:text"`
+	UpdatedAt      time.Time
+}
+
+func (v1SearchDocument) TableName() string { return "search_documents" }
+
+type v1CachedEmail struct {
+	ID             uint      `gorm:"primaryKey"`
+	UserID         uint      `gorm:"not null;index"`
+	EmailAccountID uint      `gorm:"not null;uniqueIndex:uq_cached_email_message,priority:1"`
+	MessageID      string    `gorm:"type:varchar(512);not null;uniqueIndex:uq_cached_email_message,priority:2"`
+	Folder         string    `gorm:"type:varchar(255)"`
+	Subject        string    `gorm:"type:text"`
+	FromName       string    `gorm:"type:varchar(255)"`
+	FromAddress    string    `gorm:"type:varchar(255);index"`
+	Snippet        string    `gorm:"type:text"`
+	Body           string    `gorm:"type:text"`
+	Date           time.Time `gorm:"index"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (v1CachedEmail) TableName() string { return "cached_emails" }
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "baseline",
+		Up: func(tx *gorm.DB) error {
+			err := tx.AutoMigrate(
+				&v1User{},
+				&v1EmailAccount{},
+				&v1Platform{},
+				&v1PlatformRegistration{},
+				&v1ServiceSubscription{},
+				&v1OAuthProvider{},
+				&v1UserOAuthToken{},
+				&v1OAuth2State{},
+				&v1RevisionHistory{},
+				&v1SearchDocument{},
+				&v1CachedEmail{},
+			)
+			if err != nil {
+				return err
+			}
+			if err := dropLegacyUniqueIndexes(tx); err != nil {
+				return err
+			}
+			if tx.Dialector.Name() == "mysql" {
+				return ensureMySQLActiveUniqueIndexes(tx)
+			}
+			return nil
+		},
+		// 基线不可回滚
+	})
+}
+
+// dropLegacyUniqueIndexes 删除不含 "deleted_at IS NULL" 条件的旧唯一索引，
+// 否则回收站中的记录会阻止用户重新创建同名的邮箱/平台/注册信息/订阅。
+func dropLegacyUniqueIndexes(tx *gorm.DB) error {
+	legacy := []struct {
+		model interface{}
+		name  string
+	}{
+		{&v1EmailAccount{}, "uq_user_email"},
+		{&v1Platform{}, "uq_user_platform_name"},
+		{&v1PlatformRegistration{}, "uq_user_platform_loginusername"},
+		{&v1PlatformRegistration{}, "uq_user_platform_emailaccountid"},
+		{&v1ServiceSubscription{}, "uq_user_platform_service"},
+	}
+	for _, idx := range legacy {
+		if tx.Migrator().HasIndex(idx.model, idx.name) {
+			if err := tx.Migrator().DropIndex(idx.model, idx.name); err != nil {
+				return fmt.Errorf("删除旧索引 %s 失败: %w", idx.name, err)
+			}
+			log.Printf("🔧 已删除旧索引 %s", idx.name)
+		}
+	}
+	return nil
+}
+
+// ensureMySQLActiveUniqueIndexes MySQL 不支持部分索引，GORM 会忽略 where 条件建成普通唯一索引，
+// 导致回收站中的记录阻止重新创建。这里改为追加函数索引列 IF(deleted_at IS NULL, 1, NULL)：
+// 已删除记录该列为 NULL，不参与唯一性比较。需要 MySQL 8.0.13 及以上版本。
+func ensureMySQLActiveUniqueIndexes(tx *gorm.DB) error {
+	active := []struct {
+		model interface{}
+		name  string
+	}{
+		{&v1EmailAccount{}, "uq_user_email_active"},
+		{&v1Platform{}, "uq_user_platform_name_active"},
+		{&v1PlatformRegistration{}, "uq_user_platform_loginusername_active"},
+		{&v1PlatformRegistration{}, "uq_user_platform_emailaccountid_active"},
+		{&v1ServiceSubscription{}, "uq_user_platform_service_active"},
+	}
+	for _, idx := range active {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(idx.model); err != nil {
+			return err
+		}
+		index := stmt.Schema.LookIndex(idx.name)
+		if index == nil {
+			continue
+		}
+
+		var functional int64
+		err := tx.Raw("SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ? AND expression IS NOT NULL",
+			stmt.Schema.Table, idx.name).Scan(&functional).Error
+		if err != nil {
+			return err
+		}
+		if functional > 0 {
+			continue
+		}
+
+		if tx.Migrator().HasIndex(idx.model, idx.name) {
+			if err := tx.Migrator().DropIndex(idx.model, idx.name); err != nil {
+				return err
+			}
+		}
+		columns := make([]string, 0, len(index.Fields)+1)
+		for _, f := range index.Fields {
+			columns = append(columns, "`"+f.DBName+"`")
+		}
+		columns = append(columns, "(IF(`deleted_at` IS NULL, 1, NULL))")
+		createSQL := fmt.Sprintf("CREATE UNIQUE INDEX `%s` ON `%s` (%s)", idx.name, stmt.Schema.Table, strings.Join(columns, ", "))
+		if err := tx.Exec(createSQL).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
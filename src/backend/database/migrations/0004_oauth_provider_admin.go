@@ -0,0 +1,73 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// v4OAuthProvider 管理员可配置的 OAuth 提供商：类型、OIDC 发现地址、用途开关及 SMTP 信息
+type v4OAuthProvider struct {
+	ID             uint   `gorm:"primaryKey;autoIncrement"`
+	DisplayName    string `gorm:"type:varchar(100);not null;default:''"`
+	Type           string `gorm:"type:varchar(20);not null;default:'oauth2'"`
+	IssuerURL      string `gorm:"type:varchar(255);not null;default:''"`
+	UserInfoURL    string `gorm:"type:varchar(255);not null;default:''"`
+	SMTPServer     string `gorm:"type:varchar(255);not null;default:''"`
+	SMTPPort       int    `gorm:"not null;default:0"`
+	Enabled        bool   `gorm:"not null;default:true"`
+	LoginEnabled   bool   `gorm:"not null;default:false"`
+	MailboxEnabled bool   `gorm:"not null;default:true"`
+}
+
+func (v4OAuthProvider) TableName() string { return "o_auth_providers" }
+
+// v4OAuth2State 记录发起流程的提供商和 OIDC nonce
+type v4OAuth2State struct {
+	State    string `gorm:"primaryKey"`
+	Provider string `gorm:"type:varchar(50);not null;default:''"`
+	Nonce    string `gorm:"type:varchar(64);not null;default:''"`
+}
+
+func (v4OAuth2State) TableName() string { return "o_auth2_states" }
+
+var (
+	v4ProviderColumns = []string{"DisplayName", "Type", "IssuerURL", "UserInfoURL", "SMTPServer", "SMTPPort", "Enabled", "LoginEnabled", "MailboxEnabled"}
+	v4StateColumns    = []string{"Provider", "Nonce"}
+)
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "oauth_provider_admin",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v4OAuthProvider{}, v4ProviderColumns...); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &v4OAuth2State{}, v4StateColumns...); err != nil {
+				return err
+			}
+			// 原先硬编码的提供商补齐用户信息地址和 SMTP 信息
+			builtin := []struct {
+				name, displayName, userInfoURL, smtpServer string
+			}{
+				{"google", "Google", "https://www.googleapis.com/oauth2/v2/userinfo", "smtp.gmail.com"},
+				{"microsoft", "Microsoft", "https://graph.microsoft.com/v1.0/me", "smtp.office365.com"},
+			}
+			for _, p := range builtin {
+				err := tx.Table("o_auth_providers").Where("name = ?", p.name).Updates(map[string]interface{}{
+					"display_name":  p.displayName,
+					"user_info_url": p.userInfoURL,
+					"smtp_server":   p.smtpServer,
+					"smtp_port":     587,
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Table("o_auth_providers").Where("display_name = ''").Update("display_name", gorm.Expr("name")).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, &v4OAuth2State{}, v4StateColumns...); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v4OAuthProvider{}, v4ProviderColumns...)
+		},
+	})
+}
@@ -0,0 +1,138 @@
+package migrations
+
+import (
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v5UserIdentity 用户绑定的外部登录身份
+type v5UserIdentity struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      uint   `gorm:"not null;index"`
+	Provider    string `gorm:"type:varchar(50);not null;uniqueIndex:uq_identity_provider_subject,priority:1"`
+	Subject     string `gorm:"type:varchar(255);not null;uniqueIndex:uq_identity_provider_subject,priority:2"`
+	Email       string `gorm:"type:varchar(255);not null;default:''"`
+	LastLoginAt *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (v5UserIdentity) TableName() string { return "user_identities" }
+
+// v5PendingIdentityLink 邮箱冲突时等待用户确认绑定的身份
+type v5PendingIdentityLink struct {
+	Token     string    `gorm:"primaryKey;type:varchar(64)"`
+	Provider  string    `gorm:"type:varchar(50);not null"`
+	Subject   string    `gorm:"type:varchar(255);not null"`
+	Email     string    `gorm:"type:varchar(255);not null;default:''"`
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+func (v5PendingIdentityLink) TableName() string { return "pending_identity_links" }
+
+// v5User users 表上原有的固定身份字段，迁移后由 user_identities 取代
+type v5User struct {
+	ID          uint
+	Email       string
+	LinuxDoID   *int64  `gorm:"uniqueIndex:uq_linuxdo_id,priority:1"`
+	GoogleID    *string `gorm:"uniqueIndex:uq_google_id,priority:1"`
+	MicrosoftID *string `gorm:"uniqueIndex:uq_microsoft_id,priority:1"`
+}
+
+func (v5User) TableName() string { return "users" }
+
+var (
+	v5UserIdentityColumns = []string{"LinuxDoID", "GoogleID", "MicrosoftID"}
+	v5UserIdentityIndexes = []string{"uq_linuxdo_id", "uq_google_id", "uq_microsoft_id"}
+)
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "user_identities",
+		Up: func(tx *gorm.DB) error {
+			for _, model := range []interface{}{&v5UserIdentity{}, &v5PendingIdentityLink{}} {
+				if tx.Migrator().HasTable(model) {
+					continue
+				}
+				if err := tx.Migrator().CreateTable(model); err != nil {
+					return err
+				}
+			}
+
+			// 已删除用户的身份不迁移，避免占用 (provider, subject) 唯一约束
+			var users []v5User
+			if err := tx.Where("deleted_at IS NULL").Find(&users).Error; err != nil {
+				return err
+			}
+			var identities []v5UserIdentity
+			for _, u := range users {
+				if u.LinuxDoID != nil {
+					identities = append(identities, v5UserIdentity{UserID: u.ID, Provider: "linuxdo", Subject: strconv.FormatInt(*u.LinuxDoID, 10), Email: u.Email})
+				}
+				if u.GoogleID != nil && *u.GoogleID != "" {
+					identities = append(identities, v5UserIdentity{UserID: u.ID, Provider: "google", Subject: *u.GoogleID, Email: u.Email})
+				}
+				if u.MicrosoftID != nil && *u.MicrosoftID != "" {
+					identities = append(identities, v5UserIdentity{UserID: u.ID, Provider: "microsoft", Subject: *u.MicrosoftID, Email: u.Email})
+				}
+			}
+			if len(identities) > 0 {
+				if err := tx.CreateInBatches(&identities, 100).Error; err != nil {
+					return err
+				}
+			}
+
+			for _, index := range v5UserIdentityIndexes {
+				if tx.Migrator().HasIndex(&v5User{}, index) {
+					if err := tx.Migrator().DropIndex(&v5User{}, index); err != nil {
+						return err
+					}
+				}
+			}
+			return dropColumns(tx, &v5User{}, v5UserIdentityColumns...)
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v5User{}, v5UserIdentityColumns...); err != nil {
+				return err
+			}
+
+			// 每个用户每个内置提供商只能回填一个身份，管理员配置的提供商的身份无法保留
+			var identities []v5UserIdentity
+			if err := tx.Where("provider IN ?", []string{"linuxdo", "google", "microsoft"}).Order("id").Find(&identities).Error; err != nil {
+				return err
+			}
+			for _, identity := range identities {
+				column, value := "", interface{}(identity.Subject)
+				switch identity.Provider {
+				case "linuxdo":
+					id, err := strconv.ParseInt(identity.Subject, 10, 64)
+					if err != nil {
+						continue
+					}
+					column, value = "linux_do_id", id
+				case "google":
+					column = "google_id"
+				case "microsoft":
+					column = "microsoft_id"
+				}
+				err := tx.Model(&v5User{}).Where("id = ? AND "+column+" IS NULL", identity.UserID).Update(column, value).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			for _, index := range v5UserIdentityIndexes {
+				if !tx.Migrator().HasIndex(&v5User{}, index) {
+					if err := tx.Migrator().CreateIndex(&v5User{}, index); err != nil {
+						return err
+					}
+				}
+			}
+			return tx.Migrator().DropTable(&v5PendingIdentityLink{}, &v5UserIdentity{})
+		},
+	})
+}
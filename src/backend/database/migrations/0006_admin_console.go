@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v6User 管理员可要求用户下次登录后修改密码
+type v6User struct {
+	ID                 uint
+	MustChangePassword bool `gorm:"not null;default:false"`
+}
+
+func (v6User) TableName() string { return "users" }
+
+// v6UserOAuthToken 记录令牌刷新/认证失败，供系统状态展示
+type v6UserOAuthToken struct {
+	ID           uint   `gorm:"primaryKey"`
+	FailureCount int    `gorm:"not null;default:0"`
+	LastError    string `gorm:"type:varchar(500);not null;default:''"`
+	LastErrorAt  *time.Time
+}
+
+func (v6UserOAuthToken) TableName() string { return "user_o_auth_tokens" }
+
+// v6SystemSetting 运行时可修改的系统设置
+type v6SystemSetting struct {
+	Key       string `gorm:"primaryKey;type:varchar(100)"`
+	Value     string `gorm:"type:varchar(255);not null;default:''"`
+	UpdatedAt time.Time
+}
+
+func (v6SystemSetting) TableName() string { return "system_settings" }
+
+// v6Invitation 注册邀请
+type v6Invitation struct {
+	ID        uint      `gorm:"primaryKey"`
+	Code      string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Email     string    `gorm:"type:varchar(255);not null;default:''"`
+	Role      string    `gorm:"type:varchar(20);not null;default:'user'"`
+	CreatedBy uint      `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	UsedBy    *uint
+	CreatedAt time.Time
+}
+
+func (v6Invitation) TableName() string { return "invitations" }
+
+var v6TokenColumns = []string{"FailureCount", "LastError", "LastErrorAt"}
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "admin_console",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v6User{}, "MustChangePassword"); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &v6UserOAuthToken{}, v6TokenColumns...); err != nil {
+				return err
+			}
+			for _, model := range []interface{}{&v6SystemSetting{}, &v6Invitation{}} {
+				if tx.Migrator().HasTable(model) {
+					continue
+				}
+				if err := tx.Migrator().CreateTable(model); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&v6Invitation{}, &v6SystemSetting{}); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &v6UserOAuthToken{}, v6TokenColumns...); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v6User{}, "MustChangePassword")
+		},
+	})
+}
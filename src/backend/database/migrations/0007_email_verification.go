@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v7User 记录邮箱验证时间
+type v7User struct {
+	ID              uint
+	EmailVerifiedAt *time.Time
+}
+
+func (v7User) TableName() string { return "users" }
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "email_verification",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v7User{}, "EmailVerifiedAt"); err != nil {
+				return err
+			}
+			// 开启邮箱验证前已存在的用户视为已验证，避免升级后被限制使用
+			return tx.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v7User{}, "EmailVerifiedAt")
+		},
+	})
+}
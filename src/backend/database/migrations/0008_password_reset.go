@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v8User 登录 token 版本，重置密码后递增以吊销已签发的 token
+type v8User struct {
+	ID           uint
+	TokenVersion uint `gorm:"not null;default:0"`
+}
+
+func (v8User) TableName() string { return "users" }
+
+// v8PasswordResetToken 找回密码的一次性 token
+type v8PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Email     string    `gorm:"type:varchar(255);not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (v8PasswordResetToken) TableName() string { return "password_reset_tokens" }
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "password_reset",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v8User{}, "TokenVersion"); err != nil {
+				return err
+			}
+			if tx.Migrator().HasTable(&v8PasswordResetToken{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&v8PasswordResetToken{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&v8PasswordResetToken{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v8User{}, "TokenVersion")
+		},
+	})
+}
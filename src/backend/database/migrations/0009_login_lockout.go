@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v9User 连续登录失败计数与账户锁定
+type v9User struct {
+	ID                  uint
+	FailedLoginAttempts int `gorm:"not null;default:0"`
+	LockedUntil         *time.Time
+}
+
+func (v9User) TableName() string { return "users" }
+
+var v9UserColumns = []string{"FailedLoginAttempts", "LockedUntil"}
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "login_lockout",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v9User{}, v9UserColumns...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v9User{}, v9UserColumns...)
+		},
+	})
+}
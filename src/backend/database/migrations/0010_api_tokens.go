@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v10APIToken 个人 API token
+type v10APIToken struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"not null;index"`
+	Name       string `gorm:"type:varchar(100);not null"`
+	TokenHash  string `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Hint       string `gorm:"type:varchar(20);not null"`
+	Scopes     string `gorm:"type:varchar(500);not null"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	LastUsedIP string `gorm:"type:varchar(64);not null;default:''"`
+	CreatedAt  time.Time
+}
+
+func (v10APIToken) TableName() string { return "api_tokens" }
+
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "api_tokens",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasTable(&v10APIToken{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&v10APIToken{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v10APIToken{})
+		},
+	})
+}
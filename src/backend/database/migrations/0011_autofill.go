@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v11Platform 平台的其他登录网址或 App ID
+type v11Platform struct {
+	ID            uint
+	AlternateURLs string `gorm:"type:text"`
+}
+
+func (v11Platform) TableName() string { return "platforms" }
+
+// v11PlatformRegistration 平台注册信息的 TOTP 密钥
+type v11PlatformRegistration struct {
+	ID                  uint
+	TOTPSecretEncrypted string `gorm:"type:varchar(255)"`
+}
+
+func (v11PlatformRegistration) TableName() string { return "platform_registrations" }
+
+// v11EquivalentDomain 用户自定义的等价域名组
+type v11EquivalentDomain struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	Domains   string `gorm:"type:text;not null"`
+	CreatedAt time.Time
+}
+
+func (v11EquivalentDomain) TableName() string { return "equivalent_domains" }
+
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "autofill",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v11Platform{}, "AlternateURLs"); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &v11PlatformRegistration{}, "TOTPSecretEncrypted"); err != nil {
+				return err
+			}
+			if tx.Migrator().HasTable(&v11EquivalentDomain{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&v11EquivalentDomain{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&v11EquivalentDomain{}); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &v11PlatformRegistration{}, "TOTPSecretEncrypted"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v11Platform{}, "AlternateURLs")
+		},
+	})
+}
@@ -0,0 +1,86 @@
+package migrations
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v12PlatformURL 平台的网址及匹配方式，取代 platforms.alternate_urls
+type v12PlatformURL struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"not null;index"`
+	PlatformID uint   `gorm:"not null;index"`
+	URL        string `gorm:"type:varchar(2048);not null"`
+	MatchMode  string `gorm:"type:varchar(20);not null;default:'base_domain'"`
+	CreatedAt  time.Time
+}
+
+func (v12PlatformURL) TableName() string { return "platform_urls" }
+
+// v12Platform 迁移前后的平台其他网址
+type v12Platform struct {
+	ID            uint
+	UserID        uint
+	AlternateURLs string `gorm:"type:text"`
+}
+
+func (v12Platform) TableName() string { return "platforms" }
+
+func init() {
+	register(Migration{
+		Version: 12,
+		Name:    "platform_urls",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasTable(&v12PlatformURL{}) {
+				if err := tx.Migrator().CreateTable(&v12PlatformURL{}); err != nil {
+					return err
+				}
+			}
+			if !tx.Migrator().HasColumn(&v12Platform{}, "AlternateURLs") {
+				return nil
+			}
+
+			// 每行一个的其他网址按 base_domain 迁移到 platform_urls
+			var platforms []v12Platform
+			if err := tx.Unscoped().Where("alternate_urls IS NOT NULL AND alternate_urls <> ''").Find(&platforms).Error; err != nil {
+				return err
+			}
+			now := time.Now()
+			for _, p := range platforms {
+				for _, line := range strings.Split(p.AlternateURLs, "\n") {
+					if line = strings.TrimSpace(line); line == "" {
+						continue
+					}
+					row := v12PlatformURL{UserID: p.UserID, PlatformID: p.ID, URL: line, MatchMode: "base_domain", CreatedAt: now}
+					if err := tx.Create(&row).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return dropColumns(tx, &v12Platform{}, "AlternateURLs")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v12Platform{}, "AlternateURLs"); err != nil {
+				return err
+			}
+			if tx.Migrator().HasTable(&v12PlatformURL{}) {
+				var rows []v12PlatformURL
+				if err := tx.Order("platform_id, id").Find(&rows).Error; err != nil {
+					return err
+				}
+				byPlatform := map[uint][]string{}
+				for _, row := range rows {
+					byPlatform[row.PlatformID] = append(byPlatform[row.PlatformID], row.URL)
+				}
+				for platformID, urls := range byPlatform {
+					if err := tx.Model(&v12Platform{}).Where("id = ?", platformID).Update("alternate_urls", strings.Join(urls, "\n")).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return tx.Migrator().DropTable(&v12PlatformURL{})
+		},
+	})
+}
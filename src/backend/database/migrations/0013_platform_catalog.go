@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v13CatalogPlatform 管理员维护的共享平台目录
+type v13CatalogPlatform struct {
+	ID                uint   `gorm:"primaryKey"`
+	Name              string `gorm:"type:varchar(100);not null;uniqueIndex"`
+	Domains           string `gorm:"type:text;not null"`
+	Category          string `gorm:"type:varchar(50)"`
+	IconURL           string `gorm:"type:varchar(2048)"`
+	SignupURL         string `gorm:"type:varchar(2048)"`
+	PasswordChangeURL string `gorm:"type:varchar(2048)"`
+	TwoFactorMethods  string `gorm:"type:varchar(255)"`
+	BillingCycles     string `gorm:"type:varchar(255)"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+func (v13CatalogPlatform) TableName() string { return "catalog_platforms" }
+
+// v13Favicon 服务器缓存的网站图标
+type v13Favicon struct {
+	ID          uint   `gorm:"primaryKey"`
+	Domain      string `gorm:"type:varchar(255);not null;uniqueIndex"`
+	ContentType string `gorm:"type:varchar(100)"`
+	Data        []byte
+	Missing     bool `gorm:"not null;default:false"`
+	FetchedAt   time.Time
+}
+
+func (v13Favicon) TableName() string { return "favicons" }
+
+// v13Platform 平台关联的目录条目
+type v13Platform struct {
+	ID                uint
+	CatalogPlatformID *uint `gorm:"index"`
+}
+
+func (v13Platform) TableName() string { return "platforms" }
+
+func init() {
+	register(Migration{
+		Version: 13,
+		Name:    "platform_catalog",
+		Up: func(tx *gorm.DB) error {
+			for _, table := range []interface{}{&v13CatalogPlatform{}, &v13Favicon{}} {
+				if tx.Migrator().HasTable(table) {
+					continue
+				}
+				if err := tx.Migrator().CreateTable(table); err != nil {
+					return err
+				}
+			}
+			if err := addColumns(tx, &v13Platform{}, "CatalogPlatformID"); err != nil {
+				return err
+			}
+			if tx.Migrator().HasIndex(&v13Platform{}, "CatalogPlatformID") {
+				return nil
+			}
+			return tx.Migrator().CreateIndex(&v13Platform{}, "CatalogPlatformID")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, &v13Platform{}, "CatalogPlatformID"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropTable(&v13Favicon{}); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&v13CatalogPlatform{})
+		},
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// v14CachedEmail 缓存邮件的 Message-ID 头，IMAP 邮件ID改为 文件夹+UIDVALIDITY+UID 后用于重新定位
+type v14CachedEmail struct {
+	ID                uint
+	InternetMessageID string `gorm:"type:varchar(512);index"`
+}
+
+func (v14CachedEmail) TableName() string { return "cached_emails" }
+
+func init() {
+	register(Migration{
+		Version: 14,
+		Name:    "imap_message_ids",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v14CachedEmail{}, "InternetMessageID"); err != nil {
+				return err
+			}
+			if tx.Migrator().HasIndex(&v14CachedEmail{}, "InternetMessageID") {
+				return nil
+			}
+			return tx.Migrator().CreateIndex(&v14CachedEmail{}, "InternetMessageID")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v14CachedEmail{}, "InternetMessageID")
+		},
+	})
+}
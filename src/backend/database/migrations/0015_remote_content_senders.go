@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v15RemoteContentSender 允许显示远程图片的发件人
+type v15RemoteContentSender struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;uniqueIndex:uq_remote_content_sender,priority:1"`
+	Sender    string `gorm:"type:varchar(255);not null;uniqueIndex:uq_remote_content_sender,priority:2"`
+	CreatedAt time.Time
+}
+
+func (v15RemoteContentSender) TableName() string { return "remote_content_senders" }
+
+func init() {
+	register(Migration{
+		Version: 15,
+		Name:    "remote_content_senders",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasTable(&v15RemoteContentSender{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&v15RemoteContentSender{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v15RemoteContentSender{})
+		},
+	})
+}
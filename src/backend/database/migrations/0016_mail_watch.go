@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v16MailWatch 邮箱账户的新邮件监听
+type v16MailWatch struct {
+	ID                    uint   `gorm:"primaryKey"`
+	UserID                uint   `gorm:"not null;index"`
+	EmailAccountID        uint   `gorm:"not null;uniqueIndex"`
+	Method                string `gorm:"type:varchar(20);not null"`
+	Cursor                string `gorm:"type:text"`
+	EnabledAt             time.Time
+	SubscriptionID        string `gorm:"type:varchar(255);index"`
+	SubscriptionExpiresAt *time.Time
+	ClientState           string `gorm:"type:varchar(64)"`
+	Status                string `gorm:"type:varchar(20)"`
+	LastError             string `gorm:"type:text"`
+	LastCheckedAt         *time.Time
+	LastEventAt           *time.Time
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+}
+
+func (v16MailWatch) TableName() string { return "mail_watches" }
+
+// v16NewMailEvent 监听发现的新邮件
+type v16NewMailEvent struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"not null;index"`
+	EmailAccountID uint   `gorm:"not null;uniqueIndex:uq_new_mail_event,priority:1"`
+	MessageID      string `gorm:"type:varchar(512);not null;uniqueIndex:uq_new_mail_event,priority:2"`
+	ThreadID       string `gorm:"type:varchar(512)"`
+	Subject        string `gorm:"type:varchar(1000)"`
+	FromName       string `gorm:"type:varchar(255)"`
+	FromAddress    string `gorm:"type:varchar(255)"`
+	Snippet        string `gorm:"type:text"`
+	ReceivedAt     time.Time
+	CreatedAt      time.Time `gorm:"index"`
+}
+
+func (v16NewMailEvent) TableName() string { return "new_mail_events" }
+
+func init() {
+	register(Migration{
+		Version: 16,
+		Name:    "mail_watch",
+		Up: func(tx *gorm.DB) error {
+			for _, model := range []interface{}{&v16MailWatch{}, &v16NewMailEvent{}} {
+				if tx.Migrator().HasTable(model) {
+					continue
+				}
+				if err := tx.Migrator().CreateTable(model); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v16NewMailEvent{}, &v16MailWatch{})
+		},
+	})
+}
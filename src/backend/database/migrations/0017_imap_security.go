@@ -0,0 +1,24 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// v17EmailAccount 邮箱账户的 IMAP 加密方式，已有账户为空，按端口推断
+type v17EmailAccount struct {
+	ID           uint
+	IMAPSecurity string `gorm:"type:varchar(16)"`
+}
+
+func (v17EmailAccount) TableName() string { return "email_accounts" }
+
+func init() {
+	register(Migration{
+		Version: 17,
+		Name:    "imap_security",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v17EmailAccount{}, "IMAPSecurity")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v17EmailAccount{}, "IMAPSecurity")
+		},
+	})
+}
@@ -0,0 +1,95 @@
+package migrations
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// addColumns 为已有表添加 model 中声明的字段，已存在的字段跳过
+func addColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropColumns 删除 model 表中的字段，不存在的字段跳过
+func dropColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	indexes, err := sqliteIndexes(tx, model)
+	if err != nil {
+		return err
+	}
+
+	var dropped []string
+	for _, field := range fields {
+		if !tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().DropColumn(model, field); err != nil {
+			return err
+		}
+		dropped = append(dropped, field)
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+	return restoreSQLiteIndexes(tx, model, indexes, dropped)
+}
+
+type sqliteIndex struct {
+	Name string
+	SQL  string `gorm:"column:sql"`
+}
+
+// sqliteIndexes 读取 SQLite 表上显式创建的索引。SQLite 删除字段时 GORM 会重建整张表，
+// 表上的其他索引随之丢失，需要在删除字段后按原语句重新创建。
+func sqliteIndexes(tx *gorm.DB, model interface{}) ([]sqliteIndex, error) {
+	if tx.Dialector.Name() != "sqlite" {
+		return nil, nil
+	}
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	var indexes []sqliteIndex
+	err := tx.Raw("SELECT name, sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", stmt.Schema.Table).Scan(&indexes).Error
+	return indexes, err
+}
+
+// restoreSQLiteIndexes 重新创建丢失的索引，引用已删除字段的索引跳过
+func restoreSQLiteIndexes(tx *gorm.DB, model interface{}, indexes []sqliteIndex, droppedFields []string) error {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	var droppedColumns []string
+	for _, field := range droppedFields {
+		if f := stmt.Schema.LookUpField(field); f != nil {
+			droppedColumns = append(droppedColumns, f.DBName)
+		} else {
+			droppedColumns = append(droppedColumns, field)
+		}
+	}
+
+next:
+	for _, index := range indexes {
+		for _, column := range droppedColumns {
+			if strings.Contains(index.SQL, "`"+column+"`") || strings.Contains(index.SQL, `"`+column+`"`) {
+				continue next
+			}
+		}
+		if tx.Migrator().HasIndex(model, index.Name) {
+			continue
+		}
+		if err := tx.Exec(index.SQL).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+// Package migrations 管理数据库结构的版本化迁移。
+//
+// 每个迁移有唯一且递增的版本号，可以用 Go 编写（在本包中调用 register），
+// 也可以是 sql/ 目录下的 SQL 文件：
+//
+//	NNNN_name.up.sql / NNNN_name.down.sql                  适用于所有驱动
+//	NNNN_name.<driver>.up.sql / NNNN_name.<driver>.down.sql 仅用于 sqlite、postgres 或 mysql，优先于通用文件
+//
+// SQL 文件中每条语句以行尾的分号结束。没有 down 步骤的迁移不可回滚。
+// 已发布的迁移不得再修改；模型结构的任何变化都必须新增一个迁移。
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 一个版本化的迁移步骤
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // nil 表示不可回滚
+}
+
+// SchemaMigration 记录已执行的迁移
+type SchemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time
+}
+
+// TableName 固定表名为 schema_migrations
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status 单个迁移的执行状态
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+var (
+	// ErrSchemaTooNew 数据库结构版本比当前程序已知的最新版本还新
+	ErrSchemaTooNew = errors.New("数据库结构版本高于当前程序支持的版本，请升级程序后再启动")
+	// ErrIrreversible 迁移没有 down 步骤，无法回滚
+	ErrIrreversible = errors.New("迁移不可回滚")
+)
+
+var goMigrations []Migration
+
+// register 注册用 Go 编写的迁移，在各迁移文件的 init 中调用
+func register(m Migration) {
+	goMigrations = append(goMigrations, m)
+}
+
+// All 返回当前驱动下按版本排序的全部迁移
+func All(driver string) ([]Migration, error) {
+	sqlMigrations, err := loadSQLMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+	all := append(append([]Migration{}, goMigrations...), sqlMigrations...)
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	for i := 1; i < len(all); i++ {
+		if all[i].Version == all[i-1].Version {
+			return nil, fmt.Errorf("迁移版本号重复: %d (%s / %s)", all[i].Version, all[i-1].Name, all[i].Name)
+		}
+	}
+	return all, nil
+}
+
+// Latest 返回程序已知的最新迁移版本
+func Latest(driver string) (int64, error) {
+	all, err := All(driver)
+	if err != nil || len(all) == 0 {
+		return 0, err
+	}
+	return all[len(all)-1].Version, nil
+}
+
+func ensureTable(db *gorm.DB) error {
+	return db.AutoMigrate(&SchemaMigration{})
+}
+
+func appliedMigrations(db *gorm.DB) (map[int64]SchemaMigration, error) {
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Current 返回数据库当前的结构版本（已执行的最大版本号），未执行过任何迁移时为 0
+func Current(db *gorm.DB) (int64, error) {
+	if err := ensureTable(db); err != nil {
+		return 0, err
+	}
+	var version *int64
+	if err := db.Model(&SchemaMigration{}).Select("MAX(version)").Scan(&version).Error; err != nil {
+		return 0, err
+	}
+	if version == nil {
+		return 0, nil
+	}
+	return *version, nil
+}
+
+// CheckCompatible 数据库结构比程序已知的版本新时返回 ErrSchemaTooNew，避免旧程序破坏新结构
+func CheckCompatible(db *gorm.DB) error {
+	current, err := Current(db)
+	if err != nil {
+		return err
+	}
+	latest, err := Latest(db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("%w (数据库版本 %d，程序支持到 %d)", ErrSchemaTooNew, current, latest)
+	}
+	return nil
+}
+
+// List 返回所有迁移及其执行状态
+func List(db *gorm.DB) ([]Status, error) {
+	all, err := All(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(all))
+	for _, m := range all {
+		s := Status{Version: m.Version, Name: m.Name}
+		if row, ok := applied[m.Version]; ok {
+			s.Applied = true
+			appliedAt := row.AppliedAt
+			s.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// Pending 返回尚未执行的迁移
+func Pending(db *gorm.DB) ([]Migration, error) {
+	all, err := All(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, m := range all {
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// apply 在事务中执行单个迁移并更新 schema_migrations。
+// 注意 MySQL 的 DDL 会隐式提交事务，失败时可能需要手动处理。
+func apply(db *gorm.DB, m Migration, up bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if up {
+			if err := m.Up(tx); err != nil {
+				return fmt.Errorf("执行迁移 %d_%s 失败: %w", m.Version, m.Name, err)
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		}
+		if m.Down == nil {
+			return fmt.Errorf("%w: %d_%s", ErrIrreversible, m.Version, m.Name)
+		}
+		if err := m.Down(tx); err != nil {
+			return fmt.Errorf("回滚迁移 %d_%s 失败: %w", m.Version, m.Name, err)
+		}
+		return tx.Delete(&SchemaMigration{}, m.Version).Error
+	})
+}
+
+// Up 执行所有未执行的迁移，返回执行的数量
+func Up(db *gorm.DB) (int, error) {
+	if err := CheckCompatible(db); err != nil {
+		return 0, err
+	}
+	pending, err := Pending(db)
+	if err != nil {
+		return 0, err
+	}
+	for i, m := range pending {
+		if err := apply(db, m, true); err != nil {
+			return i, err
+		}
+	}
+	return len(pending), nil
+}
+
+// Down 按版本从新到旧回滚 steps 个已执行的迁移，返回回滚的数量
+func Down(db *gorm.DB, steps int) (int, error) {
+	statuses, err := List(db)
+	if err != nil {
+		return 0, err
+	}
+	all, _ := All(db.Dialector.Name())
+	byVersion := make(map[int64]Migration, len(all))
+	for _, m := range all {
+		byVersion[m.Version] = m
+	}
+
+	done := 0
+	for i := len(statuses) - 1; i >= 0 && done < steps; i-- {
+		if !statuses[i].Applied {
+			continue
+		}
+		if err := apply(db, byVersion[statuses[i].Version], false); err != nil {
+			return done, err
+		}
+		done++
+	}
+	return done, nil
+}
+
+// To 将数据库迁移到指定版本：执行不超过该版本的未执行迁移，并回滚高于该版本的已执行迁移
+func To(db *gorm.DB, version int64) error {
+	if err := CheckCompatible(db); err != nil {
+		return err
+	}
+	statuses, err := List(db)
+	if err != nil {
+		return err
+	}
+	all, _ := All(db.Dialector.Name())
+	known := false
+	for _, m := range all {
+		if m.Version == version {
+			known = true
+		}
+	}
+	if !known && version != 0 {
+		return fmt.Errorf("未知的迁移版本: %d", version)
+	}
+
+	for i := len(statuses) - 1; i >= 0; i-- {
+		if statuses[i].Applied && statuses[i].Version > version {
+			if err := apply(db, all[i], false); err != nil {
+				return err
+			}
+		}
+	}
+	for i, s := range statuses {
+		if !s.Applied && s.Version <= version {
+			if err := apply(db, all[i], true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
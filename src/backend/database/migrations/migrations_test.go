@@ -0,0 +1,228 @@
+package migrations_test
+
+import (
+	"testing"
+	"time"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/database/dbtest"
+	"email_server/database/migrations"
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// allModels 应用使用的全部模型；新增模型时需同时新增迁移并加入此列表
+var allModels = []interface{}{
+	&models.User{},
+	&models.EmailAccount{},
+	&models.Platform{},
+	&models.PlatformRegistration{},
+	&models.ServiceSubscription{},
+	&models.OAuthProvider{},
+	&models.UserOAuthToken{},
+	&models.OAuth2State{},
+	&models.RevisionHistory{},
+	&models.SearchDocument{},
+	&models.CachedEmail{},
+	&models.UserIdentity{},
+	&models.PendingIdentityLink{},
+	&models.SystemSetting{},
+	&models.Invitation{},
+	&models.PasswordResetToken{},
+	&models.APIToken{},
+	&models.EquivalentDomain{},
+	&models.PlatformURL{},
+	&models.CatalogPlatform{},
+	&models.Favicon{},
+	&models.RemoteContentSender{},
+	&models.MailWatch{},
+	&models.NewMailEvent{},
+}
+
+func TestUp_CreatesSchemaMatchingModels(t *testing.T) {
+	db := dbtest.Open(t)
+
+	latest, err := migrations.Latest(db.Dialector.Name())
+	require.NoError(t, err)
+	current, err := migrations.Current(db)
+	require.NoError(t, err)
+	assert.Equal(t, latest, current)
+
+	pending, err := migrations.Pending(db)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// 迁移后的结构必须覆盖模型的所有表和字段
+	for _, model := range allModels {
+		stmt := &gorm.Statement{DB: db}
+		require.NoError(t, stmt.Parse(model))
+		require.True(t, db.Migrator().HasTable(model), "缺少表 %s", stmt.Schema.Table)
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			assert.True(t, db.Migrator().HasColumn(model, field.DBName), "表 %s 缺少字段 %s", stmt.Schema.Table, field.DBName)
+		}
+	}
+
+	// 再次执行不应有任何变化
+	applied, err := migrations.Up(db)
+	require.NoError(t, err)
+	assert.Zero(t, applied)
+}
+
+func TestUp_AdoptsLegacyAutoMigratedDatabase(t *testing.T) {
+	db, err := database.Open(config.DatabaseConfig{Driver: config.DriverSQLite, DSN: "file:" + t.Name() + "?mode=memory&cache=shared"})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	// 引入版本化迁移之前，数据库由 AutoMigrate 直接按模型建表
+	require.NoError(t, db.AutoMigrate(allModels...))
+	require.NoError(t, db.Exec("CREATE TABLE services (id integer PRIMARY KEY)").Error)
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "x"}
+	require.NoError(t, db.Create(&user).Error)
+
+	_, err = migrations.Up(db)
+	require.NoError(t, err)
+
+	var count int64
+	require.NoError(t, db.Model(&models.User{}).Where("username = ?", "alice").Count(&count).Error)
+	assert.EqualValues(t, 1, count, "已有数据应保留")
+	assert.False(t, db.Migrator().HasTable("services"), "遗留表应被删除")
+}
+
+func TestCheckCompatible_RejectsNewerSchema(t *testing.T) {
+	db := dbtest.Open(t)
+	require.NoError(t, migrations.CheckCompatible(db))
+
+	require.NoError(t, db.Create(&migrations.SchemaMigration{Version: 9999, Name: "from_the_future"}).Error)
+	assert.ErrorIs(t, migrations.CheckCompatible(db), migrations.ErrSchemaTooNew)
+
+	_, err := migrations.Up(db)
+	assert.ErrorIs(t, err, migrations.ErrSchemaTooNew)
+}
+
+func TestDownAndTo(t *testing.T) {
+	db := dbtest.Open(t)
+	latest, err := migrations.Latest(db.Dialector.Name())
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, latest, int64(3))
+
+	done, err := migrations.Down(db, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, done)
+	current, _ := migrations.Current(db)
+	assert.Equal(t, latest-1, current)
+
+	require.NoError(t, migrations.To(db, latest))
+	current, _ = migrations.Current(db)
+	assert.Equal(t, latest, current)
+
+	// 基线迁移不可回滚
+	err = migrations.To(db, 0)
+	assert.ErrorIs(t, err, migrations.ErrIrreversible)
+
+	assert.Error(t, migrations.To(db, 9999), "未知版本应报错")
+}
+
+func TestUserIdentities_MovesLegacyProviderColumns(t *testing.T) {
+	db := dbtest.Open(t)
+	require.NoError(t, migrations.To(db, 4))
+
+	require.NoError(t, db.Exec("INSERT INTO users (username, email, password, google_id, linux_do_id, created_at, updated_at) VALUES (?, ?, '', ?, ?, ?, ?)",
+		"alice", "alice@example.com", "g-123", 42, time.Now(), time.Now()).Error)
+	var alice models.User
+	require.NoError(t, db.Where("username = ?", "alice").First(&alice).Error)
+
+	_, err := migrations.Up(db)
+	require.NoError(t, err)
+
+	var identities []models.UserIdentity
+	require.NoError(t, db.Order("provider").Find(&identities).Error)
+	require.Len(t, identities, 2)
+	assert.Equal(t, "google", identities[0].Provider)
+	assert.Equal(t, "g-123", identities[0].Subject)
+	assert.Equal(t, "linuxdo", identities[1].Provider)
+	assert.Equal(t, "42", identities[1].Subject)
+	assert.Equal(t, alice.ID, identities[1].UserID)
+	assert.False(t, db.Migrator().HasColumn("users", "google_id"), "旧字段应被删除")
+	assert.True(t, db.Migrator().HasIndex(&models.User{}, "uq_username"), "删除字段后其他索引应保留")
+	assert.True(t, db.Migrator().HasIndex(&models.User{}, "uq_email"))
+
+	// 回滚时身份写回 users 表
+	require.NoError(t, migrations.To(db, 4))
+	var googleID string
+	require.NoError(t, db.Raw("SELECT google_id FROM users WHERE id = ?", alice.ID).Scan(&googleID).Error)
+	assert.Equal(t, "g-123", googleID)
+	assert.False(t, db.Migrator().HasTable("user_identities"))
+}
+
+func TestList(t *testing.T) {
+	db := dbtest.Open(t)
+	statuses, err := migrations.List(db)
+	require.NoError(t, err)
+	require.NotEmpty(t, statuses)
+	assert.Equal(t, int64(1), statuses[0].Version)
+	assert.Equal(t, "baseline", statuses[0].Name)
+	for _, s := range statuses {
+		assert.True(t, s.Applied, "迁移 %d 应已执行", s.Version)
+		assert.NotNil(t, s.AppliedAt)
+	}
+}
+
+func TestEmailVerification_ExistingUsersAreVerified(t *testing.T) {
+	db := dbtest.Open(t)
+	require.NoError(t, migrations.To(db, 6))
+
+	createdAt := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	require.NoError(t, db.Exec("INSERT INTO users (username, email, password, created_at, updated_at) VALUES (?, ?, '', ?, ?)",
+		"alice", "alice@example.com", createdAt, createdAt).Error)
+
+	_, err := migrations.Up(db)
+	require.NoError(t, err)
+
+	var alice models.User
+	require.NoError(t, db.Where("username = ?", "alice").First(&alice).Error)
+	require.NotNil(t, alice.EmailVerifiedAt, "升级前已存在的用户视为已验证")
+	assert.True(t, alice.EmailVerifiedAt.Equal(createdAt))
+
+	require.NoError(t, migrations.To(db, 6))
+	assert.False(t, db.Migrator().HasColumn("users", "email_verified_at"))
+}
+
+func TestPlatformURLs_MovesAlternateURLs(t *testing.T) {
+	db := dbtest.Open(t)
+	require.NoError(t, migrations.To(db, 11))
+
+	require.NoError(t, db.Exec("INSERT INTO users (username, email, password, created_at, updated_at) VALUES (?, ?, '', ?, ?)",
+		"alice", "alice@example.com", time.Now(), time.Now()).Error)
+	require.NoError(t, db.Exec("INSERT INTO platforms (user_id, name, website_url, alternate_urls, created_at, updated_at) VALUES (1, ?, ?, ?, ?, ?)",
+		"Example", "https://example.com", "https://billing.example-pay.com\n\nandroidapp://com.example.app", time.Now(), time.Now()).Error)
+
+	_, err := migrations.Up(db)
+	require.NoError(t, err)
+
+	var urls []models.PlatformURL
+	require.NoError(t, db.Order("id").Find(&urls).Error)
+	require.Len(t, urls, 2)
+	assert.Equal(t, "https://billing.example-pay.com", urls[0].URL)
+	assert.Equal(t, "base_domain", urls[0].MatchMode)
+	assert.Equal(t, "androidapp://com.example.app", urls[1].URL)
+	assert.Equal(t, uint(1), urls[1].UserID)
+	assert.False(t, db.Migrator().HasColumn("platforms", "alternate_urls"))
+	assert.True(t, db.Migrator().HasIndex(&models.Platform{}, "uq_user_platform_name_active"), "删除字段后其他索引应保留")
+
+	require.NoError(t, migrations.To(db, 11))
+	var alternateURLs string
+	require.NoError(t, db.Raw("SELECT alternate_urls FROM platforms WHERE id = 1").Scan(&alternateURLs).Error)
+	assert.Equal(t, "https://billing.example-pay.com\nandroidapp://com.example.app", alternateURLs)
+	assert.False(t, db.Migrator().HasTable("platform_urls"))
+}
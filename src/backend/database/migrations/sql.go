@@ -0,0 +1,124 @@
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
+// NNNN_name[.driver].(up|down).sql
+var sqlFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+?)(?:\.(sqlite|postgres|mysql))?\.(up|down)\.sql$`)
+
+type sqlMigrationFiles struct {
+	name       string
+	up, down   string // 通用文件
+	driverUp   string // 当前驱动专用文件
+	driverDown string
+	hasDriver  bool // 存在任一驱动的专用文件
+}
+
+// loadSQLMigrations 解析 sql/ 目录中的迁移文件，为指定驱动选择对应的 SQL
+func loadSQLMigrations(driver string) ([]Migration, error) {
+	entries, err := fs.ReadDir(sqlFiles, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*sqlMigrationFiles{}
+	for _, entry := range entries {
+		match := sqlFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("无法识别的迁移文件名: %s", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		content, err := sqlFiles.ReadFile("sql/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		files, ok := byVersion[version]
+		if !ok {
+			files = &sqlMigrationFiles{name: match[2]}
+			byVersion[version] = files
+		} else if files.name != match[2] {
+			return nil, fmt.Errorf("迁移 %d 的文件名不一致: %s / %s", version, files.name, match[2])
+		}
+
+		fileDriver, direction := match[3], match[4]
+		switch {
+		case fileDriver == "" && direction == "up":
+			files.up = string(content)
+		case fileDriver == "" && direction == "down":
+			files.down = string(content)
+		case fileDriver == driver && direction == "up":
+			files.hasDriver = true
+			files.driverUp = string(content)
+		case fileDriver == driver && direction == "down":
+			files.hasDriver = true
+			files.driverDown = string(content)
+		default:
+			files.hasDriver = true // 其他驱动的专用文件
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for version, files := range byVersion {
+		up, down := files.up, files.down
+		if files.driverUp != "" || files.driverDown != "" {
+			up, down = files.driverUp, files.driverDown
+		}
+
+		m := Migration{Version: version, Name: files.name, Up: execSQL(up)}
+		switch {
+		case down != "":
+			m.Down = execSQL(down)
+		case up == "" && files.hasDriver:
+			// 仅为其他驱动提供了 SQL，当前驱动无需任何操作，回滚同样为空操作
+			m.Down = execSQL("")
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations, nil
+}
+
+// splitStatements 按行尾分号切分 SQL 语句，忽略空行和 -- 注释行
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+func execSQL(script string) func(tx *gorm.DB) error {
+	statements := splitStatements(script)
+	return func(tx *gorm.DB) error {
+		for _, stmt := range statements {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
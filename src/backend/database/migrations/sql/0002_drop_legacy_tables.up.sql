@@ -0,0 +1,6 @@
+-- 早期版本的 Email / Service / EmailService 模型已被 EmailAccount / Platform /
+-- PlatformRegistration / ServiceSubscription 取代（见 models/models.go），删除遗留的表。
+-- 不可回滚。
+DROP TABLE IF EXISTS email_services;
+DROP TABLE IF EXISTS services;
+DROP TABLE IF EXISTS emails;
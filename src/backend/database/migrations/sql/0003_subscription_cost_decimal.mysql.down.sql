@@ -0,0 +1 @@
+ALTER TABLE service_subscriptions MODIFY cost double;
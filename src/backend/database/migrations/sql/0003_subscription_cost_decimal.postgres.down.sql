@@ -0,0 +1 @@
+ALTER TABLE service_subscriptions ALTER COLUMN cost TYPE double precision;
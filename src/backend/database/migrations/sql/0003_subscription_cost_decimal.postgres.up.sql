@@ -0,0 +1,2 @@
+-- 订阅费用改为定点小数，避免浮点误差（SQLite 为动态类型，无需修改）
+ALTER TABLE service_subscriptions ALTER COLUMN cost TYPE numeric(10,2) USING round(cost::numeric, 2);
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- 注释
+CREATE TABLE a (
+    id integer
+);
+
+-- 另一条注释
+DROP TABLE b;
+UPDATE c SET d = 1`
+
+	assert.Equal(t, []string{
+		"CREATE TABLE a (\n    id integer\n);",
+		"DROP TABLE b;",
+		"UPDATE c SET d = 1",
+	}, splitStatements(script))
+	assert.Empty(t, splitStatements("\n-- 仅有注释\n"))
+}
+
+func TestLoadSQLMigrations_SelectsDriverFiles(t *testing.T) {
+	for _, driver := range []string{"sqlite", "postgres", "mysql"} {
+		all, err := loadSQLMigrations(driver)
+		require.NoError(t, err)
+		for _, m := range all {
+			assert.NotNil(t, m.Up, "%s: 迁移 %d 缺少 up", driver, m.Version)
+			if m.Version == 3 {
+				// 仅为 postgres/mysql 提供了 SQL，sqlite 上为可回滚的空操作
+				assert.NotNil(t, m.Down, "%s: 迁移 3 应可回滚", driver)
+			}
+		}
+	}
+}
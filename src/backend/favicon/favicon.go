@@ -0,0 +1,222 @@
+// Package favicon 在服务器端获取网站图标：依次尝试指定的图标地址、首页 <link rel="icon"> 声明的图标和 /favicon.ico。
+// 默认拒绝连接内网、回环等地址，避免被用来探测服务器所在的内部网络。
+package favicon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 默认限制
+const (
+	DefaultTimeout  = 5 * time.Second
+	DefaultMaxBytes = 256 << 10 // 图标大小上限
+	maxPageBytes    = 512 << 10 // 读取首页 HTML 的上限
+)
+
+var (
+	// ErrNotFound 网站没有可用的图标
+	ErrNotFound = errors.New("未找到网站图标")
+	// ErrForbiddenAddress 目标解析到内网、回环等不允许访问的地址
+	ErrForbiddenAddress = errors.New("不允许访问的地址")
+)
+
+// Icon 获取到的图标
+type Icon struct {
+	ContentType string
+	Data        []byte
+}
+
+// Fetcher 图标获取器
+type Fetcher struct {
+	Client   *http.Client
+	Scheme   string // 访问网站使用的协议，默认 https
+	MaxBytes int64  // 图标大小上限，<=0 时使用 DefaultMaxBytes
+}
+
+// NewFetcher 创建获取器。allowPrivate 为 false 时拒绝连接内网和回环地址（包括重定向后的地址）
+func NewFetcher(timeout time.Duration, allowPrivate bool) *Fetcher {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = rejectPrivateAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // 经代理访问时无法校验目标地址
+	transport.DialContext = dialer.DialContext
+	return &Fetcher{
+		Client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 5 {
+					return errors.New("重定向次数过多")
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return ErrForbiddenAddress
+				}
+				return nil
+			},
+		},
+		Scheme: "https",
+	}
+}
+
+// rejectPrivateAddress 在建立连接前检查实际连接的 IP，DNS 解析结果在校验后无法再被替换
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// 从首页 HTML 中提取 <link rel="icon" href="..."> 使用的正则
+var (
+	linkTagPattern = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	relPattern     = regexp.MustCompile(`(?is)\brel\s*=\s*["']?([^"'>]+)`)
+	hrefPattern    = regexp.MustCompile(`(?is)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// Fetch 获取主机名 host 的图标。iconURL 不为空时优先尝试该地址
+func (f *Fetcher) Fetch(ctx context.Context, host, iconURL string) (Icon, error) {
+	scheme := f.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	base := &url.URL{Scheme: scheme, Host: host, Path: "/"}
+
+	var candidates []string
+	if iconURL != "" {
+		candidates = append(candidates, iconURL)
+	}
+	candidates = append(candidates, f.declaredIcons(ctx, base)...)
+	candidates = append(candidates, base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String())
+
+	var lastErr error = ErrNotFound
+	seen := map[string]bool{}
+	for _, candidate := range candidates {
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+		icon, err := f.download(ctx, candidate)
+		if err == nil {
+			return icon, nil
+		}
+		lastErr = err
+	}
+	if errors.Is(lastErr, ErrForbiddenAddress) {
+		return Icon{}, lastErr
+	}
+	return Icon{}, fmt.Errorf("%w: %v", ErrNotFound, lastErr)
+}
+
+// FetchImage 下载任意 http(s) 地址的位图图片，供邮件远程图片代理使用
+func (f *Fetcher) FetchImage(ctx context.Context, imageURL string) (Icon, error) {
+	u, err := url.Parse(imageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Icon{}, fmt.Errorf("无效的图片地址: %s", imageURL)
+	}
+	return f.download(ctx, u.String())
+}
+
+// declaredIcons 读取首页中声明的图标地址，失败时返回空列表
+func (f *Fetcher) declaredIcons(ctx context.Context, base *url.URL) []string {
+	body, err := f.get(ctx, base.String(), maxPageBytes)
+	if err != nil {
+		return nil
+	}
+	var icons []string
+	for _, tag := range linkTagPattern.FindAllString(string(body), -1) {
+		rel := relPattern.FindStringSubmatch(tag)
+		if rel == nil || !isIconRel(rel[1]) {
+			continue
+		}
+		href := hrefPattern.FindStringSubmatch(tag)
+		if href == nil {
+			continue
+		}
+		raw := href[1] + href[2] + href[3]
+		ref, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || raw == "" {
+			continue
+		}
+		resolved := base.ResolveReference(ref)
+		if resolved.Scheme == "http" || resolved.Scheme == "https" {
+			icons = append(icons, resolved.String())
+		}
+	}
+	return icons
+}
+
+func isIconRel(rel string) bool {
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if r == "icon" || r == "apple-touch-icon" {
+			return true
+		}
+	}
+	return false
+}
+
+// download 下载图标并按内容判断类型，只接受位图格式（SVG 可能包含脚本，不予缓存）
+func (f *Fetcher) download(ctx context.Context, iconURL string) (Icon, error) {
+	maxBytes := f.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	data, err := f.get(ctx, iconURL, maxBytes)
+	if err != nil {
+		return Icon{}, err
+	}
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/x-icon", "image/vnd.microsoft.icon", "image/png", "image/gif", "image/jpeg", "image/webp", "image/bmp":
+		return Icon{ContentType: contentType, Data: data}, nil
+	}
+	return Icon{}, fmt.Errorf("%s 不是图片 (%s)", iconURL, contentType)
+}
+
+// get 发送 GET 请求，响应超过 limit 时返回错误
+func (f *Fetcher) get(ctx context.Context, target string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "email_server-favicon/1.0")
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrForbiddenAddress) {
+			return nil, ErrForbiddenAddress
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s 返回状态码 %d", target, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s 超过大小限制", target)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s 内容为空", target)
+	}
+	return data, nil
+}
@@ -0,0 +1,104 @@
+package favicon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var gifIcon = []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")
+
+func newTestFetcher(t *testing.T, handler http.HandlerFunc) (*Fetcher, string) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	fetcher := NewFetcher(time.Second, true)
+	fetcher.Scheme = "http"
+	return fetcher, strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestFetch_PrefersDeclaredIcon(t *testing.T) {
+	fetcher, host := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<link href='/img/touch.gif' REL="apple-touch-icon"><link rel=stylesheet href=/a.css>`))
+		case "/img/touch.gif":
+			w.Write(gifIcon)
+		case "/favicon.ico":
+			t.Error("声明了图标时不应请求 /favicon.ico")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	icon, err := fetcher.Fetch(context.Background(), host, "")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if icon.ContentType != "image/gif" || !bytes.Equal(icon.Data, gifIcon) {
+		t.Fatalf("图标不正确: %s %q", icon.ContentType, icon.Data)
+	}
+}
+
+func TestFetch_FallsBackAndRejectsNonImages(t *testing.T) {
+	fetcher, host := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/custom.png":
+			w.Write([]byte("<html>not an image</html>"))
+		case "/favicon.ico":
+			w.Write(gifIcon)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	icon, err := fetcher.Fetch(context.Background(), host, "http://"+host+"/custom.png")
+	if err != nil || !bytes.Equal(icon.Data, gifIcon) {
+		t.Fatalf("应回退到 /favicon.ico: %v", err)
+	}
+
+	fetcher.MaxBytes = 4
+	if _, err := fetcher.Fetch(context.Background(), host, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("超过大小限制时应返回 ErrNotFound，实际 %v", err)
+	}
+}
+
+func TestFetch_RejectsPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(gifIcon)
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(time.Second, false)
+	fetcher.Scheme = "http"
+	_, err := fetcher.Fetch(context.Background(), strings.TrimPrefix(server.URL, "http://"), "")
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("回环地址应被拒绝，实际 %v", err)
+	}
+}
+
+func TestFetchImage(t *testing.T) {
+	fetcher, host := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pixel.gif":
+			w.Write(gifIcon)
+		case "/logo.svg":
+			w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	icon, err := fetcher.FetchImage(context.Background(), "http://"+host+"/pixel.gif")
+	if err != nil || icon.ContentType != "image/gif" {
+		t.Fatalf("FetchImage: %v %s", err, icon.ContentType)
+	}
+	if _, err := fetcher.FetchImage(context.Background(), "http://"+host+"/logo.svg"); err == nil {
+		t.Fatal("SVG 不应被接受")
+	}
+	if _, err := fetcher.FetchImage(context.Background(), "file:///etc/passwd"); err == nil {
+		t.Fatal("非 http(s) 地址应被拒绝")
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -35,8 +36,9 @@ func GetAllUsers(c *gin.Context) {
 	}
 
 	if keyword != "" {
-		likeKeyword := "%" + keyword + "%"
-		dbQuery = dbQuery.Where("username LIKE ? OR email LIKE ?", likeKeyword, likeKeyword)
+		// PostgreSQL 的 LIKE 区分大小写，统一转小写比较
+		likeKeyword := "%" + strings.ToLower(keyword) + "%"
+		dbQuery = dbQuery.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ?", likeKeyword, likeKeyword)
 	}
 
 	// 获取总数
@@ -57,9 +59,10 @@ func GetAllUsers(c *gin.Context) {
 		}
 	}
 
-	userResponses := make([]*models.UserResponse, len(usersDB))
-	for i, u := range usersDB {
-		userResponses[i] = u.ToResponse()
+	userResponses, err := adminUserResponses(usersDB)
+	if err != nil {
+		utils.SendErrorResponse(c, 500, "统计用户数据失败: "+err.Error())
+		return
 	}
 
 	result := map[string]interface{}{
@@ -72,6 +75,60 @@ func GetAllUsers(c *gin.Context) {
 	utils.SendSuccessResponse(c, result)
 }
 
+// adminUserResponses 为用户列表附加每个用户的数据统计（不含回收站中的记录）
+func adminUserResponses(users []*models.User) ([]*models.AdminUserResponse, error) {
+	userIDs := make([]uint, len(users))
+	for i, u := range users {
+		userIDs[i] = u.ID
+	}
+	emailAccountCounts, err := countByUser(&models.EmailAccount{}, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	registrationCounts, err := countByUser(&models.PlatformRegistration{}, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	subscriptionCounts, err := countByUser(&models.ServiceSubscription{}, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]*models.AdminUserResponse, len(users))
+	for i, u := range users {
+		responses[i] = &models.AdminUserResponse{
+			UserResponse:              *u.ToResponse(),
+			EmailAccountCount:         emailAccountCounts[u.ID],
+			PlatformRegistrationCount: registrationCounts[u.ID],
+			ServiceSubscriptionCount:  subscriptionCounts[u.ID],
+			FailedLoginAttempts:       u.FailedLoginAttempts,
+			LockedUntil:               u.LockedUntil,
+		}
+	}
+	return responses, nil
+}
+
+// countByUser 按用户分组统计 model 对应表的记录数
+func countByUser(model interface{}, userIDs []uint) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(userIDs))
+	if len(userIDs) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		UserID uint
+		Count  int64
+	}
+	err := database.DB.Model(model).Select("user_id, COUNT(*) AS count").
+		Where("user_id IN ?", userIDs).Group("user_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.UserID] = row.Count
+	}
+	return counts, nil
+}
+
 // UpdateUserStatus 更新用户状态（管理员功能）
 func UpdateUserStatus(c *gin.Context) {
 	userIDStr := c.Param("id")
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// userDataTable 用户拥有数据的表，export 为 false 的是缓存、索引、凭据等可重建或不应导出的数据
+type userDataTable struct {
+	name   string
+	export bool
+}
+
+// userDataTables 删除用户时需要清理的表，按依赖关系从子表到父表排列
+var userDataTables = []userDataTable{
+	{name: "new_mail_events"},
+	{name: "mail_watches"},
+	{name: "search_documents"},
+	{name: "cached_emails"},
+	{name: "user_o_auth_tokens"},
+	{name: "o_auth2_states"},
+	{name: "password_reset_tokens"},
+	{name: "api_tokens"},
+	{name: "equivalent_domains", export: true},
+	{name: "remote_content_senders", export: true},
+	{name: "user_identities", export: true},
+	{name: "revision_histories", export: true},
+	{name: "service_subscriptions", export: true},
+	{name: "platform_registrations", export: true},
+	{name: "platform_urls", export: true},
+	{name: "platforms", export: true},
+	{name: "email_accounts", export: true},
+}
+
+// exportFileNameSanitizer 导出文件名中只保留安全字符
+var exportFileNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// findUserForAdmin 按路径参数查找用户，失败时已写入响应
+func findUserForAdmin(c *gin.Context) (*models.User, bool) {
+	userID, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的用户ID")
+		return nil, false
+	}
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendErrorResponse(c, http.StatusNotFound, "用户不存在")
+		} else {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "系统错误")
+		}
+		return nil, false
+	}
+	return &user, true
+}
+
+// buildUserExport 导出用户的全部保险库数据（包含回收站中的记录）
+func buildUserExport(db *gorm.DB, user *models.User) (*models.UserDataExport, error) {
+	export := &models.UserDataExport{
+		ExportedAt: time.Now(),
+		User:       user.ToResponse(),
+		Tables:     make(map[string][]map[string]interface{}),
+	}
+	for _, table := range userDataTables {
+		if !table.export {
+			continue
+		}
+		rows := []map[string]interface{}{}
+		if err := db.Table(table.name).Where("user_id = ?", user.ID).Order("id").Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("导出 %s 失败: %w", table.name, err)
+		}
+		export.Tables[table.name] = rows
+	}
+	return export, nil
+}
+
+// writeUserExport 将导出数据写入 USER_EXPORT_DIR，返回文件路径
+func writeUserExport(export *models.UserDataExport) (string, error) {
+	dir := config.AppConfig.Admin.UserExportDir
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("user-%d-%s-%s.json", export.User.ID,
+		exportFileNameSanitizer.ReplaceAllString(export.User.Username, "_"),
+		export.ExportedAt.Format("20060102-150405"))
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// AdminCreateUser 管理员创建用户
+// @Summary 创建用户
+// @Description 未提供密码时生成临时密码（只在响应中返回一次），默认要求用户首次登录后修改密码
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.AdminCreateUserRequest true "用户信息"
+// @Success 201 {object} models.SuccessResponse{data=models.AdminCreateUserResponse} "创建成功"
+// @Failure 400 {object} models.ErrorResponse "参数错误"
+// @Failure 409 {object} models.ErrorResponse "用户名或邮箱已存在"
+// @Router /admin/users [post]
+func AdminCreateUser(c *gin.Context) {
+	var req models.AdminCreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleUser
+	}
+	if req.Role != models.RoleAdmin && req.Role != models.RoleUser {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的角色值")
+		return
+	}
+
+	var temporaryPassword string
+	password := req.Password
+	if password == "" {
+		var err error
+		if temporaryPassword, err = utils.GenerateTemporaryPassword(); err != nil {
+			log.Printf("生成临时密码失败: %v", err)
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "系统错误")
+			return
+		}
+		password = temporaryPassword
+	} else if err := utils.ValidatePassword(password); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("密码加密失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "系统错误")
+		return
+	}
+
+	mustChange := true
+	if req.MustChangePassword != nil {
+		mustChange = *req.MustChangePassword
+	}
+	// 管理员创建的用户邮箱由管理员确认，无需再验证
+	now := time.Now()
+	user := models.User{
+		Username:           req.Username,
+		Email:              req.Email,
+		Password:           hashedPassword,
+		Role:               req.Role,
+		Status:             models.StatusActive,
+		MustChangePassword: mustChange,
+		EmailVerifiedAt:    &now,
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		if utils.IsUniqueConstraintError(err) {
+			utils.SendErrorResponse(c, http.StatusConflict, "用户名或邮箱已存在")
+			return
+		}
+		log.Printf("创建用户失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "创建用户失败")
+		return
+	}
+	log.Printf("管理员 %d 创建了用户 %d (%s)", c.GetInt64("user_id"), user.ID, user.Username)
+
+	utils.SendCreatedResponse(c, models.AdminCreateUserResponse{
+		User:              user.ToResponse(),
+		TemporaryPassword: temporaryPassword,
+	})
+}
+
+// ForcePasswordReset 要求用户下次登录后修改密码（管理员功能）
+// @Summary 强制用户修改密码
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} models.SuccessResponse "设置成功"
+// @Failure 400 {object} models.ErrorResponse "用户没有密码"
+// @Failure 404 {object} models.ErrorResponse "用户不存在"
+// @Router /admin/users/{id}/force-password-reset [put]
+func ForcePasswordReset(c *gin.Context) {
+	user, ok := findUserForAdmin(c)
+	if !ok {
+		return
+	}
+	if user.Password == "" {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "该用户仅使用第三方登录，没有可修改的密码")
+		return
+	}
+	if err := database.DB.Model(user).Update("must_change_password", true).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "更新失败")
+		return
+	}
+	log.Printf("管理员 %d 要求用户 %d 修改密码", c.GetInt64("user_id"), user.ID)
+	utils.SendSuccessResponse(c, "已要求用户下次登录后修改密码")
+}
+
+// MarkEmailVerified 将用户邮箱标记为已验证（管理员功能），用于无法收到验证邮件的用户
+// @Summary 标记邮箱已验证
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} models.SuccessResponse "设置成功"
+// @Failure 404 {object} models.ErrorResponse "用户不存在"
+// @Router /admin/users/{id}/verify-email [put]
+func MarkEmailVerified(c *gin.Context) {
+	user, ok := findUserForAdmin(c)
+	if !ok {
+		return
+	}
+	if user.EmailVerifiedAt == nil {
+		if err := database.DB.Model(user).Update("email_verified_at", time.Now()).Error; err != nil {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "更新失败")
+			return
+		}
+		log.Printf("管理员 %d 将用户 %d 的邮箱标记为已验证", c.GetInt64("user_id"), user.ID)
+	}
+	utils.SendSuccessResponse(c, "邮箱已标记为验证")
+}
+
+// ExportUserData 导出用户的全部数据（管理员功能）
+// @Summary 导出用户数据
+// @Description 导出邮箱账户、平台、注册信息、订阅、修订历史和登录身份，密码等字段保持密文
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} models.SuccessResponse{data=models.UserDataExport} "导出成功"
+// @Failure 404 {object} models.ErrorResponse "用户不存在"
+// @Router /admin/users/{id}/export [get]
+func ExportUserData(c *gin.Context) {
+	user, ok := findUserForAdmin(c)
+	if !ok {
+		return
+	}
+	export, err := buildUserExport(database.DB, user)
+	if err != nil {
+		log.Printf("导出用户 %d 数据失败: %v", user.ID, err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "导出失败")
+		return
+	}
+	utils.SendSuccessResponse(c, export)
+}
+
+// DeleteUser 删除用户及其全部数据（管理员功能）
+// @Summary 删除用户
+// @Description 先将用户数据导出到 USER_EXPORT_DIR，导出成功后永久删除用户及其邮箱账户、平台、注册信息、订阅、缓存邮件等全部数据
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} models.SuccessResponse{data=models.DeleteUserResponse} "删除成功"
+// @Failure 400 {object} models.ErrorResponse "不能删除自己"
+// @Failure 404 {object} models.ErrorResponse "用户不存在"
+// @Router /admin/users/{id} [delete]
+func DeleteUser(c *gin.Context) {
+	user, ok := findUserForAdmin(c)
+	if !ok {
+		return
+	}
+	adminID := c.GetInt64("user_id")
+	if int64(user.ID) == adminID {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "不能删除自己")
+		return
+	}
+
+	// 导出失败时不删除任何数据
+	export, err := buildUserExport(database.DB, user)
+	if err != nil {
+		log.Printf("导出用户 %d 数据失败: %v", user.ID, err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "导出用户数据失败，未删除用户")
+		return
+	}
+	path, err := writeUserExport(export)
+	if err != nil {
+		log.Printf("写入用户 %d 导出文件失败: %v", user.ID, err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "导出用户数据失败，未删除用户")
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, table := range userDataTables {
+			if err := tx.Exec("DELETE FROM "+table.name+" WHERE user_id = ?", user.ID).Error; err != nil {
+				return fmt.Errorf("删除 %s 失败: %w", table.name, err)
+			}
+		}
+		return tx.Unscoped().Delete(&models.User{}, user.ID).Error
+	})
+	if err != nil {
+		log.Printf("删除用户 %d 失败: %v", user.ID, err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "删除用户失败")
+		return
+	}
+	log.Printf("管理员 %d 删除了用户 %d (%s)，数据已导出到 %s", adminID, user.ID, user.Username, path)
+	utils.SendSuccessResponse(c, models.DeleteUserResponse{ExportFile: path})
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/database/dbtest"
+	"email_server/models"
+	"email_server/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupAdminTestRouter 使用与 main.go 相同的路由表（不限流），并创建管理员 admin，管理后台接口通过 doAdminJSON 调用
+func setupAdminTestRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.Config{
+		Security: config.SecurityConfig{EncryptionKey: "0123456789abcdef0123456789abcdef"},
+		JWT:      config.JWTConfig{SecretKey: "test-secret", ExpiresIn: 24},
+		Frontend: config.FrontendConfig{BaseURL: "http://frontend.test"},
+		Admin:    config.AdminConfig{RegistrationMode: models.RegistrationModeOpen, UserExportDir: t.TempDir()},
+	}
+	db := dbtest.Open(t)
+	database.DB = db
+
+	adminPassword, err := utils.HashPassword("admin-secret")
+	require.NoError(t, err)
+	verifiedAt := time.Now()
+	require.NoError(t, db.Create(&models.User{Username: "admin", Email: "admin@example.com", Password: adminPassword, Role: models.RoleAdmin, Status: models.StatusActive, EmailVerifiedAt: &verifiedAt}).Error)
+
+	r := gin.New()
+	RegisterRoutes(r, unlimitedRouteLimits())
+	return r, db
+}
+
+// unlimitedRouteLimits 测试中不限流
+func unlimitedRouteLimits() RouteLimits {
+	next := func(c *gin.Context) { c.Next() }
+	return RouteLimits{Auth: next, Login: next, API: next, Secret: next, AutofillSecret: next}
+}
+
+// doAdminJSON 以管理员 admin 的身份发送请求
+func doAdminJSON(r *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var admin models.User
+	_ = database.DB.Where("username = ?", "admin").First(&admin).Error
+	token, _ := utils.GenerateToken(int64(admin.ID), admin.Username, admin.Role, admin.TokenVersion)
+	return doAuthJSON(r, method, path, token, body)
+}
+
+// doAuthJSON 携带 Bearer token 发送请求
+func doAuthJSON(r *gin.Engine, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func login(t *testing.T, r *gin.Engine, username, password string) models.LoginResponse {
+	w := doJSON(r, "POST", "/api/v1/auth/login", map[string]string{"username": username, "password": password})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp models.LoginResponse
+	decodeData(t, w, &resp)
+	return resp
+}
+
+func TestAdminCreateUser_MustChangePasswordBeforeUse(t *testing.T) {
+	r, _ := setupAdminTestRouter(t)
+
+	w := doAdminJSON(r, "POST", "/api/v1/admin/users", map[string]string{"username": "bob", "email": "bob@example.com"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.AdminCreateUserResponse
+	decodeData(t, w, &created)
+	require.NotEmpty(t, created.TemporaryPassword)
+	assert.True(t, created.User.MustChangePassword)
+	assert.Equal(t, models.RoleUser, created.User.Role)
+
+	w = doAdminJSON(r, "POST", "/api/v1/admin/users", map[string]string{"username": "bob", "email": "other@example.com"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// 修改密码前只能访问个人资料和修改密码接口
+	session := login(t, r, "bob", created.TemporaryPassword)
+	assert.True(t, session.User.MustChangePassword)
+	w = doAuthJSON(r, "GET", "/api/v1/platforms", session.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doAuthJSON(r, "GET", "/api/v1/users/me", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doAuthJSON(r, "POST", "/api/v1/users/me/change-password", session.Token, map[string]string{
+		"old_password": created.TemporaryPassword, "new_password": "brand-new-secret",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doAuthJSON(r, "GET", "/api/v1/platforms", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// 管理员可以再次要求修改密码
+	w = doAdminJSON(r, "PUT", "/api/v1/admin/users/"+strconv.Itoa(int(created.User.ID))+"/force-password-reset", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	session = login(t, r, "bob", "brand-new-secret")
+	assert.True(t, session.User.MustChangePassword)
+	w = doAuthJSON(r, "GET", "/api/v1/platforms", session.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestInvitationOnlyRegistration(t *testing.T) {
+	r, _ := setupAdminTestRouter(t)
+
+	w := doAdminJSON(r, "PUT", "/api/v1/admin/settings/registration", map[string]string{"registration_mode": "invite_only"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	register := func(email, code string) *httptest.ResponseRecorder {
+		return doJSON(r, "POST", "/api/v1/auth/register", map[string]string{
+			"username": "carol", "email": email, "password": "carol-secret", "invite_code": code,
+		})
+	}
+	w = register("carol@example.com", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doAdminJSON(r, "POST", "/api/v1/admin/invitations", map[string]interface{}{"email": "carol@example.com", "role": "admin"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var invitation models.InvitationResponse
+	decodeData(t, w, &invitation)
+	require.NotEmpty(t, invitation.Code)
+	assert.Equal(t, "http://frontend.test/auth/register?invite="+invitation.Code, invitation.InviteURL)
+	assert.Equal(t, "pending", invitation.Status)
+
+	w = register("mallory@example.com", invitation.Code)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = register("carol@example.com", "not-a-code")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = register("carol@example.com", invitation.Code)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var registered models.LoginResponse
+	decodeData(t, w, &registered)
+	assert.Equal(t, models.RoleAdmin, registered.User.Role)
+
+	// 邀请码只能使用一次，已使用的邀请不能撤销
+	w = doJSON(r, "POST", "/api/v1/auth/register", map[string]string{
+		"username": "carol2", "email": "carol@example.com", "password": "carol-secret", "invite_code": invitation.Code,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doAdminJSON(r, "GET", "/api/v1/admin/invitations", nil)
+	var list []models.InvitationResponse
+	decodeData(t, w, &list)
+	require.Len(t, list, 1)
+	assert.Equal(t, "used", list[0].Status)
+	assert.Empty(t, list[0].Code, "列表中不返回邀请码")
+	w = doAdminJSON(r, "DELETE", "/api/v1/admin/invitations/"+strconv.Itoa(int(list[0].ID)), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCreateInvitation_SendsInviteMail(t *testing.T) {
+	r, _ := setupAdminTestRouter(t)
+	sender := enablePasswordReset(t)
+
+	w := doAdminJSON(r, "POST", "/api/v1/admin/invitations", map[string]string{"email": "dave@example.com"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var invitation models.InvitationResponse
+	decodeData(t, w, &invitation)
+	assert.True(t, invitation.EmailSent)
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, "dave@example.com", sender.sent[0].to)
+	assert.Contains(t, sender.sent[0].body, "http://frontend.test/auth/register?invite="+invitation.Code)
+
+	// 未指定邮箱的邀请只返回链接
+	w = doAdminJSON(r, "POST", "/api/v1/admin/invitations", map[string]string{})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var linkOnly models.InvitationResponse
+	decodeData(t, w, &linkOnly)
+	assert.False(t, linkOnly.EmailSent)
+	assert.Len(t, sender.sent, 1)
+}
+
+func TestDeleteUser_ExportsThenRemovesAllData(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+
+	bob := models.User{Username: "bob", Email: "bob@example.com", Password: "hashed", Role: models.RoleUser, Status: models.StatusActive}
+	require.NoError(t, db.Create(&bob).Error)
+	account := models.EmailAccount{UserID: bob.ID, EmailAddress: "bob@example.com", PasswordEncrypted: "ciphertext"}
+	require.NoError(t, db.Create(&account).Error)
+	platform := models.Platform{UserID: bob.ID, Name: "GitHub"}
+	require.NoError(t, db.Create(&platform).Error)
+	trashed := models.Platform{UserID: bob.ID, Name: "Old"}
+	require.NoError(t, db.Create(&trashed).Error)
+	require.NoError(t, db.Delete(&trashed).Error)
+	registration := models.PlatformRegistration{UserID: bob.ID, PlatformID: platform.ID, EmailAccountID: &account.ID}
+	require.NoError(t, db.Create(&registration).Error)
+	require.NoError(t, db.Create(&models.ServiceSubscription{UserID: bob.ID, PlatformRegistrationID: registration.ID, ServiceName: "Copilot"}).Error)
+	require.NoError(t, db.Create(&models.CachedEmail{UserID: bob.ID, EmailAccountID: account.ID, MessageID: "1", Subject: "hi"}).Error)
+	require.NoError(t, db.Create(&models.UserIdentity{UserID: bob.ID, Provider: "keycloak", Subject: "bob"}).Error)
+
+	// 其他用户的数据不受影响
+	otherPlatform := models.Platform{UserID: 1, Name: "GitHub"}
+	require.NoError(t, db.Create(&otherPlatform).Error)
+
+	w := doAdminJSON(r, "GET", "/api/v1/admin/users", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var page struct {
+		Users []models.AdminUserResponse `json:"users"`
+	}
+	decodeData(t, w, &page)
+	require.Len(t, page.Users, 2)
+	for _, u := range page.Users {
+		if u.ID == bob.ID {
+			assert.EqualValues(t, 1, u.EmailAccountCount)
+			assert.EqualValues(t, 1, u.PlatformRegistrationCount)
+			assert.EqualValues(t, 1, u.ServiceSubscriptionCount)
+		}
+	}
+
+	w = doAdminJSON(r, "DELETE", "/api/v1/admin/users/1", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "不能删除自己")
+
+	w = doAdminJSON(r, "DELETE", "/api/v1/admin/users/"+strconv.Itoa(int(bob.ID)), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var deleted models.DeleteUserResponse
+	decodeData(t, w, &deleted)
+
+	info, err := os.Stat(deleted.ExportFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, err := os.ReadFile(deleted.ExportFile)
+	require.NoError(t, err)
+	var export models.UserDataExport
+	require.NoError(t, json.Unmarshal(data, &export))
+	assert.Equal(t, "bob", export.User.Username)
+	assert.Len(t, export.Tables["platforms"], 2, "回收站中的记录也要导出")
+	require.Len(t, export.Tables["email_accounts"], 1)
+	assert.Equal(t, "ciphertext", export.Tables["email_accounts"][0]["password_encrypted"])
+	assert.Len(t, export.Tables["user_identities"], 1)
+	assert.NotContains(t, export.Tables, "cached_emails")
+
+	for _, table := range userDataTables {
+		var count int64
+		require.NoError(t, db.Table(table.name).Where("user_id = ?", bob.ID).Count(&count).Error)
+		assert.Zero(t, count, table.name)
+	}
+	var count int64
+	require.NoError(t, db.Unscoped().Model(&models.User{}).Where("id = ?", bob.ID).Count(&count).Error)
+	assert.Zero(t, count)
+	require.NoError(t, db.Model(&models.Platform{}).Where("user_id = ?", 1).Count(&count).Error)
+	assert.EqualValues(t, 1, count)
+
+	w = doAdminJSON(r, "DELETE", "/api/v1/admin/users/"+strconv.Itoa(int(bob.ID)), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSystemHealth(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+
+	registerJob("test_job", "@every 1h", true)
+	runJob("test_job", func() error { return errors.New("boom") })
+
+	provider := models.OAuthProvider{Name: "google", ClientID: "id", ClientSecretEncrypted: "secret", AuthURL: "http://auth", TokenURL: "http://token"}
+	require.NoError(t, db.Create(&provider).Error)
+	account := models.EmailAccount{UserID: 1, EmailAddress: "admin@gmail.com"}
+	require.NoError(t, db.Create(&account).Error)
+	now := time.Now()
+	require.NoError(t, db.Create(&models.UserOAuthToken{
+		UserID: 1, EmailAccountID: account.ID, ProviderID: provider.ID, AccessTokenEncrypted: "x", Expiry: now,
+		FailureCount: 3, LastError: "invalid_grant", LastErrorAt: &now,
+	}).Error)
+	require.NoError(t, db.Create(&models.UserOAuthToken{
+		UserID: 1, EmailAccountID: account.ID, ProviderID: provider.ID, AccessTokenEncrypted: "y", Expiry: now,
+	}).Error)
+
+	w := doAdminJSON(r, "GET", "/api/v1/admin/system/health", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var health models.SystemHealthResponse
+	decodeData(t, w, &health)
+
+	assert.Equal(t, "sqlite", health.Database.Driver)
+	assert.Positive(t, health.Database.SizeBytes)
+	assert.Positive(t, health.Database.SchemaVersion)
+	assert.Zero(t, health.Database.PendingMigrations)
+	assert.EqualValues(t, 1, health.Counts["users"])
+	assert.EqualValues(t, 1, health.Counts["email_accounts"])
+
+	var job *models.JobStatus
+	for i := range health.Jobs {
+		if health.Jobs[i].Name == "test_job" {
+			job = &health.Jobs[i]
+		}
+	}
+	require.NotNil(t, job)
+	assert.Equal(t, 1, job.Runs)
+	assert.NotNil(t, job.LastRunAt)
+	assert.Equal(t, "boom", job.LastError)
+
+	assert.EqualValues(t, 2, health.OAuthTokens.Total)
+	assert.EqualValues(t, 1, health.OAuthTokens.Failing)
+	require.Len(t, health.OAuthTokens.Failures, 1)
+	failure := health.OAuthTokens.Failures[0]
+	assert.Equal(t, "admin@gmail.com", failure.EmailAddress)
+	assert.Equal(t, "google", failure.Provider)
+	assert.Equal(t, 3, failure.FailureCount)
+	assert.Equal(t, "invalid_grant", failure.LastError)
+	assert.NotNil(t, health.IMAPPool.Servers)
+}
+
+func TestIdentityLogin_RegistrationClosed(t *testing.T) {
+	r, db, mock, _ := setupIdentityTestRouter(t)
+	require.NoError(t, setSetting(models.SettingRegistrationMode, models.RegistrationModeInviteOnly))
+
+	state, nonce := startOIDCLogin(t, r)
+	location := oidcCallback(t, r, mock, "keycloak", state, nonce)
+	assert.Equal(t, "/auth/login", location.Path)
+	assert.Equal(t, "registration_closed", location.Query().Get("error"))
+
+	var count int64
+	require.NoError(t, db.Model(&models.User{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
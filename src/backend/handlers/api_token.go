@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// apiTokenHintLength 列表中显示的 token 开头长度（含前缀）
+const apiTokenHintLength = len(models.APITokenPrefix) + 6
+
+// generateAPIToken 生成带前缀的随机 API token
+func generateAPIToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return models.APITokenPrefix + hex.EncodeToString(buf), nil
+}
+
+// normalizeScopes 校验并去重权限范围
+func normalizeScopes(scopes []string) ([]string, bool) {
+	seen := make(map[string]bool, len(scopes))
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !models.IsValidAPITokenScope(scope) {
+			return nil, false
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, len(normalized) > 0
+}
+
+func apiTokenResponse(token models.APIToken) models.APITokenResponse {
+	return models.APITokenResponse{APIToken: token, Scopes: token.ScopeList()}
+}
+
+// GetAPITokens 获取当前用户的 API token 列表
+// @Summary 获取 API token 列表
+// @Tags Users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse{data=[]models.APITokenResponse} "获取成功"
+// @Router /users/me/api-tokens [get]
+func GetAPITokens(c *gin.Context) {
+	var tokens []models.APIToken
+	if err := database.DB.Where("user_id = ?", c.GetInt64("user_id")).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		log.Printf("查询 API token 失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询失败")
+		return
+	}
+	responses := make([]models.APITokenResponse, len(tokens))
+	for i, token := range tokens {
+		responses[i] = apiTokenResponse(token)
+	}
+	utils.SendSuccessResponse(c, responses)
+}
+
+// GetAPITokenScopes 获取 API token 可用的权限范围
+// @Summary 获取 API token 权限范围
+// @Tags Users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse{data=[]string} "获取成功"
+// @Router /users/me/api-tokens/scopes [get]
+func GetAPITokenScopes(c *gin.Context) {
+	utils.SendSuccessResponse(c, models.APITokenScopes)
+}
+
+// CreateAPIToken 创建 API token
+// @Summary 创建 API token
+// @Description token 只在创建时返回一次；只能访问授予的权限范围内的接口，查看明文密码需要 secrets:reveal
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateAPITokenRequest true "名称、权限范围和有效期"
+// @Success 201 {object} models.SuccessResponse{data=models.APITokenResponse} "创建成功"
+// @Failure 400 {object} models.ErrorResponse "参数错误"
+// @Router /users/me/api-tokens [post]
+func CreateAPIToken(c *gin.Context) {
+	var req models.CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "名称不能为空")
+		return
+	}
+	scopes, ok := normalizeScopes(req.Scopes)
+	if !ok {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的权限范围，可用: "+strings.Join(models.APITokenScopes, ", "))
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "有效期不能为负数")
+		return
+	}
+
+	raw, err := generateAPIToken()
+	if err != nil {
+		log.Printf("生成 API token 失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "系统错误")
+		return
+	}
+	token := models.APIToken{
+		UserID:    uint(c.GetInt64("user_id")),
+		Name:      name,
+		TokenHash: utils.HashToken(raw),
+		Hint:      raw[:apiTokenHintLength],
+		Scopes:    strings.Join(scopes, " "),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := database.DB.Create(&token).Error; err != nil {
+		log.Printf("创建 API token 失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "创建失败")
+		return
+	}
+	log.Printf("用户 %d 创建了 API token %d（%s）", token.UserID, token.ID, token.Scopes)
+
+	resp := apiTokenResponse(token)
+	resp.Token = raw
+	utils.SendCreatedResponse(c, resp)
+}
+
+// DeleteAPIToken 吊销 API token
+// @Summary 吊销 API token
+// @Tags Users
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API token ID"
+// @Success 200 {object} models.SuccessResponse "已吊销"
+// @Failure 404 {object} models.ErrorResponse "不存在"
+// @Router /users/me/api-tokens/{id} [delete]
+func DeleteAPIToken(c *gin.Context) {
+	tokenID, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的ID")
+		return
+	}
+	result := database.DB.Where("id = ? AND user_id = ?", tokenID, c.GetInt64("user_id")).Delete(&models.APIToken{})
+	if result.Error != nil {
+		log.Printf("删除 API token 失败: %v", result.Error)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "删除失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.SendErrorResponse(c, http.StatusNotFound, "API token 不存在")
+		return
+	}
+	utils.SendSuccessResponse(c, "已吊销")
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"email_server/models"
+	"email_server/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createAPIToken(t *testing.T, r *gin.Engine, sessionToken string, scopes ...string) models.APITokenResponse {
+	w := doAuthJSON(r, "POST", "/api/v1/users/me/api-tokens", sessionToken, map[string]interface{}{
+		"name": "extension", "scopes": scopes, "expires_in_days": 30,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.APITokenResponse
+	decodeData(t, w, &created)
+	return created
+}
+
+func TestAPIToken_ScopesEnforcedPerRoute(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	session := registerUser(t, r, "henry", "henry@example.com")
+
+	platform := models.Platform{UserID: session.User.ID, Name: "Example"}
+	require.NoError(t, db.Create(&platform).Error)
+	encrypted, err := utils.EncryptPassword("site-password")
+	require.NoError(t, err)
+	registration := models.PlatformRegistration{UserID: session.User.ID, PlatformID: platform.ID, LoginPasswordEncrypted: encrypted}
+	require.NoError(t, db.Create(&registration).Error)
+	passwordPath := "/api/v1/platform-registrations/" + strconv.Itoa(int(registration.ID)) + "/password"
+
+	readOnly := createAPIToken(t, r, session.Token, models.ScopeRegistrationsRead, models.ScopeRegistrationsRead)
+	require.True(t, strings.HasPrefix(readOnly.Token, models.APITokenPrefix))
+	assert.Equal(t, []string{models.ScopeRegistrationsRead}, readOnly.Scopes)
+	assert.True(t, strings.HasPrefix(readOnly.Token, readOnly.Hint))
+	require.NotNil(t, readOnly.ExpiresAt)
+
+	w := doAuthJSON(r, "GET", "/api/v1/platforms", readOnly.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// 没有 secrets:reveal 不能查看明文密码
+	w = doAuthJSON(r, "GET", passwordPath, readOnly.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), models.ScopeSecretsReveal)
+
+	// 未列入权限范围的接口（个人资料、创建 token）只能通过登录访问
+	w = doAuthJSON(r, "GET", "/api/v1/users/me", readOnly.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doAuthJSON(r, "POST", "/api/v1/users/me/api-tokens", readOnly.Token, map[string]interface{}{
+		"name": "escalate", "scopes": []string{models.ScopeSecretsReveal},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	reveal := createAPIToken(t, r, session.Token, models.ScopeSecretsReveal)
+	w = doAuthJSON(r, "GET", passwordPath, reveal.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "site-password")
+
+	// 列表不返回 token 本身，记录最近使用时间
+	w = doAuthJSON(r, "GET", "/api/v1/users/me/api-tokens", session.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), readOnly.Token)
+	var tokens []models.APITokenResponse
+	decodeData(t, w, &tokens)
+	require.Len(t, tokens, 2)
+	for _, token := range tokens {
+		assert.Empty(t, token.Token)
+		assert.NotNil(t, token.LastUsedAt)
+	}
+
+	// 吊销后立即失效
+	w = doAuthJSON(r, "DELETE", "/api/v1/users/me/api-tokens/"+strconv.Itoa(int(reveal.ID)), session.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doAuthJSON(r, "GET", passwordPath, reveal.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAPIToken_RejectsInvalidScopesAndExpiredTokens(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	session := registerUser(t, r, "iris", "iris@example.com")
+
+	w := doAuthJSON(r, "POST", "/api/v1/users/me/api-tokens", session.Token, map[string]interface{}{
+		"name": "bad", "scopes": []string{"admin:all"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	created := createAPIToken(t, r, session.Token, models.ScopeRegistrationsRead)
+	require.NoError(t, db.Model(&models.APIToken{}).Where("id = ?", created.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	w = doAuthJSON(r, "GET", "/api/v1/platforms", created.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 其他用户不能吊销
+	other := registerUser(t, r, "jack", "jack@example.com")
+	w = doAuthJSON(r, "DELETE", "/api/v1/users/me/api-tokens/"+strconv.Itoa(int(created.ID)), other.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"strings"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"email_server/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // Register 用户注册
@@ -27,6 +29,34 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	// 关闭注册时只能由管理员创建用户；邀请注册模式下必须提供邀请码；开放注册时也可以使用邀请码获得指定角色
+	mode := registrationMode()
+	if mode == models.RegistrationModeDisabled {
+		utils.SendErrorResponse(c, 403, "注册已关闭，请联系管理员")
+		return
+	}
+	var invitation *models.Invitation
+	if req.InviteCode == "" && mode != models.RegistrationModeOpen {
+		utils.SendErrorResponse(c, 403, "当前仅支持邀请注册，请填写邀请码")
+		return
+	}
+	if req.InviteCode != "" {
+		var err error
+		invitation, err = findUsableInvitation(req.InviteCode, req.Email)
+		switch {
+		case errors.Is(err, errInvitationInvalid):
+			utils.SendErrorResponse(c, 400, "邀请码无效或已过期")
+			return
+		case errors.Is(err, errInvitationEmailMismatch):
+			utils.SendErrorResponse(c, 400, "邀请码与注册邮箱不匹配")
+			return
+		case err != nil:
+			log.Printf("查询邀请失败: %v", err)
+			utils.SendErrorResponse(c, 500, "系统错误")
+			return
+		}
+	}
+
 	// 检查用户名和邮箱是否已存在 (Using GORM)
 	var existingUser models.User
 	// Check for username
@@ -71,18 +101,42 @@ func Register(c *gin.Context) {
 		Role:     models.RoleUser,     // 默认为普通用户
 		Status:   models.StatusActive, // 默认为激活状态
 	}
+	if invitation != nil {
+		newUser.Role = invitation.Role
+		// 指定了邮箱的邀请由管理员发给该邮箱，视为已验证
+		if invitation.Email != "" {
+			now := time.Now()
+			newUser.EmailVerifiedAt = &now
+		}
+	}
 
-	// Use a new variable for GORM operation result
-	createResult := database.DB.Create(&newUser) // newUser will be updated with ID, CreatedAt, UpdatedAt by GORM
-	if createResult.Error != nil {
-		log.Printf("创建用户失败: %v", createResult.Error)
+	// 创建用户与使用邀请在同一事务中完成，邀请被并发使用时注册失败
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newUser).Error; err != nil {
+			return err
+		}
+		if invitation != nil {
+			return consumeInvitation(tx, invitation, newUser.ID)
+		}
+		return nil
+	})
+	if errors.Is(err, errInvitationInvalid) {
+		utils.SendErrorResponse(c, 400, "邀请码无效或已过期")
+		return
+	}
+	if err != nil {
+		log.Printf("创建用户失败: %v", err)
 		utils.SendErrorResponse(c, 500, "创建用户失败")
 		return
 	}
 
+	if newUser.EmailVerifiedAt == nil && emailVerificationRequired() {
+		trySendVerificationEmail(&newUser)
+	}
+
 	// 生成token
 	// newUser.ID is uint, GenerateToken might expect int64.
-	token, err := utils.GenerateToken(int64(newUser.ID), newUser.Username, newUser.Role) // 使用用户的实际角色
+	token, err := utils.GenerateToken(int64(newUser.ID), newUser.Username, newUser.Role, newUser.TokenVersion) // 使用用户的实际角色
 	if err != nil {
 		log.Printf("生成token失败: %v", err)
 		utils.SendErrorResponse(c, 500, "系统错误")
@@ -99,6 +153,8 @@ func Register(c *gin.Context) {
 		Role:      newUser.Role,
 		Status:    newUser.Status,
 		LastLogin: newUser.LastLogin,
+		// 前端据此提示用户验证邮箱
+		EmailVerifiedAt: newUser.EmailVerifiedAt,
 		// Password is not included due to json:"-" in the model or by not explicitly setting it here.
 	}
 
@@ -139,16 +195,30 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// 连续登录失败被锁定期间，即使密码正确也不能登录
+	now := time.Now()
+	if user.IsLocked(now) {
+		utils.SendTooManyRequests(c, user.LockedUntil.Sub(now), "登录失败次数过多，账户已被临时锁定，请稍后再试")
+		return
+	}
+
 	// 验证密码
 	// user.Password from DB is the hashed password
 	if !utils.CheckPassword(req.Password, user.Password) {
+		if lockout := recordLoginFailure(&user); lockout > 0 {
+			utils.SendTooManyRequests(c, lockout, "登录失败次数过多，账户已被临时锁定，请稍后再试")
+			return
+		}
 		utils.SendErrorResponse(c, 401, "用户名或密码错误")
 		return
 	}
 
-	// 更新最后登录时间
-	now := time.Now()
-	updateResult := database.DB.Model(&user).Update("last_login", now)
+	// 更新最后登录时间，并清除连续失败计数
+	updateResult := database.DB.Model(&user).Updates(map[string]interface{}{
+		"last_login":            now,
+		"failed_login_attempts": 0,
+		"locked_until":          nil,
+	})
 	if updateResult.Error != nil {
 		log.Printf("更新最后登录时间失败: %v", updateResult.Error)
 		// 不阻断登录流程，只记录错误
@@ -157,7 +227,7 @@ func Login(c *gin.Context) {
 	}
 
 	// 生成token
-	token, err := utils.GenerateToken(int64(user.ID), user.Username, user.Role) // 使用用户的实际角色
+	token, err := utils.GenerateToken(int64(user.ID), user.Username, user.Role, user.TokenVersion) // 使用用户的实际角色
 	if err != nil {
 		log.Printf("生成token失败: %v", err)
 		utils.SendErrorResponse(c, 500, "系统错误")
@@ -172,6 +242,9 @@ func Login(c *gin.Context) {
 		Role:      user.Role,
 		Status:    user.Status,
 		LastLogin: user.LastLogin,
+		// 前端据此引导用户先修改密码、验证邮箱
+		MustChangePassword: user.MustChangePassword,
+		EmailVerifiedAt:    user.EmailVerifiedAt,
 		// Password is not included (json:"-")
 	}
 
@@ -225,17 +298,7 @@ func GetProfile(c *gin.Context) {
 	// For now, directly returning the core user model fields (GORM model + Username, Email)
 	// The User struct itself will be marshalled to JSON, respecting `json:"-"` for Password.
 
-	responseUser := models.UserResponse{
-		ID:        user.ID, // user.ID is uint, UserResponse.ID is uint
-		Username:  user.Username,
-		Email:     user.Email,
-		Role:      user.Role,
-		Status:    user.Status,
-		LastLogin: user.LastLogin,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-	}
-	utils.SendSuccessResponse(c, responseUser)
+	utils.SendSuccessResponse(c, user.ToResponse())
 }
 
 // UpdateProfile 更新用户信息
@@ -312,6 +375,17 @@ func UpdateProfile(c *gin.Context) {
 	// then `phoneValue = nil` would be appropriate.
 	// Since User.Phone is not in the model, this part is moot for now.
 
+	// 修改邮箱后需要重新验证
+	var current models.User
+	if err := database.DB.First(&current, userIDUint).Error; err != nil {
+		utils.SendErrorResponse(c, 404, "用户不存在")
+		return
+	}
+	emailChanged := !strings.EqualFold(current.Email, req.Email)
+	if emailChanged {
+		updateData["email_verified_at"] = nil
+	}
+
 	result := database.DB.Model(&models.User{}).Where("id = ?", userIDUint).Updates(updateData)
 	if result.Error != nil {
 		log.Printf("更新用户信息失败: %v", result.Error)
@@ -323,6 +397,10 @@ func UpdateProfile(c *gin.Context) {
 		// For simplicity, not treating as error, but could be a 404 if ID must exist.
 		log.Printf("更新用户信息时，没有行受到影响 (ID: %d)", userIDUint)
 	}
+	if emailChanged && emailVerificationRequired() {
+		current.Email = req.Email
+		trySendVerificationEmail(&current)
+	}
 
 	utils.SendSuccessResponse(c, "更新成功")
 }
@@ -369,6 +447,12 @@ func ChangePassword(c *gin.Context) {
 	}
 	currentPassword := user.Password
 
+	// 通过第三方登录注册的用户没有密码，无法验证旧密码，需通过邮件设置密码
+	if currentPassword == "" {
+		utils.SendErrorResponse(c, 400, "当前账户尚未设置密码，请通过“忘记密码”设置")
+		return
+	}
+
 	// 验证旧密码
 	if !utils.CheckPassword(req.OldPassword, currentPassword) {
 		utils.SendErrorResponse(c, 400, "原密码错误")
@@ -385,7 +469,11 @@ func ChangePassword(c *gin.Context) {
 
 	// 更新密码
 	// userIDUint is already defined and converted above
-	result := database.DB.Model(&models.User{}).Where("id = ?", userIDUint).Update("password", hashedPassword)
+	// 同时清除管理员设置的“下次登录修改密码”标记
+	result := database.DB.Model(&models.User{}).Where("id = ?", userIDUint).Updates(map[string]interface{}{
+		"password":             hashedPassword,
+		"must_change_password": false,
+	})
 	if result.Error != nil {
 		log.Printf("更新密码失败: %v", result.Error)
 		utils.SendErrorResponse(c, 500, "修改密码失败")
@@ -413,6 +501,18 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
+	// 重置密码后吊销的 token 不能再刷新
+	claims, err := utils.ParseToken(parts[1])
+	if err != nil {
+		utils.SendErrorResponse(c, 401, "token刷新失败")
+		return
+	}
+	var user models.User
+	if err := database.DB.Select("token_version").Where("id = ?", claims.UserID).First(&user).Error; err != nil || user.TokenVersion != claims.TokenVersion {
+		utils.SendErrorResponse(c, 401, "登录已失效，请重新登录")
+		return
+	}
+
 	newToken, err := utils.RefreshToken(parts[1])
 	if err != nil {
 		utils.SendErrorResponse(c, 401, "token刷新失败")
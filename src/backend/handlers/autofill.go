@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"email_server/database"
+	"email_server/middleware"
+	"email_server/models"
+	"email_server/urlmatch"
+	"email_server/utils"
+)
+
+// builtinEquivalentDomains 内置的等价域名组：同一账号体系在多个域名下登录。用户可以在此基础上添加自己的组
+var builtinEquivalentDomains = [][]string{
+	{"google.com", "youtube.com", "gmail.com", "blogger.com"},
+	{"microsoft.com", "live.com", "outlook.com", "office.com", "microsoftonline.com", "xbox.com", "skype.com", "bing.com"},
+	{"apple.com", "icloud.com"},
+	{"amazon.com", "amazon.co.uk", "amazon.de", "amazon.fr", "amazon.co.jp", "amazon.ca"},
+	{"facebook.com", "messenger.com", "instagram.com"},
+	{"steampowered.com", "steamcommunity.com"},
+	{"atlassian.com", "atlassian.net", "bitbucket.org", "trello.com"},
+	{"taobao.com", "tmall.com", "alipay.com", "1688.com"},
+	{"qq.com", "tencent.com"},
+	{"baidu.com", "hao123.com"},
+	{"jd.com", "jd.hk"},
+	{"bilibili.com", "biligame.com"},
+}
+
+// autofillMatchRank 匹配方式的排序，越小越精确
+var autofillMatchRank = map[string]int{
+	models.AutofillMatchExact:      0,
+	models.AutofillMatchApp:        0,
+	models.AutofillMatchDomain:     1,
+	models.AutofillMatchEquivalent: 2,
+}
+
+// autofillIncludes 解析 include 参数（password、totp，逗号分隔）
+func autofillIncludes(c *gin.Context) (password, totp bool) {
+	for _, item := range strings.Split(c.Query("include"), ",") {
+		switch strings.TrimSpace(item) {
+		case "password":
+			password = true
+		case "totp":
+			totp = true
+		}
+	}
+	return password, totp
+}
+
+// AutofillIncludesSecrets 自动填充请求是否要求返回密码或 TOTP 验证码，用于按查看密码的限流规则限流
+func AutofillIncludesSecrets(c *gin.Context) bool {
+	password, totp := autofillIncludes(c)
+	return password || totp
+}
+
+// normalizeEquivalentDomains 将用户输入的域名或网址转换为可注册域名并去重
+func normalizeEquivalentDomains(inputs []string) []string {
+	seen := map[string]bool{}
+	domains := make([]string, 0, len(inputs))
+	for _, input := range inputs {
+		addr, ok := urlmatch.Parse(input)
+		if !ok || addr.BaseDomain == "" || seen[addr.BaseDomain] {
+			continue
+		}
+		seen[addr.BaseDomain] = true
+		domains = append(domains, addr.BaseDomain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// equivalentDomainsFor 返回与 baseDomain 等价的全部可注册域名（包括其自身）
+func equivalentDomainsFor(userID uint, baseDomain string) (map[string]bool, error) {
+	equivalents := map[string]bool{baseDomain: true}
+	groups := append([][]string{}, builtinEquivalentDomains...)
+
+	var custom []models.EquivalentDomain
+	if err := database.DB.Where("user_id = ?", userID).Find(&custom).Error; err != nil {
+		return nil, err
+	}
+	for _, group := range custom {
+		groups = append(groups, group.DomainList())
+	}
+
+	for _, group := range groups {
+		for _, domain := range group {
+			if domain != baseDomain {
+				continue
+			}
+			for _, d := range group {
+				equivalents[d] = true
+			}
+			break
+		}
+	}
+	return equivalents, nil
+}
+
+// matchPlatform 按平台的官方网址和网址规则匹配页面，返回最精确的匹配方式和命中的规则。
+// 只有按可注册域名匹配的规则才参与等价域名匹配
+func matchPlatform(site urlmatch.Address, platform models.Platform, equivalents map[string]bool) (string, string) {
+	best, bestURL := "", ""
+	for _, rule := range platform.MatchRules() {
+		match := rule.Match(site)
+		if match == "" && site.AppID == "" && (rule.Mode == "" || rule.Mode == urlmatch.ModeBaseDomain) && equivalents[rule.Domain()] {
+			match = models.AutofillMatchEquivalent
+		}
+		if match != "" && (best == "" || autofillMatchRank[match] < autofillMatchRank[best]) {
+			best, bestURL = match, rule.Pattern
+		}
+	}
+	return best, bestURL
+}
+
+// Autofill 按页面网址查找可用于自动填充的平台注册信息
+// @Summary 自动填充查询
+// @Description 按公共后缀列表计算页面的可注册域名，按平台的官方网址和网址规则（可注册域名、主机名、前缀、正则、App ID）以及等价域名匹配。
+// @Description include=password,totp 时返回明文密码和当前 TOTP 验证码，API token 需要 secrets:reveal 权限
+// @Tags Autofill
+// @Produce json
+// @Security BearerAuth
+// @Param url query string true "页面网址或 App ID（如 androidapp://com.example.app）"
+// @Param include query string false "额外返回的内容：password、totp，逗号分隔"
+// @Success 200 {object} models.SuccessResponse{data=models.AutofillResponse} "查询成功"
+// @Failure 400 {object} models.ErrorResponse "无效的网址"
+// @Failure 403 {object} models.ErrorResponse "API token 缺少权限"
+// @Router /autofill [get]
+func Autofill(c *gin.Context) {
+	userID := uint(c.GetInt64("user_id"))
+	site, ok := urlmatch.Parse(c.Query("url"))
+	if !ok {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的网址")
+		return
+	}
+	includePassword, includeTOTP := autofillIncludes(c)
+	if (includePassword || includeTOTP) && !middleware.HasScope(c, models.ScopeSecretsReveal) {
+		utils.SendErrorResponse(c, http.StatusForbidden, "API token 缺少权限: "+models.ScopeSecretsReveal)
+		return
+	}
+
+	equivalents := map[string]bool{}
+	if site.BaseDomain != "" {
+		var err error
+		if equivalents, err = equivalentDomainsFor(userID, site.BaseDomain); err != nil {
+			log.Printf("查询等价域名失败: %v", err)
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "查询失败")
+			return
+		}
+	}
+
+	platforms, err := loadMatchablePlatforms(userID)
+	if err != nil {
+		log.Printf("查询平台失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询失败")
+		return
+	}
+	type platformMatch struct {
+		platform   models.Platform
+		match, url string
+	}
+	matched := map[uint]platformMatch{}
+	platformIDs := []uint{}
+	for _, platform := range platforms {
+		if match, url := matchPlatform(site, platform, equivalents); match != "" {
+			matched[platform.ID] = platformMatch{platform, match, url}
+			platformIDs = append(platformIDs, platform.ID)
+		}
+	}
+
+	resp := models.AutofillResponse{Host: site.Host, BaseDomain: site.BaseDomain, AppID: site.AppID, Matches: []models.AutofillMatch{}}
+	if len(platformIDs) == 0 {
+		utils.SendSuccessResponse(c, resp)
+		return
+	}
+
+	var registrations []models.PlatformRegistration
+	if err := database.DB.Where("user_id = ? AND platform_id IN ?", userID, platformIDs).
+		Preload("EmailAccount").Find(&registrations).Error; err != nil {
+		log.Printf("查询平台注册信息失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询失败")
+		return
+	}
+
+	now := time.Now()
+	for _, registration := range registrations {
+		pm := matched[registration.PlatformID]
+		item := models.AutofillMatch{
+			RegistrationID: registration.ID,
+			PlatformID:     registration.PlatformID,
+			PlatformName:   pm.platform.Name,
+			Match:          pm.match,
+			MatchedURL:     pm.url,
+			HasPassword:    registration.LoginPasswordEncrypted != "",
+			HasTOTP:        registration.TOTPSecretEncrypted != "",
+		}
+		if registration.LoginUsername != nil {
+			item.LoginUsername = *registration.LoginUsername
+		}
+		if registration.EmailAccount != nil {
+			item.EmailAddress = registration.EmailAccount.EmailAddress
+		}
+		if includePassword && item.HasPassword {
+			if password, err := utils.DecryptPassword(registration.LoginPasswordEncrypted); err == nil {
+				item.Password = password
+			} else {
+				log.Printf("自动填充：解密平台注册 %d 的密码失败: %v", registration.ID, err)
+			}
+		}
+		if includeTOTP && item.HasTOTP {
+			if totp, err := registrationTOTP(registration, now); err == nil {
+				item.TOTP = totp
+			} else {
+				log.Printf("自动填充：生成平台注册 %d 的 TOTP 验证码失败: %v", registration.ID, err)
+			}
+		}
+		resp.Matches = append(resp.Matches, item)
+	}
+	sort.SliceStable(resp.Matches, func(i, j int) bool {
+		a, b := resp.Matches[i], resp.Matches[j]
+		if autofillMatchRank[a.Match] != autofillMatchRank[b.Match] {
+			return autofillMatchRank[a.Match] < autofillMatchRank[b.Match]
+		}
+		if a.PlatformName != b.PlatformName {
+			return a.PlatformName < b.PlatformName
+		}
+		return a.RegistrationID < b.RegistrationID
+	})
+
+	utils.SendSuccessResponse(c, resp)
+}
+
+// GetEquivalentDomains 获取内置和用户自定义的等价域名组
+// @Summary 获取等价域名
+// @Tags Autofill
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse{data=[]models.EquivalentDomainResponse} "获取成功"
+// @Router /autofill/equivalent-domains [get]
+func GetEquivalentDomains(c *gin.Context) {
+	var custom []models.EquivalentDomain
+	if err := database.DB.Where("user_id = ?", c.GetInt64("user_id")).Order("id").Find(&custom).Error; err != nil {
+		log.Printf("查询等价域名失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询失败")
+		return
+	}
+	responses := make([]models.EquivalentDomainResponse, 0, len(builtinEquivalentDomains)+len(custom))
+	for _, group := range builtinEquivalentDomains {
+		responses = append(responses, models.EquivalentDomainResponse{Domains: group, BuiltIn: true})
+	}
+	for _, group := range custom {
+		responses = append(responses, models.EquivalentDomainResponse{ID: group.ID, Domains: group.DomainList()})
+	}
+	utils.SendSuccessResponse(c, responses)
+}
+
+// CreateEquivalentDomain 添加一组等价域名
+// @Summary 添加等价域名
+// @Description 域名按公共后缀列表转换为可注册域名，组内至少需要两个不同的域名
+// @Tags Autofill
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateEquivalentDomainRequest true "域名列表"
+// @Success 201 {object} models.SuccessResponse{data=models.EquivalentDomainResponse} "添加成功"
+// @Failure 400 {object} models.ErrorResponse "参数错误"
+// @Router /autofill/equivalent-domains [post]
+func CreateEquivalentDomain(c *gin.Context) {
+	var req models.CreateEquivalentDomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	domains := normalizeEquivalentDomains(req.Domains)
+	if len(domains) < 2 {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "至少需要两个不同的有效域名")
+		return
+	}
+
+	group := models.EquivalentDomain{UserID: uint(c.GetInt64("user_id")), Domains: strings.Join(domains, " ")}
+	if err := database.DB.Create(&group).Error; err != nil {
+		log.Printf("添加等价域名失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "添加失败")
+		return
+	}
+	utils.SendCreatedResponse(c, models.EquivalentDomainResponse{ID: group.ID, Domains: domains})
+}
+
+// DeleteEquivalentDomain 删除用户自定义的等价域名组
+// @Summary 删除等价域名
+// @Tags Autofill
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "等价域名组ID"
+// @Success 200 {object} models.SuccessResponse "删除成功"
+// @Failure 404 {object} models.ErrorResponse "不存在"
+// @Router /autofill/equivalent-domains/{id} [delete]
+func DeleteEquivalentDomain(c *gin.Context) {
+	groupID, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的ID")
+		return
+	}
+	result := database.DB.Where("id = ? AND user_id = ?", groupID, c.GetInt64("user_id")).Delete(&models.EquivalentDomain{})
+	if result.Error != nil {
+		log.Printf("删除等价域名失败: %v", result.Error)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "删除失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.SendErrorResponse(c, http.StatusNotFound, "等价域名不存在")
+		return
+	}
+	utils.SendSuccessResponse(c, "删除成功")
+}
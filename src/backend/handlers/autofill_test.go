@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"email_server/models"
+	"email_server/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func createTestPlatform(t *testing.T, r *gin.Engine, token string, body map[string]interface{}) models.PlatformResponse {
+	w := doAuthJSON(r, "POST", "/api/v1/platforms", token, body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var platform models.PlatformResponse
+	decodeData(t, w, &platform)
+	return platform
+}
+
+func createTestRegistration(t *testing.T, db *gorm.DB, userID, platformID uint, username, password string) models.PlatformRegistration {
+	encrypted, err := utils.EncryptPassword(password)
+	require.NoError(t, err)
+	registration := models.PlatformRegistration{UserID: userID, PlatformID: platformID, LoginUsername: &username, LoginPasswordEncrypted: encrypted}
+	require.NoError(t, db.Create(&registration).Error)
+	return registration
+}
+
+func autofillLookup(t *testing.T, r *gin.Engine, token, pageURL, include string) models.AutofillResponse {
+	path := "/api/v1/autofill?url=" + url.QueryEscape(pageURL)
+	if include != "" {
+		path += "&include=" + include
+	}
+	w := doAuthJSON(r, "GET", path, token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp models.AutofillResponse
+	decodeData(t, w, &resp)
+	return resp
+}
+
+func TestAutofill_MatchesByDomainURLRulesAndEquivalents(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	session := registerUser(t, r, "kate", "kate@example.com")
+
+	example := createTestPlatform(t, r, session.Token, map[string]interface{}{
+		"name":        "Example",
+		"website_url": "https://www.example.co.uk/login",
+		"urls": []map[string]string{
+			{"url": "https://billing.example-pay.com"},
+			{"url": "androidapp://com.example.app", "match_mode": "base_domain"},
+			{"url": " "},
+			{"url": "https://billing.example-pay.com"},
+		},
+	})
+	require.Len(t, example.URLs, 2, "空网址和重复项被忽略")
+	assert.Equal(t, "https://billing.example-pay.com", example.URLs[0].URL)
+	assert.Equal(t, "base_domain", example.URLs[0].MatchMode)
+	assert.Equal(t, "androidapp://com.example.app", example.URLs[1].URL)
+	google := createTestPlatform(t, r, session.Token, map[string]interface{}{"name": "Google", "website_url": "https://accounts.google.com"})
+	pages := createTestPlatform(t, r, session.Token, map[string]interface{}{"name": "Pages", "website_url": "https://kate.github.io"})
+	createTestRegistration(t, db, session.User.ID, example.ID, "kate", "example-password")
+	createTestRegistration(t, db, session.User.ID, google.ID, "kate.g", "google-password")
+	createTestRegistration(t, db, session.User.ID, pages.ID, "kate", "pages-password")
+
+	// 其他用户的平台不会被匹配
+	other := registerUser(t, r, "liam", "liam@example.com")
+	otherPlatform := createTestPlatform(t, r, other.Token, map[string]interface{}{"name": "Example", "website_url": "https://example.co.uk"})
+	createTestRegistration(t, db, other.User.ID, otherPlatform.ID, "liam", "liam-password")
+
+	cases := []struct {
+		pageURL  string
+		platform string
+		match    string
+	}{
+		{"https://example.co.uk/", "Example", models.AutofillMatchExact},
+		{"https://shop.example.co.uk/cart?id=1", "Example", models.AutofillMatchDomain},
+		{"pay.example-pay.com", "Example", models.AutofillMatchDomain},
+		{"androidapp://com.example.app", "Example", models.AutofillMatchApp},
+		{"https://www.youtube.com/watch", "Google", models.AutofillMatchEquivalent},
+		{"https://kate.github.io/blog", "Pages", models.AutofillMatchExact},
+	}
+	for _, tc := range cases {
+		resp := autofillLookup(t, r, session.Token, tc.pageURL, "")
+		require.Len(t, resp.Matches, 1, tc.pageURL)
+		assert.Equal(t, tc.platform, resp.Matches[0].PlatformName, tc.pageURL)
+		assert.Equal(t, tc.match, resp.Matches[0].Match, tc.pageURL)
+		assert.True(t, resp.Matches[0].HasPassword)
+		assert.Empty(t, resp.Matches[0].Password, "未要求时不返回密码")
+	}
+
+	// 公共后缀（co.uk、github.io）下的其他站点不算同一域名
+	for _, pageURL := range []string{"https://other.co.uk", "https://someone.github.io", "androidapp://com.other.app"} {
+		assert.Empty(t, autofillLookup(t, r, session.Token, pageURL, "").Matches, pageURL)
+	}
+
+	w := doAuthJSON(r, "GET", "/api/v1/autofill?url=", session.Token, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doAuthJSON(r, "POST", "/api/v1/platforms", session.Token, map[string]interface{}{
+		"name": "Broken", "urls": []map[string]string{{"url": "https://"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doAuthJSON(r, "POST", "/api/v1/platforms", session.Token, map[string]interface{}{
+		"name": "Broken", "urls": []map[string]string{{"url": "(unclosed", "match_mode": "regex"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doAuthJSON(r, "POST", "/api/v1/platforms", session.Token, map[string]interface{}{
+		"name": "Broken", "urls": []map[string]string{{"url": "https://example.com", "match_mode": "fuzzy"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAutofill_MatchModes(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	session := registerUser(t, r, "pia", "pia@example.com")
+
+	corp := createTestPlatform(t, r, session.Token, map[string]interface{}{
+		"name": "Corp",
+		"urls": []map[string]string{
+			{"url": "sso.corp.example", "match_mode": "host"},
+			{"url": "https://tools.example.org/corp/", "match_mode": "starts_with"},
+			{"url": `^https://[a-z]+\.corp-cdn\.net/login`, "match_mode": "regex"},
+		},
+	})
+	createTestRegistration(t, db, session.User.ID, corp.ID, "pia", "corp-password")
+
+	cases := []struct {
+		pageURL string
+		matched bool
+	}{
+		{"https://sso.corp.example/auth", true},
+		{"https://www.sso.corp.example/", true},
+		{"https://mail.corp.example/", false},
+		{"https://tools.example.org/corp/login", true},
+		{"https://tools.example.org/other", false},
+		{"https://eu.corp-cdn.net/login?next=/", true},
+		{"https://eu.corp-cdn.net/logout", false},
+	}
+	for _, tc := range cases {
+		resp := autofillLookup(t, r, session.Token, tc.pageURL, "")
+		if !tc.matched {
+			assert.Empty(t, resp.Matches, tc.pageURL)
+			continue
+		}
+		require.Len(t, resp.Matches, 1, tc.pageURL)
+		assert.Equal(t, models.AutofillMatchExact, resp.Matches[0].Match, tc.pageURL)
+	}
+
+	// 更新时替换全部网址规则；不传 urls 时保持不变
+	platformPath := "/api/v1/platforms/" + strconv.Itoa(int(corp.ID))
+	w := doAuthJSON(r, "PUT", platformPath, session.Token, map[string]interface{}{
+		"name": "Corp", "urls": []map[string]string{{"url": "corp.example"}},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doAuthJSON(r, "PUT", platformPath, session.Token, map[string]interface{}{"name": "Corp", "notes": "updated"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated models.PlatformResponse
+	decodeData(t, w, &updated)
+	require.Len(t, updated.URLs, 1)
+	assert.Equal(t, "corp.example", updated.URLs[0].URL)
+
+	resp := autofillLookup(t, r, session.Token, "https://mail.corp.example/", "")
+	require.Len(t, resp.Matches, 1)
+	assert.Equal(t, models.AutofillMatchDomain, resp.Matches[0].Match)
+	assert.Empty(t, autofillLookup(t, r, session.Token, "https://tools.example.org/corp/login", "").Matches)
+}
+
+func TestAutofill_SecretsRequireRevealScope(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	session := registerUser(t, r, "mia", "mia@example.com")
+	platform := createTestPlatform(t, r, session.Token, map[string]interface{}{"name": "Example", "website_url": "https://example.com"})
+	registration := createTestRegistration(t, db, session.User.ID, platform.ID, "mia", "site-password")
+	registrationPath := "/api/v1/platform-registrations/" + strconv.Itoa(int(registration.ID))
+
+	w := doAuthJSON(r, "PUT", registrationPath, session.Token, map[string]interface{}{
+		"login_username": "mia", "totp_secret": "not base32!",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doAuthJSON(r, "PUT", registrationPath, session.Token, map[string]interface{}{
+		"login_username": "mia", "totp_secret": "otpauth://totp/Example:mia?secret=jbsw y3dp ehpk 3pxp&issuer=Example",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"has_totp":true`)
+
+	// 不传 totp_secret 时保持不变
+	w = doAuthJSON(r, "PUT", registrationPath, session.Token, map[string]interface{}{"login_username": "mia", "notes": "updated"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"has_totp":true`)
+
+	w = doAuthJSON(r, "GET", registrationPath+"/totp", session.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var totp models.AutofillTOTP
+	decodeData(t, w, &totp)
+	assert.Len(t, totp.Code, 6)
+	assert.True(t, totp.ExpiresIn > 0 && totp.ExpiresIn <= 30)
+
+	readOnly := createAPIToken(t, r, session.Token, models.ScopeRegistrationsRead)
+	resp := autofillLookup(t, r, readOnly.Token, "https://login.example.com", "")
+	require.Len(t, resp.Matches, 1)
+	assert.True(t, resp.Matches[0].HasTOTP)
+	assert.Nil(t, resp.Matches[0].TOTP)
+
+	w = doAuthJSON(r, "GET", "/api/v1/autofill?url=example.com&include=password", readOnly.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), models.ScopeSecretsReveal)
+	w = doAuthJSON(r, "GET", registrationPath+"/totp", readOnly.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	reveal := createAPIToken(t, r, session.Token, models.ScopeRegistrationsRead, models.ScopeSecretsReveal)
+	resp = autofillLookup(t, r, reveal.Token, "https://login.example.com", "password,totp")
+	require.Len(t, resp.Matches, 1)
+	assert.Equal(t, "site-password", resp.Matches[0].Password)
+	require.NotNil(t, resp.Matches[0].TOTP)
+	assert.Len(t, resp.Matches[0].TOTP.Code, 6)
+
+	// 空字符串清除 TOTP 密钥
+	w = doAuthJSON(r, "PUT", registrationPath, session.Token, map[string]interface{}{"login_username": "mia", "totp_secret": ""})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"has_totp":false`)
+	w = doAuthJSON(r, "GET", registrationPath+"/totp", session.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAutofill_CustomEquivalentDomains(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	session := registerUser(t, r, "noah", "noah@example.com")
+	platform := createTestPlatform(t, r, session.Token, map[string]interface{}{"name": "Corp", "website_url": "https://sso.corp-example.org"})
+	createTestRegistration(t, db, session.User.ID, platform.ID, "noah", "corp-password")
+
+	assert.Empty(t, autofillLookup(t, r, session.Token, "https://mail.corp-example.net", "").Matches)
+
+	w := doAuthJSON(r, "POST", "/api/v1/autofill/equivalent-domains", session.Token, map[string]interface{}{
+		"domains": []string{"https://www.corp-example.org/x", "corp-example.org"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "去重后只剩一个域名")
+
+	w = doAuthJSON(r, "POST", "/api/v1/autofill/equivalent-domains", session.Token, map[string]interface{}{
+		"domains": []string{"https://www.corp-example.org/x", "mail.corp-example.net"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var group models.EquivalentDomainResponse
+	decodeData(t, w, &group)
+	assert.Equal(t, []string{"corp-example.net", "corp-example.org"}, group.Domains)
+
+	resp := autofillLookup(t, r, session.Token, "https://mail.corp-example.net", "")
+	require.Len(t, resp.Matches, 1)
+	assert.Equal(t, models.AutofillMatchEquivalent, resp.Matches[0].Match)
+
+	w = doAuthJSON(r, "GET", "/api/v1/autofill/equivalent-domains", session.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var groups []models.EquivalentDomainResponse
+	decodeData(t, w, &groups)
+	require.Len(t, groups, len(builtinEquivalentDomains)+1)
+	assert.True(t, groups[0].BuiltIn)
+	assert.Equal(t, group.ID, groups[len(groups)-1].ID)
+
+	// 其他用户不能删除
+	other := registerUser(t, r, "olivia", "olivia@example.com")
+	groupPath := "/api/v1/autofill/equivalent-domains/" + strconv.Itoa(int(group.ID))
+	w = doAuthJSON(r, "DELETE", groupPath, other.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, autofillLookup(t, r, other.Token, "https://mail.corp-example.net", "").Matches)
+
+	w = doAuthJSON(r, "DELETE", groupPath, session.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, autofillLookup(t, r, session.Token, "https://mail.corp-example.net", "").Matches)
+}
+
+func TestGenerateTOTP_RFC6238Vector(t *testing.T) {
+	// RFC 6238 附录 B 的 SHA1 测试向量（取后 6 位）
+	code, remaining, err := utils.GenerateTOTP("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", time.Unix(59, 0))
+	require.NoError(t, err)
+	assert.Equal(t, "287082", code)
+	assert.Equal(t, time.Second, remaining)
+
+	code, _, err = utils.GenerateTOTP("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", time.Unix(1111111109, 0))
+	require.NoError(t, err)
+	assert.Equal(t, "081804", code)
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"email_server/database"
+	"email_server/imapid"
 	"email_server/integrations"
 	"email_server/models"
 	"email_server/utils"
@@ -50,6 +51,7 @@ func GetEmailServices(c *gin.Context) {
 
 // GetInbox fetches emails from the user's specified email account.
 // THIS FUNCTION HAS BEEN UPDATED TO USE MICROSOFT GRAPH API
+// 翻页：响应中的 nextCursor 作为下一次请求的 cursor 参数；Gmail 和 Graph 账户也支持 page 参数，由页码缓存换算为服务商的翻页标记
 func GetInbox(c *gin.Context) {
 	log.Println("[GetInbox] Handler started.")
 
@@ -107,55 +109,42 @@ func GetInbox(c *gin.Context) {
 	}
 	log.Printf("[GetInbox] Found email account: ID=%d, Email: %s", emailAccount.ID, emailAccount.EmailAddress)
 
-	var oauthToken models.UserOAuthToken
-	isOAuth2 := false
-	if err := database.DB.Where("email_account_id = ?", emailAccount.ID).First(&oauthToken).Error; err == nil {
-		isOAuth2 = true
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-		log.Printf("[GetInbox] Error checking for OAuth2 token: %v", err)
-	}
-
 	// 4. Decide which fetch method to use
-	var emails []models.Email
-	var total int
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
 	folder := c.DefaultQuery("folder", "inbox") // 支持文件夹参数，默认为inbox
 
-	if isOAuth2 {
-		// If it's OAuth2, we need to check the provider name
-		var provider models.OAuthProvider
-		if err := database.DB.First(&provider, oauthToken.ProviderID).Error; err != nil {
-			utils.SendErrorResponse(c, http.StatusInternalServerError, "Could not determine OAuth provider for this account.")
+	// cursor 优先于页码：客户端使用上一页返回的 nextCursor 继续加载
+	var pageToken string
+	hasCursor := false
+	if rawCursor := c.Query("cursor"); rawCursor != "" {
+		cursor, ok := decodeInboxCursor(rawCursor)
+		if !ok || cursor.AccountID != emailAccount.ID {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid cursor")
 			return
 		}
-
-		// ★★★ CORE LOGIC CHANGE IS HERE ★★★
-		if provider.Name == "microsoft" {
-			log.Printf("[GetInbox] Provider is '%s'. Using Microsoft Graph API to fetch emails from folder '%s'.", provider.Name, folder)
-			emails, total, err = integrations.FetchEmailsWithGraphAPIFromFolder(emailAccount, page, pageSize, folder)
-		} else if provider.Name == "google" {
-			log.Printf("[GetInbox] Provider is '%s'. Using Gmail API to fetch emails from folder '%s'.", provider.Name, folder)
-			// 将folder名称转换为Gmail标签
-			gmailLabel := convertFolderToGmailLabel(folder)
-			emails, total, err = integrations.FetchEmailsWithGmailAPIFromFolder(emailAccount, page, pageSize, gmailLabel)
-		} else {
-			// For other OAuth providers, we might still use IMAP
-			log.Printf("[GetInbox] Provider is '%s'. Using standard IMAP to fetch emails.", provider.Name)
-			emails, total, err = integrations.FetchEmails(emailAccount, page, pageSize)
-		}
-	} else {
-		// Fallback to password-based IMAP
-		log.Printf("[GetInbox] Account is not OAuth2. Using standard IMAP with password to fetch emails.")
-		// Check for IMAP settings for non-OAuth accounts
-		if emailAccount.IMAPServer == "" || emailAccount.IMAPPort == 0 {
-			utils.SendErrorResponse(c, http.StatusBadRequest, "IMAP settings are not configured for this non-OAuth email account.")
-			return
-		}
-		emails, total, err = integrations.FetchEmails(emailAccount, page, pageSize)
+		page, pageSize, folder, pageToken, hasCursor = cursor.Page, cursor.PageSize, cursor.Folder, cursor.Token, true
+	}
+	if page < 1 {
+		page = 1
 	}
+	if pageSize < 1 {
+		pageSize = 10
+	} else if pageSize > inboxMaxPageSize {
+		pageSize = inboxMaxPageSize
+	}
+	pageKey := inboxPageKey{UserID: userID, AccountID: emailAccount.ID, Folder: folder, PageSize: pageSize}
+	emails, total, nextToken, tokenPaged, err := fetchInboxPage(emailAccount, pageKey, page, pageToken, hasCursor)
 
 	// 5. Handle potential errors from fetching
+	if errors.Is(err, errInboxPageTooFar) {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Page is too far ahead, please load pages with nextCursor")
+		return
+	}
+	if errors.Is(err, errIMAPNotConfigured) {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "IMAP settings are not configured for this non-OAuth email account.")
+		return
+	}
 	if err != nil {
 		log.Printf("[GetInbox] Fetching emails failed with error: %v", err)
 		// Provide more user-friendly error messages based on the error type
@@ -170,16 +159,93 @@ func GetInbox(c *gin.Context) {
 		return
 	}
 	log.Printf("[GetInbox] Fetching successful. Fetched %d emails. Total reported: %d.", len(emails), total)
+	cacheInboxEmails(userID, emailAccount.ID, folder, emails)
+	if err := annotateEmailPlatforms(userID, emails); err != nil {
+		log.Printf("[GetInbox] Failed to match sender platforms: %v", err)
+	}
+	for i := range emails {
+		sanitizeEmailHTML(userID, &emails[i], false)
+	}
 
 	// 6. Return the successful response
+	// nextCursor 为空表示没有更多邮件
+	nextCursor := ""
+	if (tokenPaged && nextToken != "") || (!tokenPaged && page*pageSize < total) {
+		nextCursor = encodeInboxCursor(inboxCursor{
+			AccountID: emailAccount.ID, Folder: folder, PageSize: pageSize, Page: page + 1, Token: nextToken,
+		})
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"data": gin.H{
-			"emails": emails,
-			"total":  total,
+			"emails":     emails,
+			"total":      total,
+			"nextCursor": nextCursor,
+			"hasMore":    nextCursor != "",
 		},
 	})
 }
 
+// errIMAPNotConfigured 使用密码登录的账户没有配置 IMAP 服务器
+var errIMAPNotConfigured = errors.New("IMAP settings are not configured")
+
+// fetchInboxPage 按账户类型获取收件箱的一页邮件。tokenPaged 表示服务商只支持游标翻页，nextToken 为下一页的翻页标记
+func fetchInboxPage(emailAccount models.EmailAccount, key inboxPageKey, page int, pageToken string, hasCursor bool) (emails []models.Email, total int, nextToken string, tokenPaged bool, err error) {
+	var oauthToken models.UserOAuthToken
+	isOAuth2 := false
+	if err := database.DB.Where("email_account_id = ?", emailAccount.ID).First(&oauthToken).Error; err == nil {
+		isOAuth2 = true
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("[fetchInboxPage] Error checking for OAuth2 token: %v", err)
+	}
+
+	if isOAuth2 {
+		// If it's OAuth2, we need to check the provider name
+		var provider models.OAuthProvider
+		if err := database.DB.First(&provider, oauthToken.ProviderID).Error; err != nil {
+			return nil, 0, "", false, fmt.Errorf("could not determine OAuth provider for this account: %w", err)
+		}
+
+		// ★★★ CORE LOGIC CHANGE IS HERE ★★★
+		if provider.Name == "microsoft" {
+			log.Printf("[fetchInboxPage] Provider is '%s'. Using Microsoft Graph API to fetch emails from folder '%s'.", provider.Name, key.Folder)
+			tokenPaged = true
+			emails, total, nextToken, err = fetchTokenPagedInbox(key, page, pageToken, hasCursor,
+				func(token string) ([]models.Email, int, string, error) {
+					return integrations.FetchEmailsWithGraphAPIFromFolder(emailAccount, token, key.PageSize, key.Folder)
+				},
+				func(token string) (string, error) {
+					return integrations.NextGraphLink(emailAccount, token, key.PageSize, key.Folder)
+				})
+		} else if provider.Name == "google" {
+			log.Printf("[fetchInboxPage] Provider is '%s'. Using Gmail API to fetch emails from folder '%s'.", provider.Name, key.Folder)
+			// 将folder名称转换为Gmail标签
+			gmailLabel := convertFolderToGmailLabel(key.Folder)
+			tokenPaged = true
+			emails, total, nextToken, err = fetchTokenPagedInbox(key, page, pageToken, hasCursor,
+				func(token string) ([]models.Email, int, string, error) {
+					return integrations.FetchEmailsWithGmailAPIFromFolder(emailAccount, token, key.PageSize, gmailLabel)
+				},
+				func(token string) (string, error) {
+					return integrations.NextGmailPageToken(emailAccount, token, key.PageSize, gmailLabel)
+				})
+		} else {
+			// For other OAuth providers, we might still use IMAP
+			log.Printf("[fetchInboxPage] Provider is '%s'. Using standard IMAP to fetch emails.", provider.Name)
+			emails, total, err = integrations.FetchEmails(emailAccount, page, key.PageSize)
+		}
+	} else {
+		// Fallback to password-based IMAP
+		log.Printf("[fetchInboxPage] Account is not OAuth2. Using standard IMAP with password to fetch emails.")
+		// Check for IMAP settings for non-OAuth accounts
+		if emailAccount.IMAPServer == "" || emailAccount.IMAPPort == 0 {
+			return nil, 0, "", false, errIMAPNotConfigured
+		}
+		emails, total, err = integrations.FetchEmails(emailAccount, page, key.PageSize)
+	}
+
+	return emails, total, nextToken, tokenPaged, err
+}
+
 // GetEmailDetail fetches a single email's detailed information by messageId
 func GetEmailDetail(c *gin.Context) {
 	log.Println("[GetEmailDetail] Handler started.")
@@ -279,8 +345,12 @@ func GetEmailDetail(c *gin.Context) {
 				return
 			}
 		} else {
-			utils.SendErrorResponse(c, http.StatusNotImplemented, "Provider not supported for email detail fetching")
-			return
+			// 其他 OAuth 提供商与收件箱列表一致，使用 IMAP
+			log.Printf("[GetEmailDetail] Provider is '%s'. Using standard IMAP to fetch email detail.", provider.Name)
+			email, err = fetchIMAPEmailDetail(c, emailAccount, messageId)
+			if err != nil {
+				return
+			}
 		}
 	} else {
 		// Password-based IMAP account - use IMAP to fetch email detail
@@ -290,10 +360,8 @@ func GetEmailDetail(c *gin.Context) {
 			utils.SendErrorResponse(c, http.StatusBadRequest, "IMAP settings are not configured for this non-OAuth email account.")
 			return
 		}
-		email, err = integrations.FetchEmailDetailWithIMAP(emailAccount, messageId)
+		email, err = fetchIMAPEmailDetail(c, emailAccount, messageId)
 		if err != nil {
-			log.Printf("[GetEmailDetail] Error fetching email detail with IMAP: %v", err)
-			utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch email detail: "+err.Error())
 			return
 		}
 	}
@@ -304,6 +372,22 @@ func GetEmailDetail(c *gin.Context) {
 	}
 
 	log.Printf("[GetEmailDetail] Successfully fetched email detail for messageId: %s", messageId)
+	cacheEmailDetail(userID, emailAccount.ID, email)
+	detail := []models.Email{*email}
+	if err := annotateEmailPlatforms(userID, detail); err != nil {
+		log.Printf("[GetEmailDetail] Failed to match sender platform: %v", err)
+	}
+	email = &detail[0]
+	prepareEmailAttachments(userID, emailAccount.ID, email)
+
+	// 远程图片默认阻止；发件人在允许列表中或请求带 remote_content=1 时通过图片代理显示
+	allowRemote := c.Query("remote_content") == "1"
+	if !allowRemote {
+		if allowRemote, err = remoteContentAllowed(userID, email.From); err != nil {
+			log.Printf("[GetEmailDetail] Failed to check remote content allowlist: %v", err)
+		}
+	}
+	sanitizeEmailHTML(userID, email, allowRemote)
 
 	// 7. Return the successful response
 	c.JSON(http.StatusOK, gin.H{
@@ -311,6 +395,45 @@ func GetEmailDetail(c *gin.Context) {
 	})
 }
 
+// fetchIMAPEmailDetail 通过 IMAP 获取邮件详情，失败时已写入错误响应。
+// UIDVALIDITY 变化后用缓存中的 Message-ID 重新定位邮件，仍找不到时返回 410，提示客户端刷新列表
+func fetchIMAPEmailDetail(c *gin.Context, emailAccount models.EmailAccount, messageID string) (*models.Email, error) {
+	fallback := ""
+	if _, ok := imapid.Parse(messageID); ok {
+		fallback = cachedInternetMessageID(emailAccount.ID, messageID)
+	}
+	email, err := integrations.FetchEmailDetailWithIMAP(emailAccount, messageID, fallback)
+	if err != nil {
+		log.Printf("[GetEmailDetail] Error fetching email detail with IMAP: %v", err)
+		switch {
+		case errors.Is(err, integrations.ErrIMAPUIDValidityChanged):
+			utils.SendErrorResponse(c, http.StatusGone, "邮件ID已失效（邮箱文件夹已重建），请刷新邮件列表")
+		case errors.Is(err, integrations.ErrIMAPMessageNotFound):
+			utils.SendErrorResponse(c, http.StatusNotFound, "Email not found")
+		default:
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch email detail: "+err.Error())
+		}
+		return nil, err
+	}
+	return email, nil
+}
+
+// accountMailProvider 返回邮箱账户关联的 OAuth 提供商名称（如 "microsoft"、"google"），使用密码登录 IMAP 的账户返回空字符串
+func accountMailProvider(emailAccount models.EmailAccount) (string, error) {
+	var oauthToken models.UserOAuthToken
+	if err := database.DB.Where("email_account_id = ?", emailAccount.ID).First(&oauthToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	var provider models.OAuthProvider
+	if err := database.DB.First(&provider, oauthToken.ProviderID).Error; err != nil {
+		return "", err
+	}
+	return provider.Name, nil
+}
+
 // convertFolderToGmailLabel 将通用文件夹名称转换为Gmail标签
 func convertFolderToGmailLabel(folder string) string {
 	switch strings.ToLower(folder) {
@@ -375,27 +498,8 @@ func MarkEmailAsRead(c *gin.Context) {
 		return
 	}
 
-	// 4. 根据提供商调用相应的API标记为已读
-	log.Printf("[MarkEmailAsRead] EmailAccount Provider: '%s'", emailAccount.Provider)
-
-	// 根据Provider字段判断邮箱服务商类型
-	providerLower := strings.ToLower(emailAccount.Provider)
-
-	if providerLower == "microsoft" || providerLower == "outlook.com" || strings.Contains(providerLower, "outlook") || strings.Contains(providerLower, "hotmail") {
-		log.Printf("[MarkEmailAsRead] Using Microsoft Graph API for provider: %s", emailAccount.Provider)
-		err = integrations.MarkMicrosoftEmailAsRead(emailAccount, messageId)
-	} else if providerLower == "google" || providerLower == "gmail.com" || strings.Contains(providerLower, "gmail") {
-		log.Printf("[MarkEmailAsRead] Using Gmail API for provider: %s", emailAccount.Provider)
-		err = integrations.MarkGmailAsRead(emailAccount, messageId)
-	} else {
-		log.Printf("[MarkEmailAsRead] Unsupported provider: '%s'", emailAccount.Provider)
-		utils.SendErrorResponse(c, http.StatusNotImplemented, fmt.Sprintf("该提供商 '%s' 暂不支持标记已读功能", emailAccount.Provider))
-		return
-	}
-
-	if err != nil {
-		log.Printf("[MarkEmailAsRead] Error marking email as read: %v", err)
-		utils.SendErrorResponse(c, http.StatusInternalServerError, "标记邮件已读失败: "+err.Error())
+	// 4. 按账户类型（Graph、Gmail 或 IMAP）标记为已读
+	if _, ok := runSingleMessageAction(c, emailAccount, messageId, models.MessageActionMarkRead, ""); !ok {
 		return
 	}
 
@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"email_server/database"
+	"email_server/integrations"
+	"email_server/mailwatch"
 	"email_server/models"
 	"email_server/utils"
+	"log"
 	"net/http"
 	"strconv"
 	"strings" // 新增导入
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -44,6 +48,7 @@ func CreateEmailAccount(c *gin.Context) {
 		Password     string `json:"password" binding:"omitempty,min=6"`
 		IMAPServer   string `json:"imap_server"`
 		IMAPPort     *int   `json:"imap_port"`
+		IMAPSecurity string `json:"imap_security" binding:"omitempty,oneof=tls starttls none"`
 		Notes        string `json:"notes"`
 		PhoneNumber  string `json:"phone_number"`
 	}
@@ -87,6 +92,7 @@ func CreateEmailAccount(c *gin.Context) {
 		PasswordEncrypted: hashedPassword,
 		Provider:          provider,
 		IMAPServer:        input.IMAPServer,
+		IMAPSecurity:      input.IMAPSecurity,
 		Notes:             input.Notes,
 		PhoneNumber:       input.PhoneNumber,
 	}
@@ -381,12 +387,15 @@ func UpdateEmailAccount(c *gin.Context) {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询待更新邮箱账户失败: "+err.Error())
 		return
 	}
+	// 记录修改前的快照，用于写入版本历史
+	before := emailAccount.Snapshot()
 
 	var input struct {
 		EmailAddress string `json:"email_address" binding:"omitempty,email"`
 		Password     string `json:"password" binding:"omitempty,min=6"`
 		IMAPServer   string `json:"imap_server"`
 		IMAPPort     *int   `json:"imap_port"`
+		IMAPSecurity string `json:"imap_security" binding:"omitempty,oneof=tls starttls none"`
 		Notes        string `json:"notes"`
 		PhoneNumber  string `json:"phone_number"`
 	}
@@ -416,6 +425,8 @@ func UpdateEmailAccount(c *gin.Context) {
 	emailAccount.Notes = input.Notes
 	emailAccount.PhoneNumber = input.PhoneNumber
 	emailAccount.IMAPServer = input.IMAPServer
+	// 与 IMAP 服务器、端口一样按请求整体更新，为空表示按端口推断
+	emailAccount.IMAPSecurity = input.IMAPSecurity
 	if input.IMAPPort != nil {
 		emailAccount.IMAPPort = *input.IMAPPort
 	} else {
@@ -423,17 +434,41 @@ func UpdateEmailAccount(c *gin.Context) {
 		emailAccount.IMAPPort = 0
 	}
 
-	if err := database.DB.Save(&emailAccount).Error; err != nil {
+	tx := database.DB.Begin()
+	if tx.Error != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "开启数据库事务失败: "+tx.Error.Error())
+		return
+	}
+
+	if err := recordRevision(tx, c, emailAccount.UserID, models.RevisionEntityEmailAccount, emailAccount.ID, models.RevisionActionUpdate, before, before.DiffFields(emailAccount.Snapshot())); err != nil {
+		tx.Rollback()
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "保存版本历史失败: "+err.Error())
+		return
+	}
+
+	if err := tx.Save(&emailAccount).Error; err != nil {
+		tx.Rollback()
+		if utils.IsUniqueConstraintError(err) {
+			utils.SendErrorResponse(c, http.StatusConflict, "该邮箱地址已存在")
+			return
+		}
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "更新邮箱账户失败: "+err.Error())
 		return
 	}
 
+	if err := tx.Commit().Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "提交事务失败: "+err.Error())
+		return
+	}
+	// 登录信息可能已变化，之前的连接不再复用
+	integrations.CloseIMAPConnections(emailAccount.ID)
+
 	utils.SendSuccessResponse(c, emailAccount.ToEmailAccountResponse())
 }
 
 // DeleteEmailAccount godoc
 // @Summary 删除指定ID的邮箱账户
-// @Description 删除当前登录用户拥有的指定ID的邮箱账户
+// @Description 删除当前登录用户拥有的指定ID的邮箱账户，连同关联的平台注册信息和服务订阅一起移入回收站
 // @Tags EmailAccounts
 // @Produce json
 // @Param id path int true "邮箱账户ID"
@@ -482,31 +517,8 @@ func DeleteEmailAccount(c *gin.Context) {
 		return
 	}
 
-	// 1. 查找并硬删除关联的 PlatformRegistrations 及其下的 ServiceSubscriptions
-	var registrations []models.PlatformRegistration
-	if err := tx.Where("email_account_id = ?", emailAccount.ID).Find(&registrations).Error; err != nil {
-		tx.Rollback()
-		utils.SendErrorResponse(c, http.StatusInternalServerError, "查找关联的平台注册信息失败: "+err.Error())
-		return
-	}
-
-	for _, reg := range registrations {
-		// 1a. 硬删除关联的 ServiceSubscriptions
-		if err := tx.Unscoped().Where("platform_registration_id = ?", reg.ID).Delete(&models.ServiceSubscription{}).Error; err != nil {
-			tx.Rollback()
-			utils.SendErrorResponse(c, http.StatusInternalServerError, "删除服务订阅失败: "+err.Error())
-			return
-		}
-		// 1b. 硬删除 PlatformRegistration
-		if err := tx.Unscoped().Delete(&reg).Error; err != nil {
-			tx.Rollback()
-			utils.SendErrorResponse(c, http.StatusInternalServerError, "删除平台注册信息失败: "+err.Error())
-			return
-		}
-	}
-
-	// 2. 硬删除 EmailAccount
-	if err := tx.Unscoped().Delete(&emailAccount).Error; err != nil {
+	// 邮箱账户及其关联的平台注册信息、服务订阅一起移入回收站，可通过 /trash 恢复
+	if err := moveEmailAccountToTrash(tx, &emailAccount, time.Now()); err != nil {
 		tx.Rollback()
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "删除邮箱账户失败: "+err.Error())
 		return
@@ -517,6 +529,12 @@ func DeleteEmailAccount(c *gin.Context) {
 		return
 	}
 
+	// 停止新邮件监听，从回收站恢复账户后需要重新开启
+	if err := mailwatch.Disable(emailAccount); err != nil {
+		log.Printf("[DeleteEmailAccount] Disabling mail watch of account %d failed: %v", emailAccount.ID, err)
+	}
+	integrations.CloseIMAPConnections(emailAccount.ID)
+
 	utils.SendSuccessResponse(c, gin.H{"message": "邮箱账户及关联信息删除成功"})
 }
 
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"email_server/database"
+	"email_server/imapid"
+	"email_server/integrations"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// validateMessageAction 校验操作类型，返回移动的目标文件夹（不移动时为空）。错误信息可直接返回给客户端
+func validateMessageAction(action, folder string) (string, error) {
+	if !slices.Contains(models.MessageActionTypes, action) {
+		return "", errors.New("不支持的操作类型: " + action)
+	}
+	if action == models.MessageActionMove && strings.TrimSpace(folder) == "" {
+		return "", errors.New("移动邮件需要指定目标文件夹")
+	}
+	return integrations.MessageActionTargetFolder(action, folder)
+}
+
+// applyMessageAction 按账户类型调用 Graph、Gmail 或 IMAP 执行操作，并同步邮件缓存
+func applyMessageAction(emailAccount models.EmailAccount, messageIDs []string, action, folder string) ([]models.MessageActionResult, error) {
+	target, err := validateMessageAction(action, folder)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := accountMailProvider(emailAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.MessageActionResult
+	switch provider {
+	case "microsoft":
+		results, err = integrations.ApplyGraphMessageAction(emailAccount, messageIDs, action, folder)
+	case "google":
+		results, err = integrations.ApplyGmailMessageAction(emailAccount, messageIDs, action, folder)
+	default:
+		fallbacks := map[string]string{}
+		for _, id := range messageIDs {
+			if _, ok := imapid.Parse(id); ok {
+				fallbacks[id] = cachedInternetMessageID(emailAccount.ID, id)
+			}
+		}
+		results, err = integrations.ApplyIMAPMessageAction(emailAccount, messageIDs, fallbacks, action, folder)
+	}
+	if err != nil {
+		return nil, err
+	}
+	updateCachedEmailsAfterAction(emailAccount.ID, action, target, results)
+	return results, nil
+}
+
+// sendMessageActionError 将执行操作的错误转换为响应
+func sendMessageActionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, integrations.ErrUnsupportedMessageAction):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "不支持的操作类型")
+	case errors.Is(err, integrations.ErrFolderNotFound):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "找不到目标文件夹: "+err.Error())
+	case errors.Is(err, integrations.ErrMessageNotFound), errors.Is(err, integrations.ErrIMAPMessageNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "邮件不存在")
+	case errors.Is(err, integrations.ErrInsufficientScope):
+		utils.SendErrorResponse(c, http.StatusForbidden, "邮箱账户的授权范围不足，请重新授权该邮箱（Gmail 需要 gmail.modify，永久删除需要 https://mail.google.com/）")
+	case errors.Is(err, integrations.ErrIMAPUIDValidityChanged):
+		utils.SendErrorResponse(c, http.StatusGone, "邮件ID已失效（邮箱文件夹已重建），请刷新邮件列表")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "操作失败: "+err.Error())
+	}
+}
+
+// findUserEmailAccount 查询用户的邮箱账户，失败时已写入错误响应
+func findUserEmailAccount(c *gin.Context, accountID uint) (models.EmailAccount, bool) {
+	var emailAccount models.EmailAccount
+	if err := database.DB.Where("id = ? AND user_id = ?", accountID, c.GetInt64("user_id")).First(&emailAccount).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendErrorResponse(c, http.StatusNotFound, "邮箱账户未找到或无权访问")
+		} else {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "获取邮箱账户失败: "+err.Error())
+		}
+		return emailAccount, false
+	}
+	return emailAccount, true
+}
+
+// runSingleMessageAction 对单封邮件执行操作，失败时已写入错误响应
+func runSingleMessageAction(c *gin.Context, emailAccount models.EmailAccount, messageID, action, folder string) (models.MessageActionResult, bool) {
+	results, err := applyMessageAction(emailAccount, []string{messageID}, action, folder)
+	if err == nil && len(results) == 1 && results[0].Err != nil {
+		err = results[0].Err
+	}
+	if err != nil {
+		log.Printf("[EmailAction] %s on %s for account %d failed: %v", action, messageID, emailAccount.ID, err)
+		sendMessageActionError(c, err)
+		return models.MessageActionResult{}, false
+	}
+	return results[0], true
+}
+
+// PerformEmailAction 对单封邮件执行操作
+// @Summary 邮件操作
+// @Description 标记已读/未读、加/取消星标、移动、归档、移到已删除、永久删除、标记/取消垃圾邮件。
+// @Description 移动后 IMAP 和 Graph 邮件的ID可能变化，新ID在 newMessageId 中返回
+// @Tags Inbox
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param messageId path string true "邮件ID"
+// @Param account_id query int true "邮箱账户ID"
+// @Param request body models.MessageActionRequest true "操作"
+// @Success 200 {object} models.SuccessResponse{data=models.MessageActionResult} "操作成功"
+// @Failure 400 {object} models.ErrorResponse "参数错误或不支持的操作"
+// @Failure 404 {object} models.ErrorResponse "邮箱账户或邮件不存在"
+// @Failure 410 {object} models.ErrorResponse "邮件ID已失效"
+// @Router /inbox/emails/{messageId}/actions [post]
+func PerformEmailAction(c *gin.Context) {
+	var req models.MessageActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if _, err := validateMessageAction(req.Action, req.Folder); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	accountID, err := utils.StringToUint(c.Query("account_id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的账户ID")
+		return
+	}
+	emailAccount, ok := findUserEmailAccount(c, accountID)
+	if !ok {
+		return
+	}
+	result, ok := runSingleMessageAction(c, emailAccount, c.Param("messageId"), req.Action, req.Folder)
+	if !ok {
+		return
+	}
+	utils.SendSuccessResponse(c, result)
+}
+
+// BatchEmailAction 对同一邮箱账户的多封邮件执行操作
+// @Summary 批量邮件操作
+// @Description 一次最多 100 封。单封邮件失败不影响其他邮件，失败原因在对应结果的 error 中返回
+// @Tags Inbox
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.BatchMessageActionRequest true "操作"
+// @Success 200 {object} models.SuccessResponse "操作完成，返回 results、succeeded、failed"
+// @Failure 400 {object} models.ErrorResponse "参数错误或不支持的操作"
+// @Failure 404 {object} models.ErrorResponse "邮箱账户不存在"
+// @Router /inbox/actions [post]
+func BatchEmailAction(c *gin.Context) {
+	var req models.BatchMessageActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if _, err := validateMessageAction(req.Action, req.Folder); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	emailAccount, ok := findUserEmailAccount(c, req.AccountID)
+	if !ok {
+		return
+	}
+	results, err := applyMessageAction(emailAccount, req.MessageIDs, req.Action, req.Folder)
+	if err != nil {
+		log.Printf("[EmailAction] Batch %s for account %d failed: %v", req.Action, emailAccount.ID, err)
+		sendMessageActionError(c, err)
+		return
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	utils.SendSuccessResponse(c, gin.H{
+		"results":   results,
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+	})
+}
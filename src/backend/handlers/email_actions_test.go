@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMessageAction(t *testing.T) {
+	cases := []struct {
+		action, folder, target string
+		ok                     bool
+	}{
+		{models.MessageActionMarkRead, "", "", true},
+		{models.MessageActionFlag, "ignored", "", true},
+		{models.MessageActionDelete, "", "", true},
+		{models.MessageActionArchive, "", "archive", true},
+		{models.MessageActionTrash, "", "trash", true},
+		{models.MessageActionSpam, "", "spam", true},
+		{models.MessageActionNotSpam, "", "inbox", true},
+		{models.MessageActionMove, "JunkEmail", "spam", true},
+		{models.MessageActionMove, "Projects/2024", "Projects/2024", true},
+		{models.MessageActionMove, "  ", "", false},
+		{"explode", "", "", false},
+	}
+	for _, tc := range cases {
+		target, err := validateMessageAction(tc.action, tc.folder)
+		if !tc.ok {
+			assert.Error(t, err, tc.action)
+			continue
+		}
+		require.NoError(t, err, tc.action)
+		assert.Equal(t, tc.target, target, tc.action)
+	}
+}
+
+func TestEmailActions_ValidationAndOwnership(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	owner := registerUser(t, r, "mona", "mona@example.com")
+	other := registerUser(t, r, "nick", "nick@example.com")
+	account := models.EmailAccount{UserID: uint(owner.User.ID), EmailAddress: "mona@example.com", IMAPServer: "127.0.0.1", IMAPPort: 1}
+	require.NoError(t, db.Create(&account).Error)
+	single := fmt.Sprintf("/api/v1/inbox/emails/42/actions?account_id=%d", account.ID)
+
+	w := doAuthJSON(r, "POST", single, owner.Token, map[string]string{"action": "explode"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doAuthJSON(r, "POST", single, owner.Token, map[string]string{"action": "move"})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "移动需要目标文件夹")
+	w = doAuthJSON(r, "POST", "/api/v1/inbox/emails/42/actions?account_id=abc", owner.Token, map[string]string{"action": "flag"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doAuthJSON(r, "POST", single, other.Token, map[string]string{"action": "flag"})
+	assert.Equal(t, http.StatusNotFound, w.Code, "不能操作其他用户的邮箱账户")
+
+	ids := make([]string, 101)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i + 1)
+	}
+	w = doAuthJSON(r, "POST", "/api/v1/inbox/actions", owner.Token, map[string]interface{}{
+		"account_id": account.ID, "message_ids": ids, "action": "mark_read",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "一次最多 100 封")
+	w = doAuthJSON(r, "POST", "/api/v1/inbox/actions", owner.Token, map[string]interface{}{
+		"account_id": account.ID, "message_ids": []string{}, "action": "mark_read",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doAuthJSON(r, "POST", "/api/v1/inbox/actions", other.Token, map[string]interface{}{
+		"account_id": account.ID, "message_ids": []string{"1"}, "action": "archive",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// IMAP 服务器不可达时整体失败，不修改缓存
+	w = doAuthJSON(r, "POST", "/api/v1/inbox/actions", owner.Token, map[string]interface{}{
+		"account_id": account.ID, "message_ids": []string{"1"}, "action": "archive",
+	})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "操作失败"), w.Body.String())
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/imapid"
+	"email_server/integrations"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// inlineImageTypes 可以在浏览器中直接显示的附件类型，其余类型一律作为下载返回
+var inlineImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// cidPattern HTML 正文中引用内嵌图片的 cid: 地址
+var cidPattern = regexp.MustCompile(`(?i)\bcid:([^"'\s)>]+)`)
+
+// emailAttachmentURL 附件的下载地址，带有签名 token，可直接用于 <img> 和下载链接
+func emailAttachmentURL(accountID uint, messageID, attachmentID, token string) string {
+	query := url.Values{}
+	query.Set("account_id", fmt.Sprint(accountID))
+	query.Set("token", token)
+	return "/api/v1/inbox/emails/" + url.PathEscape(messageID) + "/attachments/" + url.PathEscape(attachmentID) + "?" + query.Encode()
+}
+
+// prepareEmailAttachments 为附件生成签名下载地址，并把 HTML 正文中的 cid: 引用改写为对应附件的地址
+func prepareEmailAttachments(userID, accountID uint, email *models.Email) {
+	if len(email.Attachments) == 0 {
+		return
+	}
+	var user models.User
+	if err := database.DB.Select("token_version").First(&user, userID).Error; err != nil {
+		log.Printf("[prepareEmailAttachments] Failed to load user %d: %v", userID, err)
+		return
+	}
+
+	byContentID := map[string]string{}
+	for i := range email.Attachments {
+		attachment := &email.Attachments[i]
+		if attachment.ID == "" {
+			continue
+		}
+		token, err := utils.GenerateAttachmentURLToken(int64(userID), user.TokenVersion, utils.AttachmentURLTarget{
+			AccountID:    accountID,
+			MessageID:    email.MessageID,
+			AttachmentID: attachment.ID,
+		})
+		if err != nil {
+			log.Printf("[prepareEmailAttachments] Failed to sign attachment url: %v", err)
+			return
+		}
+		attachment.URL = emailAttachmentURL(accountID, email.MessageID, attachment.ID, token)
+		if attachment.ContentID != "" {
+			byContentID[strings.ToLower(attachment.ContentID)] = attachment.URL
+		}
+	}
+	email.HTMLBody = rewriteCIDReferences(email.HTMLBody, byContentID)
+}
+
+// rewriteCIDReferences 将 cid: 引用替换为附件地址，找不到对应附件的引用保持不变
+func rewriteCIDReferences(html string, byContentID map[string]string) string {
+	if html == "" || len(byContentID) == 0 {
+		return html
+	}
+	return cidPattern.ReplaceAllStringFunc(html, func(ref string) string {
+		contentID := ref[len("cid:"):]
+		if unescaped, err := url.PathUnescape(contentID); err == nil {
+			contentID = unescaped
+		}
+		target, ok := byContentID[strings.ToLower(trimAngle(contentID))]
+		if !ok {
+			return ref
+		}
+		// 地址会出现在 HTML 属性中，& 需要转义
+		return strings.ReplaceAll(target, "&", "&amp;")
+	})
+}
+
+// trimAngle 去掉两侧的尖括号
+func trimAngle(s string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(s, "<"), ">")
+}
+
+// attachmentMaxBytes 附件下载大小上限
+func attachmentMaxBytes() int64 {
+	mb := config.AppConfig.Attachment.MaxSizeMB
+	if mb <= 0 {
+		mb = 25
+	}
+	return int64(mb) << 20
+}
+
+// attachmentDisposition 生成 Content-Disposition，文件名含非 ASCII 字符时按 RFC 2231 编码
+func attachmentDisposition(disposition, filename string) string {
+	filename = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '/' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+	if filename == "" {
+		filename = "attachment"
+	}
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); value != "" {
+		return value
+	}
+	return disposition
+}
+
+// GetEmailAttachment 下载邮件附件
+// @Summary 下载邮件附件
+// @Description 从 IMAP、Gmail 或 Microsoft Graph 获取附件内容。邮件详情中附件的 url 带有签名 token，可以不带 Authorization 头直接访问；位图图片内嵌显示，其余类型作为下载返回
+// @Tags Inbox
+// @Produce octet-stream
+// @Security BearerAuth
+// @Param messageId path string true "邮件ID"
+// @Param attachmentId path string true "附件ID"
+// @Param account_id query int true "邮箱账户ID"
+// @Param token query string false "邮件详情返回的附件签名 token"
+// @Success 200 {file} binary "附件内容"
+// @Failure 401 {object} models.ErrorResponse "未认证或链接已过期"
+// @Failure 404 {object} models.ErrorResponse "邮件或附件不存在"
+// @Failure 410 {object} models.ErrorResponse "邮件ID已失效"
+// @Failure 413 {object} models.ErrorResponse "附件超过下载大小上限"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /inbox/emails/{messageId}/attachments/{attachmentId} [get]
+func GetEmailAttachment(c *gin.Context) {
+	userID := uint(c.GetInt64("user_id"))
+	if userID == 0 {
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "User not authenticated (user_id not in context)")
+		return
+	}
+	messageID, attachmentID := c.Param("messageId"), c.Param("attachmentId")
+	accountID, err := utils.StringToUint(c.Query("account_id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid account_id format")
+		return
+	}
+
+	var emailAccount models.EmailAccount
+	if err := database.DB.Where("id = ? AND user_id = ?", accountID, userID).First(&emailAccount).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendErrorResponse(c, http.StatusNotFound, "Email account not found or access denied")
+		} else {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve email account")
+		}
+		return
+	}
+
+	provider, err := accountMailProvider(emailAccount)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve provider information")
+		return
+	}
+
+	maxBytes := attachmentMaxBytes()
+	var content *integrations.AttachmentContent
+	switch provider {
+	case "microsoft":
+		content, err = integrations.FetchGraphAttachment(emailAccount, messageID, attachmentID, maxBytes)
+	case "google":
+		content, err = integrations.FetchGmailAttachment(emailAccount, messageID, attachmentID, maxBytes)
+	default:
+		fallback := ""
+		if _, ok := imapid.Parse(messageID); ok {
+			fallback = cachedInternetMessageID(emailAccount.ID, messageID)
+		}
+		content, err = integrations.FetchIMAPAttachment(emailAccount, messageID, fallback, attachmentID, maxBytes)
+	}
+	if err != nil {
+		log.Printf("[GetEmailAttachment] Failed to fetch attachment %s of %s: %v", attachmentID, messageID, err)
+		switch {
+		case errors.Is(err, integrations.ErrAttachmentNotFound), errors.Is(err, integrations.ErrIMAPMessageNotFound):
+			utils.SendErrorResponse(c, http.StatusNotFound, "附件不存在")
+		case errors.Is(err, integrations.ErrAttachmentTooLarge):
+			utils.SendErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("附件超过下载大小上限（%d MB）", maxBytes>>20))
+		case errors.Is(err, integrations.ErrIMAPUIDValidityChanged):
+			utils.SendErrorResponse(c, http.StatusGone, "邮件ID已失效（邮箱文件夹已重建），请刷新邮件列表")
+		default:
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch attachment")
+		}
+		return
+	}
+	defer content.Body.Close()
+	writeAttachment(c, content, maxBytes)
+}
+
+// writeAttachment 以流的方式返回附件内容。附件内容来自第三方，禁止浏览器嗅探类型并以沙箱方式处理，
+// 只有位图图片内嵌显示，避免 HTML 等附件在本站域名下执行
+func writeAttachment(c *gin.Context, content *integrations.AttachmentContent, maxBytes int64) {
+	mediaType, _, err := mime.ParseMediaType(content.MimeType)
+	if err != nil || mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	disposition := "attachment"
+	if inlineImageTypes[mediaType] {
+		disposition = "inline"
+	}
+
+	c.Header("Content-Disposition", attachmentDisposition(disposition, content.Filename))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Header("Content-Type", mediaType)
+	c.Status(http.StatusOK)
+	written, err := io.Copy(c.Writer, io.LimitReader(content.Body, maxBytes))
+	if err != nil {
+		log.Printf("[GetEmailAttachment] Streaming attachment failed after %d bytes: %v", written, err)
+	}
+}
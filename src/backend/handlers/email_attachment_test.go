@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPrepareEmailAttachments_SignsURLsAndRewritesCID(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	session := registerUser(t, r, "iris", "iris@example.com")
+	// 127.0.0.1:1 拒绝连接，通过认证的请求在连接 IMAP 时失败
+	account := models.EmailAccount{UserID: uint(session.User.ID), EmailAddress: "iris@example.com", IMAPServer: "127.0.0.1", IMAPPort: 1}
+	require.NoError(t, db.Create(&account).Error)
+
+	email := &models.Email{
+		MessageID: "imap_abc",
+		HTMLBody:  `<p><img src="cid:Logo@Example"><img src='cid:%3Cphoto%40example%3E'><img src="cid:missing@example"></p>`,
+		Attachments: []models.Attachment{
+			{ID: "2", Filename: "logo.png", MimeType: "image/png", ContentID: "logo@example", Inline: true},
+			{ID: "3", Filename: "photo.jpg", MimeType: "image/jpeg", ContentID: "photo@example", Inline: true},
+			{ID: "4", Filename: "报告.pdf", MimeType: "application/pdf"},
+		},
+	}
+	prepareEmailAttachments(uint(session.User.ID), account.ID, email)
+
+	for _, attachment := range email.Attachments {
+		require.True(t, strings.HasPrefix(attachment.URL, "/api/v1/inbox/emails/imap_abc/attachments/"+attachment.ID+"?"), attachment.URL)
+	}
+	logoURL := strings.ReplaceAll(email.Attachments[0].URL, "&", "&amp;")
+	photoURL := strings.ReplaceAll(email.Attachments[1].URL, "&", "&amp;")
+	assert.Contains(t, email.HTMLBody, `<img src="`+logoURL+`">`, "Content-ID 不区分大小写")
+	assert.Contains(t, email.HTMLBody, `<img src='`+photoURL+`'>`, "支持 URL 编码和尖括号")
+	assert.Contains(t, email.HTMLBody, `cid:missing@example`, "找不到附件的引用保持不变")
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// 签名链接不需要 Authorization 头
+	w := get(email.Attachments[2].URL)
+	assert.Equal(t, http.StatusInternalServerError, w.Code, "通过认证后连接 IMAP 失败: %s", w.Body.String())
+
+	// 未签名、签名指向其他附件都会被拒绝
+	w = get("/api/v1/inbox/emails/imap_abc/attachments/4?account_id=1")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = get(strings.Replace(email.Attachments[2].URL, "/attachments/4?", "/attachments/5?", 1))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 重置密码等操作使登录 token 失效后，旧链接同样失效
+	require.NoError(t, db.Model(&models.User{}).Where("id = ?", session.User.ID).Update("token_version", gorm.Expr("token_version + 1")).Error)
+	w = get(email.Attachments[2].URL)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAttachmentDisposition(t *testing.T) {
+	assert.Equal(t, `attachment; filename=report.pdf`, attachmentDisposition("attachment", "report.pdf"))
+	assert.Equal(t, `attachment; filename*=utf-8''%E6%8A%A5%E5%91%8A.pdf`, attachmentDisposition("attachment", "报告.pdf"))
+	assert.Equal(t, `inline; filename=a_b__c.png`, attachmentDisposition("inline", "a/b\r\nc.png"))
+	assert.Equal(t, `attachment; filename=attachment`, attachmentDisposition("attachment", ""))
+}
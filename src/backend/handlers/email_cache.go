@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"html"
+	"log"
+	"regexp"
+	"strings"
+
+	"email_server/database"
+	"email_server/imapid"
+	"email_server/models"
+
+	"gorm.io/gorm/clause"
+)
+
+var htmlTagPattern = regexp.MustCompile(`(?s)<(script|style)[^>]*>.*?</(script|style)>|<[^>]*>`)
+
+// htmlToText 粗略地将 HTML 正文转为纯文本，仅用于搜索索引
+func htmlToText(s string) string {
+	s = htmlTagPattern.ReplaceAllString(s, " ")
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// cacheInboxEmails 将收件箱列表中的邮件写入缓存以便全文搜索；已缓存的正文保持不变。
+// 缓存失败只记录日志，不影响接口返回。
+func cacheInboxEmails(userID, emailAccountID uint, folder string, emails []models.Email) {
+	if len(emails) == 0 {
+		return
+	}
+	rows := make([]models.CachedEmail, 0, len(emails))
+	for _, e := range emails {
+		if e.MessageID == "" {
+			continue
+		}
+		e.Body = ""
+		rows = append(rows, models.NewCachedEmail(userID, emailAccountID, folder, e))
+	}
+	if len(rows) == 0 {
+		return
+	}
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "email_account_id"}, {Name: "message_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"internet_message_id", "folder", "subject", "from_name", "from_address", "snippet", "date", "updated_at"}),
+	}).Create(&rows).Error
+	if err != nil {
+		log.Printf("[EmailCache] Failed to cache %d emails for account %d: %v", len(rows), emailAccountID, err)
+	}
+}
+
+// cacheEmailDetail 将邮件详情（含正文）写入缓存；已缓存邮件的文件夹保持不变
+func cacheEmailDetail(userID, emailAccountID uint, email *models.Email) {
+	if email == nil || email.MessageID == "" {
+		return
+	}
+	e := *email
+	if strings.TrimSpace(e.Body) == "" && e.HTMLBody != "" {
+		e.Body = htmlToText(e.HTMLBody)
+	}
+	row := models.NewCachedEmail(userID, emailAccountID, "", e)
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "email_account_id"}, {Name: "message_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"internet_message_id", "subject", "from_name", "from_address", "body", "date", "updated_at"}),
+	}).Create(&row).Error
+	if err != nil {
+		log.Printf("[EmailCache] Failed to cache email %s for account %d: %v", email.MessageID, emailAccountID, err)
+	}
+}
+
+// cachedInternetMessageID 返回缓存中记录的 Message-ID 头，未缓存时返回空字符串
+func cachedInternetMessageID(emailAccountID uint, messageID string) string {
+	var cached models.CachedEmail
+	err := database.DB.Select("internet_message_id").
+		Where("email_account_id = ? AND message_id = ?", emailAccountID, messageID).
+		Limit(1).Find(&cached).Error
+	if err != nil {
+		log.Printf("[EmailCache] Failed to look up Message-ID of %s for account %d: %v", messageID, emailAccountID, err)
+	}
+	return cached.InternetMessageID
+}
+
+// updateCachedEmailsAfterAction 邮件被删除或移动后同步缓存：永久删除和无法确定新ID的 IMAP 邮件移除缓存，
+// 其余移动的邮件更新文件夹和新ID。target 为移动的目标文件夹，不移动时为空
+func updateCachedEmailsAfterAction(emailAccountID uint, action, target string, results []models.MessageActionResult) {
+	if action != models.MessageActionDelete && target == "" {
+		return
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		var cached models.CachedEmail
+		err := database.DB.Where("email_account_id = ? AND message_id = ?", emailAccountID, result.MessageID).Limit(1).Find(&cached).Error
+		if err != nil || cached.ID == 0 {
+			continue
+		}
+		_, isIMAP := imapid.Parse(result.MessageID)
+		switch {
+		case action == models.MessageActionDelete, isIMAP && result.NewMessageID == "":
+			err = database.DB.Delete(&cached).Error
+		default:
+			if result.NewMessageID != "" {
+				cached.MessageID = result.NewMessageID
+			}
+			cached.Folder = strings.ToLower(target)
+			err = database.DB.Save(&cached).Error
+		}
+		if err != nil {
+			log.Printf("[EmailCache] Failed to update cached email %s for account %d: %v", result.MessageID, emailAccountID, err)
+		}
+	}
+}
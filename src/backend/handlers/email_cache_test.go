@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"testing"
+
+	"email_server/database"
+	"email_server/database/dbtest"
+	"email_server/imapid"
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedInternetMessageID_FallbackForStaleIMAPIDs(t *testing.T) {
+	database.DB = dbtest.Open(t)
+	id := imapid.ID{Folder: "INBOX", UIDValidity: 7, UID: 12}.String()
+
+	cacheInboxEmails(1, 3, "inbox", []models.Email{{MessageID: id, InternetMessageID: "abc@mail.example.com", Subject: "Hello"}})
+	assert.Equal(t, "abc@mail.example.com", cachedInternetMessageID(3, id))
+	assert.Empty(t, cachedInternetMessageID(4, id), "其他邮箱账户的缓存不参与查找")
+	assert.Empty(t, cachedInternetMessageID(3, "unknown"))
+
+	// 查看详情后 UIDVALIDITY 变化，新ID写入新的缓存记录并保留 Message-ID
+	renewed := imapid.ID{Folder: "INBOX", UIDValidity: 8, UID: 1}.String()
+	cacheEmailDetail(1, 3, &models.Email{MessageID: renewed, InternetMessageID: "abc@mail.example.com", Body: "body"})
+	assert.Equal(t, "abc@mail.example.com", cachedInternetMessageID(3, renewed))
+}
+
+func TestUpdateCachedEmailsAfterAction(t *testing.T) {
+	database.DB = dbtest.Open(t)
+	movedIMAP := imapid.ID{Folder: "INBOX", UIDValidity: 7, UID: 1}.String()
+	lostIMAP := imapid.ID{Folder: "INBOX", UIDValidity: 7, UID: 2}.String()
+	cacheInboxEmails(1, 3, "inbox", []models.Email{
+		{MessageID: movedIMAP, Subject: "a"},
+		{MessageID: lostIMAP, Subject: "b"},
+		{MessageID: "graph-1", Subject: "c"},
+		{MessageID: "failed", Subject: "d"},
+	})
+
+	newIMAP := imapid.ID{Folder: "Archive", UIDValidity: 9, UID: 40}.String()
+	updateCachedEmailsAfterAction(3, models.MessageActionArchive, "archive", []models.MessageActionResult{
+		{MessageID: movedIMAP, NewMessageID: newIMAP},
+		{MessageID: lostIMAP},
+		{MessageID: "graph-1", NewMessageID: "graph-1-moved"},
+		{MessageID: "failed", Error: "boom"},
+	})
+
+	folderOf := func(messageID string) (string, bool) {
+		var cached models.CachedEmail
+		database.DB.Where("email_account_id = ? AND message_id = ?", 3, messageID).Limit(1).Find(&cached)
+		return cached.Folder, cached.ID != 0
+	}
+	folder, ok := folderOf(newIMAP)
+	assert.True(t, ok)
+	assert.Equal(t, "archive", folder)
+	_, ok = folderOf(lostIMAP)
+	assert.False(t, ok, "无法确定新 UID 的 IMAP 邮件移除缓存")
+	folder, ok = folderOf("graph-1-moved")
+	assert.True(t, ok)
+	assert.Equal(t, "archive", folder)
+	folder, _ = folderOf("failed")
+	assert.Equal(t, "inbox", folder, "失败的邮件保持不变")
+
+	updateCachedEmailsAfterAction(3, models.MessageActionDelete, "", []models.MessageActionResult{{MessageID: "graph-1-moved"}})
+	_, ok = folderOf("graph-1-moved")
+	assert.False(t, ok)
+}
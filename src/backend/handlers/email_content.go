@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/favicon"
+	"email_server/mailhtml"
+	"email_server/models"
+	"email_server/urlmatch"
+	"email_server/utils"
+)
+
+// imageProxyPath 邮件远程图片代理的地址
+const imageProxyPath = "/api/v1/inbox/image-proxy"
+
+// imageProxyFetcher 获取邮件中的远程图片，测试中可替换
+var imageProxyFetcher = favicon.NewFetcher(favicon.DefaultTimeout, false)
+
+// emailLocalPrefixes 邮件正文中允许保留的站内地址（附件签名链接）
+var emailLocalPrefixes = []string{"/api/v1/inbox/emails/"}
+
+// emailStyleScope 前端显示邮件 HTML 正文的容器（EmailDetailView.vue），邮件中的 <style> 只作用于其中
+const emailStyleScope = ".email-html-body"
+
+// imageProxyMaxBytes 单张代理图片的大小上限
+func imageProxyMaxBytes() int64 {
+	mb := config.AppConfig.ImageProxy.MaxSizeMB
+	if mb <= 0 {
+		mb = 5
+	}
+	return int64(mb) << 20
+}
+
+// normalizeRemoteContentSender 规范化允许列表中的发件人：邮箱地址转为小写，"@example.com" 表示整个域名
+func normalizeRemoteContentSender(input string) (string, bool) {
+	sender := strings.ToLower(strings.TrimSpace(input))
+	if domain, ok := strings.CutPrefix(sender, "@"); ok {
+		addr, valid := urlmatch.Parse(domain)
+		if !valid || addr.Host != domain || !strings.Contains(domain, ".") {
+			return "", false
+		}
+		return "@" + domain, true
+	}
+	parsed, err := mail.ParseAddress(sender)
+	if err != nil || parsed.Address != sender {
+		return "", false
+	}
+	return sender, true
+}
+
+// remoteContentSenderKeys 发件人在允许列表中可能的记录：邮箱地址和 "@域名"
+func remoteContentSenderKeys(from []models.EmailAddress) []string {
+	var keys []string
+	for _, addr := range from {
+		address := strings.ToLower(strings.TrimSpace(addr.Address))
+		at := strings.LastIndex(address, "@")
+		if at <= 0 || at == len(address)-1 {
+			continue
+		}
+		keys = append(keys, address, address[at:])
+	}
+	return keys
+}
+
+// remoteContentAllowed 发件人是否在用户的远程图片允许列表中
+func remoteContentAllowed(userID uint, from []models.EmailAddress) (bool, error) {
+	keys := remoteContentSenderKeys(from)
+	if len(keys) == 0 {
+		return false, nil
+	}
+	var count int64
+	err := database.DB.Model(&models.RemoteContentSender{}).
+		Where("user_id = ? AND sender IN ?", userID, keys).Count(&count).Error
+	return count > 0, err
+}
+
+// imageProxyURL 返回通过图片代理访问 remote 的签名地址
+func imageProxyURL(userID uint, tokenVersion uint, expiresAt int64, remote string) string {
+	claims := utils.ImageProxyClaims{UserID: int64(userID), TokenVersion: tokenVersion, URL: remote, ExpiresAt: expiresAt}
+	query := url.Values{}
+	query.Set("url", remote)
+	query.Set("u", fmt.Sprint(userID))
+	query.Set("v", fmt.Sprint(tokenVersion))
+	query.Set("e", fmt.Sprint(expiresAt))
+	query.Set("sig", utils.SignImageProxyURL(claims))
+	return imageProxyPath + "?" + query.Encode()
+}
+
+// sanitizeEmailHTML 在服务器端清理 HTML 正文。allowRemote 为 true 且启用了图片代理时远程图片改写为代理地址，
+// 否则阻止远程图片并在 BlockedResources 中列出
+func sanitizeEmailHTML(userID uint, email *models.Email, allowRemote bool) {
+	if email.HTMLBody == "" {
+		return
+	}
+	opts := mailhtml.Options{LocalPrefixes: emailLocalPrefixes, StyleScope: emailStyleScope}
+	if allowRemote && config.AppConfig.ImageProxy.Enabled {
+		var user models.User
+		if err := database.DB.Select("token_version").First(&user, userID).Error; err != nil {
+			log.Printf("[sanitizeEmailHTML] Failed to load user %d: %v", userID, err)
+		} else {
+			expiresAt := time.Now().Add(utils.ImageProxyURLTTL).Unix()
+			opts.ProxyImage = func(remote string) string {
+				return imageProxyURL(userID, user.TokenVersion, expiresAt, remote)
+			}
+			email.RemoteContentAllowed = true
+		}
+	}
+
+	result := mailhtml.Sanitize(email.HTMLBody, opts)
+	email.HTMLBody = result.HTML
+	email.BlockedResources = nil
+	for _, r := range result.Blocked {
+		email.BlockedResources = append(email.BlockedResources, models.BlockedResource{Type: r.Type, URL: r.URL})
+	}
+}
+
+// GetProxiedImage 通过服务器获取邮件中的远程图片
+// @Summary 邮件远程图片代理
+// @Description 邮件详情中允许显示的远程图片会改写为本接口的签名地址，由服务器代为获取，不向发件人暴露用户的 IP 和浏览器信息。只返回位图格式，不允许访问内网地址
+// @Tags Inbox
+// @Produce image/png
+// @Param url query string true "远程图片地址"
+// @Param u query int true "用户ID"
+// @Param v query int true "签发时的 token_version"
+// @Param e query int true "过期时间（Unix 秒）"
+// @Param sig query string true "签名"
+// @Success 200 {file} binary "图片"
+// @Failure 401 {object} models.ErrorResponse "链接无效或已过期"
+// @Failure 404 {object} models.ErrorResponse "图片代理未启用"
+// @Failure 502 {object} models.ErrorResponse "获取图片失败"
+// @Router /inbox/image-proxy [get]
+func GetProxiedImage(c *gin.Context) {
+	if !config.AppConfig.ImageProxy.Enabled {
+		utils.SendErrorResponse(c, http.StatusNotFound, "图片代理未启用")
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*favicon.DefaultTimeout)
+	defer cancel()
+
+	fetcher := *imageProxyFetcher
+	fetcher.MaxBytes = imageProxyMaxBytes()
+	image, err := fetcher.FetchImage(ctx, c.Query("url"))
+	if err != nil {
+		log.Printf("[GetProxiedImage] Failed to fetch %s: %v", c.Query("url"), err)
+		if errors.Is(err, favicon.ErrForbiddenAddress) {
+			utils.SendErrorResponse(c, http.StatusForbidden, "不允许访问的地址")
+		} else {
+			utils.SendErrorResponse(c, http.StatusBadGateway, "获取图片失败")
+		}
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	c.Data(http.StatusOK, image.ContentType, image.Data)
+}
+
+// GetRemoteContentSenders 获取允许显示远程图片的发件人
+// @Summary 获取远程图片允许列表
+// @Tags Inbox
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse{data=[]models.RemoteContentSender} "获取成功"
+// @Router /inbox/remote-content-senders [get]
+func GetRemoteContentSenders(c *gin.Context) {
+	senders := []models.RemoteContentSender{}
+	if err := database.DB.Where("user_id = ?", c.GetInt64("user_id")).Order("sender").Find(&senders).Error; err != nil {
+		log.Printf("查询远程图片允许列表失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询失败")
+		return
+	}
+	utils.SendSuccessResponse(c, senders)
+}
+
+// CreateRemoteContentSender 允许显示发件人的远程图片
+// @Summary 添加远程图片允许的发件人
+// @Description 之后打开该发件人的邮件时，远程图片通过图片代理显示。"@example.com" 表示该域名下的所有发件人
+// @Tags Inbox
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateRemoteContentSenderRequest true "发件人"
+// @Success 201 {object} models.SuccessResponse{data=models.RemoteContentSender} "添加成功"
+// @Failure 400 {object} models.ErrorResponse "参数错误"
+// @Failure 409 {object} models.ErrorResponse "已在允许列表中"
+// @Router /inbox/remote-content-senders [post]
+func CreateRemoteContentSender(c *gin.Context) {
+	var req models.CreateRemoteContentSenderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	sender, ok := normalizeRemoteContentSender(req.Sender)
+	if !ok {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的邮箱地址或域名")
+		return
+	}
+
+	userID := uint(c.GetInt64("user_id"))
+	var count int64
+	if err := database.DB.Model(&models.RemoteContentSender{}).Where("user_id = ? AND sender = ?", userID, sender).Count(&count).Error; err != nil {
+		log.Printf("查询远程图片允许列表失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "添加失败")
+		return
+	}
+	if count > 0 {
+		utils.SendErrorResponse(c, http.StatusConflict, "该发件人已在允许列表中")
+		return
+	}
+
+	record := models.RemoteContentSender{UserID: userID, Sender: sender}
+	if err := database.DB.Create(&record).Error; err != nil {
+		log.Printf("添加远程图片允许的发件人失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "添加失败")
+		return
+	}
+	utils.SendCreatedResponse(c, record)
+}
+
+// DeleteRemoteContentSender 从远程图片允许列表中移除发件人
+// @Summary 删除远程图片允许的发件人
+// @Tags Inbox
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "记录ID"
+// @Success 200 {object} models.SuccessResponse "删除成功"
+// @Failure 404 {object} models.ErrorResponse "不存在"
+// @Router /inbox/remote-content-senders/{id} [delete]
+func DeleteRemoteContentSender(c *gin.Context) {
+	id, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的ID")
+		return
+	}
+	result := database.DB.Where("id = ? AND user_id = ?", id, c.GetInt64("user_id")).Delete(&models.RemoteContentSender{})
+	if result.Error != nil {
+		log.Printf("删除远程图片允许的发件人失败: %v", result.Error)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "删除失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.SendErrorResponse(c, http.StatusNotFound, "记录不存在")
+		return
+	}
+	utils.SendSuccessResponse(c, "删除成功")
+}
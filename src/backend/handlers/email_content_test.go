@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"email_server/config"
+	"email_server/favicon"
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestRemoteContentSenders_CRUDAndMatching(t *testing.T) {
+	r, _ := setupAdminTestRouter(t)
+	session := registerUser(t, r, "jane", "jane@example.com")
+	userID := uint(session.User.ID)
+
+	for _, bad := range []string{"", "not an address", "@localhost", "@", "Jane <news@shop.example>"} {
+		w := doAuthJSON(r, "POST", "/api/v1/inbox/remote-content-senders", session.Token, map[string]string{"sender": bad})
+		assert.Equal(t, http.StatusBadRequest, w.Code, bad)
+	}
+
+	w := doAuthJSON(r, "POST", "/api/v1/inbox/remote-content-senders", session.Token, map[string]string{"sender": " News@Shop.Example "})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.RemoteContentSender
+	decodeData(t, w, &created)
+	assert.Equal(t, "news@shop.example", created.Sender)
+
+	w = doAuthJSON(r, "POST", "/api/v1/inbox/remote-content-senders", session.Token, map[string]string{"sender": "news@shop.example"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doAuthJSON(r, "POST", "/api/v1/inbox/remote-content-senders", session.Token, map[string]string{"sender": "@Trusted.Example"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	allowed := func(address string) bool {
+		ok, err := remoteContentAllowed(userID, []models.EmailAddress{{Address: address}})
+		require.NoError(t, err)
+		return ok
+	}
+	assert.True(t, allowed("NEWS@shop.example"))
+	assert.False(t, allowed("other@shop.example"))
+	assert.True(t, allowed("anyone@trusted.example"), "@域名 匹配该域名下的所有发件人")
+	assert.False(t, allowed("anyone@sub.trusted.example"))
+
+	// 其他用户看不到、也删不掉
+	other := registerUser(t, r, "kate", "kate@example.com")
+	w = doAuthJSON(r, "GET", "/api/v1/inbox/remote-content-senders", other.Token, nil)
+	var list []models.RemoteContentSender
+	decodeData(t, w, &list)
+	assert.Empty(t, list)
+	w = doAuthJSON(r, "DELETE", "/api/v1/inbox/remote-content-senders/"+fmt.Sprint(created.ID), other.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doAuthJSON(r, "DELETE", "/api/v1/inbox/remote-content-senders/"+fmt.Sprint(created.ID), session.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, allowed("news@shop.example"))
+}
+
+func TestSanitizeEmailHTML_BlocksOrProxiesRemoteImages(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	session := registerUser(t, r, "lena", "lena@example.com")
+	userID := uint(session.User.ID)
+
+	gif := []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/pixel.gif" {
+			w.Write(gif)
+			return
+		}
+		http.NotFound(w, req)
+	}))
+	t.Cleanup(server.Close)
+	previous := imageProxyFetcher
+	fetcher := favicon.NewFetcher(time.Second, true)
+	fetcher.Client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	imageProxyFetcher = fetcher
+	t.Cleanup(func() { imageProxyFetcher = previous })
+
+	body := `<p onclick="x()">Hi<script>alert(1)</script><img src="http://images.example/pixel.gif"></p>`
+
+	email := &models.Email{HTMLBody: body}
+	sanitizeEmailHTML(userID, email, true)
+	assert.False(t, email.RemoteContentAllowed, "图片代理未启用时一律阻止")
+	assert.Equal(t, `<p>Hi<img/></p>`, email.HTMLBody)
+	assert.Equal(t, []models.BlockedResource{
+		{Type: "script"},
+		{Type: "image", URL: "http://images.example/pixel.gif"},
+	}, email.BlockedResources)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, imageProxyURL(userID, 0, time.Now().Add(time.Hour).Unix(), "http://images.example/pixel.gif"), nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "未启用时代理接口不可用")
+
+	config.AppConfig.ImageProxy.Enabled = true
+
+	email = &models.Email{HTMLBody: body}
+	sanitizeEmailHTML(userID, email, true)
+	assert.True(t, email.RemoteContentAllowed)
+	assert.Equal(t, []models.BlockedResource{{Type: "script"}}, email.BlockedResources)
+	src := regexp.MustCompile(`<img src="([^"]+)"/>`).FindStringSubmatch(email.HTMLBody)
+	require.NotNil(t, src, email.HTMLBody)
+	proxied := html.UnescapeString(src[1])
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	w = get(proxied)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "image/gif", w.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, gif, w.Body.Bytes())
+
+	// 篡改地址、过期或 token_version 变化后签名失效
+	u, err := url.Parse(proxied)
+	require.NoError(t, err)
+	query := u.Query()
+	query.Set("url", "http://images.example/other.gif")
+	assert.Equal(t, http.StatusUnauthorized, get(u.Path+"?"+query.Encode()).Code)
+	assert.Equal(t, http.StatusUnauthorized, get(imageProxyURL(userID, 0, time.Now().Add(-time.Minute).Unix(), "http://images.example/pixel.gif")).Code)
+	require.NoError(t, db.Model(&models.User{}).Where("id = ?", userID).Update("token_version", gorm.Expr("token_version + 1")).Error)
+	assert.Equal(t, http.StatusUnauthorized, get(proxied).Code)
+}
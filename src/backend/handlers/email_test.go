@@ -8,29 +8,22 @@ import (
 	"testing"
 
 	"email_server/database"
+	"email_server/database/dbtest"
 	"email_server/integrations"
 	"email_server/models"
 	"email_server/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-// setupTestRouter sets up a test router with a mock database and necessary routes.
-func setupTestRouter() (*gin.Engine, *gorm.DB) {
+// setupTestRouter sets up a test router with a migrated test database (see dbtest) and necessary routes.
+func setupTestRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 
-	// Setup in-memory SQLite for testing
-	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
-	if err != nil {
-		panic("failed to connect database")
-	}
-
-	// Auto-migrate schema
-	db.AutoMigrate(&models.User{}, &models.EmailAccount{})
+	db := dbtest.Open(t)
 	database.DB = db
 
 	// Setup routes
@@ -51,7 +44,7 @@ func AuthRequiredTest() gin.HandlerFunc {
 var fetchEmails = integrations.FetchEmails
 
 func TestGetInbox_Success(t *testing.T) {
-	router, db := setupTestRouter()
+	router, db := setupTestRouter(t)
 
 	// Create a test user and email account
 	testUser := models.User{Model: gorm.Model{ID: 1}, Username: "testuser"}
@@ -102,7 +95,7 @@ func TestGetInbox_Success(t *testing.T) {
 
 
 func TestGetInbox_NoEmailAccount(t *testing.T) {
-	router, db := setupTestRouter()
+	router, db := setupTestRouter(t)
 
 	// Create a test user but no email account
 	testUser := models.User{Model: gorm.Model{ID: 1}, Username: "testuser"}
@@ -116,7 +109,7 @@ func TestGetInbox_NoEmailAccount(t *testing.T) {
 }
 
 func TestGetInbox_FetchError(t *testing.T) {
-	router, db := setupTestRouter()
+	router, db := setupTestRouter(t)
 
 	// Create a test user and email account
 	testUser := models.User{Model: gorm.Model{ID: 1}, Username: "testuser"}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"email_server/integrations"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// emailThreadsDefaultPageSize 会话列表默认每页数量
+const emailThreadsDefaultPageSize = 20
+
+// emailThreadsCursor 会话列表的不透明游标，绑定账户、文件夹和每页数量，Token 为服务商的翻页标记
+type emailThreadsCursor struct {
+	AccountID uint   `json:"a"`
+	Folder    string `json:"f"`
+	PageSize  int    `json:"s"`
+	Token     string `json:"t"`
+}
+
+func encodeEmailThreadsCursor(cursor emailThreadsCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeEmailThreadsCursor(s string) (emailThreadsCursor, bool) {
+	var cursor emailThreadsCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &cursor) != nil {
+		return cursor, false
+	}
+	if cursor.AccountID == 0 || cursor.Token == "" || cursor.PageSize < 1 || cursor.PageSize > inboxMaxPageSize {
+		return cursor, false
+	}
+	return cursor, true
+}
+
+// listMailThreads 按账户类型使用 Gmail threads、Graph conversationId 或 IMAP THREAD 列出会话，测试中可替换
+var listMailThreads = func(emailAccount models.EmailAccount, folder, pageToken string, pageSize int) ([]integrations.MailThread, string, error) {
+	provider, err := accountMailProvider(emailAccount)
+	if err != nil {
+		return nil, "", err
+	}
+	switch provider {
+	case "microsoft":
+		return integrations.ListGraphThreads(emailAccount, folder, pageToken, pageSize)
+	case "google":
+		return integrations.ListGmailThreads(emailAccount, convertFolderToGmailLabel(folder), pageToken, pageSize)
+	}
+	if emailAccount.IMAPServer == "" || emailAccount.IMAPPort == 0 {
+		return nil, "", errIMAPNotConfigured
+	}
+	return integrations.ListIMAPThreads(emailAccount, folder, pageToken, pageSize)
+}
+
+// getMailThread 获取单个会话，测试中可替换
+var getMailThread = func(emailAccount models.EmailAccount, threadID string) (integrations.MailThread, error) {
+	provider, err := accountMailProvider(emailAccount)
+	if err != nil {
+		return integrations.MailThread{}, err
+	}
+	switch provider {
+	case "microsoft":
+		return integrations.GetGraphThread(emailAccount, threadID)
+	case "google":
+		return integrations.GetGmailThread(emailAccount, threadID)
+	}
+	if emailAccount.IMAPServer == "" || emailAccount.IMAPPort == 0 {
+		return integrations.MailThread{}, errIMAPNotConfigured
+	}
+	return integrations.GetIMAPThread(emailAccount, threadID)
+}
+
+// summarizeThread 汇总会话的邮件数量、参与者、最新日期和未读状态，Messages 需按日期升序
+func summarizeThread(thread integrations.MailThread) models.EmailThread {
+	summary := models.EmailThread{
+		ID:           thread.ID,
+		MessageCount: len(thread.Messages),
+		Participants: []models.EmailAddress{},
+	}
+	seen := map[string]bool{}
+	addParticipants := func(addresses []models.EmailAddress) {
+		for _, addr := range addresses {
+			key := strings.ToLower(addr.Address)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			summary.Participants = append(summary.Participants, addr)
+		}
+	}
+	for i, email := range thread.Messages {
+		if i == 0 {
+			summary.Subject = email.Subject
+		}
+		addParticipants(email.From)
+		addParticipants(email.To)
+		addParticipants(email.Cc)
+		if !email.Date.Before(summary.LatestDate) {
+			summary.LatestDate = email.Date
+			summary.Snippet = email.Snippet
+		}
+		if !email.IsRead {
+			summary.UnreadCount++
+		}
+		if email.HasAttachment {
+			summary.HasAttachment = true
+		}
+	}
+	summary.Unread = summary.UnreadCount > 0
+	return summary
+}
+
+// sendMailThreadError 把获取会话的错误转换为响应
+func sendMailThreadError(c *gin.Context, err error, folder string) {
+	switch {
+	case errors.Is(err, errIMAPNotConfigured):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "IMAP settings are not configured for this non-OAuth email account.")
+	case errors.Is(err, integrations.ErrFolderNotFound):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "找不到文件夹: "+folder)
+	case errors.Is(err, integrations.ErrThreadNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "会话不存在")
+	case errors.Is(err, integrations.ErrIMAPUIDValidityChanged):
+		utils.SendErrorResponse(c, http.StatusGone, "邮箱文件夹已重建，请重新获取会话列表")
+	default:
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取会话失败")
+	}
+}
+
+// GetThreads 获取邮箱账户文件夹中的会话列表
+// @Summary 会话列表
+// @Description 按会话分组邮件，按最新邮件倒序。Gmail 使用 threadId，Microsoft 使用 conversationId，
+// @Description IMAP 使用 THREAD=REFERENCES 扩展，服务器不支持时按 References、In-Reply-To 在最新的 500 封邮件中分组。
+// @Description Microsoft 账户按邮件翻页，同一会话可能在之后的页中再次出现，客户端按 id 去重。翻页时把 nextCursor 作为 cursor 参数
+// @Tags Inbox
+// @Produce json
+// @Security BearerAuth
+// @Param account_id query int true "邮箱账户ID"
+// @Param folder query string false "文件夹，默认 inbox"
+// @Param pageSize query int false "每页数量，默认 20，最多 100"
+// @Param cursor query string false "上一页返回的 nextCursor"
+// @Success 200 {object} models.SuccessResponse "返回 threads、nextCursor、hasMore"
+// @Failure 400 {object} models.ErrorResponse "参数错误"
+// @Failure 404 {object} models.ErrorResponse "邮箱账户不存在"
+// @Failure 410 {object} models.ErrorResponse "文件夹已重建，需要从第一页重新获取"
+// @Router /inbox/threads [get]
+func GetThreads(c *gin.Context) {
+	accountID, err := utils.StringToUint(c.Query("account_id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的账户ID")
+		return
+	}
+	folder := c.DefaultQuery("folder", "inbox")
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(emailThreadsDefaultPageSize)))
+	if pageSize < 1 {
+		pageSize = emailThreadsDefaultPageSize
+	} else if pageSize > inboxMaxPageSize {
+		pageSize = inboxMaxPageSize
+	}
+	var pageToken string
+	if rawCursor := c.Query("cursor"); rawCursor != "" {
+		cursor, ok := decodeEmailThreadsCursor(rawCursor)
+		if !ok || cursor.AccountID != accountID {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		folder, pageSize, pageToken = cursor.Folder, cursor.PageSize, cursor.Token
+	}
+	emailAccount, ok := findUserEmailAccount(c, accountID)
+	if !ok {
+		return
+	}
+
+	threads, nextToken, err := listMailThreads(emailAccount, folder, pageToken, pageSize)
+	if err != nil {
+		log.Printf("[GetThreads] Listing threads of account %d failed: %v", emailAccount.ID, err)
+		sendMailThreadError(c, err, folder)
+		return
+	}
+	summaries := make([]models.EmailThread, 0, len(threads))
+	for _, thread := range threads {
+		summaries = append(summaries, summarizeThread(thread))
+	}
+
+	nextCursor := ""
+	if nextToken != "" {
+		nextCursor = encodeEmailThreadsCursor(emailThreadsCursor{
+			AccountID: emailAccount.ID, Folder: folder, PageSize: pageSize, Token: nextToken,
+		})
+	}
+	utils.SendSuccessResponse(c, gin.H{
+		"threads":    summaries,
+		"nextCursor": nextCursor,
+		"hasMore":    nextCursor != "",
+	})
+}
+
+// GetThreadDetail 获取会话中的全部邮件
+// @Summary 会话详情
+// @Description 返回会话摘要和按日期升序的邮件（只含邮件头和摘要，正文通过邮件详情接口获取）
+// @Tags Inbox
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "会话ID"
+// @Param account_id query int true "邮箱账户ID"
+// @Success 200 {object} models.SuccessResponse{data=models.EmailThread}
+// @Failure 400 {object} models.ErrorResponse "参数错误"
+// @Failure 404 {object} models.ErrorResponse "邮箱账户或会话不存在"
+// @Router /inbox/threads/{id} [get]
+func GetThreadDetail(c *gin.Context) {
+	userID := uint(c.GetInt64("user_id"))
+	accountID, err := utils.StringToUint(c.Query("account_id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的账户ID")
+		return
+	}
+	threadID := c.Param("id")
+	emailAccount, ok := findUserEmailAccount(c, accountID)
+	if !ok {
+		return
+	}
+
+	thread, err := getMailThread(emailAccount, threadID)
+	if err != nil {
+		log.Printf("[GetThreadDetail] Fetching thread %s of account %d failed: %v", threadID, emailAccount.ID, err)
+		sendMailThreadError(c, err, "")
+		return
+	}
+	if err := annotateEmailPlatforms(userID, thread.Messages); err != nil {
+		log.Printf("[GetThreadDetail] Failed to match sender platforms: %v", err)
+	}
+	detail := summarizeThread(thread)
+	detail.Messages = thread.Messages
+	utils.SendSuccessResponse(c, detail)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"email_server/integrations"
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeThread(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 9, 0, 0, 0, time.UTC) }
+	alice := models.EmailAddress{Name: "Alice", Address: "alice@example.com"}
+	bob := models.EmailAddress{Name: "Bob", Address: "bob@example.com"}
+	support := models.EmailAddress{Name: "Support", Address: "support@shop.example"}
+
+	summary := summarizeThread(integrations.MailThread{ID: "t1", Messages: []models.Email{
+		{Subject: "Order #42", From: []models.EmailAddress{alice}, To: []models.EmailAddress{support}, Date: day(1), IsRead: true, Snippet: "first"},
+		{Subject: "Re: Order #42", From: []models.EmailAddress{support}, To: []models.EmailAddress{{Address: "ALICE@example.com"}}, Cc: []models.EmailAddress{bob}, Date: day(2), Snippet: "second", HasAttachment: true},
+		{Subject: "Re: Order #42", From: []models.EmailAddress{bob}, Date: day(3), Snippet: "latest"},
+	}})
+
+	assert.Equal(t, "t1", summary.ID)
+	assert.Equal(t, "Order #42", summary.Subject)
+	assert.Equal(t, 3, summary.MessageCount)
+	assert.Equal(t, []models.EmailAddress{alice, support, bob}, summary.Participants, "参与者按地址不区分大小写去重")
+	assert.Equal(t, day(3), summary.LatestDate)
+	assert.Equal(t, "latest", summary.Snippet)
+	assert.True(t, summary.Unread)
+	assert.Equal(t, 2, summary.UnreadCount)
+	assert.True(t, summary.HasAttachment)
+	assert.Empty(t, summary.Messages)
+}
+
+func TestThreads_ListPagesAndDetail(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	owner := registerUser(t, r, "tess", "tess@example.com")
+	other := registerUser(t, r, "uma", "uma@example.com")
+	account := models.EmailAccount{UserID: uint(owner.User.ID), EmailAddress: "tess@example.com", IMAPServer: "imap.example.com", IMAPPort: 993}
+	require.NoError(t, db.Create(&account).Error)
+
+	type call struct {
+		folder   string
+		token    string
+		pageSize int
+	}
+	var calls []call
+	originalList, originalGet := listMailThreads, getMailThread
+	listMailThreads = func(emailAccount models.EmailAccount, folder, pageToken string, pageSize int) ([]integrations.MailThread, string, error) {
+		calls = append(calls, call{folder, pageToken, pageSize})
+		if pageToken == "" {
+			return []integrations.MailThread{{ID: "t1", Messages: []models.Email{{MessageID: "m1", Subject: "Hello"}, {MessageID: "m2", Subject: "Re: Hello", IsRead: true}}}}, "3:1", nil
+		}
+		return []integrations.MailThread{{ID: "t2", Messages: []models.Email{{MessageID: "m3", IsRead: true}}}}, "", nil
+	}
+	getMailThread = func(emailAccount models.EmailAccount, threadID string) (integrations.MailThread, error) {
+		if threadID != "t1" {
+			return integrations.MailThread{}, integrations.ErrThreadNotFound
+		}
+		return integrations.MailThread{ID: "t1", Messages: []models.Email{{MessageID: "m1"}, {MessageID: "m2", IsRead: true}}}, nil
+	}
+	t.Cleanup(func() { listMailThreads, getMailThread = originalList, originalGet })
+
+	type listResponse struct {
+		Threads    []models.EmailThread `json:"threads"`
+		NextCursor string               `json:"nextCursor"`
+		HasMore    bool                 `json:"hasMore"`
+	}
+	list := func(token string, params url.Values) (int, listResponse) {
+		w := doAuthJSON(r, "GET", "/api/v1/inbox/threads?"+params.Encode(), token, nil)
+		var resp listResponse
+		if w.Code == http.StatusOK {
+			decodeData(t, w, &resp)
+		}
+		return w.Code, resp
+	}
+	accountID := fmt.Sprint(account.ID)
+
+	code, _ := list(other.Token, url.Values{"account_id": {accountID}})
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = list(owner.Token, url.Values{"account_id": {"abc"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Empty(t, calls)
+
+	code, first := list(owner.Token, url.Values{"account_id": {accountID}, "folder": {"sent"}, "pageSize": {"10"}})
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, first.Threads, 1)
+	assert.Equal(t, "t1", first.Threads[0].ID)
+	assert.Equal(t, 2, first.Threads[0].MessageCount)
+	assert.True(t, first.Threads[0].Unread)
+	assert.Empty(t, first.Threads[0].Messages, "列表不返回邮件")
+	assert.True(t, first.HasMore)
+
+	code, second := list(owner.Token, url.Values{"account_id": {accountID}, "folder": {"inbox"}, "cursor": {first.NextCursor}})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "t2", second.Threads[0].ID)
+	assert.False(t, second.HasMore)
+	require.Len(t, calls, 2)
+	assert.Equal(t, call{"sent", "3:1", 10}, calls[1], "翻页时沿用游标中的文件夹和每页数量")
+
+	code, _ = list(owner.Token, url.Values{"account_id": {accountID}, "cursor": {"garbage"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	w := doAuthJSON(r, "GET", "/api/v1/inbox/threads/t1?account_id="+accountID, owner.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var detail models.EmailThread
+	decodeData(t, w, &detail)
+	assert.Equal(t, 2, detail.MessageCount)
+	assert.Equal(t, 1, detail.UnreadCount)
+	require.Len(t, detail.Messages, 2)
+	assert.Equal(t, "m1", detail.Messages[0].MessageID)
+
+	w = doAuthJSON(r, "GET", "/api/v1/inbox/threads/missing?account_id="+accountID, owner.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doAuthJSON(r, "GET", "/api/v1/inbox/threads/t1?account_id="+accountID, other.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
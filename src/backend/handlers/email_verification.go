@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/mailer"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// emailVerificationRequired 自助注册的用户是否需要验证邮箱后才能使用
+func emailVerificationRequired() bool {
+	return config.AppConfig.Admin.RequireEmailVerification
+}
+
+// sendVerificationEmail 向用户当前邮箱发送验证链接
+func sendVerificationEmail(user *models.User) error {
+	token, err := utils.GenerateEmailVerificationToken(int64(user.ID), user.Email)
+	if err != nil {
+		return err
+	}
+	link := frontendBaseURL() + "/auth/verify-email?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("%s，您好：\n\n请在 %d 小时内打开以下链接验证您的邮箱：\n\n%s\n\n如果这不是您本人的操作，请忽略此邮件。\n",
+		user.Username, int(utils.EmailVerificationTTL.Hours()), link)
+	return mailer.Default.Send(user.Email, "验证您的邮箱", body)
+}
+
+// trySendVerificationEmail 注册或修改邮箱后发送验证邮件，失败时只记录日志，用户可以稍后重新发送
+func trySendVerificationEmail(user *models.User) {
+	if !mailer.Configured() {
+		log.Printf("未配置 SMTP，无法向用户 %d 发送验证邮件", user.ID)
+		return
+	}
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("向用户 %d 发送验证邮件失败: %v", user.ID, err)
+	}
+}
+
+// VerifyEmail 通过邮件中的链接验证邮箱
+// @Summary 验证邮箱
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body models.VerifyEmailRequest true "验证 token"
+// @Success 200 {object} models.SuccessResponse "验证成功"
+// @Failure 400 {object} models.ErrorResponse "链接无效或已过期"
+// @Router /auth/verify-email [post]
+func VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误")
+		return
+	}
+	userID, email, err := utils.ParseEmailVerificationToken(req.Token)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "验证链接无效或已过期")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "验证链接无效或已过期")
+		} else {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "系统错误")
+		}
+		return
+	}
+	// 用户在发送链接后修改了邮箱，旧链接不再有效
+	if user.Email != email {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "验证链接无效或已过期")
+		return
+	}
+	if user.EmailVerifiedAt == nil {
+		if err := database.DB.Model(&user).Update("email_verified_at", time.Now()).Error; err != nil {
+			log.Printf("更新邮箱验证状态失败: %v", err)
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "系统错误")
+			return
+		}
+		log.Printf("用户 %d 验证了邮箱", user.ID)
+	}
+	utils.SendSuccessResponse(c, "邮箱验证成功")
+}
+
+// ResendVerificationEmail 重新发送验证邮件
+// @Summary 重新发送验证邮件
+// @Tags Users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse "已发送"
+// @Failure 400 {object} models.ErrorResponse "邮箱已验证"
+// @Failure 503 {object} models.ErrorResponse "未配置邮件服务"
+// @Router /users/me/verify-email/resend [post]
+func ResendVerificationEmail(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.GetInt64("user_id")).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "邮箱已验证")
+		return
+	}
+	if !mailer.Configured() {
+		utils.SendErrorResponse(c, http.StatusServiceUnavailable, "未配置邮件服务，请联系管理员")
+		return
+	}
+	if err := sendVerificationEmail(&user); err != nil {
+		log.Printf("向用户 %d 发送验证邮件失败: %v", user.ID, err)
+		utils.SendErrorResponse(c, http.StatusBadGateway, "发送验证邮件失败，请稍后重试")
+		return
+	}
+	utils.SendSuccessResponse(c, "验证邮件已发送")
+}
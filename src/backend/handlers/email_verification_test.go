@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+
+	"email_server/config"
+	"email_server/mailer"
+	"email_server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sentMail struct {
+	to, subject, body string
+}
+
+// recordingSender 记录发送的邮件而不连接 SMTP 服务器
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []sentMail
+}
+
+func (s *recordingSender) Send(to, subject, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, sentMail{to: to, subject: subject, body: body})
+	return nil
+}
+
+// lastVerificationToken 取出最近一封验证邮件中的 token
+func (s *recordingSender) lastVerificationToken(t *testing.T) string {
+	return s.lastLinkToken(t, "/auth/verify-email")
+}
+
+// lastLinkToken 取出最近一封邮件中指向前端 path 的链接里的 token
+func (s *recordingSender) lastLinkToken(t *testing.T, path string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	require.NotEmpty(t, s.sent)
+	link := regexp.MustCompile(`http://frontend\.test`+regexp.QuoteMeta(path)+`\?token=\S+`).FindString(s.sent[len(s.sent)-1].body)
+	require.NotEmpty(t, link)
+	parsed, err := url.Parse(link)
+	require.NoError(t, err)
+	return parsed.Query().Get("token")
+}
+
+// enableEmailVerification 开启邮箱验证，并把发件器替换为 recordingSender
+func enableEmailVerification(t *testing.T) *recordingSender {
+	config.AppConfig.Admin.RequireEmailVerification = true
+	config.AppConfig.SMTP = config.SMTPConfig{Host: "smtp.test", Port: 587, From: "noreply@example.com"}
+	sender := &recordingSender{}
+	previous := mailer.Default
+	mailer.Default = sender
+	t.Cleanup(func() { mailer.Default = previous })
+	return sender
+}
+
+func registerUser(t *testing.T, r *gin.Engine, username, email string) models.LoginResponse {
+	w := doJSON(r, "POST", "/api/v1/auth/register", map[string]string{
+		"username": username, "email": email, "password": "secret-password",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp models.LoginResponse
+	decodeData(t, w, &resp)
+	return resp
+}
+
+func TestRegister_EmailVerificationRequired(t *testing.T) {
+	r, _ := setupAdminTestRouter(t)
+	sender := enableEmailVerification(t)
+
+	session := registerUser(t, r, "dave", "dave@example.com")
+	assert.Nil(t, session.User.EmailVerifiedAt)
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, "dave@example.com", sender.sent[0].to)
+
+	// 验证前只能访问个人资料等接口
+	w := doAuthJSON(r, "GET", "/api/v1/platforms", session.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "请先验证邮箱")
+	w = doAuthJSON(r, "GET", "/api/v1/users/me", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 修改邮箱后旧链接失效，新邮箱收到新的链接
+	oldToken := sender.lastVerificationToken(t)
+	w = doAuthJSON(r, "PUT", "/api/v1/users/me", session.Token, map[string]string{"email": "dave@example.org"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, sender.sent, 2)
+	assert.Equal(t, "dave@example.org", sender.sent[1].to)
+	w = doJSON(r, "POST", "/api/v1/auth/verify-email", map[string]string{"token": oldToken})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doAuthJSON(r, "POST", "/api/v1/users/me/verify-email/resend", session.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, sender.sent, 3)
+
+	w = doJSON(r, "POST", "/api/v1/auth/verify-email", map[string]string{"token": sender.lastVerificationToken(t)})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doAuthJSON(r, "GET", "/api/v1/platforms", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doAuthJSON(r, "POST", "/api/v1/users/me/verify-email/resend", session.Token, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 验证 token 不能当作登录 token 使用
+	w = doAuthJSON(r, "GET", "/api/v1/users/me", oldToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRegister_VerificationNotRequired(t *testing.T) {
+	r, _ := setupAdminTestRouter(t)
+
+	session := registerUser(t, r, "erin", "erin@example.com")
+	assert.Nil(t, session.User.EmailVerifiedAt)
+	w := doAuthJSON(r, "GET", "/api/v1/platforms", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestRegister_InvitedEmailIsVerified(t *testing.T) {
+	r, _ := setupAdminTestRouter(t)
+	sender := enableEmailVerification(t)
+
+	w := doAdminJSON(r, "POST", "/api/v1/admin/invitations", map[string]string{"email": "frank@example.com"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var invitation models.InvitationResponse
+	decodeData(t, w, &invitation)
+
+	w = doJSON(r, "POST", "/api/v1/auth/register", map[string]string{
+		"username": "frank", "email": "frank@example.com", "password": "secret-password", "invite_code": invitation.Code,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var session models.LoginResponse
+	decodeData(t, w, &session)
+	assert.NotNil(t, session.User.EmailVerifiedAt)
+	require.Len(t, sender.sent, 1, "只发送了邀请邮件，没有验证邮件")
+	assert.Equal(t, "注册邀请", sender.sent[0].subject)
+	w = doAuthJSON(r, "GET", "/api/v1/platforms", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRegister_Disabled(t *testing.T) {
+	r, _ := setupAdminTestRouter(t)
+
+	w := doAdminJSON(r, "POST", "/api/v1/admin/invitations", map[string]string{})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var invitation models.InvitationResponse
+	decodeData(t, w, &invitation)
+
+	w = doAdminJSON(r, "PUT", "/api/v1/admin/settings/registration", map[string]string{"registration_mode": "disabled"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// 关闭注册后邀请码也不能注册
+	w = doJSON(r, "POST", "/api/v1/auth/register", map[string]string{
+		"username": "gina", "email": "gina@example.com", "password": "secret-password", "invite_code": invitation.Code,
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doAdminJSON(r, "PUT", "/api/v1/admin/settings/registration", map[string]string{"registration_mode": "closed"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
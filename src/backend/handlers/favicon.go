@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/favicon"
+	"email_server/models"
+	"email_server/urlmatch"
+	"email_server/utils"
+)
+
+// faviconFetcher 获取第三方网站图标，测试中可替换
+var faviconFetcher = favicon.NewFetcher(favicon.DefaultTimeout, false)
+
+// faviconMissingTTL 获取失败的结果缓存时长，过后重新尝试
+const faviconMissingTTL = 24 * time.Hour
+
+// faviconCall 同一主机名的并发请求只获取一次
+type faviconCall struct {
+	done chan struct{}
+	icon models.Favicon
+	err  error
+}
+
+var (
+	faviconMu       sync.Mutex
+	faviconInflight = map[string]*faviconCall{}
+)
+
+// faviconHost 校验并规范化路径中的主机名，只接受域名（不含端口、不能是 IP）
+func faviconHost(raw string) (string, bool) {
+	host := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(raw)), ".")
+	if host == "" || len(host) > 253 || net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return "", false
+	}
+	addr, ok := urlmatch.Parse(host)
+	if !ok || addr.Host != host {
+		return "", false
+	}
+	return host, true
+}
+
+// faviconFresh 缓存是否仍在有效期内
+func faviconFresh(icon *models.Favicon, now time.Time) bool {
+	ttl := faviconMissingTTL
+	if !icon.Missing {
+		days := config.AppConfig.Favicon.CacheDays
+		if days <= 0 {
+			days = 7
+		}
+		ttl = time.Duration(days) * 24 * time.Hour
+	}
+	return now.Sub(icon.FetchedAt) < ttl
+}
+
+// catalogIconURL 主机名所属平台目录条目配置的图标地址
+func catalogIconURL(host string) string {
+	entry, _, err := resolveCatalogPlatform(database.DB, "", host)
+	if err != nil || entry == nil {
+		return ""
+	}
+	return entry.IconURL
+}
+
+// loadFavicon 返回主机名的图标缓存，缓存不存在或过期时重新获取并保存
+func loadFavicon(ctx context.Context, host string) (models.Favicon, error) {
+	var cached models.Favicon
+	err := database.DB.Where("domain = ?", host).First(&cached).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return cached, err
+	}
+	found := err == nil
+	if found && (faviconFresh(&cached, time.Now()) || !config.AppConfig.Favicon.Enabled) {
+		return cached, nil
+	}
+	if !config.AppConfig.Favicon.Enabled {
+		return models.Favicon{Domain: host, Missing: true}, nil
+	}
+
+	faviconMu.Lock()
+	if call, ok := faviconInflight[host]; ok {
+		faviconMu.Unlock()
+		select {
+		case <-call.done:
+			return call.icon, call.err
+		case <-ctx.Done():
+			return cached, ctx.Err()
+		}
+	}
+	call := &faviconCall{done: make(chan struct{})}
+	faviconInflight[host] = call
+	faviconMu.Unlock()
+
+	call.icon, call.err = fetchFavicon(host)
+
+	faviconMu.Lock()
+	delete(faviconInflight, host)
+	faviconMu.Unlock()
+	close(call.done)
+	return call.icon, call.err
+}
+
+// fetchFavicon 从网站获取图标并写入缓存；获取失败时缓存为 Missing，避免反复访问第三方网站
+func fetchFavicon(host string) (models.Favicon, error) {
+	// 不使用请求的 context：客户端断开后仍完成获取，结果供后续请求使用
+	ctx, cancel := context.WithTimeout(context.Background(), 2*favicon.DefaultTimeout)
+	defer cancel()
+
+	record := models.Favicon{Domain: host, FetchedAt: time.Now()}
+	icon, err := faviconFetcher.Fetch(ctx, host, catalogIconURL(host))
+	if err != nil {
+		log.Printf("获取网站图标失败 (%s): %v", host, err)
+		record.Missing = true
+	} else {
+		record.ContentType = icon.ContentType
+		record.Data = icon.Data
+	}
+
+	err = database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "domain"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content_type", "data", "missing", "fetched_at"}),
+	}).Create(&record).Error
+	return record, err
+}
+
+// GetFavicon 获取网站图标
+// @Summary 获取网站图标
+// @Description 由服务器获取并缓存网站图标，客户端无需直接访问第三方网站。依次尝试平台目录配置的图标、首页声明的图标和 /favicon.ico；只返回位图格式
+// @Tags PlatformCatalog
+// @Produce image/png
+// @Security BearerAuth
+// @Param domain path string true "主机名，例如 github.com"
+// @Success 200 {file} binary "图标"
+// @Failure 400 {object} models.ErrorResponse "无效的域名"
+// @Failure 404 {object} models.ErrorResponse "未找到网站图标"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /favicons/{domain} [get]
+func GetFavicon(c *gin.Context) {
+	host, ok := faviconHost(c.Param("domain"))
+	if !ok {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的域名")
+		return
+	}
+	icon, err := loadFavicon(c.Request.Context(), host)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取网站图标失败")
+		return
+	}
+	if icon.Missing || len(icon.Data) == 0 {
+		utils.SendErrorResponse(c, http.StatusNotFound, "未找到网站图标")
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, icon.ContentType, icon.Data)
+}
@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// 内置（环境变量配置）的登录提供商
+const (
+	identityProviderLinuxDo   = "linuxdo"
+	identityProviderGoogle    = "google"
+	identityProviderMicrosoft = "microsoft"
+)
+
+// pendingIdentityLinkTTL 邮箱冲突时暂存身份的有效期
+const pendingIdentityLinkTTL = 15 * time.Minute
+
+// identityLinkCookie 保存待绑定身份的 token。token 只放在发起登录的浏览器的 HttpOnly cookie 中，
+// 不出现在 URL 里，其他人拿到确认链接也无法把自己的身份绑定到别人的账户
+const (
+	identityLinkCookie     = "identity_link"
+	identityLinkCookiePath = "/api/v1/users/me/identities/confirm"
+)
+
+// setIdentityLinkCookie 设置（maxAge < 0 时清除）待绑定身份的 cookie
+func setIdentityLinkCookie(c *gin.Context, token string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     identityLinkCookie,
+		Value:    token,
+		Path:     identityLinkCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(config.AppConfig.Backend.BaseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+var (
+	errIdentityLinkRequired    = errors.New("an account with this email already exists")
+	errIdentityLinkedElsewhere = errors.New("identity is already linked to another user")
+	errEmailNotProvided        = errors.New("provider did not return an email address")
+	errRegistrationClosed      = errors.New("registration is invite only")
+)
+
+// identityProviderDisplayName 返回提供商的展示名称
+func identityProviderDisplayName(name string) string {
+	var provider models.OAuthProvider
+	if err := database.DB.Select("display_name").Where("name = ?", name).First(&provider).Error; err == nil && provider.DisplayName != "" {
+		return provider.DisplayName
+	}
+	switch name {
+	case identityProviderLinuxDo:
+		return "LinuxDo"
+	case identityProviderGoogle:
+		return "Google"
+	case identityProviderMicrosoft:
+		return "Microsoft"
+	}
+	return name
+}
+
+// resolveIdentityLogin 根据外部身份确定登录用户：
+//  1. 身份已绑定用户时直接返回该用户；
+//  2. 邮箱与已有账户冲突时不自动合并，暂存身份并返回 link token，用户登录原账户后确认绑定；
+//  3. 否则创建新用户并绑定该身份。
+func resolveIdentityLogin(providerName string, identity *oauthIdentity) (*models.User, string, error) {
+	var linked models.UserIdentity
+	err := database.DB.Where("provider = ? AND subject = ?", providerName, identity.Subject).First(&linked).Error
+	switch {
+	case err == nil:
+		var user models.User
+		err = database.DB.First(&user, linked.UserID).Error
+		if err == nil {
+			updates := map[string]interface{}{"last_login_at": time.Now()}
+			if identity.Email != "" {
+				updates["email"] = identity.Email
+			}
+			if err := database.DB.Model(&linked).Updates(updates).Error; err != nil {
+				log.Printf("更新登录身份失败: %v", err)
+			}
+			return &user, "", nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", err
+		}
+		// 用户已被删除，清理遗留的身份后按新身份处理
+		if err := database.DB.Delete(&linked).Error; err != nil {
+			return nil, "", err
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, "", err
+	}
+
+	if identity.Email == "" {
+		return nil, "", errEmailNotProvided
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.User{}).Where("email = ?", identity.Email).Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if count > 0 {
+		token, err := createPendingIdentityLink(providerName, identity)
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, token, errIdentityLinkRequired
+	}
+
+	// 邀请注册模式下不允许通过第三方登录自助注册
+	if registrationMode() != models.RegistrationModeOpen {
+		return nil, "", errRegistrationClosed
+	}
+
+	user, err := createIdentityUser(providerName, identity)
+	return user, "", err
+}
+
+// createIdentityUser 使用外部身份注册新用户
+func createIdentityUser(providerName string, identity *oauthIdentity) (*models.User, error) {
+	username := identity.Username
+	if username == "" {
+		username = identity.Name
+	}
+	if username == "" {
+		username = identity.Email
+		if atIndex := strings.Index(identity.Email, "@"); atIndex > 0 {
+			username = identity.Email[:atIndex]
+		}
+	}
+	username, err := uniqueUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := providerName
+	now := time.Now()
+	user := models.User{
+		Username: username,
+		Email:    identity.Email,
+		Provider: &provider,
+		Role:     models.RoleUser,
+		Status:   models.StatusActive,
+	}
+	if identity.EmailVerified {
+		// 邮箱已由登录提供商验证，无需再验证
+		user.EmailVerifiedAt = &now
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    providerName,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// createPendingIdentityLink 暂存与已有账户邮箱冲突的身份，返回确认绑定用的 token
+func createPendingIdentityLink(providerName string, identity *oauthIdentity) (string, error) {
+	token, err := generateRandomState()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if err := database.DB.Where("expires_at < ?", now).Delete(&models.PendingIdentityLink{}).Error; err != nil {
+		log.Printf("清理过期的待绑定身份失败: %v", err)
+	}
+	pending := models.PendingIdentityLink{
+		Token:     token,
+		Provider:  providerName,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		ExpiresAt: now.Add(pendingIdentityLinkTTL),
+	}
+	if err := database.DB.Create(&pending).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// linkIdentity 将外部身份绑定到用户，已绑定到该用户时直接返回
+func linkIdentity(userID uint, providerName, subject, email string) (*models.UserIdentity, error) {
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var existing models.UserIdentity
+	err := database.DB.Where("provider = ? AND subject = ?", providerName, subject).First(&existing).Error
+	if err == nil {
+		if existing.UserID == userID {
+			return &existing, nil
+		}
+		return nil, errIdentityLinkedElsewhere
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	identity := models.UserIdentity{
+		UserID:   userID,
+		Provider: providerName,
+		Subject:  subject,
+		Email:    email,
+	}
+	if err := database.DB.Create(&identity).Error; err != nil {
+		if utils.IsUniqueConstraintError(err) {
+			return nil, errIdentityLinkedElsewhere
+		}
+		return nil, err
+	}
+	log.Printf("用户 %d 绑定了 %s 登录身份", userID, providerName)
+	return &identity, nil
+}
+
+// completeOAuthIdentity 登录或绑定流程获取到外部身份后的统一出口：
+// state 中带有 UserID 时为已登录用户绑定身份，否则按身份登录
+func completeOAuthIdentity(c *gin.Context, stateInfo *models.OAuth2State, providerName string, identity *oauthIdentity) {
+	if identity.Subject == "" {
+		log.Printf("%s 未返回用户ID", providerName)
+		redirectIdentityError(c, stateInfo, "user_info_failed")
+		return
+	}
+
+	if stateInfo.UserID != 0 {
+		_, err := linkIdentity(stateInfo.UserID, providerName, identity.Subject, identity.Email)
+		switch {
+		case errors.Is(err, errIdentityLinkedElsewhere):
+			redirectIdentityError(c, stateInfo, "identity_linked_elsewhere")
+		case err != nil:
+			log.Printf("绑定登录身份失败 (%s): %v", providerName, err)
+			redirectIdentityError(c, stateInfo, "internal_error")
+		default:
+			c.Redirect(http.StatusFound, frontendBaseURL()+"/profile?identity_linked="+url.QueryEscape(providerName))
+		}
+		return
+	}
+
+	user, linkToken, err := resolveIdentityLogin(providerName, identity)
+	switch {
+	case errors.Is(err, errIdentityLinkRequired):
+		log.Printf("%s 登录的邮箱已被其他账户使用，需要登录原账户后确认绑定", providerName)
+		setIdentityLinkCookie(c, linkToken, int(pendingIdentityLinkTTL.Seconds()))
+		c.Redirect(http.StatusFound, fmt.Sprintf("%s/auth/login?error=identity_link_required&provider=%s",
+			frontendBaseURL(), url.QueryEscape(providerName)))
+		return
+	case errors.Is(err, errEmailNotProvided):
+		redirectLoginError(c, "email_not_provided")
+		return
+	case errors.Is(err, errRegistrationClosed):
+		redirectLoginError(c, "registration_closed")
+		return
+	case err != nil:
+		log.Printf("创建用户失败 (%s): %v", providerName, err)
+		redirectLoginError(c, "user_creation_failed")
+		return
+	}
+
+	finishOAuth2Login(c, user, identityProviderDisplayName(providerName))
+}
+
+// redirectIdentityError 绑定流程出错时回到个人资料页，登录流程出错时回到登录页
+func redirectIdentityError(c *gin.Context, stateInfo *models.OAuth2State, code string) {
+	if stateInfo != nil && stateInfo.UserID != 0 {
+		c.Redirect(http.StatusFound, frontendBaseURL()+"/profile?error="+code)
+		return
+	}
+	redirectLoginError(c, code)
+}
+
+// GetUserIdentities 获取当前用户已绑定的登录身份
+// @Summary 获取已绑定的登录方式
+// @Tags Users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse{data=models.UserIdentitiesResponse} "获取成功"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /users/me/identities [get]
+func GetUserIdentities(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+	var identities []models.UserIdentity
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&identities).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取登录方式失败")
+		return
+	}
+
+	result := models.UserIdentitiesResponse{
+		HasPassword: user.Password != "",
+		Identities:  make([]models.UserIdentityResponse, 0, len(identities)),
+	}
+	for _, identity := range identities {
+		result.Identities = append(result.Identities, toUserIdentityResponse(&identity))
+	}
+	utils.SendSuccessResponse(c, result)
+}
+
+func toUserIdentityResponse(identity *models.UserIdentity) models.UserIdentityResponse {
+	return models.UserIdentityResponse{
+		ID:                  identity.ID,
+		Provider:            identity.Provider,
+		ProviderDisplayName: identityProviderDisplayName(identity.Provider),
+		Email:               identity.Email,
+		LastLoginAt:         identity.LastLoginAt,
+		CreatedAt:           identity.CreatedAt,
+	}
+}
+
+// StartIdentityLink 为当前用户发起绑定登录身份的授权流程
+// @Summary 绑定登录方式
+// @Description 返回提供商的授权URL，授权完成后回调会把该身份绑定到当前用户
+// @Tags Users
+// @Produce json
+// @Security BearerAuth
+// @Param provider path string true "提供商名称，如 linuxdo、google、microsoft 或管理员配置的提供商"
+// @Success 200 {object} models.SuccessResponse{data=map[string]string} "返回授权URL和state"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 404 {object} models.ErrorResponse "提供商不存在或未启用登录"
+// @Router /users/me/identities/link/{provider} [get]
+func StartIdentityLink(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	providerName := c.Param("provider")
+
+	// 管理员配置并启用了登录的提供商优先于环境变量中的内置配置
+	if provider, err := loadOAuthProvider(providerName); err == nil && provider.LoginEnabled {
+		startProviderLogin(c, provider, uint(userID.(int64)))
+		return
+	}
+	switch providerName {
+	case identityProviderLinuxDo:
+		startLinuxDoLogin(c, uint(userID.(int64)))
+	case identityProviderGoogle, identityProviderMicrosoft:
+		startLegacyLogin(c, providerName, uint(userID.(int64)))
+	default:
+		utils.SendErrorResponse(c, http.StatusNotFound, "该提供商不存在或未启用登录")
+	}
+}
+
+// ConfirmIdentityLink 登录原账户后确认绑定因邮箱冲突而暂存的身份
+// @Summary 确认绑定登录方式
+// @Description 使用外部身份登录时若邮箱已被其他账户使用，回调会在浏览器中设置 HttpOnly cookie；
+// @Description 用户在同一浏览器登录原账户后调用本接口完成绑定，待绑定身份的邮箱必须与当前账户的邮箱一致
+// @Tags Users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse{data=models.UserIdentityResponse} "绑定成功"
+// @Failure 400 {object} models.ErrorResponse "没有待绑定的身份或已过期"
+// @Failure 403 {object} models.ErrorResponse "待绑定身份的邮箱与当前账户不一致"
+// @Failure 409 {object} models.ErrorResponse "该身份已绑定其他用户"
+// @Router /users/me/identities/confirm [post]
+func ConfirmIdentityLink(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	token, err := c.Cookie(identityLinkCookie)
+	if err != nil || token == "" {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "绑定请求无效或已过期，请重新登录")
+		return
+	}
+	setIdentityLinkCookie(c, "", -1)
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+
+	// token 只能使用一次
+	var pending models.PendingIdentityLink
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token = ?", token).First(&pending).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&pending).Error
+	})
+	if err != nil || time.Now().After(pending.ExpiresAt) {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "绑定请求无效或已过期，请重新登录")
+		return
+	}
+	if !strings.EqualFold(pending.Email, user.Email) {
+		log.Printf("用户 %d 确认绑定的 %s 身份邮箱与账户邮箱不一致，已拒绝", user.ID, pending.Provider)
+		utils.SendErrorResponse(c, http.StatusForbidden, "待绑定身份的邮箱与当前账户不一致")
+		return
+	}
+
+	identity, err := linkIdentity(user.ID, pending.Provider, pending.Subject, pending.Email)
+	if err != nil {
+		if errors.Is(err, errIdentityLinkedElsewhere) {
+			utils.SendErrorResponse(c, http.StatusConflict, "该登录身份已绑定其他用户")
+			return
+		}
+		log.Printf("确认绑定登录身份失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "绑定登录方式失败")
+		return
+	}
+	utils.SendSuccessResponse(c, toUserIdentityResponse(identity))
+}
+
+// DeleteUserIdentity 解绑登录身份，不允许解绑最后一种登录方式
+// @Summary 解绑登录方式
+// @Tags Users
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "身份ID"
+// @Success 200 {object} models.SuccessResponse "解绑成功"
+// @Failure 400 {object} models.ErrorResponse "不能解绑最后一种登录方式"
+// @Failure 404 {object} models.ErrorResponse "身份不存在"
+// @Router /users/me/identities/{id} [delete]
+func DeleteUserIdentity(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	identityID, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的身份ID")
+		return
+	}
+
+	errLastLoginMethod := errors.New("last login method")
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		if err := tx.Where("id = ? AND user_id = ?", identityID, userID).First(&identity).Error; err != nil {
+			return err
+		}
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.Password == "" {
+			var count int64
+			if err := tx.Model(&models.UserIdentity{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count <= 1 {
+				return errLastLoginMethod
+			}
+		}
+		return tx.Delete(&identity).Error
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.SendErrorResponse(c, http.StatusNotFound, "登录身份不存在")
+	case errors.Is(err, errLastLoginMethod):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "不能解绑唯一的登录方式，请先设置密码或绑定其他登录方式")
+	case err != nil:
+		log.Printf("解绑登录身份失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "解绑登录方式失败")
+	default:
+		utils.SendSuccessResponse(c, gin.H{"message": "解绑成功"})
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"email_server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupIdentityTestRouter 在 OAuth 提供商测试路由上增加身份接口，currentUser 为模拟登录的用户ID
+func setupIdentityTestRouter(t *testing.T) (*gin.Engine, *gorm.DB, *mockOIDCServer, *int64) {
+	r, db := setupOAuthProviderTestRouter(t)
+	mock := newMockOIDCServer(t, "email-server")
+	createKeycloakProvider(t, r, mock.URL)
+
+	currentUser := new(int64)
+	asUser := func(c *gin.Context) {
+		c.Set("user_id", *currentUser)
+		c.Next()
+	}
+	r.GET("/users/me/identities", asUser, GetUserIdentities)
+	r.GET("/users/me/identities/link/:provider", asUser, StartIdentityLink)
+	r.POST("/users/me/identities/confirm", asUser, ConfirmIdentityLink)
+	r.DELETE("/users/me/identities/:id", asUser, DeleteUserIdentity)
+	return r, db, mock, currentUser
+}
+
+// oidcCallback 使用 state 完成提供商回调，返回重定向地址
+func oidcCallback(t *testing.T, r *gin.Engine, mock *mockOIDCServer, provider, state, nonce string) *url.URL {
+	location, _ := oidcCallbackWithCookies(t, r, mock, provider, state, nonce)
+	return location
+}
+
+// oidcCallbackWithCookies 同 oidcCallback，同时返回回调设置的 cookie
+func oidcCallbackWithCookies(t *testing.T, r *gin.Engine, mock *mockOIDCServer, provider, state, nonce string) (*url.URL, []*http.Cookie) {
+	mock.setNonce(nonce)
+	w := doJSON(r, "GET", "/api/v1/oauth2/callback/"+provider+"?code=good-code&state="+state, nil)
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	return location, w.Result().Cookies()
+}
+
+// confirmIdentityLink 携带 cookie 确认绑定暂存的身份
+func confirmIdentityLink(r *gin.Engine, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/users/me/identities/confirm", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// startIdentityLink 当前用户发起绑定并返回 state 和 nonce
+func startIdentityLink(t *testing.T, r *gin.Engine, provider string) (string, string) {
+	w := doJSON(r, "GET", "/users/me/identities/link/"+provider, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var data map[string]string
+	decodeData(t, w, &data)
+	authURL, err := url.Parse(data["auth_url"])
+	require.NoError(t, err)
+	return data["state"], authURL.Query().Get("nonce")
+}
+
+func TestIdentityLogin_EmailCollisionRequiresProof(t *testing.T) {
+	r, db, mock, currentUser := setupIdentityTestRouter(t)
+
+	alice := models.User{Username: "alice", Email: "carol@example.com", Password: "hashed", Role: models.RoleUser, Status: models.StatusActive}
+	require.NoError(t, db.Create(&alice).Error)
+
+	// 邮箱已被现有账户使用：不合并也不创建新用户，返回待确认的 link token
+	state, nonce := startOIDCLogin(t, r)
+	location, cookies := oidcCallbackWithCookies(t, r, mock, "keycloak", state, nonce)
+	assert.Equal(t, "/auth/login", location.Path)
+	assert.Equal(t, "identity_link_required", location.Query().Get("error"))
+	assert.NotContains(t, location.RawQuery, "token", "token 不出现在 URL 中")
+	require.Len(t, cookies, 1)
+	assert.Equal(t, identityLinkCookie, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+
+	var count int64
+	require.NoError(t, db.Model(&models.User{}).Count(&count).Error)
+	assert.EqualValues(t, 1, count)
+	require.NoError(t, db.Model(&models.UserIdentity{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	// 登录原账户后确认绑定
+	*currentUser = int64(alice.ID)
+	w := confirmIdentityLink(r, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "没有 cookie 的浏览器不能确认")
+	w = confirmIdentityLink(r, cookies)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var linked models.UserIdentityResponse
+	decodeData(t, w, &linked)
+	assert.Equal(t, "keycloak", linked.Provider)
+	assert.Equal(t, "Company SSO", linked.ProviderDisplayName)
+
+	// token 只能使用一次
+	w = confirmIdentityLink(r, cookies)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 之后可以直接用该身份登录原账户
+	state, nonce = startOIDCLogin(t, r)
+	location = oidcCallback(t, r, mock, "keycloak", state, nonce)
+	assert.Equal(t, "/oauth2/callback", location.Path)
+	assert.NotEmpty(t, location.Query().Get("token"))
+	require.NoError(t, db.Model(&models.User{}).Count(&count).Error)
+	assert.EqualValues(t, 1, count)
+}
+
+func TestIdentityLinkAndUnlink(t *testing.T) {
+	r, db, mock, currentUser := setupIdentityTestRouter(t)
+
+	// 通过 OIDC 注册的用户没有密码，只有一个登录身份
+	state, nonce := startOIDCLogin(t, r)
+	oidcCallback(t, r, mock, "keycloak", state, nonce)
+	var carol models.User
+	require.NoError(t, db.Where("email = ?", "carol@example.com").First(&carol).Error)
+	*currentUser = int64(carol.ID)
+
+	w := doJSON(r, "GET", "/users/me/identities", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp models.UserIdentitiesResponse
+	decodeData(t, w, &resp)
+	assert.False(t, resp.HasPassword)
+	require.Len(t, resp.Identities, 1)
+	first := resp.Identities[0]
+
+	// 不能解绑唯一的登录方式
+	w = doJSON(r, "DELETE", "/users/me/identities/"+strconv.Itoa(int(first.ID)), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 绑定另一个提供商的身份
+	w = doJSON(r, "POST", "/admin/oauth-providers", map[string]interface{}{
+		"name": "partner", "type": "oidc", "issuer_url": mock.URL, "client_id": "email-server", "client_secret": "s3cret",
+		"login_enabled": true, "mailbox_enabled": false,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	state, nonce = startIdentityLink(t, r, "partner")
+	location := oidcCallback(t, r, mock, "partner", state, nonce)
+	assert.Equal(t, "/profile", location.Path)
+	assert.Equal(t, "partner", location.Query().Get("identity_linked"))
+
+	w = doJSON(r, "GET", "/users/me/identities", nil)
+	decodeData(t, w, &resp)
+	require.Len(t, resp.Identities, 2)
+	second := resp.Identities[1]
+
+	// 有其他登录方式时可以解绑
+	w = doJSON(r, "DELETE", "/users/me/identities/"+strconv.Itoa(int(first.ID)), nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doJSON(r, "DELETE", "/users/me/identities/"+strconv.Itoa(int(first.ID)), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// 已绑定到其他用户的身份不能再绑定
+	dave := models.User{Username: "dave", Email: "dave@example.com", Password: "hashed", Role: models.RoleUser, Status: models.StatusActive}
+	require.NoError(t, db.Create(&dave).Error)
+	*currentUser = int64(dave.ID)
+	state, nonce = startIdentityLink(t, r, "partner")
+	location = oidcCallback(t, r, mock, "partner", state, nonce)
+	assert.Equal(t, "/profile", location.Path)
+	assert.Equal(t, "identity_linked_elsewhere", location.Query().Get("error"))
+
+	// 其他用户的身份不可见也不能解绑
+	w = doJSON(r, "GET", "/users/me/identities", nil)
+	decodeData(t, w, &resp)
+	assert.True(t, resp.HasPassword)
+	assert.Empty(t, resp.Identities)
+	w = doJSON(r, "DELETE", "/users/me/identities/"+strconv.Itoa(int(second.ID)), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doJSON(r, "GET", "/users/me/identities/link/unknown", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "未启用登录")
+}
+
+func TestIdentityFromClaims_EmailVerifiedOnlyWhenExplicit(t *testing.T) {
+	cases := []struct {
+		name     string
+		claims   map[string]interface{}
+		email    string
+		verified bool
+	}{
+		{"未返回验证标记", map[string]interface{}{"sub": "1", "email": "a@example.com"}, "a@example.com", false},
+		{"email_verified", map[string]interface{}{"sub": "1", "email": "a@example.com", "email_verified": true}, "a@example.com", true},
+		{"email_verified 为字符串", map[string]interface{}{"sub": "1", "email": "a@example.com", "email_verified": "true"}, "a@example.com", true},
+		{"email_verified 为 false", map[string]interface{}{"sub": "1", "email": "a@example.com", "email_verified": false}, "a@example.com", false},
+		{"Google v2", map[string]interface{}{"id": "1", "email": "a@example.com", "verified_email": true}, "a@example.com", true},
+		{"Graph mail 不视为已验证", map[string]interface{}{"id": "1", "mail": "a@example.com", "email_verified": true}, "a@example.com", false},
+		{"userPrincipalName 不视为已验证", map[string]interface{}{"id": "1", "userPrincipalName": "a@example.com"}, "a@example.com", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			identity := identityFromClaims(tc.claims)
+			assert.Equal(t, tc.email, identity.Email)
+			assert.Equal(t, tc.verified, identity.EmailVerified)
+		})
+	}
+}
+
+func TestIdentityLink_ConfirmRequiresMatchingEmail(t *testing.T) {
+	r, db, mock, currentUser := setupIdentityTestRouter(t)
+
+	alice := models.User{Username: "alice", Email: "carol@example.com", Password: "hashed", Role: models.RoleUser, Status: models.StatusActive}
+	require.NoError(t, db.Create(&alice).Error)
+	victim := models.User{Username: "victor", Email: "victor@example.com", Password: "hashed", Role: models.RoleUser, Status: models.StatusActive}
+	require.NoError(t, db.Create(&victim).Error)
+
+	// 攻击者用自己的身份登录得到待绑定的 cookie，再让其他账户确认：邮箱不一致，拒绝且 token 作废
+	state, nonce := startOIDCLogin(t, r)
+	_, cookies := oidcCallbackWithCookies(t, r, mock, "keycloak", state, nonce)
+	*currentUser = int64(victim.ID)
+	w := confirmIdentityLink(r, cookies)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var count int64
+	require.NoError(t, db.Model(&models.UserIdentity{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	*currentUser = int64(alice.ID)
+	w = confirmIdentityLink(r, cookies)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 邮箱一致的账户重新走一遍流程即可确认
+	state, nonce = startOIDCLogin(t, r)
+	_, cookies = oidcCallbackWithCookies(t, r, mock, "keycloak", state, nonce)
+	w = confirmIdentityLink(r, cookies)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
@@ -4,10 +4,12 @@ import (
 	"email_server/database" // Import database package
 	"email_server/importer"
 	"email_server/models" // Import models package
+	"email_server/urlmatch"
 	"email_server/utils"
 	"encoding/json" // Import json package
 	"errors"        // Added for errors.Is
 	"fmt"           // Import fmt package
+	"io"
 	"log"
 	"net/http"
 	"net/mail" // Added for email validation
@@ -18,11 +20,25 @@ import (
 	"gorm.io/gorm" // Import gorm package
 )
 
+// loginItemParser 解析上传的导出文件，importPasswords 为 false 时不返回密码
+type loginItemParser func(reader io.Reader, importPasswords bool) ([]models.ImportedLoginItem, error)
+
 // ImportBitwardenCSVHandler 处理 Bitwarden CSV 文件导入请求
 func ImportBitwardenCSVHandler(c *gin.Context) {
+	importLoginItems(c, "Bitwarden CSV", importer.ParseBitwardenCSV, 2) // CSV 数据从第二行开始
+}
+
+// ImportBitwardenJSONHandler 处理 Bitwarden 未加密 JSON 文件导入请求，网址的匹配检测方式会导入为平台网址的匹配规则
+func ImportBitwardenJSONHandler(c *gin.Context) {
+	importLoginItems(c, "Bitwarden JSON", importer.ParseBitwardenJSON, 1) // 按条目序号报告错误
+}
+
+// importLoginItems 读取上传的文件（multipart 字段 file、importPasswords），解析后逐条保存为平台、邮箱账户和平台注册信息。
+// firstRow 为第一个条目在错误信息中的行号
+func importLoginItems(c *gin.Context, source string, parse loginItemParser, firstRow int) {
 	// 检查 Content-Type 是否为 multipart/form-data
 	if c.ContentType() != "multipart/form-data" {
-		log.Printf("ImportBitwardenCSVHandler: Invalid Content-Type: %s", c.ContentType())
+		log.Printf("Import %s: Invalid Content-Type: %s", source, c.ContentType())
 		utils.SendErrorResponse(c, http.StatusBadRequest, "请求必须是 multipart/form-data 类型")
 		return
 	}
@@ -30,7 +46,7 @@ func ImportBitwardenCSVHandler(c *gin.Context) {
 	// 获取上传的文件
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
-		log.Printf("ImportBitwardenCSVHandler: Error getting form file 'file': %v", err)
+		log.Printf("Import %s: Error getting form file 'file': %v", source, err)
 		utils.SendErrorResponse(c, http.StatusBadRequest, "无法获取上传的文件: "+err.Error())
 		return
 	}
@@ -38,7 +54,7 @@ func ImportBitwardenCSVHandler(c *gin.Context) {
 	// 打开上传的文件
 	file, err := fileHeader.Open()
 	if err != nil {
-		log.Printf("ImportBitwardenCSVHandler: Error opening uploaded file: %v", err)
+		log.Printf("Import %s: Error opening uploaded file: %v", source, err)
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "无法打开上传的文件: "+err.Error())
 		return
 	}
@@ -48,19 +64,19 @@ func ImportBitwardenCSVHandler(c *gin.Context) {
 	importPasswordsStr := c.PostForm("importPasswords")
 	importPasswords, _ := strconv.ParseBool(importPasswordsStr) // 忽略错误，默认为 false
 
-	log.Printf("ImportBitwardenCSVHandler: Received file '%s', importPasswords=%t", fileHeader.Filename, importPasswords)
+	log.Printf("Import %s: Received file '%s', importPasswords=%t", source, fileHeader.Filename, importPasswords)
 
 	// 调用解析器
-	items, err := importer.ParseBitwardenCSV(file, importPasswords)
+	items, err := parse(file, importPasswords)
 	if err != nil {
-		log.Printf("ImportBitwardenCSVHandler: Error parsing Bitwarden CSV: %v", err)
+		log.Printf("Import %s: Error parsing file: %v", source, err)
 		// 根据错误类型判断是客户端错误还是服务端错误
 		// 简单的处理：假设大部分解析错误是由于文件格式问题 (客户端错误)
-		utils.SendErrorResponse(c, http.StatusBadRequest, "解析 CSV 文件失败: "+err.Error())
+		utils.SendErrorResponse(c, http.StatusBadRequest, "解析 "+source+" 文件失败: "+err.Error())
 		return
 	}
 
-	log.Printf("ImportBitwardenCSVHandler: Successfully parsed %d items from '%s'. Now attempting to save to database.", len(items), fileHeader.Filename)
+	log.Printf("Import %s: Successfully parsed %d items from '%s'. Now attempting to save to database.", source, len(items), fileHeader.Filename)
 
 	// --- 开始数据库保存逻辑 ---
 	db := database.DB                       // 直接使用包级变量 DB
@@ -94,7 +110,7 @@ func ImportBitwardenCSVHandler(c *gin.Context) {
 	var errorMessages []string
 
 	for i, item := range items {
-		rowIndex := i + 2 // CSV data starts from the second row, and i is 0-indexed.
+		rowIndex := i + firstRow
 
 		// --- Input Validation from CSV item ---
 		platformName := strings.TrimSpace(item.ItemName)
@@ -125,6 +141,10 @@ func ImportBitwardenCSVHandler(c *gin.Context) {
 					Name:       platformName,
 					WebsiteURL: item.URL, // Assign the URL from the imported item
 				}
+				// 按名称或网址关联平台目录；导入时保留原名称，避免与导入文件中的条目对不上
+				if catalog, _, catalogErr := resolveCatalogPlatform(db, platformName, item.URL); catalogErr == nil && catalog != nil {
+					platform.CatalogPlatformID = &catalog.ID
+				}
 				if createErr := db.Create(&platform).Error; createErr != nil {
 					errorCount++
 					errorMessages = append(errorMessages, fmt.Sprintf("第 %d 行: 创建平台 '%s' 失败: %v", rowIndex, platformName, createErr))
@@ -143,6 +163,9 @@ func ImportBitwardenCSVHandler(c *gin.Context) {
 			log.Printf("Import: Row %d found existing platform '%s' (ID: %d) for user %d", rowIndex, platform.Name, platform.ID, userID)
 		}
 		// Platform is now valid, active, and associated with the user.
+		for _, msg := range addImportedPlatformURLs(db, &platform, item.URLs) {
+			errorMessages = append(errorMessages, fmt.Sprintf("第 %d 行 (平台 %s): %s", rowIndex, platform.Name, msg))
+		}
 
 		// 2. Determine EmailAccount and LoginUsername for Registration
 		var emailAccount models.EmailAccount
@@ -268,6 +291,14 @@ func ImportBitwardenCSVHandler(c *gin.Context) {
 			loginUsernamePtr = &loginUsernameForRegistration
 		}
 
+		encryptedTOTPSecret, totpErr := encryptTOTPSecret(item.TOTP)
+		if totpErr != nil {
+			// 密钥无效时仍然导入登录信息，只是不保存 TOTP
+			log.Printf("Import: Row %d warning, could not import TOTP secret for login '%s', platform '%s': %v", rowIndex, loginIdentifier, platform.Name, totpErr)
+			errorMessages = append(errorMessages, fmt.Sprintf("第 %d 行 (平台 %s, 登录名 '%s'): TOTP 密钥无效，已跳过", rowIndex, platform.Name, loginIdentifier))
+			encryptedTOTPSecret = ""
+		}
+
 		registration := models.PlatformRegistration{
 			UserID:                 userID,
 			EmailAccountID:         currentEmailAccountIDPtr,
@@ -276,12 +307,13 @@ func ImportBitwardenCSVHandler(c *gin.Context) {
 			LoginPasswordEncrypted: encryptedPassword,
 			Notes:                  combinedNotes,
 			PhoneNumber:            "", // Bitwarden CSV doesn't map directly to this.
+			TOTPSecretEncrypted:    encryptedTOTPSecret,
 		}
 
 		if createErr := db.Create(&registration).Error; createErr != nil {
 			errorCount++
 			errMsg := fmt.Sprintf("第 %d 行 (平台 %s, 登录名 '%s'): 创建平台注册信息失败: %v", rowIndex, platform.Name, loginIdentifier, createErr)
-			if strings.Contains(createErr.Error(), "UNIQUE constraint failed") || strings.Contains(createErr.Error(), "UNIQUE constraint violation") {
+			if utils.IsUniqueConstraintError(createErr) {
 				errMsg = fmt.Sprintf("第 %d 行 (平台 %s, 登录名 '%s'): 创建失败，唯一约束冲突 (可能已存在): %v", rowIndex, platform.Name, loginIdentifier, createErr)
 			}
 			errorMessages = append(errorMessages, errMsg)
@@ -297,7 +329,7 @@ func ImportBitwardenCSVHandler(c *gin.Context) {
 	log.Printf("Import finished. Saved: %d, Errors: %d", savedCount, errorCount)
 
 	// 根据保存结果返回响应
-	responseMessage := fmt.Sprintf("Bitwarden CSV 文件处理完成。成功保存 %d 条记录。", savedCount)
+	responseMessage := fmt.Sprintf("%s 文件处理完成。成功保存 %d 条记录。", source, savedCount)
 	if errorCount > 0 {
 		responseMessage += fmt.Sprintf(" 遇到 %d 个错误。", errorCount)
 	}
@@ -314,3 +346,50 @@ func ImportBitwardenCSVHandler(c *gin.Context) {
 		// "items": items, // 不再返回原始解析项，减少响应大小
 	})
 }
+
+// addImportedPlatformURLs 将导入条目的网址添加为平台网址，已存在的规则和与官方网址相同的默认规则会被跳过。
+// 返回无法导入的网址说明，不影响登录信息的导入
+func addImportedPlatformURLs(db *gorm.DB, platform *models.Platform, imported []models.ImportedURL) []string {
+	if len(imported) == 0 {
+		return nil
+	}
+	var existing []models.PlatformURL
+	if err := db.Where("platform_id = ?", platform.ID).Find(&existing).Error; err != nil {
+		log.Printf("Import: error loading URLs of platform %d: %v", platform.ID, err)
+		return []string{"读取平台网址失败，网址未导入"}
+	}
+	seen := map[string]bool{urlmatch.ModeBaseDomain + " " + platform.WebsiteURL: true}
+	for _, u := range existing {
+		seen[u.MatchMode+" "+u.URL] = true
+	}
+
+	var added []models.PlatformURL
+	var messages []string
+	for _, u := range imported {
+		urls, ok := buildPlatformURLs(platform.UserID, []models.PlatformURLInput{{URL: u.URL, MatchMode: u.MatchMode}})
+		if !ok {
+			messages = append(messages, fmt.Sprintf("网址 '%s' 无效，已跳过", u.URL))
+			continue
+		}
+		for _, url := range urls {
+			key := url.MatchMode + " " + url.URL
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			url.PlatformID = platform.ID
+			added = append(added, url)
+		}
+	}
+	if len(added) == 0 {
+		return messages
+	}
+	if err := db.Create(&added).Error; err != nil {
+		log.Printf("Import: error adding URLs to platform %d: %v", platform.ID, err)
+		return append(messages, "保存平台网址失败，网址未导入")
+	}
+	if err := models.SyncSearchDocuments(db, models.SearchEntityPlatform, []uint{platform.ID}); err != nil {
+		log.Printf("Import: error reindexing platform %d: %v", platform.ID, err)
+	}
+	return messages
+}
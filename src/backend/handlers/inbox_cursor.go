@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"email_server/models"
+)
+
+// inboxCursor 收件箱列表的不透明游标，绑定账户、文件夹和每页数量
+// Token 为服务商的翻页标记（Gmail pageToken / Graph @odata.nextLink），IMAP 账户只使用页码
+type inboxCursor struct {
+	AccountID uint   `json:"a"`
+	Folder    string `json:"f"`
+	PageSize  int    `json:"s"`
+	Page      int    `json:"p"`
+	Token     string `json:"t,omitempty"`
+}
+
+// encodeInboxCursor 将游标编码为可放在查询参数中的字符串
+func encodeInboxCursor(cursor inboxCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeInboxCursor 解析游标，格式不正确时返回 false
+func decodeInboxCursor(s string) (inboxCursor, bool) {
+	var cursor inboxCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &cursor) != nil {
+		return cursor, false
+	}
+	if cursor.AccountID == 0 || cursor.Page < 1 || cursor.PageSize < 1 || cursor.PageSize > inboxMaxPageSize {
+		return cursor, false
+	}
+	return cursor, true
+}
+
+const (
+	// inboxMaxPageSize 每页邮件数量上限
+	inboxMaxPageSize = 100
+	// inboxMaxPageWalk 按页码访问时最多向后定位的页数，更远的页需使用游标逐页加载
+	inboxMaxPageWalk = 20
+	// inboxPageCacheTTL 页码缓存的有效期
+	inboxPageCacheTTL = 15 * time.Minute
+	// inboxPageCacheLimit 页码缓存最多保存的列表数量
+	inboxPageCacheLimit = 1000
+)
+
+// errInboxPageTooFar 请求的页码离已知页太远
+var errInboxPageTooFar = errors.New("inbox page too far")
+
+// inboxPageKey 同一用户、账户、文件夹和每页数量的列表共享页码缓存
+type inboxPageKey struct {
+	UserID    uint
+	AccountID uint
+	Folder    string
+	PageSize  int
+}
+
+// inboxPageTokens 页码到翻页标记的映射，第 1 页的标记为空字符串
+type inboxPageTokens struct {
+	tokens    map[int]string
+	updatedAt time.Time
+}
+
+var (
+	inboxPageMu    sync.Mutex
+	inboxPageCache = map[inboxPageKey]*inboxPageTokens{}
+)
+
+// rememberInboxPageToken 记录第 page 页的翻页标记
+func rememberInboxPageToken(key inboxPageKey, page int, token string) {
+	inboxPageMu.Lock()
+	defer inboxPageMu.Unlock()
+
+	now := time.Now()
+	entry, ok := inboxPageCache[key]
+	if !ok || now.Sub(entry.updatedAt) > inboxPageCacheTTL {
+		if len(inboxPageCache) >= inboxPageCacheLimit {
+			pruneInboxPageCache(now)
+		}
+		entry = &inboxPageTokens{tokens: map[int]string{1: ""}}
+		inboxPageCache[key] = entry
+	}
+	entry.tokens[page] = token
+	entry.updatedAt = now
+}
+
+// pruneInboxPageCache 删除过期的缓存，仍然超出上限时清空；调用方需持有 inboxPageMu
+func pruneInboxPageCache(now time.Time) {
+	for key, entry := range inboxPageCache {
+		if now.Sub(entry.updatedAt) > inboxPageCacheTTL {
+			delete(inboxPageCache, key)
+		}
+	}
+	if len(inboxPageCache) >= inboxPageCacheLimit {
+		inboxPageCache = map[inboxPageKey]*inboxPageTokens{}
+	}
+}
+
+// resetInboxPageTokens 重新加载第一页时清除缓存，新邮件到达后旧的页码标记不再准确
+func resetInboxPageTokens(key inboxPageKey) {
+	inboxPageMu.Lock()
+	defer inboxPageMu.Unlock()
+	delete(inboxPageCache, key)
+}
+
+// closestInboxPageToken 返回不超过 page 的最近一个已知页及其翻页标记
+func closestInboxPageToken(key inboxPageKey, page int) (int, string) {
+	inboxPageMu.Lock()
+	defer inboxPageMu.Unlock()
+
+	entry, ok := inboxPageCache[key]
+	if !ok || time.Since(entry.updatedAt) > inboxPageCacheTTL {
+		return 1, ""
+	}
+	known, token := 1, ""
+	for p, t := range entry.tokens {
+		if p <= page && p > known {
+			known, token = p, t
+		}
+	}
+	return known, token
+}
+
+// resolveInboxPageToken 将页码转换为服务商的翻页标记
+// 缓存中没有该页时，从最近的已知页开始调用 next 逐页获取下一页标记；列表在到达该页前结束时 ok 为 false
+func resolveInboxPageToken(key inboxPageKey, page int, next func(token string) (string, error)) (token string, ok bool, err error) {
+	known, token := closestInboxPageToken(key, page)
+	if page-known > inboxMaxPageWalk {
+		return "", false, errInboxPageTooFar
+	}
+	for known < page {
+		token, err = next(token)
+		if err != nil {
+			return "", false, err
+		}
+		if token == "" {
+			return "", false, nil
+		}
+		known++
+		rememberInboxPageToken(key, known, token)
+	}
+	return token, true, nil
+}
+
+// inboxPageFetcher 按翻页标记获取一页邮件，返回下一页的标记
+type inboxPageFetcher func(token string) ([]models.Email, int, string, error)
+
+// fetchTokenPagedInbox 获取只支持游标翻页的服务商（Gmail / Graph）的一页邮件
+// hasCursor 为 true 时直接使用游标中的 token，否则通过页码缓存把页码转换为 token
+func fetchTokenPagedInbox(key inboxPageKey, page int, token string, hasCursor bool, fetch inboxPageFetcher, next func(token string) (string, error)) ([]models.Email, int, string, error) {
+	switch {
+	case hasCursor:
+		rememberInboxPageToken(key, page, token)
+	case page == 1:
+		resetInboxPageTokens(key)
+	default:
+		resolved, ok, err := resolveInboxPageToken(key, page, next)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		if !ok {
+			// 列表没有这么多页
+			return []models.Email{}, 0, "", nil
+		}
+		token = resolved
+	}
+
+	emails, total, nextToken, err := fetch(token)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if nextToken != "" {
+		rememberInboxPageToken(key, page+1, nextToken)
+	}
+	return emails, total, nextToken, nil
+}
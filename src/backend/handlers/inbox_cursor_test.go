@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInboxCursor_RoundTripAndValidation(t *testing.T) {
+	cursor := inboxCursor{AccountID: 7, Folder: "inbox", PageSize: 20, Page: 3, Token: "https://graph.microsoft.com/v1.0/me/mailFolders/inbox/messages?$skiptoken=x"}
+	decoded, ok := decodeInboxCursor(encodeInboxCursor(cursor))
+	require.True(t, ok)
+	assert.Equal(t, cursor, decoded)
+
+	for _, bad := range []string{"", "not base64!", encodeInboxCursor(inboxCursor{AccountID: 7, PageSize: 20}), encodeInboxCursor(inboxCursor{AccountID: 7, Page: 1, PageSize: 1000})} {
+		_, ok := decodeInboxCursor(bad)
+		assert.False(t, ok, bad)
+	}
+}
+
+// fakeTokenList 模拟按 pageToken 翻页的服务商：共 pages 页，第 n 页的标记为 "tn"
+type fakeTokenList struct {
+	pages   int
+	fetched []string
+	walked  []string
+}
+
+func (f *fakeTokenList) nextOf(token string) string {
+	n := 1
+	if token != "" {
+		n = int(token[1] - '0')
+	}
+	if n >= f.pages {
+		return ""
+	}
+	return "t" + string(rune('0'+n+1))
+}
+
+func (f *fakeTokenList) fetch(token string) ([]models.Email, int, string, error) {
+	f.fetched = append(f.fetched, token)
+	return []models.Email{{MessageID: "page-" + token}}, f.pages, f.nextOf(token), nil
+}
+
+func (f *fakeTokenList) next(token string) (string, error) {
+	f.walked = append(f.walked, token)
+	return f.nextOf(token), nil
+}
+
+func TestFetchTokenPagedInbox_EmulatesPageNumbers(t *testing.T) {
+	key := inboxPageKey{UserID: 1, AccountID: 2, Folder: "inbox", PageSize: 10}
+	resetInboxPageTokens(key)
+	list := &fakeTokenList{pages: 4}
+
+	// 第一页返回的下一页标记被缓存，直接请求第 2 页不需要额外定位
+	_, _, next, err := fetchTokenPagedInbox(key, 1, "", false, list.fetch, list.next)
+	require.NoError(t, err)
+	assert.Equal(t, "t2", next)
+	_, _, _, err = fetchTokenPagedInbox(key, 2, "", false, list.fetch, list.next)
+	require.NoError(t, err)
+	assert.Empty(t, list.walked)
+
+	// 跳到第 4 页时从最近的已知页（第 3 页）向后定位
+	emails, _, next, err := fetchTokenPagedInbox(key, 4, "", false, list.fetch, list.next)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t3"}, list.walked)
+	assert.Equal(t, "page-t4", emails[0].MessageID)
+	assert.Empty(t, next, "最后一页没有下一页标记")
+
+	// 超出列表范围时返回空列表
+	emails, _, _, err = fetchTokenPagedInbox(key, 6, "", false, list.fetch, list.next)
+	require.NoError(t, err)
+	assert.Empty(t, emails)
+
+	// 重新加载第一页会清除缓存
+	_, _, _, err = fetchTokenPagedInbox(key, 1, "", false, list.fetch, list.next)
+	require.NoError(t, err)
+	list.walked = nil
+	_, _, _, err = fetchTokenPagedInbox(key, 3, "", false, list.fetch, list.next)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t2"}, list.walked)
+
+	// 使用游标时直接使用游标中的标记
+	list.walked = nil
+	emails, _, _, err = fetchTokenPagedInbox(key, 9, "t4", true, list.fetch, list.next)
+	require.NoError(t, err)
+	assert.Equal(t, "page-t4", emails[0].MessageID)
+	assert.Empty(t, list.walked)
+}
+
+func TestFetchTokenPagedInbox_RejectsFarPages(t *testing.T) {
+	key := inboxPageKey{UserID: 1, AccountID: 3, Folder: "inbox", PageSize: 10}
+	resetInboxPageTokens(key)
+	list := &fakeTokenList{pages: 9}
+	_, _, _, err := fetchTokenPagedInbox(key, inboxMaxPageWalk+2, "", false, list.fetch, list.next)
+	assert.True(t, errors.Is(err, errInboxPageTooFar))
+	assert.Empty(t, list.walked)
+}
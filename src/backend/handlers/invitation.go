@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"email_server/database"
+	"email_server/mailer"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// defaultInvitationTTL 邀请默认有效期
+const defaultInvitationTTL = 72 * time.Hour
+
+var (
+	errInvitationInvalid       = errors.New("invitation is invalid, used or expired")
+	errInvitationEmailMismatch = errors.New("invitation was issued for another email")
+)
+
+// findUsableInvitation 查找可用于该邮箱注册的邀请
+func findUsableInvitation(code, email string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := database.DB.Where("code = ?", code).First(&invitation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvitationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if invitation.Status() != "pending" {
+		return nil, errInvitationInvalid
+	}
+	if invitation.Email != "" && !strings.EqualFold(invitation.Email, email) {
+		return nil, errInvitationEmailMismatch
+	}
+	return &invitation, nil
+}
+
+// consumeInvitation 在注册事务中将邀请标记为已使用，并发注册时只有一个能成功
+func consumeInvitation(tx *gorm.DB, invitation *models.Invitation, userID uint) error {
+	now := time.Now()
+	result := tx.Model(&models.Invitation{}).
+		Where("id = ? AND used_at IS NULL", invitation.ID).
+		Updates(map[string]interface{}{"used_at": now, "used_by": userID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvitationInvalid
+	}
+	return nil
+}
+
+// invitationURL 邀请注册链接
+func invitationURL(code string) string {
+	return frontendBaseURL() + "/auth/register?invite=" + url.QueryEscape(code)
+}
+
+// sendInvitationMail 把邀请链接发送到邀请的邮箱
+func sendInvitationMail(invitation models.Invitation, code string) error {
+	body := fmt.Sprintf("您好：\n\n您被邀请注册账户。请在 %s 前打开以下链接完成注册，链接只能使用一次：\n\n%s\n\n如果您不认识发出邀请的人，请忽略此邮件。\n",
+		invitation.ExpiresAt.Format("2006-01-02 15:04"), invitationURL(code))
+	return mailer.Default.Send(invitation.Email, "注册邀请", body)
+}
+
+// CreateInvitation 创建注册邀请（管理员功能）
+// @Summary 创建注册邀请
+// @Description 邀请码只在创建时返回一次；指定邮箱时只能用该邮箱注册，配置了 SMTP 时同时把邀请链接发送到该邮箱
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateInvitationRequest true "邀请信息"
+// @Success 201 {object} models.SuccessResponse{data=models.InvitationResponse} "创建成功"
+// @Failure 400 {object} models.ErrorResponse "参数错误"
+// @Router /admin/invitations [post]
+func CreateInvitation(c *gin.Context) {
+	var req models.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleUser
+	}
+	if req.Role != models.RoleAdmin && req.Role != models.RoleUser {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的角色值")
+		return
+	}
+	if req.ExpiresInHours < 0 {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "有效期不能为负数")
+		return
+	}
+	ttl := defaultInvitationTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	code, err := generateRandomState()
+	if err != nil {
+		log.Printf("生成邀请码失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "系统错误")
+		return
+	}
+	adminID := c.GetInt64("user_id")
+	invitation := models.Invitation{
+		Code:      code,
+		Email:     strings.TrimSpace(req.Email),
+		Role:      req.Role,
+		CreatedBy: uint(adminID),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := database.DB.Create(&invitation).Error; err != nil {
+		log.Printf("创建邀请失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "创建邀请失败")
+		return
+	}
+	log.Printf("管理员 %d 创建了注册邀请 %d", adminID, invitation.ID)
+
+	// 发送失败不影响邀请本身，管理员仍可手动转发返回的链接
+	emailSent := false
+	if invitation.Email != "" && mailer.Configured() {
+		if err := sendInvitationMail(invitation, code); err != nil {
+			log.Printf("发送注册邀请 %d 的邮件失败: %v", invitation.ID, err)
+		} else {
+			emailSent = true
+		}
+	}
+
+	utils.SendCreatedResponse(c, models.InvitationResponse{
+		Invitation: invitation,
+		Status:     invitation.Status(),
+		Code:       code,
+		InviteURL:  invitationURL(code),
+		EmailSent:  emailSent,
+	})
+}
+
+// GetInvitations 获取注册邀请列表（管理员功能）
+// @Summary 获取注册邀请列表
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse{data=[]models.InvitationResponse} "获取成功"
+// @Router /admin/invitations [get]
+func GetInvitations(c *gin.Context) {
+	var invitations []models.Invitation
+	if err := database.DB.Order("created_at DESC").Find(&invitations).Error; err != nil {
+		log.Printf("查询邀请失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询邀请失败")
+		return
+	}
+	responses := make([]models.InvitationResponse, len(invitations))
+	for i, invitation := range invitations {
+		responses[i] = models.InvitationResponse{Invitation: invitation, Status: invitation.Status()}
+	}
+	utils.SendSuccessResponse(c, responses)
+}
+
+// DeleteInvitation 撤销未使用的注册邀请（管理员功能）
+// @Summary 撤销注册邀请
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "邀请ID"
+// @Success 200 {object} models.SuccessResponse "撤销成功"
+// @Failure 400 {object} models.ErrorResponse "邀请已使用"
+// @Failure 404 {object} models.ErrorResponse "邀请不存在"
+// @Router /admin/invitations/{id} [delete]
+func DeleteInvitation(c *gin.Context) {
+	id, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的邀请ID")
+		return
+	}
+	var invitation models.Invitation
+	if err := database.DB.First(&invitation, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendErrorResponse(c, http.StatusNotFound, "邀请不存在")
+		} else {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "系统错误")
+		}
+		return
+	}
+	if invitation.UsedAt != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "邀请已被使用，不能撤销")
+		return
+	}
+	if err := database.DB.Delete(&invitation).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "撤销邀请失败")
+		return
+	}
+	utils.SendSuccessResponse(c, "邀请已撤销")
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"email_server/models"
+)
+
+// jobRegistry 记录定时任务在本进程中的运行情况，供系统状态接口展示
+var jobRegistry = struct {
+	sync.Mutex
+	order []string
+	jobs  map[string]*models.JobStatus
+}{jobs: make(map[string]*models.JobStatus)}
+
+// registerJob 登记定时任务，重复登记时更新计划与启用状态
+func registerJob(name, schedule string, enabled bool) {
+	jobRegistry.Lock()
+	defer jobRegistry.Unlock()
+	if job, ok := jobRegistry.jobs[name]; ok {
+		job.Schedule = schedule
+		job.Enabled = enabled
+		return
+	}
+	jobRegistry.order = append(jobRegistry.order, name)
+	jobRegistry.jobs[name] = &models.JobStatus{Name: name, Schedule: schedule, Enabled: enabled}
+}
+
+// runJob 执行任务并记录运行时间、耗时和错误
+func runJob(name string, fn func() error) {
+	start := time.Now()
+	err := fn()
+
+	jobRegistry.Lock()
+	defer jobRegistry.Unlock()
+	job, ok := jobRegistry.jobs[name]
+	if !ok {
+		return
+	}
+	job.Runs++
+	job.LastRunAt = &start
+	job.LastDurationMs = time.Since(start).Milliseconds()
+	job.LastError = ""
+	if err != nil {
+		job.LastError = err.Error()
+	}
+}
+
+// jobStatuses 按登记顺序返回所有任务状态的副本
+func jobStatuses() []models.JobStatus {
+	jobRegistry.Lock()
+	defer jobRegistry.Unlock()
+	statuses := make([]models.JobStatus, 0, len(jobRegistry.order))
+	for _, name := range jobRegistry.order {
+		statuses = append(statuses, *jobRegistry.jobs[name])
+	}
+	return statuses
+}
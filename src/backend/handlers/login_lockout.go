@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// loginLockoutDuration 连续失败 attempts 次后的锁定时长：达到阈值时锁定 LoginLockoutMinutes，
+// 此后每多失败一次翻倍，不超过 LoginLockoutMaxMinutes；未达到阈值或未开启锁定时返回 0
+func loginLockoutDuration(attempts int) time.Duration {
+	security := config.AppConfig.Security
+	if security.LoginLockoutThreshold <= 0 || attempts < security.LoginLockoutThreshold {
+		return 0
+	}
+	base := time.Duration(security.LoginLockoutMinutes) * time.Minute
+	if base <= 0 {
+		base = time.Minute
+	}
+	max := time.Duration(security.LoginLockoutMaxMinutes) * time.Minute
+	if max < base {
+		max = base
+	}
+	lockout := base
+	for i := security.LoginLockoutThreshold; i < attempts && lockout < max; i++ {
+		lockout *= 2
+	}
+	if lockout > max {
+		lockout = max
+	}
+	return lockout
+}
+
+// recordLoginFailure 记录一次密码错误，达到阈值时锁定账户并返回锁定时长
+func recordLoginFailure(user *models.User) time.Duration {
+	err := database.DB.Model(&models.User{}).Where("id = ?", user.ID).
+		UpdateColumn("failed_login_attempts", gorm.Expr("failed_login_attempts + 1")).Error
+	if err == nil {
+		// 重新读取计数，并发的失败登录都会被计入
+		err = database.DB.Model(&models.User{}).Select("failed_login_attempts").Where("id = ?", user.ID).
+			Scan(&user.FailedLoginAttempts).Error
+	}
+	if err != nil {
+		log.Printf("记录用户 %d 登录失败次数失败: %v", user.ID, err)
+		return 0
+	}
+
+	lockout := loginLockoutDuration(user.FailedLoginAttempts)
+	if lockout == 0 {
+		return 0
+	}
+	lockedUntil := time.Now().Add(lockout)
+	if err := database.DB.Model(&models.User{}).Where("id = ?", user.ID).UpdateColumn("locked_until", lockedUntil).Error; err != nil {
+		log.Printf("锁定用户 %d 失败: %v", user.ID, err)
+		return 0
+	}
+	user.LockedUntil = &lockedUntil
+	log.Printf("用户 %d 连续 %d 次登录失败，锁定至 %s", user.ID, user.FailedLoginAttempts, lockedUntil.Format(time.RFC3339))
+	return lockout
+}
+
+// UnlockUser 解除用户因连续登录失败导致的锁定（管理员功能）
+// @Summary 解锁用户
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} models.SuccessResponse "解锁成功"
+// @Failure 404 {object} models.ErrorResponse "用户不存在"
+// @Router /admin/users/{id}/unlock [put]
+func UnlockUser(c *gin.Context) {
+	userID, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的用户ID")
+		return
+	}
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendErrorResponse(c, http.StatusNotFound, "用户不存在")
+		} else {
+			log.Printf("查询用户失败: %v", err)
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "系统错误")
+		}
+		return
+	}
+	err = database.DB.Model(&user).UpdateColumns(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"locked_until":          nil,
+	}).Error
+	if err != nil {
+		log.Printf("解锁用户 %d 失败: %v", user.ID, err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "解锁失败")
+		return
+	}
+	log.Printf("管理员 %d 解锁了用户 %d", c.GetInt64("user_id"), user.ID)
+	utils.SendSuccessResponse(c, "解锁成功")
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"email_server/config"
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogin_ProgressiveLockoutAndAdminUnlock(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	config.AppConfig.Security.LoginLockoutThreshold = 3
+	config.AppConfig.Security.LoginLockoutMinutes = 1
+	config.AppConfig.Security.LoginLockoutMaxMinutes = 60
+	registerUser(t, r, "grace", "grace@example.com")
+	badLogin := map[string]string{"username": "grace", "password": "wrong-password"}
+
+	for i := 0; i < 2; i++ {
+		w := doJSON(r, "POST", "/api/v1/auth/login", badLogin)
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	// 第三次失败后锁定 1 分钟，锁定期间密码正确也不能登录
+	w := doJSON(r, "POST", "/api/v1/auth/login", badLogin)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	w = doJSON(r, "POST", "/api/v1/auth/login", map[string]string{"username": "grace", "password": "secret-password"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// 锁定到期后再次失败，锁定时长翻倍
+	require.NoError(t, db.Model(&models.User{}).Where("username = ?", "grace").Update("locked_until", time.Now().Add(-time.Second)).Error)
+	w = doJSON(r, "POST", "/api/v1/auth/login", badLogin)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "120", w.Header().Get("Retry-After"))
+
+	// 管理员可以看到锁定状态并解锁
+	var user models.User
+	require.NoError(t, db.Where("username = ?", "grace").First(&user).Error)
+	w = doAdminJSON(r, "GET", "/api/v1/admin/users", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"failed_login_attempts":4`)
+
+	w = doAdminJSON(r, "PUT", "/api/v1/admin/users/"+strconv.Itoa(int(user.ID))+"/unlock", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	login(t, r, "grace", "secret-password")
+
+	// 登录成功后计数清零
+	var reloaded models.User
+	require.NoError(t, db.First(&reloaded, user.ID).Error)
+	assert.Zero(t, reloaded.FailedLoginAttempts)
+	assert.Nil(t, reloaded.LockedUntil)
+}
+
+func TestLoginLockoutDuration(t *testing.T) {
+	config.AppConfig = &config.Config{Security: config.SecurityConfig{LoginLockoutThreshold: 5, LoginLockoutMinutes: 1, LoginLockoutMaxMinutes: 10}}
+
+	assert.Zero(t, loginLockoutDuration(4))
+	assert.Equal(t, time.Minute, loginLockoutDuration(5))
+	assert.Equal(t, 2*time.Minute, loginLockoutDuration(6))
+	assert.Equal(t, 8*time.Minute, loginLockoutDuration(8))
+	assert.Equal(t, 10*time.Minute, loginLockoutDuration(9))
+	assert.Equal(t, 10*time.Minute, loginLockoutDuration(1000))
+
+	config.AppConfig.Security.LoginLockoutThreshold = 0
+	assert.Zero(t, loginLockoutDuration(1000))
+}
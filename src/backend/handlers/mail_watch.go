@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/mailwatch"
+	"email_server/models"
+	"email_server/utils"
+)
+
+const (
+	// mailWatchEventPurgeJobName 新邮件事件清理任务在系统状态中的名称
+	mailWatchEventPurgeJobName = "mail_watch_event_purge"
+	// mailEventsReplayLimit 客户端重连时最多补发的事件数
+	mailEventsReplayLimit = 100
+)
+
+// mailEventsHeartbeat SSE 连接的心跳间隔，避免代理因空闲断开连接，测试中可修改
+var mailEventsHeartbeat = 25 * time.Second
+
+// StartMailWatch 启动新邮件监听和过期事件的清理任务
+func StartMailWatch() {
+	cfg := config.AppConfig.MailWatch
+	if err := mailwatch.Start(cfg, config.AppConfig.Backend.BaseURL); err != nil {
+		log.Printf("Error starting mail watch: %v", err)
+	}
+
+	retentionDays := cfg.EventRetentionDays
+	const schedule = "@hourly"
+	registerJob(mailWatchEventPurgeJobName, schedule, retentionDays > 0)
+	if retentionDays <= 0 {
+		return
+	}
+	c := cron.New()
+	_, err := c.AddFunc(schedule, func() {
+		runJob(mailWatchEventPurgeJobName, func() error {
+			purged, err := mailwatch.PurgeEvents(time.Now().AddDate(0, 0, -retentionDays))
+			if err != nil {
+				log.Printf("Error purging new mail events: %v", err)
+				return err
+			}
+			if purged > 0 {
+				log.Printf("New mail event purge finished, %d event(s) deleted.", purged)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Fatalf("Error adding new mail event purge cron job: %v", err)
+	}
+	c.Start()
+}
+
+// mailWatchMethod 按账户类型选择监听方式
+func mailWatchMethod(emailAccount models.EmailAccount) (string, error) {
+	provider, err := accountMailProvider(emailAccount)
+	if err != nil {
+		return "", err
+	}
+	switch provider {
+	case "microsoft":
+		return models.MailWatchMethodGraphDelta, nil
+	case "google":
+		return models.MailWatchMethodGmailHistory, nil
+	}
+	if emailAccount.IMAPServer == "" || emailAccount.IMAPPort == 0 {
+		return "", errIMAPNotConfigured
+	}
+	return models.MailWatchMethodIMAPIdle, nil
+}
+
+// GetMailWatches 获取当前用户所有邮箱账户的新邮件监听状态
+// @Summary 新邮件监听状态
+// @Description 返回每个邮箱账户是否开启了新邮件监听，以及监听方式、状态和最近一次错误
+// @Tags Inbox
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse "返回 watches 列表"
+// @Router /inbox/watches [get]
+func GetMailWatches(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	var accounts []models.EmailAccount
+	if err := database.DB.Where("user_id = ?", userID).Order("id").Find(&accounts).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取邮箱账户失败")
+		return
+	}
+	var watches []models.MailWatch
+	if err := database.DB.Where("user_id = ?", userID).Find(&watches).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取新邮件监听失败")
+		return
+	}
+	byAccount := make(map[uint]models.MailWatch, len(watches))
+	for _, watch := range watches {
+		byAccount[watch.EmailAccountID] = watch
+	}
+
+	type accountWatch struct {
+		AccountID    uint              `json:"accountId"`
+		EmailAddress string            `json:"emailAddress"`
+		Enabled      bool              `json:"enabled"`
+		Watch        *models.MailWatch `json:"watch,omitempty"`
+	}
+	result := make([]accountWatch, 0, len(accounts))
+	for _, account := range accounts {
+		item := accountWatch{AccountID: account.ID, EmailAddress: account.EmailAddress}
+		if watch, ok := byAccount[account.ID]; ok {
+			item.Enabled = true
+			item.Watch = &watch
+		}
+		result = append(result, item)
+	}
+	utils.SendSuccessResponse(c, gin.H{"watches": result})
+}
+
+// UpdateMailWatch 开启或关闭邮箱账户的新邮件监听
+// @Summary 开启或关闭新邮件监听
+// @Description IMAP 账户使用 IDLE 长连接（服务器不支持时定期检查），Gmail 账户定期检查 history，
+// @Description Outlook 账户定期执行 delta 查询，配置了 MAIL_WATCH_GRAPH_NOTIFICATIONS 时由变更通知立即触发。
+// @Description 开启后收到的新邮件通过 /inbox/events 推送。被暂停（suspended）的监听重新开启即可恢复
+// @Tags Inbox
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param accountId path int true "邮箱账户ID"
+// @Param request body models.UpdateMailWatchRequest true "是否开启"
+// @Success 200 {object} models.SuccessResponse "返回 enabled 和 watch"
+// @Failure 400 {object} models.ErrorResponse "参数错误或 IMAP 未配置"
+// @Failure 404 {object} models.ErrorResponse "邮箱账户不存在"
+// @Router /inbox/watches/{accountId} [put]
+func UpdateMailWatch(c *gin.Context) {
+	accountID, err := utils.StringToUint(c.Param("accountId"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的账户ID")
+		return
+	}
+	var req models.UpdateMailWatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+	emailAccount, ok := findUserEmailAccount(c, accountID)
+	if !ok {
+		return
+	}
+
+	if !*req.Enabled {
+		if err := mailwatch.Disable(emailAccount); err != nil {
+			log.Printf("[UpdateMailWatch] Disabling watch of account %d failed: %v", emailAccount.ID, err)
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "关闭新邮件监听失败")
+			return
+		}
+		utils.SendSuccessResponse(c, gin.H{"enabled": false})
+		return
+	}
+
+	method, err := mailWatchMethod(emailAccount)
+	if errors.Is(err, errIMAPNotConfigured) {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "IMAP settings are not configured for this non-OAuth email account.")
+		return
+	} else if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取邮箱账户类型失败")
+		return
+	}
+	watch, err := mailwatch.Enable(emailAccount, method)
+	if err != nil {
+		log.Printf("[UpdateMailWatch] Enabling watch of account %d failed: %v", emailAccount.ID, err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "开启新邮件监听失败")
+		return
+	}
+	utils.SendSuccessResponse(c, gin.H{"enabled": true, "watch": watch})
+}
+
+// GetNewMailEvents 获取 ID 大于 since_id 的新邮件事件，供无法保持 SSE 连接的客户端轮询
+// @Summary 新邮件事件
+// @Tags Inbox
+// @Produce json
+// @Security BearerAuth
+// @Param since_id query int false "上次收到的最大事件ID，默认 0"
+// @Param limit query int false "最多返回数量，默认 100"
+// @Success 200 {object} models.SuccessResponse "返回 events 列表，按 ID 升序"
+// @Router /inbox/new-mail-events [get]
+func GetNewMailEvents(c *gin.Context) {
+	sinceID, _ := strconv.ParseUint(c.DefaultQuery("since_id", "0"), 10, 64)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(mailEventsReplayLimit)))
+	if limit < 1 || limit > mailEventsReplayLimit {
+		limit = mailEventsReplayLimit
+	}
+	events, err := mailwatch.EventsAfter(uint(c.GetInt64("user_id")), uint(sinceID), limit)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取新邮件事件失败")
+		return
+	}
+	utils.SendSuccessResponse(c, gin.H{"events": events})
+}
+
+// StreamNewMailEvents 通过 Server-Sent Events 推送新邮件
+// @Summary 新邮件推送（SSE）
+// @Description 保持连接并以 text/event-stream 推送 new_mail 事件，data 为事件 JSON，id 为事件ID。
+// @Description 重连时通过 Last-Event-ID 请求头或 since_id 参数补发之后的事件（最多 100 条）。
+// @Description 接口需要 Authorization 请求头，浏览器中请使用 fetch 读取流而不是 EventSource
+// @Tags Inbox
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param since_id query int false "上次收到的最大事件ID"
+// @Router /inbox/events [get]
+func StreamNewMailEvents(c *gin.Context) {
+	userID := uint(c.GetInt64("user_id"))
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("since_id")
+	}
+
+	// 先订阅再补发，避免两者之间的事件丢失；补发过的事件按 ID 跳过
+	events, unsubscribe := mailwatch.DefaultHub.Subscribe(userID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	var sentID uint
+	if lastID != "" {
+		if afterID, err := strconv.ParseUint(lastID, 10, 64); err == nil {
+			missed, err := mailwatch.EventsAfter(userID, uint(afterID), mailEventsReplayLimit)
+			if err != nil {
+				log.Printf("[StreamNewMailEvents] Loading missed events for user %d failed: %v", userID, err)
+			}
+			for _, event := range missed {
+				writeNewMailEvent(c.Writer, event)
+				sentID = event.ID
+			}
+		}
+	}
+	fmt.Fprint(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(mailEventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.ID <= sentID {
+				continue
+			}
+			writeNewMailEvent(c.Writer, event)
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+func writeNewMailEvent(w io.Writer, event models.NewMailEvent) {
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "id: %d\nevent: new_mail\ndata: %s\n\n", event.ID, data)
+}
+
+// HandleGraphMailNotification 接收 Microsoft Graph 的新邮件变更通知
+// @Summary Graph 变更通知回调
+// @Description 创建订阅时 Graph 以 validationToken 参数验证地址，原样返回即可。
+// @Description 之后的通知按 subscriptionId 和 clientState 找到对应账户并立即检查新邮件，通知内容本身不被信任
+// @Tags Webhooks
+// @Accept json
+// @Produce plain
+// @Param validationToken query string false "订阅验证"
+// @Success 200 {string} string "订阅验证"
+// @Success 202 "已接收"
+// @Router /webhooks/graph/mail [post]
+func HandleGraphMailNotification(c *gin.Context) {
+	if token := c.Query("validationToken"); token != "" {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(token))
+		return
+	}
+	var payload struct {
+		Value []struct {
+			SubscriptionID string `json:"subscriptionId"`
+			ClientState    string `json:"clientState"`
+		} `json:"value"`
+	}
+	if err := json.NewDecoder(io.LimitReader(c.Request.Body, 1<<20)).Decode(&payload); err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	for _, notification := range payload.Value {
+		if !mailwatch.HandleGraphNotification(notification.SubscriptionID, notification.ClientState) {
+			log.Printf("[HandleGraphMailNotification] Ignoring notification for unknown subscription %q", notification.SubscriptionID)
+		}
+	}
+	c.Status(http.StatusAccepted)
+}
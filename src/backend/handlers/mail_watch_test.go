@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"email_server/mailwatch"
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailWatches_EnableAndDisable(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	owner := registerUser(t, r, "wade", "wade@example.com")
+	other := registerUser(t, r, "xena", "xena@example.com")
+	imapAccount := models.EmailAccount{UserID: uint(owner.User.ID), EmailAddress: "wade@example.com", IMAPServer: "imap.example.com", IMAPPort: 993}
+	require.NoError(t, db.Create(&imapAccount).Error)
+	noIMAP := models.EmailAccount{UserID: uint(owner.User.ID), EmailAddress: "wade@other.example"}
+	require.NoError(t, db.Create(&noIMAP).Error)
+
+	put := func(token string, accountID uint, enabled bool) *httptest.ResponseRecorder {
+		return doAuthJSON(r, "PUT", fmt.Sprintf("/api/v1/inbox/watches/%d", accountID), token, map[string]bool{"enabled": enabled})
+	}
+
+	assert.Equal(t, http.StatusNotFound, put(other.Token, imapAccount.ID, true).Code)
+	assert.Equal(t, http.StatusBadRequest, put(owner.Token, noIMAP.ID, true).Code)
+	w := doAuthJSON(r, "PUT", fmt.Sprintf("/api/v1/inbox/watches/%d", imapAccount.ID), owner.Token, map[string]string{})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "enabled 必填")
+
+	w = put(owner.Token, imapAccount.ID, true)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var enabled struct {
+		Enabled bool             `json:"enabled"`
+		Watch   models.MailWatch `json:"watch"`
+	}
+	decodeData(t, w, &enabled)
+	assert.True(t, enabled.Enabled)
+	assert.Equal(t, models.MailWatchMethodIMAPIdle, enabled.Watch.Method)
+	assert.Equal(t, models.MailWatchStatusStopped, enabled.Watch.Status, "监听管理器未运行时只保存设置")
+
+	type listResponse struct {
+		Watches []struct {
+			AccountID uint              `json:"accountId"`
+			Enabled   bool              `json:"enabled"`
+			Watch     *models.MailWatch `json:"watch"`
+		} `json:"watches"`
+	}
+	var list listResponse
+	w = doAuthJSON(r, "GET", "/api/v1/inbox/watches", owner.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	decodeData(t, w, &list)
+	require.Len(t, list.Watches, 2)
+	assert.True(t, list.Watches[0].Enabled)
+	assert.Equal(t, imapAccount.ID, list.Watches[0].AccountID)
+	assert.False(t, list.Watches[1].Enabled)
+	assert.Nil(t, list.Watches[1].Watch)
+
+	w = doAuthJSON(r, "GET", "/api/v1/inbox/watches", other.Token, nil)
+	decodeData(t, w, &list)
+	assert.Empty(t, list.Watches)
+
+	require.Equal(t, http.StatusOK, put(owner.Token, imapAccount.ID, false).Code)
+	var count int64
+	db.Model(&models.MailWatch{}).Count(&count)
+	assert.Zero(t, count)
+	assert.Equal(t, http.StatusOK, put(owner.Token, imapAccount.ID, false).Code, "重复关闭不报错")
+}
+
+func TestNewMailEvents_ListAndStream(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	owner := registerUser(t, r, "yuri", "yuri@example.com")
+	other := registerUser(t, r, "zoe", "zoe@example.com")
+	ownerID := uint(owner.User.ID)
+	for i, user := range []uint{ownerID, ownerID, uint(other.User.ID)} {
+		require.NoError(t, db.Create(&models.NewMailEvent{UserID: user, EmailAccountID: 1, MessageID: fmt.Sprintf("m%d", i), Subject: "hi"}).Error)
+	}
+
+	var listed struct {
+		Events []models.NewMailEvent `json:"events"`
+	}
+	w := doAuthJSON(r, "GET", "/api/v1/inbox/new-mail-events?since_id=1", owner.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	decodeData(t, w, &listed)
+	require.Len(t, listed.Events, 1, "只返回自己的、ID 更大的事件")
+	assert.Equal(t, uint(2), listed.Events[0].ID)
+
+	original := mailEventsHeartbeat
+	mailEventsHeartbeat = 10 * time.Millisecond
+	t.Cleanup(func() { mailEventsHeartbeat = original })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/api/v1/inbox/events", nil).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+owner.Token)
+	req.Header.Set("Last-Event-ID", "1")
+	stream := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		r.ServeHTTP(stream, req)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return mailwatch.DefaultHub.Subscribers(ownerID) == 1 }, 5*time.Second, 5*time.Millisecond)
+	mailwatch.DefaultHub.Publish(models.NewMailEvent{ID: 2, UserID: ownerID, MessageID: "m1"})
+	mailwatch.DefaultHub.Publish(models.NewMailEvent{ID: 9, UserID: ownerID, MessageID: "m9"})
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	body := stream.Body.String()
+	assert.Equal(t, "text/event-stream", stream.Header().Get("Content-Type"))
+	assert.Equal(t, 1, strings.Count(body, "id: 2\n"), "补发过的事件不重复推送")
+	assert.Contains(t, body, "id: 9\nevent: new_mail\ndata: {")
+	assert.NotContains(t, body, "id: 3\n", "不推送其他用户的事件")
+	assert.Less(t, strings.Index(body, "id: 2\n"), strings.Index(body, "id: 9\n"))
+	assert.Contains(t, body, ": ping\n\n")
+	assert.Zero(t, mailwatch.DefaultHub.Subscribers(ownerID), "断开后取消订阅")
+}
+
+func TestHandleGraphMailNotification(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	require.NoError(t, db.Create(&models.MailWatch{UserID: 1, EmailAccountID: 1, Method: models.MailWatchMethodGraphDelta, SubscriptionID: "sub-1", ClientState: "secret"}).Error)
+
+	req := httptest.NewRequest("POST", "/api/v1/webhooks/graph/mail?validationToken=abc%20123", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "abc 123", w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+
+	req = httptest.NewRequest("POST", "/api/v1/webhooks/graph/mail", strings.NewReader(`{"value":[{"subscriptionId":"sub-1","clientState":"secret"},{"subscriptionId":"sub-1","clientState":"forged"}]}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	req = httptest.NewRequest("POST", "/api/v1/webhooks/graph/mail", strings.NewReader(`not json`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
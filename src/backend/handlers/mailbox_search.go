@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"email_server/integrations"
+	"email_server/mailquery"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// mailboxSearchDefaultPageSize 邮箱搜索默认每页数量
+const mailboxSearchDefaultPageSize = 20
+
+// mailboxSearchCursor 邮箱搜索的不透明游标，绑定账户、文件夹、查询和每页数量，Token 为服务商的翻页标记
+type mailboxSearchCursor struct {
+	AccountID uint   `json:"a"`
+	Folder    string `json:"f"`
+	Query     string `json:"q"`
+	PageSize  int    `json:"s"`
+	Token     string `json:"t"`
+}
+
+func encodeMailboxSearchCursor(cursor mailboxSearchCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeMailboxSearchCursor(s string) (mailboxSearchCursor, bool) {
+	var cursor mailboxSearchCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &cursor) != nil {
+		return cursor, false
+	}
+	if cursor.AccountID == 0 || cursor.Token == "" || cursor.PageSize < 1 || cursor.PageSize > inboxMaxPageSize {
+		return cursor, false
+	}
+	return cursor, true
+}
+
+// searchMailbox 按账户类型把查询转换为 Gmail q、Graph $search/$filter 或 IMAP SEARCH，测试中可替换
+var searchMailbox = func(emailAccount models.EmailAccount, query mailquery.Query, folder, pageToken string, pageSize int) ([]models.Email, string, error) {
+	provider, err := accountMailProvider(emailAccount)
+	if err != nil {
+		return nil, "", err
+	}
+	switch provider {
+	case "microsoft":
+		return integrations.SearchGraphMessages(emailAccount, query, folder, pageToken, pageSize)
+	case "google":
+		return integrations.SearchGmailMessages(emailAccount, query, convertFolderToGmailLabel(folder), pageToken, pageSize)
+	}
+	if emailAccount.IMAPServer == "" || emailAccount.IMAPPort == 0 {
+		return nil, "", errIMAPNotConfigured
+	}
+	return integrations.SearchIMAPMessages(emailAccount, query, folder, pageToken, pageSize)
+}
+
+// SearchMailbox 在邮箱账户的文件夹中搜索邮件
+// @Summary 邮箱搜索
+// @Description 在服务商侧搜索，不依赖本地缓存。q 支持 from:、to:、subject:、has:attachment、is:unread、is:read、
+// @Description before:、after:（日期格式 2006-01-02）和自由文本，值中有空格时用双引号括起来。翻页时把 nextCursor 作为 cursor 参数
+// @Tags Inbox
+// @Produce json
+// @Security BearerAuth
+// @Param account_id query int true "邮箱账户ID"
+// @Param q query string true "查询"
+// @Param folder query string false "文件夹，默认 inbox"
+// @Param pageSize query int false "每页数量，默认 20，最多 100"
+// @Param cursor query string false "上一页返回的 nextCursor"
+// @Success 200 {object} models.SuccessResponse "返回 emails、nextCursor、hasMore"
+// @Failure 400 {object} models.ErrorResponse "参数或查询语法错误"
+// @Failure 404 {object} models.ErrorResponse "邮箱账户不存在"
+// @Failure 410 {object} models.ErrorResponse "文件夹已重建，需要重新搜索"
+// @Router /inbox/search [get]
+func SearchMailbox(c *gin.Context) {
+	userID := uint(c.GetInt64("user_id"))
+	accountID, err := utils.StringToUint(c.Query("account_id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的账户ID")
+		return
+	}
+	rawQuery := strings.TrimSpace(c.Query("q"))
+	folder := c.DefaultQuery("folder", "inbox")
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(mailboxSearchDefaultPageSize)))
+	if pageSize < 1 {
+		pageSize = mailboxSearchDefaultPageSize
+	} else if pageSize > inboxMaxPageSize {
+		pageSize = inboxMaxPageSize
+	}
+	// cursor 优先于其他参数，保证翻页时查询条件不变
+	var pageToken string
+	if rawCursor := c.Query("cursor"); rawCursor != "" {
+		cursor, ok := decodeMailboxSearchCursor(rawCursor)
+		if !ok || cursor.AccountID != accountID {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		rawQuery, folder, pageSize, pageToken = cursor.Query, cursor.Folder, cursor.PageSize, cursor.Token
+	}
+
+	query, err := mailquery.Parse(rawQuery)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if query.Empty() {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "请输入搜索条件")
+		return
+	}
+	emailAccount, ok := findUserEmailAccount(c, accountID)
+	if !ok {
+		return
+	}
+
+	emails, nextToken, err := searchMailbox(emailAccount, query, folder, pageToken, pageSize)
+	if err != nil {
+		log.Printf("[SearchMailbox] Searching account %d failed: %v", emailAccount.ID, err)
+		switch {
+		case errors.Is(err, errIMAPNotConfigured):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "IMAP settings are not configured for this non-OAuth email account.")
+		case errors.Is(err, integrations.ErrFolderNotFound):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "找不到文件夹: "+folder)
+		case errors.Is(err, integrations.ErrIMAPUIDValidityChanged):
+			utils.SendErrorResponse(c, http.StatusGone, "邮箱文件夹已重建，请重新搜索")
+		default:
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "搜索失败")
+		}
+		return
+	}
+	if emails == nil {
+		emails = []models.Email{}
+	}
+	cacheInboxEmails(userID, emailAccount.ID, folder, emails)
+	if err := annotateEmailPlatforms(userID, emails); err != nil {
+		log.Printf("[SearchMailbox] Failed to match sender platforms: %v", err)
+	}
+	for i := range emails {
+		sanitizeEmailHTML(userID, &emails[i], false)
+	}
+
+	nextCursor := ""
+	if nextToken != "" {
+		nextCursor = encodeMailboxSearchCursor(mailboxSearchCursor{
+			AccountID: emailAccount.ID, Folder: folder, Query: rawQuery, PageSize: pageSize, Token: nextToken,
+		})
+	}
+	utils.SendSuccessResponse(c, gin.H{
+		"emails":     emails,
+		"nextCursor": nextCursor,
+		"hasMore":    nextCursor != "",
+	})
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"email_server/mailquery"
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchMailbox_ParsesQueryAndPagesWithCursor(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	owner := registerUser(t, r, "quinn", "quinn@example.com")
+	other := registerUser(t, r, "rosa", "rosa@example.com")
+	account := models.EmailAccount{UserID: uint(owner.User.ID), EmailAddress: "quinn@example.com", IMAPServer: "imap.example.com", IMAPPort: 993}
+	require.NoError(t, db.Create(&account).Error)
+
+	type call struct {
+		query    mailquery.Query
+		folder   string
+		token    string
+		pageSize int
+	}
+	var calls []call
+	original := searchMailbox
+	searchMailbox = func(emailAccount models.EmailAccount, query mailquery.Query, folder, pageToken string, pageSize int) ([]models.Email, string, error) {
+		calls = append(calls, call{query, folder, pageToken, pageSize})
+		if pageToken == "" {
+			return []models.Email{{MessageID: "m1", Subject: "Your invoice"}}, "7:40", nil
+		}
+		return []models.Email{{MessageID: "m2", Subject: "Older invoice"}}, "", nil
+	}
+	t.Cleanup(func() { searchMailbox = original })
+
+	type response struct {
+		Emails     []models.Email `json:"emails"`
+		NextCursor string         `json:"nextCursor"`
+		HasMore    bool           `json:"hasMore"`
+	}
+	search := func(token string, params url.Values) (int, response) {
+		w := doAuthJSON(r, "GET", "/api/v1/inbox/search?"+params.Encode(), token, nil)
+		var resp response
+		if w.Code == http.StatusOK {
+			decodeData(t, w, &resp)
+		}
+		return w.Code, resp
+	}
+	accountID := fmt.Sprint(account.ID)
+
+	code, _ := search(owner.Token, url.Values{"account_id": {accountID}, "q": {"  "}})
+	assert.Equal(t, http.StatusBadRequest, code, "空查询")
+	code, _ = search(owner.Token, url.Values{"account_id": {accountID}, "q": {"is:starred"}})
+	assert.Equal(t, http.StatusBadRequest, code, "不支持的条件")
+	code, _ = search(other.Token, url.Values{"account_id": {accountID}, "q": {"invoice"}})
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Empty(t, calls)
+
+	code, first := search(owner.Token, url.Values{"account_id": {accountID}, "q": {`from:billing@shop.example is:unread invoice`}, "folder": {"archive"}, "pageSize": {"5"}})
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, first.Emails, 1)
+	assert.True(t, first.HasMore)
+	require.Len(t, calls, 1)
+	assert.Equal(t, []string{"billing@shop.example"}, calls[0].query.From)
+	assert.True(t, calls[0].query.Unread)
+	assert.Equal(t, "archive", calls[0].folder)
+	assert.Equal(t, 5, calls[0].pageSize)
+
+	// 翻页时沿用游标中的查询、文件夹和每页数量
+	code, second := search(owner.Token, url.Values{"account_id": {accountID}, "q": {"ignored"}, "cursor": {first.NextCursor}})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "m2", second.Emails[0].MessageID)
+	assert.False(t, second.HasMore)
+	require.Len(t, calls, 2)
+	assert.Equal(t, calls[0].query, calls[1].query)
+	assert.Equal(t, "archive", calls[1].folder)
+	assert.Equal(t, "7:40", calls[1].token)
+
+	code, _ = search(owner.Token, url.Values{"account_id": {"999"}, "cursor": {first.NextCursor}})
+	assert.Equal(t, http.StatusBadRequest, code, "游标绑定账户")
+}
@@ -4,16 +4,14 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/oauth2"
 
@@ -47,6 +45,17 @@ func truncateString(s string, maxLen int) string {
 // LinuxDoOAuth2Login 生成LinuxDo OAuth2登录URL
 // 已更新为使用数据库存储state
 func LinuxDoOAuth2Login(c *gin.Context) {
+	startLinuxDoLogin(c, 0)
+}
+
+// startLinuxDoLogin 发起LinuxDo授权流程，userID 非0时为已登录用户绑定身份
+func startLinuxDoLogin(c *gin.Context, userID uint) {
+	cfg := config.AppConfig.OAuth2.LinuxDo
+	if cfg.ClientID == "" {
+		utils.SendErrorResponse(c, http.StatusNotFound, "该提供商不存在或未启用登录")
+		return
+	}
+
 	state, err := generateRandomState()
 	if err != nil {
 		log.Printf("生成state失败: %v", err)
@@ -59,6 +68,8 @@ func LinuxDoOAuth2Login(c *gin.Context) {
 	// 创建并保存 state 到数据库
 	oauthState := models.OAuth2State{
 		State:     state,
+		UserID:    userID,
+		Provider:  identityProviderLinuxDo,
 		ExpiresAt: expiresAt,
 	}
 	if err := database.DB.Create(&oauthState).Error; err != nil {
@@ -70,9 +81,9 @@ func LinuxDoOAuth2Login(c *gin.Context) {
 	log.Printf("创建并保存LinuxDo OAuth2 state到数据库: %s, 过期时间: %v", state, expiresAt)
 
 	authURL := fmt.Sprintf("%s?client_id=%s&redirect_uri=%s&response_type=code&state=%s&scope=read",
-		config.AppConfig.OAuth2.LinuxDo.AuthURL,
-		config.AppConfig.OAuth2.LinuxDo.ClientID,
-		url.QueryEscape(config.AppConfig.OAuth2.LinuxDo.RedirectURI),
+		cfg.AuthURL,
+		cfg.ClientID,
+		url.QueryEscape(cfg.RedirectURI),
 		state,
 	)
 
@@ -99,228 +110,100 @@ func LinuxDoOAuth2Callback(c *gin.Context) {
 	if err := tx.Where("state = ?", state).First(&stateInfo).Error; err != nil {
 		tx.Rollback()
 		log.Printf("State验证失败: state=%s 在数据库中不存在或查询出错: %v", state, err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=invalid_state")
+		redirectLoginError(c, "invalid_state")
 		return
 	}
 	if err := tx.Delete(&stateInfo).Error; err != nil {
 		tx.Rollback()
 		log.Printf("从数据库删除 state 失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=internal_error")
+		redirectLoginError(c, "internal_error")
 		return
 	}
 	if err := tx.Commit().Error; err != nil {
 		log.Printf("提交 state 删除事务失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=internal_error")
+		redirectLoginError(c, "internal_error")
 		return
 	}
 
 	if time.Now().After(stateInfo.ExpiresAt) {
 		log.Printf("State验证失败: state=%s 已过期", state)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=state_expired")
+		redirectIdentityError(c, &stateInfo, "state_expired")
+		return
+	}
+	if stateInfo.Provider != "" && stateInfo.Provider != identityProviderLinuxDo {
+		log.Printf("State验证失败: state=%s 属于提供商 %s", state, stateInfo.Provider)
+		redirectIdentityError(c, &stateInfo, "invalid_state")
 		return
 	}
 
 	log.Printf("State验证成功: %s", state)
 
-	accessToken, err := exchangeCodeForToken(code)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
+	defer cancel()
+
+	conf := linuxDoOAuth2Config()
+	token, err := conf.Exchange(ctx, code)
 	if err != nil {
 		log.Printf("获取访问令牌失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=token_exchange_failed")
+		redirectIdentityError(c, &stateInfo, "token_exchange_failed")
 		return
 	}
 
-	userInfo, err := getLinuxDoUserInfo(accessToken)
-	if err != nil {
+	var claims map[string]interface{}
+	if err := fetchUserInfo(ctx, conf.Client(ctx, token), config.AppConfig.OAuth2.LinuxDo.UserInfoURL, &claims); err != nil {
 		log.Printf("获取用户信息失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=user_info_failed")
-		return
-	}
-
-	user, err := findOrCreateLinuxDoUser(userInfo)
-	if err != nil {
-		log.Printf("创建用户失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=user_creation_failed")
+		redirectIdentityError(c, &stateInfo, "user_info_failed")
 		return
 	}
+	identity := identityFromClaims(claims)
+	// LinuxDo 以数字 id 标识用户
+	identity.Subject = claimString(claims, "id")
 
-	if !user.IsStatusActive() {
-		log.Printf("用户账户已被封禁: user_id=%d, username=%s", user.ID, user.Username)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=account_banned")
-		return
-	}
-
-	now := time.Now()
-	if err := database.DB.Model(user).Update("last_login", now).Error; err != nil {
-		log.Printf("更新最后登录时间失败: %v", err)
-	}
-
-	token, err := utils.GenerateToken(int64(user.ID), user.Username, user.Role)
-	if err != nil {
-		log.Printf("生成token失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=token_generation_failed")
-		return
-	}
-
-	log.Printf("LinuxDo OAuth2登录成功: user_id=%d, username=%s", user.ID, user.Username)
-
-	frontendURL := config.AppConfig.Frontend.BaseURL
-	if frontendURL == "" {
-		frontendURL = "http://localhost:8080"
-	}
-	redirectURL := fmt.Sprintf("%s/oauth2/callback?token=%s&expires_in=%d", frontendURL, token, config.AppConfig.JWT.ExpiresIn)
-	c.Redirect(302, redirectURL)
+	completeOAuthIdentity(c, &stateInfo, identityProviderLinuxDo, identity)
 }
 
 // --- LinuxDo 辅助函数 ---
 
-func exchangeCodeForToken(code string) (string, error) {
-	data := url.Values{}
-	data.Set("grant_type", "authorization_code")
-	data.Set("client_id", config.AppConfig.OAuth2.LinuxDo.ClientID)
-	data.Set("client_secret", config.AppConfig.OAuth2.LinuxDo.ClientSecret)
-	data.Set("code", code)
-	data.Set("redirect_uri", config.AppConfig.OAuth2.LinuxDo.RedirectURI)
-
-	req, err := http.NewRequest("POST", config.AppConfig.OAuth2.LinuxDo.TokenURL, strings.NewReader(data.Encode()))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := (&http.Client{}).Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-	var tokenResponse struct {
-		AccessToken string `json:"access_token"`
-	}
-	if err := json.Unmarshal(body, &tokenResponse); err != nil {
-		return "", err
-	}
-	return tokenResponse.AccessToken, nil
-}
-
-func getLinuxDoUserInfo(accessToken string) (*models.LinuxDoUserInfo, error) {
-	req, err := http.NewRequest("GET", config.AppConfig.OAuth2.LinuxDo.UserInfoURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := (&http.Client{}).Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("user info request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-	var userInfo models.LinuxDoUserInfo
-	if err := json.Unmarshal(body, &userInfo); err != nil {
-		return nil, err
-	}
-	return &userInfo, nil
-}
-
-func findOrCreateLinuxDoUser(userInfo *models.LinuxDoUserInfo) (*models.User, error) {
-	var user models.User
-	if err := database.DB.Where("linux_do_id = ?", userInfo.ID).First(&user).Error; err == nil {
-		user.Username = userInfo.Username
-		user.Email = userInfo.Email
-		return &user, database.DB.Save(&user).Error
-	}
-
-	if err := database.DB.Where("email = ?", userInfo.Email).First(&user).Error; err == nil {
-		user.LinuxDoID = &userInfo.ID
-		provider := "linuxdo"
-		user.Provider = &provider
-		return &user, database.DB.Save(&user).Error
-	}
-
-	provider := "linuxdo"
-	user = models.User{
-		Username:  userInfo.Username,
-		Email:     userInfo.Email,
-		LinuxDoID: &userInfo.ID,
-		Provider:  &provider,
-		Role:      models.RoleUser,
-		Status:    models.StatusActive,
+// linuxDoOAuth2Config LinuxDo 要求在请求体中提交 client 凭据
+func linuxDoOAuth2Config() *oauth2.Config {
+	cfg := config.AppConfig.OAuth2.LinuxDo
+	return &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURI,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   cfg.AuthURL,
+			TokenURL:  cfg.TokenURL,
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
 	}
-	return &user, database.DB.Create(&user).Error
 }
 
-// --- Google OAuth2 流程 ---
-
-// GoogleUserInfo 定义Google OAuth2用户信息结构
-type GoogleUserInfo struct {
-	ID            string `json:"id"`
-	Email         string `json:"email"`
-	VerifiedEmail bool   `json:"verified_email"`
-	Name          string `json:"name"`
-	GivenName     string `json:"given_name"`
-	FamilyName    string `json:"family_name"`
-	Picture       string `json:"picture"`
-}
+// --- Google / Microsoft 登录流程（使用环境变量中的配置） ---
 
 // GoogleOAuth2Login 生成Google OAuth2登录URL
 func GoogleOAuth2Login(c *gin.Context) {
-	state, err := generateRandomState()
-	if err != nil {
-		log.Printf("生成state失败: %v", err)
-		utils.SendErrorResponse(c, 500, "系统错误")
-		return
-	}
+	startLegacyLogin(c, identityProviderGoogle, 0)
+}
 
-	expiresAt := time.Now().Add(10 * time.Minute)
+// MicrosoftOAuth2Login 生成Microsoft OAuth2登录URL
+func MicrosoftOAuth2Login(c *gin.Context) {
+	startLegacyLogin(c, identityProviderMicrosoft, 0)
+}
 
-	// 创建并保存 state 到数据库，AccountID设为0表示这是登录流程而非邮箱关联
-	oauthState := models.OAuth2State{
-		State:     state,
-		AccountID: 0, // 0表示登录流程
-		ExpiresAt: expiresAt,
+// startLegacyLogin 发起 Google/Microsoft 授权流程，userID 非0时为已登录用户绑定身份
+func startLegacyLogin(c *gin.Context, providerName string, userID uint) {
+	var conf *oauth2.Config
+	if providerName == identityProviderGoogle {
+		conf = googleLoginOAuth2Config()
+	} else {
+		conf = microsoftLoginOAuth2Config()
 	}
-	if err := database.DB.Create(&oauthState).Error; err != nil {
-		log.Printf("保存OAuth2 state到数据库失败: %v", err)
-		utils.SendErrorResponse(c, http.StatusInternalServerError, "无法启动OAuth2流程")
+	if conf.ClientID == "" {
+		utils.SendErrorResponse(c, http.StatusNotFound, "该提供商不存在或未启用登录")
 		return
 	}
 
-	log.Printf("创建并保存Google OAuth2 state到数据库: %s, 过期时间: %v", state, expiresAt)
-
-	// 构建Google OAuth2授权URL，使用配置文件中的重定向URI
-	authURL := fmt.Sprintf("https://accounts.google.com/o/oauth2/v2/auth?client_id=%s&redirect_uri=%s&response_type=code&state=%s&scope=%s&access_type=offline&prompt=consent",
-		config.AppConfig.OAuth2.Google.ClientID,
-		url.QueryEscape(config.AppConfig.OAuth2.Google.RedirectURI),
-		state,
-		url.QueryEscape("openid email profile"),
-	)
-
-	utils.SendSuccessResponse(c, gin.H{
-		"auth_url": authURL,
-		"state":    state,
-	})
-}
-
-// --- Microsoft OAuth2 流程 ---
-
-// MicrosoftOAuth2Login 生成Microsoft OAuth2登录URL
-func MicrosoftOAuth2Login(c *gin.Context) {
 	state, err := generateRandomState()
 	if err != nil {
 		log.Printf("生成state失败: %v", err)
@@ -333,6 +216,7 @@ func MicrosoftOAuth2Login(c *gin.Context) {
 	// 创建并保存 state 到数据库，AccountID设为0表示这是登录流程而非邮箱关联
 	oauthState := models.OAuth2State{
 		State:     state,
+		UserID:    userID,
 		AccountID: 0, // 0表示登录流程
 		ExpiresAt: expiresAt,
 	}
@@ -342,15 +226,14 @@ func MicrosoftOAuth2Login(c *gin.Context) {
 		return
 	}
 
-	log.Printf("创建并保存Microsoft OAuth2 state到数据库: %s, 过期时间: %v", state, expiresAt)
+	log.Printf("创建并保存%s OAuth2 state到数据库: %s, 过期时间: %v", providerName, state, expiresAt)
 
-	// 构建Microsoft OAuth2授权URL
-	authURL := fmt.Sprintf("https://login.microsoftonline.com/common/oauth2/v2.0/authorize?client_id=%s&redirect_uri=%s&response_type=code&state=%s&scope=%s&response_mode=query",
-		config.AppConfig.OAuth2.Microsoft.ClientID,
-		url.QueryEscape(config.AppConfig.OAuth2.Microsoft.RedirectURI),
-		state,
-		url.QueryEscape("openid email profile User.Read"),
-	)
+	var authURL string
+	if providerName == identityProviderGoogle {
+		authURL = conf.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("prompt", "consent"))
+	} else {
+		authURL = conf.AuthCodeURL(state, oauth2.SetAuthURLParam("response_mode", "query"))
+	}
 
 	utils.SendSuccessResponse(c, gin.H{
 		"auth_url": authURL,
@@ -358,274 +241,34 @@ func MicrosoftOAuth2Login(c *gin.Context) {
 	})
 }
 
-// --- Google 辅助函数 ---
-
-func exchangeGoogleCodeForToken(code string) (string, error) {
-	data := url.Values{}
-	data.Set("grant_type", "authorization_code")
-	data.Set("client_id", config.AppConfig.OAuth2.Google.ClientID)
-	data.Set("client_secret", config.AppConfig.OAuth2.Google.ClientSecret)
-	data.Set("code", code)
-	data.Set("redirect_uri", config.AppConfig.OAuth2.Google.RedirectURI)
-
-	req, err := http.NewRequest("POST", "https://oauth2.googleapis.com/token", strings.NewReader(data.Encode()))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := (&http.Client{}).Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-	var tokenResponse struct {
-		AccessToken string `json:"access_token"`
-	}
-	if err := json.Unmarshal(body, &tokenResponse); err != nil {
-		return "", err
-	}
-	return tokenResponse.AccessToken, nil
-}
-
-func getGoogleUserInfo(accessToken string) (*GoogleUserInfo, error) {
-	req, err := http.NewRequest("GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := (&http.Client{}).Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("user info request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-	var userInfo GoogleUserInfo
-	if err := json.Unmarshal(body, &userInfo); err != nil {
-		return nil, err
-	}
-	return &userInfo, nil
-}
-
-func findOrCreateGoogleUser(userInfo *GoogleUserInfo) (*models.User, error) {
-	var user models.User
-
-	// 首先尝试通过Google ID查找现有用户
-	if err := database.DB.Where("google_id = ?", userInfo.ID).First(&user).Error; err == nil {
-		// 用户已存在，更新用户信息
-		user.Username = userInfo.Name
-		user.Email = userInfo.Email
-		return &user, database.DB.Save(&user).Error
-	}
-
-	// 尝试通过邮箱查找现有用户
-	if err := database.DB.Where("email = ?", userInfo.Email).First(&user).Error; err == nil {
-		// 用户已存在，关联Google ID
-		user.GoogleID = &userInfo.ID
-		provider := "google"
-		user.Provider = &provider
-		return &user, database.DB.Save(&user).Error
-	}
-
-	// 创建新用户
-	provider := "google"
-	// 从邮箱地址生成用户名（取@前面的部分），如果Name为空的话
-	username := userInfo.Name
-	if username == "" {
-		username = userInfo.Email
-		if atIndex := strings.Index(userInfo.Email, "@"); atIndex > 0 {
-			username = userInfo.Email[:atIndex]
-		}
-	}
-
-	user = models.User{
-		Username: username,
-		Email:    userInfo.Email,
-		GoogleID: &userInfo.ID,
-		Provider: &provider,
-		Role:     models.RoleUser,
-		Status:   models.StatusActive,
-	}
-	return &user, database.DB.Create(&user).Error
-}
-
-// --- Microsoft 辅助函数 ---
-
-func exchangeMicrosoftCodeForToken(code string) (string, error) {
-	data := url.Values{}
-	data.Set("client_id", config.AppConfig.OAuth2.Microsoft.ClientID)
-	data.Set("client_secret", config.AppConfig.OAuth2.Microsoft.ClientSecret)
-	data.Set("code", code)
-	data.Set("grant_type", "authorization_code")
-	data.Set("redirect_uri", config.AppConfig.OAuth2.Microsoft.RedirectURI)
-	data.Set("scope", "openid email profile User.Read")
-
-	req, err := http.NewRequest("POST", "https://login.microsoftonline.com/common/oauth2/v2.0/token", strings.NewReader(data.Encode()))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := (&http.Client{}).Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var tokenResponse struct {
-		AccessToken string `json:"access_token"`
-		TokenType   string `json:"token_type"`
-		ExpiresIn   int    `json:"expires_in"`
-	}
-	if err := json.Unmarshal(body, &tokenResponse); err != nil {
-		return "", err
-	}
-	return tokenResponse.AccessToken, nil
-}
-
-func getMicrosoftUserInfo(accessToken string) (*models.MicrosoftUserInfo, error) {
-	req, err := http.NewRequest("GET", "https://graph.microsoft.com/v1.0/me", nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := (&http.Client{}).Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("user info request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-	var userInfo models.MicrosoftUserInfo
-	if err := json.Unmarshal(body, &userInfo); err != nil {
-		return nil, err
-	}
-	return &userInfo, nil
-}
-
-func findOrCreateMicrosoftUser(userInfo *models.MicrosoftUserInfo) (*models.User, error) {
-	var user models.User
-
-	// 首先尝试通过Microsoft ID查找现有用户
-	if err := database.DB.Where("microsoft_id = ?", userInfo.ID).First(&user).Error; err == nil {
-		// 用户已存在，更新用户信息
-		user.Username = userInfo.DisplayName
-		// 优先使用Mail字段，如果为空则使用UserPrincipalName
-		email := userInfo.Mail
-		if email == "" {
-			email = userInfo.UserPrincipalName
-		}
-		user.Email = email
-		return &user, database.DB.Save(&user).Error
-	}
-
-	// 尝试通过邮箱查找现有用户
-	email := userInfo.Mail
-	if email == "" {
-		email = userInfo.UserPrincipalName
-	}
-	if err := database.DB.Where("email = ?", email).First(&user).Error; err == nil {
-		// 用户已存在，关联Microsoft ID
-		user.MicrosoftID = &userInfo.ID
-		provider := "microsoft"
-		user.Provider = &provider
-		return &user, database.DB.Save(&user).Error
-	}
-
-	// 创建新用户
-	provider := "microsoft"
-	// 从邮箱地址生成用户名（取@前面的部分），如果DisplayName为空的话
-	username := userInfo.DisplayName
-	if username == "" {
-		username = email
-		if atIndex := strings.Index(email, "@"); atIndex > 0 {
-			username = email[:atIndex]
-		}
-	}
-
-	user = models.User{
-		Username:    username,
-		Email:       email,
-		MicrosoftID: &userInfo.ID,
-		Provider:    &provider,
-		Role:        models.RoleUser,
-		Status:      models.StatusActive,
+func googleLoginOAuth2Config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     config.AppConfig.OAuth2.Google.ClientID,
+		ClientSecret: config.AppConfig.OAuth2.Google.ClientSecret,
+		RedirectURL:  config.AppConfig.OAuth2.Google.RedirectURI,
+		Scopes:       []string{"openid", "email", "profile"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  "https://accounts.google.com/o/oauth2/v2/auth",
+			TokenURL: "https://oauth2.googleapis.com/token",
+		},
 	}
-	return &user, database.DB.Create(&user).Error
 }
 
-// --- 通用 OAuth2 提供商流程 (Microsoft, Google, etc.) ---
-
-// getOAuth2Config 从数据库动态构建 oauth2.Config
-func getOAuth2Config(providerName string) (*oauth2.Config, error) {
-	var provider models.OAuthProvider
-	if err := database.DB.Where("name = ?", providerName).First(&provider).Error; err != nil {
-		return nil, fmt.Errorf("provider '%s' not found in database", providerName)
-	}
-
-	decryptedSecret, err := utils.Decrypt(provider.ClientSecretEncrypted)
-	if err != nil {
-		return nil, fmt.Errorf("could not decrypt client secret for provider '%s'", providerName)
-	}
-
-	baseURL := config.AppConfig.Backend.BaseURL
-	if baseURL == "" {
-		baseURL = "http://localhost:5555"
-	}
-	redirectURL := fmt.Sprintf("%s/api/v1/oauth2/callback/%s", baseURL, provider.Name)
-
-	log.Printf("[DEBUG] Preparing OAuth2 config for provider '%s'", providerName)
-	log.Printf("[DEBUG]   -> ClientID: %s", provider.ClientID)
-	log.Printf("[DEBUG]   -> ClientSecret (decrypted): %s", string(decryptedSecret))
-	log.Printf("[DEBUG]   -> RedirectURL: %s", redirectURL)
-
+func microsoftLoginOAuth2Config() *oauth2.Config {
 	return &oauth2.Config{
-		ClientID:     provider.ClientID,
-		ClientSecret: string(decryptedSecret),
-		RedirectURL:  redirectURL,
-		Scopes:       strings.Split(provider.Scopes, ","),
+		ClientID:     config.AppConfig.OAuth2.Microsoft.ClientID,
+		ClientSecret: config.AppConfig.OAuth2.Microsoft.ClientSecret,
+		RedirectURL:  config.AppConfig.OAuth2.Microsoft.RedirectURI,
+		Scopes:       []string{"openid", "email", "profile", "User.Read"},
 		Endpoint: oauth2.Endpoint{
-			AuthURL:  provider.AuthURL,
-			TokenURL: provider.TokenURL,
+			AuthURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+			TokenURL: "https://login.microsoftonline.com/common/oauth2/v2.0/token",
 		},
-	}, nil
+	}
 }
 
+// --- 通用 OAuth2 提供商流程 (Microsoft, Google, etc.) ---
+
 // RedirectToOAuthProvider 将用户重定向到所选提供商的授权页面
 func RedirectToOAuthProvider(c *gin.Context) {
 	providerName := c.Param("provider")
@@ -648,7 +291,12 @@ func RedirectToOAuthProvider(c *gin.Context) {
 		return
 	}
 
-	conf, err := getOAuth2Config(providerName)
+	provider, err := loadOAuthProvider(providerName)
+	if err != nil || !provider.MailboxEnabled {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Unsupported or misconfigured OAuth2 provider")
+		return
+	}
+	conf, err := oauth2ConfigFor(provider)
 	if err != nil {
 		log.Printf("Error getting OAuth2 config for %s: %v", providerName, err)
 		utils.SendErrorResponse(c, http.StatusBadRequest, "Unsupported or misconfigured OAuth2 provider")
@@ -676,9 +324,16 @@ func RedirectToOAuthProvider(c *gin.Context) {
 		State:        state,
 		UserID:       uint(userID.(int64)), // 保存发起OAuth2流程的用户ID，转换int64到uint
 		AccountID:    accountID,
+		Provider:     provider.Name,
 		PKCEVerifier: pkceVerifier.Value,
 		ExpiresAt:    expiresAt,
 	}
+	if provider.Type == models.OAuthProviderTypeOIDC {
+		if oauthState.Nonce, err = generateRandomState(); err != nil {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "无法启动OAuth2流程")
+			return
+		}
+	}
 	if err := database.DB.Create(&oauthState).Error; err != nil {
 		log.Printf("保存OAuth2 state到数据库失败: %v", err)
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "无法启动OAuth2流程")
@@ -704,12 +359,16 @@ func RedirectToOAuthProvider(c *gin.Context) {
 			oauth2.SetAuthURLParam("prompt", "consent"),
 		)
 	} else {
-		authURL = conf.AuthCodeURL(state,
+		opts := []oauth2.AuthCodeOption{
 			oauth2.AccessTypeOffline,
 			oauth2.ApprovalForce,
 			oauth2.SetAuthURLParam("code_challenge", pkceVerifier.CodeChallengeS256()),
 			oauth2.SetAuthURLParam("code_challenge_method", "S256"),
-		)
+		}
+		if oauthState.Nonce != "" {
+			opts = append(opts, oidc.Nonce(oauthState.Nonce))
+		}
+		authURL = conf.AuthCodeURL(state, opts...)
 	}
 
 	log.Printf("[DEBUG] 生成的授权URL: %s", authURL)
@@ -766,14 +425,22 @@ func HandleOAuth2Callback(c *gin.Context) {
 	}
 	log.Printf("[DEBUG] State从数据库验证成功: %s", state)
 
+	if stateInfo.Provider != "" && stateInfo.Provider != provider {
+		log.Printf("State验证失败: state=%s 属于提供商 %s，回调来自 %s", state, stateInfo.Provider, provider)
+		c.Redirect(http.StatusTemporaryRedirect, "/?error=invalid_state")
+		return
+	}
+
 	// 检查是否为登录流程（AccountID为0）
 	if stateInfo.AccountID == 0 {
-		// 这是登录流程，使用简化的token交换流程
-		if provider == "google" {
-			handleGoogleLoginCallback(c, code, state)
+		if stateInfo.Provider != "" {
+			// 管理员配置的提供商登录/绑定流程
+			handleProviderLoginCallback(c, provider, code, &stateInfo)
 			return
-		} else if provider == "microsoft" {
-			handleMicrosoftLoginCallback(c, code, state)
+		}
+		// 旧的 Google/Microsoft 登录/绑定流程，使用环境变量中的配置
+		if provider == identityProviderGoogle || provider == identityProviderMicrosoft {
+			handleLegacyLoginCallback(c, provider, code, &stateInfo)
 			return
 		} else {
 			log.Printf("不支持的登录provider: %s", provider)
@@ -783,7 +450,13 @@ func HandleOAuth2Callback(c *gin.Context) {
 	}
 
 	// 2. 准备交换token（邮箱关联流程）
-	conf, err := getOAuth2Config(provider)
+	oauthProvider, err := loadOAuthProvider(provider)
+	if err != nil || !oauthProvider.MailboxEnabled {
+		log.Printf("Error loading OAuth2 provider %s: %v", provider, err)
+		c.Redirect(http.StatusTemporaryRedirect, "/?error=provider_not_configured")
+		return
+	}
+	conf, err := oauth2ConfigFor(oauthProvider)
 	if err != nil {
 		log.Printf("Error getting OAuth2 config for %s: %v", provider, err)
 		c.Redirect(http.StatusTemporaryRedirect, "/?error=provider_not_configured")
@@ -801,10 +474,6 @@ func HandleOAuth2Callback(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
 	defer cancel()
 
-	// (可选) 调试代码
-	httpClient := &http.Client{Transport: &loggingTransport{T: http.DefaultTransport}}
-	debugCtx := context.WithValue(ctx, oauth2.HTTPClient, httpClient)
-
 	opts := []oauth2.AuthCodeOption{
 		oauth2.SetAuthURLParam("code_verifier", pkceVerifier),
 	}
@@ -815,7 +484,7 @@ func HandleOAuth2Callback(c *gin.Context) {
 	}
 
 	log.Printf("[DEBUG] Calling conf.Exchange with all required parameters...")
-	token, err := conf.Exchange(debugCtx, code, opts...) // 使用 debugCtx
+	token, err := conf.Exchange(ctx, code, opts...)
 	if err != nil {
 		log.Printf("用code交换token失败: %v", err)
 		c.Redirect(http.StatusTemporaryRedirect, "/?error=token_exchange_failed&details="+url.QueryEscape(err.Error()))
@@ -827,53 +496,13 @@ func HandleOAuth2Callback(c *gin.Context) {
 	log.Printf("[DEBUG] Token交换成功, Expiry: %v", token.Expiry)
 
 	// 3. 获取用户信息
-	client := conf.Client(ctx, token) // 这里用回原始的ctx即可
-	var userInfoURL string
-	switch provider {
-	case "google":
-		userInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
-	case "microsoft":
-		userInfoURL = "https://graph.microsoft.com/v1.0/me"
-	default:
-		c.Redirect(http.StatusTemporaryRedirect, "/?error=unsupported_provider")
-		return
-	}
-
-	// ... 后续代码完全不变 ...
-	resp, err := client.Get(userInfoURL)
+	identity, err := fetchOAuthIdentity(ctx, oauthProvider, conf, token, stateInfo.Nonce)
 	if err != nil {
 		log.Printf("获取用户信息失败: %v", err)
 		c.Redirect(http.StatusTemporaryRedirect, "/?error=user_info_failed")
 		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("获取用户信息失败: status=%d, body=%s", resp.StatusCode, string(bodyBytes))
-		c.Redirect(http.StatusTemporaryRedirect, "/?error=user_info_failed")
-		return
-	}
-
-	var userInfo struct {
-		Email             string `json:"email"`
-		UserPrincipalName string `json:"userPrincipalName,omitempty"`
-		Mail              string `json:"mail,omitempty"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		log.Printf("解析用户信息失败: %v", err)
-		c.Redirect(http.StatusTemporaryRedirect, "/?error=user_info_parsing_failed")
-		return
-	}
-
-	email := userInfo.Email
-	if provider == "microsoft" && email == "" {
-		if userInfo.Mail != "" {
-			email = userInfo.Mail
-		} else {
-			email = userInfo.UserPrincipalName
-		}
-	}
+	email := identity.Email
 	if email == "" {
 		log.Printf("无法从provider获取邮箱信息")
 		c.Redirect(http.StatusTemporaryRedirect, "/?error=email_not_provided")
@@ -888,11 +517,6 @@ func HandleOAuth2Callback(c *gin.Context) {
 		c.Redirect(http.StatusTemporaryRedirect, "/?error=user_not_found")
 		return
 	}
-	var oauthProvider models.OAuthProvider
-	if err := database.DB.Where("name = ?", provider).First(&oauthProvider).Error; err != nil {
-		c.Redirect(http.StatusTemporaryRedirect, "/?error=provider_not_configured")
-		return
-	}
 	var emailAccount models.EmailAccount
 	if err := database.DB.Where("id = ? AND user_id = ?", stateInfo.AccountID, user.ID).First(&emailAccount).Error; err != nil {
 		c.Redirect(http.StatusTemporaryRedirect, "/?error=email_account_not_found")
@@ -944,16 +568,7 @@ func HandleOAuth2Callback(c *gin.Context) {
 	}
 
 	// 构建成功消息
-	var providerName string
-	switch provider {
-	case "google":
-		providerName = "Google"
-	case "microsoft":
-		providerName = "Microsoft"
-	default:
-		providerName = provider
-	}
-	message := fmt.Sprintf("%s账户关联成功！", providerName)
+	message := fmt.Sprintf("%s账户关联成功！", oauthProvider.DisplayName)
 
 	redirectURL := fmt.Sprintf("%s/email-accounts?status=success&provider=%s&message=%s",
 		frontendURL, provider, url.QueryEscape(message))
@@ -987,139 +602,38 @@ func GetDBStateStats(c *gin.Context) {
 	utils.SendSuccessResponse(c, stats)
 }
 
-// --- 在文件末尾添加这个辅助类型和方法，用于打印请求 ---
-type loggingTransport struct {
-	T http.RoundTripper
-}
+// handleLegacyLoginCallback 处理 Google/Microsoft 登录或身份绑定回调（不使用PKCE）
+func handleLegacyLoginCallback(c *gin.Context, providerName, code string, stateInfo *models.OAuth2State) {
+	log.Printf("处理%s登录回调: code=%s, state=%s", providerName, truncateString(code, 20), stateInfo.State)
 
-func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// 打印请求细节
-	reqDump, dumpErr := httputil.DumpRequestOut(req, true)
-	if dumpErr != nil {
-		log.Printf("Error dumping request: %v", dumpErr)
-	} else {
-		log.Printf("\n--- OAUTH2 TOKEN REQUEST ---\n%s\n--------------------------", string(reqDump))
-	}
-
-	// 执行原始请求
-	resp, roundTripErr := t.T.RoundTrip(req)
-	if roundTripErr != nil {
-		return nil, roundTripErr
-	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
+	defer cancel()
 
-	// 打印响应细节
-	respDump, dumpErr := httputil.DumpResponse(resp, true)
-	if dumpErr != nil {
-		log.Printf("Error dumping response: %v", dumpErr)
+	var conf *oauth2.Config
+	var userInfoURL string
+	var opts []oauth2.AuthCodeOption
+	if providerName == identityProviderGoogle {
+		conf = googleLoginOAuth2Config()
+		userInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
 	} else {
-		log.Printf("\n--- OAUTH2 TOKEN RESPONSE ---\n%s\n---------------------------", string(respDump))
-	}
-
-	return resp, nil
-}
-
-// handleGoogleLoginCallback 处理Google登录回调（简化版本，不需要PKCE）
-func handleGoogleLoginCallback(c *gin.Context, code, state string) {
-	log.Printf("处理Google登录回调: code=%s, state=%s", truncateString(code, 20), state)
-
-	accessToken, err := exchangeGoogleCodeForToken(code)
-	if err != nil {
-		log.Printf("获取访问令牌失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=token_exchange_failed")
-		return
-	}
-
-	userInfo, err := getGoogleUserInfo(accessToken)
-	if err != nil {
-		log.Printf("获取用户信息失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=user_info_failed")
-		return
-	}
-
-	user, err := findOrCreateGoogleUser(userInfo)
-	if err != nil {
-		log.Printf("创建用户失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=user_creation_failed")
-		return
-	}
-
-	if !user.IsStatusActive() {
-		log.Printf("用户账户已被封禁: user_id=%d, username=%s", user.ID, user.Username)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=account_banned")
-		return
-	}
-
-	now := time.Now()
-	if err := database.DB.Model(user).Update("last_login", now).Error; err != nil {
-		log.Printf("更新最后登录时间失败: %v", err)
-	}
-
-	token, err := utils.GenerateToken(int64(user.ID), user.Username, user.Role)
-	if err != nil {
-		log.Printf("生成token失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=token_generation_failed")
-		return
-	}
-
-	log.Printf("Google OAuth2登录成功: user_id=%d, username=%s", user.ID, user.Username)
-
-	frontendURL := config.AppConfig.Frontend.BaseURL
-	if frontendURL == "" {
-		frontendURL = "http://localhost:8080"
+		conf = microsoftLoginOAuth2Config()
+		userInfoURL = "https://graph.microsoft.com/v1.0/me"
+		opts = append(opts, oauth2.SetAuthURLParam("scope", strings.Join(conf.Scopes, " ")))
 	}
-	redirectURL := fmt.Sprintf("%s/oauth2/callback?token=%s&expires_in=%d", frontendURL, token, config.AppConfig.JWT.ExpiresIn)
-	c.Redirect(302, redirectURL)
-}
-
-// handleMicrosoftLoginCallback 处理Microsoft登录回调
-func handleMicrosoftLoginCallback(c *gin.Context, code, state string) {
-	log.Printf("处理Microsoft登录回调: code=%s, state=%s", truncateString(code, 20), state)
 
-	accessToken, err := exchangeMicrosoftCodeForToken(code)
+	token, err := conf.Exchange(ctx, code, opts...)
 	if err != nil {
 		log.Printf("获取访问令牌失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=token_exchange_failed")
+		redirectIdentityError(c, stateInfo, "token_exchange_failed")
 		return
 	}
 
-	userInfo, err := getMicrosoftUserInfo(accessToken)
-	if err != nil {
+	var claims map[string]interface{}
+	if err := fetchUserInfo(ctx, conf.Client(ctx, token), userInfoURL, &claims); err != nil {
 		log.Printf("获取用户信息失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=user_info_failed")
-		return
-	}
-
-	user, err := findOrCreateMicrosoftUser(userInfo)
-	if err != nil {
-		log.Printf("创建用户失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=user_creation_failed")
+		redirectIdentityError(c, stateInfo, "user_info_failed")
 		return
 	}
 
-	if !user.IsStatusActive() {
-		log.Printf("用户账户已被封禁: user_id=%d, username=%s", user.ID, user.Username)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=account_banned")
-		return
-	}
-
-	now := time.Now()
-	if err := database.DB.Model(user).Update("last_login", now).Error; err != nil {
-		log.Printf("更新最后登录时间失败: %v", err)
-	}
-
-	token, err := utils.GenerateToken(int64(user.ID), user.Username, user.Role)
-	if err != nil {
-		log.Printf("生成token失败: %v", err)
-		c.Redirect(302, "http://localhost:8080/auth/login?error=token_generation_failed")
-		return
-	}
-
-	log.Printf("Microsoft OAuth2登录成功: user_id=%d, username=%s", user.ID, user.Username)
-
-	frontendURL := config.AppConfig.Frontend.BaseURL
-	if frontendURL == "" {
-		frontendURL = "http://localhost:8080"
-	}
-	redirectURL := fmt.Sprintf("%s/oauth2/callback?token=%s&expires_in=%d", frontendURL, token, config.AppConfig.JWT.ExpiresIn)
-	c.Redirect(302, redirectURL)
+	completeOAuthIdentity(c, stateInfo, providerName, identityFromClaims(claims))
 }
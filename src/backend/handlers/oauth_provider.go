@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// 提供商名称会出现在回调地址中，只允许小写字母、数字、-、_
+var oauthProviderNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// oauthProviderInput 创建/更新提供商的请求体，更新时未提供的字段保持不变
+type oauthProviderInput struct {
+	Name           *string   `json:"name"`
+	DisplayName    *string   `json:"display_name"`
+	Type           *string   `json:"type"`
+	IssuerURL      *string   `json:"issuer_url"`
+	ClientID       *string   `json:"client_id"`
+	ClientSecret   *string   `json:"client_secret"` // 提供非空值即轮换密钥
+	AuthURL        *string   `json:"auth_url"`
+	TokenURL       *string   `json:"token_url"`
+	UserInfoURL    *string   `json:"user_info_url"`
+	Scopes         *[]string `json:"scopes"`
+	IMAPServer     *string   `json:"imap_server"`
+	IMAPPort       *int      `json:"imap_port"`
+	SMTPServer     *string   `json:"smtp_server"`
+	SMTPPort       *int      `json:"smtp_port"`
+	Enabled        *bool     `json:"enabled"`
+	LoginEnabled   *bool     `json:"login_enabled"`
+	MailboxEnabled *bool     `json:"mailbox_enabled"`
+}
+
+// apply 将请求中提供的字段写入提供商，返回是否更换了 client secret
+func (in *oauthProviderInput) apply(p *models.OAuthProvider) (bool, error) {
+	setString := func(dst *string, src *string) {
+		if src != nil {
+			*dst = strings.TrimSpace(*src)
+		}
+	}
+	setString(&p.DisplayName, in.DisplayName)
+	setString(&p.Type, in.Type)
+	setString(&p.IssuerURL, in.IssuerURL)
+	setString(&p.ClientID, in.ClientID)
+	setString(&p.AuthURL, in.AuthURL)
+	setString(&p.TokenURL, in.TokenURL)
+	setString(&p.UserInfoURL, in.UserInfoURL)
+	setString(&p.IMAPServer, in.IMAPServer)
+	setString(&p.SMTPServer, in.SMTPServer)
+	if in.Scopes != nil {
+		p.Scopes = strings.Join(*in.Scopes, ",")
+	}
+	if in.IMAPPort != nil {
+		p.IMAPPort = *in.IMAPPort
+	}
+	if in.SMTPPort != nil {
+		p.SMTPPort = *in.SMTPPort
+	}
+	if in.Enabled != nil {
+		p.Enabled = *in.Enabled
+	}
+	if in.LoginEnabled != nil {
+		p.LoginEnabled = *in.LoginEnabled
+	}
+	if in.MailboxEnabled != nil {
+		p.MailboxEnabled = *in.MailboxEnabled
+	}
+
+	rotated := false
+	if in.ClientSecret != nil && *in.ClientSecret != "" {
+		encrypted, err := utils.Encrypt([]byte(*in.ClientSecret))
+		if err != nil {
+			return false, err
+		}
+		p.ClientSecretEncrypted = encrypted
+		rotated = true
+	}
+	return rotated, nil
+}
+
+// validateOAuthProvider 校验提供商配置；OIDC 类型通过 discovery 获取端点
+func validateOAuthProvider(ctx context.Context, p *models.OAuthProvider) string {
+	if p.DisplayName == "" {
+		p.DisplayName = p.Name
+	}
+	if p.ClientID == "" || p.ClientSecretEncrypted == "" {
+		return "client_id 和 client_secret 不能为空"
+	}
+	if !p.LoginEnabled && !p.MailboxEnabled {
+		return "login_enabled 和 mailbox_enabled 至少需要开启一个"
+	}
+	if p.MailboxEnabled && (p.IMAPServer == "" || p.IMAPPort <= 0) {
+		return "用于关联邮箱的提供商必须配置 IMAP 服务器和端口"
+	}
+
+	switch p.Type {
+	case models.OAuthProviderTypeOIDC:
+		if p.IssuerURL == "" {
+			return "OIDC 提供商必须配置 issuer_url"
+		}
+		if err := applyOIDCDiscovery(ctx, p); err != nil {
+			log.Printf("OIDC discovery 失败 (%s): %v", p.IssuerURL, err)
+			return "OIDC discovery 失败: " + err.Error()
+		}
+	case models.OAuthProviderTypeOAuth2:
+		if p.AuthURL == "" || p.TokenURL == "" {
+			return "OAuth2 提供商必须配置 auth_url 和 token_url"
+		}
+		if p.LoginEnabled && p.UserInfoURL == "" {
+			return "用于登录的 OAuth2 提供商必须配置 user_info_url"
+		}
+	default:
+		return "无效的提供商类型，可选值: oauth2, oidc"
+	}
+	return ""
+}
+
+// findOAuthProviderByParam 按路径参数 id 查找提供商，失败时已写入错误响应
+func findOAuthProviderByParam(c *gin.Context) (*models.OAuthProvider, bool) {
+	id, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的ID格式")
+		return nil, false
+	}
+	var provider models.OAuthProvider
+	if err := database.DB.First(&provider, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendErrorResponse(c, http.StatusNotFound, "OAuth提供商不存在")
+		} else {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "查询OAuth提供商失败")
+		}
+		return nil, false
+	}
+	return &provider, true
+}
+
+// GetOAuthProviders 获取所有OAuth提供商（管理员功能）
+// @Summary 获取OAuth提供商列表
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse{data=[]models.OAuthProviderResponse} "获取成功"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 403 {object} models.ErrorResponse "需要管理员权限"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /admin/oauth-providers [get]
+func GetOAuthProviders(c *gin.Context) {
+	var providers []models.OAuthProvider
+	if err := database.DB.Order("id").Find(&providers).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询OAuth提供商失败")
+		return
+	}
+	responses := make([]models.OAuthProviderResponse, 0, len(providers))
+	for i := range providers {
+		responses = append(responses, providers[i].ToResponse())
+	}
+	utils.SendSuccessResponse(c, responses)
+}
+
+// GetOAuthProvider 获取单个OAuth提供商（管理员功能）
+// @Summary 获取OAuth提供商详情
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "提供商ID"
+// @Success 200 {object} models.SuccessResponse{data=models.OAuthProviderResponse} "获取成功"
+// @Failure 400 {object} models.ErrorResponse "无效的ID格式"
+// @Failure 404 {object} models.ErrorResponse "OAuth提供商不存在"
+// @Router /admin/oauth-providers/{id} [get]
+func GetOAuthProvider(c *gin.Context) {
+	provider, ok := findOAuthProviderByParam(c)
+	if !ok {
+		return
+	}
+	utils.SendSuccessResponse(c, provider.ToResponse())
+}
+
+// CreateOAuthProvider 创建OAuth提供商（管理员功能）
+// @Summary 创建OAuth提供商
+// @Description 类型为 oidc 时根据 issuer_url 自动发现授权、令牌和用户信息端点
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param provider body oauthProviderInput true "提供商配置"
+// @Success 201 {object} models.SuccessResponse{data=models.OAuthProviderResponse} "创建成功"
+// @Failure 400 {object} models.ErrorResponse "请求参数错误"
+// @Failure 409 {object} models.ErrorResponse "名称已存在"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /admin/oauth-providers [post]
+func CreateOAuthProvider(c *gin.Context) {
+	var input oauthProviderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if input.Name == nil || !oauthProviderNamePattern.MatchString(*input.Name) {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "名称只能包含小写字母、数字、- 和 _")
+		return
+	}
+
+	// 新建提供商默认启用、可关联邮箱
+	provider := models.OAuthProvider{
+		Name:           *input.Name,
+		Type:           models.OAuthProviderTypeOAuth2,
+		Enabled:        true,
+		MailboxEnabled: true,
+	}
+	if _, err := input.apply(&provider); err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "加密Client Secret失败")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+	if msg := validateOAuthProvider(ctx, &provider); msg != "" {
+		utils.SendErrorResponse(c, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := database.DB.Create(&provider).Error; err != nil {
+		if utils.IsUniqueConstraintError(err) {
+			utils.SendErrorResponse(c, http.StatusConflict, "该名称的OAuth提供商已存在")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "创建OAuth提供商失败")
+		return
+	}
+	log.Printf("管理员创建了OAuth提供商 '%s' (%s)", provider.Name, provider.Type)
+	utils.SendCreatedResponse(c, provider.ToResponse())
+}
+
+// UpdateOAuthProvider 更新OAuth提供商（管理员功能）
+// @Summary 更新OAuth提供商
+// @Description 只更新请求中提供的字段；提供非空 client_secret 即轮换密钥。名称不可修改。
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "提供商ID"
+// @Param provider body oauthProviderInput true "提供商配置"
+// @Success 200 {object} models.SuccessResponse{data=models.OAuthProviderResponse} "更新成功"
+// @Failure 400 {object} models.ErrorResponse "请求参数错误"
+// @Failure 404 {object} models.ErrorResponse "OAuth提供商不存在"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /admin/oauth-providers/{id} [put]
+func UpdateOAuthProvider(c *gin.Context) {
+	provider, ok := findOAuthProviderByParam(c)
+	if !ok {
+		return
+	}
+
+	var input oauthProviderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if input.Name != nil && *input.Name != provider.Name {
+		// 名称是回调地址的一部分，修改后需在提供商处重新登记，因此不允许修改
+		utils.SendErrorResponse(c, http.StatusBadRequest, "提供商名称不可修改")
+		return
+	}
+
+	rotated, err := input.apply(provider)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "加密Client Secret失败")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+	if msg := validateOAuthProvider(ctx, provider); msg != "" {
+		utils.SendErrorResponse(c, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := database.DB.Save(provider).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "更新OAuth提供商失败")
+		return
+	}
+	if rotated {
+		log.Printf("管理员轮换了OAuth提供商 '%s' 的Client Secret", provider.Name)
+	}
+	utils.SendSuccessResponse(c, provider.ToResponse())
+}
+
+// DeleteOAuthProvider 删除OAuth提供商（管理员功能）
+// @Summary 删除OAuth提供商
+// @Description 仍有邮箱账户通过该提供商授权时拒绝删除，可改为停用
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "提供商ID"
+// @Success 200 {object} models.SuccessResponse "删除成功"
+// @Failure 400 {object} models.ErrorResponse "无效的ID格式"
+// @Failure 404 {object} models.ErrorResponse "OAuth提供商不存在"
+// @Failure 409 {object} models.ErrorResponse "提供商仍在使用中"
+// @Router /admin/oauth-providers/{id} [delete]
+func DeleteOAuthProvider(c *gin.Context) {
+	provider, ok := findOAuthProviderByParam(c)
+	if !ok {
+		return
+	}
+
+	var tokenCount int64
+	if err := database.DB.Model(&models.UserOAuthToken{}).Where("provider_id = ?", provider.ID).Count(&tokenCount).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询OAuth提供商使用情况失败")
+		return
+	}
+	if tokenCount > 0 {
+		utils.SendErrorResponse(c, http.StatusConflict, "仍有邮箱账户通过该提供商授权，请先解除关联或改为停用")
+		return
+	}
+
+	if err := database.DB.Delete(provider).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "删除OAuth提供商失败")
+		return
+	}
+	oidcProviders.Delete(provider.IssuerURL)
+	log.Printf("管理员删除了OAuth提供商 '%s'", provider.Name)
+	utils.SendSuccessResponse(c, gin.H{"message": "OAuth提供商已删除"})
+}
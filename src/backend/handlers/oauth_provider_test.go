@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/database/dbtest"
+	"email_server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// mockOIDCServer 本地模拟的 OpenID Connect 提供商：discovery、JWKS、令牌和用户信息端点
+type mockOIDCServer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu    sync.Mutex
+	nonce string // 下一次签发的 ID Token 中携带的 nonce
+	email string
+}
+
+func newMockOIDCServer(t *testing.T, clientID string) *mockOIDCServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	m := &mockOIDCServer{key: key, clientID: clientID, email: "carol@example.com"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/auth",
+			"token_endpoint":                        m.URL + "/token",
+			"userinfo_endpoint":                     m.URL + "/userinfo",
+			"jwks_uri":                              m.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("code") != "good-code" || r.PostForm.Get("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		m.mu.Lock()
+		claims := map[string]interface{}{
+			"iss":                m.URL,
+			"sub":                "kc-user-1",
+			"aud":                m.clientID,
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"iat":                time.Now().Unix(),
+			"nonce":              m.nonce,
+			"email":              m.email,
+			"email_verified":     true,
+			"preferred_username": "carol",
+		}
+		m.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     m.sign(t, claims),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"sub": "kc-user-1", "email": m.email})
+	})
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// sign 生成 RS256 签名的 JWT
+func (m *mockOIDCServer) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (m *mockOIDCServer) setNonce(nonce string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nonce = nonce
+}
+
+func setupOAuthProviderTestRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.Config{
+		Security: config.SecurityConfig{EncryptionKey: "0123456789abcdef0123456789abcdef"},
+		JWT:      config.JWTConfig{SecretKey: "test-secret", ExpiresIn: 24},
+		Backend:  config.BackendConfig{BaseURL: "http://backend.test"},
+		Frontend: config.FrontendConfig{BaseURL: "http://frontend.test"},
+	}
+
+	db := dbtest.Open(t)
+	database.DB = db
+
+	r := gin.New()
+	admin := func(c *gin.Context) {
+		c.Set("user_id", int64(1))
+		c.Next()
+	}
+	r.GET("/admin/oauth-providers", admin, GetOAuthProviders)
+	r.POST("/admin/oauth-providers", admin, CreateOAuthProvider)
+	r.GET("/admin/oauth-providers/:id", admin, GetOAuthProvider)
+	r.PUT("/admin/oauth-providers/:id", admin, UpdateOAuthProvider)
+	r.DELETE("/admin/oauth-providers/:id", admin, DeleteOAuthProvider)
+	r.GET("/auth/oauth2/providers", ListLoginOAuthProviders)
+	r.GET("/auth/oauth2/login/:provider", OAuth2ProviderLogin)
+	r.GET("/api/v1/oauth2/callback/:provider", HandleOAuth2Callback)
+	return r, db
+}
+
+func decodeData(t *testing.T, w *httptest.ResponseRecorder, out interface{}) {
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+	require.NoError(t, json.Unmarshal(resp.Data, out))
+}
+
+func createKeycloakProvider(t *testing.T, r *gin.Engine, issuer string) models.OAuthProviderResponse {
+	w := doJSON(r, "POST", "/admin/oauth-providers", map[string]interface{}{
+		"name":            "keycloak",
+		"display_name":    "Company SSO",
+		"type":            "oidc",
+		"issuer_url":      issuer,
+		"client_id":       "email-server",
+		"client_secret":   "s3cret",
+		"scopes":          []string{"email", "profile"},
+		"login_enabled":   true,
+		"mailbox_enabled": false,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.OAuthProviderResponse
+	decodeData(t, w, &created)
+	return created
+}
+
+func TestOAuthProviderAdmin_CRUD(t *testing.T) {
+	r, db := setupOAuthProviderTestRouter(t)
+	mock := newMockOIDCServer(t, "email-server")
+
+	// OIDC 提供商必须提供 issuer
+	w := doJSON(r, "POST", "/admin/oauth-providers", map[string]interface{}{
+		"name": "broken", "type": "oidc", "client_id": "x", "client_secret": "y", "login_enabled": true, "mailbox_enabled": false,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 名称格式校验
+	w = doJSON(r, "POST", "/admin/oauth-providers", map[string]interface{}{"name": "Bad Name"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	created := createKeycloakProvider(t, r, mock.URL)
+	assert.Equal(t, mock.URL+"/auth", created.AuthURL, "端点应通过 discovery 获取")
+	assert.Equal(t, mock.URL+"/token", created.TokenURL)
+	assert.Equal(t, mock.URL+"/userinfo", created.UserInfoURL)
+	assert.True(t, created.Enabled)
+	assert.True(t, created.HasClientSecret)
+	w = doJSON(r, "GET", "/admin/oauth-providers", nil)
+	assert.NotContains(t, w.Body.String(), "s3cret")
+	assert.NotContains(t, w.Body.String(), `"client_secret"`)
+
+	// 重名
+	w = doJSON(r, "POST", "/admin/oauth-providers", map[string]interface{}{
+		"name": "keycloak", "type": "oidc", "issuer_url": mock.URL, "client_id": "x", "client_secret": "y", "login_enabled": true, "mailbox_enabled": false,
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// 登录页只列出启用登录的提供商
+	w = doJSON(r, "GET", "/auth/oauth2/providers", nil)
+	var public []models.PublicOAuthProvider
+	decodeData(t, w, &public)
+	require.Len(t, public, 1)
+	assert.Equal(t, "Company SSO", public[0].DisplayName)
+
+	// 轮换 client secret，名称不可修改
+	var before models.OAuthProvider
+	require.NoError(t, db.First(&before, created.ID).Error)
+	w = doJSON(r, "PUT", "/admin/oauth-providers/"+strconv.Itoa(int(created.ID)), map[string]interface{}{"client_secret": "rotated", "enabled": false})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var after models.OAuthProvider
+	require.NoError(t, db.First(&after, created.ID).Error)
+	assert.NotEqual(t, before.ClientSecretEncrypted, after.ClientSecretEncrypted)
+	assert.False(t, after.Enabled)
+	assert.Equal(t, "email-server", after.ClientID, "未提供的字段保持不变")
+
+	w = doJSON(r, "PUT", "/admin/oauth-providers/"+strconv.Itoa(int(created.ID)), map[string]interface{}{"name": "renamed"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 停用后不能用于登录
+	w = doJSON(r, "GET", "/auth/oauth2/login/keycloak", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// 仍有邮箱令牌引用时不能删除
+	token := models.UserOAuthToken{UserID: 1, EmailAccountID: 1, ProviderID: created.ID, AccessTokenEncrypted: "x", Expiry: time.Now()}
+	require.NoError(t, db.Session(&gorm.Session{SkipHooks: true}).Omit("User", "EmailAccount", "Provider").Create(&token).Error)
+	w = doJSON(r, "DELETE", "/admin/oauth-providers/"+strconv.Itoa(int(created.ID)), nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	require.NoError(t, db.Delete(&token).Error)
+	w = doJSON(r, "DELETE", "/admin/oauth-providers/"+strconv.Itoa(int(created.ID)), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, "GET", "/admin/oauth-providers/"+strconv.Itoa(int(created.ID)), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// startOIDCLogin 发起登录并返回 state 和 nonce
+func startOIDCLogin(t *testing.T, r *gin.Engine) (string, string) {
+	w := doJSON(r, "GET", "/auth/oauth2/login/keycloak", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var data map[string]string
+	decodeData(t, w, &data)
+	authURL, err := url.Parse(data["auth_url"])
+	require.NoError(t, err)
+	query := authURL.Query()
+	assert.Equal(t, "http://backend.test/api/v1/oauth2/callback/keycloak", query.Get("redirect_uri"))
+	assert.Contains(t, query.Get("scope"), "openid")
+	assert.NotEmpty(t, query.Get("code_challenge"))
+	require.NotEmpty(t, query.Get("nonce"))
+	return data["state"], query.Get("nonce")
+}
+
+func TestOIDCLogin_WithMockProvider(t *testing.T) {
+	r, db := setupOAuthProviderTestRouter(t)
+	mock := newMockOIDCServer(t, "email-server")
+	createKeycloakProvider(t, r, mock.URL)
+
+	state, nonce := startOIDCLogin(t, r)
+	mock.setNonce(nonce)
+	w := doJSON(r, "GET", "/api/v1/oauth2/callback/keycloak?code=good-code&state="+state, nil)
+	require.Equal(t, http.StatusFound, w.Code)
+	location := w.Header().Get("Location")
+	assert.True(t, strings.HasPrefix(location, "http://frontend.test/oauth2/callback?token="), location)
+
+	var user models.User
+	require.NoError(t, db.Where("email = ?", "carol@example.com").First(&user).Error)
+	assert.Equal(t, "carol", user.Username)
+	require.NotNil(t, user.Provider)
+	assert.Equal(t, "keycloak", *user.Provider)
+
+	// state 只能使用一次
+	w = doJSON(r, "GET", "/api/v1/oauth2/callback/keycloak?code=good-code&state="+state, nil)
+	assert.Contains(t, w.Header().Get("Location"), "error=invalid_state")
+
+	// 再次登录匹配同一用户
+	state, nonce = startOIDCLogin(t, r)
+	mock.setNonce(nonce)
+	w = doJSON(r, "GET", "/api/v1/oauth2/callback/keycloak?code=good-code&state="+state, nil)
+	require.Equal(t, http.StatusFound, w.Code)
+	var count int64
+	require.NoError(t, db.Model(&models.User{}).Count(&count).Error)
+	assert.EqualValues(t, 1, count)
+
+	// nonce 不匹配的 ID Token 被拒绝
+	state, _ = startOIDCLogin(t, r)
+	mock.setNonce("replayed-nonce")
+	w = doJSON(r, "GET", "/api/v1/oauth2/callback/keycloak?code=good-code&state="+state, nil)
+	assert.Equal(t, "http://frontend.test/auth/login?error=user_info_failed", w.Header().Get("Location"))
+}
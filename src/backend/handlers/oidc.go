@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+
+	pkce "github.com/nirasan/go-oauth-pkce-code-verifier"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// oidcProviders 缓存 OIDC discovery 结果（含 JWKS），按 issuer 索引
+var oidcProviders sync.Map
+
+// discoverOIDC 获取 issuer 的 OIDC 配置，结果会被缓存
+func discoverOIDC(ctx context.Context, issuer string) (*oidc.Provider, error) {
+	if cached, ok := oidcProviders.Load(issuer); ok {
+		return cached.(*oidc.Provider), nil
+	}
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	oidcProviders.Store(issuer, provider)
+	return provider, nil
+}
+
+// applyOIDCDiscovery 通过 discovery 文档填充提供商的授权、令牌和用户信息端点
+func applyOIDCDiscovery(ctx context.Context, p *models.OAuthProvider) error {
+	oidcProviders.Delete(p.IssuerURL) // 配置变更时重新获取
+	provider, err := discoverOIDC(ctx, p.IssuerURL)
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		UserInfoEndpoint string `json:"userinfo_endpoint"`
+	}
+	if err := provider.Claims(&claims); err != nil {
+		return err
+	}
+	endpoint := provider.Endpoint()
+	p.AuthURL = endpoint.AuthURL
+	p.TokenURL = endpoint.TokenURL
+	p.UserInfoURL = claims.UserInfoEndpoint
+	return nil
+}
+
+// loadOAuthProvider 按名称加载已启用的提供商
+func loadOAuthProvider(name string) (*models.OAuthProvider, error) {
+	var provider models.OAuthProvider
+	if err := database.DB.Where("name = ? AND enabled = ?", name, true).First(&provider).Error; err != nil {
+		return nil, fmt.Errorf("provider '%s' not found or disabled: %w", name, err)
+	}
+	return &provider, nil
+}
+
+// oauth2ConfigFor 根据数据库中的提供商配置构建 oauth2.Config
+func oauth2ConfigFor(provider *models.OAuthProvider) (*oauth2.Config, error) {
+	decryptedSecret, err := utils.Decrypt(provider.ClientSecretEncrypted)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt client secret for provider '%s'", provider.Name)
+	}
+
+	baseURL := config.AppConfig.Backend.BaseURL
+	if baseURL == "" {
+		baseURL = "http://localhost:5555"
+	}
+
+	scopes := provider.ScopeList()
+	if provider.Type == models.OAuthProviderTypeOIDC && !containsString(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	return &oauth2.Config{
+		ClientID:     provider.ClientID,
+		ClientSecret: string(decryptedSecret),
+		RedirectURL:  fmt.Sprintf("%s/api/v1/oauth2/callback/%s", baseURL, provider.Name),
+		Scopes:       scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  provider.AuthURL,
+			TokenURL: provider.TokenURL,
+		},
+	}, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// oauthIdentity 从 ID Token 或用户信息接口中提取的身份
+type oauthIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+}
+
+// fetchUserInfo 使用访问令牌请求用户信息接口并解析 JSON
+func fetchUserInfo(ctx context.Context, client *http.Client, userInfoURL string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", userInfoURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("user info request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// claimString 依次读取多个候选字段，返回第一个非空的字符串（数字 ID 会被转换为字符串）
+func claimString(claims map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := claims[key].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64:
+			return strconv.FormatInt(int64(v), 10)
+		}
+	}
+	return ""
+}
+
+// identityFromClaims 兼容 OIDC 标准字段以及 Google v2、Microsoft Graph、LinuxDo 等常见用户信息格式。
+// 只有提供商明确返回 email_verified（Google v2 为 verified_email）为 true 时才视为已验证邮箱；
+// mail、userPrincipalName 等字段只是目录中的属性，提供商并未验证邮箱归属，一律视为未验证。
+func identityFromClaims(claims map[string]interface{}) *oauthIdentity {
+	identity := &oauthIdentity{
+		Subject:  claimString(claims, "sub", "id"),
+		Email:    claimString(claims, "email"),
+		Name:     claimString(claims, "name", "displayName"),
+		Username: claimString(claims, "preferred_username", "username", "login"),
+	}
+	if identity.Email == "" {
+		identity.Email = claimString(claims, "mail", "userPrincipalName")
+		return identity
+	}
+	for _, key := range []string{"email_verified", "verified_email"} {
+		switch v := claims[key].(type) {
+		case bool:
+			identity.EmailVerified = v
+		case string:
+			identity.EmailVerified = v == "true"
+		}
+	}
+	return identity
+}
+
+// fetchOAuthIdentity 获取登录用户的身份：OIDC 提供商校验 ID Token（签名、issuer、audience、nonce），
+// 缺少邮箱时再请求用户信息接口；普通 OAuth2 提供商直接请求用户信息接口。
+func fetchOAuthIdentity(ctx context.Context, provider *models.OAuthProvider, conf *oauth2.Config, token *oauth2.Token, nonce string) (*oauthIdentity, error) {
+	var identity *oauthIdentity
+
+	if provider.Type == models.OAuthProviderTypeOIDC {
+		rawIDToken, _ := token.Extra("id_token").(string)
+		if rawIDToken == "" {
+			return nil, errors.New("token response did not include an id_token")
+		}
+		oidcProvider, err := discoverOIDC(ctx, provider.IssuerURL)
+		if err != nil {
+			return nil, fmt.Errorf("oidc discovery failed: %w", err)
+		}
+		idToken, err := oidcProvider.Verifier(&oidc.Config{ClientID: provider.ClientID}).Verify(ctx, rawIDToken)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id_token: %w", err)
+		}
+		if nonce != "" && idToken.Nonce != nonce {
+			return nil, errors.New("id_token nonce mismatch")
+		}
+		var claims map[string]interface{}
+		if err := idToken.Claims(&claims); err != nil {
+			return nil, err
+		}
+		identity = identityFromClaims(claims)
+		if identity.Email != "" || provider.UserInfoURL == "" {
+			return identity, nil
+		}
+	}
+
+	if provider.UserInfoURL == "" {
+		return nil, fmt.Errorf("provider '%s' has no user info endpoint", provider.Name)
+	}
+	var claims map[string]interface{}
+	if err := fetchUserInfo(ctx, conf.Client(ctx, token), provider.UserInfoURL, &claims); err != nil {
+		return nil, err
+	}
+	fromUserInfo := identityFromClaims(claims)
+	if identity != nil {
+		// OIDC 要求用户信息中的 sub 与 ID Token 一致
+		if fromUserInfo.Subject != "" && fromUserInfo.Subject != identity.Subject {
+			return nil, errors.New("userinfo subject does not match id_token")
+		}
+		fromUserInfo.Subject = identity.Subject
+	}
+	return fromUserInfo, nil
+}
+
+// ListLoginOAuthProviders 获取可用于登录的 OAuth 提供商
+// @Summary 获取登录提供商列表
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} models.SuccessResponse{data=[]models.PublicOAuthProvider} "获取成功"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /auth/oauth2/providers [get]
+func ListLoginOAuthProviders(c *gin.Context) {
+	listPublicOAuthProviders(c, "login_enabled")
+}
+
+// ListMailboxOAuthProviders 获取可用于关联邮箱的 OAuth 提供商
+// @Summary 获取邮箱关联提供商列表
+// @Tags OAuth2
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse{data=[]models.PublicOAuthProvider} "获取成功"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /oauth2/providers [get]
+func ListMailboxOAuthProviders(c *gin.Context) {
+	listPublicOAuthProviders(c, "mailbox_enabled")
+}
+
+func listPublicOAuthProviders(c *gin.Context, usageColumn string) {
+	var providers []models.OAuthProvider
+	if err := database.DB.Where("enabled = ? AND "+usageColumn+" = ?", true, true).Order("display_name").Find(&providers).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取OAuth提供商失败")
+		return
+	}
+	result := make([]models.PublicOAuthProvider, 0, len(providers))
+	for _, p := range providers {
+		result = append(result, models.PublicOAuthProvider{Name: p.Name, DisplayName: p.DisplayName, Type: p.Type})
+	}
+	utils.SendSuccessResponse(c, result)
+}
+
+// OAuth2ProviderLogin 生成管理员配置的 OAuth2/OIDC 提供商的登录URL
+// @Summary 通过OAuth提供商登录
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "提供商名称"
+// @Success 200 {object} models.SuccessResponse{data=map[string]string} "返回授权URL和state"
+// @Failure 404 {object} models.ErrorResponse "提供商不存在或未启用登录"
+// @Router /auth/oauth2/login/{provider} [get]
+func OAuth2ProviderLogin(c *gin.Context) {
+	provider, err := loadOAuthProvider(c.Param("provider"))
+	if err != nil || !provider.LoginEnabled {
+		utils.SendErrorResponse(c, http.StatusNotFound, "该提供商不存在或未启用登录")
+		return
+	}
+	startProviderLogin(c, provider, 0)
+}
+
+// startProviderLogin 发起管理员配置的提供商的授权流程，userID 非0时为已登录用户绑定身份
+func startProviderLogin(c *gin.Context, provider *models.OAuthProvider, userID uint) {
+	conf, err := oauth2ConfigFor(provider)
+	if err != nil {
+		log.Printf("Error building OAuth2 config for %s: %v", provider.Name, err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "OAuth提供商配置错误")
+		return
+	}
+
+	state, err := generateRandomState()
+	if err != nil {
+		log.Printf("生成state失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "系统错误")
+		return
+	}
+	pkceVerifier, err := pkce.CreateCodeVerifier()
+	if err != nil {
+		log.Printf("生成PKCE verifier失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "无法启动OAuth2流程")
+		return
+	}
+
+	oauthState := models.OAuth2State{
+		State:        state,
+		UserID:       userID,
+		Provider:     provider.Name,
+		PKCEVerifier: pkceVerifier.Value,
+		ExpiresAt:    time.Now().Add(10 * time.Minute),
+	}
+	opts := []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", pkceVerifier.CodeChallengeS256()),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+	if provider.Type == models.OAuthProviderTypeOIDC {
+		if oauthState.Nonce, err = generateRandomState(); err != nil {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "系统错误")
+			return
+		}
+		opts = append(opts, oidc.Nonce(oauthState.Nonce))
+	}
+	if err := database.DB.Create(&oauthState).Error; err != nil {
+		log.Printf("保存OAuth2 state到数据库失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "无法启动OAuth2流程")
+		return
+	}
+
+	utils.SendSuccessResponse(c, gin.H{
+		"auth_url": conf.AuthCodeURL(state, opts...),
+		"state":    state,
+	})
+}
+
+// handleProviderLoginCallback 处理管理员配置的提供商的登录或身份绑定回调
+func handleProviderLoginCallback(c *gin.Context, providerName, code string, stateInfo *models.OAuth2State) {
+	provider, err := loadOAuthProvider(providerName)
+	if err != nil || !provider.LoginEnabled {
+		redirectIdentityError(c, stateInfo, "provider_not_configured")
+		return
+	}
+	conf, err := oauth2ConfigFor(provider)
+	if err != nil {
+		log.Printf("Error building OAuth2 config for %s: %v", providerName, err)
+		redirectIdentityError(c, stateInfo, "provider_not_configured")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
+	defer cancel()
+
+	token, err := conf.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", stateInfo.PKCEVerifier))
+	if err != nil {
+		log.Printf("用code交换token失败 (%s): %v", providerName, err)
+		redirectIdentityError(c, stateInfo, "token_exchange_failed")
+		return
+	}
+
+	identity, err := fetchOAuthIdentity(ctx, provider, conf, token, stateInfo.Nonce)
+	if err != nil {
+		log.Printf("获取用户身份失败 (%s): %v", providerName, err)
+		redirectIdentityError(c, stateInfo, "user_info_failed")
+		return
+	}
+
+	completeOAuthIdentity(c, stateInfo, provider.Name, identity)
+}
+
+// uniqueUsername 用户名已被占用时追加数字后缀
+func uniqueUsername(base string) (string, error) {
+	candidate := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := database.DB.Unscoped().Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// finishOAuth2Login 检查账户状态、签发JWT并重定向回前端
+func finishOAuth2Login(c *gin.Context, user *models.User, providerName string) {
+	if !user.IsStatusActive() {
+		log.Printf("用户账户已被封禁: user_id=%d, username=%s", user.ID, user.Username)
+		redirectLoginError(c, "account_banned")
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(user).Update("last_login", now).Error; err != nil {
+		log.Printf("更新最后登录时间失败: %v", err)
+	}
+
+	token, err := utils.GenerateToken(int64(user.ID), user.Username, user.Role, user.TokenVersion)
+	if err != nil {
+		log.Printf("生成token失败: %v", err)
+		redirectLoginError(c, "token_generation_failed")
+		return
+	}
+
+	log.Printf("%s OAuth2登录成功: user_id=%d, username=%s", providerName, user.ID, user.Username)
+
+	redirectURL := fmt.Sprintf("%s/oauth2/callback?token=%s&expires_in=%d", frontendBaseURL(), token, config.AppConfig.JWT.ExpiresIn)
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// redirectLoginError 登录失败时重定向到前端登录页
+func redirectLoginError(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, frontendBaseURL()+"/auth/login?error="+code)
+}
+
+func frontendBaseURL() string {
+	if config.AppConfig.Frontend.BaseURL != "" {
+		return config.AppConfig.Frontend.BaseURL
+	}
+	return "http://localhost:8080"
+}
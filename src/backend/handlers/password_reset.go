@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"email_server/database"
+	"email_server/mailer"
+	"email_server/models"
+	"email_server/ratelimit"
+	"email_server/utils"
+)
+
+// passwordResetTTL 重置密码链接的有效期
+const passwordResetTTL = time.Hour
+
+var errPasswordResetInvalid = errors.New("password reset token is invalid, used or expired")
+
+// 找回密码的限流：同一 IP 和同一邮箱分别计数，防止借此向他人邮箱发送大量邮件或枚举 token
+var (
+	forgotPasswordIPLimiter    = ratelimit.New("forgot-password-ip", ratelimit.Rule{Limit: 10, Window: 15 * time.Minute})
+	forgotPasswordEmailLimiter = ratelimit.New("forgot-password-email", ratelimit.Rule{Limit: 3, Window: time.Hour})
+	resetPasswordIPLimiter     = ratelimit.New("reset-password-ip", ratelimit.Rule{Limit: 20, Window: 15 * time.Minute})
+)
+
+// passwordResetMails 正在后台发送的重置密码邮件，测试中等待发送完成
+var passwordResetMails sync.WaitGroup
+
+// sendPasswordResetEmail 为用户生成新的重置 token 并发送邮件，之前未使用的 token 一并作废
+func sendPasswordResetEmail(user *models.User) error {
+	token, err := generateRandomState()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			Email:     user.Email,
+			ExpiresAt: now.Add(passwordResetTTL),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// 通过第三方登录注册的用户没有密码，邮件中说明这是设置密码
+	action := "重置"
+	if user.Password == "" {
+		action = "设置"
+	}
+	link := frontendBaseURL() + "/auth/reset-password?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("%s，您好：\n\n我们收到了为您的账户%s密码的请求。请在 %d 分钟内打开以下链接%s密码，链接只能使用一次：\n\n%s\n\n如果这不是您本人的操作，请忽略此邮件，您的密码不会改变。\n",
+		user.Username, action, int(passwordResetTTL.Minutes()), action, link)
+	return mailer.Default.Send(user.Email, action+"您的密码", body)
+}
+
+// ForgotPassword 申请通过邮件重置密码
+// @Summary 忘记密码
+// @Description 无论邮箱是否已注册都返回相同结果，避免泄露用户信息
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body models.ForgotPasswordRequest true "注册邮箱"
+// @Success 200 {object} models.SuccessResponse "已受理"
+// @Failure 429 {object} models.ErrorResponse "请求过于频繁"
+// @Failure 503 {object} models.ErrorResponse "未配置邮件服务"
+// @Router /auth/forgot-password [post]
+func ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误")
+		return
+	}
+	if !mailer.Configured() {
+		utils.SendErrorResponse(c, http.StatusServiceUnavailable, "未配置邮件服务，请联系管理员重置密码")
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if allowed, retryAfter := forgotPasswordIPLimiter.Allow(c.ClientIP()); !allowed {
+		utils.SendTooManyRequests(c, retryAfter, "请求过于频繁，请稍后再试")
+		return
+	}
+	if allowed, retryAfter := forgotPasswordEmailLimiter.Allow(email); !allowed {
+		utils.SendTooManyRequests(c, retryAfter, "请求过于频繁，请稍后再试")
+		return
+	}
+
+	// 查询和发送都在后台进行，已注册、未注册和发送失败的请求返回相同的状态码，耗时也没有差别
+	passwordResetMails.Add(1)
+	go func() {
+		defer passwordResetMails.Done()
+		processForgotPassword(email)
+	}()
+	utils.SendSuccessResponse(c, "如果该邮箱已注册，重置密码邮件已发送")
+}
+
+// processForgotPassword 向邮箱对应的正常用户发送重置密码邮件，结果只记录日志
+func processForgotPassword(email string) {
+	var user models.User
+	err := database.DB.Where("LOWER(email) = ?", email).Order("id").First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return
+	}
+	if err != nil {
+		log.Printf("查询用户失败: %v", err)
+		return
+	}
+	if !user.IsStatusActive() {
+		log.Printf("已封禁的用户 %d 申请重置密码，忽略", user.ID)
+		return
+	}
+	if err := sendPasswordResetEmail(&user); err != nil {
+		log.Printf("向用户 %d 发送重置密码邮件失败: %v", user.ID, err)
+		return
+	}
+	log.Printf("已向用户 %d 发送重置密码邮件", user.ID)
+}
+
+// ResetPassword 使用邮件中的 token 设置新密码，成功后所有已登录的会话失效
+// @Summary 重置密码
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordRequest true "重置 token 与新密码"
+// @Success 200 {object} models.SuccessResponse "重置成功"
+// @Failure 400 {object} models.ErrorResponse "链接无效或已过期"
+// @Failure 429 {object} models.ErrorResponse "请求过于频繁"
+// @Router /auth/reset-password [post]
+func ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误")
+		return
+	}
+	if err := utils.ValidatePassword(req.NewPassword); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if allowed, retryAfter := resetPasswordIPLimiter.Allow(c.ClientIP()); !allowed {
+		utils.SendTooManyRequests(c, retryAfter, "请求过于频繁，请稍后再试")
+		return
+	}
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		log.Printf("密码加密失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "系统错误")
+		return
+	}
+
+	var resetToken models.PasswordResetToken
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(req.Token), time.Now()).
+			First(&resetToken).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errPasswordResetInvalid
+		}
+		if err != nil {
+			return err
+		}
+		var user models.User
+		if err := tx.Select("id", "email", "status").First(&user, resetToken.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errPasswordResetInvalid
+			}
+			return err
+		}
+		// 发送后修改了邮箱或被封禁的用户不能再使用旧链接
+		if user.Email != resetToken.Email || !user.IsStatusActive() {
+			return errPasswordResetInvalid
+		}
+
+		// 并发提交同一 token 时只有一个能成功
+		now := time.Now()
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetToken.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPasswordResetInvalid
+		}
+		// 能收到邮件说明邮箱属于该用户，同时视为已验证邮箱
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"password":              hashedPassword,
+			"must_change_password":  false,
+			"token_version":         gorm.Expr("token_version + 1"),
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+			"email_verified_at":     gorm.Expr("COALESCE(email_verified_at, ?)", now),
+		}).Error
+	})
+	if errors.Is(err, errPasswordResetInvalid) {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "重置链接无效或已过期")
+		return
+	}
+	if err != nil {
+		log.Printf("重置密码失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "重置密码失败")
+		return
+	}
+	log.Printf("用户 %d 通过邮件重置了密码，已吊销所有登录会话", resetToken.UserID)
+	utils.SendSuccessResponse(c, "密码已重置，请使用新密码登录")
+}
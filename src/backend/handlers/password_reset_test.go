@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"email_server/config"
+	"email_server/mailer"
+	"email_server/models"
+	"email_server/ratelimit"
+	"email_server/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enablePasswordReset 配置发件器并重置找回密码的限流计数
+func enablePasswordReset(t *testing.T) *recordingSender {
+	config.AppConfig.SMTP = config.SMTPConfig{Host: "smtp.test", Port: 587, From: "noreply@example.com"}
+	sender := &recordingSender{}
+	previousSender := mailer.Default
+	mailer.Default = sender
+
+	// 使用新的存储，避免计数在测试之间累积
+	previousStore := ratelimit.Default
+	ratelimit.Default = ratelimit.NewMemoryStore()
+	previousIP, previousEmail, previousReset := forgotPasswordIPLimiter, forgotPasswordEmailLimiter, resetPasswordIPLimiter
+	forgotPasswordIPLimiter = ratelimit.New("forgot-password-ip", previousIP.Rule())
+	forgotPasswordEmailLimiter = ratelimit.New("forgot-password-email", previousEmail.Rule())
+	resetPasswordIPLimiter = ratelimit.New("reset-password-ip", previousReset.Rule())
+	t.Cleanup(func() {
+		passwordResetMails.Wait()
+		mailer.Default = previousSender
+		ratelimit.Default = previousStore
+		forgotPasswordIPLimiter, forgotPasswordEmailLimiter, resetPasswordIPLimiter = previousIP, previousEmail, previousReset
+	})
+	return sender
+}
+
+// forgotPassword 申请重置密码并等待后台发送完成
+func forgotPassword(r *gin.Engine, email string) *httptest.ResponseRecorder {
+	w := doJSON(r, "POST", "/api/v1/auth/forgot-password", map[string]string{"email": email})
+	passwordResetMails.Wait()
+	return w
+}
+
+func TestPasswordReset_RevokesSessions(t *testing.T) {
+	r, _ := setupAdminTestRouter(t)
+	sender := enablePasswordReset(t)
+	registerUser(t, r, "alice", "alice@example.com")
+	session := login(t, r, "alice", "secret-password")
+
+	// 未注册的邮箱返回相同结果，但不发送邮件
+	w := forgotPassword(r, "nobody@example.com")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, sender.sent)
+
+	w = forgotPassword(r, "Alice@Example.com")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, "alice@example.com", sender.sent[0].to)
+	staleToken := sender.lastLinkToken(t, "/auth/reset-password")
+
+	// 再次申请后之前的链接失效
+	w = forgotPassword(r, "alice@example.com")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	resetToken := sender.lastLinkToken(t, "/auth/reset-password")
+	w = doJSON(r, "POST", "/api/v1/auth/reset-password", map[string]string{"token": staleToken, "new_password": "new-password"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(r, "POST", "/api/v1/auth/reset-password", map[string]string{"token": resetToken, "new_password": "new-password"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// 重置前签发的 token 全部失效，也不能刷新
+	w = doAuthJSON(r, "GET", "/api/v1/users/me", session.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doAuthJSON(r, "POST", "/api/v1/auth/refresh", session.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 链接只能使用一次
+	w = doJSON(r, "POST", "/api/v1/auth/reset-password", map[string]string{"token": resetToken, "new_password": "another-password"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(r, "POST", "/api/v1/auth/login", map[string]string{"username": "alice", "password": "secret-password"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	session = login(t, r, "alice", "new-password")
+	w = doAuthJSON(r, "GET", "/api/v1/users/me", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestPasswordReset_InvalidAfterEmailChange(t *testing.T) {
+	r, _ := setupAdminTestRouter(t)
+	sender := enablePasswordReset(t)
+	session := registerUser(t, r, "erin", "erin@example.com")
+
+	w := forgotPassword(r, "erin@example.com")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	resetToken := sender.lastLinkToken(t, "/auth/reset-password")
+
+	w = doAuthJSON(r, "PUT", "/api/v1/users/me", session.Token, map[string]string{"email": "erin@new.example.com"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doJSON(r, "POST", "/api/v1/auth/reset-password", map[string]string{"token": resetToken, "new_password": "new-password"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPasswordReset_OAuthOnlyUserSetsPassword(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	sender := enablePasswordReset(t)
+	user := models.User{Username: "octocat", Email: "octocat@example.com", Role: models.RoleUser, Status: models.StatusActive}
+	require.NoError(t, db.Create(&user).Error)
+	token, err := utils.GenerateToken(int64(user.ID), user.Username, user.Role, user.TokenVersion)
+	require.NoError(t, err)
+
+	// 没有密码时不能通过旧密码修改
+	w := doAuthJSON(r, "POST", "/api/v1/users/me/change-password", token, map[string]string{"old_password": "", "new_password": "new-password"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doAuthJSON(r, "POST", "/api/v1/users/me/change-password", token, map[string]string{"old_password": "anything", "new_password": "new-password"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "忘记密码")
+
+	w = forgotPassword(r, "octocat@example.com")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, sender.sent, 1)
+	assert.Contains(t, sender.sent[0].subject, "设置")
+
+	w = doJSON(r, "POST", "/api/v1/auth/reset-password", map[string]string{"token": sender.lastLinkToken(t, "/auth/reset-password"), "new_password": "new-password"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	login(t, r, "octocat", "new-password")
+}
+
+func TestForgotPassword_RateLimited(t *testing.T) {
+	r, _ := setupAdminTestRouter(t)
+	sender := enablePasswordReset(t)
+	registerUser(t, r, "frank", "frank@example.com")
+
+	for i := 0; i < 3; i++ {
+		w := forgotPassword(r, "frank@example.com")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	w := forgotPassword(r, "FRANK@example.com")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Len(t, sender.sent, 3)
+
+	// 同一 IP 申请不同邮箱也有上限（此前已计 4 次）
+	for i := 0; i < 6; i++ {
+		w = forgotPassword(r, fmt.Sprintf("other%d@example.com", i))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	w = forgotPassword(r, "another@example.com")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestForgotPassword_NotConfigured(t *testing.T) {
+	r, _ := setupAdminTestRouter(t)
+
+	w := forgotPassword(r, "admin@example.com")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+// failingSender 发送总是失败的发件器
+type failingSender struct{}
+
+func (failingSender) Send(to, subject, body string) error {
+	return errors.New("smtp unavailable")
+}
+
+func TestForgotPassword_SameResponseForAllEmails(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	enablePasswordReset(t)
+	mailer.Default = failingSender{}
+	registerUser(t, r, "gina", "gina@example.com")
+	banned := models.User{Username: "hank", Email: "hank@example.com", Password: "hashed", Role: models.RoleUser}
+	require.NoError(t, db.Create(&banned).Error)
+	require.NoError(t, db.Model(&banned).Update("status", models.StatusBanned).Error)
+
+	// 发送失败、已封禁和未注册的邮箱返回完全相同的响应
+	expected := forgotPassword(r, "nobody@example.com")
+	require.Equal(t, http.StatusOK, expected.Code)
+	for _, email := range []string{"gina@example.com", "hank@example.com"} {
+		w := forgotPassword(r, email)
+		assert.Equal(t, expected.Code, w.Code, email)
+		assert.Equal(t, expected.Body.String(), w.Body.String(), email)
+	}
+}
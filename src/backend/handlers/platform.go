@@ -4,8 +4,10 @@ import (
 	"email_server/database"
 	"email_server/models"
 	"email_server/utils"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"strings"
 
@@ -40,15 +42,53 @@ func CreatePlatform(c *gin.Context) {
 	currentUserID := uint(userID)
 
 	var input struct {
-		Name       string `json:"name" binding:"required,min=2,max=100"`
-		WebsiteURL string `json:"website_url" binding:"omitempty,url"`
-		Notes      string `json:"notes"`
+		Name       string                    `json:"name" binding:"required,min=2,max=100"`
+		WebsiteURL string                    `json:"website_url" binding:"omitempty,url"`
+		URLs       []models.PlatformURLInput `json:"urls"` // 其他登录网址或 App ID 及匹配方式
+		Notes      string                    `json:"notes"`
+		// CatalogPlatformID 从平台目录中选择的条目；不传时按名称或网址自动匹配
+		CatalogPlatformID *uint `json:"catalog_platform_id"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		utils.SendErrorResponse(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
 		return
 	}
+	urls, ok := buildPlatformURLs(currentUserID, input.URLs)
+	if !ok {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的平台网址或匹配规则")
+		return
+	}
+
+	var catalog *models.CatalogPlatform
+	if input.CatalogPlatformID != nil {
+		var entry models.CatalogPlatform
+		if err := database.DB.First(&entry, *input.CatalogPlatformID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				utils.SendErrorResponse(c, http.StatusBadRequest, "平台目录条目不存在")
+				return
+			}
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "查询平台目录失败: "+err.Error())
+			return
+		}
+		catalog = &entry
+	} else {
+		entry, byName, err := resolveCatalogPlatform(database.DB, input.Name, input.WebsiteURL)
+		if err != nil {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "查询平台目录失败: "+err.Error())
+			return
+		}
+		catalog = entry
+		if byName {
+			// 按名称匹配到目录时统一使用规范名称（如 github -> GitHub）
+			input.Name = entry.Name
+		}
+	}
+	if catalog != nil && input.WebsiteURL == "" {
+		if domain := catalog.PrimaryDomain(); domain != "" {
+			input.WebsiteURL = "https://" + domain
+		}
+	}
 
 	// 首先检查是否存在同名的记录
 	var existingPlatform models.Platform
@@ -69,8 +109,12 @@ func CreatePlatform(c *gin.Context) {
 		UserID:     currentUserID,
 		Name:       input.Name,
 		WebsiteURL: input.WebsiteURL,
+		URLs:       urls,
 		Notes:      input.Notes,
 	}
+	if catalog != nil {
+		platform.CatalogPlatformID = &catalog.ID
+	}
 
 	if err := database.DB.Create(&platform).Error; err != nil {
 		if utils.IsUniqueConstraintError(err) {
@@ -81,6 +125,7 @@ func CreatePlatform(c *gin.Context) {
 		return
 	}
 
+	platform.Catalog = catalog
 	utils.SendSuccessResponse(c, platform.ToPlatformResponse())
 }
 
@@ -207,7 +252,7 @@ func GetPlatforms(c *gin.Context) {
 	}
 	// If fetchAllWindows is true, no Offset or Limit is applied, getting all records.
 
-	if err := finalQuery.Find(&platforms).Error; err != nil {
+	if err := finalQuery.Preload("URLs", orderByID).Preload("Catalog").Find(&platforms).Error; err != nil {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取平台列表失败: "+err.Error())
 		return
 	}
@@ -277,7 +322,7 @@ func GetPlatformByID(c *gin.Context) {
 	}
 
 	var platform models.Platform
-	if err := database.DB.Where("id = ? AND user_id = ?", platformID, currentUserID).First(&platform).Error; err != nil {
+	if err := database.DB.Preload("URLs", orderByID).Preload("Catalog").Where("id = ? AND user_id = ?", platformID, currentUserID).First(&platform).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.SendErrorResponse(c, http.StatusNotFound, "平台未找到或无权访问")
 			return
@@ -346,9 +391,10 @@ func UpdatePlatform(c *gin.Context) {
 	}
 
 	var input struct {
-		Name       string `json:"name" binding:"omitempty,min=2,max=100"`
-		WebsiteURL string `json:"website_url" binding:"omitempty,url"`
-		Notes      string `json:"notes"`
+		Name       string                     `json:"name" binding:"omitempty,min=2,max=100"`
+		WebsiteURL string                     `json:"website_url" binding:"omitempty,url"`
+		URLs       *[]models.PlatformURLInput `json:"urls"` // 不传表示不修改
+		Notes      string                     `json:"notes"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -402,8 +448,42 @@ func UpdatePlatform(c *gin.Context) {
 	}
 	platform.WebsiteURL = input.WebsiteURL // Allow clearing
 	platform.Notes = input.Notes           // Allow clearing
+	var urls []models.PlatformURL
+	if input.URLs != nil {
+		if urls, ok = buildPlatformURLs(currentUserID, *input.URLs); !ok {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "无效的平台网址或匹配规则")
+			return
+		}
+	}
 
-	if err := database.DB.Save(&platform).Error; err != nil {
+	// 尚未关联平台目录的平台（如目录条目创建之前添加的）在更新时按名称或网址重新匹配
+	if platform.CatalogPlatformID == nil {
+		catalog, _, resolveErr := resolveCatalogPlatform(database.DB, platform.Name, platform.WebsiteURL)
+		if resolveErr != nil {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "查询平台目录失败: "+resolveErr.Error())
+			return
+		}
+		if catalog != nil {
+			platform.CatalogPlatformID = &catalog.ID
+		}
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if input.URLs != nil {
+			return replacePlatformURLs(tx, &platform, urls)
+		}
+		return tx.Save(&platform).Error
+	})
+	if err == nil && input.URLs == nil {
+		err = database.DB.Where("platform_id = ?", platform.ID).Order("id").Find(&platform.URLs).Error
+	}
+	if err == nil && platform.CatalogPlatformID != nil {
+		var catalog models.CatalogPlatform
+		if database.DB.First(&catalog, *platform.CatalogPlatformID).Error == nil {
+			platform.Catalog = &catalog
+		}
+	}
+	if err != nil {
 		if utils.IsUniqueConstraintError(err) {
 			utils.SendErrorResponse(c, http.StatusConflict, "您已创建过同名平台")
 			return
@@ -428,7 +508,7 @@ func UpdatePlatform(c *gin.Context) {
 
 // DeletePlatform godoc
 // @Summary 删除指定ID的平台
-// @Description 删除指定ID的平台信息
+// @Description 删除指定ID的平台信息，连同关联的平台注册信息和服务订阅一起移入回收站
 // @Tags Platforms
 // @Produce json
 // @Param id path int true "平台ID"
@@ -476,33 +556,8 @@ func DeletePlatform(c *gin.Context) {
 		return
 	}
 
-	// 1. 查找并硬删除关联的 PlatformRegistrations 及其下的 ServiceSubscriptions
-	var registrations []models.PlatformRegistration
-	// 注意：由于 Platform 现在是用户特定的，我们只删除当前用户与此平台相关的注册信息
-	if err := tx.Where("platform_id = ? AND user_id = ?", platform.ID, currentUserID).Find(&registrations).Error; err != nil {
-		tx.Rollback()
-		utils.SendErrorResponse(c, http.StatusInternalServerError, "查找关联的平台注册信息失败: "+err.Error())
-		return
-	}
-
-	for _, reg := range registrations {
-		// 1a. 硬删除关联的 ServiceSubscriptions
-		// ServiceSubscription 也应该有 UserID，确保只删除当前用户的订阅
-		if err := tx.Unscoped().Where("platform_registration_id = ? AND user_id = ?", reg.ID, currentUserID).Delete(&models.ServiceSubscription{}).Error; err != nil {
-			tx.Rollback()
-			utils.SendErrorResponse(c, http.StatusInternalServerError, "删除服务订阅失败: "+err.Error())
-			return
-		}
-		// 1b. 硬删除 PlatformRegistration
-		if err := tx.Unscoped().Delete(&reg).Error; err != nil { // reg 已经包含了 UserID，所以 GORM 的钩子或条件应该能正确处理
-			tx.Rollback()
-			utils.SendErrorResponse(c, http.StatusInternalServerError, "删除平台注册信息失败: "+err.Error())
-			return
-		}
-	}
-
-	// 2. 硬删除 Platform 本身
-	if err := tx.Unscoped().Delete(&platform).Error; err != nil { // platform 已经通过 platformID 和 currentUserID 查询得到，是正确的记录
+	// 平台及其关联的平台注册信息、服务订阅一起移入回收站，可通过 /trash 恢复
+	if err := movePlatformToTrash(tx, &platform, time.Now()); err != nil {
 		tx.Rollback()
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "删除平台失败: "+err.Error())
 		return
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"email_server/database"
+	"email_server/models"
+	"email_server/urlmatch"
+	"email_server/utils"
+)
+
+// buildCatalogPlatform 校验请求并写入目录条目，域名统一保存为去重后的可注册域名。返回错误信息，为空表示校验通过
+func buildCatalogPlatform(input *models.CatalogPlatformInput, entry *models.CatalogPlatform) string {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return "名称不能为空"
+	}
+
+	var domains []string
+	seen := map[string]bool{}
+	for _, raw := range input.Domains {
+		addr, ok := urlmatch.Parse(raw)
+		if !ok || addr.Host == "" || !strings.Contains(addr.BaseDomain, ".") {
+			return "无效的域名: " + raw
+		}
+		if !seen[addr.BaseDomain] {
+			seen[addr.BaseDomain] = true
+			domains = append(domains, addr.BaseDomain)
+		}
+	}
+
+	methods, ok := normalizeChoices(input.TwoFactorMethods, models.CatalogTwoFactorMethods)
+	if !ok {
+		return "无效的 2FA 方式，可选值: " + strings.Join(models.CatalogTwoFactorMethods, ", ")
+	}
+	cycles, ok := normalizeChoices(input.BillingCycles, models.CatalogBillingCycles)
+	if !ok {
+		return "无效的计费周期，可选值: " + strings.Join(models.CatalogBillingCycles, ", ")
+	}
+
+	entry.Name = name
+	entry.Domains = strings.Join(domains, " ")
+	entry.Category = strings.TrimSpace(input.Category)
+	entry.IconURL = strings.TrimSpace(input.IconURL)
+	entry.SignupURL = strings.TrimSpace(input.SignupURL)
+	entry.PasswordChangeURL = strings.TrimSpace(input.PasswordChangeURL)
+	entry.TwoFactorMethods = methods
+	entry.BillingCycles = cycles
+	return ""
+}
+
+// normalizeChoices 校验取值都在 allowed 中，去重后按空格拼接
+func normalizeChoices(values, allowed []string) (string, bool) {
+	var result []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		valid := false
+		for _, a := range allowed {
+			if a == value {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return "", false
+		}
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return strings.Join(result, " "), true
+}
+
+// resolveCatalogPlatform 按名称（忽略大小写）或域名查找平台目录条目。
+// 先匹配名称；名称未命中时按 websiteURL 的可注册域名匹配，websiteURL 为空且名称形如域名时用名称匹配。
+// 未找到时返回 nil；byName 表示通过名称匹配，此时调用方应使用目录中的规范名称
+func resolveCatalogPlatform(db *gorm.DB, name, websiteURL string) (entry *models.CatalogPlatform, byName bool, err error) {
+	name = strings.TrimSpace(name)
+	if name != "" {
+		var found models.CatalogPlatform
+		err = db.Where("LOWER(name) = ?", strings.ToLower(name)).First(&found).Error
+		if err == nil {
+			return &found, true, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, err
+		}
+	}
+
+	domainSource := websiteURL
+	if strings.TrimSpace(domainSource) == "" && strings.Contains(name, ".") {
+		domainSource = name
+	}
+	addr, ok := urlmatch.Parse(domainSource)
+	if !ok || addr.BaseDomain == "" {
+		return nil, false, nil
+	}
+	// 用 LIKE 粗筛后在内存中精确比较空格分隔的域名列表，避免依赖各数据库不同的字符串拼接函数
+	var entries []models.CatalogPlatform
+	if err := db.Where("domains LIKE ?", "%"+addr.BaseDomain+"%").Order("id").Find(&entries).Error; err != nil {
+		return nil, false, err
+	}
+	for i := range entries {
+		for _, domain := range entries[i].DomainList() {
+			if domain == addr.BaseDomain {
+				return &entries[i], false, nil
+			}
+		}
+	}
+	return nil, false, nil
+}
+
+// findCatalogPlatformByParam 按路径参数 id 查找目录条目，失败时已写入错误响应
+func findCatalogPlatformByParam(c *gin.Context) (*models.CatalogPlatform, bool) {
+	id, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的ID格式")
+		return nil, false
+	}
+	var entry models.CatalogPlatform
+	if err := database.DB.First(&entry, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendErrorResponse(c, http.StatusNotFound, "平台目录条目不存在")
+		} else {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "查询平台目录失败")
+		}
+		return nil, false
+	}
+	return &entry, true
+}
+
+// GetPlatformCatalog 获取平台目录
+// @Summary 获取平台目录
+// @Description 管理员维护的共享平台目录，包括规范名称、域名、分类、图标、修改密码地址、2FA 支持和常见计费周期。q 按名称或域名模糊搜索
+// @Tags PlatformCatalog
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "按名称或域名搜索"
+// @Success 200 {object} models.SuccessResponse{data=[]models.CatalogPlatformResponse} "获取成功"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /platform-catalog [get]
+func GetPlatformCatalog(c *gin.Context) {
+	query := database.DB.Model(&models.CatalogPlatform{})
+	if q := strings.ToLower(strings.TrimSpace(c.Query("q"))); q != "" {
+		like := "%" + q + "%"
+		query = query.Where("LOWER(name) LIKE ? OR domains LIKE ?", like, like)
+	}
+	var entries []models.CatalogPlatform
+	if err := query.Order("name").Find(&entries).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询平台目录失败")
+		return
+	}
+	responses := make([]models.CatalogPlatformResponse, 0, len(entries))
+	for i := range entries {
+		responses = append(responses, entries[i].ToResponse())
+	}
+	utils.SendSuccessResponse(c, responses)
+}
+
+// CreateCatalogPlatform 创建平台目录条目（管理员功能）
+// @Summary 创建平台目录条目
+// @Description 域名可以是网址或裸域名，统一保存为可注册域名，第一个为主域名（用于获取图标）
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param entry body models.CatalogPlatformInput true "目录条目"
+// @Success 201 {object} models.SuccessResponse{data=models.CatalogPlatformResponse} "创建成功"
+// @Failure 400 {object} models.ErrorResponse "请求参数错误"
+// @Failure 409 {object} models.ErrorResponse "名称已存在"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /admin/platform-catalog [post]
+func CreateCatalogPlatform(c *gin.Context) {
+	var input models.CatalogPlatformInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	var entry models.CatalogPlatform
+	if msg := buildCatalogPlatform(&input, &entry); msg != "" {
+		utils.SendErrorResponse(c, http.StatusBadRequest, msg)
+		return
+	}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		if utils.IsUniqueConstraintError(err) {
+			utils.SendErrorResponse(c, http.StatusConflict, "该名称的平台目录条目已存在")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "创建平台目录条目失败")
+		return
+	}
+	log.Printf("管理员创建了平台目录条目 '%s'", entry.Name)
+	utils.SendCreatedResponse(c, entry.ToResponse())
+}
+
+// UpdateCatalogPlatform 更新平台目录条目（管理员功能）
+// @Summary 更新平台目录条目
+// @Description 整体替换条目内容。已关联的用户平台保留自己的名称和网址
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "目录条目ID"
+// @Param entry body models.CatalogPlatformInput true "目录条目"
+// @Success 200 {object} models.SuccessResponse{data=models.CatalogPlatformResponse} "更新成功"
+// @Failure 400 {object} models.ErrorResponse "请求参数错误"
+// @Failure 404 {object} models.ErrorResponse "条目不存在"
+// @Failure 409 {object} models.ErrorResponse "名称已存在"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /admin/platform-catalog/{id} [put]
+func UpdateCatalogPlatform(c *gin.Context) {
+	entry, ok := findCatalogPlatformByParam(c)
+	if !ok {
+		return
+	}
+	var input models.CatalogPlatformInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if msg := buildCatalogPlatform(&input, entry); msg != "" {
+		utils.SendErrorResponse(c, http.StatusBadRequest, msg)
+		return
+	}
+	if err := database.DB.Save(entry).Error; err != nil {
+		if utils.IsUniqueConstraintError(err) {
+			utils.SendErrorResponse(c, http.StatusConflict, "该名称的平台目录条目已存在")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "更新平台目录条目失败")
+		return
+	}
+	utils.SendSuccessResponse(c, entry.ToResponse())
+}
+
+// DeleteCatalogPlatform 删除平台目录条目（管理员功能）
+// @Summary 删除平台目录条目
+// @Description 用户的平台不会被删除，只是解除与该条目的关联
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "目录条目ID"
+// @Success 200 {object} models.SuccessResponse "删除成功"
+// @Failure 400 {object} models.ErrorResponse "无效的ID格式"
+// @Failure 404 {object} models.ErrorResponse "条目不存在"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /admin/platform-catalog/{id} [delete]
+func DeleteCatalogPlatform(c *gin.Context) {
+	entry, ok := findCatalogPlatformByParam(c)
+	if !ok {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 用 UpdateColumn 避免修改用户平台的更新时间
+		if err := tx.Model(&models.Platform{}).Unscoped().Where("catalog_platform_id = ?", entry.ID).
+			UpdateColumn("catalog_platform_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(entry).Error
+	})
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "删除平台目录条目失败")
+		return
+	}
+	log.Printf("管理员删除了平台目录条目 '%s'", entry.Name)
+	utils.SendSuccessResponse(c, gin.H{"message": "平台目录条目已删除"})
+}
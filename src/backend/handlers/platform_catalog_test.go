@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"email_server/config"
+	"email_server/favicon"
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlatformCatalog_AdminCRUDAndResolve(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	session := registerUser(t, r, "nina", "nina@example.com")
+
+	w := doAdminJSON(r, "POST", "/api/v1/admin/platform-catalog", map[string]interface{}{
+		"name": "GitHub", "domains": []string{"https://www.github.com/login", "GitHub.com", "githubstatus.com"},
+		"category": "开发", "password_change_url": "https://github.com/settings/security",
+		"two_factor_methods": []string{"TOTP", "webauthn", "totp"}, "billing_cycles": []string{"monthly", "yearly"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var github models.CatalogPlatformResponse
+	decodeData(t, w, &github)
+	assert.Equal(t, []string{"github.com", "githubstatus.com"}, github.Domains, "域名保存为去重后的可注册域名")
+	assert.Equal(t, []string{"totp", "webauthn"}, github.TwoFactorMethods)
+	assert.True(t, github.Supports2FA)
+	assert.Equal(t, "/api/v1/favicons/github.com", github.FaviconURL)
+
+	w = doAdminJSON(r, "POST", "/api/v1/admin/platform-catalog", map[string]interface{}{"name": "GitHub", "domains": []string{"github.io"}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doAdminJSON(r, "POST", "/api/v1/admin/platform-catalog", map[string]interface{}{"name": "Bad", "domains": []string{"bad.example"}, "two_factor_methods": []string{"carrier-pigeon"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doAdminJSON(r, "POST", "/api/v1/admin/platform-catalog", map[string]interface{}{"name": "Bad", "domains": []string{"localhost"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doAuthJSON(r, "GET", "/api/v1/platform-catalog?q=GITHUB", session.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var found []models.CatalogPlatformResponse
+	decodeData(t, w, &found)
+	require.Len(t, found, 1)
+
+	// 按名称匹配时使用规范名称并补全官方网址
+	byName := createTestPlatform(t, r, session.Token, map[string]interface{}{"name": "github"})
+	assert.Equal(t, "GitHub", byName.Name)
+	assert.Equal(t, "https://github.com", byName.WebsiteURL)
+	require.NotNil(t, byName.Catalog)
+	assert.Equal(t, "https://github.com/settings/security", byName.Catalog.PasswordChangeURL)
+	assert.Equal(t, "/api/v1/favicons/github.com", byName.FaviconURL)
+
+	// 按域名匹配时保留用户填写的名称
+	byDomain := createTestPlatform(t, r, session.Token, map[string]interface{}{"name": "Status", "website_url": "https://www.githubstatus.com"})
+	assert.Equal(t, "Status", byDomain.Name)
+	require.NotNil(t, byDomain.CatalogPlatformID)
+	assert.Equal(t, github.ID, *byDomain.CatalogPlatformID)
+	assert.Equal(t, "/api/v1/favicons/www.githubstatus.com", byDomain.FaviconURL)
+
+	unmatched := createTestPlatform(t, r, session.Token, map[string]interface{}{"name": "Internal Wiki"})
+	assert.Nil(t, unmatched.CatalogPlatformID)
+	assert.Empty(t, unmatched.FaviconURL)
+
+	// 通过名称创建注册信息时，输入的域名解析到已有的 GitHub 平台
+	w = doAuthJSON(r, "POST", "/api/v1/platform-registrations/by-name", session.Token, map[string]interface{}{
+		"platform_name": "github.com", "login_username": "nina",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var registration models.PlatformRegistrationResponse
+	decodeData(t, w, &registration)
+	assert.Equal(t, byName.ID, registration.PlatformID)
+
+	// 修改目录条目后，已关联的平台返回新的目录信息
+	w = doAdminJSON(r, "PUT", "/api/v1/admin/platform-catalog/"+strconv.FormatUint(uint64(github.ID), 10), map[string]interface{}{
+		"name": "GitHub", "domains": []string{"github.com"}, "password_change_url": "https://github.com/settings/password",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doAuthJSON(r, "GET", "/api/v1/platforms", session.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var platforms []models.PlatformResponse
+	decodeData(t, w, &platforms)
+	for _, p := range platforms {
+		if p.ID == byName.ID {
+			require.NotNil(t, p.Catalog)
+			assert.Equal(t, "https://github.com/settings/password", p.Catalog.PasswordChangeURL)
+			assert.False(t, p.Catalog.Supports2FA)
+		}
+	}
+
+	// 删除目录条目只解除关联，不删除用户的平台
+	w = doAdminJSON(r, "DELETE", "/api/v1/admin/platform-catalog/"+strconv.FormatUint(uint64(github.ID), 10), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var linked int64
+	require.NoError(t, db.Model(&models.Platform{}).Where("catalog_platform_id IS NOT NULL").Count(&linked).Error)
+	assert.Zero(t, linked)
+	var total int64
+	require.NoError(t, db.Model(&models.Platform{}).Count(&total).Error)
+	assert.EqualValues(t, 3, total)
+}
+
+func TestGetFavicon_FetchesOnceAndCaches(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	config.AppConfig.Favicon = config.FaviconConfig{Enabled: true, CacheDays: 7}
+	session := registerUser(t, r, "otto", "otto@example.com")
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch {
+		case req.Host == "icons.example" && req.URL.Path == "/":
+			w.Write([]byte(`<html><head><link rel="shortcut icon" href="/static/icon.png"></head></html>`))
+		case req.Host == "icons.example" && req.URL.Path == "/static/icon.png":
+			w.Write(png)
+		case req.URL.Path == "/favicon.ico" && req.Host == "svg.example":
+			w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"></svg>`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	// 所有主机名都连接到测试服务器
+	previous := faviconFetcher
+	fetcher := favicon.NewFetcher(time.Second, true)
+	fetcher.Scheme = "http"
+	fetcher.Client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	faviconFetcher = fetcher
+	t.Cleanup(func() { faviconFetcher = previous })
+
+	w := doAuthJSON(r, "GET", "/api/v1/favicons/Icons.Example", session.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, png, w.Body.Bytes())
+	fetched := atomic.LoadInt32(&requests)
+
+	w = doAuthJSON(r, "GET", "/api/v1/favicons/icons.example", session.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, fetched, atomic.LoadInt32(&requests), "缓存有效期内不再访问网站")
+
+	// SVG 不予缓存，获取失败的结果同样缓存
+	w = doAuthJSON(r, "GET", "/api/v1/favicons/svg.example", session.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var missing models.Favicon
+	require.NoError(t, db.Where("domain = ?", "svg.example").First(&missing).Error)
+	assert.True(t, missing.Missing)
+	fetched = atomic.LoadInt32(&requests)
+	w = doAuthJSON(r, "GET", "/api/v1/favicons/svg.example", session.Token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, fetched, atomic.LoadInt32(&requests))
+
+	for _, bad := range []string{"127.0.0.1", "localhost", "icons.example:8080"} {
+		w = doAuthJSON(r, "GET", "/api/v1/favicons/"+bad, session.Token, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, bad)
+	}
+}
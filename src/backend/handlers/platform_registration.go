@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -21,6 +22,7 @@ type CreatePlatformRegistrationInput struct {
 	LoginPassword string `json:"login_password" binding:"omitempty,min=6"` // 密码可选
 	Notes         string `json:"notes"`
 	PhoneNumber   string `json:"phone_number"` // 手机号码，可选
+	TOTPSecret    string `json:"totp_secret"`  // TOTP 密钥或 otpauth:// 链接，可选
 	// 可以根据需要添加 Provider (针对EmailAccount) 和 WebsiteURL (针对Platform)
 	// EmailProvider    string `json:"email_provider"`
 	// PlatformWebsiteURL string `json:"platform_website_url"`
@@ -34,6 +36,32 @@ type CreatePlatformRegistrationWithIDsInput struct {
 	LoginPassword  string `json:"login_password" binding:"omitempty,min=6"` // 密码可选
 	Notes          string `json:"notes"`
 	PhoneNumber    string `json:"phone_number"` // 手机号码，可选
+	TOTPSecret     string `json:"totp_secret"`  // TOTP 密钥或 otpauth:// 链接，可选
+}
+
+// encryptTOTPSecret 校验并加密 TOTP 密钥，空字符串表示未设置
+func encryptTOTPSecret(input string) (string, error) {
+	if strings.TrimSpace(input) == "" {
+		return "", nil
+	}
+	secret, err := utils.NormalizeTOTPSecret(input)
+	if err != nil {
+		return "", err
+	}
+	return utils.EncryptPassword(secret)
+}
+
+// registrationTOTP 计算平台注册信息当前的 TOTP 验证码
+func registrationTOTP(registration models.PlatformRegistration, now time.Time) (*models.AutofillTOTP, error) {
+	secret, err := utils.DecryptPassword(registration.TOTPSecretEncrypted)
+	if err != nil {
+		return nil, err
+	}
+	code, remaining, err := utils.GenerateTOTP(secret, now)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AutofillTOTP{Code: code, ExpiresIn: int(remaining / time.Second)}, nil
 }
 
 // CreatePlatformRegistrationWithIDs godoc
@@ -69,6 +97,16 @@ func CreatePlatformRegistrationWithIDs(c *gin.Context) {
 		return
 	}
 
+	encryptedTOTPSecret, totpErr := encryptTOTPSecret(input.TOTPSecret)
+	if totpErr != nil {
+		if errors.Is(totpErr, utils.ErrInvalidTOTPSecret) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "无效的 TOTP 密钥")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "TOTP 密钥加密失败: "+totpErr.Error())
+		return
+	}
+
 	// 开始事务
 	tx := database.DB.Begin()
 	defer func() {
@@ -177,10 +215,11 @@ func CreatePlatformRegistrationWithIDs(c *gin.Context) {
 		LoginPasswordEncrypted: encryptedPassword,
 		Notes:                  input.Notes,
 		PhoneNumber:            input.PhoneNumber,
+		TOTPSecretEncrypted:    encryptedTOTPSecret,
 	}
 	if createErr := tx.Create(&registration).Error; createErr != nil {
 		tx.Rollback()
-		if strings.Contains(createErr.Error(), "UNIQUE constraint failed") {
+		if utils.IsUniqueConstraintError(createErr) {
 			// 根据输入推断是哪个约束冲突
 			// 优先判断 EmailAccountID 是否可能导致冲突，因为它有一个涉及 EmailAccountID 的唯一索引组合
 			// uq_user_platform_emailaccountid: (UserID, PlatformID, EmailAccountID)
@@ -255,6 +294,16 @@ func CreatePlatformRegistrationByNames(c *gin.Context) {
 	}
 	// --- 校验结束 ---
 
+	encryptedTOTPSecret, totpErr := encryptTOTPSecret(input.TOTPSecret)
+	if totpErr != nil {
+		if errors.Is(totpErr, utils.ErrInvalidTOTPSecret) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "无效的 TOTP 密钥")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "TOTP 密钥加密失败: "+totpErr.Error())
+		return
+	}
+
 	// 开始事务
 	tx := database.DB.Begin()
 	defer func() {
@@ -296,6 +345,17 @@ func CreatePlatformRegistrationByNames(c *gin.Context) {
 	// 查找或创建 Platform
 	var platform models.Platform
 	err = tx.Where("name = ? AND user_id = ?", input.PlatformName, currentUserID).First(&platform).Error
+	var catalog *models.CatalogPlatform
+	if err == gorm.ErrRecordNotFound {
+		// 按名称或域名匹配平台目录，使用规范名称查找（如输入 github 或 github.com 时查找 GitHub）
+		catalog, _, err = resolveCatalogPlatform(tx, input.PlatformName, "")
+		if err == nil {
+			err = gorm.ErrRecordNotFound
+			if catalog != nil && catalog.Name != input.PlatformName {
+				err = tx.Where("name = ? AND user_id = ?", catalog.Name, currentUserID).First(&platform).Error
+			}
+		}
+	}
 	if err != nil {
 		if err == gorm.ErrRecordNotFound { // 完全不存在，创建新的
 			platform = models.Platform{
@@ -304,6 +364,13 @@ func CreatePlatformRegistrationByNames(c *gin.Context) {
 				WebsiteURL: "", // 可以从 input.PlatformWebsiteURL 获取 (如果 CreatePlatformRegistrationInput 有此字段)
 				Notes:      "", // 可以从 input.Notes 获取 (如果 CreatePlatformRegistrationInput 有此字段，但通常notes是registration的)
 			}
+			if catalog != nil {
+				platform.Name = catalog.Name
+				platform.CatalogPlatformID = &catalog.ID
+				if domain := catalog.PrimaryDomain(); domain != "" {
+					platform.WebsiteURL = "https://" + domain
+				}
+			}
 			if createErr := tx.Create(&platform).Error; createErr != nil {
 				tx.Rollback()
 				utils.SendErrorResponse(c, http.StatusInternalServerError, "创建平台失败: "+createErr.Error())
@@ -401,10 +468,11 @@ func CreatePlatformRegistrationByNames(c *gin.Context) {
 		LoginPasswordEncrypted: encryptedPassword,
 		Notes:                  input.Notes,
 		PhoneNumber:            input.PhoneNumber,
+		TOTPSecretEncrypted:    encryptedTOTPSecret,
 	}
 	if createErr := tx.Create(&registration).Error; createErr != nil {
 		tx.Rollback()
-		if strings.Contains(createErr.Error(), "UNIQUE constraint failed") {
+		if utils.IsUniqueConstraintError(createErr) {
 			// 根据输入推断是哪个约束冲突
 			if input.LoginUsername != "" {
 				// 假设是用户名冲突
@@ -678,7 +746,7 @@ func GetPlatformRegistrationByID(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "平台注册ID"
-// @Param platformRegistration body object{email_address=string,login_username=string,login_password=string,notes=string,phone_number=string} true "要更新的平台注册信息。邮箱地址会自动查找或创建对应的邮箱账户。密码可选。"
+// @Param platformRegistration body object{email_address=string,login_username=string,login_password=string,notes=string,phone_number=string,totp_secret=string} true "要更新的平台注册信息。邮箱地址会自动查找或创建对应的邮箱账户。密码可选。"
 // @Success 200 {object} models.SuccessResponse{data=models.PlatformRegistrationResponse} "更新成功"
 // @Failure 400 {object} models.ErrorResponse "请求参数错误或无效的ID格式"
 // @Failure 401 {object} models.ErrorResponse "用户未认证"
@@ -727,13 +795,16 @@ func UpdatePlatformRegistration(c *gin.Context) {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询待更新平台注册信息失败: "+err.Error())
 		return
 	}
+	// 记录修改前的快照，用于写入版本历史
+	before := registration.Snapshot()
 
 	var input struct {
-		EmailAddress  string `json:"email_address" binding:"omitempty,email"` // 修改为接受邮箱地址
-		LoginUsername string `json:"login_username"`
-		LoginPassword string `json:"login_password" binding:"omitempty,min=6"` // 密码可选
-		Notes         string `json:"notes"`
-		PhoneNumber   string `json:"phone_number"` // 手机号码，可选
+		EmailAddress  string  `json:"email_address" binding:"omitempty,email"` // 修改为接受邮箱地址
+		LoginUsername string  `json:"login_username"`
+		LoginPassword string  `json:"login_password" binding:"omitempty,min=6"` // 密码可选
+		Notes         string  `json:"notes"`
+		PhoneNumber   string  `json:"phone_number"` // 手机号码，可选
+		TOTPSecret    *string `json:"totp_secret"`  // TOTP 密钥；不传表示不修改，空字符串表示清除
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -742,6 +813,20 @@ func UpdatePlatformRegistration(c *gin.Context) {
 		return
 	}
 
+	if input.TOTPSecret != nil {
+		encryptedTOTPSecret, err := encryptTOTPSecret(*input.TOTPSecret)
+		if err != nil {
+			tx.Rollback()
+			if errors.Is(err, utils.ErrInvalidTOTPSecret) {
+				utils.SendErrorResponse(c, http.StatusBadRequest, "无效的 TOTP 密钥")
+				return
+			}
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "TOTP 密钥加密失败: "+err.Error())
+			return
+		}
+		registration.TOTPSecretEncrypted = encryptedTOTPSecret
+	}
+
 	originalLoginUsername := registration.LoginUsername
 	// 更新基本字段
 	if input.LoginUsername != "" {
@@ -855,10 +940,16 @@ func UpdatePlatformRegistration(c *gin.Context) {
 	}
 	// --- 校验结束 ---
 
+	if err := recordRevision(tx, c, registration.UserID, models.RevisionEntityPlatformRegistration, registration.ID, models.RevisionActionUpdate, before, before.DiffFields(registration.Snapshot())); err != nil {
+		tx.Rollback()
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "保存版本历史失败: "+err.Error())
+		return
+	}
+
 	if err := tx.Save(&registration).Error; err != nil {
 		tx.Rollback()
 		// 理论上，如果前面的检查都通过了，这里的保存不应再触发唯一约束错误，但以防万一
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") { // 检查 SQLite 特有的唯一约束错误
+		if utils.IsUniqueConstraintError(err) {
 			// 尝试判断是哪个字段引起的冲突
 			// 注意：这里的判断可能不完美，因为Save操作可能同时更新多个字段
 			// 更好的做法是进行更细致的预检查
@@ -961,9 +1052,50 @@ func GetPlatformRegistrationPassword(c *gin.Context) {
 	utils.SendSuccessResponse(c, response)
 }
 
+// GetPlatformRegistrationTOTP godoc
+// @Summary 获取平台注册的 TOTP 验证码
+// @Description 根据保存的 TOTP 密钥计算当前的两步验证码
+// @Tags PlatformRegistrations
+// @Produce json
+// @Param id path int true "平台注册ID"
+// @Success 200 {object} models.SuccessResponse{data=models.AutofillTOTP} "获取成功"
+// @Failure 400 {object} models.ErrorResponse "无效的ID格式"
+// @Failure 404 {object} models.ErrorResponse "平台注册信息未找到或未设置 TOTP 密钥"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /platform-registrations/{id}/totp [get]
+// @Security BearerAuth
+func GetPlatformRegistrationTOTP(c *gin.Context) {
+	registrationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的平台注册ID格式")
+		return
+	}
+
+	var registration models.PlatformRegistration
+	if err := database.DB.Where("id = ? AND user_id = ?", registrationID, c.GetInt64("user_id")).First(&registration).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.SendErrorResponse(c, http.StatusNotFound, "平台注册信息未找到或无权访问")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取平台注册信息失败: "+err.Error())
+		return
+	}
+	if registration.TOTPSecretEncrypted == "" {
+		utils.SendErrorResponse(c, http.StatusNotFound, "该注册信息未设置 TOTP 密钥")
+		return
+	}
+
+	totp, err := registrationTOTP(registration, time.Now())
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "生成 TOTP 验证码失败: "+err.Error())
+		return
+	}
+	utils.SendSuccessResponse(c, totp)
+}
+
 // DeletePlatformRegistration godoc
 // @Summary 删除指定ID的平台注册信息
-// @Description 删除当前用户拥有的指定ID的平台注册信息
+// @Description 删除当前用户拥有的指定ID的平台注册信息，连同关联的服务订阅一起移入回收站
 // @Tags PlatformRegistrations
 // @Produce json
 // @Param id path int true "平台注册ID"
@@ -1011,15 +1143,8 @@ func DeletePlatformRegistration(c *gin.Context) {
 		return
 	}
 
-	// 1. 硬删除关联的 ServiceSubscriptions
-	if err := tx.Unscoped().Where("platform_registration_id = ? AND user_id = ?", registration.ID, currentUserID).Delete(&models.ServiceSubscription{}).Error; err != nil {
-		tx.Rollback()
-		utils.SendErrorResponse(c, http.StatusInternalServerError, "删除服务订阅失败: "+err.Error())
-		return
-	}
-
-	// 2. 硬删除 PlatformRegistration
-	if err := tx.Unscoped().Delete(&registration).Error; err != nil {
+	// 注册信息及其服务订阅一起移入回收站，可通过 /trash 恢复
+	if err := moveRegistrationsToTrash(tx, currentUserID, time.Now(), "id = ?", registration.ID); err != nil {
 		tx.Rollback()
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "删除平台注册信息失败: "+err.Error())
 		return
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"strings"
+
+	"email_server/database"
+	"email_server/models"
+	"email_server/urlmatch"
+
+	"gorm.io/gorm"
+)
+
+// buildPlatformURLs 校验提交的平台网址并转换为模型，忽略空网址和重复项；match_mode 为空时按 base_domain
+func buildPlatformURLs(userID uint, inputs []models.PlatformURLInput) ([]models.PlatformURL, bool) {
+	seen := map[string]bool{}
+	urls := make([]models.PlatformURL, 0, len(inputs))
+	for _, input := range inputs {
+		pattern := strings.TrimSpace(input.URL)
+		mode := strings.TrimSpace(input.MatchMode)
+		if mode == "" {
+			mode = urlmatch.ModeBaseDomain
+		}
+		if pattern == "" {
+			continue
+		}
+		if err := (urlmatch.Rule{Pattern: pattern, Mode: mode}).Validate(); err != nil {
+			return nil, false
+		}
+		key := mode + " " + pattern
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		urls = append(urls, models.PlatformURL{UserID: userID, URL: pattern, MatchMode: mode})
+	}
+	return urls, true
+}
+
+// orderByID 预加载平台网址时按添加顺序排序
+func orderByID(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+// replacePlatformURLs 用新的网址列表替换平台原有网址，并保存平台（触发搜索索引更新）
+func replacePlatformURLs(tx *gorm.DB, platform *models.Platform, urls []models.PlatformURL) error {
+	if err := tx.Where("platform_id = ?", platform.ID).Delete(&models.PlatformURL{}).Error; err != nil {
+		return err
+	}
+	for i := range urls {
+		urls[i].ID = 0
+		urls[i].PlatformID = platform.ID
+	}
+	platform.URLs = urls
+	return tx.Save(platform).Error
+}
+
+// loadMatchablePlatforms 加载用户所有配置了网址的平台及其网址规则
+func loadMatchablePlatforms(userID uint) ([]models.Platform, error) {
+	var platforms []models.Platform
+	err := database.DB.Preload("URLs", orderByID).
+		Where("user_id = ?", userID).
+		Where("website_url <> '' OR id IN (?)", database.DB.Model(&models.PlatformURL{}).Select("platform_id").Where("user_id = ?", userID)).
+		Order("name, id").
+		Find(&platforms).Error
+	return platforms, err
+}
+
+// platformIDsForSites 返回网址规则匹配全部网址的平台 ID，用于搜索的 site: 过滤
+func platformIDsForSites(userID uint, sites []string) ([]uint, error) {
+	var addrs []urlmatch.Address
+	for _, site := range sites {
+		addr, ok := urlmatch.Parse(site)
+		if !ok {
+			return []uint{}, nil
+		}
+		addrs = append(addrs, addr)
+	}
+	platforms, err := loadMatchablePlatforms(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := []uint{}
+	for _, platform := range platforms {
+		rules := platform.MatchRules()
+		matchedAll := true
+		for _, addr := range addrs {
+			matched := false
+			for _, rule := range rules {
+				if rule.Match(addr) != "" {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				matchedAll = false
+				break
+			}
+		}
+		if matchedAll {
+			ids = append(ids, platform.ID)
+		}
+	}
+	return ids, nil
+}
+
+// senderPlatformRank 发件人域名匹配的优先级：按主机名、前缀或正则的精确规则优先于按可注册域名
+func senderPlatformRank(rule urlmatch.Rule) int {
+	if rule.Mode == "" || rule.Mode == urlmatch.ModeBaseDomain {
+		return 1
+	}
+	return 2
+}
+
+// matchSenderPlatform 按发件人地址的域名找到所属平台，未匹配时返回 nil
+func matchSenderPlatform(platforms []models.Platform, address string) *models.Platform {
+	domain := urlmatch.EmailDomain(address)
+	if domain == "" {
+		return nil
+	}
+	var best *models.Platform
+	bestRank := 0
+	for i := range platforms {
+		for _, rule := range platforms[i].MatchRules() {
+			if rank := senderPlatformRank(rule); rank > bestRank && rule.MatchDomain(domain) {
+				best, bestRank = &platforms[i], rank
+			}
+		}
+	}
+	return best
+}
+
+// annotateEmailPlatforms 按发件人域名为邮件标注所属平台
+func annotateEmailPlatforms(userID uint, emails []models.Email) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	platforms, err := loadMatchablePlatforms(userID)
+	if err != nil || len(platforms) == 0 {
+		return err
+	}
+	for i := range emails {
+		if len(emails[i].From) == 0 {
+			continue
+		}
+		if platform := matchSenderPlatform(platforms, emails[i].From[0].Address); platform != nil {
+			emails[i].PlatformID = platform.ID
+			emails[i].PlatformName = platform.Name
+		}
+	}
+	return nil
+}
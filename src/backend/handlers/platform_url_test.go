@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"email_server/database"
+	"email_server/database/dbtest"
+	"email_server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotateEmailPlatforms_MatchesSenderDomain(t *testing.T) {
+	database.DB = dbtest.Open(t)
+	platforms := []models.Platform{
+		{UserID: 1, Name: "GitHub", WebsiteURL: "https://github.com"},
+		{UserID: 1, Name: "Corp", URLs: []models.PlatformURL{{UserID: 1, URL: "corp.example", MatchMode: "base_domain"}}},
+		{UserID: 1, Name: "Corp Billing", URLs: []models.PlatformURL{{UserID: 1, URL: "https://billing.corp.example/login", MatchMode: "host"}}},
+		{UserID: 1, Name: "Pay", URLs: []models.PlatformURL{{UserID: 1, URL: `^https://mail\.pay-[a-z]+\.com/`, MatchMode: "regex"}}},
+		{UserID: 2, Name: "Other", WebsiteURL: "https://news.example.org"},
+	}
+	for i := range platforms {
+		require.NoError(t, database.DB.Create(&platforms[i]).Error)
+	}
+
+	emails := []models.Email{
+		{Subject: "Sign-in", From: []models.EmailAddress{{Address: "noreply@notifications.github.com"}}},
+		{Subject: "Welcome", From: []models.EmailAddress{{Address: "hr@corp.example"}}},
+		{Subject: "Invoice", From: []models.EmailAddress{{Address: "<invoices@eu.billing.corp.example>"}}},
+		{Subject: "Receipt", From: []models.EmailAddress{{Address: "receipts@mail.pay-eu.com"}}},
+		{Subject: "Digest", From: []models.EmailAddress{{Address: "news@news.example.org"}}},
+		{Subject: "No sender"},
+	}
+	require.NoError(t, annotateEmailPlatforms(1, emails))
+
+	assert.Equal(t, "GitHub", emails[0].PlatformName)
+	assert.Equal(t, platforms[0].ID, emails[0].PlatformID)
+	assert.Equal(t, "Corp", emails[1].PlatformName)
+	assert.Equal(t, "Corp Billing", emails[2].PlatformName, "按主机名的规则优先于按可注册域名")
+	assert.Equal(t, "Pay", emails[3].PlatformName)
+	assert.Empty(t, emails[4].PlatformName, "其他用户的平台不参与匹配")
+	assert.Zero(t, emails[5].PlatformID)
+}
+
+func TestImportBitwardenJSON_AddsPlatformURLs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database.DB = dbtest.Open(t)
+	existing := models.Platform{UserID: 1, Name: "Example", WebsiteURL: "https://example.com",
+		URLs: []models.PlatformURL{{UserID: 1, URL: "sso.example.net", MatchMode: "host"}}}
+	require.NoError(t, database.DB.Create(&existing).Error)
+
+	r := gin.New()
+	r.POST("/import/bitwarden-json", func(c *gin.Context) {
+		c.Set("user_id", int64(1))
+		c.Next()
+	}, ImportBitwardenJSONHandler)
+
+	export := `{"encrypted": false, "items": [
+  {"type": 1, "name": "Example", "login": {"username": "alice", "uris": [
+    {"match": null, "uri": "https://example.com"},
+    {"match": 1, "uri": "sso.example.net"},
+    {"match": 3, "uri": "https://exact.example.io/login"},
+    {"match": 4, "uri": "(unclosed"}
+  ]}},
+  {"type": 1, "name": "New Site", "login": {"username": "bob", "uris": [
+    {"match": 0, "uri": "https://new.example.org"},
+    {"match": 2, "uri": "https://new.example.org/app/"}
+  ]}}
+]}`
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "bitwarden.json")
+	require.NoError(t, err)
+	_, err = part.Write([]byte(export))
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+	req := httptest.NewRequest(http.MethodPost, "/import/bitwarden-json", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "(unclosed")
+
+	// 已有平台只添加缺少的规则
+	var urls []models.PlatformURL
+	require.NoError(t, database.DB.Where("platform_id = ?", existing.ID).Order("id").Find(&urls).Error)
+	require.Len(t, urls, 2)
+	assert.Equal(t, `^https://exact\.example\.io/login$`, urls[1].URL)
+	assert.Equal(t, "regex", urls[1].MatchMode)
+
+	var created models.Platform
+	require.NoError(t, database.DB.Preload("URLs", orderByID).Where("name = ?", "New Site").First(&created).Error)
+	assert.Equal(t, "https://new.example.org", created.WebsiteURL)
+	require.Len(t, created.URLs, 1, "与官方网址相同的默认规则不重复保存")
+	assert.Equal(t, "starts_with", created.URLs[0].MatchMode)
+
+	var registrations int64
+	require.NoError(t, database.DB.Model(&models.PlatformRegistration{}).Count(&registrations).Error)
+	assert.EqualValues(t, 2, registrations)
+}
@@ -29,11 +29,16 @@ type ReminderInfo struct {
 }
 
 
+// reminderJobName 订阅提醒任务在系统状态中的名称
+const reminderJobName = "subscription_reminder"
+
 // StartSubscriptionReminderJob 初始化并启动订阅提醒的定时任务
 func StartSubscriptionReminderJob() {
+	const schedule = "0 1 * * *"
+	registerJob(reminderJobName, schedule, true)
 	c := cron.New()
 	// 每天凌晨1点执行 (可根据需求调整 "0 1 * * *")
-	_, err := c.AddFunc("0 1 * * *", checkUpcomingRenewals)
+	_, err := c.AddFunc(schedule, func() { runJob(reminderJobName, checkUpcomingRenewals) })
 	if err != nil {
 		log.Fatalf("Error adding cron job: %v", err)
 	}
@@ -42,7 +47,7 @@ func StartSubscriptionReminderJob() {
 }
 
 // checkUpcomingRenewals 检查即将到期的订阅并记录日志
-func checkUpcomingRenewals() {
+func checkUpcomingRenewals() error {
 	log.Println("Running daily check for upcoming renewals...")
 	db := database.DB
 
@@ -58,7 +63,7 @@ func checkUpcomingRenewals() {
 
 	if err != nil {
 		log.Printf("Error querying upcoming renewals: %v", err)
-		return
+		return err
 	}
 
 	if len(upcomingSubscriptions) > 0 {
@@ -82,6 +87,7 @@ if sub.NextRenewalDate == nil {
 	} else {
 		log.Println("No upcoming renewals found in the next 30 days.")
 	}
+	return nil
 }
 
 // GetUserReminders 获取当前认证用户的订阅提醒列表
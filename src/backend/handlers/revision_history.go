@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recordRevision 在给定事务中写入一条版本历史；changedFields 为空时视为无变化，不写入
+func recordRevision(tx *gorm.DB, c *gin.Context, ownerID uint, entityType string, entityID uint, action string, before interface{}, changedFields []string) error {
+	if len(changedFields) == 0 {
+		return nil
+	}
+
+	snapshot, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	fields, err := json.Marshal(changedFields)
+	if err != nil {
+		return err
+	}
+
+	revision := models.RevisionHistory{
+		UserID:        ownerID,
+		EntityType:    entityType,
+		EntityID:      entityID,
+		Action:        action,
+		ChangedByID:   ownerID,
+		ChangedFields: string(fields),
+		Snapshot:      string(snapshot),
+	}
+	if userIDRaw, exists := c.Get("user_id"); exists {
+		if uid, ok := userIDRaw.(int64); ok {
+			revision.ChangedByID = uint(uid)
+		}
+	}
+	if usernameRaw, exists := c.Get("username"); exists {
+		if username, ok := usernameRaw.(string); ok {
+			revision.ChangedByUsername = username
+		}
+	}
+
+	return tx.Create(&revision).Error
+}
+
+// parseRevisionParams 解析路由中的实体ID与版本ID，失败时已写入错误响应
+func parseRevisionParams(c *gin.Context) (currentUserID uint, entityID uint64, revisionID uint64, ok bool) {
+	userIDRaw, exists := c.Get("user_id")
+	if !exists {
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "用户未认证")
+		return 0, 0, 0, false
+	}
+	userID, isInt := userIDRaw.(int64)
+	if !isInt {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "用户ID类型错误")
+		return 0, 0, 0, false
+	}
+
+	entityID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的ID格式")
+		return 0, 0, 0, false
+	}
+
+	if c.Param("revisionId") != "" {
+		revisionID, err = strconv.ParseUint(c.Param("revisionId"), 10, 32)
+		if err != nil {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "无效的版本ID格式")
+			return 0, 0, 0, false
+		}
+	}
+
+	return uint(userID), entityID, revisionID, true
+}
+
+// listRevisions 分页返回某个实体的版本历史
+func listRevisions(c *gin.Context, currentUserID uint, entityType string, entityID uint64) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := database.DB.Model(&models.RevisionHistory{}).
+		Where("user_id = ? AND entity_type = ? AND entity_id = ?", currentUserID, entityType, entityID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取版本历史总数失败: "+err.Error())
+		return
+	}
+
+	var revisions []models.RevisionHistory
+	if err := query.Order("created_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&revisions).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取版本历史失败: "+err.Error())
+		return
+	}
+
+	responses := make([]models.RevisionHistoryResponse, 0, len(revisions))
+	for _, r := range revisions {
+		responses = append(responses, r.ToRevisionHistoryResponse())
+	}
+	utils.SendSuccessResponseWithMeta(c, responses, utils.CreatePaginationMeta(page, pageSize, int(total)))
+}
+
+// findRevision 查找属于当前用户且对应指定实体的版本记录，失败时已写入错误响应
+func findRevision(c *gin.Context, db *gorm.DB, currentUserID uint, entityType string, entityID, revisionID uint64) (*models.RevisionHistory, bool) {
+	var revision models.RevisionHistory
+	if err := db.Where("id = ? AND user_id = ? AND entity_type = ? AND entity_id = ?", revisionID, currentUserID, entityType, entityID).First(&revision).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.SendErrorResponse(c, http.StatusNotFound, "版本记录未找到或无权访问")
+			return nil, false
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询版本记录失败: "+err.Error())
+		return nil, false
+	}
+	return &revision, true
+}
+
+// sendRevisionPassword 解密并返回历史版本中的密码
+func sendRevisionPassword(c *gin.Context, encrypted string) {
+	if encrypted == "" {
+		utils.SendErrorResponse(c, http.StatusNotFound, "该版本未设置密码")
+		return
+	}
+	if !utils.IsEncryptedPassword(encrypted) {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "该版本的密码使用旧格式存储，无法查看。")
+		return
+	}
+	decryptedPassword, err := utils.DecryptPassword(encrypted)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "密码解密失败: "+err.Error())
+		return
+	}
+	utils.SendSuccessResponse(c, map[string]string{"password": decryptedPassword})
+}
+
+// GetPlatformRegistrationHistory godoc
+// @Summary 获取平台注册信息的版本历史
+// @Description 分页列出指定平台注册信息的历史版本（谁在何时修改了哪些字段），不包含密码
+// @Tags PlatformRegistrations
+// @Produce json
+// @Param id path int true "平台注册ID"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} models.SuccessResponse{data=[]models.RevisionHistoryResponse} "获取成功"
+// @Failure 400 {object} models.ErrorResponse "无效的ID格式"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 404 {object} models.ErrorResponse "平台注册信息未找到"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /platform-registrations/{id}/history [get]
+// @Security BearerAuth
+func GetPlatformRegistrationHistory(c *gin.Context) {
+	currentUserID, registrationID, _, ok := parseRevisionParams(c)
+	if !ok {
+		return
+	}
+
+	var registration models.PlatformRegistration
+	if err := database.DB.Where("id = ? AND user_id = ?", registrationID, currentUserID).First(&registration).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.SendErrorResponse(c, http.StatusNotFound, "平台注册信息未找到或无权访问")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取平台注册信息失败: "+err.Error())
+		return
+	}
+
+	listRevisions(c, currentUserID, models.RevisionEntityPlatformRegistration, registrationID)
+}
+
+// GetPlatformRegistrationRevisionPassword godoc
+// @Summary 获取平台注册信息历史版本中的密码
+// @Description 解密并返回指定历史版本中保存的登录密码
+// @Tags PlatformRegistrations
+// @Produce json
+// @Param id path int true "平台注册ID"
+// @Param revisionId path int true "版本ID"
+// @Success 200 {object} models.SuccessResponse{data=map[string]string} "获取成功"
+// @Failure 400 {object} models.ErrorResponse "无效的ID格式"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 404 {object} models.ErrorResponse "版本记录未找到"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /platform-registrations/{id}/history/{revisionId}/password [get]
+// @Security BearerAuth
+func GetPlatformRegistrationRevisionPassword(c *gin.Context) {
+	currentUserID, registrationID, revisionID, ok := parseRevisionParams(c)
+	if !ok {
+		return
+	}
+
+	revision, ok := findRevision(c, database.DB, currentUserID, models.RevisionEntityPlatformRegistration, registrationID, revisionID)
+	if !ok {
+		return
+	}
+
+	var snapshot models.PlatformRegistrationSnapshot
+	if err := json.Unmarshal([]byte(revision.Snapshot), &snapshot); err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "解析版本快照失败: "+err.Error())
+		return
+	}
+	sendRevisionPassword(c, snapshot.LoginPasswordEncrypted)
+}
+
+// RestorePlatformRegistrationRevision godoc
+// @Summary 恢复平台注册信息到指定历史版本
+// @Description 将平台注册信息的用户名、密码、关联邮箱、备注和手机号恢复为指定版本的值；恢复前的当前值会作为新版本保存
+// @Tags PlatformRegistrations
+// @Produce json
+// @Param id path int true "平台注册ID"
+// @Param revisionId path int true "版本ID"
+// @Success 200 {object} models.SuccessResponse{data=models.PlatformRegistrationResponse} "恢复成功"
+// @Failure 400 {object} models.ErrorResponse "无效的ID格式"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 404 {object} models.ErrorResponse "平台注册信息或版本记录未找到"
+// @Failure 409 {object} models.ErrorResponse "恢复后与现有注册信息冲突"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /platform-registrations/{id}/history/{revisionId}/restore [post]
+// @Security BearerAuth
+func RestorePlatformRegistrationRevision(c *gin.Context) {
+	currentUserID, registrationID, revisionID, ok := parseRevisionParams(c)
+	if !ok {
+		return
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	var registration models.PlatformRegistration
+	if err := tx.Where("id = ? AND user_id = ?", registrationID, currentUserID).First(&registration).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			utils.SendErrorResponse(c, http.StatusNotFound, "平台注册信息未找到或无权访问")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询平台注册信息失败: "+err.Error())
+		return
+	}
+
+	revision, ok := findRevision(c, tx, currentUserID, models.RevisionEntityPlatformRegistration, registrationID, revisionID)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+
+	var target models.PlatformRegistrationSnapshot
+	if err := json.Unmarshal([]byte(revision.Snapshot), &target); err != nil {
+		tx.Rollback()
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "解析版本快照失败: "+err.Error())
+		return
+	}
+
+	// 历史版本关联的邮箱账户可能已被删除
+	if target.EmailAccountID != nil && *target.EmailAccountID != 0 {
+		var count int64
+		if err := tx.Model(&models.EmailAccount{}).Where("id = ? AND user_id = ?", *target.EmailAccountID, currentUserID).Count(&count).Error; err != nil {
+			tx.Rollback()
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "检查关联邮箱账户失败: "+err.Error())
+			return
+		}
+		if count == 0 {
+			tx.Rollback()
+			utils.SendErrorResponse(c, http.StatusConflict, "该版本关联的邮箱账户已不存在，无法恢复")
+			return
+		}
+	}
+
+	before := registration.Snapshot()
+	changed := before.DiffFields(target)
+	if err := recordRevision(tx, c, registration.UserID, models.RevisionEntityPlatformRegistration, registration.ID, models.RevisionActionRestore, before, changed); err != nil {
+		tx.Rollback()
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "保存版本历史失败: "+err.Error())
+		return
+	}
+
+	registration.ApplySnapshot(target)
+	if err := tx.Save(&registration).Error; err != nil {
+		tx.Rollback()
+		if utils.IsUniqueConstraintError(err) {
+			utils.SendErrorResponse(c, http.StatusConflict, "恢复失败，该版本的用户名或邮箱已在此平台存在其他注册信息。")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "恢复平台注册信息失败: "+err.Error())
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "提交事务失败: "+err.Error())
+		return
+	}
+
+	if err := database.DB.Preload("EmailAccount").Preload("Platform").First(&registration, registration.ID).Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取恢复后的平台注册信息失败: "+err.Error())
+		return
+	}
+	emailAccountForResp := models.EmailAccount{}
+	if registration.EmailAccount != nil {
+		emailAccountForResp = *registration.EmailAccount
+	}
+	utils.SendSuccessResponse(c, registration.ToPlatformRegistrationResponse(emailAccountForResp, registration.Platform))
+}
+
+// GetEmailAccountHistory godoc
+// @Summary 获取邮箱账户的版本历史
+// @Description 分页列出指定邮箱账户的历史版本（谁在何时修改了哪些字段），不包含密码
+// @Tags EmailAccounts
+// @Produce json
+// @Param id path int true "邮箱账户ID"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} models.SuccessResponse{data=[]models.RevisionHistoryResponse} "获取成功"
+// @Failure 400 {object} models.ErrorResponse "无效的ID格式"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 404 {object} models.ErrorResponse "邮箱账户未找到"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /email-accounts/{id}/history [get]
+// @Security BearerAuth
+func GetEmailAccountHistory(c *gin.Context) {
+	currentUserID, emailAccountID, _, ok := parseRevisionParams(c)
+	if !ok {
+		return
+	}
+
+	var emailAccount models.EmailAccount
+	if err := database.DB.Where("id = ? AND user_id = ?", emailAccountID, currentUserID).First(&emailAccount).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.SendErrorResponse(c, http.StatusNotFound, "邮箱账户未找到或无权访问")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取邮箱账户失败: "+err.Error())
+		return
+	}
+
+	listRevisions(c, currentUserID, models.RevisionEntityEmailAccount, emailAccountID)
+}
+
+// GetEmailAccountRevisionPassword godoc
+// @Summary 获取邮箱账户历史版本中的密码
+// @Description 解密并返回指定历史版本中保存的邮箱密码
+// @Tags EmailAccounts
+// @Produce json
+// @Param id path int true "邮箱账户ID"
+// @Param revisionId path int true "版本ID"
+// @Success 200 {object} models.SuccessResponse{data=map[string]string} "获取成功"
+// @Failure 400 {object} models.ErrorResponse "无效的ID格式"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 404 {object} models.ErrorResponse "版本记录未找到"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /email-accounts/{id}/history/{revisionId}/password [get]
+// @Security BearerAuth
+func GetEmailAccountRevisionPassword(c *gin.Context) {
+	currentUserID, emailAccountID, revisionID, ok := parseRevisionParams(c)
+	if !ok {
+		return
+	}
+
+	revision, ok := findRevision(c, database.DB, currentUserID, models.RevisionEntityEmailAccount, emailAccountID, revisionID)
+	if !ok {
+		return
+	}
+
+	var snapshot models.EmailAccountSnapshot
+	if err := json.Unmarshal([]byte(revision.Snapshot), &snapshot); err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "解析版本快照失败: "+err.Error())
+		return
+	}
+	sendRevisionPassword(c, snapshot.PasswordEncrypted)
+}
+
+// RestoreEmailAccountRevision godoc
+// @Summary 恢复邮箱账户到指定历史版本
+// @Description 将邮箱账户的地址、密码、IMAP设置、备注和手机号恢复为指定版本的值；恢复前的当前值会作为新版本保存
+// @Tags EmailAccounts
+// @Produce json
+// @Param id path int true "邮箱账户ID"
+// @Param revisionId path int true "版本ID"
+// @Success 200 {object} models.SuccessResponse{data=models.EmailAccountResponse} "恢复成功"
+// @Failure 400 {object} models.ErrorResponse "无效的ID格式"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 404 {object} models.ErrorResponse "邮箱账户或版本记录未找到"
+// @Failure 409 {object} models.ErrorResponse "邮箱地址已存在"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /email-accounts/{id}/history/{revisionId}/restore [post]
+// @Security BearerAuth
+func RestoreEmailAccountRevision(c *gin.Context) {
+	currentUserID, emailAccountID, revisionID, ok := parseRevisionParams(c)
+	if !ok {
+		return
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	var emailAccount models.EmailAccount
+	if err := tx.Where("id = ? AND user_id = ?", emailAccountID, currentUserID).First(&emailAccount).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			utils.SendErrorResponse(c, http.StatusNotFound, "邮箱账户未找到或无权访问")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询邮箱账户失败: "+err.Error())
+		return
+	}
+
+	revision, ok := findRevision(c, tx, currentUserID, models.RevisionEntityEmailAccount, emailAccountID, revisionID)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+
+	var target models.EmailAccountSnapshot
+	if err := json.Unmarshal([]byte(revision.Snapshot), &target); err != nil {
+		tx.Rollback()
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "解析版本快照失败: "+err.Error())
+		return
+	}
+
+	before := emailAccount.Snapshot()
+	if err := recordRevision(tx, c, emailAccount.UserID, models.RevisionEntityEmailAccount, emailAccount.ID, models.RevisionActionRestore, before, before.DiffFields(target)); err != nil {
+		tx.Rollback()
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "保存版本历史失败: "+err.Error())
+		return
+	}
+
+	emailAccount.ApplySnapshot(target)
+	if err := tx.Save(&emailAccount).Error; err != nil {
+		tx.Rollback()
+		if utils.IsUniqueConstraintError(err) {
+			utils.SendErrorResponse(c, http.StatusConflict, "恢复失败，该版本的邮箱地址已被其他账户使用。")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "恢复邮箱账户失败: "+err.Error())
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "提交事务失败: "+err.Error())
+		return
+	}
+
+	utils.SendSuccessResponse(c, emailAccount.ToEmailAccountResponse())
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/database/dbtest"
+	"email_server/models"
+	"email_server/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupRevisionTestRouter 使用独立的内存数据库，避免与其他测试共享状态
+func setupRevisionTestRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.Config{Security: config.SecurityConfig{EncryptionKey: "0123456789abcdef0123456789abcdef"}}
+
+	db := dbtest.Open(t)
+	database.DB = db
+
+	r := gin.New()
+	auth := func(c *gin.Context) {
+		c.Set("user_id", int64(1))
+		c.Set("username", "tester")
+		c.Next()
+	}
+	r.PUT("/email-accounts/:id", auth, UpdateEmailAccount)
+	r.GET("/email-accounts/:id/history", auth, GetEmailAccountHistory)
+	r.GET("/email-accounts/:id/history/:revisionId/password", auth, GetEmailAccountRevisionPassword)
+	r.POST("/email-accounts/:id/history/:revisionId/restore", auth, RestoreEmailAccountRevision)
+	r.PUT("/platform-registrations/:id", auth, UpdatePlatformRegistration)
+	r.GET("/platform-registrations/:id/history", auth, GetPlatformRegistrationHistory)
+	r.POST("/platform-registrations/:id/history/:revisionId/restore", auth, RestorePlatformRegistrationRevision)
+	return r, db
+}
+
+func doJSON(r *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestEmailAccountHistory_UpdateAndRestore(t *testing.T) {
+	r, db := setupRevisionTestRouter(t)
+
+	oldPassword, err := utils.EncryptPassword("old-secret")
+	require.NoError(t, err)
+	account := models.EmailAccount{UserID: 1, EmailAddress: "me@example.com", Provider: "example.com", PasswordEncrypted: oldPassword, Notes: "old notes"}
+	require.NoError(t, db.Create(&account).Error)
+
+	// 修改邮箱地址时服务商随之变化
+	w := doJSON(r, http.MethodPut, "/email-accounts/1", map[string]interface{}{"email_address": "me@example.org", "password": "new-secret", "notes": "new notes"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doJSON(r, http.MethodGet, "/email-accounts/1/history", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Data []models.RevisionHistoryResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Data, 1)
+	rev := list.Data[0]
+	assert.Equal(t, "tester", rev.ChangedByUsername)
+	assert.ElementsMatch(t, []string{"email_address", "password", "provider", "notes"}, rev.ChangedFields)
+	assert.Equal(t, "old notes", rev.Values["notes"])
+	assert.Equal(t, "example.com", rev.Values["provider"])
+	assert.True(t, rev.HasPassword)
+	assert.NotContains(t, w.Body.String(), oldPassword, "history must not leak ciphertext")
+
+	w = doJSON(r, http.MethodGet, "/email-accounts/1/history/1/password", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "old-secret")
+
+	w = doJSON(r, http.MethodPost, "/email-accounts/1/history/1/restore", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var restored models.EmailAccount
+	require.NoError(t, db.First(&restored, account.ID).Error)
+	assert.Equal(t, "old notes", restored.Notes)
+	assert.Equal(t, "example.com", restored.Provider)
+	assert.Equal(t, oldPassword, restored.PasswordEncrypted)
+
+	// 恢复操作本身也会留下一条版本记录
+	var count int64
+	db.Model(&models.RevisionHistory{}).Where("entity_type = ? AND entity_id = ?", models.RevisionEntityEmailAccount, account.ID).Count(&count)
+	assert.EqualValues(t, 2, count)
+}
+
+func TestEmailAccountHistory_NoChangeNoRevision(t *testing.T) {
+	r, db := setupRevisionTestRouter(t)
+
+	account := models.EmailAccount{UserID: 1, EmailAddress: "me@example.com", Notes: "same"}
+	require.NoError(t, db.Create(&account).Error)
+
+	w := doJSON(r, http.MethodPut, "/email-accounts/1", map[string]interface{}{"notes": "same"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var count int64
+	db.Model(&models.RevisionHistory{}).Count(&count)
+	assert.EqualValues(t, 0, count)
+}
+
+func TestEmailAccountHistory_IMAPSecurity(t *testing.T) {
+	r, db := setupRevisionTestRouter(t)
+
+	account := models.EmailAccount{UserID: 1, EmailAddress: "me@example.com", IMAPServer: "imap.example.com", IMAPPort: 143}
+	require.NoError(t, db.Create(&account).Error)
+
+	w := doJSON(r, http.MethodPut, "/email-accounts/1", map[string]interface{}{"imap_server": "imap.example.com", "imap_port": 143, "imap_security": "ssl"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(r, http.MethodPut, "/email-accounts/1", map[string]interface{}{"imap_server": "imap.example.com", "imap_port": 143, "imap_security": "none"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated models.EmailAccountResponse
+	decodeData(t, w, &updated)
+	assert.Equal(t, models.IMAPSecurityNone, updated.IMAPSecurity)
+
+	w = doJSON(r, http.MethodGet, "/email-accounts/1/history", nil)
+	var list struct {
+		Data []models.RevisionHistoryResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Data, 1)
+	assert.Equal(t, []string{"imap_security"}, list.Data[0].ChangedFields)
+	assert.Equal(t, "", list.Data[0].Values["imap_security"])
+}
+
+func TestPlatformRegistrationHistory_RestoreOtherUsersRevision(t *testing.T) {
+	r, db := setupRevisionTestRouter(t)
+
+	username := "alice"
+	platform := models.Platform{UserID: 1, Name: "Example"}
+	require.NoError(t, db.Create(&platform).Error)
+	registration := models.PlatformRegistration{UserID: 1, PlatformID: platform.ID, LoginUsername: &username}
+	require.NoError(t, db.Create(&registration).Error)
+
+	w := doJSON(r, http.MethodPut, "/platform-registrations/1", map[string]interface{}{"login_username": "bob", "notes": "renamed"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doJSON(r, http.MethodGet, "/platform-registrations/1/history", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"login_username":"alice"`)
+
+	// 其他用户的版本记录不可恢复
+	require.NoError(t, db.Model(&models.RevisionHistory{}).Where("id = ?", 1).Update("user_id", 2).Error)
+	w = doJSON(r, http.MethodPost, "/platform-registrations/1/history/1/restore", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	require.NoError(t, db.Model(&models.RevisionHistory{}).Where("id = ?", 1).Update("user_id", 1).Error)
+	w = doJSON(r, http.MethodPost, "/platform-registrations/1/history/1/restore", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var restored models.PlatformRegistration
+	require.NoError(t, db.First(&restored, registration.ID).Error)
+	require.NotNil(t, restored.LoginUsername)
+	assert.Equal(t, "alice", *restored.LoginUsername)
+	assert.Equal(t, "", restored.Notes)
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"email_server/middleware"
+)
+
+// RouteLimits 各类接口使用的限流中间件
+type RouteLimits struct {
+	Auth           gin.HandlerFunc // 认证接口，按 IP
+	Login          gin.HandlerFunc // 登录接口，按用户名
+	API            gin.HandlerFunc // 需要登录的接口，按用户
+	Secret         gin.HandlerFunc // 查看明文密码的接口
+	AutofillSecret gin.HandlerFunc // 自动填充中返回密码的请求
+}
+
+// RegisterRoutes 注册全部 API 路由，main.go 与测试共用同一张路由表
+func RegisterRoutes(r *gin.Engine, limits RouteLimits) {
+	// 公开路由（不需要认证）
+	public := r.Group("/api/v1")
+	{
+		// 新的 OAuth2 路由 (公开)
+		oauth2Public := public.Group("/oauth2")
+		{
+			// oauth2Public.GET("/connect/:provider", RedirectToOAuthProvider) // Moved to protected routes
+			oauth2Public.GET("/callback/:provider", HandleOAuth2Callback)
+		}
+
+		// 认证相关
+		auth := public.Group("/auth", limits.Auth)
+		{
+			auth.POST("/register", Register)
+			auth.POST("/login", limits.Login, Login)
+			auth.POST("/refresh", RefreshToken)
+			auth.GET("/registration", GetRegistrationInfo) // 注册模式（开放/邀请/关闭）
+			auth.POST("/verify-email", VerifyEmail)        // 邮件中的验证链接
+			auth.POST("/forgot-password", ForgotPassword)  // 发送重置密码邮件
+			auth.POST("/reset-password", ResetPassword)    // 邮件中的重置密码链接
+
+			// OAuth2 相关路由
+			oauth2 := auth.Group("/oauth2")
+			{
+				oauth2.GET("/linuxdo/login", LinuxDoOAuth2Login)
+				oauth2.GET("/linuxdo/callback", LinuxDoOAuth2Callback)
+				oauth2.GET("/google/login", GoogleOAuth2Login)
+				oauth2.GET("/microsoft/login", MicrosoftOAuth2Login)
+				oauth2.GET("/stats", GetDBStateStats)               // 监控端点 (temporarily disabled)
+				oauth2.GET("/providers", ListLoginOAuthProviders)   // 可用于登录的提供商
+				oauth2.GET("/login/:provider", OAuth2ProviderLogin) // 管理员配置的 OAuth2/OIDC 提供商登录
+			}
+		}
+
+		// Microsoft Graph 新邮件变更通知，按 clientState 校验
+		public.POST("/webhooks/graph/mail", HandleGraphMailNotification)
+
+		// 健康检查
+		public.GET("/health", func(c *gin.Context) {
+			c.JSON(200, gin.H{"status": "ok", "timestamp": time.Now()})
+		})
+	}
+
+	// 需要认证的路由
+	protected := r.Group("/api/v1")
+	protected.Use(middleware.AuthRequired())
+	protected.Use(middleware.EnforceAccountSetup())
+	protected.Use(limits.API)
+	{
+		// OAuth2 connection initiation needs to be protected to get user_id
+		oauth2Protected := protected.Group("/oauth2")
+		{
+			oauth2Protected.GET("/connect/:provider", RedirectToOAuthProvider)
+			oauth2Protected.GET("/providers", ListMailboxOAuthProviders) // 可用于关联邮箱的提供商
+		}
+
+		// 用户相关
+		// user := protected.Group("/user") // Grouping /users together
+		// {
+		// user.GET("/profile", GetProfile) // Old path
+		protected.GET("/users/me", GetProfile)                                   // New path as per plan /api/v1/users/me
+		protected.PUT("/users/me", UpdateProfile)                                // 更新用户资料路由
+		protected.POST("/users/me/change-password", ChangePassword)              // 修改密码路由
+		protected.POST("/users/me/verify-email/resend", ResendVerificationEmail) // 重新发送验证邮件
+		protected.GET("/users/me/identities", GetUserIdentities)                 // 已绑定的登录方式
+		protected.GET("/users/me/identities/link/:provider", StartIdentityLink)  // 发起绑定登录方式
+		protected.POST("/users/me/identities/confirm", ConfirmIdentityLink)      // 确认绑定邮箱冲突时暂存的身份
+		protected.DELETE("/users/me/identities/:id", DeleteUserIdentity)         // 解绑登录方式
+		protected.GET("/users/me/api-tokens", GetAPITokens)                      // 个人 API token
+		protected.GET("/users/me/api-tokens/scopes", GetAPITokenScopes)          // 可用的权限范围
+		protected.POST("/users/me/api-tokens", CreateAPIToken)                   // 创建 API token
+		protected.DELETE("/users/me/api-tokens/:id", DeleteAPIToken)             // 吊销 API token
+		// user.POST("/logout", Logout) // Moved to /auth/logout
+		// }
+
+		// Auth related routes that need protection (e.g. logout)
+		authProtected := protected.Group("/auth")
+		{
+			authProtected.POST("/logout", Logout) // New path as per plan /api/v1/auth/logout
+		}
+
+		// EmailAccount 模块
+		emailAccounts := protected.Group("/email-accounts")
+		{
+			emailAccounts.POST("", CreateEmailAccount)
+			emailAccounts.GET("", GetEmailAccounts)
+			emailAccounts.GET("/:id", GetEmailAccountByID)
+			emailAccounts.GET("/:id/password", limits.Secret, GetEmailAccountPassword) // 新增：获取邮箱账户密码
+			emailAccounts.PUT("/:id", UpdateEmailAccount)
+			emailAccounts.DELETE("/:id", DeleteEmailAccount)
+			emailAccounts.GET("/providers", GetEmailAccountProviders)                                              // 新增：获取唯一服务商列表
+			emailAccounts.GET("/:id/platform-registrations", GetPlatformRegistrationsByEmailAccountID)             // 修改参数名
+			emailAccounts.GET("/:id/history", GetEmailAccountHistory)                                              // 新增：版本历史
+			emailAccounts.GET("/:id/history/:revisionId/password", limits.Secret, GetEmailAccountRevisionPassword) // 新增：历史版本密码
+			emailAccounts.POST("/:id/history/:revisionId/restore", RestoreEmailAccountRevision)                    // 新增：恢复历史版本
+		}
+
+		// Inbox
+		protected.GET("/inbox", GetInbox)
+		protected.GET("/inbox/unified", GetUnifiedInbox)
+		protected.GET("/inbox/search", SearchMailbox)
+		protected.GET("/inbox/threads", GetThreads)
+		protected.GET("/inbox/threads/:id", GetThreadDetail)
+		protected.GET("/inbox/watches", GetMailWatches)
+		protected.PUT("/inbox/watches/:accountId", UpdateMailWatch)
+		protected.GET("/inbox/events", StreamNewMailEvents) // 新邮件推送（SSE）
+		protected.GET("/inbox/new-mail-events", GetNewMailEvents)
+		protected.GET("/inbox/emails/:messageId", GetEmailDetail)
+		protected.POST("/inbox/emails/:messageId/mark-read", MarkEmailAsRead)
+		protected.POST("/inbox/emails/:messageId/actions", PerformEmailAction)
+		protected.POST("/inbox/actions", BatchEmailAction)
+		protected.GET("/inbox/remote-content-senders", GetRemoteContentSenders)
+		protected.POST("/inbox/remote-content-senders", CreateRemoteContentSender)
+		protected.DELETE("/inbox/remote-content-senders/:id", DeleteRemoteContentSender)
+
+		// Platform 模块
+		platforms := protected.Group("/platforms")
+		{
+			platforms.POST("", CreatePlatform)
+			platforms.GET("", GetPlatforms)
+			platforms.GET("/:id", GetPlatformByID)
+			platforms.PUT("/:id", UpdatePlatform)
+			platforms.DELETE("/:id", DeletePlatform)
+			platforms.GET("/:id/email-registrations", GetEmailRegistrationsByPlatformID) // 修改参数名
+		}
+
+		// 平台目录和网站图标
+		protected.GET("/platform-catalog", GetPlatformCatalog)
+		protected.GET("/favicons/:domain", GetFavicon)
+
+		// PlatformRegistration 模块
+		platformRegistrations := protected.Group("/platform-registrations")
+		{
+			platformRegistrations.POST("", CreatePlatformRegistrationWithIDs)         // 通过ID创建
+			platformRegistrations.POST("/by-name", CreatePlatformRegistrationByNames) // 通过名称创建
+			platformRegistrations.GET("", GetPlatformRegistrations)
+			platformRegistrations.GET("/:id", GetPlatformRegistrationByID)
+			platformRegistrations.GET("/:id/password", limits.Secret, GetPlatformRegistrationPassword) // 获取密码
+			platformRegistrations.GET("/:id/totp", limits.Secret, GetPlatformRegistrationTOTP)         // 获取 TOTP 验证码
+			platformRegistrations.PUT("/:id", UpdatePlatformRegistration)
+			platformRegistrations.DELETE("/:id", DeletePlatformRegistration)
+			platformRegistrations.GET("/:id/service-subscriptions", GetServiceSubscriptionsByPlatformRegistrationID)
+			platformRegistrations.GET("/:id/history", GetPlatformRegistrationHistory)                                              // 新增：版本历史
+			platformRegistrations.GET("/:id/history/:revisionId/password", limits.Secret, GetPlatformRegistrationRevisionPassword) // 新增：历史版本密码
+			platformRegistrations.POST("/:id/history/:revisionId/restore", RestorePlatformRegistrationRevision)                    // 新增：恢复历史版本
+		}
+
+		// 浏览器插件自动填充
+		autofill := protected.Group("/autofill")
+		{
+			autofill.GET("", limits.AutofillSecret, Autofill) // 按页面网址查找登录信息，返回密码时按查看密码限流
+			autofill.GET("/equivalent-domains", GetEquivalentDomains)
+			autofill.POST("/equivalent-domains", CreateEquivalentDomain)
+			autofill.DELETE("/equivalent-domains/:id", DeleteEquivalentDomain)
+		}
+
+		// ServiceSubscription 模块
+		serviceSubscriptions := protected.Group("/service-subscriptions")
+		{
+			serviceSubscriptions.POST("", CreateServiceSubscription)
+			serviceSubscriptions.GET("", GetServiceSubscriptions)
+			serviceSubscriptions.GET("/distinct-platform-names", GetDistinctPlatformNames) // 新增
+			serviceSubscriptions.GET("/distinct-emails", GetDistinctEmails)                // 新增
+			serviceSubscriptions.GET("/distinct-usernames", GetDistinctUsernames)          // 新增
+			serviceSubscriptions.GET("/:id", GetServiceSubscriptionByID)
+			serviceSubscriptions.PUT("/:id", UpdateServiceSubscription)
+			serviceSubscriptions.DELETE("/:id", DeleteServiceSubscription)
+		}
+
+		// 导入模块
+		importerGroup := protected.Group("/import") // 使用 importer 而不是 import 避免与 Go 关键字冲突
+		{
+			importerGroup.POST("/bitwarden-csv", ImportBitwardenCSVHandler)
+			importerGroup.POST("/bitwarden-json", ImportBitwardenJSONHandler)
+		}
+
+		// 仪表板
+		protected.GET("/dashboard", GetDashboard)                // 旧的仪表盘API，已在handler中标记为弃用
+		protected.GET("/dashboard/summary", GetDashboardSummary) // 新的仪表盘摘要API
+
+		// 全局搜索
+		protected.GET("/search", SearchHandler)
+
+		// 用户提醒
+		protected.GET("/users/me/reminders", GetUserReminders)
+		protected.PUT("/users/me/reminders/:id/read", MarkReminderAsRead) // 新增：标记提醒为已读
+
+		// 回收站
+		trash := protected.Group("/trash")
+		{
+			trash.GET("", GetTrash)
+			trash.DELETE("", EmptyTrash)
+			trash.POST("/:type/:id/restore", RestoreTrashItem)
+			trash.DELETE("/:type/:id", DeleteTrashItem)
+		}
+
+		// 邮箱管理 (DEPRECATED - Use /email-accounts)
+		// emails := protected.Group("/emails")
+		// {
+		// 	emails.GET("", GetEmails)
+		// 	emails.POST("", CreateEmail)
+		// 	emails.GET("/:id", GetEmailByID)
+		// 	emails.PUT("/:id", UpdateEmail)
+		// 	emails.DELETE("/:id", DeleteEmail)
+		// 	emails.GET("/:id/services", GetEmailServices)
+		// }
+
+		// 服务管理 (DEPRECATED - Use /platforms)
+		// services := protected.Group("/services")
+		// {
+		// 	services.GET("", GetServices)
+		// 	services.POST("", CreateService)
+		// 	services.GET("/:id", GetServiceByID)
+		// 	services.PUT("/:id", UpdateService)
+		// 	services.DELETE("/:id", DeleteService)
+		// 	services.GET("/:id/emails", GetServiceEmails)
+		// }
+
+		// 邮箱服务关联管理 (DEPRECATED - Use /platform-registrations and /service-subscriptions)
+		// emailServices := protected.Group("/email-services")
+		// {
+		// 	emailServices.GET("", GetAllEmailServices)
+		// 	emailServices.POST("", CreateEmailService)
+		// 	emailServices.PUT("/:id", UpdateEmailService)
+		// 	emailServices.DELETE("/:id", DeleteEmailService)
+		// }
+	}
+
+	// 附件下载：邮件详情返回的附件地址带有签名 token，<img> 和下载链接无法携带 Authorization 头
+	r.GET("/api/v1/inbox/emails/:messageId/attachments/:attachmentId",
+		middleware.AttachmentURLAuth(), middleware.EnforceAccountSetup(), limits.API, GetEmailAttachment)
+	// 邮件远程图片代理：只接受邮件详情中返回的签名地址
+	r.GET("/api/v1/inbox/image-proxy", middleware.ImageProxyURLAuth(), limits.API, GetProxiedImage)
+
+	// 管理员路由
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.AuthRequired())
+	admin.Use(middleware.EnforceAccountSetup())
+	admin.Use(middleware.AdminRequired())
+	admin.Use(limits.API)
+	{
+		// 用户管理
+		admin.GET("/users", GetAllUsers)
+		admin.POST("/users", AdminCreateUser)
+		admin.PUT("/users/:id/status", UpdateUserStatus)                 // 更新用户状态
+		admin.PUT("/users/:id/role", UpdateUserRole)                     // 更新用户角色
+		admin.PUT("/users/:id/force-password-reset", ForcePasswordReset) // 要求下次登录修改密码
+		admin.PUT("/users/:id/verify-email", MarkEmailVerified)          // 标记邮箱已验证
+		admin.PUT("/users/:id/unlock", UnlockUser)                       // 解除连续登录失败导致的锁定
+		admin.GET("/users/:id/export", ExportUserData)                   // 导出用户数据
+		admin.DELETE("/users/:id", DeleteUser)                           // 导出后删除用户及其全部数据
+
+		// 注册邀请
+		admin.GET("/invitations", GetInvitations)
+		admin.POST("/invitations", CreateInvitation)
+		admin.DELETE("/invitations/:id", DeleteInvitation)
+
+		// 系统设置与状态
+		admin.GET("/settings/registration", GetRegistrationSettings)
+		admin.PUT("/settings/registration", UpdateRegistrationSettings)
+		admin.GET("/system/health", GetSystemHealth)
+
+		// OAuth 提供商管理
+		admin.GET("/oauth-providers", GetOAuthProviders)
+		admin.POST("/oauth-providers", CreateOAuthProvider)
+		admin.GET("/oauth-providers/:id", GetOAuthProvider)
+		admin.PUT("/oauth-providers/:id", UpdateOAuthProvider)
+		admin.DELETE("/oauth-providers/:id", DeleteOAuthProvider)
+
+		// 平台目录管理
+		admin.GET("/platform-catalog", GetPlatformCatalog)
+		admin.POST("/platform-catalog", CreateCatalogPlatform)
+		admin.PUT("/platform-catalog/:id", UpdateCatalogPlatform)
+		admin.DELETE("/platform-catalog/:id", DeleteCatalogPlatform)
+	}
+}
@@ -2,209 +2,130 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"email_server/database"
 	"email_server/models"
+	"email_server/search"
 	"email_server/utils"
 
 	"github.com/gin-gonic/gin"
-	// "gorm.io/gorm" // Removed as it's not directly used in this file after recent changes
 )
 
-// SearchHandler handles global search requests.
-// GET /search?q=...&type=...
+// searchTypeEntities 将 type 查询参数映射为搜索文档的实体类型
+var searchTypeEntities = map[string]string{
+	"email_accounts":         models.SearchEntityEmailAccount,
+	"platforms":              models.SearchEntityPlatform,
+	"platform_registrations": models.SearchEntityPlatformRegistration,
+	"service_subscriptions":  models.SearchEntityServiceSubscription,
+	"emails":                 models.SearchEntityEmail,
+}
+
+// SearchHandler godoc
+// @Summary 全局搜索
+// @Description 在邮箱账户、平台、注册信息、订阅及已缓存的邮件中进行全文搜索，结果按相关度排序。
+// @Description 语法：空格分隔的词为 AND 关系；"多个 词" 为短语；词尾 * 为前缀匹配；platform:xx、tag:xx、from:xx 为字段过滤；site:网址 按平台的网址匹配规则过滤。
+// @Tags Search
+// @Produce json
+// @Param q query string true "查询字符串"
+// @Param type query string false "all, email_accounts, platforms, platform_registrations, service_subscriptions, emails，可用逗号分隔多个" default(all)
+// @Param page query int false "页码" default(1)
+// @Param pageSize query int false "每页数量" default(20)
+// @Success 200 {object} models.SuccessResponse{data=models.GlobalSearchResponse,meta=models.PaginationMeta} "搜索结果"
+// @Failure 400 {object} models.ErrorResponse "请求参数错误"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /search [get]
+// @Security BearerAuth
 func SearchHandler(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	userID, exists := c.Get("user_id")
 	if !exists {
-		utils.SendErrorResponse(c, http.StatusUnauthorized, "User ID not found in token")
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "用户未认证")
 		return
 	}
-	currentUserID := userID.(uint)
-
-	query := strings.ToLower(strings.TrimSpace(c.Query("q")))
-	searchType := strings.ToLower(strings.TrimSpace(c.Query("type")))
+	currentUserID := uint(userID.(int64))
 
-	if query == "" {
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Search query 'q' cannot be empty")
+	raw := strings.TrimSpace(c.Query("q"))
+	if raw == "" {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "搜索关键词 q 不能为空")
 		return
 	}
 
-	var results []models.GlobalSearchResultItem
-	db := database.DB
-
-	// Search Users (example: by username, email) - Assuming User model has Username and Email fields
-	// Note: In a real application, searching all users might be an admin-only feature.
-	// For this task, we'll allow searching users but the results might be limited or need careful consideration for privacy.
-	if searchType == "users" || searchType == "all" || searchType == "" {
-		var users []models.User
-		// Adjust fields based on your User model
-		if err := db.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ?", "%"+query+"%", "%"+query+"%").Find(&users).Error; err == nil {
-			for _, u := range users {
-				// Only return current user's information if searching users, or if it's an admin search (not implemented here)
-				// This is a simplified approach. For non-admin users, they should probably only find themselves.
-				if u.ID == currentUserID { // Simplified: only show current user if "users" type is searched by non-admin
-					results = append(results, models.GlobalSearchResultItem{
-						ID:          u.ID,
-						Type:        "user",
-						DisplayName: u.Username,
-						Details: gin.H{
-							"email": u.Email,
-						},
-					})
-				}
-			}
+	var entityTypes []string
+	for _, t := range strings.Split(strings.ToLower(c.Query("type")), ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || t == "all" {
+			continue
 		}
-	}
-
-	// Search EmailAccounts (by email address, provider)
-	if searchType == "email_accounts" || searchType == "all" || searchType == "" {
-		var emailAccounts []models.EmailAccount
-		if err := db.Where("user_id = ? AND (LOWER(email_address) LIKE ? OR LOWER(provider) LIKE ?)", currentUserID, "%"+query+"%", "%"+query+"%").Find(&emailAccounts).Error; err == nil {
-			for _, ea := range emailAccounts {
-				results = append(results, models.GlobalSearchResultItem{
-					ID:          ea.ID,
-					Type:        "email_account",
-					DisplayName: ea.EmailAddress,
-					Details: gin.H{
-						"provider": ea.Provider,
-					},
-				})
-			}
+		entityType, ok := searchTypeEntities[t]
+		if !ok {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "无效的搜索类型: "+t)
+			return
 		}
+		entityTypes = append(entityTypes, entityType)
 	}
 
-	// Search Platforms (by name, url) - Public data
-	if searchType == "platforms" || searchType == "all" || searchType == "" {
-		var platforms []models.Platform
-		if err := db.Where("LOWER(name) LIKE ? OR LOWER(website) LIKE ?", "%"+query+"%", "%"+query+"%").Find(&platforms).Error; err == nil {
-			for _, p := range platforms {
-				results = append(results, models.GlobalSearchResultItem{
-					ID:          p.ID,
-					Type:        "platform",
-					DisplayName: p.Name,
-					Details: gin.H{
-						"website_url": p.WebsiteURL,
-						// "category": p.Category, // Category field does not exist in Platform model
-					},
-				})
-			}
-		}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page <= 0 {
+		page = 1
 	}
-
-	// Search PlatformRegistrations (by username, notes)
-	if searchType == "platform_registrations" || searchType == "all" || searchType == "" {
-		var platformRegistrations []models.PlatformRegistration
-		// Need to join with EmailAccount to ensure UserID match for ownership
-		// Or, if PlatformRegistration directly has UserID (which it should for direct ownership)
-		// Assuming PlatformRegistration has UserID. If not, this query needs adjustment.
-		// Let's assume PlatformRegistration has a UserID field for direct ownership.
-		// If PlatformRegistration is linked via EmailAccount, the query would be more complex.
-		// For simplicity, assuming direct UserID on PlatformRegistration or a join is handled by GORM's Preload or similar.
-		// The task implies user-specific entities, so PlatformRegistration should be filtered by currentUserID.
-		// A direct UserID on PlatformRegistration is the most straightforward for this.
-		// If it's indirect (PlatformRegistration -> EmailAccount -> User), the query needs joins.
-		// Let's assume PlatformRegistration has UserID.
-		// If not, we'll need to adjust. Reading the model file for PlatformRegistration would clarify.
-		// For now, proceeding with assumption of direct UserID.
-
-		// Correct approach: PlatformRegistrations are linked to EmailAccounts, which are linked to Users.
-		// So we need a join.
-		if err := db.Joins("JOIN email_accounts ON email_accounts.id = platform_registrations.email_account_id").
-			Where("email_accounts.user_id = ? AND (LOWER(platform_registrations.username) LIKE ? OR LOWER(platform_registrations.notes) LIKE ?)", currentUserID, "%"+query+"%", "%"+query+"%").
-			Preload("Platform"). // Preload platform to get its name for display
-			Find(&platformRegistrations).Error; err == nil {
-			for _, pr := range platformRegistrations {
-				displayName := ""
-				if pr.LoginUsername != nil {
-					displayName = *pr.LoginUsername
-				}
-				if pr.Platform.Name != "" {
-					if displayName != "" {
-						displayName = displayName + " @ " + pr.Platform.Name
-					} else {
-						displayName = pr.Platform.Name
-					}
-				}
-				results = append(results, models.GlobalSearchResultItem{
-					ID:          pr.ID,
-					Type:        "platform_registration",
-					DisplayName: displayName,
-					Details: gin.H{
-						"platform_id":   pr.PlatformID,
-						"platform_name": pr.Platform.Name, // Assumes Platform is preloaded
-						"notes":         pr.Notes,
-					},
-				})
-			}
-		}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
 	}
 
-	// Search ServiceSubscriptions (by service name, notes)
-	if searchType == "service_subscriptions" || searchType == "all" || searchType == "" {
-		var serviceSubscriptions []models.ServiceSubscription
-		// Assuming ServiceSubscription has UserID.
-		// If linked via PlatformRegistration -> EmailAccount -> User, this also needs joins.
-		// The task implies user-specific entities.
-		// Let's assume ServiceSubscription has UserID.
-		// Reading the model file for ServiceSubscription would clarify.
-		// For now, proceeding with assumption of direct UserID.
-
-		// Correct approach: ServiceSubscriptions are linked to PlatformRegistrations,
-		// which are linked to EmailAccounts, which are linked to Users. This is a multi-level join.
-		// Or, if ServiceSubscription has a direct UserID.
-		// Given the structure, it's more likely linked.
-		// Let's assume ServiceSubscription has a UserID field for simplicity of this search handler first.
-		// If not, this will need significant join clauses.
-		// The prompt says "ensure on user specific entities ... all ownership validation"
-		// This implies ServiceSubscription should be filtered by currentUserID.
-
-		// Simpler: Assume ServiceSubscription has UserID.
-		// If not, the join would be:
-		// JOIN platform_registrations ON platform_registrations.id = service_subscriptions.platform_registration_id
-		// JOIN email_accounts ON email_accounts.id = platform_registrations.email_account_id
-		// WHERE email_accounts.user_id = ?
-		// This is getting complex for a single search handler without helper functions or more direct UserID links.
-		// For now, let's assume ServiceSubscription has a UserID field.
-		// This is a common simplification if performance of deep joins is a concern for search.
-		// If ServiceSubscription.UserID does not exist, this part will fail and need rework.
-
-		// Revisiting: The most robust way is to join.
-		err := db.Joins("JOIN platform_registrations ON platform_registrations.id = service_subscriptions.platform_registration_id").
-			Joins("JOIN email_accounts ON email_accounts.id = platform_registrations.email_account_id").
-			Where("email_accounts.user_id = ? AND (LOWER(service_subscriptions.service_name) LIKE ? OR LOWER(service_subscriptions.notes) LIKE ?)", currentUserID, "%"+query+"%", "%"+query+"%").
-			Preload("PlatformRegistration.Platform"). // For context
-			Find(&serviceSubscriptions).Error
-
-		if err == nil {
-			for _, ss := range serviceSubscriptions {
-				displayName := ss.ServiceName
-				if ss.PlatformRegistration.Platform.Name != "" {
-					displayName = ss.ServiceName + " (" + ss.PlatformRegistration.Platform.Name + ")"
-				}
-
-				results = append(results, models.GlobalSearchResultItem{
-					ID:          ss.ID,
-					Type:        "service_subscription",
-					DisplayName: displayName,
-					Details: gin.H{
-						"status":                   ss.Status,
-						"billing_cycle":            ss.BillingCycle,
-						"next_renewal_date":        ss.NextRenewalDate,
-						"platform_registration_id": ss.PlatformRegistrationID,
-					},
-				})
-			}
-		} else {
-			// Log error if any during DB operation for service_subscriptions
-			// c.Error(err) // Or some other logging
+	query := search.Parse(raw)
+	opts := search.Options{
+		UserID:   currentUserID,
+		Types:    entityTypes,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	if len(query.Sites) > 0 {
+		platformIDs, err := platformIDsForSites(currentUserID, query.Sites)
+		if err != nil {
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "搜索失败: "+err.Error())
+			return
 		}
+		opts.FilterPlatforms, opts.PlatformIDs = true, platformIDs
 	}
 
-	if len(results) == 0 {
-		utils.SendSuccessResponse(c, models.GlobalSearchResponse{Results: []models.GlobalSearchResultItem{}})
+	hits, total, err := search.Search(database.DB, query, opts)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "搜索失败: "+err.Error())
 		return
 	}
 
-	utils.SendSuccessResponse(c, models.GlobalSearchResponse{Results: results})
+	results := make([]models.GlobalSearchResultItem, 0, len(hits))
+	for _, h := range hits {
+		details := gin.H{}
+		if h.PlatformID != 0 {
+			details["platform_id"] = h.PlatformID
+			details["platform_name"] = h.Platform
+		}
+		if h.EmailAccountID != 0 {
+			details["email_account_id"] = h.EmailAccountID
+		}
+		if h.Tags != "" {
+			details["tags"] = strings.Split(h.Tags, "\n")
+		}
+		if h.Sender != "" {
+			details["from"] = strings.ReplaceAll(h.Sender, "\n", " ")
+		}
+		results = append(results, models.GlobalSearchResultItem{
+			ID:          h.EntityID,
+			Type:        h.EntityType,
+			DisplayName: strings.ReplaceAll(h.Title, "\n", " · "),
+			Details:     details,
+			Score:       h.Score,
+			Highlight:   strings.ReplaceAll(h.TitleHighlight, "\n", " · "),
+			Snippet:     h.Snippet,
+		})
+	}
+
+	utils.SendSuccessResponseWithMeta(c, models.GlobalSearchResponse{Results: results}, utils.CreatePaginationMeta(page, pageSize, total))
 }
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/database/dbtest"
+	"email_server/models"
+	"email_server/search"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupSearchTestRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.Config{Trash: config.TrashConfig{RetentionDays: 30}}
+
+	db := dbtest.Open(t)
+	search.Init(db)
+	database.DB = db
+
+	r := gin.New()
+	auth := func(c *gin.Context) {
+		c.Set("user_id", int64(1))
+		c.Next()
+	}
+	r.GET("/search", auth, SearchHandler)
+	r.DELETE("/platforms/:id", auth, DeletePlatform)
+	r.POST("/trash/:type/:id/restore", auth, RestoreTrashItem)
+	return r, db
+}
+
+type searchTestResponse struct {
+	Data models.GlobalSearchResponse `json:"data"`
+	Meta struct {
+		TotalItems int `json:"total_items"`
+	} `json:"meta"`
+}
+
+func doSearch(t *testing.T, r *gin.Engine, q string, extra string) searchTestResponse {
+	w := doJSON(r, http.MethodGet, "/search?q="+url.QueryEscape(q)+extra, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp searchTestResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func resultTypes(resp searchTestResponse) []string {
+	types := make([]string, 0, len(resp.Data.Results))
+	for _, item := range resp.Data.Results {
+		types = append(types, item.Type)
+	}
+	return types
+}
+
+func seedSearchData(t *testing.T, db *gorm.DB) models.Platform {
+	username := "octocat"
+	account := models.EmailAccount{UserID: 1, EmailAddress: "me@example.com", Provider: "gmail"}
+	require.NoError(t, db.Create(&account).Error)
+	platform := models.Platform{UserID: 1, Name: "GitHub", WebsiteURL: "https://github.com", Notes: "code hosting"}
+	require.NoError(t, db.Create(&platform).Error)
+	reg := models.PlatformRegistration{UserID: 1, PlatformID: platform.ID, EmailAccountID: &account.ID, LoginUsername: &username, Notes: "work account"}
+	require.NoError(t, db.Create(&reg).Error)
+	sub := models.ServiceSubscription{UserID: 1, PlatformRegistrationID: reg.ID, ServiceName: "Copilot", Status: "active", BillingCycle: "monthly"}
+	require.NoError(t, db.Create(&sub).Error)
+
+	cacheInboxEmails(1, account.ID, "INBOX", []models.Email{
+		{MessageID: "m1", Subject: "Your invoice is ready", From: []models.EmailAddress{{Name: "GitHub Billing", Address: "billing@github.com"}}, Snippet: "Payment received"},
+		{MessageID: "m2", Subject: "Weekly digest", From: []models.EmailAddress{{Name: "News", Address: "news@example.org"}}, Snippet: "Top stories"},
+	})
+
+	// 其他用户的数据不应出现在结果中
+	other := models.Platform{UserID: 2, Name: "GitHub"}
+	require.NoError(t, db.Create(&other).Error)
+	return platform
+}
+
+func TestSearch_RankingFiltersAndHighlights(t *testing.T) {
+	r, db := setupSearchTestRouter(t)
+	seedSearchData(t, db)
+
+	resp := doSearch(t, r, "github", "")
+	require.NotEmpty(t, resp.Data.Results)
+	assert.Equal(t, models.SearchEntityPlatform, resp.Data.Results[0].Type, "标题命中应排在最前")
+	assert.Contains(t, resp.Data.Results[0].Highlight, "<mark>GitHub</mark>")
+	assert.Equal(t, len(resp.Data.Results), resp.Meta.TotalItems)
+	platforms := 0
+	for _, typ := range resultTypes(resp) {
+		if typ == models.SearchEntityPlatform {
+			platforms++
+		}
+	}
+	assert.Equal(t, 1, platforms, "不应返回其他用户的平台")
+
+	resp = doSearch(t, r, "platform:github tag:active", "")
+	assert.Equal(t, []string{models.SearchEntityServiceSubscription}, resultTypes(resp))
+
+	resp = doSearch(t, r, "from:billing", "")
+	require.Equal(t, []string{models.SearchEntityEmail}, resultTypes(resp))
+	assert.Equal(t, "Your invoice is ready", resp.Data.Results[0].DisplayName)
+
+	resp = doSearch(t, r, "invo*", "")
+	assert.Equal(t, []string{models.SearchEntityEmail}, resultTypes(resp))
+
+	resp = doSearch(t, r, `"invoice is ready"`, "")
+	assert.Len(t, resp.Data.Results, 1)
+	resp = doSearch(t, r, `"ready invoice"`, "")
+	assert.Empty(t, resp.Data.Results)
+
+	resp = doSearch(t, r, "github", "&type=emails")
+	assert.Equal(t, []string{models.SearchEntityEmail}, resultTypes(resp))
+
+	resp = doSearch(t, r, "github", "&pageSize=1&page=2")
+	assert.Len(t, resp.Data.Results, 1)
+	assert.Greater(t, resp.Meta.TotalItems, 1)
+
+	w := doJSON(r, http.MethodGet, "/search?q=github&type=users", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSearch_IndexFollowsUpdatesAndTrash(t *testing.T) {
+	r, db := setupSearchTestRouter(t)
+	platform := seedSearchData(t, db)
+
+	platform.Name = "Gitea"
+	require.NoError(t, db.Save(&platform).Error)
+	assert.Empty(t, doSearch(t, r, "platform:github", "").Data.Results)
+	assert.Len(t, doSearch(t, r, "platform:gitea", "").Data.Results, 3)
+
+	w := doJSON(r, http.MethodDelete, "/platforms/1", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, doSearch(t, r, "platform:gitea", "").Data.Results)
+	assert.Empty(t, doSearch(t, r, "octocat", "").Data.Results)
+
+	w = doJSON(r, http.MethodPost, "/trash/platform/1/restore", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Len(t, doSearch(t, r, "platform:gitea", "").Data.Results, 3)
+}
+
+func TestSearch_SiteFilterUsesPlatformURLRules(t *testing.T) {
+	r, db := setupSearchTestRouter(t)
+	github := seedSearchData(t, db)
+	gitlab := models.Platform{UserID: 1, Name: "GitLab", URLs: []models.PlatformURL{{UserID: 1, URL: "gitlab.example.net", MatchMode: "host"}}}
+	require.NoError(t, db.Create(&gitlab).Error)
+	require.NoError(t, db.Create(&models.PlatformRegistration{UserID: 1, PlatformID: gitlab.ID, Notes: "work account"}).Error)
+
+	// 平台网址出现在平台的搜索正文中
+	resp := doSearch(t, r, "gitlab.example.net", "")
+	require.NotEmpty(t, resp.Data.Results)
+	assert.Equal(t, gitlab.ID, resp.Data.Results[0].ID)
+
+	resp = doSearch(t, r, "site:https://gist.github.com/octocat", "")
+	assert.ElementsMatch(t, []string{models.SearchEntityPlatform, models.SearchEntityPlatformRegistration, models.SearchEntityServiceSubscription}, resultTypes(resp))
+	for _, item := range resp.Data.Results {
+		assert.EqualValues(t, github.ID, item.Details.(map[string]interface{})["platform_id"])
+	}
+
+	resp = doSearch(t, r, "site:gitlab.example.net work", "")
+	require.Len(t, resp.Data.Results, 1)
+	assert.Equal(t, models.SearchEntityPlatformRegistration, resp.Data.Results[0].Type)
+
+	// host 规则不匹配同一可注册域名下的其他主机
+	assert.Empty(t, doSearch(t, r, "site:other.example.net", "").Data.Results)
+	assert.Empty(t, doSearch(t, r, "site:github.com site:gitlab.example.net", "").Data.Results)
+}
+
+func TestSearch_CaseInsensitiveMatching(t *testing.T) {
+	r, db := setupSearchTestRouter(t)
+
+	require.NoError(t, db.Create(&models.Platform{UserID: 1, Name: "GITHUB Enterprise"}).Error)
+	require.NoError(t, db.Create(&models.Platform{UserID: 1, Name: "Ärztekammer"}).Error)
+	require.NoError(t, db.Create(&models.Platform{UserID: 1, Name: "GitLab"}).Error)
+
+	resp := doSearch(t, r, "github enter*", "")
+	require.Len(t, resp.Data.Results, 1)
+	assert.Equal(t, "GITHUB Enterprise", resp.Data.Results[0].DisplayName)
+
+	// 非 ASCII 字符的大小写在 SQLite 中也能匹配
+	resp = doSearch(t, r, "ärztekammer", "")
+	require.Len(t, resp.Data.Results, 1)
+	assert.Equal(t, "Ärztekammer", resp.Data.Results[0].DisplayName)
+}
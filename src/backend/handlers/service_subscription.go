@@ -653,7 +653,7 @@ func UpdateServiceSubscription(c *gin.Context) {
 
 // DeleteServiceSubscription godoc
 // @Summary 删除指定ID的服务订阅
-// @Description 删除当前用户拥有的指定ID的服务订阅
+// @Description 删除当前用户拥有的指定ID的服务订阅（移入回收站）
 // @Tags ServiceSubscriptions
 // @Produce json
 // @Param id path int true "服务订阅ID"
@@ -694,7 +694,8 @@ func DeleteServiceSubscription(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Unscoped().Delete(&ss).Error; err != nil {
+	// 软删除，订阅进入回收站
+	if err := database.DB.Delete(&ss).Error; err != nil {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "删除服务订阅失败: "+err.Error())
 		return
 	}
@@ -889,7 +890,7 @@ func GetDistinctPlatformNames(c *gin.Context) {
 		Select("DISTINCT p.name").
 		Joins("JOIN platform_registrations pr ON pr.id = ss.platform_registration_id").
 		Joins("JOIN platforms p ON p.id = pr.platform_id").
-		Where("ss.user_id = ?", currentUserID).
+		Where("ss.user_id = ? AND ss.deleted_at IS NULL", currentUserID).
 		Where("p.name IS NOT NULL AND p.name != ''").
 		Order("p.name ASC")
 
@@ -931,7 +932,7 @@ func GetDistinctEmails(c *gin.Context) {
 		Select("DISTINCT ea.email_address").
 		Joins("JOIN platform_registrations pr ON pr.id = ss.platform_registration_id").
 		Joins("JOIN email_accounts ea ON ea.id = pr.email_account_id").
-		Where("ss.user_id = ?", currentUserID).
+		Where("ss.user_id = ? AND ss.deleted_at IS NULL", currentUserID).
 		Where("ea.email_address IS NOT NULL AND ea.email_address != ''").
 		Order("ea.email_address ASC")
 
@@ -1129,7 +1130,7 @@ func GetDistinctUsernames(c *gin.Context) {
 	query := database.DB.Table("service_subscriptions ss").
 		Select("DISTINCT pr.login_username").
 		Joins("JOIN platform_registrations pr ON pr.id = ss.platform_registration_id").
-		Where("ss.user_id = ?", currentUserID).
+		Where("ss.user_id = ? AND ss.deleted_at IS NULL", currentUserID).
 		Where("pr.login_username IS NOT NULL AND pr.login_username != ''").
 		Order("pr.login_username ASC")
 
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// getSetting 读取系统设置，未设置时返回 defaultValue
+func getSetting(key, defaultValue string) (string, error) {
+	var setting models.SystemSetting
+	// key 在 MySQL 中是保留字，使用结构体条件由 GORM 按方言加引号
+	err := database.DB.Where(&models.SystemSetting{Key: key}).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultValue, nil
+	}
+	if err != nil {
+		return defaultValue, err
+	}
+	return setting.Value, nil
+}
+
+// setSetting 写入系统设置
+func setSetting(key, value string) error {
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&models.SystemSetting{Key: key, Value: value, UpdatedAt: time.Now()}).Error
+}
+
+// registrationMode 当前注册模式，读取失败时按更严格的邀请注册处理
+func registrationMode() string {
+	defaultMode := models.RegistrationModeOpen
+	if config.AppConfig != nil {
+		switch mode := config.AppConfig.Admin.RegistrationMode; mode {
+		case models.RegistrationModeInviteOnly, models.RegistrationModeDisabled:
+			defaultMode = mode
+		}
+	}
+	mode, err := getSetting(models.SettingRegistrationMode, defaultMode)
+	if err != nil {
+		log.Printf("读取注册模式失败: %v", err)
+		return models.RegistrationModeInviteOnly
+	}
+	return mode
+}
+
+// GetRegistrationInfo 获取注册模式，供注册页判断是否开放注册、是否需要邀请码和验证邮箱
+// @Summary 获取注册模式
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} models.SuccessResponse{data=models.RegistrationInfo} "获取成功"
+// @Router /auth/registration [get]
+func GetRegistrationInfo(c *gin.Context) {
+	utils.SendSuccessResponse(c, models.RegistrationInfo{
+		Mode:                      registrationMode(),
+		EmailVerificationRequired: emailVerificationRequired(),
+	})
+}
+
+// GetRegistrationSettings 获取注册设置（管理员功能）
+// @Summary 获取注册设置
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse{data=models.RegistrationSettings} "获取成功"
+// @Router /admin/settings/registration [get]
+func GetRegistrationSettings(c *gin.Context) {
+	utils.SendSuccessResponse(c, models.RegistrationSettings{Mode: registrationMode()})
+}
+
+// UpdateRegistrationSettings 切换开放注册/邀请注册/关闭注册（管理员功能）
+// @Summary 修改注册设置
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.RegistrationSettings true "注册模式"
+// @Success 200 {object} models.SuccessResponse{data=models.RegistrationSettings} "修改成功"
+// @Failure 400 {object} models.ErrorResponse "参数错误"
+// @Router /admin/settings/registration [put]
+func UpdateRegistrationSettings(c *gin.Context) {
+	var req models.RegistrationSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "注册模式只能是 open、invite_only 或 disabled")
+		return
+	}
+	if err := setSetting(models.SettingRegistrationMode, req.Mode); err != nil {
+		log.Printf("保存注册模式失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "保存设置失败")
+		return
+	}
+	adminID, _ := c.Get("user_id")
+	log.Printf("管理员 %v 将注册模式修改为 %s", adminID, req.Mode)
+	utils.SendSuccessResponse(c, req)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"email_server/database"
+	"email_server/database/migrations"
+	"email_server/integrations"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// maxReportedTokenFailures 系统状态中最多列出的失败令牌数
+const maxReportedTokenFailures = 50
+
+// healthCountTables 系统状态中统计记录数的表（不含回收站中的记录）
+var healthCountTables = map[string]interface{}{
+	"users":                  &models.User{},
+	"email_accounts":         &models.EmailAccount{},
+	"platforms":              &models.Platform{},
+	"platform_registrations": &models.PlatformRegistration{},
+	"service_subscriptions":  &models.ServiceSubscription{},
+	"cached_emails":          &models.CachedEmail{},
+}
+
+// GetSystemHealth 获取系统状态（管理员功能）
+// @Summary 获取系统状态
+// @Description 数据库大小与迁移版本、数据量统计、定时任务最近运行情况、IMAP 连接池使用情况以及刷新/认证失败的邮箱 OAuth 令牌
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SuccessResponse{data=models.SystemHealthResponse} "获取成功"
+// @Failure 500 {object} models.ErrorResponse "查询失败"
+// @Router /admin/system/health [get]
+func GetSystemHealth(c *gin.Context) {
+	db := database.DB
+	var resp models.SystemHealthResponse
+
+	resp.Database.Driver = db.Dialector.Name()
+	size, err := database.Size(db)
+	if err != nil {
+		// 部分托管数据库不允许查询大小，不影响其他信息
+		log.Printf("查询数据库大小失败: %v", err)
+	}
+	resp.Database.SizeBytes = size
+	if resp.Database.SchemaVersion, err = migrations.Current(db); err != nil {
+		log.Printf("查询迁移版本失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询系统状态失败")
+		return
+	}
+	pending, err := migrations.Pending(db)
+	if err != nil {
+		log.Printf("查询待执行迁移失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询系统状态失败")
+		return
+	}
+	resp.Database.PendingMigrations = len(pending)
+
+	resp.Counts = make(map[string]int64, len(healthCountTables)+1)
+	for name, model := range healthCountTables {
+		var count int64
+		if err := db.Model(model).Count(&count).Error; err != nil {
+			log.Printf("统计 %s 失败: %v", name, err)
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "查询系统状态失败")
+			return
+		}
+		resp.Counts[name] = count
+	}
+	var pendingInvitations int64
+	if err := db.Model(&models.Invitation{}).Where("used_at IS NULL AND expires_at > ?", time.Now()).Count(&pendingInvitations).Error; err != nil {
+		log.Printf("统计邀请失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询系统状态失败")
+		return
+	}
+	resp.Counts["pending_invitations"] = pendingInvitations
+
+	resp.Jobs = jobStatuses()
+	resp.IMAPPool = integrations.IMAPPoolStats()
+
+	if err := db.Model(&models.UserOAuthToken{}).Count(&resp.OAuthTokens.Total).Error; err != nil {
+		log.Printf("统计 OAuth 令牌失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询系统状态失败")
+		return
+	}
+	if err := db.Model(&models.UserOAuthToken{}).Where("failure_count > 0").Count(&resp.OAuthTokens.Failing).Error; err != nil {
+		log.Printf("统计失败的 OAuth 令牌失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询系统状态失败")
+		return
+	}
+	resp.OAuthTokens.Failures = []models.OAuthTokenFailure{}
+	err = db.Table("user_o_auth_tokens AS t").
+		Select("t.id AS token_id, t.user_id, e.email_address, p.name AS provider, t.failure_count, t.last_error, t.last_error_at").
+		Joins("LEFT JOIN email_accounts e ON e.id = t.email_account_id").
+		Joins("LEFT JOIN o_auth_providers p ON p.id = t.provider_id").
+		Where("t.failure_count > 0").
+		Order("t.last_error_at DESC").
+		Limit(maxReportedTokenFailures).
+		Scan(&resp.OAuthTokens.Failures).Error
+	if err != nil {
+		log.Printf("查询失败的 OAuth 令牌失败: %v", err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "查询系统状态失败")
+		return
+	}
+
+	utils.SendSuccessResponse(c, resp)
+}
@@ -0,0 +1,711 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// 一次删除操作中级联进入回收站的记录共享同一个 deleted_at，恢复时据此找回被级联删除的子项，
+// 而不会把此前单独删除的子项一并恢复。
+
+// errTrashParentDeleted 表示待恢复条目的上级记录仍在回收站中
+var errTrashParentDeleted = errors.New("上级记录仍在回收站中，请先恢复上级记录")
+
+// --- 移入回收站 ---
+
+// moveRegistrationsToTrash 将符合条件的平台注册信息及其服务订阅以同一时间戳软删除
+func moveRegistrationsToTrash(tx *gorm.DB, userID uint, now time.Time, query interface{}, args ...interface{}) error {
+	var ids []uint
+	if err := tx.Model(&models.PlatformRegistration{}).Where("user_id = ?", userID).Where(query, args...).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var subIDs []uint
+	if err := tx.Model(&models.ServiceSubscription{}).Where("user_id = ? AND platform_registration_id IN ?", userID, ids).Pluck("id", &subIDs).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.ServiceSubscription{}).Where("id IN ?", subIDs).Update("deleted_at", now).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.PlatformRegistration{}).Where("id IN ?", ids).Update("deleted_at", now).Error; err != nil {
+		return err
+	}
+	// 批量更新不会触发模型钩子，需手动同步搜索文档
+	if err := models.SyncSearchDocuments(tx, models.SearchEntityServiceSubscription, subIDs); err != nil {
+		return err
+	}
+	return models.SyncSearchDocuments(tx, models.SearchEntityPlatformRegistration, ids)
+}
+
+// moveEmailAccountToTrash 将邮箱账户及其关联的平台注册信息、服务订阅移入回收站
+func moveEmailAccountToTrash(tx *gorm.DB, account *models.EmailAccount, now time.Time) error {
+	if err := moveRegistrationsToTrash(tx, account.UserID, now, "email_account_id = ?", account.ID); err != nil {
+		return err
+	}
+	if err := tx.Model(&models.EmailAccount{}).Where("id = ?", account.ID).Update("deleted_at", now).Error; err != nil {
+		return err
+	}
+	if err := models.SyncSearchDocuments(tx, models.SearchEntityEmailAccount, []uint{account.ID}); err != nil {
+		return err
+	}
+	// 回收站中邮箱账户的缓存邮件不参与搜索
+	return tx.Where("entity_type = ? AND email_account_id = ?", models.SearchEntityEmail, account.ID).Delete(&models.SearchDocument{}).Error
+}
+
+// movePlatformToTrash 将平台及其关联的平台注册信息、服务订阅移入回收站
+func movePlatformToTrash(tx *gorm.DB, platform *models.Platform, now time.Time) error {
+	if err := moveRegistrationsToTrash(tx, platform.UserID, now, "platform_id = ?", platform.ID); err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Platform{}).Where("id = ?", platform.ID).Update("deleted_at", now).Error; err != nil {
+		return err
+	}
+	return models.SyncSearchDocuments(tx, models.SearchEntityPlatform, []uint{platform.ID})
+}
+
+// --- 从回收站恢复 ---
+
+// loadTrashed 查询当前用户回收站中的指定记录
+func loadTrashed(tx *gorm.DB, dest interface{}, userID uint, id uint64) error {
+	return tx.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, userID).First(dest).Error
+}
+
+// registrationParentsAlive 判断注册信息所属的平台和邮箱账户是否都未被删除
+func registrationParentsAlive(tx *gorm.DB, reg *models.PlatformRegistration) (bool, error) {
+	var count int64
+	if err := tx.Model(&models.Platform{}).Where("id = ?", reg.PlatformID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, nil
+	}
+	if reg.EmailAccountID != nil && *reg.EmailAccountID != 0 {
+		if err := tx.Model(&models.EmailAccount{}).Where("id = ?", *reg.EmailAccountID).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// restoreRegistrationRow 恢复单条注册信息以及与它同时被删除的服务订阅
+func restoreRegistrationRow(tx *gorm.DB, reg *models.PlatformRegistration) error {
+	if err := tx.Unscoped().Model(&models.PlatformRegistration{}).Where("id = ?", reg.ID).Update("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	if err := models.SyncSearchDocuments(tx, models.SearchEntityPlatformRegistration, []uint{reg.ID}); err != nil {
+		return err
+	}
+
+	var subs []models.ServiceSubscription
+	if err := tx.Unscoped().Where("platform_registration_id = ? AND deleted_at IS NOT NULL", reg.ID).Find(&subs).Error; err != nil {
+		return err
+	}
+	var ids []uint
+	for _, sub := range subs {
+		if sub.DeletedAt.Time.Equal(reg.DeletedAt.Time) {
+			ids = append(ids, sub.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Unscoped().Model(&models.ServiceSubscription{}).Where("id IN ?", ids).Update("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	return models.SyncSearchDocuments(tx, models.SearchEntityServiceSubscription, ids)
+}
+
+// restoreCascadedRegistrations 恢复与上级记录同时被删除的注册信息；
+// 若注册信息的另一个上级（平台或邮箱）仍在回收站中，则保留在回收站
+func restoreCascadedRegistrations(tx *gorm.DB, userID uint, deletedAt time.Time, query interface{}, args ...interface{}) error {
+	var regs []models.PlatformRegistration
+	if err := tx.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID).Where(query, args...).Find(&regs).Error; err != nil {
+		return err
+	}
+	for i := range regs {
+		if !regs[i].DeletedAt.Time.Equal(deletedAt) {
+			continue
+		}
+		alive, err := registrationParentsAlive(tx, &regs[i])
+		if err != nil {
+			return err
+		}
+		if !alive {
+			continue
+		}
+		if err := restoreRegistrationRow(tx, &regs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreTrashItem 恢复回收站中的条目及其被级联删除的子项
+func restoreTrashItem(tx *gorm.DB, userID uint, itemType string, id uint64) error {
+	switch itemType {
+	case models.TrashTypeEmailAccount:
+		var account models.EmailAccount
+		if err := loadTrashed(tx, &account, userID, id); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.EmailAccount{}).Where("id = ?", account.ID).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := models.SyncSearchDocuments(tx, models.SearchEntityEmailAccount, []uint{account.ID}); err != nil {
+			return err
+		}
+		var cachedIDs []uint
+		if err := tx.Model(&models.CachedEmail{}).Where("email_account_id = ?", account.ID).Pluck("id", &cachedIDs).Error; err != nil {
+			return err
+		}
+		if err := models.SyncSearchDocuments(tx, models.SearchEntityEmail, cachedIDs); err != nil {
+			return err
+		}
+		return restoreCascadedRegistrations(tx, userID, account.DeletedAt.Time, "email_account_id = ?", account.ID)
+
+	case models.TrashTypePlatform:
+		var platform models.Platform
+		if err := loadTrashed(tx, &platform, userID, id); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Platform{}).Where("id = ?", platform.ID).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := models.SyncSearchDocuments(tx, models.SearchEntityPlatform, []uint{platform.ID}); err != nil {
+			return err
+		}
+		return restoreCascadedRegistrations(tx, userID, platform.DeletedAt.Time, "platform_id = ?", platform.ID)
+
+	case models.TrashTypePlatformRegistration:
+		var reg models.PlatformRegistration
+		if err := loadTrashed(tx, &reg, userID, id); err != nil {
+			return err
+		}
+		alive, err := registrationParentsAlive(tx, &reg)
+		if err != nil {
+			return err
+		}
+		if !alive {
+			return errTrashParentDeleted
+		}
+		return restoreRegistrationRow(tx, &reg)
+
+	case models.TrashTypeServiceSubscription:
+		var sub models.ServiceSubscription
+		if err := loadTrashed(tx, &sub, userID, id); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.PlatformRegistration{}).Where("id = ?", sub.PlatformRegistrationID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errTrashParentDeleted
+		}
+		if err := tx.Unscoped().Model(&models.ServiceSubscription{}).Where("id = ?", sub.ID).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return models.SyncSearchDocuments(tx, models.SearchEntityServiceSubscription, []uint{sub.ID})
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// --- 永久删除 ---
+
+// purgeRegistrations 永久删除注册信息及其服务订阅、版本历史
+func purgeRegistrations(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Unscoped().Where("platform_registration_id IN ?", ids).Delete(&models.ServiceSubscription{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("entity_type = ? AND entity_id IN ?", models.RevisionEntityPlatformRegistration, ids).Delete(&models.RevisionHistory{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&models.PlatformRegistration{}).Error
+}
+
+// trashedRegistrationIDs 返回引用指定上级记录且位于回收站中的注册信息ID
+func trashedRegistrationIDs(tx *gorm.DB, query interface{}, args ...interface{}) ([]uint, error) {
+	var ids []uint
+	err := tx.Unscoped().Model(&models.PlatformRegistration{}).Where("deleted_at IS NOT NULL").Where(query, args...).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// permanentlyDeleteTrashItem 永久删除回收站中的条目；平台/邮箱账户会连同回收站中引用它们的注册信息一起删除
+func permanentlyDeleteTrashItem(tx *gorm.DB, userID uint, itemType string, id uint64) error {
+	switch itemType {
+	case models.TrashTypeEmailAccount:
+		var account models.EmailAccount
+		if err := loadTrashed(tx, &account, userID, id); err != nil {
+			return err
+		}
+		regIDs, err := trashedRegistrationIDs(tx, "email_account_id = ?", account.ID)
+		if err != nil {
+			return err
+		}
+		if err := purgeRegistrations(tx, regIDs); err != nil {
+			return err
+		}
+		if err := tx.Where("email_account_id = ?", account.ID).Delete(&models.UserOAuthToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("email_account_id = ?", account.ID).Delete(&models.CachedEmail{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("entity_type = ? AND email_account_id = ?", models.SearchEntityEmail, account.ID).Delete(&models.SearchDocument{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("entity_type = ? AND entity_id = ?", models.RevisionEntityEmailAccount, account.ID).Delete(&models.RevisionHistory{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&account).Error
+
+	case models.TrashTypePlatform:
+		var platform models.Platform
+		if err := loadTrashed(tx, &platform, userID, id); err != nil {
+			return err
+		}
+		regIDs, err := trashedRegistrationIDs(tx, "platform_id = ?", platform.ID)
+		if err != nil {
+			return err
+		}
+		if err := purgeRegistrations(tx, regIDs); err != nil {
+			return err
+		}
+		if err := tx.Where("platform_id = ?", platform.ID).Delete(&models.PlatformURL{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&platform).Error
+
+	case models.TrashTypePlatformRegistration:
+		var reg models.PlatformRegistration
+		if err := loadTrashed(tx, &reg, userID, id); err != nil {
+			return err
+		}
+		return purgeRegistrations(tx, []uint{reg.ID})
+
+	case models.TrashTypeServiceSubscription:
+		var sub models.ServiceSubscription
+		if err := loadTrashed(tx, &sub, userID, id); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&sub).Error
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// --- 列表 ---
+
+// trashPurgeAt 计算条目的自动清除时间，未启用自动清除时返回空字符串
+func trashPurgeAt(deletedAt time.Time) string {
+	if config.AppConfig == nil || config.AppConfig.Trash.RetentionDays <= 0 {
+		return ""
+	}
+	return deletedAt.AddDate(0, 0, config.AppConfig.Trash.RetentionDays).Format("2006-01-02 15:04:05")
+}
+
+func newTrashItem(itemType string, id uint, title, subtitle string, deletedAt time.Time) models.TrashItemResponse {
+	return models.TrashItemResponse{
+		Type:       itemType,
+		ID:         id,
+		Title:      title,
+		Subtitle:   subtitle,
+		DeletedAt:  deletedAt.Format("2006-01-02 15:04:05"),
+		PurgeAt:    trashPurgeAt(deletedAt),
+		Dependents: []models.TrashItemResponse{},
+	}
+}
+
+// buildTrashList 组装当前用户的回收站列表，级联删除的子项挂在其上级条目下
+func buildTrashList(db *gorm.DB, userID uint) ([]models.TrashItemResponse, error) {
+	var accounts []models.EmailAccount
+	var platforms []models.Platform
+	var regs []models.PlatformRegistration
+	var subs []models.ServiceSubscription
+
+	trashed := db.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID)
+	if err := trashed.Session(&gorm.Session{}).Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	if err := trashed.Session(&gorm.Session{}).Find(&platforms).Error; err != nil {
+		return nil, err
+	}
+	if err := trashed.Session(&gorm.Session{}).Find(&regs).Error; err != nil {
+		return nil, err
+	}
+	if err := trashed.Session(&gorm.Session{}).Find(&subs).Error; err != nil {
+		return nil, err
+	}
+
+	// 注册信息和订阅的展示名称需要平台名/邮箱地址，上级可能已在回收站中，因此不加软删除条件
+	platformNames := map[uint]string{}
+	accountAddresses := map[uint]string{}
+	var allPlatforms []models.Platform
+	if err := db.Unscoped().Select("id, name").Where("user_id = ?", userID).Find(&allPlatforms).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range allPlatforms {
+		platformNames[p.ID] = p.Name
+	}
+	var allAccounts []models.EmailAccount
+	if err := db.Unscoped().Select("id, email_address").Where("user_id = ?", userID).Find(&allAccounts).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range allAccounts {
+		accountAddresses[a.ID] = a.EmailAddress
+	}
+
+	accountIdx := map[uint]int{}
+	platformIdx := map[uint]int{}
+	// 顶层条目，按删除时间倒序排列
+	type topEntry struct {
+		item      *models.TrashItemResponse
+		deletedAt time.Time
+	}
+	var top []topEntry
+
+	accountItems := make([]models.TrashItemResponse, len(accounts))
+	for i, a := range accounts {
+		accountItems[i] = newTrashItem(models.TrashTypeEmailAccount, a.ID, a.EmailAddress, a.Provider, a.DeletedAt.Time)
+		accountIdx[a.ID] = i
+	}
+	platformItems := make([]models.TrashItemResponse, len(platforms))
+	for i, p := range platforms {
+		platformItems[i] = newTrashItem(models.TrashTypePlatform, p.ID, p.Name, p.WebsiteURL, p.DeletedAt.Time)
+		platformIdx[p.ID] = i
+	}
+
+	regItems := make([]models.TrashItemResponse, len(regs))
+	regIdx := map[uint]int{}
+	for i, r := range regs {
+		title := ""
+		if r.LoginUsername != nil && *r.LoginUsername != "" {
+			title = *r.LoginUsername
+		} else if r.EmailAccountID != nil {
+			title = accountAddresses[*r.EmailAccountID]
+		}
+		regItems[i] = newTrashItem(models.TrashTypePlatformRegistration, r.ID, title, platformNames[r.PlatformID], r.DeletedAt.Time)
+		regIdx[r.ID] = i
+	}
+
+	// 订阅：与所属注册信息同时删除的挂在注册信息下
+	for _, s := range subs {
+		item := newTrashItem(models.TrashTypeServiceSubscription, s.ID, s.ServiceName, "", s.DeletedAt.Time)
+		if i, ok := regIdx[s.PlatformRegistrationID]; ok && regs[i].DeletedAt.Time.Equal(s.DeletedAt.Time) {
+			item.Subtitle = regItems[i].Subtitle
+			regItems[i].Dependents = append(regItems[i].Dependents, item)
+			continue
+		}
+		item.Subtitle = platformNameForSubscription(db, s.PlatformRegistrationID, platformNames)
+		top = append(top, topEntry{&item, s.DeletedAt.Time})
+	}
+
+	// 注册信息：与所属邮箱账户或平台同时删除的挂在上级下
+	for i, r := range regs {
+		if r.EmailAccountID != nil {
+			if j, ok := accountIdx[*r.EmailAccountID]; ok && accounts[j].DeletedAt.Time.Equal(r.DeletedAt.Time) {
+				accountItems[j].Dependents = append(accountItems[j].Dependents, regItems[i])
+				continue
+			}
+		}
+		if j, ok := platformIdx[r.PlatformID]; ok && platforms[j].DeletedAt.Time.Equal(r.DeletedAt.Time) {
+			platformItems[j].Dependents = append(platformItems[j].Dependents, regItems[i])
+			continue
+		}
+		top = append(top, topEntry{&regItems[i], r.DeletedAt.Time})
+	}
+	for i := range accountItems {
+		top = append(top, topEntry{&accountItems[i], accounts[i].DeletedAt.Time})
+	}
+	for i := range platformItems {
+		top = append(top, topEntry{&platformItems[i], platforms[i].DeletedAt.Time})
+	}
+
+	sort.SliceStable(top, func(i, j int) bool { return top[i].deletedAt.After(top[j].deletedAt) })
+	result := make([]models.TrashItemResponse, 0, len(top))
+	for _, entry := range top {
+		result = append(result, *entry.item)
+	}
+	return result, nil
+}
+
+// platformNameForSubscription 查询订阅所属注册信息对应的平台名称
+func platformNameForSubscription(db *gorm.DB, registrationID uint, platformNames map[uint]string) string {
+	var reg models.PlatformRegistration
+	if err := db.Unscoped().Select("id, platform_id").First(&reg, registrationID).Error; err != nil {
+		return ""
+	}
+	return platformNames[reg.PlatformID]
+}
+
+// --- HTTP 处理函数 ---
+
+// parseTrashParams 解析 :type 和 :id 路由参数，失败时已写入错误响应
+func parseTrashParams(c *gin.Context) (uint, string, uint64, bool) {
+	userIDRaw, exists := c.Get("user_id")
+	if !exists {
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "用户未认证")
+		return 0, "", 0, false
+	}
+	userID, ok := userIDRaw.(int64)
+	if !ok {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "用户ID类型错误")
+		return 0, "", 0, false
+	}
+
+	itemType := c.Param("type")
+	if !models.IsValidTrashType(itemType) {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的回收站条目类型")
+		return 0, "", 0, false
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "无效的ID格式")
+		return 0, "", 0, false
+	}
+	return uint(userID), itemType, id, true
+}
+
+// GetTrash godoc
+// @Summary 获取回收站列表
+// @Description 列出当前用户已删除的邮箱账户、平台、平台注册信息和服务订阅，被级联删除的子项列在上级条目的 dependents 中
+// @Tags Trash
+// @Produce json
+// @Param type query string false "仅返回指定类型 (email_account, platform, platform_registration, service_subscription)"
+// @Success 200 {object} models.SuccessResponse{data=[]models.TrashItemResponse} "获取成功"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /trash [get]
+// @Security BearerAuth
+func GetTrash(c *gin.Context) {
+	userIDRaw, exists := c.Get("user_id")
+	if !exists {
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "用户未认证")
+		return
+	}
+	userID, ok := userIDRaw.(int64)
+	if !ok {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "用户ID类型错误")
+		return
+	}
+
+	items, err := buildTrashList(database.DB, uint(userID))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取回收站失败: "+err.Error())
+		return
+	}
+
+	if itemType := c.Query("type"); itemType != "" {
+		filtered := make([]models.TrashItemResponse, 0, len(items))
+		for _, item := range items {
+			if item.Type == itemType {
+				filtered = append(filtered, item)
+			}
+		}
+		items = filtered
+	}
+	utils.SendSuccessResponse(c, items)
+}
+
+// RestoreTrashItem godoc
+// @Summary 从回收站恢复条目
+// @Description 恢复指定条目以及与其一起被级联删除的子项
+// @Tags Trash
+// @Produce json
+// @Param type path string true "条目类型"
+// @Param id path int true "条目ID"
+// @Success 200 {object} models.SuccessResponse "恢复成功"
+// @Failure 400 {object} models.ErrorResponse "无效的参数"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 404 {object} models.ErrorResponse "回收站中不存在该条目"
+// @Failure 409 {object} models.ErrorResponse "上级记录已删除或与现有记录冲突"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /trash/{type}/{id}/restore [post]
+// @Security BearerAuth
+func RestoreTrashItem(c *gin.Context) {
+	userID, itemType, id, ok := parseTrashParams(c)
+	if !ok {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return restoreTrashItem(tx, userID, itemType, id)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.SendErrorResponse(c, http.StatusNotFound, "回收站中未找到该条目")
+		case errors.Is(err, errTrashParentDeleted):
+			utils.SendErrorResponse(c, http.StatusConflict, err.Error())
+		case utils.IsUniqueConstraintError(err):
+			utils.SendErrorResponse(c, http.StatusConflict, "恢复失败：已存在同名的记录，请先修改或删除现有记录")
+		default:
+			utils.SendErrorResponse(c, http.StatusInternalServerError, "恢复失败: "+err.Error())
+		}
+		return
+	}
+
+	utils.SendSuccessResponse(c, gin.H{"message": "恢复成功"})
+}
+
+// DeleteTrashItem godoc
+// @Summary 永久删除回收站中的条目
+// @Description 永久删除指定条目；删除邮箱账户或平台时，回收站中引用它们的注册信息及订阅也会被永久删除
+// @Tags Trash
+// @Produce json
+// @Param type path string true "条目类型"
+// @Param id path int true "条目ID"
+// @Success 200 {object} models.SuccessResponse "删除成功"
+// @Failure 400 {object} models.ErrorResponse "无效的参数"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 404 {object} models.ErrorResponse "回收站中不存在该条目"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /trash/{type}/{id} [delete]
+// @Security BearerAuth
+func DeleteTrashItem(c *gin.Context) {
+	userID, itemType, id, ok := parseTrashParams(c)
+	if !ok {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return permanentlyDeleteTrashItem(tx, userID, itemType, id)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendErrorResponse(c, http.StatusNotFound, "回收站中未找到该条目")
+			return
+		}
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "永久删除失败: "+err.Error())
+		return
+	}
+
+	utils.SendSuccessResponse(c, gin.H{"message": "已永久删除"})
+}
+
+// EmptyTrash godoc
+// @Summary 清空回收站
+// @Description 永久删除当前用户回收站中的全部条目
+// @Tags Trash
+// @Produce json
+// @Success 200 {object} models.SuccessResponse "清空成功"
+// @Failure 401 {object} models.ErrorResponse "用户未认证"
+// @Failure 500 {object} models.ErrorResponse "服务器内部错误"
+// @Router /trash [delete]
+// @Security BearerAuth
+func EmptyTrash(c *gin.Context) {
+	userIDRaw, exists := c.Get("user_id")
+	if !exists {
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "用户未认证")
+		return
+	}
+	userID, ok := userIDRaw.(int64)
+	if !ok {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "用户ID类型错误")
+		return
+	}
+
+	purged, err := purgeTrash(database.DB.Where("user_id = ?", uint(userID)))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "清空回收站失败: "+err.Error())
+		return
+	}
+	utils.SendSuccessResponse(c, gin.H{"message": "回收站已清空", "purged": purged})
+}
+
+// --- 定时清除 ---
+
+// purgeTrash 永久删除 scope 条件下回收站中的所有条目，返回删除的顶层条目数。
+// 先处理上级记录，使其子项随之删除，再处理剩余的子项。
+func purgeTrash(scope *gorm.DB) (int, error) {
+	order := []struct {
+		itemType string
+		model    interface{}
+	}{
+		{models.TrashTypeEmailAccount, &models.EmailAccount{}},
+		{models.TrashTypePlatform, &models.Platform{}},
+		{models.TrashTypePlatformRegistration, &models.PlatformRegistration{}},
+		{models.TrashTypeServiceSubscription, &models.ServiceSubscription{}},
+	}
+
+	purged := 0
+	for _, o := range order {
+		var refs []struct {
+			ID     uint
+			UserID uint
+		}
+		if err := scope.Session(&gorm.Session{}).Unscoped().Model(o.model).Where("deleted_at IS NOT NULL").Select("id, user_id").Scan(&refs).Error; err != nil {
+			return purged, err
+		}
+		for _, ref := range refs {
+			err := database.DB.Transaction(func(tx *gorm.DB) error {
+				return permanentlyDeleteTrashItem(tx, ref.UserID, o.itemType, uint64(ref.ID))
+			})
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue // 已随上级记录一起删除
+			}
+			if err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// PurgeExpiredTrash 永久删除 deleted_at 早于 cutoff 的回收站条目
+func PurgeExpiredTrash(cutoff time.Time) (int, error) {
+	return purgeTrash(database.DB.Where("deleted_at < ?", cutoff))
+}
+
+// trashPurgeJobName 回收站清除任务在系统状态中的名称
+const trashPurgeJobName = "trash_purge"
+
+// StartTrashPurgeJob 初始化并启动回收站自动清除的定时任务
+func StartTrashPurgeJob() {
+	retentionDays := config.AppConfig.Trash.RetentionDays
+	registerJob(trashPurgeJobName, config.AppConfig.Trash.PurgeCron, retentionDays > 0)
+	if retentionDays <= 0 {
+		log.Println("Trash purge job disabled (TRASH_RETENTION_DAYS <= 0).")
+		return
+	}
+
+	c := cron.New()
+	_, err := c.AddFunc(config.AppConfig.Trash.PurgeCron, func() {
+		runJob(trashPurgeJobName, func() error {
+			cutoff := time.Now().AddDate(0, 0, -retentionDays)
+			purged, err := PurgeExpiredTrash(cutoff)
+			if err != nil {
+				log.Printf("Error purging trash: %v", err)
+				return err
+			}
+			log.Printf("Trash purge finished, %d item(s) permanently deleted.", purged)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Fatalf("Error adding trash purge cron job: %v", err)
+	}
+	c.Start()
+	log.Printf("Trash purge job started (retention: %d days).", retentionDays)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/database/dbtest"
+	"email_server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupTrashTestRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.Config{Trash: config.TrashConfig{RetentionDays: 30}}
+
+	db := dbtest.Open(t)
+	database.DB = db
+
+	r := gin.New()
+	auth := func(c *gin.Context) {
+		c.Set("user_id", int64(1))
+		c.Next()
+	}
+	r.POST("/platforms", auth, CreatePlatform)
+	r.DELETE("/platforms/:id", auth, DeletePlatform)
+	r.DELETE("/service-subscriptions/:id", auth, DeleteServiceSubscription)
+	r.GET("/trash", auth, GetTrash)
+	r.POST("/trash/:type/:id/restore", auth, RestoreTrashItem)
+	r.DELETE("/trash/:type/:id", auth, DeleteTrashItem)
+	return r, db
+}
+
+// seedPlatformTree 创建 平台 -> 注册信息 -> 两个订阅
+func seedPlatformTree(t *testing.T, db *gorm.DB) (models.Platform, models.PlatformRegistration, []models.ServiceSubscription) {
+	username := "alice"
+	platform := models.Platform{UserID: 1, Name: "Example"}
+	require.NoError(t, db.Create(&platform).Error)
+	reg := models.PlatformRegistration{UserID: 1, PlatformID: platform.ID, LoginUsername: &username}
+	require.NoError(t, db.Create(&reg).Error)
+	subs := []models.ServiceSubscription{
+		{UserID: 1, PlatformRegistrationID: reg.ID, ServiceName: "Pro", Status: "active", BillingCycle: "monthly"},
+		{UserID: 1, PlatformRegistrationID: reg.ID, ServiceName: "Storage", Status: "active", BillingCycle: "monthly"},
+	}
+	require.NoError(t, db.Create(&subs).Error)
+	return platform, reg, subs
+}
+
+func TestTrash_DeletePlatformCascadesAndRestores(t *testing.T) {
+	r, db := setupTrashTestRouter(t)
+	platform, reg, subs := seedPlatformTree(t, db)
+
+	// 先单独删除一个订阅，它不应随平台一起被恢复
+	w := doJSON(r, http.MethodDelete, "/service-subscriptions/2", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	time.Sleep(5 * time.Millisecond)
+
+	w = doJSON(r, http.MethodDelete, "/platforms/1", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var live int64
+	db.Model(&models.PlatformRegistration{}).Count(&live)
+	assert.EqualValues(t, 0, live)
+
+	w = doJSON(r, http.MethodGet, "/trash", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Data []models.TrashItemResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Data, 2) // 平台（含级联子项）+ 单独删除的订阅
+	top := list.Data[0]
+	assert.Equal(t, models.TrashTypePlatform, top.Type)
+	require.Len(t, top.Dependents, 1)
+	assert.Equal(t, models.TrashTypePlatformRegistration, top.Dependents[0].Type)
+	require.Len(t, top.Dependents[0].Dependents, 1)
+	assert.Equal(t, "Pro", top.Dependents[0].Dependents[0].Title)
+	assert.NotEmpty(t, top.PurgeAt)
+
+	w = doJSON(r, http.MethodPost, "/trash/platform/1/restore", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	require.NoError(t, db.First(&models.Platform{}, platform.ID).Error)
+	require.NoError(t, db.First(&models.PlatformRegistration{}, reg.ID).Error)
+	require.NoError(t, db.First(&models.ServiceSubscription{}, subs[0].ID).Error)
+	assert.ErrorIs(t, db.First(&models.ServiceSubscription{}, subs[1].ID).Error, gorm.ErrRecordNotFound)
+}
+
+func TestTrash_RecreateAfterDeleteAndRestoreConflict(t *testing.T) {
+	r, db := setupTrashTestRouter(t)
+	seedPlatformTree(t, db)
+
+	w := doJSON(r, http.MethodDelete, "/platforms/1", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// 回收站中的同名平台不应阻止重新创建
+	w = doJSON(r, http.MethodPost, "/platforms", map[string]interface{}{"name": "Example"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doJSON(r, http.MethodPost, "/trash/platform/1/restore", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestTrash_RestoreChildOfTrashedParent(t *testing.T) {
+	r, db := setupTrashTestRouter(t)
+	seedPlatformTree(t, db)
+
+	w := doJSON(r, http.MethodDelete, "/platforms/1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(r, http.MethodPost, "/trash/platform_registration/1/restore", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doJSON(r, http.MethodPost, "/trash/unknown/1/restore", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestTrash_PermanentDeleteAndPurge(t *testing.T) {
+	r, db := setupTrashTestRouter(t)
+	seedPlatformTree(t, db)
+
+	// 不在回收站中的条目不能被永久删除
+	w := doJSON(r, http.MethodDelete, "/trash/platform/1", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doJSON(r, http.MethodDelete, "/platforms/1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// 未到期的条目不会被自动清除
+	purged, err := PurgeExpiredTrash(time.Now().AddDate(0, 0, -30))
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged)
+
+	purged, err = PurgeExpiredTrash(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	var remaining int64
+	db.Unscoped().Model(&models.ServiceSubscription{}).Count(&remaining)
+	assert.EqualValues(t, 0, remaining)
+	db.Unscoped().Model(&models.PlatformRegistration{}).Count(&remaining)
+	assert.EqualValues(t, 0, remaining)
+	db.Unscoped().Model(&models.Platform{}).Count(&remaining)
+	assert.EqualValues(t, 0, remaining)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// unifiedInboxDefaultPageSize 统一收件箱默认从每个账户获取的邮件数量
+const unifiedInboxDefaultPageSize = 20
+
+// errUnifiedInboxTimeout 单个账户获取超时
+var errUnifiedInboxTimeout = errors.New("获取超时")
+
+// unifiedInboxFetch 获取单个账户收件箱的第一页，测试中可替换
+var unifiedInboxFetch = func(emailAccount models.EmailAccount, key inboxPageKey) ([]models.Email, error) {
+	emails, _, _, _, err := fetchInboxPage(emailAccount, key, 1, "", false)
+	return emails, err
+}
+
+// unifiedInboxFilter 统一收件箱的过滤条件，空字段表示不过滤
+type unifiedInboxFilter struct {
+	Sender     string
+	Subject    string
+	UnreadOnly bool
+}
+
+// match 邮件是否满足过滤条件：发件人匹配名称或地址，主题不区分大小写包含
+func (f unifiedInboxFilter) match(email models.Email) bool {
+	if f.UnreadOnly && email.IsRead {
+		return false
+	}
+	if f.Subject != "" && !strings.Contains(strings.ToLower(email.Subject), f.Subject) {
+		return false
+	}
+	if f.Sender == "" {
+		return true
+	}
+	for _, from := range email.From {
+		if strings.Contains(strings.ToLower(from.Address), f.Sender) || strings.Contains(strings.ToLower(from.Name), f.Sender) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAccountIDs 解析逗号分隔的账户ID列表
+func parseAccountIDs(raw string) ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := utils.StringToUint(part)
+		if err != nil || id == 0 {
+			return nil, errors.New("无效的账户ID: " + part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// fetchWithTimeout 在 timeout 内获取账户的邮件，超时后不再等待，迟到的结果被丢弃
+func fetchWithTimeout(emailAccount models.EmailAccount, key inboxPageKey, timeout time.Duration) ([]models.Email, error) {
+	type result struct {
+		emails []models.Email
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		emails, err := unifiedInboxFetch(emailAccount, key)
+		done <- result{emails, err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.emails, r.err
+	case <-timer.C:
+		return nil, errUnifiedInboxTimeout
+	}
+}
+
+// unifiedInboxError 返回给客户端的账户错误信息
+func unifiedInboxError(err error) string {
+	switch {
+	case errors.Is(err, errUnifiedInboxTimeout):
+		return err.Error()
+	case errors.Is(err, errIMAPNotConfigured):
+		return "未配置 IMAP 服务器"
+	case strings.Contains(err.Error(), "oauth2") || strings.Contains(err.Error(), "re-authenticate"):
+		return "授权已失效，请重新连接该邮箱账户"
+	}
+	return "获取邮件失败"
+}
+
+// GetUnifiedInbox 汇总用户多个邮箱账户的收件箱
+// @Summary 统一收件箱
+// @Description 并发获取全部（或 account_ids、provider 选定的）邮箱账户的最新邮件，按日期倒序合并。
+// @Description 每个账户单独超时，失败的账户在 accounts 中报告错误，不影响其他账户。过滤条件作用于每个账户获取到的最新 pageSize 封邮件
+// @Tags Inbox
+// @Produce json
+// @Security BearerAuth
+// @Param account_ids query string false "逗号分隔的邮箱账户ID，默认为全部账户"
+// @Param provider query string false "只包含该服务商的账户（不区分大小写）"
+// @Param folder query string false "文件夹，默认 inbox"
+// @Param pageSize query int false "每个账户获取的邮件数量，默认 20，最多 100"
+// @Param sender query string false "发件人名称或地址包含"
+// @Param subject query string false "主题包含"
+// @Param unread query bool false "只返回未读邮件"
+// @Success 200 {object} models.SuccessResponse "返回 emails、accounts、total"
+// @Failure 400 {object} models.ErrorResponse "参数错误"
+// @Router /inbox/unified [get]
+func GetUnifiedInbox(c *gin.Context) {
+	userID := uint(c.GetInt64("user_id"))
+	accountIDs, err := parseAccountIDs(c.Query("account_ids"))
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(unifiedInboxDefaultPageSize)))
+	if pageSize < 1 {
+		pageSize = unifiedInboxDefaultPageSize
+	} else if pageSize > inboxMaxPageSize {
+		pageSize = inboxMaxPageSize
+	}
+	folder := c.DefaultQuery("folder", "inbox")
+	unread, _ := strconv.ParseBool(c.Query("unread"))
+	filter := unifiedInboxFilter{
+		Sender:     strings.ToLower(strings.TrimSpace(c.Query("sender"))),
+		Subject:    strings.ToLower(strings.TrimSpace(c.Query("subject"))),
+		UnreadOnly: unread,
+	}
+
+	query := database.DB.Where("user_id = ?", userID)
+	if len(accountIDs) > 0 {
+		query = query.Where("id IN ?", accountIDs)
+	}
+	if provider := strings.TrimSpace(c.Query("provider")); provider != "" {
+		query = query.Where("LOWER(provider) = ?", strings.ToLower(provider))
+	}
+	var accounts []models.EmailAccount
+	if err := query.Order("id").Find(&accounts).Error; err != nil {
+		log.Printf("[GetUnifiedInbox] Failed to load email accounts for user %d: %v", userID, err)
+		utils.SendErrorResponse(c, http.StatusInternalServerError, "获取邮箱账户失败")
+		return
+	}
+
+	timeout := time.Duration(config.AppConfig.UnifiedInbox.AccountTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	concurrency := config.AppConfig.UnifiedInbox.Concurrency
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+
+	fetched := make([][]models.Email, len(accounts))
+	errs := make([]error, len(accounts))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, account := range accounts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, account models.EmailAccount) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			key := inboxPageKey{UserID: userID, AccountID: account.ID, Folder: folder, PageSize: pageSize}
+			fetched[i], errs[i] = fetchWithTimeout(account, key, timeout)
+		}(i, account)
+	}
+	wg.Wait()
+
+	emails := []models.Email{}
+	results := make([]models.UnifiedInboxAccount, len(accounts))
+	for i, account := range accounts {
+		results[i] = models.UnifiedInboxAccount{AccountID: account.ID, EmailAddress: account.EmailAddress}
+		if errs[i] != nil {
+			log.Printf("[GetUnifiedInbox] Fetching account %d failed: %v", account.ID, errs[i])
+			results[i].Error = unifiedInboxError(errs[i])
+			continue
+		}
+		cacheInboxEmails(userID, account.ID, folder, fetched[i])
+		for _, email := range fetched[i] {
+			if !filter.match(email) {
+				continue
+			}
+			email.AccountID = account.ID
+			email.AccountEmail = account.EmailAddress
+			emails = append(emails, email)
+			results[i].Count++
+		}
+	}
+
+	sort.SliceStable(emails, func(a, b int) bool { return emails[a].Date.After(emails[b].Date) })
+	if err := annotateEmailPlatforms(userID, emails); err != nil {
+		log.Printf("[GetUnifiedInbox] Failed to match sender platforms: %v", err)
+	}
+	for i := range emails {
+		sanitizeEmailHTML(userID, &emails[i], false)
+	}
+
+	utils.SendSuccessResponse(c, gin.H{
+		"emails":   emails,
+		"accounts": results,
+		"total":    len(emails),
+	})
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"email_server/config"
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUnifiedInbox_MergesAccountsAndReportsErrors(t *testing.T) {
+	r, db := setupAdminTestRouter(t)
+	owner := registerUser(t, r, "olga", "olga@example.com")
+	other := registerUser(t, r, "pete", "pete@example.com")
+	ownerID := uint(owner.User.ID)
+
+	gmail := models.EmailAccount{UserID: ownerID, EmailAddress: "olga@gmail.com", Provider: "Gmail"}
+	outlook := models.EmailAccount{UserID: ownerID, EmailAddress: "olga@outlook.com", Provider: "Outlook"}
+	broken := models.EmailAccount{UserID: ownerID, EmailAddress: "olga@broken.example", Provider: "Other"}
+	slow := models.EmailAccount{UserID: ownerID, EmailAddress: "olga@slow.example", Provider: "Other"}
+	foreign := models.EmailAccount{UserID: uint(other.User.ID), EmailAddress: "pete@gmail.com", Provider: "Gmail"}
+	for _, account := range []*models.EmailAccount{&gmail, &outlook, &broken, &slow, &foreign} {
+		require.NoError(t, db.Create(account).Error)
+	}
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mail := func(id, subject, from string, hours int, read bool) models.Email {
+		return models.Email{MessageID: id, Subject: subject, From: []models.EmailAddress{{Name: "Sender", Address: from}},
+			Date: base.Add(time.Duration(hours) * time.Hour), IsRead: read}
+	}
+	original := unifiedInboxFetch
+	unifiedInboxFetch = func(account models.EmailAccount, key inboxPageKey) ([]models.Email, error) {
+		assert.NotEqual(t, foreign.ID, account.ID, "不能获取其他用户的账户")
+		switch account.ID {
+		case gmail.ID:
+			return []models.Email{
+				mail("g1", "Verify your email", "no-reply@github.com", 3, false),
+				mail("g2", "Weekly digest", "news@shop.example", 1, true),
+			}, nil
+		case outlook.ID:
+			return []models.Email{mail("o1", "Your verification code", "security@github.com", 2, false)}, nil
+		case slow.ID:
+			time.Sleep(1500 * time.Millisecond)
+			return []models.Email{mail("s1", "late", "x@slow.example", 5, false)}, nil
+		}
+		return nil, errors.New("dial tcp: connection refused")
+	}
+	config.AppConfig.UnifiedInbox.AccountTimeoutSeconds = 1
+	t.Cleanup(func() {
+		unifiedInboxFetch = original
+		config.AppConfig.UnifiedInbox.AccountTimeoutSeconds = 0
+	})
+
+	type response struct {
+		Emails   []models.Email               `json:"emails"`
+		Accounts []models.UnifiedInboxAccount `json:"accounts"`
+		Total    int                          `json:"total"`
+	}
+	get := func(query string) response {
+		w := doAuthJSON(r, "GET", "/api/v1/inbox/unified"+query, owner.Token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp response
+		decodeData(t, w, &resp)
+		return resp
+	}
+
+	resp := get("")
+	require.Len(t, resp.Accounts, 4)
+	var ids []string
+	for _, email := range resp.Emails {
+		ids = append(ids, email.MessageID)
+	}
+	assert.Equal(t, []string{"g1", "o1", "g2"}, ids, "按日期倒序合并")
+	assert.Equal(t, gmail.ID, resp.Emails[0].AccountID)
+	assert.Equal(t, "olga@outlook.com", resp.Emails[1].AccountEmail)
+	errorsByAccount := map[uint]string{}
+	for _, account := range resp.Accounts {
+		errorsByAccount[account.AccountID] = account.Error
+	}
+	assert.Empty(t, errorsByAccount[gmail.ID])
+	assert.Equal(t, "获取邮件失败", errorsByAccount[broken.ID])
+	assert.Equal(t, "获取超时", errorsByAccount[slow.ID])
+
+	resp = get("?sender=GITHUB&unread=true&subject=verif")
+	assert.Equal(t, 2, resp.Total)
+	resp = get("?unread=1&subject=code")
+	require.Len(t, resp.Emails, 1)
+	assert.Equal(t, "o1", resp.Emails[0].MessageID)
+
+	resp = get("?provider=gmail")
+	require.Len(t, resp.Accounts, 1)
+	assert.Equal(t, gmail.ID, resp.Accounts[0].AccountID)
+	resp = get(fmt.Sprintf("?account_ids=%d,%d", outlook.ID, foreign.ID))
+	require.Len(t, resp.Accounts, 1, "其他用户的账户被忽略")
+	assert.Equal(t, 1, resp.Accounts[0].Count)
+
+	w := doAuthJSON(r, "GET", "/api/v1/inbox/unified?account_ids=1,abc", owner.Token, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
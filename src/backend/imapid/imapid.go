@@ -0,0 +1,81 @@
+// Package imapid 把 IMAP 邮件的位置（文件夹 + UIDVALIDITY + UID）编码为对外使用的不透明邮件 ID。
+// UID 在 UIDVALIDITY 不变时保持稳定，按 ID 查看邮件只需一次 UID FETCH，无需扫描整个文件夹。
+package imapid
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// prefix 区分 IMAP 邮件 ID 与 Message-ID 头（含 < @ >）及 Gmail/Graph 的邮件 ID
+const prefix = "imap_"
+
+// ID IMAP 邮件在服务器上的位置
+type ID struct {
+	Folder      string // 文件夹名称（服务器上的原始名称，如 INBOX）
+	UIDValidity uint32 // 选择文件夹时服务器返回的 UIDVALIDITY，变化后原 UID 失效
+	UID         uint32
+}
+
+// String 编码为 URL 安全的不透明字符串
+func (id ID) String() string {
+	raw := fmt.Sprintf("%d:%d:%s", id.UIDValidity, id.UID, id.Folder)
+	return prefix + base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Parse 解析 String 生成的 ID，不是 IMAP 邮件 ID 时返回 false（调用方可按 Message-ID 处理）
+func Parse(s string) (ID, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return ID{}, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s[len(prefix):])
+	if err != nil {
+		return ID{}, false
+	}
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return ID{}, false
+	}
+	validity, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return ID{}, false
+	}
+	uid, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil || uid == 0 {
+		return ID{}, false
+	}
+	return ID{Folder: parts[2], UIDValidity: uint32(validity), UID: uint32(uid)}, true
+}
+
+// threadPrefix 区分 IMAP 会话 ID 与邮件 ID
+const threadPrefix = "imapthread_"
+
+// ThreadID IMAP 会话：文件夹 + 会话根邮件的 Message-ID。
+// 会话中的邮件都在 References 或 In-Reply-To 中引用根邮件，可以用 SEARCH 重新找到
+type ThreadID struct {
+	Folder string
+	Root   string // 根邮件的 Message-ID，不含尖括号
+}
+
+// String 编码为 URL 安全的不透明字符串
+func (id ThreadID) String() string {
+	return threadPrefix + base64.RawURLEncoding.EncodeToString([]byte(id.Folder+"\n"+id.Root))
+}
+
+// ParseThread 解析 ThreadID.String 生成的 ID
+func ParseThread(s string) (ThreadID, bool) {
+	if !strings.HasPrefix(s, threadPrefix) {
+		return ThreadID{}, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s[len(threadPrefix):])
+	if err != nil {
+		return ThreadID{}, false
+	}
+	folder, root, ok := strings.Cut(string(raw), "\n")
+	if !ok || folder == "" || root == "" {
+		return ThreadID{}, false
+	}
+	return ThreadID{Folder: folder, Root: root}, true
+}
@@ -0,0 +1,55 @@
+package imapid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, id := range []ID{
+		{Folder: "INBOX", UIDValidity: 1700000000, UID: 42},
+		{Folder: "[Gmail]/已发送邮件:备份", UIDValidity: 0, UID: 4294967295},
+	} {
+		encoded := id.String()
+		assert.NotContains(t, encoded, "/")
+		parsed, ok := Parse(encoded)
+		assert.True(t, ok, encoded)
+		assert.Equal(t, id, parsed)
+	}
+}
+
+func TestParse_RejectsOtherIDs(t *testing.T) {
+	for _, s := range []string{
+		"<CAF=abc@mail.gmail.com>",
+		"18c2f0a1b2c3d4e5",
+		"AAMkAGI2TG93AAA=",
+		"imap_!!!",
+		ID{Folder: "INBOX", UIDValidity: 1, UID: 0}.String(),
+		ID{Folder: "", UIDValidity: 1, UID: 3}.String(),
+	} {
+		_, ok := Parse(s)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestThreadRoundTrip(t *testing.T) {
+	id := ThreadID{Folder: "[Gmail]/已发送邮件", Root: "CAF=abc+1@mail.gmail.com"}
+	encoded := id.String()
+	assert.NotContains(t, encoded, "/")
+	parsed, ok := ParseThread(encoded)
+	assert.True(t, ok)
+	assert.Equal(t, id, parsed)
+
+	_, ok = Parse(encoded)
+	assert.False(t, ok, "会话 ID 不是邮件 ID")
+	for _, s := range []string{
+		ID{Folder: "INBOX", UIDValidity: 1, UID: 3}.String(),
+		"18c2f0a1b2c3d4e5",
+		ThreadID{Folder: "INBOX"}.String(),
+		ThreadID{Root: "a@x"}.String(),
+	} {
+		_, ok := ParseThread(s)
+		assert.False(t, ok, s)
+	}
+}
@@ -0,0 +1,91 @@
+package imappool
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DeadlineConn 为使用中的连接限制服务器无响应的时间。
+//
+// IMAP 客户端在等待命令响应时不设置读超时，服务器不响应会让请求一直挂起。
+// 连接处于使用中（SetActive(true)）且客户端没有设置读超时时，每次读取最多等待 timeout；
+// 空闲时不限制，以便连接留在池中。读写出错后 Broken 返回 true，这样的连接不应再放回池中。
+type DeadlineConn struct {
+	net.Conn
+	timeout time.Duration
+
+	mu sync.Mutex
+	// active 是否正在执行命令
+	active bool
+	// clientDeadline 客户端自己设置的读超时
+	clientDeadline time.Time
+	broken         atomic.Bool
+}
+
+// NewDeadlineConn 包装 conn，timeout <= 0 时不限制
+func NewDeadlineConn(conn net.Conn, timeout time.Duration) *DeadlineConn {
+	return &DeadlineConn{Conn: conn, timeout: timeout}
+}
+
+// readDeadline 返回当前应生效的读超时，需持有锁
+func (c *DeadlineConn) readDeadline() time.Time {
+	if !c.clientDeadline.IsZero() || !c.active || c.timeout <= 0 {
+		return c.clientDeadline
+	}
+	return time.Now().Add(c.timeout)
+}
+
+// SetActive 标记连接开始或结束使用，同时更新正在等待的读取的超时
+func (c *DeadlineConn) SetActive(active bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active = active
+	c.Conn.SetReadDeadline(c.readDeadline())
+}
+
+// Broken 连接是否出现过读写错误
+func (c *DeadlineConn) Broken() bool {
+	return c.broken.Load()
+}
+
+func (c *DeadlineConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	if c.active && c.clientDeadline.IsZero() && c.timeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+	c.mu.Unlock()
+	n, err := c.Conn.Read(p)
+	if err != nil {
+		c.broken.Store(true)
+	}
+	return n, err
+}
+
+func (c *DeadlineConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if err != nil {
+		c.broken.Store(true)
+	}
+	return n, err
+}
+
+func (c *DeadlineConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clientDeadline = t
+	return c.Conn.SetReadDeadline(c.readDeadline())
+}
+
+func (c *DeadlineConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *DeadlineConn) Close() error {
+	c.broken.Store(true)
+	return c.Conn.Close()
+}
@@ -0,0 +1,71 @@
+package imappool
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadlineConn_TimesOutOnlyWhileActive(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := NewDeadlineConn(client, 30*time.Millisecond)
+	defer conn.Close()
+
+	// 空闲时不超时
+	read := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		t.Fatalf("idle read returned early: %v", err)
+	case <-time.After(80 * time.Millisecond):
+	}
+	assert.False(t, conn.Broken())
+
+	// 开始使用后，正在等待的读取也会超时
+	conn.SetActive(true)
+	select {
+	case err := <-read:
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	case <-time.After(2 * time.Second):
+		t.Fatal("active read did not time out")
+	}
+	assert.True(t, conn.Broken())
+}
+
+func TestDeadlineConn_ClientDeadlineWins(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := NewDeadlineConn(client, time.Hour)
+	defer conn.Close()
+	conn.SetActive(true)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	start := time.Now()
+	_, err := conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestDeadlineConn_ActiveReadSucceeds(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := NewDeadlineConn(client, time.Second)
+	defer conn.Close()
+	conn.SetActive(true)
+
+	go server.Write([]byte("* OK\r\n"))
+	buf := make([]byte, 6)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "* OK\r\n", string(buf[:n]))
+	conn.SetActive(false)
+	assert.False(t, conn.Broken())
+}
@@ -0,0 +1,373 @@
+// Package imappool 复用已登录的 IMAP 连接。
+//
+// 连接按 key（通常是邮箱账户和其登录信息的指纹）归还到空闲列表，下一次同一账户的操作直接取用，
+// 避免每次请求都重新建立 TLS 和登录。同一服务器同时打开的连接数有上限，达到上限时先关闭其他账户的空闲连接，
+// 仍然没有名额则等待，超时返回 ErrExhausted。空闲超过 IdleTimeout 的连接被关闭，
+// 空闲超过 HealthCheckAfter 的连接在取用前先检查（IMAP NOOP）。
+package imappool
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrExhausted 服务器的连接数已达上限，等待超时
+var ErrExhausted = errors.New("imap pool: too many connections to server")
+
+// Conn 池中的连接
+type Conn interface {
+	// Check 检查连接是否仍然可用
+	Check() error
+	Close() error
+}
+
+// Options 连接池参数
+type Options struct {
+	// MaxPerServer 同一服务器同时打开的连接数上限（含空闲连接），<=0 表示不限制
+	MaxPerServer int
+	// MaxIdlePerKey 每个 key 保留的空闲连接数，<=0 时不保留空闲连接（即不复用）
+	MaxIdlePerKey int
+	// IdleTimeout 空闲连接的保留时间，<=0 时不保留空闲连接
+	IdleTimeout time.Duration
+	// HealthCheckAfter 空闲超过该时间的连接在取用前先 Check
+	HealthCheckAfter time.Duration
+	// WaitTimeout 连接数达到上限时等待空闲名额的时间
+	WaitTimeout time.Duration
+}
+
+type idleConn struct {
+	conn   Conn
+	server string
+	key    string
+	since  time.Time
+}
+
+type serverState struct {
+	open  int
+	inUse int
+	// released 有连接关闭或归还时关闭并替换，用于唤醒等待名额的调用方
+	released chan struct{}
+}
+
+// Pool 连接池，可并发使用
+type Pool struct {
+	opts Options
+
+	mu      sync.Mutex
+	servers map[string]*serverState
+	idle    map[string][]*idleConn
+	closed  bool
+	stats   Counters
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Counters 连接池的累计计数
+type Counters struct {
+	Dials               int64 `json:"dials"`
+	DialFailures        int64 `json:"dial_failures"`
+	Reused              int64 `json:"reused"`
+	HealthCheckFailures int64 `json:"health_check_failures"`
+	Evicted             int64 `json:"evicted"`
+	Expired             int64 `json:"expired"`
+	Waits               int64 `json:"waits"`
+	WaitTimeouts        int64 `json:"wait_timeouts"`
+}
+
+// ServerStats 单个服务器的连接数
+type ServerStats struct {
+	Server string `json:"server"`
+	Open   int    `json:"open"`
+	InUse  int    `json:"in_use"`
+	Idle   int    `json:"idle"`
+}
+
+// Stats 连接池的使用情况，计数从进程启动开始累计
+type Stats struct {
+	Counters
+	MaxPerServer int           `json:"max_per_server"`
+	Servers      []ServerStats `json:"servers"`
+}
+
+// New 创建连接池。保留空闲连接时启动后台清理，Close 时停止
+func New(opts Options) *Pool {
+	p := &Pool{
+		opts:    opts,
+		servers: make(map[string]*serverState),
+		idle:    make(map[string][]*idleConn),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if p.reuses() {
+		go p.reap()
+	} else {
+		close(p.done)
+	}
+	return p
+}
+
+func (p *Pool) reuses() bool {
+	return p.opts.MaxIdlePerKey > 0 && p.opts.IdleTimeout > 0
+}
+
+func (p *Pool) server(name string) *serverState {
+	s := p.servers[name]
+	if s == nil {
+		s = &serverState{released: make(chan struct{})}
+		p.servers[name] = s
+	}
+	return s
+}
+
+// notify 唤醒等待该服务器名额的调用方，需持有锁
+func (s *serverState) notify() {
+	close(s.released)
+	s.released = make(chan struct{})
+}
+
+// Lease 从池中取出的连接，用完后必须调用 Release
+type Lease struct {
+	Conn Conn
+	// Reused 是否为复用的空闲连接
+	Reused bool
+
+	pool   *Pool
+	server string
+	key    string
+	once   sync.Once
+}
+
+// Get 取出 key 的空闲连接，没有时在 server 的名额内调用 dial 建立新连接
+func (p *Pool) Get(server, key string, dial func() (Conn, error)) (*Lease, error) {
+	var deadline time.Time
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, errors.New("imap pool: closed")
+		}
+		s := p.server(server)
+
+		if idle := p.popIdle(key); idle != nil {
+			s.inUse++
+			p.mu.Unlock()
+			if p.opts.HealthCheckAfter > 0 && time.Since(idle.since) >= p.opts.HealthCheckAfter {
+				if err := idle.conn.Check(); err != nil {
+					idle.conn.Close()
+					p.mu.Lock()
+					p.stats.HealthCheckFailures++
+					s.inUse--
+					s.open--
+					s.notify()
+					p.mu.Unlock()
+					continue
+				}
+			}
+			p.mu.Lock()
+			p.stats.Reused++
+			p.mu.Unlock()
+			return &Lease{Conn: idle.conn, Reused: true, pool: p, server: server, key: key}, nil
+		}
+
+		if p.opts.MaxPerServer <= 0 || s.open < p.opts.MaxPerServer {
+			s.open++
+			s.inUse++
+			p.stats.Dials++
+			p.mu.Unlock()
+			conn, err := dial()
+			if err != nil {
+				p.mu.Lock()
+				p.stats.DialFailures++
+				s.open--
+				s.inUse--
+				s.notify()
+				p.mu.Unlock()
+				return nil, err
+			}
+			return &Lease{Conn: conn, pool: p, server: server, key: key}, nil
+		}
+
+		// 名额已满：关闭该服务器上最久未用的其他账户的空闲连接
+		if victim := p.oldestIdle(server); victim != nil {
+			p.removeIdle(victim)
+			s.open--
+			p.stats.Evicted++
+			p.mu.Unlock()
+			victim.conn.Close()
+			continue
+		}
+
+		if deadline.IsZero() {
+			deadline = time.Now().Add(p.opts.WaitTimeout)
+			p.stats.Waits++
+		}
+		released := s.released
+		p.mu.Unlock()
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			p.mu.Lock()
+			p.stats.WaitTimeouts++
+			p.mu.Unlock()
+			return nil, ErrExhausted
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-released:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// popIdle 取出 key 最近归还的空闲连接，需持有锁
+func (p *Pool) popIdle(key string) *idleConn {
+	conns := p.idle[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	idle := conns[len(conns)-1]
+	if len(conns) == 1 {
+		delete(p.idle, key)
+	} else {
+		p.idle[key] = conns[:len(conns)-1]
+	}
+	return idle
+}
+
+// oldestIdle 返回 server 上空闲最久的连接，需持有锁
+func (p *Pool) oldestIdle(server string) *idleConn {
+	var oldest *idleConn
+	for _, conns := range p.idle {
+		for _, idle := range conns {
+			if idle.server == server && (oldest == nil || idle.since.Before(oldest.since)) {
+				oldest = idle
+			}
+		}
+	}
+	return oldest
+}
+
+// removeIdle 从空闲列表中移除连接，需持有锁
+func (p *Pool) removeIdle(target *idleConn) {
+	conns := p.idle[target.key]
+	for i, idle := range conns {
+		if idle == target {
+			conns = append(conns[:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(conns) == 0 {
+		delete(p.idle, target.key)
+	} else {
+		p.idle[target.key] = conns
+	}
+}
+
+// Release 归还连接。reusable 为 false（连接出错或状态未知）或空闲连接已足够时关闭连接。重复调用无效
+func (l *Lease) Release(reusable bool) {
+	l.once.Do(func() {
+		p := l.pool
+		p.mu.Lock()
+		s := p.server(l.server)
+		s.inUse--
+		if reusable && !p.closed && p.reuses() && len(p.idle[l.key]) < p.opts.MaxIdlePerKey {
+			p.idle[l.key] = append(p.idle[l.key], &idleConn{conn: l.Conn, server: l.server, key: l.key, since: time.Now()})
+			s.notify()
+			p.mu.Unlock()
+			return
+		}
+		s.open--
+		s.notify()
+		p.mu.Unlock()
+		l.Conn.Close()
+	})
+}
+
+// reap 定期关闭空闲超时的连接
+func (p *Pool) reap() {
+	defer close(p.done)
+	interval := p.opts.IdleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.closeIdle(func(idle *idleConn) bool { return time.Since(idle.since) >= p.opts.IdleTimeout }, true)
+		}
+	}
+}
+
+// closeIdle 关闭满足条件的空闲连接
+func (p *Pool) closeIdle(match func(*idleConn) bool, expired bool) {
+	var closing []*idleConn
+	p.mu.Lock()
+	for _, conns := range p.idle {
+		for _, idle := range conns {
+			if match(idle) {
+				closing = append(closing, idle)
+			}
+		}
+	}
+	for _, idle := range closing {
+		p.removeIdle(idle)
+		s := p.server(idle.server)
+		s.open--
+		s.notify()
+		if expired {
+			p.stats.Expired++
+		}
+	}
+	p.mu.Unlock()
+	for _, idle := range closing {
+		idle.conn.Close()
+	}
+}
+
+// CloseIdle 关闭 key 满足 match 的空闲连接，例如账户被删除或修改了登录信息时
+func (p *Pool) CloseIdle(match func(key string) bool) {
+	p.closeIdle(func(idle *idleConn) bool { return match(idle.key) }, false)
+}
+
+// Close 关闭所有空闲连接并停止清理，之后归还的连接直接关闭
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	p.mu.Unlock()
+	close(p.stop)
+	<-p.done
+	p.closeIdle(func(*idleConn) bool { return true }, false)
+}
+
+// Stats 返回连接池的当前使用情况
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	idleByServer := map[string]int{}
+	for _, conns := range p.idle {
+		for _, idle := range conns {
+			idleByServer[idle.server]++
+		}
+	}
+	stats := Stats{Counters: p.stats, MaxPerServer: p.opts.MaxPerServer, Servers: []ServerStats{}}
+	for name, s := range p.servers {
+		if s.open == 0 {
+			continue
+		}
+		stats.Servers = append(stats.Servers, ServerStats{Server: name, Open: s.open, InUse: s.inUse, Idle: idleByServer[name]})
+	}
+	sort.Slice(stats.Servers, func(i, j int) bool { return stats.Servers[i].Server < stats.Servers[j].Server })
+	return stats
+}
@@ -0,0 +1,203 @@
+package imappool
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConn struct {
+	id       int
+	checkErr error
+	mu       sync.Mutex
+	checks   int
+	closed   bool
+}
+
+func (c *fakeConn) Check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks++
+	return c.checkErr
+}
+
+func (c *fakeConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+type dialer struct {
+	mu    sync.Mutex
+	conns []*fakeConn
+}
+
+func (d *dialer) dial() (Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	conn := &fakeConn{id: len(d.conns) + 1}
+	d.conns = append(d.conns, conn)
+	return conn, nil
+}
+
+func newPool(t *testing.T, opts Options) *Pool {
+	p := New(opts)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestPool_ReusesIdleConnectionPerKey(t *testing.T) {
+	p := newPool(t, Options{MaxPerServer: 5, MaxIdlePerKey: 1, IdleTimeout: time.Minute, HealthCheckAfter: time.Hour})
+	d := &dialer{}
+
+	first, err := p.Get("imap.example.com:993", "a", d.dial)
+	require.NoError(t, err)
+	assert.False(t, first.Reused)
+	first.Release(true)
+	first.Release(true) // 重复归还无效
+
+	again, err := p.Get("imap.example.com:993", "a", d.dial)
+	require.NoError(t, err)
+	assert.True(t, again.Reused)
+	assert.Same(t, first.Conn, again.Conn)
+
+	other, err := p.Get("imap.example.com:993", "b", d.dial)
+	require.NoError(t, err)
+	assert.False(t, other.Reused, "不同账户不共用连接")
+
+	stats := p.Stats()
+	require.Len(t, stats.Servers, 1)
+	assert.Equal(t, ServerStats{Server: "imap.example.com:993", Open: 2, InUse: 2}, stats.Servers[0])
+
+	again.Release(false)
+	assert.True(t, again.Conn.(*fakeConn).isClosed(), "不可复用的连接直接关闭")
+	other.Release(true)
+	stats = p.Stats()
+	assert.Equal(t, ServerStats{Server: "imap.example.com:993", Open: 1, Idle: 1}, stats.Servers[0])
+	assert.Equal(t, int64(2), stats.Dials)
+	assert.Equal(t, int64(1), stats.Reused)
+}
+
+func TestPool_KeepsAtMostMaxIdlePerKey(t *testing.T) {
+	p := newPool(t, Options{MaxPerServer: 5, MaxIdlePerKey: 1, IdleTimeout: time.Minute})
+	d := &dialer{}
+	first, _ := p.Get("s", "a", d.dial)
+	second, _ := p.Get("s", "a", d.dial)
+	first.Release(true)
+	second.Release(true)
+	assert.False(t, d.conns[0].isClosed())
+	assert.True(t, d.conns[1].isClosed())
+	assert.Equal(t, 1, p.Stats().Servers[0].Open)
+}
+
+func TestPool_HealthCheckDiscardsDeadConnection(t *testing.T) {
+	p := newPool(t, Options{MaxPerServer: 5, MaxIdlePerKey: 1, IdleTimeout: time.Minute, HealthCheckAfter: time.Nanosecond})
+	d := &dialer{}
+	lease, _ := p.Get("s", "a", d.dial)
+	lease.Release(true)
+	d.conns[0].checkErr = errors.New("connection reset")
+
+	lease, err := p.Get("s", "a", d.dial)
+	require.NoError(t, err)
+	assert.False(t, lease.Reused)
+	assert.Same(t, d.conns[1], lease.Conn)
+	assert.True(t, d.conns[0].isClosed())
+	assert.Equal(t, int64(1), p.Stats().HealthCheckFailures)
+}
+
+func TestPool_LimitsConnectionsPerServer(t *testing.T) {
+	p := newPool(t, Options{MaxPerServer: 2, MaxIdlePerKey: 1, IdleTimeout: time.Minute, WaitTimeout: 50 * time.Millisecond})
+	d := &dialer{}
+
+	idle, _ := p.Get("s", "a", d.dial)
+	busy, _ := p.Get("s", "b", d.dial)
+	idle.Release(true)
+
+	// 名额已满时关闭其他账户的空闲连接
+	c, err := p.Get("s", "c", d.dial)
+	require.NoError(t, err)
+	assert.True(t, d.conns[0].isClosed())
+	assert.Equal(t, int64(1), p.Stats().Evicted)
+
+	// 其他服务器不受影响
+	elsewhere, err := p.Get("t", "a", d.dial)
+	require.NoError(t, err)
+	elsewhere.Release(true)
+
+	_, err = p.Get("s", "d", d.dial)
+	assert.ErrorIs(t, err, ErrExhausted)
+	assert.Equal(t, int64(1), p.Stats().WaitTimeouts)
+
+	// 等待中的调用方在名额释放后继续
+	p.opts.WaitTimeout = 5 * time.Second
+	got := make(chan *Lease)
+	go func() {
+		lease, err := p.Get("s", "d", d.dial)
+		assert.NoError(t, err)
+		got <- lease
+	}()
+	time.Sleep(20 * time.Millisecond)
+	busy.Release(false)
+	select {
+	case lease := <-got:
+		lease.Release(true)
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiter was not woken up")
+	}
+	c.Release(true)
+}
+
+func TestPool_ExpiresIdleConnections(t *testing.T) {
+	p := newPool(t, Options{MaxIdlePerKey: 1, IdleTimeout: 10 * time.Millisecond})
+	d := &dialer{}
+	lease, _ := p.Get("s", "a", d.dial)
+	lease.Release(true)
+	p.closeIdle(func(idle *idleConn) bool { return time.Since(idle.since) >= p.opts.IdleTimeout }, true)
+	assert.False(t, d.conns[0].isClosed(), "未超时")
+
+	time.Sleep(20 * time.Millisecond)
+	p.closeIdle(func(idle *idleConn) bool { return time.Since(idle.since) >= p.opts.IdleTimeout }, true)
+	assert.True(t, d.conns[0].isClosed())
+	assert.Equal(t, int64(1), p.Stats().Expired)
+	assert.Empty(t, p.Stats().Servers)
+}
+
+func TestPool_CloseIdleByKeyAndClose(t *testing.T) {
+	p := New(Options{MaxIdlePerKey: 1, IdleTimeout: time.Minute})
+	d := &dialer{}
+	a, _ := p.Get("s", "1:a", d.dial)
+	b, _ := p.Get("s", "2:b", d.dial)
+	inUse, _ := p.Get("s", "3:c", d.dial)
+	a.Release(true)
+	b.Release(true)
+
+	p.CloseIdle(func(key string) bool { return key == "1:a" })
+	assert.True(t, d.conns[0].isClosed())
+	assert.False(t, d.conns[1].isClosed())
+
+	p.Close()
+	assert.True(t, d.conns[1].isClosed())
+	inUse.Release(true)
+	assert.True(t, d.conns[2].isClosed(), "关闭后归还的连接直接关闭")
+	_, err := p.Get("s", "1:a", d.dial)
+	assert.Error(t, err)
+}
+
+func TestPool_WithoutIdleTimeoutNeverReuses(t *testing.T) {
+	p := newPool(t, Options{MaxIdlePerKey: 2})
+	d := &dialer{}
+	lease, _ := p.Get("s", "a", d.dial)
+	lease.Release(true)
+	assert.True(t, d.conns[0].isClosed())
+}
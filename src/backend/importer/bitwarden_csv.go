@@ -111,7 +111,15 @@ func ParseBitwardenCSV(reader io.Reader, importPasswords bool) ([]models.Importe
 		item.Folder = getValue("folder")
 		item.ItemName = getValue("name")
 		item.Notes = getValue("notes")
-		item.URL = getValue("login_uri")
+		// 多个网址在 login_uri 列中以逗号分隔；CSV 不包含匹配方式，均按默认方式导入
+		for _, uri := range strings.Split(getValue("login_uri"), ",") {
+			if uri = strings.TrimSpace(uri); uri != "" {
+				item.URLs = append(item.URLs, models.ImportedURL{URL: uri})
+			}
+		}
+		if len(item.URLs) > 0 {
+			item.URL = item.URLs[0].URL
+		}
 		item.Username = getValue("login_username")
 		item.TOTP = getValue("login_totp")
 
@@ -28,7 +28,7 @@ func TestParseBitwardenCSV(t *testing.T) {
 		}
 		item1 := items[0]
 		expectedItem1 := models.ImportedLoginItem{
-			SourceName: "Bitwarden", ItemName: "Example Site", Username: "user@example.com", Password: "password123", URL: "https://example.com", Notes: "Some notes here", Folder: "Work", TOTP: "otpauth://totp/Example:user@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example",
+			SourceName: "Bitwarden", ItemName: "Example Site", Username: "user@example.com", Password: "password123", URL: "https://example.com", URLs: []models.ImportedURL{{URL: "https://example.com"}}, Notes: "Some notes here", Folder: "Work", TOTP: "otpauth://totp/Example:user@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example",
 			CustomFields: map[string]string{"type": "login", "reprompt": "0", "favorite": "0", "custom_field_1": "value1", "secret_code": "1234"},
 		}
 		if !reflect.DeepEqual(item1, expectedItem1) {
@@ -36,7 +36,7 @@ func TestParseBitwardenCSV(t *testing.T) {
 		}
 		item2 := items[1]
 		expectedItem2 := models.ImportedLoginItem{
-			SourceName: "Bitwarden", ItemName: "Another Site", Username: "anotheruser", Password: "anotherpass", URL: "https://another.com", Notes: "", Folder: "", TOTP: "",
+			SourceName: "Bitwarden", ItemName: "Another Site", Username: "anotheruser", Password: "anotherpass", URL: "https://another.com", URLs: []models.ImportedURL{{URL: "https://another.com"}}, Notes: "", Folder: "", TOTP: "",
 			CustomFields: map[string]string{"type": "login", "reprompt": "1", "favorite": "1"},
 		}
 		if !reflect.DeepEqual(item2, expectedItem2) {
@@ -53,7 +53,7 @@ func TestParseBitwardenCSV(t *testing.T) {
 		}
 		item5 := items[4]
 		expectedItem5 := models.ImportedLoginItem{
-			SourceName: "Bitwarden", ItemName: "Name, with comma", Username: "comma,user", Password: "comma,pass", URL: "https://comma.com", Notes: `Note with "quotes"`, Folder: "Folder, with comma", TOTP: "",
+			SourceName: "Bitwarden", ItemName: "Name, with comma", Username: "comma,user", Password: "comma,pass", URL: "https://comma.com", URLs: []models.ImportedURL{{URL: "https://comma.com"}}, Notes: `Note with "quotes"`, Folder: "Folder, with comma", TOTP: "",
 			CustomFields: map[string]string{"type": "login", "reprompt": "0", "favorite": "0"},
 		}
 		if !reflect.DeepEqual(item5, expectedItem5) {
@@ -61,6 +61,19 @@ func TestParseBitwardenCSV(t *testing.T) {
 		}
 	})
 
+	t.Run("Multiple URIs", func(t *testing.T) {
+		multiURICsv := "name,login_uri,login_username\n" +
+			`Multi,"https://a.example.com, androidapp://com.example.app,,https://b.example.net/login",multi_user` + "\n"
+		items, err := ParseBitwardenCSV(strings.NewReader(multiURICsv), false)
+		if err != nil {
+			t.Fatalf("ParseBitwardenCSV failed: %v", err)
+		}
+		expectedURLs := []models.ImportedURL{{URL: "https://a.example.com"}, {URL: "androidapp://com.example.app"}, {URL: "https://b.example.net/login"}}
+		if len(items) != 1 || items[0].URL != "https://a.example.com" || !reflect.DeepEqual(items[0].URLs, expectedURLs) {
+			t.Errorf("Multiple URIs mismatch: %+v", items)
+		}
+	})
+
 	t.Run("Parsing without Passwords", func(t *testing.T) {
 		reader := strings.NewReader(csvData)
 		items, err := ParseBitwardenCSV(reader, false)
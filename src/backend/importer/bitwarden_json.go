@@ -0,0 +1,145 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"email_server/models"
+	"email_server/urlmatch"
+)
+
+// bitwardenItemTypeLogin Bitwarden 条目类型：1 为登录信息
+const bitwardenItemTypeLogin = 1
+
+// bitwardenExport Bitwarden 未加密 JSON 导出文件的结构（只包含需要的字段）
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []struct {
+		Type     int     `json:"type"`
+		Name     string  `json:"name"`
+		Notes    *string `json:"notes"`
+		FolderID *string `json:"folderId"`
+		Favorite bool    `json:"favorite"`
+		Reprompt int     `json:"reprompt"`
+		Fields   []struct {
+			Name  string  `json:"name"`
+			Value *string `json:"value"`
+		} `json:"fields"`
+		Login *struct {
+			URIs []struct {
+				Match *int   `json:"match"`
+				URI   string `json:"uri"`
+			} `json:"uris"`
+			Username *string `json:"username"`
+			Password *string `json:"password"`
+			TOTP     *string `json:"totp"`
+		} `json:"login"`
+	} `json:"items"`
+}
+
+// bitwardenURIMatch 将 Bitwarden 的 URI 匹配检测方式转换为平台网址的匹配规则，返回 false 表示不导入该网址。
+// 0 基础域名、1 主机、2 开始于、3 完全一致、4 正则表达式、5 从不；为空时使用默认（基础域名）
+func bitwardenURIMatch(match *int, uri string) (models.ImportedURL, bool) {
+	if match == nil {
+		return models.ImportedURL{URL: uri, MatchMode: urlmatch.ModeBaseDomain}, true
+	}
+	switch *match {
+	case 0:
+		return models.ImportedURL{URL: uri, MatchMode: urlmatch.ModeBaseDomain}, true
+	case 1:
+		return models.ImportedURL{URL: uri, MatchMode: urlmatch.ModeHost}, true
+	case 2:
+		return models.ImportedURL{URL: uri, MatchMode: urlmatch.ModeStartsWith}, true
+	case 3:
+		return models.ImportedURL{URL: "^" + regexp.QuoteMeta(uri) + "$", MatchMode: urlmatch.ModeRegex}, true
+	case 4:
+		return models.ImportedURL{URL: uri, MatchMode: urlmatch.ModeRegex}, true
+	default:
+		return models.ImportedURL{}, false
+	}
+}
+
+// ParseBitwardenJSON 解析 Bitwarden 导出的未加密 JSON 数据。
+// 与 CSV 不同，JSON 导出包含每个网址的匹配检测方式，导入时转换为平台网址的匹配规则。
+// 只导入登录类型的条目；importPasswords 为 false 时不导入密码。
+func ParseBitwardenJSON(reader io.Reader, importPasswords bool) ([]models.ImportedLoginItem, error) {
+	var export bitwardenExport
+	if err := json.NewDecoder(reader).Decode(&export); err != nil {
+		return nil, fmt.Errorf("读取 JSON 数据时出错: %w", err)
+	}
+	if export.Encrypted {
+		return nil, fmt.Errorf("不支持加密的 Bitwarden 导出文件，请导出为未加密的 JSON")
+	}
+
+	folders := make(map[string]string, len(export.Folders))
+	for _, folder := range export.Folders {
+		folders[folder.ID] = folder.Name
+	}
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+
+	importedItems := []models.ImportedLoginItem{}
+	for _, raw := range export.Items {
+		if raw.Type != bitwardenItemTypeLogin || raw.Login == nil {
+			continue
+		}
+		item := models.ImportedLoginItem{
+			SourceName:   "Bitwarden",
+			ItemName:     raw.Name,
+			Username:     deref(raw.Login.Username),
+			Notes:        deref(raw.Notes),
+			TOTP:         deref(raw.Login.TOTP),
+			Folder:       folders[deref(raw.FolderID)],
+			CustomFields: make(map[string]string),
+		}
+		if importPasswords {
+			item.Password = deref(raw.Login.Password)
+		}
+
+		for _, uri := range raw.Login.URIs {
+			value := strings.TrimSpace(uri.URI)
+			if value == "" {
+				continue
+			}
+			imported, ok := bitwardenURIMatch(uri.Match, value)
+			if !ok {
+				continue
+			}
+			item.URLs = append(item.URLs, imported)
+			if item.URL == "" {
+				item.URL = value
+			}
+		}
+
+		// 与 CSV 导入保持一致，favorite、reprompt 和自定义字段存入 CustomFields
+		item.CustomFields["favorite"] = "0"
+		if raw.Favorite {
+			item.CustomFields["favorite"] = "1"
+		}
+		item.CustomFields["reprompt"] = strconv.Itoa(raw.Reprompt)
+		for _, field := range raw.Fields {
+			if _, exists := item.CustomFields[strings.ToLower(field.Name)]; exists {
+				item.CustomFields["field_"+field.Name] = deref(field.Value)
+				continue
+			}
+			item.CustomFields[field.Name] = deref(field.Value)
+		}
+
+		if item.ItemName != "" || item.Username != "" {
+			importedItems = append(importedItems, item)
+		}
+	}
+	return importedItems, nil
+}
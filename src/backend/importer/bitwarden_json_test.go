@@ -0,0 +1,74 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"email_server/models"
+)
+
+func TestParseBitwardenJSON(t *testing.T) {
+	jsonData := `{
+  "encrypted": false,
+  "folders": [{"id": "f1", "name": "Work"}],
+  "items": [
+    {
+      "type": 1, "name": "Example", "notes": "notes", "folderId": "f1", "favorite": true, "reprompt": 0,
+      "fields": [{"name": "pin", "value": "1234", "type": 1}],
+      "login": {
+        "uris": [
+          {"match": null, "uri": "https://example.com/login"},
+          {"match": 1, "uri": "https://sso.example.net"},
+          {"match": 2, "uri": "https://tools.example.org/app/"},
+          {"match": 3, "uri": "https://exact.example.io/a?b=1"},
+          {"match": 4, "uri": "^https://.*\\.example\\.dev/"},
+          {"match": 5, "uri": "https://never.example.com"},
+          {"match": 0, "uri": " "}
+        ],
+        "username": "alice", "password": "secret", "totp": "JBSWY3DPEHPK3PXP"
+      }
+    },
+    {"type": 2, "name": "Secure note", "secureNote": {"type": 0}},
+    {"type": 1, "name": "No URIs", "folderId": null, "login": {"uris": null, "username": "bob", "password": null, "totp": null}}
+  ]
+}`
+
+	items, err := ParseBitwardenJSON(strings.NewReader(jsonData), true)
+	if err != nil {
+		t.Fatalf("ParseBitwardenJSON failed: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 login items, got %d", len(items))
+	}
+	expected := models.ImportedLoginItem{
+		SourceName: "Bitwarden", ItemName: "Example", Username: "alice", Password: "secret", URL: "https://example.com/login",
+		URLs: []models.ImportedURL{
+			{URL: "https://example.com/login", MatchMode: "base_domain"},
+			{URL: "https://sso.example.net", MatchMode: "host"},
+			{URL: "https://tools.example.org/app/", MatchMode: "starts_with"},
+			{URL: `^https://exact\.example\.io/a\?b=1$`, MatchMode: "regex"},
+			{URL: `^https://.*\.example\.dev/`, MatchMode: "regex"},
+		},
+		Notes: "notes", Folder: "Work", TOTP: "JBSWY3DPEHPK3PXP",
+		CustomFields: map[string]string{"favorite": "1", "reprompt": "0", "pin": "1234"},
+	}
+	if !reflect.DeepEqual(items[0], expected) {
+		t.Errorf("Item mismatch:\nExpected: %+v\nGot:      %+v", expected, items[0])
+	}
+	if items[1].ItemName != "No URIs" || items[1].URL != "" || items[1].URLs != nil || items[1].Folder != "" {
+		t.Errorf("Unexpected item without URIs: %+v", items[1])
+	}
+
+	items, err = ParseBitwardenJSON(strings.NewReader(jsonData), false)
+	if err != nil || items[0].Password != "" {
+		t.Errorf("Expected empty password when importPasswords=false, got %q (err %v)", items[0].Password, err)
+	}
+
+	if _, err := ParseBitwardenJSON(strings.NewReader(`{"encrypted": true, "items": []}`), true); err == nil {
+		t.Error("Expected error for encrypted export")
+	}
+	if _, err := ParseBitwardenJSON(strings.NewReader(`name,login_uri`), true); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+}
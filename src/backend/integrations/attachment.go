@@ -0,0 +1,102 @@
+// 邮件附件下载
+package integrations
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+)
+
+var (
+	// ErrAttachmentNotFound 邮件中没有该附件
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	// ErrAttachmentTooLarge 附件超过下载大小上限
+	ErrAttachmentTooLarge = errors.New("attachment too large")
+)
+
+// AttachmentContent 附件内容，调用方读取完毕后必须关闭 Body
+type AttachmentContent struct {
+	Filename string
+	MimeType string
+	// Size 附件大小（字节），未知时为 0
+	Size int64
+	Body io.ReadCloser
+}
+
+// attachmentPart 判断 MIME 分段是否作为附件返回：带文件名、声明为 attachment，或带 Content-ID 的非文本分段（内嵌图片）。
+// 正文的 text/plain 和 text/html 分段不是附件
+func attachmentPart(mediaType, filename, disposition, contentID string) (isAttachment, inline bool) {
+	disposition = strings.ToLower(disposition)
+	mediaType = strings.ToLower(mediaType)
+	if strings.HasPrefix(mediaType, "multipart/") {
+		return false, false
+	}
+	inline = contentID != "" && disposition != "attachment"
+	if filename != "" || disposition == "attachment" {
+		return true, inline
+	}
+	if contentID != "" && !strings.HasPrefix(mediaType, "text/") {
+		return true, inline
+	}
+	return false, false
+}
+
+// trimContentID 去掉 Content-ID 两侧的尖括号
+func trimContentID(id string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(id), "<"), ">")
+}
+
+// decodeMIMEWords 解码 RFC 2047 编码的文件名，解码失败时原样返回
+func decodeMIMEWords(s string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
+
+// transferDecoder 按 Content-Transfer-Encoding 以流的方式解码分段内容
+func transferDecoder(body io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &lineBreakFilter{r: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// lineBreakFilter 去掉 base64 内容中的换行和空白
+type lineBreakFilter struct {
+	r io.Reader
+}
+
+func (f *lineBreakFilter) Read(p []byte) (int, error) {
+	for {
+		n, err := f.r.Read(p)
+		kept := 0
+		for _, b := range p[:n] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// readCloser 组合读取器和关闭函数
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
@@ -2,13 +2,18 @@
 package integrations
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"email_server/models"
@@ -58,96 +63,125 @@ type GmailMessageRef struct {
 	ThreadID string `json:"threadId"`
 }
 
-// FetchEmailsWithGmailAPI 使用Gmail API获取邮件列表
-func FetchEmailsWithGmailAPI(emailAccount models.EmailAccount, page, pageSize int) ([]models.Email, int, error) {
-	return FetchEmailsWithGmailAPIFromFolder(emailAccount, page, pageSize, "INBOX")
+// FetchEmailsWithGmailAPI 使用Gmail API获取收件箱的一页邮件
+func FetchEmailsWithGmailAPI(emailAccount models.EmailAccount, pageToken string, pageSize int) ([]models.Email, int, string, error) {
+	return FetchEmailsWithGmailAPIFromFolder(emailAccount, pageToken, pageSize, "INBOX")
 }
 
-// FetchEmailsWithGmailAPIFromFolder 从指定标签/文件夹获取邮件
-func FetchEmailsWithGmailAPIFromFolder(emailAccount models.EmailAccount, page, pageSize int, labelName string) ([]models.Email, int, error) {
+// FetchEmailsWithGmailAPIFromFolder 从指定标签/文件夹获取一页邮件
+// Gmail API 使用 pageToken 翻页：pageToken 为空时返回第一页，返回值中的 nextPageToken 为空表示没有更多邮件
+func FetchEmailsWithGmailAPIFromFolder(emailAccount models.EmailAccount, pageToken string, pageSize int, labelName string) ([]models.Email, int, string, error) {
 	client, err := GetOAuth2HTTPClient(emailAccount.ID)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get oauth2 client: %w", err)
+		return nil, 0, "", fmt.Errorf("failed to get oauth2 client: %w", err)
 	}
 
-	// 构建Gmail API请求URL
-	// Gmail API使用pageToken而不是skip/offset
-	url := fmt.Sprintf("https://gmail.googleapis.com/gmail/v1/users/me/messages?labelIds=%s&maxResults=%d", labelName, pageSize)
-
-	// 如果不是第一页，需要处理分页token
-	// 这里简化处理，实际应用中需要存储和管理pageToken
-	if page > 1 {
-		// Gmail API的分页比较复杂，这里先简化实现
-		log.Printf("[FetchEmailsWithGmailAPIFromFolder] Gmail API pagination not fully implemented for page %d", page)
-	}
-
-	log.Printf("[FetchEmailsWithGmailAPIFromFolder] Requesting URL: %s", url)
-
-	req, err := http.NewRequest("GET", url, nil)
+	listResponse, err := listGmailMessages(client, labelName, "", pageToken, pageSize, "")
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, "", err
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to call gmail api: %w", err)
-	}
-	defer resp.Body.Close()
+	emails := fetchGmailMessages(client, listResponse.Messages)
 
-	if resp.StatusCode != http.StatusOK {
-		// 读取响应体以获取更详细的错误信息
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("[FetchEmailsWithGmailAPIFromFolder] Gmail API error response: %s", string(body))
-		return nil, 0, fmt.Errorf("gmail api returned non-200 status: %s, body: %s", resp.Status, string(body))
+	total := listResponse.ResultSizeEstimate
+	if total == 0 && len(emails) > 0 {
+		total = len(emails)
 	}
 
-	var listResponse GmailListResponse
-	if err := json.NewDecoder(resp.Body).Decode(&listResponse); err != nil {
-		return nil, 0, fmt.Errorf("failed to decode gmail api response: %w", err)
-	}
+	return emails, total, listResponse.NextPageToken, nil
+}
 
-	// 并发获取每个邮件的详细信息以提高性能
-	var emails []models.Email
-	emailChan := make(chan *models.Email, len(listResponse.Messages))
-	errorChan := make(chan error, len(listResponse.Messages))
+// fetchGmailMessages 并发获取列表中每封邮件的详细信息以提高性能，结果按列表顺序返回，获取失败的邮件被跳过
+func fetchGmailMessages(client *http.Client, refs []GmailMessageRef) []models.Email {
+	results := make([]*models.Email, len(refs))
+	var wg sync.WaitGroup
 
 	// 限制并发数量以避免API配额问题
 	maxConcurrent := 5
 	semaphore := make(chan struct{}, maxConcurrent)
 
-	for _, msgRef := range listResponse.Messages {
-		go func(messageID string) {
+	for i, msgRef := range refs {
+		wg.Add(1)
+		go func(i int, messageID string) {
+			defer wg.Done()
 			semaphore <- struct{}{}        // 获取信号量
 			defer func() { <-semaphore }() // 释放信号量
 
 			email, err := fetchGmailMessageDetail(client, messageID)
 			if err != nil {
+				// 记录错误但继续处理其他邮件
 				log.Printf("Failed to fetch message detail for %s: %v", messageID, err)
-				errorChan <- err
 				return
 			}
-			emailChan <- email
-		}(msgRef.ID)
+			results[i] = email
+		}(i, msgRef.ID)
 	}
+	wg.Wait()
 
-	// 收集结果
-	for i := 0; i < len(listResponse.Messages); i++ {
-		select {
-		case email := <-emailChan:
-			if email != nil {
-				emails = append(emails, *email)
-			}
-		case <-errorChan:
-			// 记录错误但继续处理其他邮件
+	var emails []models.Email
+	for _, email := range results {
+		if email != nil {
+			emails = append(emails, *email)
 		}
 	}
 
-	total := listResponse.ResultSizeEstimate
-	if total == 0 && len(emails) > 0 {
-		total = len(emails)
+	return emails
+}
+
+// NextGmailPageToken 只列出邮件ID，返回 pageToken 所在页的下一页标记，用于按页码跳转时快速定位
+func NextGmailPageToken(emailAccount models.EmailAccount, pageToken string, pageSize int, labelName string) (string, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	listResponse, err := listGmailMessages(client, labelName, "", pageToken, pageSize, "nextPageToken")
+	if err != nil {
+		return "", err
 	}
+	return listResponse.NextPageToken, nil
+}
+
+// listGmailMessages 调用 messages.list，search 为 Gmail 搜索语法，fields 不为空时只返回指定字段
+func listGmailMessages(client *http.Client, labelName, search, pageToken string, pageSize int, fields string) (*GmailListResponse, error) {
+	query := url.Values{}
+	query.Set("labelIds", labelName)
+	if search != "" {
+		query.Set("q", search)
+	}
+	query.Set("maxResults", strconv.Itoa(pageSize))
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+	if fields != "" {
+		query.Set("fields", fields)
+	}
+	requestURL := "https://gmail.googleapis.com/gmail/v1/users/me/messages?" + query.Encode()
+
+	log.Printf("[listGmailMessages] Requesting URL: %s", requestURL)
+
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call gmail api: %w", err)
+	}
+	defer resp.Body.Close()
 
-	return emails, total, nil
+	if resp.StatusCode != http.StatusOK {
+		// 读取响应体以获取更详细的错误信息
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("[listGmailMessages] Gmail API error response: %s", string(body))
+		return nil, fmt.Errorf("gmail api returned non-200 status: %s, body: %s", resp.Status, string(body))
+	}
+
+	var listResponse GmailListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&listResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode gmail api response: %w", err)
+	}
+	return &listResponse, nil
 }
 
 // fetchGmailMessageDetail 获取单个邮件的详细信息
@@ -182,6 +216,7 @@ func fetchGmailMessageDetail(client *http.Client, messageID string) (*models.Ema
 func convertGmailMessageToEmail(gmailMsg *GmailMessage) *models.Email {
 	email := &models.Email{
 		MessageID: gmailMsg.ID,
+		ThreadID:  gmailMsg.ThreadID,
 		Subject:   getHeaderValue(gmailMsg.Payload.Headers, "Subject"),
 	}
 
@@ -217,6 +252,7 @@ func convertGmailMessageToEmail(gmailMsg *GmailMessage) *models.Email {
 
 	// 检查是否有附件
 	email.HasAttachment = hasAttachments(&gmailMsg.Payload)
+	email.Attachments = gmailAttachments(&gmailMsg.Payload)
 
 	// 提取邮件正文
 	extractEmailBody(&gmailMsg.Payload, email)
@@ -292,6 +328,49 @@ func hasAttachments(part *GmailMessagePart) bool {
 	return false
 }
 
+// gmailAttachment 分段是附件时返回其信息，附件ID使用分段编号（partId），同一封邮件中保持不变
+func gmailAttachment(part *GmailMessagePart) (models.Attachment, bool) {
+	disposition, _, _ := mime.ParseMediaType(getHeaderValue(part.Headers, "Content-Disposition"))
+	contentID := trimContentID(getHeaderValue(part.Headers, "Content-ID"))
+	isAttachment, inline := attachmentPart(part.MimeType, part.Filename, disposition, contentID)
+	if !isAttachment || part.PartID == "" {
+		return models.Attachment{}, false
+	}
+	return models.Attachment{
+		ID:        part.PartID,
+		Filename:  part.Filename,
+		MimeType:  part.MimeType,
+		Size:      int64(part.Body.Size),
+		ContentID: contentID,
+		Inline:    inline,
+	}, true
+}
+
+// gmailAttachments 列出邮件中的附件和内嵌图片
+func gmailAttachments(part *GmailMessagePart) []models.Attachment {
+	var attachments []models.Attachment
+	if attachment, ok := gmailAttachment(part); ok {
+		attachments = append(attachments, attachment)
+	}
+	for i := range part.Parts {
+		attachments = append(attachments, gmailAttachments(&part.Parts[i])...)
+	}
+	return attachments
+}
+
+// findGmailPart 按分段编号查找分段
+func findGmailPart(part *GmailMessagePart, partID string) *GmailMessagePart {
+	if part.PartID == partID {
+		return part
+	}
+	for i := range part.Parts {
+		if found := findGmailPart(&part.Parts[i], partID); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
 // extractEmailBody 提取邮件正文
 func extractEmailBody(part *GmailMessagePart, email *models.Email) {
 	if part.MimeType == "text/plain" && part.Body.Data != "" {
@@ -337,42 +416,215 @@ func FetchGmailMessageDetail(emailAccount models.EmailAccount, messageID string)
 	return fetchGmailMessageDetail(client, messageID)
 }
 
-// MarkGmailAsRead 标记Gmail邮件为已读
-func MarkGmailAsRead(emailAccount models.EmailAccount, messageID string) error {
+// FetchGmailAttachment 下载Gmail邮件的附件，partID 为附件的分段编号
+func FetchGmailAttachment(emailAccount models.EmailAccount, messageID, partID string, maxBytes int64) (*AttachmentContent, error) {
 	client, err := GetOAuth2HTTPClient(emailAccount.ID)
 	if err != nil {
-		return fmt.Errorf("failed to get oauth2 client: %w", err)
+		return nil, fmt.Errorf("failed to get oauth2 client: %w", err)
 	}
 
-	// Gmail API修改邮件标签的请求体
-	requestBody := map[string]interface{}{
-		"removeLabelIds": []string{"UNREAD"},
+	var message GmailMessage
+	if err := getGmailJSON(client, "https://gmail.googleapis.com/gmail/v1/users/me/messages/"+url.PathEscape(messageID)+"?format=full", &message); err != nil {
+		return nil, err
+	}
+	part := findGmailPart(&message.Payload, partID)
+	if part == nil {
+		return nil, ErrAttachmentNotFound
+	}
+	attachment, ok := gmailAttachment(part)
+	if !ok {
+		return nil, ErrAttachmentNotFound
+	}
+	if maxBytes > 0 && attachment.Size > maxBytes {
+		return nil, ErrAttachmentTooLarge
 	}
 
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request body: %w", err)
+	// 较小的内嵌分段直接包含在邮件中，其余通过 attachments.get 获取
+	data := part.Body.Data
+	if part.Body.AttachmentID != "" {
+		var body GmailMessageBody
+		attachmentURL := "https://gmail.googleapis.com/gmail/v1/users/me/messages/" + url.PathEscape(messageID) + "/attachments/" + url.PathEscape(part.Body.AttachmentID)
+		if err := getGmailJSON(client, attachmentURL, &body); err != nil {
+			return nil, err
+		}
+		data = body.Data
 	}
+	decoded, err := decodeBase64URL(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode gmail attachment: %w", err)
+	}
+	return &AttachmentContent{
+		Filename: attachment.Filename,
+		MimeType: attachment.MimeType,
+		Size:     int64(len(decoded)),
+		Body:     io.NopCloser(bytes.NewReader(decoded)),
+	}, nil
+}
 
-	// 调用Gmail API修改邮件标签
-	url := fmt.Sprintf("https://gmail.googleapis.com/gmail/v1/users/me/messages/%s/modify", messageID)
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(jsonData)))
+// getGmailJSON 请求 Gmail API 并解析 JSON 响应，404 时返回 ErrAttachmentNotFound
+func getGmailJSON(client *http.Client, requestURL string, out interface{}) error {
+	resp, err := client.Get(requestURL)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to call gmail api: %w", err)
 	}
+	defer resp.Body.Close()
 
-	req.Header.Set("Content-Type", "application/json")
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrAttachmentNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return gmailStatusError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
 
+// gmailStatusError 将非成功响应转换为错误。令牌缺少所需授权范围时 Gmail 返回 403 insufficient scopes，转换为 ErrInsufficientScope
+func gmailStatusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusForbidden && strings.Contains(strings.ToLower(string(body)), "insufficient") {
+		return fmt.Errorf("%w: gmail api returned %s", ErrInsufficientScope, resp.Status)
+	}
+	return fmt.Errorf("gmail api returned non-200 status: %s", resp.Status)
+}
+
+// gmailFolderLabels 通用文件夹名称对应的 Gmail 系统标签。Gmail 没有归档文件夹，归档即移除 INBOX 标签
+var gmailFolderLabels = map[string]string{
+	folderInbox:  "INBOX",
+	folderTrash:  "TRASH",
+	folderSpam:   "SPAM",
+	folderSent:   "SENT",
+	folderDrafts: "DRAFT",
+}
+
+// gmailLabel 对应 users.labels.list 返回的标签
+type gmailLabel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// gmailLabelID 将用户标签的名称解析为标签 ID，batchModify 只接受 ID（系统标签的 ID 与名称相同，不需要解析）。
+// 传入的已经是标签 ID 时原样返回，名称优先精确匹配，其次不区分大小写匹配
+func gmailLabelID(client *http.Client, name string) (string, error) {
+	var list struct {
+		Labels []gmailLabel `json:"labels"`
+	}
+	if err := getGmailJSON(client, "https://gmail.googleapis.com/gmail/v1/users/me/labels", &list); err != nil {
+		return "", err
+	}
+	for _, label := range list.Labels {
+		if label.ID == name || label.Name == name {
+			return label.ID, nil
+		}
+	}
+	for _, label := range list.Labels {
+		if strings.EqualFold(label.Name, name) {
+			return label.ID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrFolderNotFound, name)
+}
+
+// gmailActionLabels 操作对应的标签变更。Gmail 中移动邮件即添加目标标签并移出收件箱，
+// 移动到用户标签时 target 须为已解析的标签 ID
+func gmailActionLabels(action, target string) (add, remove []string) {
+	switch action {
+	case models.MessageActionMarkRead:
+		return nil, []string{"UNREAD"}
+	case models.MessageActionMarkUnread:
+		return []string{"UNREAD"}, nil
+	case models.MessageActionFlag:
+		return []string{"STARRED"}, nil
+	case models.MessageActionUnflag:
+		return nil, []string{"STARRED"}
+	}
+	switch target {
+	case folderArchive:
+		return nil, []string{"INBOX"}
+	case folderSpam:
+		return []string{"SPAM"}, []string{"INBOX"}
+	case folderInbox:
+		return []string{"INBOX"}, []string{"SPAM", "TRASH"}
+	}
+	label := target
+	if system, ok := gmailFolderLabels[target]; ok {
+		label = system
+	}
+	return []string{label}, []string{"INBOX"}
+}
+
+// ApplyGmailMessageAction 对 Gmail 邮件执行操作：标签类操作使用 messages.batchModify，移到已删除使用 messages.trash，
+// 永久删除使用 messages.batchDelete（需要 https://mail.google.com/ 授权范围）。
+// batchModify 和 batchDelete 对整批邮件生效，失败时所有邮件记录相同的错误
+func ApplyGmailMessageAction(emailAccount models.EmailAccount, messageIDs []string, action, folder string) ([]models.MessageActionResult, error) {
+	target, err := MessageActionTargetFolder(action, folder)
+	if err != nil {
+		return nil, err
+	}
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	results := newMessageActionResults(messageIDs)
+
+	switch {
+	case target == folderTrash:
+		forEachMessage(len(messageIDs), func(i int) {
+			requestURL := "https://gmail.googleapis.com/gmail/v1/users/me/messages/" + url.PathEscape(messageIDs[i]) + "/trash"
+			setMessageActionError(results, i, postGmailJSON(client, requestURL, nil))
+		})
+	case action == models.MessageActionDelete:
+		err := postGmailJSON(client, "https://gmail.googleapis.com/gmail/v1/users/me/messages/batchDelete", map[string]interface{}{
+			"ids": messageIDs,
+		})
+		for i := range results {
+			setMessageActionError(results, i, err)
+		}
+	default:
+		if _, system := gmailFolderLabels[target]; action == models.MessageActionMove && !system && target != folderArchive {
+			if target, err = gmailLabelID(client, target); err != nil {
+				return nil, err
+			}
+		}
+		add, remove := gmailActionLabels(action, target)
+		err := postGmailJSON(client, "https://gmail.googleapis.com/gmail/v1/users/me/messages/batchModify", map[string]interface{}{
+			"ids":            messageIDs,
+			"addLabelIds":    add,
+			"removeLabelIds": remove,
+		})
+		for i := range results {
+			setMessageActionError(results, i, err)
+		}
+	}
+	return results, nil
+}
+
+// postGmailJSON 发送 POST 请求，body 为 nil 时不带请求体
+func postGmailJSON(client *http.Client, requestURL string, body interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(http.MethodPost, requestURL, payload)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to call gmail api: %w", err)
 	}
 	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("gmail api returned non-200 status: %s", resp.Status)
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrMessageNotFound
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return gmailStatusError(resp)
 	}
-
-	log.Printf("[MarkGmailAsRead] Successfully marked message %s as read", messageID)
 	return nil
 }
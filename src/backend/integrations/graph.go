@@ -2,11 +2,15 @@
 package integrations
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,6 +30,8 @@ type GraphAPIMessage struct {
 	ToRecipients     []GraphAPIAddress `json:"toRecipients"`
 	IsRead           bool              `json:"isRead"`
 	HasAttachments   bool              `json:"hasAttachments"`
+	ConversationID   string            `json:"conversationId"`
+	BodyPreview      string            `json:"bodyPreview"` // 仅在 $select 包含时返回
 }
 
 type GraphAPIAddress struct {
@@ -62,7 +68,7 @@ func GetOAuth2HTTPClient(accountID uint) (*http.Client, error) {
 	conf := &oauth2.Config{
 		ClientID:     provider.ClientID,
 		ClientSecret: string(decryptedSecret),
-		Scopes:       strings.Split(provider.Scopes, ","),
+		Scopes:       provider.ScopeList(),
 		Endpoint: oauth2.Endpoint{
 			AuthURL:  provider.AuthURL,
 			TokenURL: provider.TokenURL,
@@ -85,51 +91,53 @@ func GetOAuth2HTTPClient(accountID uint) (*http.Client, error) {
 		Expiry:       oauthToken.Expiry,
 	}
 
-	// 返回一个会自动刷新token的http.Client
-	return conf.Client(context.Background(), token), nil
+	// 返回一个会自动刷新token的http.Client，刷新结果写回数据库
+	ctx := context.Background()
+	source := &persistingTokenSource{
+		base:        oauth2.ReuseTokenSource(token, conf.TokenSource(ctx, token)),
+		token:       &oauthToken,
+		accessToken: token.AccessToken,
+	}
+	return oauth2.NewClient(ctx, source), nil
 }
 
+// graphMessageListFields 邮件列表请求的 $select 字段
+const graphMessageListFields = "id,receivedDateTime,subject,from,toRecipients,isRead,hasAttachments,conversationId"
+
+// graphAPIBaseURL Graph API 的地址；@odata.nextLink 只接受此前缀，避免把访问令牌发送到其他主机
+const graphAPIBaseURL = "https://graph.microsoft.com/"
+
 // FetchEmailsWithGraphAPI 是新的邮件获取实现
-func FetchEmailsWithGraphAPI(emailAccount models.EmailAccount, page, pageSize int) ([]models.Email, int, error) {
-	return FetchEmailsWithGraphAPIFromFolder(emailAccount, page, pageSize, "inbox")
+func FetchEmailsWithGraphAPI(emailAccount models.EmailAccount, nextLink string, pageSize int) ([]models.Email, int, string, error) {
+	return FetchEmailsWithGraphAPIFromFolder(emailAccount, nextLink, pageSize, "inbox")
 }
 
-// FetchEmailsWithGraphAPIFromFolder 从指定文件夹获取邮件
-func FetchEmailsWithGraphAPIFromFolder(emailAccount models.EmailAccount, page, pageSize int, folderName string) ([]models.Email, int, error) {
+// FetchEmailsWithGraphAPIFromFolder 从指定文件夹获取一页邮件
+// nextLink 为空时返回第一页，否则请求上一页响应中的 @odata.nextLink；返回值中的 nextLink 为空表示没有更多邮件
+func FetchEmailsWithGraphAPIFromFolder(emailAccount models.EmailAccount, nextLink string, pageSize int, folderName string) ([]models.Email, int, string, error) {
 	client, err := GetOAuth2HTTPClient(emailAccount.ID)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get oauth2 client: %w", err)
+		return nil, 0, "", fmt.Errorf("failed to get oauth2 client: %w", err)
 	}
 
-	// 构建Graph API请求URL，支持不同的文件夹，包含isRead字段
-	skip := (page - 1) * pageSize
-	url := fmt.Sprintf("https://graph.microsoft.com/v1.0/me/mailFolders/%s/messages?$top=%d&$skip=%d&$orderby=receivedDateTime desc&$count=true&$select=id,receivedDateTime,subject,from,toRecipients,isRead,hasAttachments", folderName, pageSize, skip)
-
-	log.Printf("[FetchEmailsWithGraphAPIFromFolder] Requesting URL: %s", url)
-
-	req, err := http.NewRequest("GET", url, nil)
+	graphResponse, err := listGraphMessages(client, nextLink, pageSize, folderName)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, "", err
 	}
-	// Graph API 要求返回总数时，加上这个Header
-	req.Header.Add("ConsistencyLevel", "eventual")
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to call graph api: %w", err)
-	}
-	defer resp.Body.Close()
+	emails := graphMessagesToEmails(graphResponse)
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, 0, fmt.Errorf("graph api returned non-200 status: %s", resp.Status)
+	total := graphResponse.Count
+	// 如果API没有返回总数，但返回了邮件，我们至少可以用当前获取的数量，以避免前端出问题
+	if total == 0 && len(emails) > 0 {
+		total = len(emails)
 	}
 
-	var graphResponse GraphAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&graphResponse); err != nil {
-		return nil, 0, fmt.Errorf("failed to decode graph api response: %w", err)
-	}
+	return emails, total, graphResponse.NextLink, nil
+}
 
-	// 将Graph API的返回结果转换为我们自己的models.Email格式
+// graphMessagesToEmails 将Graph API的返回结果转换为我们自己的models.Email格式
+func graphMessagesToEmails(graphResponse *GraphAPIResponse) []models.Email {
 	var emails []models.Email
 	for _, msg := range graphResponse.Value {
 		var from []models.EmailAddress
@@ -156,19 +164,74 @@ func FetchEmailsWithGraphAPIFromFolder(emailAccount models.EmailAccount, page, p
 			To:            to,
 			IsRead:        msg.IsRead,
 			HasAttachment: msg.HasAttachments,
+			ThreadID:      msg.ConversationID,
+			Snippet:       msg.BodyPreview,
 		})
 
 		// 调试日志：输出已读状态
 		log.Printf("[Graph] Message %s IsRead: %v", msg.ID, msg.IsRead)
 	}
 
-	total := graphResponse.Count
-	// 如果API没有返回总数，但返回了邮件，我们至少可以用当前获取的数量，以避免前端出问题
-	if total == 0 && len(emails) > 0 {
-		total = len(emails)
+	return emails
+}
+
+// NextGraphLink 返回 nextLink 所在页的下一页链接，用于按页码跳转时逐页定位
+func NextGraphLink(emailAccount models.EmailAccount, nextLink string, pageSize int, folderName string) (string, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	graphResponse, err := listGraphMessages(client, nextLink, pageSize, folderName)
+	if err != nil {
+		return "", err
 	}
+	return graphResponse.NextLink, nil
+}
 
-	return emails, total, nil
+// listGraphMessages 请求文件夹的邮件列表：第一页按参数构建地址，之后的页直接使用 @odata.nextLink
+// nextLink 会保留首次请求的 $select 等参数，因此定位页码时也使用同样的字段，保证缓存的链接可以直接用于获取邮件
+func listGraphMessages(client *http.Client, nextLink string, pageSize int, folderName string) (*GraphAPIResponse, error) {
+	requestURL := nextLink
+	if requestURL == "" {
+		query := url.Values{}
+		query.Set("$top", strconv.Itoa(pageSize))
+		query.Set("$orderby", "receivedDateTime desc")
+		query.Set("$count", "true")
+		query.Set("$select", graphMessageListFields)
+		requestURL = graphAPIBaseURL + "v1.0/me/mailFolders/" + url.PathEscape(folderName) + "/messages?" + query.Encode()
+	} else if !strings.HasPrefix(requestURL, graphAPIBaseURL) {
+		return nil, fmt.Errorf("graph api next link has unexpected host: %s", requestURL)
+	}
+
+	return getGraphMessages(client, requestURL)
+}
+
+// getGraphMessages 请求邮件列表地址并解析响应
+func getGraphMessages(client *http.Client, requestURL string) (*GraphAPIResponse, error) {
+	log.Printf("[getGraphMessages] Requesting URL: %s", requestURL)
+
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Graph API 要求返回总数时，加上这个Header
+	req.Header.Add("ConsistencyLevel", "eventual")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call graph api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("graph api returned non-200 status: %s", resp.Status)
+	}
+
+	var graphResponse GraphAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&graphResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode graph api response: %w", err)
+	}
+	return &graphResponse, nil
 }
 
 // FetchEmailDetailWithGraphAPI fetches detailed information for a single email by messageId
@@ -229,12 +292,7 @@ func FetchEmailDetailWithGraphAPI(emailAccount models.EmailAccount, messageId st
 			Content     string `json:"content"`
 		} `json:"body"`
 		Attachments struct {
-			Value []struct {
-				Name        string `json:"name"`
-				ContentType string `json:"contentType"`
-				Size        int64  `json:"size"`
-				ContentId   string `json:"contentId"`
-			} `json:"value"`
+			Value []graphAttachment `json:"value"`
 		} `json:"attachments"`
 	}
 
@@ -286,53 +344,214 @@ func FetchEmailDetailWithGraphAPI(emailAccount models.EmailAccount, messageId st
 
 	// Convert attachments
 	for _, att := range graphMessage.Attachments.Value {
-		email.Attachments = append(email.Attachments, models.Attachment{
-			Filename:  att.Name,
-			MimeType:  att.ContentType,
-			Size:      att.Size,
-			ContentID: att.ContentId,
-		})
+		email.Attachments = append(email.Attachments, att.toAttachment())
+	}
+	// attachments 是导航属性，响应中没有附件列表时单独获取
+	if graphMessage.HasAttachments && len(email.Attachments) == 0 {
+		attachments, err := listGraphAttachments(client, graphMessage.ID)
+		if err != nil {
+			log.Printf("[FetchEmailDetailWithGraphAPI] Failed to list attachments of %s: %v", graphMessage.ID, err)
+		}
+		email.Attachments = attachments
 	}
 
 	return email, nil
 }
 
-// MarkMicrosoftEmailAsRead 标记Microsoft邮件为已读
-func MarkMicrosoftEmailAsRead(emailAccount models.EmailAccount, messageID string) error {
-	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+// graphAttachment 对应 Graph API 返回的附件信息
+type graphAttachment struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	ContentId   string `json:"contentId"`
+	IsInline    bool   `json:"isInline"`
+}
+
+func (att graphAttachment) toAttachment() models.Attachment {
+	return models.Attachment{
+		ID:        att.ID,
+		Filename:  att.Name,
+		MimeType:  att.ContentType,
+		Size:      att.Size,
+		ContentID: trimContentID(att.ContentId),
+		Inline:    att.IsInline,
+	}
+}
+
+// graphInlineContentIDLimit 获取内嵌附件 Content-ID 时的大小上限，单个附件请求会同时返回附件内容
+const graphInlineContentIDLimit = 5 << 20
+
+// listGraphAttachments 获取邮件的附件列表。contentId 只属于 fileAttachment 类型，
+// 列表只选择基础字段，内嵌附件再单独获取以得到 Content-ID
+func listGraphAttachments(client *http.Client, messageID string) ([]models.Attachment, error) {
+	attachmentsURL := graphAPIBaseURL + "v1.0/me/messages/" + url.PathEscape(messageID) + "/attachments"
+	resp, err := client.Get(attachmentsURL + "?$select=id,name,contentType,size,isInline")
 	if err != nil {
-		return fmt.Errorf("failed to get oauth2 client: %w", err)
+		return nil, fmt.Errorf("failed to call graph api: %w", err)
+	}
+	var list struct {
+		Value []graphAttachment `json:"value"`
+	}
+	if err := decodeGraphResponse(resp, &list); err != nil {
+		return nil, err
 	}
 
-	// Microsoft Graph API修改邮件的请求体
-	requestBody := map[string]interface{}{
-		"isRead": true,
+	var attachments []models.Attachment
+	for _, att := range list.Value {
+		if att.IsInline && att.Size <= graphInlineContentIDLimit {
+			resp, err := client.Get(attachmentsURL + "/" + url.PathEscape(att.ID))
+			if err == nil {
+				var full graphAttachment
+				if decodeGraphResponse(resp, &full) == nil {
+					att.ContentId = full.ContentId
+				}
+			}
+		}
+		attachments = append(attachments, att.toAttachment())
 	}
+	return attachments, nil
+}
 
-	jsonData, err := json.Marshal(requestBody)
+// FetchGraphAttachment 下载Microsoft邮件的附件，内容以流的方式返回
+func FetchGraphAttachment(emailAccount models.EmailAccount, messageID, attachmentID string, maxBytes int64) (*AttachmentContent, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request body: %w", err)
+		return nil, fmt.Errorf("failed to get oauth2 client: %w", err)
 	}
+	attachmentURL := graphAPIBaseURL + "v1.0/me/messages/" + url.PathEscape(messageID) + "/attachments/" + url.PathEscape(attachmentID)
 
-	// 调用Microsoft Graph API修改邮件
-	url := fmt.Sprintf("https://graph.microsoft.com/v1.0/me/messages/%s", messageID)
-	req, err := http.NewRequest("PATCH", url, strings.NewReader(string(jsonData)))
+	// 先获取附件信息检查大小，避免下载超出上限的附件
+	resp, err := client.Get(attachmentURL + "?$select=id,name,contentType,size,isInline")
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to call graph api: %w", err)
+	}
+	var att graphAttachment
+	err = decodeGraphResponse(resp, &att)
+	if err != nil {
+		return nil, err
+	}
+	if maxBytes > 0 && att.Size > maxBytes {
+		return nil, ErrAttachmentTooLarge
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
+	resp, err = client.Get(attachmentURL + "/$value")
 	if err != nil {
-		return fmt.Errorf("failed to call graph api: %w", err)
+		return nil, fmt.Errorf("failed to call graph api: %w", err)
 	}
-	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeGraphResponse(resp, nil)
+	}
+	return &AttachmentContent{
+		Filename: att.Name,
+		MimeType: att.ContentType,
+		Size:     att.Size,
+		Body:     resp.Body,
+	}, nil
+}
 
+// decodeGraphResponse 解析 Graph API 的 JSON 响应并关闭响应体，404 时返回 ErrAttachmentNotFound
+func decodeGraphResponse(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrAttachmentNotFound
+	}
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("graph api returned non-200 status: %s", resp.Status)
 	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// graphWellKnownFolders 通用文件夹名称对应的 Graph 邮件文件夹 well-known name
+var graphWellKnownFolders = map[string]string{
+	folderInbox:   "inbox",
+	folderArchive: "archive",
+	folderTrash:   "deleteditems",
+	folderSpam:    "junkemail",
+	folderSent:    "sentitems",
+	folderDrafts:  "drafts",
+}
+
+// ApplyGraphMessageAction 对 Microsoft 邮件执行操作：已读和星标使用 PATCH，移动使用 /move（移动后邮件ID会变化），
+// 永久删除使用 /permanentDelete。Graph 没有批量修改接口，逐封并发调用
+func ApplyGraphMessageAction(emailAccount models.EmailAccount, messageIDs []string, action, folder string) ([]models.MessageActionResult, error) {
+	target, err := MessageActionTargetFolder(action, folder)
+	if err != nil {
+		return nil, err
+	}
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	if wellKnown, ok := graphWellKnownFolders[target]; ok {
+		target = wellKnown
+	}
+
+	results := newMessageActionResults(messageIDs)
+	forEachMessage(len(messageIDs), func(i int) {
+		messageURL := graphAPIBaseURL + "v1.0/me/messages/" + url.PathEscape(messageIDs[i])
+		switch action {
+		case models.MessageActionMarkRead, models.MessageActionMarkUnread:
+			setMessageActionError(results, i, sendGraphJSON(client, http.MethodPatch, messageURL, map[string]interface{}{
+				"isRead": action == models.MessageActionMarkRead,
+			}, nil))
+		case models.MessageActionFlag, models.MessageActionUnflag:
+			status := "notFlagged"
+			if action == models.MessageActionFlag {
+				status = "flagged"
+			}
+			setMessageActionError(results, i, sendGraphJSON(client, http.MethodPatch, messageURL, map[string]interface{}{
+				"flag": map[string]string{"flagStatus": status},
+			}, nil))
+		case models.MessageActionDelete:
+			setMessageActionError(results, i, sendGraphJSON(client, http.MethodPost, messageURL+"/permanentDelete", nil, nil))
+		default:
+			var moved struct {
+				ID string `json:"id"`
+			}
+			err := sendGraphJSON(client, http.MethodPost, messageURL+"/move", map[string]string{"destinationId": target}, &moved)
+			setMessageActionError(results, i, err)
+			if err == nil && moved.ID != messageIDs[i] {
+				results[i].NewMessageID = moved.ID
+			}
+		}
+	})
+	return results, nil
+}
 
-	log.Printf("[MarkMicrosoftEmailAsRead] Successfully marked message %s as read", messageID)
-	return nil
+// sendGraphJSON 发送 JSON 请求，out 不为 nil 时解析响应
+func sendGraphJSON(client *http.Client, method, requestURL string, body, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, requestURL, payload)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call graph api: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrMessageNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("graph api returned non-2xx status: %s", resp.Status)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
 }
@@ -0,0 +1,223 @@
+package integrations
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+
+	"email_server/imapid"
+	"email_server/models"
+)
+
+// imapFolderNames 服务器不支持 SPECIAL-USE 时按常见名称查找归档、已删除和垃圾邮件文件夹
+var imapFolderNames = map[imap.MailboxAttr][]string{
+	imap.MailboxAttrArchive: {"Archive", "Archives", "[Gmail]/All Mail", "INBOX.Archive", "归档"},
+	imap.MailboxAttrTrash:   {"Trash", "Deleted Items", "Deleted Messages", "[Gmail]/Trash", "INBOX.Trash", "已删除", "已删除邮件"},
+	imap.MailboxAttrJunk:    {"Junk", "Spam", "Junk E-mail", "Junk Email", "[Gmail]/Spam", "INBOX.Junk", "INBOX.Spam", "垃圾邮件"},
+}
+
+// imapGenericFolderAttrs 通用文件夹名称对应的 SPECIAL-USE 属性
+var imapGenericFolderAttrs = map[string]imap.MailboxAttr{
+	folderArchive: imap.MailboxAttrArchive,
+	folderTrash:   imap.MailboxAttrTrash,
+	folderSpam:    imap.MailboxAttrJunk,
+	folderSent:    imap.MailboxAttrSent,
+	folderDrafts:  imap.MailboxAttrDrafts,
+}
+
+// imapFlagActions 通过 UID STORE 修改标记实现的操作
+var imapFlagActions = map[string]imap.StoreFlags{
+	models.MessageActionMarkRead:   {Op: imap.StoreFlagsAdd, Silent: true, Flags: []imap.Flag{imap.FlagSeen}},
+	models.MessageActionMarkUnread: {Op: imap.StoreFlagsDel, Silent: true, Flags: []imap.Flag{imap.FlagSeen}},
+	models.MessageActionFlag:       {Op: imap.StoreFlagsAdd, Silent: true, Flags: []imap.Flag{imap.FlagFlagged}},
+	models.MessageActionUnflag:     {Op: imap.StoreFlagsDel, Silent: true, Flags: []imap.Flag{imap.FlagFlagged}},
+}
+
+// resolveIMAPFolder 将通用文件夹名称解析为服务器上的文件夹：优先按 SPECIAL-USE 属性，其次按常见名称。
+// 不是通用名称时原样返回
+func resolveIMAPFolder(c *imapclient.Client, folder string) (string, error) {
+	if folder == folderInbox {
+		return "INBOX", nil
+	}
+	attr, ok := imapGenericFolderAttrs[folder]
+	if !ok {
+		return folder, nil
+	}
+	mailboxes, err := c.List("", "*", nil).Collect()
+	if err != nil {
+		return "", fmt.Errorf("LIST failed: %w", err)
+	}
+	for _, mailbox := range mailboxes {
+		for _, a := range mailbox.Attrs {
+			if strings.EqualFold(string(a), string(attr)) {
+				return mailbox.Mailbox, nil
+			}
+		}
+	}
+	for _, name := range imapFolderNames[attr] {
+		for _, mailbox := range mailboxes {
+			if strings.EqualFold(mailbox.Mailbox, name) {
+				return mailbox.Mailbox, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrFolderNotFound, folder)
+}
+
+// ApplyIMAPMessageAction 对 IMAP 邮件执行操作。邮件按所在文件夹分组，每个文件夹只 SELECT 一次：
+// 标记类操作使用 UID STORE，移动使用 UID MOVE（服务器不支持时为 COPY + STORE \Deleted + EXPUNGE），
+// 永久删除使用 STORE \Deleted + UID EXPUNGE。fallbacks 为各邮件缓存中的 Message-ID 头，用于 UIDVALIDITY 变化后重新定位。
+// 连接或查找目标文件夹失败时返回 error，单封邮件的失败记录在结果中
+func ApplyIMAPMessageAction(emailAccount models.EmailAccount, messageIDs []string, fallbacks map[string]string, action, folder string) ([]models.MessageActionResult, error) {
+	target, err := MessageActionTargetFolder(action, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := acquireIMAP(emailAccount)
+	if err != nil {
+		log.Printf("Failed to connect or login for %s: %v", emailAccount.EmailAddress, err)
+		return nil, err
+	}
+	defer session.Release()
+	c := session.Client
+
+	if target != "" {
+		if target, err = resolveIMAPFolder(c, target); err != nil {
+			return nil, err
+		}
+	}
+
+	// 按文件夹分组，保持文件夹首次出现的顺序
+	var folders []string
+	groups := map[string][]int{}
+	for i, id := range messageIDs {
+		name := "INBOX"
+		if ref, ok := imapid.Parse(id); ok {
+			name = ref.Folder
+		}
+		if _, seen := groups[name]; !seen {
+			folders = append(folders, name)
+		}
+		groups[name] = append(groups[name], i)
+	}
+
+	results := newMessageActionResults(messageIDs)
+	for _, name := range folders {
+		applyIMAPFolderAction(c, name, groups[name], messageIDs, fallbacks, action, target, results)
+	}
+	return results, nil
+}
+
+// applyIMAPFolderAction 对同一文件夹中的邮件执行操作
+func applyIMAPFolderAction(c *imapclient.Client, folder string, indexes []int, messageIDs []string, fallbacks map[string]string, action, target string, results []models.MessageActionResult) {
+	mailbox, err := c.Select(folder, nil).Wait()
+	if err != nil {
+		err = fmt.Errorf("failed to select %s: %w", folder, err)
+		for _, i := range indexes {
+			setMessageActionError(results, i, err)
+		}
+		return
+	}
+
+	// 确定每封邮件的 UID
+	var uids imap.UIDSet
+	byUID := map[imap.UID][]int{}
+	for _, i := range indexes {
+		uid, err := resolveIMAPUID(c, mailbox, messageIDs[i], fallbacks[messageIDs[i]])
+		if err != nil {
+			setMessageActionError(results, i, err)
+			continue
+		}
+		uids.AddNum(uid)
+		byUID[uid] = append(byUID[uid], i)
+	}
+	if len(byUID) == 0 {
+		return
+	}
+
+	fail := func(err error) {
+		for _, list := range byUID {
+			for _, i := range list {
+				setMessageActionError(results, i, err)
+			}
+		}
+	}
+
+	if flags, ok := imapFlagActions[action]; ok {
+		if err := c.Store(uids, &flags, nil).Close(); err != nil {
+			fail(fmt.Errorf("UID STORE failed: %w", err))
+		}
+		return
+	}
+
+	if action == models.MessageActionDelete {
+		deleted := imap.StoreFlags{Op: imap.StoreFlagsAdd, Silent: true, Flags: []imap.Flag{imap.FlagDeleted}}
+		if err := c.Store(uids, &deleted, nil).Close(); err != nil {
+			fail(fmt.Errorf("UID STORE failed: %w", err))
+			return
+		}
+		// 不支持 UIDPLUS 时只能 EXPUNGE 整个文件夹中带 \Deleted 标记的邮件
+		expunge := c.Expunge()
+		if c.Caps().Has(imap.CapUIDPlus) {
+			expunge = c.UIDExpunge(uids)
+		}
+		if err := expunge.Close(); err != nil {
+			fail(fmt.Errorf("EXPUNGE failed: %w", err))
+		}
+		return
+	}
+
+	// 已经在目标文件夹中的邮件无需移动
+	if strings.EqualFold(folder, target) {
+		return
+	}
+	data, err := c.Move(uids, target).Wait()
+	if err != nil {
+		fail(fmt.Errorf("failed to move messages to %s: %w", target, err))
+		return
+	}
+	// 服务器支持 UIDPLUS 时返回邮件在目标文件夹中的新 UID
+	source, srcOK := data.SourceUIDs.(imap.UIDSet)
+	dest, destOK := data.DestUIDs.(imap.UIDSet)
+	if !srcOK || !destOK || data.UIDValidity == 0 {
+		return
+	}
+	sourceNums, _ := source.Nums()
+	destNums, _ := dest.Nums()
+	if len(sourceNums) != len(destNums) {
+		return
+	}
+	for k, uid := range sourceNums {
+		newID := imapid.ID{Folder: target, UIDValidity: data.UIDValidity, UID: uint32(destNums[k])}.String()
+		for _, i := range byUID[uid] {
+			results[i].NewMessageID = newID
+		}
+	}
+}
+
+// resolveIMAPUID 确定当前选中文件夹中邮件的 UID，规则与 locateIMAPMessage 相同
+func resolveIMAPUID(c *imapclient.Client, mailbox *imap.SelectData, messageID, fallbackMessageID string) (imap.UID, error) {
+	headerMessageID := messageID
+	ref, isRef := imapid.Parse(messageID)
+	if isRef {
+		if ref.UIDValidity == 0 || ref.UIDValidity == mailbox.UIDValidity {
+			return imap.UID(ref.UID), nil
+		}
+		headerMessageID = fallbackMessageID
+	}
+	uid, err := searchUIDByMessageID(c, headerMessageID)
+	if err != nil {
+		return 0, err
+	}
+	if uid == 0 {
+		if isRef {
+			return 0, ErrIMAPUIDValidityChanged
+		}
+		return 0, ErrIMAPMessageNotFound
+	}
+	return uid, nil
+}
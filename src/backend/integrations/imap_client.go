@@ -3,6 +3,7 @@ package integrations
 import (
 	"context"
 	"email_server/database"
+	"email_server/imapid"
 	"email_server/models"
 	"email_server/utils"
 	"encoding/base64"
@@ -14,13 +15,13 @@ import (
 	"mime/multipart"
 	"mime/quotedprintable"
 	"net/mail"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/imapclient"
 	"golang.org/x/oauth2"
-	"gorm.io/gorm"
 )
 
 type xoauth2Client struct {
@@ -43,30 +44,20 @@ func (a *xoauth2Client) Next(challenge []byte) ([]byte, error) {
 }
 
 // connectAndLogin handles the connection and authentication logic.
-func connectAndLogin(emailAccount models.EmailAccount, token *models.UserOAuthToken) (*imapclient.Client, error) {
-	var imapServer, imapPort = emailAccount.IMAPServer, emailAccount.IMAPPort
-
-	// If it's an OAuth2 connection, we need to fetch the provider's IMAP details from the DB.
-	if token != nil {
-		var provider models.OAuthProvider
-		if err := database.DB.First(&provider, token.ProviderID).Error; err != nil {
-			return nil, fmt.Errorf("failed to find oauth provider with id %d for imap details: %w", token.ProviderID, err)
-		}
-		imapServer = provider.IMAPServer
-		imapPort = provider.IMAPPort
-	}
-
-	imapServerAddr := fmt.Sprintf("%s:%d", imapServer, imapPort)
+// commandTimeout 为执行命令时服务器无响应的最长时间（0 表示不限制），options 为 nil 时使用默认选项
+func connectAndLogin(emailAccount models.EmailAccount, endpoint imapEndpoint, commandTimeout time.Duration, options *imapclient.Options) (*imapConn, error) {
+	token := endpoint.token
 	authMethod := "Password"
 	if token != nil {
 		authMethod = "XOAUTH2"
 	}
-	log.Printf("Connecting to IMAP server: %s for user %s (Auth: %s)", imapServerAddr, emailAccount.EmailAddress, authMethod)
+	log.Printf("Connecting to IMAP server: %s for user %s (Auth: %s, Security: %s)", endpoint.addr(), emailAccount.EmailAddress, authMethod, endpoint.security)
 
-	c, err := imapclient.DialTLS(imapServerAddr, &imapclient.Options{})
+	conn, err := dialIMAP(endpoint, commandTimeout, options)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to IMAP server: %w", err)
 	}
+	c := conn.client
 
 	if token != nil {
 		// OAuth2 authentication
@@ -108,7 +99,7 @@ func connectAndLogin(emailAccount models.EmailAccount, token *models.UserOAuthTo
 			conf := &oauth2.Config{
 				ClientID:     provider.ClientID,
 				ClientSecret: string(decryptedSecret),
-				Scopes:       strings.Split(provider.Scopes, ","), // <-- 多了这一行
+				Scopes:       provider.ScopeList(),
 				Endpoint: oauth2.Endpoint{
 					AuthURL:  provider.AuthURL,
 					TokenURL: provider.TokenURL,
@@ -118,6 +109,7 @@ func connectAndLogin(emailAccount models.EmailAccount, token *models.UserOAuthTo
 			tokenSource := conf.TokenSource(context.Background(), oauth2Token)
 			newToken, err := tokenSource.Token()
 			if err != nil {
+				recordTokenFailure(token, err)
 				c.Close()
 				return nil, fmt.Errorf("failed to refresh token: %w", err)
 			}
@@ -147,15 +139,16 @@ func connectAndLogin(emailAccount models.EmailAccount, token *models.UserOAuthTo
 		}
 
 		log.Printf("Attempting XOAUTH2 login for %s", emailAccount.EmailAddress)
-		log.Printf("--- FULL ACCESS TOKEN FOR DEBUG ---\n%s\n---------------------------------", oauth2Token.AccessToken)
 		auth := &xoauth2Client{
 			user:  emailAccount.EmailAddress,
 			token: oauth2Token.AccessToken,
 		}
 		if err := c.Authenticate(auth); err != nil {
+			recordTokenFailure(token, err)
 			c.Close()
 			return nil, fmt.Errorf("XOAUTH2 login failed: %w", err)
 		}
+		recordTokenSuccess(token)
 		log.Printf("Successfully logged in with XOAUTH2 for %s", emailAccount.EmailAddress)
 	} else {
 		// Password (PLAIN) authentication
@@ -176,7 +169,7 @@ func connectAndLogin(emailAccount models.EmailAccount, token *models.UserOAuthTo
 		log.Printf("Successfully logged in with password for %s", emailAccount.EmailAddress)
 	}
 
-	return c, nil
+	return conn, nil
 }
 
 // parseEmailContent 解析邮件内容，支持MIME格式和编码解析
@@ -346,32 +339,41 @@ func decodeBody(body io.Reader, encoding string) (string, error) {
 	return string(content), nil
 }
 
-// FetchEmails connects to an IMAP server and fetches emails with pagination.
-func FetchEmails(emailAccount models.EmailAccount, page, pageSize int) ([]models.Email, int, error) {
-	var token models.UserOAuthToken
-	err := database.DB.Where("email_account_id = ?", emailAccount.ID).First(&token).Error
-
-	var c *imapclient.Client
-	if err == nil {
-		// Token found, use OAuth2
-		c, err = connectAndLogin(emailAccount, &token)
-	} else if errors.Is(err, gorm.ErrRecordNotFound) {
-		// No token found, use password
-		log.Printf("No OAuth token found for %s, falling back to password authentication.", emailAccount.EmailAddress)
-		c, err = connectAndLogin(emailAccount, nil)
-	} else {
-		// Database error
-		return nil, 0, fmt.Errorf("failed to query for oauth token: %w", err)
+var (
+	// ErrIMAPMessageNotFound 邮件不存在（已删除或已移动到其他文件夹）
+	ErrIMAPMessageNotFound = errors.New("message not found")
+	// ErrIMAPUIDValidityChanged 文件夹的 UIDVALIDITY 已变化，原邮件ID失效且无法按 Message-ID 重新定位
+	ErrIMAPUIDValidityChanged = errors.New("mailbox UIDVALIDITY changed, message id is stale")
+)
+
+// connectIMAPWithOptions 建立不经过连接池的 IMAP 连接，用于 IDLE 等长时间保持的连接，不限制命令的响应时间。
+// 根据邮箱账户是否关联 OAuth 令牌选择 XOAUTH2 或密码登录，可以指定客户端选项（如处理 IDLE 期间服务器推送的数据）
+func connectIMAPWithOptions(emailAccount models.EmailAccount, options *imapclient.Options) (*imapclient.Client, error) {
+	endpoint, err := resolveIMAPEndpoint(emailAccount)
+	if err != nil {
+		return nil, err
 	}
+	conn, err := connectAndLogin(emailAccount, endpoint, 0, options)
+	if err != nil {
+		return nil, err
+	}
+	return conn.client, nil
+}
 
+// FetchEmails connects to an IMAP server and fetches emails with pagination.
+// 返回的 MessageID 为编码了文件夹、UIDVALIDITY 和 UID 的不透明ID（见 imapid 包），用于查看邮件详情。
+func FetchEmails(emailAccount models.EmailAccount, page, pageSize int) ([]models.Email, int, error) {
+	session, err := acquireIMAP(emailAccount)
 	if err != nil {
 		log.Printf("Failed to connect or login for %s: %v", emailAccount.EmailAddress, err)
 		return nil, 0, err
 	}
-	defer c.Close()
+	defer session.Release()
+	c := session.Client
 
 	// Select INBOX
-	mailbox, err := c.Select("INBOX", nil).Wait()
+	const folder = "INBOX"
+	mailbox, err := c.Select(folder, nil).Wait()
 	if err != nil {
 		log.Printf("Failed to select INBOX for %s: %v", emailAccount.EmailAddress, err)
 		return nil, 0, fmt.Errorf("failed to select INBOX: %w", err)
@@ -403,6 +405,7 @@ func FetchEmails(emailAccount models.EmailAccount, page, pageSize int) ([]models
 	fetchOptions := &imap.FetchOptions{
 		Envelope: true,
 		Flags:    true,
+		UID:      true,
 		// Fetching body sections can be added here if needed
 	}
 
@@ -417,115 +420,109 @@ func FetchEmails(emailAccount models.EmailAccount, page, pageSize int) ([]models
 	// Reverse the order of messages to have the newest first
 	for i := len(messages) - 1; i >= 0; i-- {
 		msg := messages[i]
-		if msg == nil {
+		if msg == nil || msg.Envelope == nil {
 			log.Println("Received a nil message from fetch command")
 			continue
 		}
-
-		from := make([]models.EmailAddress, len(msg.Envelope.From))
-		for i, addr := range msg.Envelope.From {
-			from[i] = models.EmailAddress{Name: addr.Mailbox, Address: addr.Host}
-		}
-
-		to := make([]models.EmailAddress, len(msg.Envelope.To))
-		for i, addr := range msg.Envelope.To {
-			to[i] = models.EmailAddress{Name: addr.Mailbox, Address: addr.Host}
-		}
-
-		date := time.Time{}
-		if !msg.Envelope.Date.IsZero() {
-			date = msg.Envelope.Date
-		}
-
-		email := models.Email{
-			MessageID: msg.Envelope.MessageID,
-			Subject:   msg.Envelope.Subject,
-			From:      from,
-			To:        to,
-			Date:      date,
-		}
-		emails = append(emails, email)
+		emails = append(emails, imapEnvelopeEmail(folder, mailbox.UIDValidity, msg))
 	}
 
 	log.Printf("Successfully fetched %d emails for %s", len(emails), emailAccount.EmailAddress)
 	return emails, totalMessages, nil
 }
 
-// FetchEmailDetailWithIMAP fetches a single email's detailed information using IMAP
-// FetchEmailDetailWithIMAP fetches a single email's detailed information using IMAP
-func FetchEmailDetailWithIMAP(emailAccount models.EmailAccount, messageID string) (*models.Email, error) {
-	var token models.UserOAuthToken
-	err := database.DB.Where("email_account_id = ?", emailAccount.ID).First(&token).Error
-
-	var c *imapclient.Client
-	if err == nil {
-		c, err = connectAndLogin(emailAccount, &token)
-	} else if errors.Is(err, gorm.ErrRecordNotFound) {
-		log.Printf("No OAuth token found for %s, falling back to password authentication.", emailAccount.EmailAddress)
-		c, err = connectAndLogin(emailAccount, nil)
-	} else {
-		return nil, fmt.Errorf("failed to query for oauth token: %w", err)
+// imapEnvelopeEmail 根据 FETCH 返回的信封和标记构造列表中的邮件
+func imapEnvelopeEmail(folder string, uidValidity uint32, msg *imapclient.FetchMessageBuffer) models.Email {
+	from := make([]models.EmailAddress, len(msg.Envelope.From))
+	for i, addr := range msg.Envelope.From {
+		from[i] = models.EmailAddress{Name: addr.Mailbox, Address: addr.Host}
 	}
 
-	if err != nil {
-		log.Printf("Failed to connect or login for %s: %v", emailAccount.EmailAddress, err)
-		return nil, err
+	to := make([]models.EmailAddress, len(msg.Envelope.To))
+	for i, addr := range msg.Envelope.To {
+		to[i] = models.EmailAddress{Name: addr.Mailbox, Address: addr.Host}
 	}
-	defer c.Close()
 
-	_, err = c.Select("INBOX", nil).Wait()
-	if err != nil {
-		log.Printf("Failed to select INBOX for %s: %v", emailAccount.EmailAddress, err)
-		return nil, fmt.Errorf("failed to select INBOX: %w", err)
+	date := time.Time{}
+	if !msg.Envelope.Date.IsZero() {
+		date = msg.Envelope.Date
 	}
 
-	// --- NEW ROBUST STRATEGY: Scan-then-Fetch ---
-
-	// Step 1: Scan all message envelopes to find the sequence number.
-	log.Printf("IMAP SEARCH is unreliable on this server. Starting full envelope scan for Message-ID: %s", messageID)
-	var allMessagesSeqSet imap.SeqSet
-	allMessagesSeqSet.AddRange(1, 0) // 0 means the last message
-
-	scanFetchOptions := &imap.FetchOptions{Envelope: true}
-	envelopes, err := c.Fetch(allMessagesSeqSet, scanFetchOptions).Collect()
-	if err != nil {
-		return nil, fmt.Errorf("failed to scan envelopes: %w", err)
+	email := models.Email{
+		MessageID:         imapid.ID{Folder: folder, UIDValidity: uidValidity, UID: uint32(msg.UID)}.String(),
+		InternetMessageID: msg.Envelope.MessageID,
+		Subject:           msg.Envelope.Subject,
+		From:              from,
+		To:                to,
+		Date:              date,
 	}
-
-	var targetSeqNum uint32
-	for _, msg := range envelopes {
-		if msg.Envelope != nil && msg.Envelope.MessageID == messageID {
-			targetSeqNum = msg.SeqNum
-			log.Printf("Found message with ID %s at sequence number: %d", messageID, targetSeqNum)
+	for _, flag := range msg.Flags {
+		if flag == imap.FlagSeen {
+			email.IsRead = true
 			break
 		}
 	}
+	return email
+}
+
+// searchUIDByMessageID 在当前选中的文件夹中按 Message-ID 头查找邮件 UID，未找到时返回 0
+func searchUIDByMessageID(c *imapclient.Client, messageID string) (imap.UID, error) {
+	messageID = strings.Trim(strings.TrimSpace(messageID), "<>")
+	if messageID == "" {
+		return 0, nil
+	}
+	// 服务器按子串匹配，带上尖括号避免匹配到包含该ID的其他 Message-ID
+	criteria := &imap.SearchCriteria{
+		Header: []imap.SearchCriteriaHeaderField{{Key: "Message-ID", Value: "<" + messageID + ">"}},
+	}
+	data, err := c.UIDSearch(criteria, nil).Wait()
+	if err != nil {
+		return 0, fmt.Errorf("UID SEARCH failed: %w", err)
+	}
+	uids := data.AllUIDs()
+	if len(uids) == 0 {
+		return 0, nil
+	}
+	// 同一 Message-ID 出现多次时取最新的一封
+	return uids[len(uids)-1], nil
+}
 
-	if targetSeqNum == 0 {
-		log.Printf("Message with ID %s not found after scanning all envelopes.", messageID)
-		return nil, fmt.Errorf("message with ID %s not found", messageID)
+// FetchEmailDetailWithIMAP fetches a single email's detailed information using IMAP.
+// messageID 通常是收件箱列表返回的不透明ID，直接 UID FETCH；文件夹的 UIDVALIDITY 变化后改用
+// fallbackMessageID（缓存中记录的 Message-ID 头）通过 UID SEARCH HEADER 重新定位。
+// 为兼容旧客户端，messageID 也可以直接是 Message-ID 头，此时在 INBOX 中搜索。
+func FetchEmailDetailWithIMAP(emailAccount models.EmailAccount, messageID, fallbackMessageID string) (*models.Email, error) {
+	session, err := acquireIMAP(emailAccount)
+	if err != nil {
+		log.Printf("Failed to connect or login for %s: %v", emailAccount.EmailAddress, err)
+		return nil, err
 	}
+	defer session.Release()
+	c := session.Client
 
-	// Step 2: Fetch the full details for the found sequence number.
-	var detailSeqSet imap.SeqSet
-	detailSeqSet.AddNum(targetSeqNum)
+	// Step 1: 确定邮件所在的文件夹和 UID
+	folder, mailbox, uid, err := locateIMAPMessage(c, messageID, fallbackMessageID)
+	if err != nil {
+		return nil, err
+	}
 
-	// 获取完整的邮件内容，包括所有部分
+	// Step 2: UID FETCH 获取完整的邮件内容，包括所有部分
 	fullBodySectionItem := &imap.FetchItemBodySection{Specifier: imap.PartSpecifierNone}
 	detailFetchOptions := &imap.FetchOptions{
 		Envelope:      true,
 		Flags:         true,
+		UID:           true,
 		BodyStructure: &imap.FetchItemBodyStructure{Extended: true},
 		BodySection:   []*imap.FetchItemBodySection{fullBodySectionItem},
 	}
 
-	detailMessages, err := c.Fetch(detailSeqSet, detailFetchOptions).Collect()
+	detailMessages, err := c.Fetch(imap.UIDSetNum(uid), detailFetchOptions).Collect()
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch details for seqnum %d: %w", targetSeqNum, err)
+		return nil, fmt.Errorf("failed to fetch details for uid %d: %w", uid, err)
 	}
 
-	if len(detailMessages) == 0 {
-		return nil, fmt.Errorf("message with seqnum %d vanished after being found", targetSeqNum)
+	if len(detailMessages) == 0 || detailMessages[0].Envelope == nil {
+		return nil, ErrIMAPMessageNotFound
 	}
 
 	// Step 3: Process the detailed message.
@@ -566,15 +563,17 @@ func FetchEmailDetailWithIMAP(emailAccount models.EmailAccount, messageID string
 	}
 
 	email := &models.Email{
-		MessageID:     msg.Envelope.MessageID,
-		Subject:       msg.Envelope.Subject,
-		From:          from,
-		To:            to,
-		Date:          date,
-		Body:          textBody,
-		HTMLBody:      htmlBody,
-		IsRead:        false,
-		HasAttachment: false,
+		// UIDVALIDITY 变化后重新定位到的邮件返回新的ID
+		MessageID:         imapid.ID{Folder: folder, UIDValidity: mailbox.UIDValidity, UID: uint32(msg.UID)}.String(),
+		InternetMessageID: msg.Envelope.MessageID,
+		Subject:           msg.Envelope.Subject,
+		From:              from,
+		To:                to,
+		Date:              date,
+		Body:              textBody,
+		HTMLBody:          htmlBody,
+		IsRead:            false,
+		HasAttachment:     false,
 	}
 
 	for _, flag := range msg.Flags {
@@ -585,12 +584,174 @@ func FetchEmailDetailWithIMAP(emailAccount models.EmailAccount, messageID string
 	}
 
 	if msg.BodyStructure != nil {
-		fullMediaType := msg.BodyStructure.MediaType()
-		if strings.HasPrefix(strings.ToLower(fullMediaType), "multipart/") {
-			email.HasAttachment = true
-		}
+		email.Attachments = imapAttachments(msg.BodyStructure)
+		email.HasAttachment = len(email.Attachments) > 0
 	}
 
-	log.Printf("Successfully fetched email detail for messageID: %s using scan-then-fetch method.", messageID)
+	log.Printf("Successfully fetched email detail for messageID: %s (uid %d in %s).", messageID, msg.UID, folder)
 	return email, nil
 }
+
+// locateIMAPMessage 选择邮件所在的文件夹并确定 UID。
+// messageID 为不透明ID时直接使用其中的 UID；UIDVALIDITY 变化后用 fallbackMessageID 通过 Message-ID 头重新定位。
+// messageID 不是不透明ID时视为 Message-ID 头，在 INBOX 中搜索
+func locateIMAPMessage(c *imapclient.Client, messageID, fallbackMessageID string) (string, *imap.SelectData, imap.UID, error) {
+	folder := "INBOX"
+	ref, isRef := imapid.Parse(messageID)
+	if isRef {
+		folder = ref.Folder
+	}
+
+	mailbox, err := c.Select(folder, nil).Wait()
+	if err != nil {
+		log.Printf("Failed to select %s: %v", folder, err)
+		return "", nil, 0, fmt.Errorf("failed to select %s: %w", folder, err)
+	}
+
+	if isRef && ref.UIDValidity != 0 && ref.UIDValidity != mailbox.UIDValidity {
+		log.Printf("UIDVALIDITY of %s changed (%d -> %d), locating message by Message-ID", folder, ref.UIDValidity, mailbox.UIDValidity)
+	}
+	uid, err := resolveIMAPUID(c, mailbox, messageID, fallbackMessageID)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	return folder, mailbox, uid, nil
+}
+
+// imapPartID 分段路径的文本形式，例如 [2 1] -> "2.1"
+func imapPartID(path []int) string {
+	parts := make([]string, len(path))
+	for i, n := range path {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// imapAttachments 从 BODYSTRUCTURE 中列出附件和内嵌图片，附件ID为分段编号
+func imapAttachments(bs imap.BodyStructure) []models.Attachment {
+	var attachments []models.Attachment
+	bs.Walk(func(path []int, part imap.BodyStructure) bool {
+		single, ok := part.(*imap.BodyStructureSinglePart)
+		if !ok {
+			return true
+		}
+		if attachment, ok := imapAttachment(path, single); ok {
+			attachments = append(attachments, attachment)
+		}
+		return true
+	})
+	return attachments
+}
+
+// imapAttachment 分段是附件时返回其信息
+func imapAttachment(path []int, part *imap.BodyStructureSinglePart) (models.Attachment, bool) {
+	disposition := ""
+	if d := part.Disposition(); d != nil {
+		disposition = d.Value
+	}
+	filename := decodeMIMEWords(part.Filename())
+	contentID := trimContentID(part.ID)
+	isAttachment, inline := attachmentPart(part.MediaType(), filename, disposition, contentID)
+	if !isAttachment {
+		return models.Attachment{}, false
+	}
+	size := int64(part.Size)
+	if strings.EqualFold(part.Encoding, "base64") {
+		// BODYSTRUCTURE 中是编码后的大小
+		size = size * 3 / 4
+	}
+	return models.Attachment{
+		ID:        imapPartID(path),
+		Filename:  filename,
+		MimeType:  part.MediaType(),
+		Size:      size,
+		ContentID: contentID,
+		Inline:    inline,
+	}, true
+}
+
+// FetchIMAPAttachment 下载 IMAP 邮件的附件，partID 为附件的分段编号。
+// 内容以流的方式返回，关闭 Body 时断开 IMAP 连接（客户端可能没有读完，连接不放回连接池）
+func FetchIMAPAttachment(emailAccount models.EmailAccount, messageID, fallbackMessageID, partID string, maxBytes int64) (*AttachmentContent, error) {
+	session, err := acquireIMAP(emailAccount)
+	if err != nil {
+		log.Printf("Failed to connect or login for %s: %v", emailAccount.EmailAddress, err)
+		return nil, err
+	}
+	content, err := fetchIMAPAttachment(session.Client, messageID, fallbackMessageID, partID, maxBytes, func() error {
+		session.Discard()
+		return nil
+	})
+	if err != nil {
+		session.Release()
+		return nil, err
+	}
+	return content, nil
+}
+
+// fetchIMAPAttachment 读取附件，closeBody 在关闭返回的 Body 时调用
+func fetchIMAPAttachment(c *imapclient.Client, messageID, fallbackMessageID, partID string, maxBytes int64, closeBody func() error) (*AttachmentContent, error) {
+	_, _, uid, err := locateIMAPMessage(c, messageID, fallbackMessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先获取 BODYSTRUCTURE 确认分段是附件，并取得文件名和传输编码
+	structures, err := c.Fetch(imap.UIDSetNum(uid), &imap.FetchOptions{
+		UID:           true,
+		BodyStructure: &imap.FetchItemBodyStructure{Extended: true},
+	}).Collect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch body structure for uid %d: %w", uid, err)
+	}
+	if len(structures) == 0 || structures[0].BodyStructure == nil {
+		return nil, ErrIMAPMessageNotFound
+	}
+	var path []int
+	var part *imap.BodyStructureSinglePart
+	var attachment models.Attachment
+	structures[0].BodyStructure.Walk(func(p []int, bs imap.BodyStructure) bool {
+		single, ok := bs.(*imap.BodyStructureSinglePart)
+		if !ok || imapPartID(p) != partID {
+			return part == nil
+		}
+		if a, ok := imapAttachment(p, single); ok {
+			path, part, attachment = p, single, a
+		}
+		return false
+	})
+	if part == nil {
+		return nil, ErrAttachmentNotFound
+	}
+	if maxBytes > 0 && attachment.Size > maxBytes {
+		return nil, ErrAttachmentTooLarge
+	}
+
+	// BODY.PEEK 不会把邮件标记为已读
+	cmd := c.Fetch(imap.UIDSetNum(uid), &imap.FetchOptions{
+		UID:         true,
+		BodySection: []*imap.FetchItemBodySection{{Part: path, Peek: true}},
+	})
+	msg := cmd.Next()
+	if msg == nil {
+		cmd.Close()
+		return nil, ErrIMAPMessageNotFound
+	}
+	for {
+		item := msg.Next()
+		if item == nil {
+			cmd.Close()
+			return nil, ErrAttachmentNotFound
+		}
+		section, ok := item.(imapclient.FetchItemDataBodySection)
+		if !ok || section.Literal == nil {
+			continue
+		}
+		return &AttachmentContent{
+			Filename: attachment.Filename,
+			MimeType: attachment.MimeType,
+			Size:     attachment.Size,
+			Body:     readCloser{Reader: transferDecoder(section.Literal, part.Encoding), close: closeBody},
+		}, nil
+	}
+}
@@ -0,0 +1,229 @@
+package integrations
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"gorm.io/gorm"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/imappool"
+	"email_server/models"
+)
+
+// ErrIMAPPoolExhausted IMAP 服务器的连接数已达上限，等待超时
+var ErrIMAPPoolExhausted = imappool.ErrExhausted
+
+// imapSettings 当前的 IMAP 连接配置，未加载配置时（测试中）不限制超时也不复用连接
+func imapSettings() config.IMAPConfig {
+	if config.AppConfig == nil {
+		return config.IMAPConfig{}
+	}
+	return config.AppConfig.IMAP
+}
+
+func seconds(n int) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+var (
+	imapPoolOnce sync.Once
+	imapPool     *imappool.Pool
+)
+
+// sharedIMAPPool 进程内共用的 IMAP 连接池，首次使用时按配置创建
+func sharedIMAPPool() *imappool.Pool {
+	imapPoolOnce.Do(func() {
+		cfg := imapSettings()
+		imapPool = imappool.New(imappool.Options{
+			MaxPerServer:     cfg.PoolMaxConnectionsPerServer,
+			MaxIdlePerKey:    cfg.PoolMaxIdlePerAccount,
+			IdleTimeout:      seconds(cfg.PoolIdleTimeoutSeconds),
+			HealthCheckAfter: seconds(cfg.PoolHealthCheckSeconds),
+			WaitTimeout:      seconds(cfg.DialTimeoutSeconds),
+		})
+	})
+	return imapPool
+}
+
+// IMAPPoolStats 返回 IMAP 连接池的使用情况
+func IMAPPoolStats() imappool.Stats {
+	return sharedIMAPPool().Stats()
+}
+
+// CloseIMAPConnections 关闭邮箱账户在连接池中的空闲连接，在账户被删除或修改了登录信息后调用
+func CloseIMAPConnections(emailAccountID uint) {
+	prefix := strconv.FormatUint(uint64(emailAccountID), 10) + ":"
+	sharedIMAPPool().CloseIdle(func(key string) bool { return strings.HasPrefix(key, prefix) })
+}
+
+// imapEndpoint 邮箱账户的 IMAP 服务器和登录方式
+type imapEndpoint struct {
+	host     string
+	port     int
+	security string
+	// token OAuth 令牌，为 nil 时使用密码登录
+	token *models.UserOAuthToken
+}
+
+func (e imapEndpoint) addr() string {
+	return net.JoinHostPort(e.host, strconv.Itoa(e.port))
+}
+
+// imapSecurity 返回实际使用的加密方式：未设置时 143 端口使用 STARTTLS，其他端口使用 TLS
+func imapSecurity(security string, port int) string {
+	if security != "" {
+		return security
+	}
+	if port == 143 {
+		return models.IMAPSecurityStartTLS
+	}
+	return models.IMAPSecurityTLS
+}
+
+// resolveIMAPEndpoint 关联了 OAuth 令牌的账户使用服务商配置的 IMAP 服务器和 XOAUTH2，其他账户使用账户中的服务器和密码
+func resolveIMAPEndpoint(emailAccount models.EmailAccount) (imapEndpoint, error) {
+	var token models.UserOAuthToken
+	err := database.DB.Where("email_account_id = ?", emailAccount.ID).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return imapEndpoint{
+			host:     emailAccount.IMAPServer,
+			port:     emailAccount.IMAPPort,
+			security: imapSecurity(emailAccount.IMAPSecurity, emailAccount.IMAPPort),
+		}, nil
+	}
+	if err != nil {
+		return imapEndpoint{}, fmt.Errorf("failed to query for oauth token: %w", err)
+	}
+
+	var provider models.OAuthProvider
+	if err := database.DB.First(&provider, token.ProviderID).Error; err != nil {
+		return imapEndpoint{}, fmt.Errorf("failed to find oauth provider with id %d for imap details: %w", token.ProviderID, err)
+	}
+	return imapEndpoint{
+		host:     provider.IMAPServer,
+		port:     provider.IMAPPort,
+		security: imapSecurity("", provider.IMAPPort),
+		token:    &token,
+	}, nil
+}
+
+// imapConn 已登录的 IMAP 连接
+type imapConn struct {
+	client *imapclient.Client
+	conn   *imappool.DeadlineConn
+}
+
+// Check 发送 NOOP 检查空闲连接是否仍然可用
+func (c *imapConn) Check() error {
+	c.conn.SetActive(true)
+	return c.client.Noop().Wait()
+}
+
+func (c *imapConn) Close() error {
+	return c.client.Close()
+}
+
+// dialIMAP 按加密方式建立连接并等待服务器问候，连接和 TLS 握手受 IMAP_DIAL_TIMEOUT_SECONDS 限制
+func dialIMAP(endpoint imapEndpoint, commandTimeout time.Duration, options *imapclient.Options) (*imapConn, error) {
+	if options == nil {
+		options = &imapclient.Options{}
+	}
+	dialTimeout := seconds(imapSettings().DialTimeoutSeconds)
+	dialer := net.Dialer{Timeout: dialTimeout}
+	raw, err := dialer.Dial("tcp", endpoint.addr())
+	if err != nil {
+		return nil, err
+	}
+	conn := imappool.NewDeadlineConn(raw, commandTimeout)
+	conn.SetActive(true)
+
+	var client *imapclient.Client
+	switch endpoint.security {
+	case models.IMAPSecurityNone:
+		client = imapclient.New(conn, options)
+	case models.IMAPSecurityStartTLS:
+		startTLSOptions := *options
+		startTLSOptions.TLSConfig = &tls.Config{ServerName: endpoint.host}
+		if client, err = imapclient.NewStartTLS(conn, &startTLSOptions); err != nil {
+			return nil, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	default:
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: endpoint.host, NextProtos: []string{"imap"}})
+		ctx := context.Background()
+		if dialTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, dialTimeout)
+			defer cancel()
+		}
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		client = imapclient.New(tlsConn, options)
+	}
+	if err := client.WaitGreeting(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("no greeting from server: %w", err)
+	}
+	return &imapConn{client: client, conn: conn}, nil
+}
+
+// imapSession 从连接池取出的已登录连接，用完后必须调用 Release 或 Discard
+type imapSession struct {
+	Client *imapclient.Client
+	conn   *imapConn
+	lease  *imappool.Lease
+}
+
+// acquireIMAP 取出邮箱账户的空闲连接，没有时建立新连接并登录。
+// 账户修改后 UpdatedAt 变化，之前的连接不再被复用
+func acquireIMAP(emailAccount models.EmailAccount) (*imapSession, error) {
+	endpoint, err := resolveIMAPEndpoint(emailAccount)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%d:%d", emailAccount.ID, emailAccount.UpdatedAt.UnixNano())
+	commandTimeout := seconds(imapSettings().CommandTimeoutSeconds)
+	lease, err := sharedIMAPPool().Get(endpoint.addr(), key, func() (imappool.Conn, error) {
+		conn, err := connectAndLogin(emailAccount, endpoint, commandTimeout, nil)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	conn := lease.Conn.(*imapConn)
+	conn.conn.SetActive(true)
+	return &imapSession{Client: conn.client, conn: conn, lease: lease}, nil
+}
+
+// Release 归还连接。出现过读写错误或已退出登录的连接直接关闭
+func (s *imapSession) Release() {
+	reusable := !s.conn.conn.Broken()
+	if state := s.Client.State(); state != imap.ConnStateAuthenticated && state != imap.ConnStateSelected {
+		reusable = false
+	}
+	s.conn.conn.SetActive(false)
+	s.lease.Release(reusable)
+}
+
+// Discard 关闭连接而不放回连接池，用于连接上可能还有未读完的响应时
+func (s *imapSession) Discard() {
+	s.lease.Release(false)
+}
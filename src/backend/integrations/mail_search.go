@@ -0,0 +1,151 @@
+package integrations
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+
+	"email_server/mailquery"
+	"email_server/models"
+)
+
+// 搜索函数的 pageToken 为上一页返回的翻页标记，为空时返回第一页；返回的翻页标记为空表示没有更多结果
+
+// SearchGmailMessages 使用 messages.list 的 q 参数在标签中搜索邮件
+func SearchGmailMessages(emailAccount models.EmailAccount, query mailquery.Query, labelName, pageToken string, pageSize int) ([]models.Email, string, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	listResponse, err := listGmailMessages(client, labelName, query.Gmail(), pageToken, pageSize, "")
+	if err != nil {
+		return nil, "", err
+	}
+	return fetchGmailMessages(client, listResponse.Messages), listResponse.NextPageToken, nil
+}
+
+// SearchGraphMessages 在文件夹中搜索邮件：包含地址、主题或自由文本时使用 $search（按相关性排序，
+// 已读状态在结果中再过滤），否则使用 $filter 并按收到时间倒序
+func SearchGraphMessages(emailAccount models.EmailAccount, query mailquery.Query, folderName, pageToken string, pageSize int) ([]models.Email, string, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	if generic := genericFolder(folderName); generic != "" {
+		folderName = graphWellKnownFolders[generic]
+	}
+
+	requestURL := pageToken
+	if requestURL == "" {
+		params := url.Values{}
+		params.Set("$top", strconv.Itoa(pageSize))
+		params.Set("$select", graphMessageListFields)
+		if query.UsesGraphSearch() {
+			params.Set("$search", query.GraphSearch())
+		} else {
+			params.Set("$filter", query.GraphFilter())
+			params.Set("$orderby", "receivedDateTime desc")
+		}
+		requestURL = graphAPIBaseURL + "v1.0/me/mailFolders/" + url.PathEscape(folderName) + "/messages?" + params.Encode()
+	} else if !strings.HasPrefix(requestURL, graphAPIBaseURL) {
+		return nil, "", fmt.Errorf("graph api next link has unexpected host: %s", requestURL)
+	}
+
+	graphResponse, err := getGraphMessages(client, requestURL)
+	if err != nil {
+		return nil, "", err
+	}
+	emails := graphMessagesToEmails(graphResponse)
+	if query.UsesGraphSearch() && (query.Unread || query.Read) {
+		filtered := emails[:0]
+		for _, email := range emails {
+			if email.IsRead == query.Read {
+				filtered = append(filtered, email)
+			}
+		}
+		emails = filtered
+	}
+	return emails, graphResponse.NextLink, nil
+}
+
+// SearchIMAPMessages 在文件夹中执行 UID SEARCH，按 UID 倒序返回一页结果。
+// 翻页标记为 "UIDVALIDITY:UID"，下一页只包含 UID 更小的邮件；UIDVALIDITY 变化后返回 ErrIMAPUIDValidityChanged
+func SearchIMAPMessages(emailAccount models.EmailAccount, query mailquery.Query, folder, pageToken string, pageSize int) ([]models.Email, string, error) {
+	var tokenValidity, beforeUID uint32
+	if pageToken != "" {
+		validity, uid, ok := strings.Cut(pageToken, ":")
+		v, err1 := strconv.ParseUint(validity, 10, 32)
+		u, err2 := strconv.ParseUint(uid, 10, 32)
+		if !ok || err1 != nil || err2 != nil || u <= 1 {
+			return nil, "", fmt.Errorf("invalid imap page token: %q", pageToken)
+		}
+		tokenValidity, beforeUID = uint32(v), uint32(u)
+	}
+
+	session, err := acquireIMAP(emailAccount)
+	if err != nil {
+		log.Printf("Failed to connect or login for %s: %v", emailAccount.EmailAddress, err)
+		return nil, "", err
+	}
+	defer session.Release()
+	c := session.Client
+
+	if generic := genericFolder(folder); generic != "" {
+		folder = generic
+	}
+	if folder, err = resolveIMAPFolder(c, folder); err != nil {
+		return nil, "", err
+	}
+	mailbox, err := c.Select(folder, &imap.SelectOptions{ReadOnly: true}).Wait()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to select %s: %w", folder, err)
+	}
+	if pageToken != "" && tokenValidity != mailbox.UIDValidity {
+		return nil, "", ErrIMAPUIDValidityChanged
+	}
+
+	criteria := query.IMAPCriteria()
+	if beforeUID > 0 {
+		var before imap.UIDSet
+		before.AddRange(1, imap.UID(beforeUID-1))
+		criteria.UID = []imap.UIDSet{before}
+	}
+	data, err := c.UIDSearch(criteria, nil).Wait()
+	if err != nil {
+		return nil, "", fmt.Errorf("UID SEARCH failed: %w", err)
+	}
+	uids := data.AllUIDs()
+	if len(uids) == 0 {
+		return []models.Email{}, "", nil
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+
+	// 取 UID 最大（最新）的 pageSize 封
+	page := uids
+	nextToken := ""
+	if len(uids) > pageSize {
+		page = uids[len(uids)-pageSize:]
+		nextToken = fmt.Sprintf("%d:%d", mailbox.UIDValidity, page[0])
+	}
+	var set imap.UIDSet
+	set.AddNum(page...)
+	messages, err := c.Fetch(set, &imap.FetchOptions{Envelope: true, Flags: true, UID: true}).Collect()
+	if err != nil {
+		return nil, "", fmt.Errorf("IMAP fetch command failed: %w", err)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].UID > messages[j].UID })
+
+	emails := make([]models.Email, 0, len(messages))
+	for _, msg := range messages {
+		if msg == nil || msg.Envelope == nil {
+			continue
+		}
+		emails = append(emails, imapEnvelopeEmail(folder, mailbox.UIDValidity, msg))
+	}
+	return emails, nextToken, nil
+}
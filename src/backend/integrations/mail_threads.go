@@ -0,0 +1,527 @@
+package integrations
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+
+	"email_server/imapid"
+	"email_server/mailthread"
+	"email_server/models"
+)
+
+// ErrThreadNotFound 会话不存在或其中的邮件都已删除
+var ErrThreadNotFound = errors.New("thread not found")
+
+// MailThread 服务商返回的一个会话，Messages 按日期升序，只包含邮件头和摘要，不含正文
+type MailThread struct {
+	ID       string
+	Messages []models.Email
+}
+
+// 列出会话的函数的 pageToken 为上一页返回的翻页标记，为空时返回第一页；返回的翻页标记为空表示没有更多会话
+
+// threadFetchConcurrency 并发获取会话内容的数量
+const threadFetchConcurrency = 5
+
+// fetchThreadsConcurrently 并发获取每个会话，结果按 ids 的顺序返回，获取失败的会话被跳过
+func fetchThreadsConcurrently(ids []string, fetch func(id string) (MailThread, error)) []MailThread {
+	results := make([]*MailThread, len(ids))
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, threadFetchConcurrency)
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			thread, err := fetch(id)
+			if err != nil {
+				log.Printf("Failed to fetch thread %s: %v", id, err)
+				return
+			}
+			results[i] = &thread
+		}(i, id)
+	}
+	wg.Wait()
+
+	threads := make([]MailThread, 0, len(ids))
+	for _, thread := range results {
+		if thread != nil && len(thread.Messages) > 0 {
+			threads = append(threads, *thread)
+		}
+	}
+	return threads
+}
+
+func sortThreadMessages(messages []models.Email) {
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].Date.Before(messages[j].Date) })
+}
+
+// gmailThreadListResponse threads.list 的响应
+type gmailThreadListResponse struct {
+	Threads []struct {
+		ID string `json:"id"`
+	} `json:"threads"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// ListGmailThreads 使用 threads.list 列出标签中的会话（按最新邮件倒序），再逐个获取会话中的邮件
+func ListGmailThreads(emailAccount models.EmailAccount, labelName, pageToken string, pageSize int) ([]MailThread, string, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	query := url.Values{}
+	query.Set("labelIds", labelName)
+	query.Set("maxResults", strconv.Itoa(pageSize))
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+	var listResponse gmailThreadListResponse
+	if err := getGmailJSON(client, "https://gmail.googleapis.com/gmail/v1/users/me/threads?"+query.Encode(), &listResponse); err != nil {
+		return nil, "", err
+	}
+
+	ids := make([]string, len(listResponse.Threads))
+	for i, thread := range listResponse.Threads {
+		ids[i] = thread.ID
+	}
+	threads := fetchThreadsConcurrently(ids, func(id string) (MailThread, error) {
+		return fetchGmailThread(client, id)
+	})
+	return threads, listResponse.NextPageToken, nil
+}
+
+// GetGmailThread 获取 Gmail 会话中的全部邮件
+func GetGmailThread(emailAccount models.EmailAccount, threadID string) (MailThread, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return MailThread{}, fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	return fetchGmailThread(client, threadID)
+}
+
+// fetchGmailThread 调用 threads.get，只请求列表需要的邮件头
+func fetchGmailThread(client *http.Client, threadID string) (MailThread, error) {
+	query := url.Values{}
+	query.Set("format", "metadata")
+	for _, header := range []string{"Subject", "From", "To", "Cc", "Date"} {
+		query.Add("metadataHeaders", header)
+	}
+	var response struct {
+		ID       string         `json:"id"`
+		Messages []GmailMessage `json:"messages"`
+	}
+	requestURL := "https://gmail.googleapis.com/gmail/v1/users/me/threads/" + url.PathEscape(threadID) + "?" + query.Encode()
+	if err := getGmailJSON(client, requestURL, &response); err != nil {
+		if errors.Is(err, ErrAttachmentNotFound) {
+			return MailThread{}, ErrThreadNotFound
+		}
+		return MailThread{}, err
+	}
+	if len(response.Messages) == 0 {
+		return MailThread{}, ErrThreadNotFound
+	}
+
+	thread := MailThread{ID: response.ID}
+	for i := range response.Messages {
+		email := convertGmailMessageToEmail(&response.Messages[i])
+		email.Snippet = response.Messages[i].Snippet
+		thread.Messages = append(thread.Messages, *email)
+	}
+	sortThreadMessages(thread.Messages)
+	return thread, nil
+}
+
+// ListGraphThreads 取文件夹中的一页邮件，按 conversationId 分组后获取每个会话的全部邮件（包括其他文件夹中的回复）。
+// 翻页以邮件为单位，同一会话在之后的页中可能再次出现，调用方按会话ID去重
+func ListGraphThreads(emailAccount models.EmailAccount, folderName, pageToken string, pageSize int) ([]MailThread, string, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	if generic := genericFolder(folderName); generic != "" {
+		folderName = graphWellKnownFolders[generic]
+	}
+	graphResponse, err := listGraphMessages(client, pageToken, pageSize, folderName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var ids []string
+	seen := map[string]bool{}
+	for _, email := range graphMessagesToEmails(graphResponse) {
+		id := email.ThreadID
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	threads := fetchThreadsConcurrently(ids, func(id string) (MailThread, error) {
+		return fetchGraphConversation(client, id)
+	})
+	return threads, graphResponse.NextLink, nil
+}
+
+// GetGraphThread 获取 Graph 会话中的全部邮件
+func GetGraphThread(emailAccount models.EmailAccount, conversationID string) (MailThread, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return MailThread{}, fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	return fetchGraphConversation(client, conversationID)
+}
+
+// graphConversationMaxMessages 单个会话最多获取的邮件数量
+const graphConversationMaxMessages = 100
+
+// fetchGraphConversation 按 conversationId 过滤全部文件夹中的邮件。该过滤不能与 $orderby 同时使用，在本地按日期排序
+func fetchGraphConversation(client *http.Client, conversationID string) (MailThread, error) {
+	query := url.Values{}
+	query.Set("$filter", "conversationId eq '"+strings.ReplaceAll(conversationID, "'", "''")+"'")
+	query.Set("$select", graphMessageListFields+",bodyPreview")
+	query.Set("$top", strconv.Itoa(graphConversationMaxMessages))
+	graphResponse, err := getGraphMessages(client, graphAPIBaseURL+"v1.0/me/messages?"+query.Encode())
+	if err != nil {
+		return MailThread{}, err
+	}
+	if len(graphResponse.Value) == 0 {
+		return MailThread{}, ErrThreadNotFound
+	}
+	thread := MailThread{ID: conversationID, Messages: graphMessagesToEmails(graphResponse)}
+	sortThreadMessages(thread.Messages)
+	return thread, nil
+}
+
+// imapThreadWindow 服务器不支持 THREAD 扩展时，在本地分组的最新邮件数量
+const imapThreadWindow = 500
+
+// imapReferencesSection 只获取 References 头
+var imapReferencesSection = &imap.FetchItemBodySection{
+	Specifier:    imap.PartSpecifierHeader,
+	HeaderFields: []string{"References"},
+	Peek:         true,
+}
+
+// ListIMAPThreads 列出文件夹中的会话，按最新邮件倒序。服务器支持 THREAD=REFERENCES 时使用 UID THREAD，
+// 否则取最新的 imapThreadWindow 封邮件按 References、In-Reply-To 在本地分组（见 mailthread 包）。
+// 翻页标记为 "UIDVALIDITY:偏移量"；UIDVALIDITY 变化后返回 ErrIMAPUIDValidityChanged
+func ListIMAPThreads(emailAccount models.EmailAccount, folder, pageToken string, pageSize int) ([]MailThread, string, error) {
+	var tokenValidity uint32
+	offset := 0
+	if pageToken != "" {
+		validity, rawOffset, ok := strings.Cut(pageToken, ":")
+		v, err1 := strconv.ParseUint(validity, 10, 32)
+		o, err2 := strconv.Atoi(rawOffset)
+		if !ok || err1 != nil || err2 != nil || o <= 0 {
+			return nil, "", fmt.Errorf("invalid imap page token: %q", pageToken)
+		}
+		tokenValidity, offset = uint32(v), o
+	}
+
+	session, err := acquireIMAP(emailAccount)
+	if err != nil {
+		log.Printf("Failed to connect or login for %s: %v", emailAccount.EmailAddress, err)
+		return nil, "", err
+	}
+	defer session.Release()
+	c := session.Client
+
+	folder, mailbox, err := selectIMAPThreadFolder(c, folder)
+	if err != nil {
+		return nil, "", err
+	}
+	if pageToken != "" && tokenValidity != mailbox.UIDValidity {
+		return nil, "", ErrIMAPUIDValidityChanged
+	}
+
+	var groups [][]imap.UID
+	var threadMessages map[imap.UID]imapThreadMessage
+	if supportsIMAPThreadReferences(c) {
+		data, err := c.UIDThread(&imapclient.ThreadOptions{Algorithm: imap.ThreadReferences, SearchCriteria: &imap.SearchCriteria{}}).Wait()
+		if err != nil {
+			return nil, "", fmt.Errorf("UID THREAD failed: %w", err)
+		}
+		for _, thread := range data {
+			groups = append(groups, flattenIMAPThread(thread, nil))
+		}
+		// 按会话中最大的 UID（最近收到的邮件）倒序
+		sort.SliceStable(groups, func(i, j int) bool { return maxUID(groups[i]) > maxUID(groups[j]) })
+	} else {
+		data, err := c.UIDSearch(&imap.SearchCriteria{}, nil).Wait()
+		if err != nil {
+			return nil, "", fmt.Errorf("UID SEARCH failed: %w", err)
+		}
+		uids := data.AllUIDs()
+		sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+		if len(uids) > imapThreadWindow {
+			uids = uids[len(uids)-imapThreadWindow:]
+		}
+		threadMessages, err = fetchIMAPThreadMessages(c, folder, mailbox.UIDValidity, uids)
+		if err != nil {
+			return nil, "", err
+		}
+		groups = groupIMAPThreadMessages(threadMessages)
+	}
+
+	if offset >= len(groups) {
+		return []MailThread{}, "", nil
+	}
+	end := offset + pageSize
+	nextToken := ""
+	if end < len(groups) {
+		nextToken = fmt.Sprintf("%d:%d", mailbox.UIDValidity, end)
+	} else {
+		end = len(groups)
+	}
+	groups = groups[offset:end]
+
+	if threadMessages == nil {
+		var uids []imap.UID
+		for _, group := range groups {
+			uids = append(uids, group...)
+		}
+		if threadMessages, err = fetchIMAPThreadMessages(c, folder, mailbox.UIDValidity, uids); err != nil {
+			return nil, "", err
+		}
+	}
+	threads := make([]MailThread, 0, len(groups))
+	for _, group := range groups {
+		if thread, ok := buildIMAPThread(folder, group, threadMessages); ok {
+			threads = append(threads, thread)
+		}
+	}
+	return threads, nextToken, nil
+}
+
+// GetIMAPThread 获取 IMAP 会话。threadID 通常由 ListIMAPThreads 返回（imapid.ThreadID），在会话所在的文件夹中
+// 搜索根邮件以及 References、In-Reply-To 引用根邮件的全部邮件；根邮件没有 Message-ID 时会话ID为该邮件的ID，只包含这一封
+func GetIMAPThread(emailAccount models.EmailAccount, threadID string) (MailThread, error) {
+	id, isThread := imapid.ParseThread(threadID)
+	ref, isMessage := imapid.Parse(threadID)
+	if !isThread && !isMessage {
+		return MailThread{}, ErrThreadNotFound
+	}
+	folder := id.Folder
+	if isMessage {
+		folder = ref.Folder
+	}
+
+	session, err := acquireIMAP(emailAccount)
+	if err != nil {
+		log.Printf("Failed to connect or login for %s: %v", emailAccount.EmailAddress, err)
+		return MailThread{}, err
+	}
+	defer session.Release()
+	c := session.Client
+
+	folder, mailbox, err := selectIMAPThreadFolder(c, folder)
+	if err != nil {
+		return MailThread{}, err
+	}
+
+	var uids []imap.UID
+	if isMessage {
+		if ref.UIDValidity != mailbox.UIDValidity {
+			return MailThread{}, ErrIMAPUIDValidityChanged
+		}
+		uids = []imap.UID{imap.UID(ref.UID)}
+	} else {
+		// 服务器按子串匹配，带上尖括号避免匹配到包含该ID的其他 Message-ID
+		root := "<" + id.Root + ">"
+		header := func(key string) imap.SearchCriteria {
+			return imap.SearchCriteria{Header: []imap.SearchCriteriaHeaderField{{Key: key, Value: root}}}
+		}
+		criteria := &imap.SearchCriteria{Or: [][2]imap.SearchCriteria{{
+			header("Message-ID"),
+			{Or: [][2]imap.SearchCriteria{{header("References"), header("In-Reply-To")}}},
+		}}}
+		data, err := c.UIDSearch(criteria, nil).Wait()
+		if err != nil {
+			return MailThread{}, fmt.Errorf("UID SEARCH failed: %w", err)
+		}
+		uids = data.AllUIDs()
+	}
+	threadMessages, err := fetchIMAPThreadMessages(c, folder, mailbox.UIDValidity, uids)
+	if err != nil {
+		return MailThread{}, err
+	}
+	thread, ok := buildIMAPThread(folder, uids, threadMessages)
+	if !ok {
+		return MailThread{}, ErrThreadNotFound
+	}
+	// 会话ID保持请求中的ID，即使根邮件本身不在文件夹中
+	thread.ID = threadID
+	for i := range thread.Messages {
+		thread.Messages[i].ThreadID = thread.ID
+	}
+	return thread, nil
+}
+
+// selectIMAPThreadFolder 解析通用文件夹名称并以只读方式选择文件夹
+func selectIMAPThreadFolder(c *imapclient.Client, folder string) (string, *imap.SelectData, error) {
+	if generic := genericFolder(folder); generic != "" {
+		folder = generic
+	}
+	folder, err := resolveIMAPFolder(c, folder)
+	if err != nil {
+		return "", nil, err
+	}
+	mailbox, err := c.Select(folder, &imap.SelectOptions{ReadOnly: true}).Wait()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to select %s: %w", folder, err)
+	}
+	return folder, mailbox, nil
+}
+
+func supportsIMAPThreadReferences(c *imapclient.Client) bool {
+	for _, algorithm := range c.Caps().ThreadAlgorithms() {
+		if algorithm == imap.ThreadReferences {
+			return true
+		}
+	}
+	return false
+}
+
+// flattenIMAPThread 按树的先序展开 THREAD 响应中的 UID
+func flattenIMAPThread(thread imapclient.ThreadData, out []imap.UID) []imap.UID {
+	for _, uid := range thread.Chain {
+		out = append(out, imap.UID(uid))
+	}
+	for _, sub := range thread.SubThreads {
+		out = flattenIMAPThread(sub, out)
+	}
+	return out
+}
+
+func maxUID(uids []imap.UID) imap.UID {
+	var max imap.UID
+	for _, uid := range uids {
+		if uid > max {
+			max = uid
+		}
+	}
+	return max
+}
+
+// imapThreadMessage 分组需要的邮件信息
+type imapThreadMessage struct {
+	email      models.Email
+	references []string // References 头中的 Message-ID，In-Reply-To 放在最后
+}
+
+// fetchIMAPThreadMessages 获取邮件的信封、标记和 References 头
+func fetchIMAPThreadMessages(c *imapclient.Client, folder string, uidValidity uint32, uids []imap.UID) (map[imap.UID]imapThreadMessage, error) {
+	result := make(map[imap.UID]imapThreadMessage, len(uids))
+	if len(uids) == 0 {
+		return result, nil
+	}
+	var set imap.UIDSet
+	set.AddNum(uids...)
+	messages, err := c.Fetch(set, &imap.FetchOptions{
+		Envelope:    true,
+		Flags:       true,
+		UID:         true,
+		BodySection: []*imap.FetchItemBodySection{imapReferencesSection},
+	}).Collect()
+	if err != nil {
+		return nil, fmt.Errorf("IMAP fetch command failed: %w", err)
+	}
+	for _, msg := range messages {
+		if msg == nil || msg.Envelope == nil {
+			continue
+		}
+		var references []string
+		if header := string(msg.FindBodySection(imapReferencesSection)); header != "" {
+			if _, value, ok := strings.Cut(header, ":"); ok {
+				references = mailthread.ParseIDs(value)
+			}
+		}
+		for _, inReplyTo := range msg.Envelope.InReplyTo {
+			if inReplyTo = strings.Trim(inReplyTo, "<>"); inReplyTo != "" && !containsString(references, inReplyTo) {
+				references = append(references, inReplyTo)
+			}
+		}
+		result[msg.UID] = imapThreadMessage{
+			email:      imapEnvelopeEmail(folder, uidValidity, msg),
+			references: references,
+		}
+	}
+	return result, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// groupIMAPThreadMessages 用 mailthread 在本地分组，返回每个会话的 UID，会话按最新邮件倒序
+func groupIMAPThreadMessages(messages map[imap.UID]imapThreadMessage) [][]imap.UID {
+	// map 的遍历顺序不固定，按 UID 排序保证日期相同时结果稳定
+	uids := make([]imap.UID, 0, len(messages))
+	for uid := range messages {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	input := make([]mailthread.Message, 0, len(uids))
+	for _, uid := range uids {
+		msg := messages[uid]
+		input = append(input, mailthread.Message{
+			Key:        strconv.FormatUint(uint64(uid), 10),
+			MessageID:  msg.email.InternetMessageID,
+			References: msg.references,
+			Date:       msg.email.Date,
+		})
+	}
+
+	threads := mailthread.Build(input)
+	groups := make([][]imap.UID, len(threads))
+	for i, thread := range threads {
+		for _, key := range thread.Keys {
+			uid, _ := strconv.ParseUint(key, 10, 32)
+			groups[i] = append(groups[i], imap.UID(uid))
+		}
+	}
+	return groups
+}
+
+// buildIMAPThread 按 UID 组装会话。会话ID以最早一封邮件引用的根邮件（或其自身）为准，根邮件没有 Message-ID 时用其邮件ID
+func buildIMAPThread(folder string, uids []imap.UID, messages map[imap.UID]imapThreadMessage) (MailThread, bool) {
+	var members []imapThreadMessage
+	for _, uid := range uids {
+		if msg, ok := messages[uid]; ok {
+			members = append(members, msg)
+		}
+	}
+	if len(members) == 0 {
+		return MailThread{}, false
+	}
+	sort.SliceStable(members, func(i, j int) bool { return members[i].email.Date.Before(members[j].email.Date) })
+
+	var thread MailThread
+	if root := mailthread.RootOf(strings.Trim(members[0].email.InternetMessageID, "<>"), members[0].references); root != "" {
+		thread.ID = imapid.ThreadID{Folder: folder, Root: root}.String()
+	} else {
+		thread.ID = members[0].email.MessageID
+	}
+	for _, member := range members {
+		member.email.ThreadID = thread.ID
+		thread.Messages = append(thread.Messages, member.email)
+	}
+	return thread, true
+}
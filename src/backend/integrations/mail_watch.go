@@ -0,0 +1,413 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+
+	"email_server/models"
+)
+
+// 新邮件监听使用的检查函数。cursor 为上次返回的检查位置，为空或失效时从当前位置开始，不返回已有的邮件
+
+// mailWatchMaxMessages 一次检查最多返回的新邮件数量，超出时只返回最新的邮件
+const mailWatchMaxMessages = 50
+
+// IMAPWatchHandler IMAP 监听的回调，在监听所在的 goroutine 中调用
+type IMAPWatchHandler struct {
+	// Ready 登录并选择收件箱后调用，idle 表示服务器支持 IDLE
+	Ready func(idle bool)
+	// NewMessages 检查后调用，emails 可能为空，cursor 为新的检查位置。返回错误时结束监听
+	NewMessages func(emails []models.Email, cursor string) error
+}
+
+// WatchIMAPInbox 保持 IMAP 连接监听收件箱，直到 ctx 取消（返回 nil）或连接出错。
+// 服务器支持 IDLE 时在 IDLE 中等待新邮件通知（go-imap 每隔约 28 分钟自动重新发送 IDLE），否则每隔 pollInterval 检查一次。
+// cursor 为 "UIDVALIDITY:UID"，只返回 UID 更大的邮件
+func WatchIMAPInbox(ctx context.Context, emailAccount models.EmailAccount, cursor string, pollInterval time.Duration, handler IMAPWatchHandler) error {
+	notify := make(chan struct{}, 1)
+	options := &imapclient.Options{
+		UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+			Mailbox: func(data *imapclient.UnilateralDataMailbox) {
+				if data.NumMessages == nil {
+					return
+				}
+				select {
+				case notify <- struct{}{}:
+				default:
+				}
+			},
+		},
+	}
+	c, err := connectIMAPWithOptions(emailAccount, options)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	// ctx 取消时关闭连接，结束阻塞中的命令
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+
+	mailbox, err := c.Select("INBOX", &imap.SelectOptions{ReadOnly: true}).Wait()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to select INBOX: %w", err)
+	}
+	idle := c.Caps().Has(imap.CapIdle)
+	if handler.Ready != nil {
+		handler.Ready(idle)
+	}
+
+	for {
+		emails, next, err := checkIMAPInbox(c, mailbox, cursor)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		cursor = next
+		if err := handler.NewMessages(emails, cursor); err != nil {
+			return err
+		}
+
+		if !idle {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+
+		idleCmd, err := c.Idle()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("IDLE failed: %w", err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- idleCmd.Wait() }()
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-done:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("IDLE ended: %w", err)
+		case <-notify:
+			if err := idleCmd.Close(); err != nil {
+				return fmt.Errorf("failed to stop IDLE: %w", err)
+			}
+			if err := <-done; err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("IDLE ended: %w", err)
+			}
+		}
+	}
+}
+
+// checkIMAPInbox 返回 cursor 之后收到的邮件。cursor 为空或 UIDVALIDITY 变化时从当前位置开始
+func checkIMAPInbox(c *imapclient.Client, mailbox *imap.SelectData, cursor string) ([]models.Email, string, error) {
+	lastUID, ok := parseIMAPWatchCursor(cursor, mailbox.UIDValidity)
+	if !ok {
+		if mailbox.UIDNext > 0 {
+			return nil, fmt.Sprintf("%d:%d", mailbox.UIDValidity, mailbox.UIDNext-1), nil
+		}
+		// 服务器没有返回 UIDNEXT 时以现有最大的 UID 为起点
+		data, err := c.UIDSearch(&imap.SearchCriteria{}, nil).Wait()
+		if err != nil {
+			return nil, "", fmt.Errorf("UID SEARCH failed: %w", err)
+		}
+		var max imap.UID
+		for _, uid := range data.AllUIDs() {
+			if uid > max {
+				max = uid
+			}
+		}
+		return nil, fmt.Sprintf("%d:%d", mailbox.UIDValidity, max), nil
+	}
+
+	// "UID n:*" 在没有更大的 UID 时也会返回最后一封邮件，需要再过滤
+	var set imap.UIDSet
+	set.AddRange(imap.UID(lastUID+1), 0)
+	data, err := c.UIDSearch(&imap.SearchCriteria{UID: []imap.UIDSet{set}}, nil).Wait()
+	if err != nil {
+		return nil, "", fmt.Errorf("UID SEARCH failed: %w", err)
+	}
+	var uids []imap.UID
+	for _, uid := range data.AllUIDs() {
+		if uint32(uid) > lastUID {
+			uids = append(uids, uid)
+		}
+	}
+	if len(uids) == 0 {
+		return nil, cursor, nil
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	next := fmt.Sprintf("%d:%d", mailbox.UIDValidity, uids[len(uids)-1])
+	if len(uids) > mailWatchMaxMessages {
+		uids = uids[len(uids)-mailWatchMaxMessages:]
+	}
+
+	messages, err := c.Fetch(imap.UIDSetNum(uids...), &imap.FetchOptions{Envelope: true, Flags: true, UID: true}).Collect()
+	if err != nil {
+		return nil, "", fmt.Errorf("IMAP fetch command failed: %w", err)
+	}
+	emails := make([]models.Email, 0, len(messages))
+	for _, msg := range messages {
+		if msg == nil || msg.Envelope == nil {
+			continue
+		}
+		emails = append(emails, imapEnvelopeEmail("INBOX", mailbox.UIDValidity, msg))
+	}
+	return emails, next, nil
+}
+
+// parseIMAPWatchCursor 解析 "UIDVALIDITY:UID"，UIDVALIDITY 与当前不同时返回 false
+func parseIMAPWatchCursor(cursor string, uidValidity uint32) (uint32, bool) {
+	validity, uid, ok := strings.Cut(cursor, ":")
+	if !ok {
+		return 0, false
+	}
+	v, err1 := strconv.ParseUint(validity, 10, 32)
+	u, err2 := strconv.ParseUint(uid, 10, 32)
+	if err1 != nil || err2 != nil || uint32(v) != uidValidity {
+		return 0, false
+	}
+	return uint32(u), true
+}
+
+// gmailHistoryResponse history.list 的响应，只包含新增邮件
+type gmailHistoryResponse struct {
+	History []struct {
+		MessagesAdded []struct {
+			Message GmailMessageRef `json:"message"`
+		} `json:"messagesAdded"`
+	} `json:"history"`
+	HistoryID     string `json:"historyId"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// CheckGmailHistory 用 history.list 获取 historyID 之后收件箱中新增的邮件，返回新的 historyId。
+// historyID 为空或已过期（Gmail 只保留约一周的历史）时从当前的 historyId 开始
+func CheckGmailHistory(emailAccount models.EmailAccount, historyID string) ([]models.Email, string, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	if historyID == "" {
+		latest, err := gmailCurrentHistoryID(client)
+		return nil, latest, err
+	}
+
+	var refs []GmailMessageRef
+	seen := map[string]bool{}
+	latest := historyID
+	pageToken := ""
+	for {
+		query := url.Values{}
+		query.Set("startHistoryId", historyID)
+		query.Set("historyTypes", "messageAdded")
+		query.Set("labelId", "INBOX")
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		var response gmailHistoryResponse
+		err := getGmailJSON(client, "https://gmail.googleapis.com/gmail/v1/users/me/history?"+query.Encode(), &response)
+		if errors.Is(err, ErrAttachmentNotFound) {
+			log.Printf("[CheckGmailHistory] History %s of account %d expired, restarting from current position", historyID, emailAccount.ID)
+			latest, err := gmailCurrentHistoryID(client)
+			return nil, latest, err
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		for _, history := range response.History {
+			for _, added := range history.MessagesAdded {
+				if !seen[added.Message.ID] {
+					seen[added.Message.ID] = true
+					refs = append(refs, added.Message)
+				}
+			}
+		}
+		if response.HistoryID != "" {
+			latest = response.HistoryID
+		}
+		if pageToken = response.NextPageToken; pageToken == "" {
+			break
+		}
+	}
+
+	if len(refs) > mailWatchMaxMessages {
+		refs = refs[len(refs)-mailWatchMaxMessages:]
+	}
+	return fetchGmailMessages(client, refs), latest, nil
+}
+
+// gmailCurrentHistoryID 邮箱当前的 historyId
+func gmailCurrentHistoryID(client *http.Client) (string, error) {
+	var profile struct {
+		HistoryID string `json:"historyId"`
+	}
+	if err := getGmailJSON(client, "https://gmail.googleapis.com/gmail/v1/users/me/profile", &profile); err != nil {
+		return "", err
+	}
+	return profile.HistoryID, nil
+}
+
+// errGraphDeltaExpired deltaLink 已失效，需要重新开始
+var errGraphDeltaExpired = errors.New("graph delta token expired")
+
+// graphDeltaResponse delta 查询的一页结果，被删除的邮件带有 @removed
+type graphDeltaResponse struct {
+	Value []struct {
+		GraphAPIMessage
+		Removed json.RawMessage `json:"@removed"`
+	} `json:"value"`
+	NextLink  string `json:"@odata.nextLink"`
+	DeltaLink string `json:"@odata.deltaLink"`
+}
+
+// CheckGraphInboxDelta 用收件箱的 delta 查询获取 deltaLink 之后新增或变化的邮件，返回新的 deltaLink。
+// delta 查询也会返回已读状态等变化的邮件，调用方需要按邮件ID去重。deltaLink 为空或已失效时从当前时间开始
+func CheckGraphInboxDelta(emailAccount models.EmailAccount, deltaLink string) ([]models.Email, string, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	if deltaLink != "" {
+		emails, next, err := followGraphDelta(client, deltaLink, true)
+		if !errors.Is(err, errGraphDeltaExpired) {
+			return emails, next, err
+		}
+		log.Printf("[CheckGraphInboxDelta] Delta link of account %d expired, restarting from current time", emailAccount.ID)
+	}
+
+	// 初始同步只包含此刻之后收到的邮件，结果丢弃，只保留 deltaLink
+	query := url.Values{}
+	query.Set("$select", graphMessageListFields)
+	query.Set("$filter", "receivedDateTime ge "+time.Now().UTC().Format(time.RFC3339))
+	_, next, err := followGraphDelta(client, graphAPIBaseURL+"v1.0/me/mailFolders/inbox/messages/delta?"+query.Encode(), false)
+	return nil, next, err
+}
+
+// followGraphDelta 依次请求 @odata.nextLink 直到返回 @odata.deltaLink，collect 为 false 时不收集邮件
+func followGraphDelta(client *http.Client, requestURL string, collect bool) ([]models.Email, string, error) {
+	var messages []GraphAPIMessage
+	for requestURL != "" {
+		if !strings.HasPrefix(requestURL, graphAPIBaseURL) {
+			return nil, "", fmt.Errorf("graph api delta link has unexpected host: %s", requestURL)
+		}
+		req, err := http.NewRequest(http.MethodGet, requestURL, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("Prefer", "odata.maxpagesize="+strconv.Itoa(mailWatchMaxMessages))
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to call graph api: %w", err)
+		}
+		if resp.StatusCode == http.StatusGone {
+			resp.Body.Close()
+			return nil, "", errGraphDeltaExpired
+		}
+		var page graphDeltaResponse
+		if err := decodeGraphResponse(resp, &page); err != nil {
+			return nil, "", err
+		}
+		if collect {
+			for _, item := range page.Value {
+				if item.Removed == nil {
+					messages = append(messages, item.GraphAPIMessage)
+				}
+			}
+		}
+		if page.DeltaLink != "" {
+			if len(messages) > mailWatchMaxMessages {
+				messages = messages[len(messages)-mailWatchMaxMessages:]
+			}
+			return graphMessagesToEmails(&GraphAPIResponse{Value: messages}), page.DeltaLink, nil
+		}
+		requestURL = page.NextLink
+	}
+	return nil, "", errors.New("graph api delta response has neither nextLink nor deltaLink")
+}
+
+// GraphMailSubscriptionMaxLifetime 邮件变更通知订阅的有效期，Graph 对邮件资源的上限为 4230 分钟，到期前需要续订
+const GraphMailSubscriptionMaxLifetime = 70 * time.Hour
+
+// graphSubscription Graph 变更通知订阅
+type graphSubscription struct {
+	ID                 string    `json:"id,omitempty"`
+	ChangeType         string    `json:"changeType,omitempty"`
+	NotificationURL    string    `json:"notificationUrl,omitempty"`
+	Resource           string    `json:"resource,omitempty"`
+	ExpirationDateTime time.Time `json:"expirationDateTime"`
+	ClientState        string    `json:"clientState,omitempty"`
+}
+
+// CreateGraphMailSubscription 订阅收件箱的新邮件通知。Graph 创建订阅时会向 notificationURL 发送验证请求
+func CreateGraphMailSubscription(emailAccount models.EmailAccount, notificationURL, clientState string, expires time.Time) (string, time.Time, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	var created graphSubscription
+	err = sendGraphJSON(client, http.MethodPost, graphAPIBaseURL+"v1.0/subscriptions", graphSubscription{
+		ChangeType:         "created",
+		NotificationURL:    notificationURL,
+		Resource:           "me/mailFolders('inbox')/messages",
+		ExpirationDateTime: expires.UTC(),
+		ClientState:        clientState,
+	}, &created)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return created.ID, created.ExpirationDateTime, nil
+}
+
+// RenewGraphMailSubscription 延长订阅的有效期，订阅不存在时返回 ErrMessageNotFound
+func RenewGraphMailSubscription(emailAccount models.EmailAccount, subscriptionID string, expires time.Time) (time.Time, error) {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	var renewed graphSubscription
+	err = sendGraphJSON(client, http.MethodPatch, graphAPIBaseURL+"v1.0/subscriptions/"+url.PathEscape(subscriptionID),
+		graphSubscription{ExpirationDateTime: expires.UTC()}, &renewed)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return renewed.ExpirationDateTime, nil
+}
+
+// DeleteGraphMailSubscription 取消订阅，订阅已不存在时视为成功
+func DeleteGraphMailSubscription(emailAccount models.EmailAccount, subscriptionID string) error {
+	client, err := GetOAuth2HTTPClient(emailAccount.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get oauth2 client: %w", err)
+	}
+	err = sendGraphJSON(client, http.MethodDelete, graphAPIBaseURL+"v1.0/subscriptions/"+url.PathEscape(subscriptionID), nil, nil)
+	if errors.Is(err, ErrMessageNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package integrations
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"email_server/models"
+)
+
+var (
+	// ErrUnsupportedMessageAction 未知的邮件操作类型
+	ErrUnsupportedMessageAction = errors.New("unsupported message action")
+	// ErrMessageNotFound Gmail、Graph 邮件不存在（已删除或ID已失效）
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrFolderNotFound 找不到操作的目标文件夹（如服务器没有归档文件夹）
+	ErrFolderNotFound = errors.New("folder not found")
+	// ErrInsufficientScope 邮箱账户授权的 OAuth 范围不足以执行该操作，需要重新授权
+	ErrInsufficientScope = errors.New("insufficient oauth scope")
+)
+
+// messageActionWorkers 逐封调用服务商 API 时的并发数
+const messageActionWorkers = 4
+
+// 通用文件夹名称，各服务商分别映射到自己的文件夹或标签
+const (
+	folderInbox   = "inbox"
+	folderArchive = "archive"
+	folderTrash   = "trash"
+	folderSpam    = "spam"
+	folderSent    = "sent"
+	folderDrafts  = "drafts"
+)
+
+// genericFolder 将常见的文件夹别名规范化为通用名称，不是通用名称时返回空字符串
+func genericFolder(folder string) string {
+	switch strings.ToLower(strings.TrimSpace(folder)) {
+	case "inbox":
+		return folderInbox
+	case "archive", "archives":
+		return folderArchive
+	case "trash", "deleted", "deleteditems":
+		return folderTrash
+	case "spam", "junk", "junkemail":
+		return folderSpam
+	case "sent", "sentitems":
+		return folderSent
+	case "drafts", "draft":
+		return folderDrafts
+	}
+	return ""
+}
+
+// MessageActionTargetFolder 校验操作并返回目标文件夹（通用名称或服务商侧名称），不需要移动时返回空字符串
+func MessageActionTargetFolder(action, folder string) (string, error) {
+	switch action {
+	case models.MessageActionMove:
+		if strings.TrimSpace(folder) == "" {
+			return "", errors.New("move requires a target folder")
+		}
+		if generic := genericFolder(folder); generic != "" {
+			return generic, nil
+		}
+		return folder, nil
+	case models.MessageActionArchive:
+		return folderArchive, nil
+	case models.MessageActionTrash:
+		return folderTrash, nil
+	case models.MessageActionSpam:
+		return folderSpam, nil
+	case models.MessageActionNotSpam:
+		return folderInbox, nil
+	case models.MessageActionMarkRead, models.MessageActionMarkUnread, models.MessageActionFlag,
+		models.MessageActionUnflag, models.MessageActionDelete:
+		return "", nil
+	}
+	return "", ErrUnsupportedMessageAction
+}
+
+// newMessageActionResults 按请求顺序初始化每封邮件的结果
+func newMessageActionResults(messageIDs []string) []models.MessageActionResult {
+	results := make([]models.MessageActionResult, len(messageIDs))
+	for i, id := range messageIDs {
+		results[i].MessageID = id
+	}
+	return results
+}
+
+// setMessageActionError 记录第 i 封邮件的错误
+func setMessageActionError(results []models.MessageActionResult, i int, err error) {
+	if err != nil {
+		results[i].Error = err.Error()
+		results[i].Err = err
+	}
+}
+
+// forEachMessage 以有限的并发对每封邮件调用 fn
+func forEachMessage(count int, fn func(i int)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, messageActionWorkers)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
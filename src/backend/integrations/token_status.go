@@ -0,0 +1,93 @@
+package integrations
+
+import (
+	"log"
+	"time"
+
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// maxTokenErrorLength 与 user_o_auth_tokens.last_error 列长度一致
+const maxTokenErrorLength = 500
+
+// recordTokenFailure 记录令牌刷新或认证失败，供管理员在系统状态中查看
+func recordTokenFailure(token *models.UserOAuthToken, cause error) {
+	message := cause.Error()
+	if len(message) > maxTokenErrorLength {
+		message = message[:maxTokenErrorLength]
+	}
+	now := time.Now()
+	err := database.DB.Model(&models.UserOAuthToken{}).Where("id = ?", token.ID).UpdateColumns(map[string]interface{}{
+		"failure_count": gorm.Expr("failure_count + 1"),
+		"last_error":    message,
+		"last_error_at": now,
+	}).Error
+	if err != nil {
+		log.Printf("记录 OAuth 令牌 %d 的失败信息失败: %v", token.ID, err)
+		return
+	}
+	token.FailureCount++
+	token.LastError = message
+	token.LastErrorAt = &now
+}
+
+// recordTokenSuccess 令牌刷新或认证成功后清除失败计数
+func recordTokenSuccess(token *models.UserOAuthToken) {
+	if token.FailureCount == 0 {
+		return
+	}
+	err := database.DB.Model(&models.UserOAuthToken{}).Where("id = ?", token.ID).UpdateColumns(map[string]interface{}{
+		"failure_count": 0,
+		"last_error":    "",
+		"last_error_at": nil,
+	}).Error
+	if err != nil {
+		log.Printf("清除 OAuth 令牌 %d 的失败信息失败: %v", token.ID, err)
+		return
+	}
+	token.FailureCount = 0
+	token.LastError = ""
+	token.LastErrorAt = nil
+}
+
+// persistingTokenSource 在令牌刷新后写回数据库，并记录刷新失败
+type persistingTokenSource struct {
+	base        oauth2.TokenSource
+	token       *models.UserOAuthToken
+	accessToken string
+}
+
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	t, err := s.base.Token()
+	if err != nil {
+		recordTokenFailure(s.token, err)
+		return nil, err
+	}
+	if t.AccessToken == s.accessToken {
+		return t, nil
+	}
+
+	// 令牌已刷新，保存新令牌
+	s.accessToken = t.AccessToken
+	updates := map[string]interface{}{"expiry": t.Expiry}
+	if updates["access_token_encrypted"], err = utils.Encrypt([]byte(t.AccessToken)); err != nil {
+		log.Printf("加密刷新后的 access token 失败: %v", err)
+		return t, nil
+	}
+	if t.RefreshToken != "" {
+		if updates["refresh_token_encrypted"], err = utils.Encrypt([]byte(t.RefreshToken)); err != nil {
+			log.Printf("加密刷新后的 refresh token 失败: %v", err)
+			return t, nil
+		}
+	}
+	if err := database.DB.Model(&models.UserOAuthToken{}).Where("id = ?", s.token.ID).Updates(updates).Error; err != nil {
+		log.Printf("保存刷新后的 OAuth 令牌 %d 失败: %v", s.token.ID, err)
+	}
+	recordTokenSuccess(s.token)
+	return t, nil
+}
@@ -0,0 +1,135 @@
+// Package mailer 通过配置的 SMTP 中继发送系统邮件（邮箱验证等）
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"email_server/config"
+)
+
+// ErrNotConfigured 未配置 SMTP_HOST
+var ErrNotConfigured = errors.New("smtp relay is not configured")
+
+// dialTimeout 连接 SMTP 服务器的超时时间
+const dialTimeout = 10 * time.Second
+
+// Sender 发送纯文本邮件
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// Default 系统使用的发件器，测试中可替换
+var Default Sender = SMTPSender{}
+
+// Configured 是否配置了 SMTP 中继
+func Configured() bool {
+	return config.AppConfig != nil && config.AppConfig.SMTP.Host != ""
+}
+
+// SMTPSender 使用 config.AppConfig.SMTP 发送邮件
+type SMTPSender struct{}
+
+// Send 发送一封 UTF-8 纯文本邮件
+func (SMTPSender) Send(to, subject, body string) error {
+	if !Configured() {
+		return ErrNotConfigured
+	}
+	cfg := config.AppConfig.SMTP
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("SMTP_FROM 无效: %w", err)
+	}
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("收件人地址无效: %w", err)
+	}
+
+	client, err := dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP 认证失败: %w", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(recipient.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMessage(from, recipient, subject, body)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// dial 按 TLSMode 建立连接，starttls 模式下服务器不支持 STARTTLS 时拒绝以明文发送
+func dial(cfg config.SMTPConfig) (*smtp.Client, error) {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+
+	if cfg.TLSMode == "tls" {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+		}
+		return smtp.NewClient(conn, cfg.Host)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if cfg.TLSMode == "none" {
+		return client, nil
+	}
+	if ok, _ := client.Extension("STARTTLS"); !ok {
+		client.Close()
+		return nil, errors.New("SMTP 服务器不支持 STARTTLS")
+	}
+	if err := client.StartTLS(tlsConfig); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("STARTTLS 失败: %w", err)
+	}
+	return client, nil
+}
+
+// buildMessage 构造邮件内容，主题按 RFC 2047 编码
+func buildMessage(from, to *mail.Address, subject, body string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(body)
+	return buf.Bytes()
+}
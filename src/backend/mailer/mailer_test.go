@@ -0,0 +1,93 @@
+package mailer
+
+import (
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"email_server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTPServer 接收一封邮件的最小 SMTP 服务器（不支持 STARTTLS），返回收到的命令和邮件内容
+func fakeSMTPServer(t *testing.T) (string, int, <-chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var lines []string
+		tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				break
+			}
+			lines = append(lines, line)
+			switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+			case "EHLO":
+				tp.PrintfLine("250-fake")
+				tp.PrintfLine("250 8BITMIME")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				body, _ := tp.ReadDotLines()
+				lines = append(lines, body...)
+				tp.PrintfLine("250 ok")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				received <- lines
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+		received <- lines
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	return host, portNum, received
+}
+
+func TestSMTPSender_Send(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+	config.AppConfig = &config.Config{SMTP: config.SMTPConfig{
+		Host: host, Port: port, From: "Email Server <noreply@example.com>", TLSMode: "none",
+	}}
+
+	require.NoError(t, SMTPSender{}.Send("dave@example.com", "验证您的邮箱", "第一行\n第二行\n"))
+
+	lines := <-received
+	assert.Contains(t, lines, "MAIL FROM:<noreply@example.com> BODY=8BITMIME")
+	assert.Contains(t, lines, "RCPT TO:<dave@example.com>")
+	assert.Contains(t, lines, "Subject: =?utf-8?q?=E9=AA=8C=E8=AF=81=E6=82=A8=E7=9A=84=E9=82=AE=E7=AE=B1?=")
+	assert.Contains(t, lines, "Content-Type: text/plain; charset=UTF-8")
+	assert.Contains(t, lines, "第二行")
+}
+
+func TestSMTPSender_RequiresSTARTTLS(t *testing.T) {
+	host, port, _ := fakeSMTPServer(t)
+	config.AppConfig = &config.Config{SMTP: config.SMTPConfig{
+		Host: host, Port: port, From: "noreply@example.com", TLSMode: "starttls",
+	}}
+
+	err := SMTPSender{}.Send("dave@example.com", "subject", "body")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "STARTTLS")
+}
+
+func TestSMTPSender_NotConfigured(t *testing.T) {
+	config.AppConfig = &config.Config{}
+	assert.ErrorIs(t, SMTPSender{}.Send("dave@example.com", "subject", "body"), ErrNotConfigured)
+}
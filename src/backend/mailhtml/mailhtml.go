@@ -0,0 +1,593 @@
+// Package mailhtml 按白名单清理邮件的 HTML 正文：移除脚本、事件属性、javascript: 链接、表单和嵌入内容，
+// 并阻止或改写远程图片、样式中的 url() 和 image-set()，避免打开邮件时向发件人泄露已读状态或页面内容。
+// <style> 中的规则限制在邮件容器内，不能影响页面的其他部分。
+package mailhtml
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 被阻止资源的类型
+const (
+	ResourceImage      = "image"
+	ResourceStylesheet = "stylesheet"
+	ResourceScript     = "script"
+	ResourceForm       = "form"
+	ResourceFrame      = "frame"
+	ResourceObject     = "object"
+	ResourceMedia      = "media"
+)
+
+// maxBlocked 最多记录的被阻止资源数量
+const maxBlocked = 100
+
+// Resource 被阻止的资源
+type Resource struct {
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
+}
+
+// Options 清理选项
+type Options struct {
+	// ProxyImage 不为 nil 时远程图片改写为它返回的地址（图片代理）；为 nil 时远程图片被阻止
+	ProxyImage func(remote string) string
+	// LocalPrefixes 允许保留的站内地址前缀，例如附件下载地址
+	LocalPrefixes []string
+	// StyleScope 显示邮件的容器的选择器，<style> 中的规则只作用于该容器内；为空时移除 <style>
+	StyleScope string
+}
+
+// Result 清理结果
+type Result struct {
+	HTML    string
+	Blocked []Resource
+}
+
+// allowedElements 保留的元素，其余元素去掉标签只保留内容
+var allowedElements = map[atom.Atom]bool{
+	atom.A: true, atom.Abbr: true, atom.Address: true, atom.Article: true, atom.Aside: true,
+	atom.B: true, atom.Bdi: true, atom.Bdo: true, atom.Big: true, atom.Blockquote: true, atom.Br: true,
+	atom.Caption: true, atom.Center: true, atom.Cite: true, atom.Code: true, atom.Col: true, atom.Colgroup: true,
+	atom.Dd: true, atom.Del: true, atom.Details: true, atom.Dfn: true, atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Em: true, atom.Figcaption: true, atom.Figure: true, atom.Font: true, atom.Footer: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Header: true, atom.Hr: true, atom.I: true, atom.Img: true, atom.Ins: true, atom.Kbd: true,
+	atom.Li: true, atom.Main: true, atom.Mark: true, atom.Nav: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Q: true, atom.S: true, atom.Samp: true, atom.Section: true, atom.Small: true, atom.Span: true,
+	atom.Strike: true, atom.Strong: true, atom.Style: true, atom.Sub: true, atom.Summary: true, atom.Sup: true,
+	atom.Table: true, atom.Tbody: true, atom.Td: true, atom.Tfoot: true, atom.Th: true, atom.Thead: true,
+	atom.Time: true, atom.Tr: true, atom.Tt: true, atom.U: true, atom.Ul: true, atom.Var: true, atom.Wbr: true,
+}
+
+// droppedElements 连同内容一起移除的元素，值为记录的资源类型（空字符串表示不记录）
+var droppedElements = map[atom.Atom]string{
+	atom.Script: ResourceScript, atom.Noscript: "", atom.Template: "",
+	atom.Iframe: ResourceFrame, atom.Frame: ResourceFrame, atom.Frameset: ResourceFrame,
+	atom.Object: ResourceObject, atom.Embed: ResourceObject, atom.Applet: ResourceObject,
+	atom.Audio: ResourceMedia, atom.Video: ResourceMedia, atom.Source: ResourceMedia, atom.Track: ResourceMedia,
+	atom.Svg: "", atom.Math: "", atom.Canvas: "", atom.Dialog: "",
+	atom.Title: "", atom.Meta: "", atom.Base: "", atom.Link: "",
+	atom.Input: "", atom.Button: "", atom.Select: "", atom.Option: "", atom.Optgroup: "", atom.Textarea: "",
+	atom.Datalist: "", atom.Output: "", atom.Keygen: "",
+}
+
+// allowedAttributes 保留的属性；href、src、background、style 单独处理
+var allowedAttributes = map[string]bool{
+	"align": true, "alt": true, "bgcolor": true, "border": true, "cellpadding": true, "cellspacing": true,
+	"class": true, "color": true, "cols": true, "colspan": true, "dir": true, "face": true, "headers": true,
+	"height": true, "hspace": true, "lang": true, "nowrap": true, "rows": true, "rowspan": true, "scope": true,
+	"size": true, "span": true, "start": true, "summary": true, "title": true, "type": true, "valign": true,
+	"vspace": true, "width": true, "datetime": true, "open": true, "reversed": true,
+}
+
+// safeDataImage 允许内嵌的 data: 图片（不包括 SVG）
+var safeDataImage = regexp.MustCompile(`(?i)^data:image/(png|jpe?g|gif|webp|bmp);base64,[a-z0-9+/=\s]+$`)
+
+// sanitizer 一次清理的状态
+type sanitizer struct {
+	opts    Options
+	blocked []Resource
+	seen    map[Resource]bool
+}
+
+// Sanitize 清理邮件 HTML，返回可以直接嵌入页面的片段和被阻止的资源列表
+func Sanitize(input string, opts Options) Result {
+	if strings.TrimSpace(input) == "" {
+		return Result{}
+	}
+	doc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		return Result{}
+	}
+	s := &sanitizer{opts: opts, seen: map[Resource]bool{}}
+
+	// <head> 中只保留 <style>，放在正文之前
+	var nodes []*html.Node
+	if head := findElement(doc, atom.Head); head != nil {
+		for c := head.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if c.DataAtom == atom.Style {
+				nodes = append(nodes, c)
+			} else {
+				s.blockDropped(c)
+			}
+		}
+	}
+	if body := findElement(doc, atom.Body); body != nil {
+		for c := body.FirstChild; c != nil; c = c.NextSibling {
+			nodes = append(nodes, c)
+		}
+	}
+
+	container := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	for _, n := range nodes {
+		n.Parent.RemoveChild(n)
+		container.AppendChild(n)
+	}
+	s.sanitizeChildren(container)
+
+	var buf bytes.Buffer
+	for c := container.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&buf, c); err != nil {
+			return Result{Blocked: s.blocked}
+		}
+	}
+	return Result{HTML: buf.String(), Blocked: s.blocked}
+}
+
+// findElement 深度优先查找第一个指定元素
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// block 记录被阻止的资源
+func (s *sanitizer) block(kind, url string) {
+	r := Resource{Type: kind, URL: url}
+	if s.seen[r] || len(s.blocked) >= maxBlocked {
+		return
+	}
+	s.seen[r] = true
+	s.blocked = append(s.blocked, r)
+}
+
+// blockDropped 记录被移除元素引用的外部资源
+func (s *sanitizer) blockDropped(n *html.Node) {
+	if n.DataAtom == atom.Link {
+		if strings.Contains(strings.ToLower(attr(n, "rel")), "stylesheet") {
+			s.block(ResourceStylesheet, attr(n, "href"))
+		}
+		return
+	}
+	if kind := droppedElements[n.DataAtom]; kind != "" {
+		s.block(kind, firstNonEmpty(attr(n, "src"), attr(n, "data"), attr(n, "code")))
+	}
+}
+
+// sanitizeChildren 清理 n 的所有子节点
+func (s *sanitizer) sanitizeChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		s.sanitizeNode(c)
+		c = next
+	}
+}
+
+// sanitizeNode 清理单个节点，可能将其移除或替换为其子节点
+func (s *sanitizer) sanitizeNode(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		return
+	case html.ElementNode:
+	default:
+		// 注释（包括 IE 条件注释）、DOCTYPE 等一律移除
+		n.Parent.RemoveChild(n)
+		return
+	}
+
+	if _, drop := droppedElements[n.DataAtom]; drop {
+		s.blockDropped(n)
+		n.Parent.RemoveChild(n)
+		return
+	}
+	if n.DataAtom == atom.Form {
+		// 表单可能把输入内容提交到外部地址，只保留其中的文字
+		s.block(ResourceForm, attr(n, "action"))
+		s.sanitizeChildren(n)
+		unwrap(n)
+		return
+	}
+	if n.DataAtom == atom.Style {
+		s.sanitizeStyleElement(n)
+		return
+	}
+	if !allowedElements[n.DataAtom] || n.Namespace != "" {
+		s.sanitizeChildren(n)
+		unwrap(n)
+		return
+	}
+
+	s.sanitizeAttributes(n)
+	s.sanitizeChildren(n)
+}
+
+// sanitizeStyleElement 清理 <style> 中的 CSS，只保留文字内容
+func (s *sanitizer) sanitizeStyleElement(n *html.Node) {
+	var css strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			css.WriteString(c.Data)
+		}
+	}
+	for n.FirstChild != nil {
+		n.RemoveChild(n.FirstChild)
+	}
+	n.Attr = nil
+	if s.opts.StyleScope == "" {
+		n.Parent.RemoveChild(n)
+		return
+	}
+	cleaned := scopeCSS(s.sanitizeCSS(css.String()), s.opts.StyleScope)
+	// <style> 的内容按原样输出，不能出现 "<" 以免提前结束元素
+	cleaned = strings.ReplaceAll(cleaned, "<", "")
+	if strings.TrimSpace(cleaned) == "" {
+		n.Parent.RemoveChild(n)
+		return
+	}
+	n.AppendChild(&html.Node{Type: html.TextNode, Data: cleaned})
+}
+
+// sanitizeAttributes 按白名单过滤属性
+func (s *sanitizer) sanitizeAttributes(n *html.Node) {
+	attrs := make([]html.Attribute, 0, len(n.Attr))
+	hasLink := false
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		if a.Namespace != "" {
+			continue
+		}
+		switch {
+		case key == "href" && n.DataAtom == atom.A:
+			if href, ok := safeLink(a.Val); ok {
+				attrs = append(attrs, html.Attribute{Key: key, Val: href})
+				hasLink = !strings.HasPrefix(href, "#")
+			}
+		case key == "src" && n.DataAtom == atom.Img, key == "background":
+			if src, ok := s.imageURL(a.Val); ok {
+				attrs = append(attrs, html.Attribute{Key: key, Val: src})
+			}
+		case key == "style":
+			if css := strings.TrimSpace(s.sanitizeCSS(a.Val)); css != "" {
+				attrs = append(attrs, html.Attribute{Key: key, Val: css})
+			}
+		case allowedAttributes[key]:
+			attrs = append(attrs, html.Attribute{Key: key, Val: a.Val})
+		}
+	}
+	if hasLink {
+		// 在新窗口打开外部链接，不泄露来源页面
+		attrs = append(attrs,
+			html.Attribute{Key: "target", Val: "_blank"},
+			html.Attribute{Key: "rel", Val: "noopener noreferrer nofollow"})
+	}
+	n.Attr = attrs
+}
+
+// safeLink 只保留 http、https、mailto、tel 链接和页内锚点
+func safeLink(raw string) (string, bool) {
+	href := strings.TrimSpace(raw)
+	lower := strings.ToLower(stripControl(href))
+	switch {
+	case strings.HasPrefix(lower, "http://"), strings.HasPrefix(lower, "https://"),
+		strings.HasPrefix(lower, "mailto:"), strings.HasPrefix(lower, "tel:"):
+		return href, true
+	case strings.HasPrefix(href, "#"):
+		return href, true
+	}
+	return "", false
+}
+
+// imageURL 处理图片地址：内嵌 data 图片和站内地址保留，远程图片改写为代理地址或阻止，其余地址移除
+func (s *sanitizer) imageURL(raw string) (string, bool) {
+	src := strings.TrimSpace(raw)
+	lower := strings.ToLower(stripControl(src))
+	switch {
+	case src == "":
+		return "", false
+	case safeDataImage.MatchString(src):
+		return src, true
+	case strings.HasPrefix(src, "//"):
+		src, lower = "https:"+src, "https:"+lower
+	}
+	for _, prefix := range s.opts.LocalPrefixes {
+		if strings.HasPrefix(src, prefix) {
+			return src, true
+		}
+	}
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		if s.opts.ProxyImage != nil {
+			return s.opts.ProxyImage(src), true
+		}
+		s.block(ResourceImage, src)
+	}
+	return "", false
+}
+
+// stripControl 去掉空白和控制字符，浏览器解析 "java\tscript:" 时会忽略这些字符
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+var (
+	cssComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssEscape  = regexp.MustCompile(`\\([0-9a-fA-F]{1,6}\s?|.)`)
+	cssImport  = regexp.MustCompile(`(?i)@import\s+(?:url\(\s*)?["']?([^"');\s]*)["']?\s*\)?[^;]*;?`)
+	// cssURL 浏览器在缺少右括号或右引号时读到声明末尾，仍会加载其中的地址
+	cssURL      = regexp.MustCompile(`(?i)url\(\s*(?:"([^"\n]*)"?|'([^'\n]*)'?|([^)]*))\s*\)?`)
+	cssImageSet = regexp.MustCompile(`(?i)(?:-webkit-)?image-set\(`)
+	// cssFixed 固定定位的元素可以覆盖整个页面
+	cssFixed = regexp.MustCompile(`(?i)(position\s*:\s*)fixed`)
+	// cssDangerous 旧版浏览器可执行脚本的 CSS
+	cssDangerous = regexp.MustCompile(`(?i)expression\s*\(|behavior\s*:|-moz-binding|javascript:|vbscript:`)
+)
+
+// sanitizeCSS 清理样式：移除 @import 和可执行脚本的写法，url() 和 image-set() 中的远程地址按图片规则处理，
+// 固定定位改为普通定位
+func (s *sanitizer) sanitizeCSS(css string) string {
+	css = cssComment.ReplaceAllString(css, "")
+	// 转义序列可以绕过关键字检查（如 u\72l(），先还原为原字符
+	css = cssEscape.ReplaceAllStringFunc(css, unescapeCSS)
+	css = cssImport.ReplaceAllStringFunc(css, func(rule string) string {
+		s.block(ResourceStylesheet, cssImport.FindStringSubmatch(rule)[1])
+		return ""
+	})
+	css = cssURL.ReplaceAllStringFunc(css, func(ref string) string {
+		m := cssURL.FindStringSubmatch(ref)
+		return s.cssImage(m[1] + m[2] + strings.TrimSpace(m[3]))
+	})
+	css = s.rewriteImageSets(css)
+	css = cssFixed.ReplaceAllString(css, "${1}static")
+	return cssDangerous.ReplaceAllString(css, "")
+}
+
+// cssImage 返回处理后的 url()，地址不允许时返回 none
+func (s *sanitizer) cssImage(raw string) string {
+	if src, ok := s.imageURL(raw); ok {
+		return `url("` + strings.NewReplacer(`"`, "%22", `\`, "%5C", "\n", "", "\r", "").Replace(src) + `")`
+	}
+	return "none"
+}
+
+// rewriteImageSets image-set() 的参数可以直接用字符串表示图片地址，这些字符串按 url() 的规则改写
+func (s *sanitizer) rewriteImageSets(css string) string {
+	var out strings.Builder
+	for {
+		loc := cssImageSet.FindStringIndex(css)
+		if loc == nil {
+			out.WriteString(css)
+			return out.String()
+		}
+		out.WriteString(css[:loc[1]])
+		css = css[loc[1]:]
+		i, depth := 0, 1
+		for i < len(css) && depth > 0 {
+			switch css[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			case '"', '\'':
+				end := cssStringEnd(css, i)
+				if depth == 1 {
+					out.WriteString(css[:i])
+					out.WriteString(s.cssImage(strings.Trim(css[i:end], `"'`)))
+					css, i = css[end:], 0
+				} else {
+					i = end
+				}
+				continue
+			}
+			i++
+		}
+		out.WriteString(css[:i])
+		css = css[i:]
+	}
+}
+
+// cssStringEnd 返回从 start 处的引号开始的字符串之后的位置，未闭合的字符串在换行处结束。
+// 转义序列此时已经还原，不再需要处理反斜杠
+func cssStringEnd(css string, start int) int {
+	for i := start + 1; i < len(css); i++ {
+		switch css[i] {
+		case css[start]:
+			return i + 1
+		case '\n':
+			return i
+		}
+	}
+	return len(css)
+}
+
+var (
+	// cssRootSelector 选择器开头的 html、:root 和 body，替换为邮件容器
+	cssRootSelector = regexp.MustCompile(`(?i)^(?:html|:root|body)(?:\s*>\s*|\s+|$)`)
+	cssAtRuleName   = regexp.MustCompile(`^@[-a-zA-Z]+`)
+)
+
+// scopeCSS 把样式规则限制在 scope 内：每个选择器前加上 scope，开头的 html/body 替换为 scope。
+// @media 和 @supports 中的规则同样处理，其他 @ 规则（@font-face、@keyframes 等会影响整个页面）移除
+func scopeCSS(css, scope string) string {
+	var out strings.Builder
+	for i := 0; i < len(css); {
+		end := cssPreludeEnd(css, i)
+		prelude := strings.TrimSpace(css[i:end])
+		if end == len(css) || css[end] != '{' {
+			// 没有规则体的语句（@charset、多余的分号或右括号）直接丢弃
+			i = end + 1
+			continue
+		}
+		blockEnd := cssBlockEnd(css, end+1)
+		block := css[end+1 : blockEnd]
+		i = blockEnd + 1
+		if strings.HasPrefix(prelude, "@") {
+			if name := strings.ToLower(cssAtRuleName.FindString(prelude)); name == "@media" || name == "@supports" {
+				out.WriteString(prelude + "{" + scopeCSS(block, scope) + "}")
+			}
+			continue
+		}
+		selectors := splitSelectors(prelude)
+		for j, sel := range selectors {
+			selectors[j] = scopeSelector(sel, scope)
+		}
+		out.WriteString(strings.Join(selectors, ",") + "{" + block + "}")
+	}
+	return out.String()
+}
+
+// scopeSelector 把单个选择器限制在 scope 内
+func scopeSelector(sel, scope string) string {
+	sel = strings.TrimSpace(sel)
+	for {
+		loc := cssRootSelector.FindStringIndex(sel)
+		if loc == nil || loc[1] == 0 {
+			break
+		}
+		sel = sel[loc[1]:]
+	}
+	if sel == "" {
+		return scope
+	}
+	return scope + " " + sel
+}
+
+// splitSelectors 按顶层的逗号拆分选择器列表，括号和字符串中的逗号不拆分
+func splitSelectors(prelude string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(prelude); i++ {
+		switch prelude[i] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case '"', '\'':
+			i = cssStringEnd(prelude, i) - 1
+		case ',':
+			if depth == 0 {
+				parts = append(parts, prelude[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, prelude[start:])
+}
+
+// cssPreludeEnd 返回从 start 开始的第一个顶层 "{"、";" 或 "}" 的位置，没有时返回 len(css)
+func cssPreludeEnd(css string, start int) int {
+	depth := 0
+	for i := start; i < len(css); i++ {
+		switch css[i] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case '"', '\'':
+			i = cssStringEnd(css, i) - 1
+		case '{', ';', '}':
+			if depth <= 0 {
+				return i
+			}
+		}
+	}
+	return len(css)
+}
+
+// cssBlockEnd 返回与 start 之前的 "{" 匹配的 "}" 的位置，未闭合时返回 len(css)
+func cssBlockEnd(css string, start int) int {
+	depth := 1
+	for i := start; i < len(css); i++ {
+		switch css[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		case '"', '\'':
+			i = cssStringEnd(css, i) - 1
+		}
+	}
+	return len(css)
+}
+
+// unescapeCSS 还原单个 CSS 转义序列，无效的码点直接去掉
+func unescapeCSS(esc string) string {
+	body := strings.TrimRight(esc[1:], " \t\r\n\f")
+	if body == "" {
+		// 反斜杠加换行表示续行
+		return ""
+	}
+	code, err := strconv.ParseUint(body, 16, 32)
+	if err != nil {
+		if body == `\` {
+			return ""
+		}
+		return body
+	}
+	// 还原出的反斜杠会和后面的字符组成新的转义序列（如 \\75rl( 还原后是 \75rl(），直接去掉
+	if r := rune(code); r != 0 && r != '\\' && utf8.ValidRune(r) {
+		return string(r)
+	}
+	return ""
+}
+
+// unwrap 用子节点替换 n
+func unwrap(n *html.Node) {
+	parent := n.Parent
+	for n.FirstChild != nil {
+		c := n.FirstChild
+		n.RemoveChild(c)
+		parent.InsertBefore(c, n)
+	}
+	parent.RemoveChild(n)
+}
+
+// attr 返回属性值
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+package mailhtml
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitize_RemovesScriptsAndHandlers(t *testing.T) {
+	res := Sanitize(`<html><head><title>t</title><script src="https://evil.example/a.js"></script></head>
+<body onload="steal()"><p onclick="x()" style="color:red">Hi <b>there</b></p>
+<iframe src="https://evil.example/frame"></iframe><!-- hidden --><svg><script>1</script></svg>
+<a href="javascript:alert(1)">bad</a><a href=" JaVa&#x09;script:alert(1)">bad2</a>
+<a href="https://example.com/x">good</a><a href="#top">top</a><unknown-tag>kept text</unknown-tag></body></html>`, Options{})
+
+	assert.NotContains(t, res.HTML, "script")
+	assert.NotContains(t, res.HTML, "onclick")
+	assert.NotContains(t, res.HTML, "onload")
+	assert.NotContains(t, res.HTML, "iframe")
+	assert.NotContains(t, res.HTML, "hidden")
+	assert.NotContains(t, res.HTML, "javascript")
+	assert.Contains(t, res.HTML, `<p style="color:red">Hi <b>there</b></p>`)
+	assert.Contains(t, res.HTML, `<a>bad</a>`)
+	assert.Contains(t, res.HTML, `<a href="https://example.com/x" target="_blank" rel="noopener noreferrer nofollow">good</a>`)
+	assert.Contains(t, res.HTML, `<a href="#top">top</a>`)
+	assert.Contains(t, res.HTML, "kept text")
+	assert.NotContains(t, res.HTML, "unknown-tag")
+	assert.Equal(t, []Resource{
+		{Type: ResourceScript, URL: "https://evil.example/a.js"},
+		{Type: ResourceFrame, URL: "https://evil.example/frame"},
+	}, res.Blocked)
+}
+
+func TestSanitize_UnwrapsForms(t *testing.T) {
+	res := Sanitize(`<form action="https://phish.example/login">Password: <input name="p"><button>Go</button></form>`, Options{})
+	assert.Equal(t, "Password: ", res.HTML)
+	assert.Equal(t, []Resource{{Type: ResourceForm, URL: "https://phish.example/login"}}, res.Blocked)
+}
+
+func TestSanitize_BlocksRemoteImagesByDefault(t *testing.T) {
+	res := Sanitize(`<img src="https://tracker.example/open.gif?id=1" alt="x">
+<img src="https://tracker.example/open.gif?id=1">
+<img src="//cdn.example/logo.png">
+<img src="data:image/png;base64,iVBORw0KGgo=">
+<img src="data:image/svg+xml;base64,PHN2Zz4=">
+<img src="/api/v1/inbox/emails/1/attachments/2?token=t">
+<table><tr><td background="http://cdn.example/bg.jpg">cell</td></tr></table>`, Options{LocalPrefixes: []string{"/api/v1/inbox/emails/"}})
+
+	assert.Contains(t, res.HTML, `<img alt="x"/>`)
+	assert.Contains(t, res.HTML, `<img src="data:image/png;base64,iVBORw0KGgo="/>`)
+	assert.Contains(t, res.HTML, `<img src="/api/v1/inbox/emails/1/attachments/2?token=t"/>`)
+	assert.NotContains(t, res.HTML, "svg")
+	assert.NotContains(t, res.HTML, "tracker.example")
+	assert.NotContains(t, res.HTML, "cdn.example")
+	assert.Equal(t, []Resource{
+		{Type: ResourceImage, URL: "https://tracker.example/open.gif?id=1"},
+		{Type: ResourceImage, URL: "https://cdn.example/logo.png"},
+		{Type: ResourceImage, URL: "http://cdn.example/bg.jpg"},
+	}, res.Blocked, "重复的地址只记录一次")
+}
+
+func TestSanitize_ProxiesRemoteImages(t *testing.T) {
+	proxy := func(remote string) string { return "/proxy?url=" + url.QueryEscape(remote) }
+	res := Sanitize(`<img src="https://cdn.example/a.png"><div style="background:url('https://cdn.example/b.png')">x</div>`,
+		Options{ProxyImage: proxy})
+
+	assert.Contains(t, res.HTML, `<img src="/proxy?url=https%3A%2F%2Fcdn.example%2Fa.png"/>`)
+	assert.Contains(t, res.HTML, `background:url(&#34;/proxy?url=https%3A%2F%2Fcdn.example%2Fb.png&#34;)`)
+	assert.Empty(t, res.Blocked)
+}
+
+func TestSanitize_CSS(t *testing.T) {
+	res := Sanitize(`<html><head><style>@import url("https://evil.example/a.css");
+body { background: u\72l(https://tracker.example/bg.png) } p { width: expression(alert(1)) }
+</style><style></style></head><body><style>a{color:red}</style><p style="behavior:url(x.htc);color:blue">t</p></body></html>`, Options{StyleScope: ".mail"})
+
+	assert.True(t, strings.HasPrefix(res.HTML, "<style>"), "head 中的样式保留在正文之前: %s", res.HTML)
+	assert.NotContains(t, res.HTML, "@import")
+	assert.NotContains(t, res.HTML, "expression")
+	assert.NotContains(t, res.HTML, "behavior")
+	assert.NotContains(t, res.HTML, "tracker.example")
+	assert.Contains(t, res.HTML, "background: none")
+	assert.Contains(t, res.HTML, "<style>.mail a{color:red}</style>")
+	assert.Contains(t, res.HTML, `color:blue`)
+	assert.Equal(t, 2, strings.Count(res.HTML, "<style>"), "空的 <style> 被移除")
+	assert.Equal(t, []Resource{
+		{Type: ResourceStylesheet, URL: "https://evil.example/a.css"},
+		{Type: ResourceImage, URL: "https://tracker.example/bg.png"},
+	}, res.Blocked)
+}
+
+func TestSanitize_StyleCannotCloseElement(t *testing.T) {
+	res := Sanitize(`<style>p{content:"</style><script>alert(1)</script>"}</style>`, Options{})
+	assert.NotContains(t, res.HTML, "<script")
+}
+
+func TestSanitize_Empty(t *testing.T) {
+	assert.Equal(t, Result{}, Sanitize("  ", Options{}))
+}
+
+func TestSanitize_CSSUnclosedURL(t *testing.T) {
+	res := Sanitize(`<p style="background:url(https://track.example/p.gif">a</p><p style='background:url("https://track.example/q.gif'>b</p>`, Options{})
+	assert.NotContains(t, res.HTML, "track.example")
+	assert.Equal(t, []Resource{
+		{Type: ResourceImage, URL: "https://track.example/p.gif"},
+		{Type: ResourceImage, URL: "https://track.example/q.gif"},
+	}, res.Blocked)
+}
+
+func TestSanitize_CSSImageSet(t *testing.T) {
+	res := Sanitize(`<p style="background-image:image-set('https://track.example/b.gif' 1x, url(https://track.example/c.gif) 2x)">a</p>
+<p style="background-image:-webkit-image-set(&quot;//track.example/d.gif&quot; 1x)">b</p>`, Options{})
+	assert.NotContains(t, res.HTML, "track.example")
+	assert.Equal(t, []Resource{
+		{Type: ResourceImage, URL: "https://track.example/c.gif"},
+		{Type: ResourceImage, URL: "https://track.example/b.gif"},
+		{Type: ResourceImage, URL: "https://track.example/d.gif"},
+	}, res.Blocked)
+
+	proxy := func(remote string) string { return "/proxy?url=" + url.QueryEscape(remote) }
+	res = Sanitize(`<p style="background-image:image-set('https://cdn.example/b.png' 1x)">a</p>`, Options{ProxyImage: proxy})
+	assert.Contains(t, res.HTML, `image-set(url(&#34;/proxy?url=https%3A%2F%2Fcdn.example%2Fb.png&#34;) 1x)`)
+}
+
+func TestSanitize_CSSEscapedBackslash(t *testing.T) {
+	// \\75 还原后不能再组成 \75（即 u）
+	res := Sanitize(`<p style="background:\\75rl(https://track.example/e.gif)">a</p>`, Options{})
+	assert.NotContains(t, res.HTML, `\`)
+}
+
+func TestSanitize_StyleScope(t *testing.T) {
+	res := Sanitize(`<style>
+body{display:none} html > body p, .a:is(.b, .c){color:red} :root{--x:1}
+@media (max-width: 600px) { body td { width:100% } }
+@font-face { font-family: Arial; src: url(data:font/woff2;base64,AAAA) }
+@keyframes spin { to { transform: rotate(1turn) } }
+.overlay{position:fixed;top:0;left:0}
+</style><p>t</p>`, Options{StyleScope: ".mail"})
+	assert.Contains(t, res.HTML, ".mail{display:none}")
+	assert.Contains(t, res.HTML, ".mail p,.mail .a:is(.b, .c){color:red}")
+	assert.Contains(t, res.HTML, ".mail{--x:1}")
+	assert.Contains(t, res.HTML, "@media (max-width: 600px){.mail td{ width:100% }}")
+	assert.Contains(t, res.HTML, ".mail .overlay{position:static;top:0;left:0}")
+	assert.NotContains(t, res.HTML, "@font-face")
+	assert.NotContains(t, res.HTML, "@keyframes")
+
+	res = Sanitize(`<style>body{display:none}</style><p style="position: FIXED; inset:0">t</p>`, Options{})
+	assert.Equal(t, `<p style="position: static; inset:0">t</p>`, res.HTML, "未指定 StyleScope 时移除 <style>")
+}
@@ -0,0 +1,279 @@
+// Package mailquery 解析邮箱搜索使用的简单查询语言，并转换为 IMAP SEARCH 条件、Gmail 的 q 参数和 Graph 的 $search / $filter。
+//
+// 支持的写法：from:、to:、subject:、has:attachment、is:unread、is:read、before:、after: 和自由文本，
+// 值中有空格时用双引号括起来，如 from:"John Doe"。多个条件之间是“与”的关系。
+// 日期格式为 2006-01-02 或 2006/01/02，after: 包含当天，before: 不包含当天。
+package mailquery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// MaxLength 查询字符串的长度上限
+const MaxLength = 1000
+
+// Query 解析后的查询条件
+type Query struct {
+	From    []string
+	To      []string
+	Subject []string
+	Text    []string // 自由文本，匹配主题、正文和地址
+
+	HasAttachment bool
+	Unread        bool // is:unread
+	Read          bool // is:read
+
+	After  time.Time // 收到日期不早于该日（含当天），零值表示不限
+	Before time.Time // 收到日期早于该日（不含当天），零值表示不限
+}
+
+var dateLayouts = []string{"2006-01-02", "2006/01/02"}
+
+// Parse 解析查询字符串。未知的 key: 前缀按自由文本处理，不支持的 has:、is: 取值和无效日期返回错误
+func Parse(input string) (Query, error) {
+	var q Query
+	if len(input) > MaxLength {
+		return q, fmt.Errorf("查询过长，最多 %d 个字符", MaxLength)
+	}
+	for _, token := range tokenize(input) {
+		key, value, hasKey := strings.Cut(token.raw, ":")
+		if !hasKey || token.quotedKey {
+			q.Text = append(q.Text, token.text())
+			continue
+		}
+		value = strings.ReplaceAll(value, `"`, "")
+		switch strings.ToLower(key) {
+		case "from":
+			q.From = appendValue(q.From, value)
+		case "to":
+			q.To = appendValue(q.To, value)
+		case "subject":
+			q.Subject = appendValue(q.Subject, value)
+		case "has":
+			if !strings.EqualFold(value, "attachment") {
+				return q, fmt.Errorf("不支持的条件 has:%s", value)
+			}
+			q.HasAttachment = true
+		case "is":
+			switch strings.ToLower(value) {
+			case "unread":
+				q.Unread = true
+			case "read":
+				q.Read = true
+			default:
+				return q, fmt.Errorf("不支持的条件 is:%s", value)
+			}
+		case "before", "after":
+			date, err := parseDate(value)
+			if err != nil {
+				return q, fmt.Errorf("无效的日期 %s:%s", key, value)
+			}
+			if strings.EqualFold(key, "before") {
+				q.Before = date
+			} else {
+				q.After = date
+			}
+		default:
+			q.Text = append(q.Text, token.text())
+		}
+	}
+	if q.Unread && q.Read {
+		return q, errors.New("is:unread 和 is:read 不能同时使用")
+	}
+	return q, nil
+}
+
+// Empty 没有任何条件
+func (q Query) Empty() bool {
+	return len(q.From) == 0 && len(q.To) == 0 && len(q.Subject) == 0 && len(q.Text) == 0 &&
+		!q.HasAttachment && !q.Unread && !q.Read && q.After.IsZero() && q.Before.IsZero()
+}
+
+// token 查询中的一个词；quotedKey 表示冒号出现在引号内，不作为条件前缀
+type token struct {
+	raw       string
+	quotedKey bool
+}
+
+// text 作为自由文本时去掉引号
+func (t token) text() string {
+	return strings.ReplaceAll(t.raw, `"`, "")
+}
+
+// tokenize 按空白分词，双引号内的空白不分词
+func tokenize(input string) []token {
+	var tokens []token
+	var b strings.Builder
+	inQuotes, quotedKey := false, false
+	flush := func() {
+		if strings.Trim(b.String(), `"`) != "" {
+			tokens = append(tokens, token{raw: b.String(), quotedKey: quotedKey})
+		}
+		b.Reset()
+		quotedKey = false
+	}
+	for _, r := range input {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			b.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuotes:
+			flush()
+		default:
+			if r == ':' && inQuotes && !strings.Contains(b.String(), ":") {
+				quotedKey = true
+			}
+			b.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func appendValue(values []string, value string) []string {
+	if value = strings.TrimSpace(value); value != "" {
+		values = append(values, value)
+	}
+	return values
+}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid date")
+}
+
+// IMAPCriteria 转换为 IMAP SEARCH 条件。IMAP 没有附件条件，has:attachment 按 multipart/mixed 的 Content-Type 近似匹配
+func (q Query) IMAPCriteria() *imap.SearchCriteria {
+	criteria := &imap.SearchCriteria{Text: q.Text}
+	for _, v := range q.From {
+		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: "From", Value: v})
+	}
+	for _, v := range q.To {
+		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: "To", Value: v})
+	}
+	for _, v := range q.Subject {
+		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: "Subject", Value: v})
+	}
+	if q.HasAttachment {
+		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: "Content-Type", Value: "multipart/mixed"})
+	}
+	if q.Unread {
+		criteria.NotFlag = append(criteria.NotFlag, imap.FlagSeen)
+	}
+	if q.Read {
+		criteria.Flag = append(criteria.Flag, imap.FlagSeen)
+	}
+	criteria.Since = q.After
+	criteria.Before = q.Before
+	return criteria
+}
+
+// Gmail 转换为 Gmail 搜索语法（messages.list 的 q 参数）
+func (q Query) Gmail() string {
+	var parts []string
+	add := func(prefix string, values []string) {
+		for _, v := range values {
+			parts = append(parts, prefix+gmailQuote(v))
+		}
+	}
+	add("from:", q.From)
+	add("to:", q.To)
+	add("subject:", q.Subject)
+	if q.HasAttachment {
+		parts = append(parts, "has:attachment")
+	}
+	if q.Unread {
+		parts = append(parts, "is:unread")
+	}
+	if q.Read {
+		parts = append(parts, "is:read")
+	}
+	if !q.After.IsZero() {
+		parts = append(parts, "after:"+q.After.Format("2006/01/02"))
+	}
+	if !q.Before.IsZero() {
+		parts = append(parts, "before:"+q.Before.Format("2006/01/02"))
+	}
+	add("", q.Text)
+	return strings.Join(parts, " ")
+}
+
+func gmailQuote(v string) string {
+	if strings.ContainsAny(v, " \t()") {
+		return `"` + v + `"`
+	}
+	return v
+}
+
+// UsesGraphSearch 是否需要使用 Graph 的 $search。地址、主题和自由文本只能通过 $search 匹配，
+// 其余条件使用 $filter，可以按时间排序
+func (q Query) UsesGraphSearch() bool {
+	return len(q.From) > 0 || len(q.To) > 0 || len(q.Subject) > 0 || len(q.Text) > 0
+}
+
+// GraphSearch 转换为 Graph $search 的 KQL（含外层双引号）。$search 不支持已读状态，
+// is:unread、is:read 需要调用方对结果再过滤
+func (q Query) GraphSearch() string {
+	var parts []string
+	add := func(prefix string, values []string) {
+		for _, v := range values {
+			parts = append(parts, prefix+graphQuote(v))
+		}
+	}
+	add("from:", q.From)
+	add("to:", q.To)
+	add("subject:", q.Subject)
+	if q.HasAttachment {
+		parts = append(parts, "hasattachment:true")
+	}
+	if !q.After.IsZero() {
+		parts = append(parts, "received>="+q.After.Format("2006-01-02"))
+	}
+	if !q.Before.IsZero() {
+		parts = append(parts, "received<"+q.Before.Format("2006-01-02"))
+	}
+	add("", q.Text)
+	return `"` + strings.Join(parts, " AND ") + `"`
+}
+
+// graphQuote KQL 中含空格的值用转义的双引号括起来，值中的双引号和反斜杠已在解析时去掉或在此转义
+func graphQuote(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	if strings.ContainsAny(v, " \t") {
+		return `\"` + v + `\"`
+	}
+	return v
+}
+
+// GraphFilter 转换为 Graph $filter，用于不需要 $search 的查询。
+// 以 receivedDateTime 开头，满足按 receivedDateTime 排序时 $orderby 的属性必须先出现在 $filter 中的要求
+func (q Query) GraphFilter() string {
+	after := q.After
+	if after.IsZero() {
+		after = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	parts := []string{"receivedDateTime ge " + after.UTC().Format(time.RFC3339)}
+	if !q.Before.IsZero() {
+		parts = append(parts, "receivedDateTime lt "+q.Before.UTC().Format(time.RFC3339))
+	}
+	if q.HasAttachment {
+		parts = append(parts, "hasAttachments eq true")
+	}
+	if q.Unread {
+		parts = append(parts, "isRead eq false")
+	}
+	if q.Read {
+		parts = append(parts, "isRead eq true")
+	}
+	return strings.Join(parts, " and ")
+}
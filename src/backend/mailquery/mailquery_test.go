@@ -0,0 +1,70 @@
+package mailquery
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	q, err := Parse(`from:"John Doe" TO:ops@example.com subject:invoice has:attachment is:unread after:2024-01-02 before:2024/02/01 "quarterly report" refund`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"John Doe"}, q.From)
+	assert.Equal(t, []string{"ops@example.com"}, q.To)
+	assert.Equal(t, []string{"invoice"}, q.Subject)
+	assert.True(t, q.HasAttachment)
+	assert.True(t, q.Unread)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), q.After)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), q.Before)
+	assert.Equal(t, []string{"quarterly report", "refund"}, q.Text)
+
+	q, err = Parse(`https://example.com/reset "note: urgent" label:work`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/reset", "note: urgent", "label:work"}, q.Text, "未知前缀和引号内的冒号按自由文本处理")
+
+	q, err = Parse("   ")
+	require.NoError(t, err)
+	assert.True(t, q.Empty())
+
+	for _, bad := range []string{"has:pdf", "is:starred", "before:yesterday", "after:2024-13-01", "is:read is:unread", strings.Repeat("a", MaxLength+1)} {
+		_, err := Parse(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestGmail(t *testing.T) {
+	q, err := Parse(`from:"John Doe" subject:invoice has:attachment is:unread after:2024-01-02 before:2024-02-01 refund`)
+	require.NoError(t, err)
+	assert.Equal(t, `from:"John Doe" subject:invoice has:attachment is:unread after:2024/01/02 before:2024/02/01 refund`, q.Gmail())
+}
+
+func TestGraph(t *testing.T) {
+	q, err := Parse(`from:"John Doe" has:attachment after:2024-01-02 is:unread refund`)
+	require.NoError(t, err)
+	assert.True(t, q.UsesGraphSearch())
+	assert.Equal(t, `"from:\"John Doe\" AND hasattachment:true AND received>=2024-01-02 AND refund"`, q.GraphSearch())
+
+	q, err = Parse("is:unread has:attachment before:2024-02-01")
+	require.NoError(t, err)
+	assert.False(t, q.UsesGraphSearch())
+	assert.Equal(t, "receivedDateTime ge 1970-01-01T00:00:00Z and receivedDateTime lt 2024-02-01T00:00:00Z and hasAttachments eq true and isRead eq false", q.GraphFilter())
+}
+
+func TestIMAPCriteria(t *testing.T) {
+	q, err := Parse(`from:alice@example.com subject:"weekly report" is:read after:2024-01-02 budget`)
+	require.NoError(t, err)
+	criteria := q.IMAPCriteria()
+	assert.Equal(t, []imap.SearchCriteriaHeaderField{
+		{Key: "From", Value: "alice@example.com"},
+		{Key: "Subject", Value: "weekly report"},
+	}, criteria.Header)
+	assert.Equal(t, []imap.Flag{imap.FlagSeen}, criteria.Flag)
+	assert.Empty(t, criteria.NotFlag)
+	assert.Equal(t, []string{"budget"}, criteria.Text)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), criteria.Since)
+	assert.True(t, criteria.Before.IsZero())
+}
@@ -0,0 +1,180 @@
+// Package mailthread 根据 Message-ID、References 和 In-Reply-To 把邮件归为会话，
+// 即 RFC 5256 REFERENCES 算法（JWZ 算法）中按引用关系建树的部分，用于不支持 THREAD 扩展的 IMAP 服务器。
+// 不做按主题合并：同一会话的邮件必须能通过引用关系找到共同的根，这样会话ID（根的 Message-ID）可以用 SEARCH 重新取回整个会话。
+package mailthread
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message 参与分组的邮件
+type Message struct {
+	Key        string   // 调用方的邮件标识
+	MessageID  string   // Message-ID 头，不含尖括号
+	References []string // References 头中的 Message-ID，按从远到近的顺序，In-Reply-To 放在最后
+	Date       time.Time
+}
+
+// Thread 一个会话
+type Thread struct {
+	// RootID 会话根的 Message-ID。根邮件可能不在给定的邮件中（只被引用），根邮件没有 Message-ID 时为空
+	RootID string
+	Keys   []string // 会话中的邮件，按日期升序
+	Latest time.Time
+}
+
+// ParseIDs 提取 References、In-Reply-To 头中尖括号括起来的 Message-ID，没有尖括号时按空白分隔
+func ParseIDs(header string) []string {
+	var ids []string
+	rest := header
+	for {
+		start := strings.IndexByte(rest, '<')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[start:], '>')
+		if end < 0 {
+			break
+		}
+		if id := strings.TrimSpace(rest[start+1 : start+end]); id != "" {
+			ids = append(ids, id)
+		}
+		rest = rest[start+end+1:]
+	}
+	if len(ids) == 0 {
+		ids = strings.Fields(header)
+	}
+	return ids
+}
+
+// RootOf 单封邮件所在会话的根：References 中最早的 Message-ID，没有引用时为自己的 Message-ID
+func RootOf(messageID string, references []string) string {
+	if len(references) > 0 {
+		return references[0]
+	}
+	return messageID
+}
+
+type container struct {
+	id       string
+	message  *Message
+	parent   *container
+	children []*container
+}
+
+// hasDescendant c 的子树中是否包含 target
+func (c *container) hasDescendant(target *container) bool {
+	for _, child := range c.children {
+		if child == target || child.hasDescendant(target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *container) setParent(parent *container) {
+	if c.parent == parent {
+		return
+	}
+	if c.parent != nil {
+		siblings := c.parent.children
+		for i, child := range siblings {
+			if child == c {
+				c.parent.children = append(siblings[:i:i], siblings[i+1:]...)
+				break
+			}
+		}
+	}
+	c.parent = parent
+	if parent != nil {
+		parent.children = append(parent.children, c)
+	}
+}
+
+// canLink 把 child 挂到 parent 下是否不会形成环
+func canLink(parent, child *container) bool {
+	return parent != child && !child.hasDescendant(parent)
+}
+
+// Build 把邮件分组为会话，按会话中最新邮件的日期倒序返回
+func Build(messages []Message) []Thread {
+	table := map[string]*container{}
+	var order []*container
+	get := func(id string) *container {
+		c, ok := table[id]
+		if !ok {
+			c = &container{id: id}
+			table[id] = c
+			order = append(order, c)
+		}
+		return c
+	}
+
+	for i := range messages {
+		msg := &messages[i]
+		id := strings.Trim(strings.TrimSpace(msg.MessageID), "<>")
+		c := table[id]
+		if id == "" || (c != nil && c.message != nil) {
+			// 没有 Message-ID 或重复时单独成为一个节点，不参与引用
+			c = &container{message: msg}
+			order = append(order, c)
+		} else {
+			c = get(id)
+			c.message = msg
+		}
+
+		// 按 References 的顺序依次链接，已有父节点的不再改变
+		var prev *container
+		for _, ref := range msg.References {
+			ref = strings.Trim(strings.TrimSpace(ref), "<>")
+			if ref == "" || ref == id {
+				continue
+			}
+			rc := get(ref)
+			if prev != nil && rc.parent == nil && canLink(prev, rc) {
+				rc.setParent(prev)
+			}
+			prev = rc
+		}
+		// 邮件自己的父节点以最后一个引用为准
+		if prev != nil && canLink(prev, c) {
+			c.setParent(prev)
+		} else if prev == nil && c.parent != nil && len(msg.References) == 0 {
+			c.setParent(nil)
+		}
+	}
+
+	var threads []Thread
+	for _, c := range order {
+		if c.parent != nil {
+			continue
+		}
+		var members []*Message
+		collectMessages(c, &members)
+		if len(members) == 0 {
+			continue
+		}
+		sort.SliceStable(members, func(a, b int) bool { return members[a].Date.Before(members[b].Date) })
+		thread := Thread{RootID: c.id}
+		for _, m := range members {
+			thread.Keys = append(thread.Keys, m.Key)
+			if m.Date.After(thread.Latest) {
+				thread.Latest = m.Date
+			}
+		}
+		threads = append(threads, thread)
+	}
+	sort.SliceStable(threads, func(a, b int) bool { return threads[a].Latest.After(threads[b].Latest) })
+	return threads
+}
+
+func collectMessages(c *container, out *[]*Message) {
+	if c.message != nil {
+		*out = append(*out, c.message)
+	}
+	for _, child := range c.children {
+		collectMessages(child, out)
+	}
+}
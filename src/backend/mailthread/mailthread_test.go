@@ -0,0 +1,64 @@
+package mailthread
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func day(d int) time.Time {
+	return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseIDs(t *testing.T) {
+	assert.Equal(t, []string{"a@x", "b@y"}, ParseIDs("<a@x>\r\n <b@y>"))
+	assert.Equal(t, []string{"a@x"}, ParseIDs(" <a@x> (comment)"))
+	assert.Equal(t, []string{"a@x", "b@y"}, ParseIDs("a@x b@y"), "没有尖括号时按空白分隔")
+	assert.Empty(t, ParseIDs(""))
+}
+
+func TestRootOf(t *testing.T) {
+	assert.Equal(t, "a@x", RootOf("c@x", []string{"a@x", "b@x"}))
+	assert.Equal(t, "c@x", RootOf("c@x", nil))
+}
+
+func TestBuild(t *testing.T) {
+	threads := Build([]Message{
+		{Key: "reply2", MessageID: "c@x", References: []string{"a@x", "b@x"}, Date: day(3)},
+		{Key: "root", MessageID: "<a@x>", Date: day(1)},
+		{Key: "other", MessageID: "z@x", Date: day(2)},
+		{Key: "reply1", MessageID: "b@x", References: []string{"a@x"}, Date: day(2)},
+		// 根邮件不在结果中，只被引用
+		{Key: "orphan1", MessageID: "p@x", References: []string{"missing@x"}, Date: day(4)},
+		{Key: "orphan2", MessageID: "q@x", References: []string{"<missing@x>"}, Date: day(5)},
+		{Key: "noid", Date: day(6)},
+	})
+	require.Len(t, threads, 4)
+
+	assert.Equal(t, "", threads[0].RootID, "没有 Message-ID 的邮件单独成为会话")
+	assert.Equal(t, []string{"noid"}, threads[0].Keys)
+
+	assert.Equal(t, "missing@x", threads[1].RootID)
+	assert.Equal(t, []string{"orphan1", "orphan2"}, threads[1].Keys)
+	assert.Equal(t, day(5), threads[1].Latest)
+
+	assert.Equal(t, "a@x", threads[2].RootID)
+	assert.Equal(t, []string{"root", "reply1", "reply2"}, threads[2].Keys)
+
+	assert.Equal(t, "z@x", threads[3].RootID)
+}
+
+func TestBuild_DuplicatesAndLoops(t *testing.T) {
+	threads := Build([]Message{
+		{Key: "a", MessageID: "a@x", References: []string{"b@x"}, Date: day(1)},
+		{Key: "b", MessageID: "b@x", References: []string{"a@x"}, Date: day(2)},
+		{Key: "a-copy", MessageID: "a@x", Date: day(3)},
+	})
+	var keys []string
+	for _, thread := range threads {
+		keys = append(keys, thread.Keys...)
+	}
+	assert.ElementsMatch(t, []string{"a", "b", "a-copy"}, keys, "循环引用和重复 Message-ID 不丢失邮件")
+}
@@ -0,0 +1,64 @@
+package mailwatch
+
+import (
+	"sync"
+
+	"email_server/models"
+)
+
+// subscriberBuffer 每个连接缓冲的事件数，客户端读取过慢时丢弃新事件（客户端可按事件ID补取）
+const subscriberBuffer = 64
+
+// Hub 把新邮件事件分发给同一用户的所有在线连接
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[uint]map[chan models.NewMailEvent]struct{}
+}
+
+// NewHub 创建事件分发器
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[uint]map[chan models.NewMailEvent]struct{})}
+}
+
+// Subscribe 订阅用户的新邮件事件，返回的函数用于取消订阅（之后通道被关闭）
+func (h *Hub) Subscribe(userID uint) (<-chan models.NewMailEvent, func()) {
+	ch := make(chan models.NewMailEvent, subscriberBuffer)
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan models.NewMailEvent]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subscribers[userID], ch)
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// Publish 把事件发送给该用户的所有连接，不阻塞
+func (h *Hub) Publish(event models.NewMailEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribers 用户当前的连接数
+func (h *Hub) Subscribers(userID uint) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[userID])
+}
@@ -0,0 +1,37 @@
+package mailwatch
+
+import (
+	"testing"
+
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub_PublishToUserSubscribers(t *testing.T) {
+	hub := NewHub()
+	first, cancelFirst := hub.Subscribe(1)
+	second, cancelSecond := hub.Subscribe(1)
+	other, cancelOther := hub.Subscribe(2)
+	defer cancelOther()
+	assert.Equal(t, 2, hub.Subscribers(1))
+
+	hub.Publish(models.NewMailEvent{ID: 7, UserID: 1})
+	assert.Equal(t, uint(7), (<-first).ID)
+	assert.Equal(t, uint(7), (<-second).ID)
+	assert.Empty(t, other, "其他用户收不到事件")
+
+	cancelFirst()
+	cancelFirst()
+	_, open := <-first
+	assert.False(t, open, "取消订阅后通道关闭")
+	assert.Equal(t, 1, hub.Subscribers(1))
+
+	// 缓冲满时丢弃而不阻塞
+	for i := 0; i < subscriberBuffer+10; i++ {
+		hub.Publish(models.NewMailEvent{UserID: 1})
+	}
+	assert.Len(t, second, subscriberBuffer)
+	cancelSecond()
+	assert.Equal(t, 0, hub.Subscribers(1))
+}
@@ -0,0 +1,573 @@
+// Package mailwatch 为用户开启了新邮件监听的邮箱账户保持长期运行的监听：IMAP 账户使用 IDLE 长连接，
+// Gmail 账户定期调用 history.list，Outlook 账户定期执行 delta 查询（配置了变更通知时收到通知立即检查）。
+// 发现的新邮件记录为 NewMailEvent，并通过 Hub 推送给在线的客户端。
+//
+// 每个账户一个 goroutine，失败后按指数退避重试；连续的授权错误会暂停监听，等待用户重新开启。
+package mailwatch
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/integrations"
+	"email_server/models"
+)
+
+// 检查函数，测试中可替换
+var (
+	watchIMAPInbox          = integrations.WatchIMAPInbox
+	checkGmailHistory       = integrations.CheckGmailHistory
+	checkGraphDelta         = integrations.CheckGraphInboxDelta
+	createGraphSubscription = integrations.CreateGraphMailSubscription
+	renewGraphSubscription  = integrations.RenewGraphMailSubscription
+	deleteGraphSubscription = integrations.DeleteGraphMailSubscription
+)
+
+// DefaultHub 进程内的新邮件事件分发器
+var DefaultHub = NewHub()
+
+// GraphNotificationPath Graph 变更通知的回调路径
+const GraphNotificationPath = "/api/v1/webhooks/graph/mail"
+
+const (
+	// backoffBase 第一次重试的等待时间，之后每次加倍
+	backoffBase = 5 * time.Second
+	// maxAuthFailures 连续授权失败的次数达到该值后暂停监听
+	maxAuthFailures = 3
+	// graphSubscriptionRenewBefore 订阅在到期前多久续订
+	graphSubscriptionRenewBefore = 24 * time.Hour
+)
+
+// Backoff 第 failures 次失败后的等待时间：从 5 秒开始倍增，不超过 max
+func Backoff(failures int, max time.Duration) time.Duration {
+	wait := backoffBase
+	for i := 1; i < failures && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait
+}
+
+// isAuthError 是否为需要用户重新授权或修改密码的错误
+func isAuthError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"oauth2", "re-authenticate", "login failed", "could not decrypt", "password for email account"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Manager 管理所有账户的监听
+type Manager struct {
+	cfg config.MailWatchConfig
+	// notificationURL Graph 变更通知地址，为空时 Outlook 账户只定期检查
+	notificationURL string
+	hub             *Hub
+	imapSlots       chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	// watchers 按邮箱账户ID索引的运行中的监听
+	watchers map[uint]*watcher
+}
+
+type watcher struct {
+	cancel context.CancelFunc
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+// NewManager 创建监听管理器，notificationURL 为空时不创建 Graph 变更通知订阅
+func NewManager(cfg config.MailWatchConfig, notificationURL string, hub *Hub) *Manager {
+	if cfg.MaxIMAPConnections <= 0 {
+		cfg.MaxIMAPConnections = 50
+	}
+	if cfg.PollIntervalSeconds <= 0 {
+		cfg.PollIntervalSeconds = 60
+	}
+	if cfg.MaxBackoffSeconds <= 0 {
+		cfg.MaxBackoffSeconds = 600
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		cfg:             cfg,
+		notificationURL: notificationURL,
+		hub:             hub,
+		imapSlots:       make(chan struct{}, cfg.MaxIMAPConnections),
+		ctx:             ctx,
+		cancel:          cancel,
+		watchers:        make(map[uint]*watcher),
+	}
+}
+
+var (
+	managerMu sync.Mutex
+	manager   *Manager
+)
+
+func current() *Manager {
+	managerMu.Lock()
+	defer managerMu.Unlock()
+	return manager
+}
+
+// Start 启动监听管理器并恢复所有未暂停的监听。cfg.Enabled 为 false 时不启动，已开启的监听保留但不运行
+func Start(cfg config.MailWatchConfig, backendBaseURL string) error {
+	if !cfg.Enabled {
+		log.Println("Mail watch disabled (MAIL_WATCH_ENABLED=false).")
+		return nil
+	}
+	notificationURL := ""
+	if cfg.GraphNotifications {
+		notificationURL = strings.TrimRight(backendBaseURL, "/") + GraphNotificationPath
+	}
+	m := NewManager(cfg, notificationURL, DefaultHub)
+	if err := m.Resume(); err != nil {
+		m.Stop()
+		return err
+	}
+	managerMu.Lock()
+	manager = m
+	managerMu.Unlock()
+	return nil
+}
+
+// Resume 启动数据库中所有未暂停的监听
+func (m *Manager) Resume() error {
+	var watches []models.MailWatch
+	if err := database.DB.Where("status <> ?", models.MailWatchStatusSuspended).Find(&watches).Error; err != nil {
+		return fmt.Errorf("failed to load mail watches: %w", err)
+	}
+	for _, watch := range watches {
+		m.start(watch)
+	}
+	log.Printf("Mail watch started, %d account(s) watched.", len(watches))
+	return nil
+}
+
+// Stop 停止所有监听并等待退出
+func (m *Manager) Stop() {
+	m.cancel()
+	m.mu.Lock()
+	var done []chan struct{}
+	for _, w := range m.watchers {
+		done = append(done, w.done)
+	}
+	m.mu.Unlock()
+	for _, ch := range done {
+		<-ch
+	}
+}
+
+// start 启动账户的监听，已在运行时先停止
+func (m *Manager) start(watch models.MailWatch) {
+	m.stop(watch.EmailAccountID)
+	ctx, cancel := context.WithCancel(m.ctx)
+	w := &watcher{cancel: cancel, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	m.mu.Lock()
+	m.watchers[watch.EmailAccountID] = w
+	m.mu.Unlock()
+	go m.run(ctx, w, watch)
+}
+
+// stop 停止账户的监听并等待退出
+func (m *Manager) stop(accountID uint) {
+	m.mu.Lock()
+	w := m.watchers[accountID]
+	delete(m.watchers, accountID)
+	m.mu.Unlock()
+	if w != nil {
+		w.cancel()
+		<-w.done
+	}
+}
+
+// forget 监听自行退出时从索引中移除
+func (m *Manager) forget(accountID uint, w *watcher) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.watchers[accountID] == w {
+		delete(m.watchers, accountID)
+	}
+}
+
+// Wake 立即检查账户的新邮件（IMAP IDLE 账户不需要），账户没有运行中的监听时返回 false
+func (m *Manager) Wake(accountID uint) bool {
+	m.mu.Lock()
+	w := m.watchers[accountID]
+	m.mu.Unlock()
+	if w == nil {
+		return false
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Running 账户的监听是否在运行
+func (m *Manager) Running(accountID uint) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.watchers[accountID] != nil
+}
+
+func (m *Manager) pollInterval() time.Duration {
+	return time.Duration(m.cfg.PollIntervalSeconds) * time.Second
+}
+
+// run 账户监听的主循环
+func (m *Manager) run(ctx context.Context, w *watcher, watch models.MailWatch) {
+	defer close(w.done)
+	defer m.forget(watch.EmailAccountID, w)
+
+	failures, authFailures := 0, 0
+	for ctx.Err() == nil {
+		var account models.EmailAccount
+		err := database.DB.First(&account, watch.EmailAccountID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("[mailwatch] Email account %d no longer exists, removing its watch", watch.EmailAccountID)
+			database.DB.Delete(&models.MailWatch{}, watch.ID)
+			return
+		}
+		if err == nil {
+			if watch.Method == models.MailWatchMethodIMAPIdle {
+				var connected bool
+				connected, err = m.watchIMAP(ctx, account, &watch)
+				if connected {
+					// 连接建立后断开的，从最短的等待时间开始重试
+					failures, authFailures = 0, 0
+				}
+			} else {
+				err = m.poll(account, &watch)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		wait := m.pollInterval()
+		if err != nil {
+			failures++
+			if isAuthError(err) {
+				authFailures++
+			} else {
+				authFailures = 0
+			}
+			if authFailures >= maxAuthFailures {
+				log.Printf("[mailwatch] Suspending watch of account %d after repeated auth failures: %v", watch.EmailAccountID, err)
+				m.setStatus(watch.ID, models.MailWatchStatusSuspended, err)
+				return
+			}
+			wait = Backoff(failures, time.Duration(m.cfg.MaxBackoffSeconds)*time.Second)
+			log.Printf("[mailwatch] Watching account %d failed (retry in %s): %v", watch.EmailAccountID, wait, err)
+			m.setStatus(watch.ID, models.MailWatchStatusRetrying, err)
+		} else {
+			failures, authFailures = 0, 0
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-w.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// watchIMAP 占用一个 IMAP 连接名额并保持 IDLE，直到 ctx 取消或连接出错。connected 表示曾成功连接
+func (m *Manager) watchIMAP(ctx context.Context, account models.EmailAccount, watch *models.MailWatch) (connected bool, err error) {
+	select {
+	case m.imapSlots <- struct{}{}:
+	default:
+		m.setStatus(watch.ID, models.MailWatchStatusWaiting, nil)
+		select {
+		case m.imapSlots <- struct{}{}:
+		case <-ctx.Done():
+			return false, nil
+		}
+	}
+	defer func() { <-m.imapSlots }()
+
+	err = watchIMAPInbox(ctx, account, watch.Cursor, m.pollInterval(), integrations.IMAPWatchHandler{
+		Ready: func(idle bool) {
+			connected = true
+			if !idle {
+				log.Printf("[mailwatch] IMAP server of account %d does not support IDLE, polling every %s", account.ID, m.pollInterval())
+			}
+			m.setStatus(watch.ID, models.MailWatchStatusWatching, nil)
+		},
+		NewMessages: func(emails []models.Email, cursor string) error {
+			return m.checked(watch, emails, cursor)
+		},
+	})
+	return connected, err
+}
+
+// poll 检查一次 Gmail 或 Outlook 账户的新邮件
+func (m *Manager) poll(account models.EmailAccount, watch *models.MailWatch) error {
+	var emails []models.Email
+	var cursor string
+	var err error
+	switch watch.Method {
+	case models.MailWatchMethodGmailHistory:
+		emails, cursor, err = checkGmailHistory(account, watch.Cursor)
+	case models.MailWatchMethodGraphDelta:
+		if m.notificationURL != "" {
+			m.ensureGraphSubscription(account, watch)
+		}
+		emails, cursor, err = checkGraphDelta(account, watch.Cursor)
+		// delta 查询也返回已读状态等变化的旧邮件，开启监听前收到的邮件不产生事件
+		filtered := emails[:0]
+		for _, email := range emails {
+			if !email.Date.Before(watch.EnabledAt) {
+				filtered = append(filtered, email)
+			}
+		}
+		emails = filtered
+	default:
+		return fmt.Errorf("unknown mail watch method %q", watch.Method)
+	}
+	if err != nil {
+		return err
+	}
+	return m.checked(watch, emails, cursor)
+}
+
+// checked 记录检查结果：保存新邮件事件和检查位置，状态改为监听中
+func (m *Manager) checked(watch *models.MailWatch, emails []models.Email, cursor string) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"cursor":          cursor,
+		"status":          models.MailWatchStatusWatching,
+		"last_error":      "",
+		"last_checked_at": now,
+	}
+	if m.record(watch, emails) > 0 {
+		updates["last_event_at"] = now
+	}
+	watch.Cursor = cursor
+	return database.DB.Model(&models.MailWatch{}).Where("id = ?", watch.ID).Updates(updates).Error
+}
+
+// record 保存新邮件事件并推送，已记录过的邮件跳过，返回新记录的数量
+func (m *Manager) record(watch *models.MailWatch, emails []models.Email) int {
+	count := 0
+	for _, email := range emails {
+		if email.MessageID == "" {
+			continue
+		}
+		event := newMailEvent(watch, email)
+		result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&event)
+		if result.Error != nil {
+			log.Printf("[mailwatch] Failed to record new mail event for account %d: %v", watch.EmailAccountID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		count++
+		m.hub.Publish(event)
+	}
+	return count
+}
+
+func newMailEvent(watch *models.MailWatch, email models.Email) models.NewMailEvent {
+	event := models.NewMailEvent{
+		UserID:         watch.UserID,
+		EmailAccountID: watch.EmailAccountID,
+		MessageID:      email.MessageID,
+		ThreadID:       truncate(email.ThreadID, 512),
+		Subject:        truncate(email.Subject, 1000),
+		Snippet:        email.Snippet,
+		ReceivedAt:     email.Date,
+	}
+	if len(email.From) > 0 {
+		event.FromName = truncate(email.From[0].Name, 255)
+		event.FromAddress = truncate(email.From[0].Address, 255)
+	}
+	if event.ReceivedAt.IsZero() {
+		event.ReceivedAt = time.Now()
+	}
+	return event
+}
+
+// truncate 按字符截断，避免超出字段长度
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// setStatus 更新监听状态，err 不为 nil 时记录错误信息
+func (m *Manager) setStatus(watchID uint, status string, err error) {
+	updates := map[string]interface{}{"status": status}
+	if err != nil {
+		updates["last_error"] = err.Error()
+	} else if status == models.MailWatchStatusWatching {
+		updates["last_error"] = ""
+	}
+	if dbErr := database.DB.Model(&models.MailWatch{}).Where("id = ?", watchID).Updates(updates).Error; dbErr != nil {
+		log.Printf("[mailwatch] Failed to update status of watch %d: %v", watchID, dbErr)
+	}
+}
+
+// ensureGraphSubscription 创建或续订 Graph 变更通知订阅。失败时只记录日志，仍按间隔检查
+func (m *Manager) ensureGraphSubscription(account models.EmailAccount, watch *models.MailWatch) {
+	now := time.Now()
+	if watch.SubscriptionID != "" && watch.SubscriptionExpiresAt != nil && watch.SubscriptionExpiresAt.After(now.Add(graphSubscriptionRenewBefore)) {
+		return
+	}
+	expires := now.Add(integrations.GraphMailSubscriptionMaxLifetime)
+	if watch.SubscriptionID != "" {
+		renewed, err := renewGraphSubscription(account, watch.SubscriptionID, expires)
+		if err == nil {
+			m.saveSubscription(watch, watch.SubscriptionID, renewed, watch.ClientState)
+			return
+		}
+		log.Printf("[mailwatch] Renewing graph subscription of account %d failed, creating a new one: %v", account.ID, err)
+	}
+
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		log.Printf("[mailwatch] Failed to generate client state: %v", err)
+		return
+	}
+	clientState := hex.EncodeToString(secret)
+	id, expiresAt, err := createGraphSubscription(account, m.notificationURL, clientState, expires)
+	if err != nil {
+		log.Printf("[mailwatch] Creating graph subscription for account %d failed: %v", account.ID, err)
+		return
+	}
+	m.saveSubscription(watch, id, expiresAt, clientState)
+}
+
+func (m *Manager) saveSubscription(watch *models.MailWatch, id string, expires time.Time, clientState string) {
+	watch.SubscriptionID, watch.SubscriptionExpiresAt, watch.ClientState = id, &expires, clientState
+	err := database.DB.Model(&models.MailWatch{}).Where("id = ?", watch.ID).Updates(map[string]interface{}{
+		"subscription_id":         id,
+		"subscription_expires_at": expires,
+		"client_state":            clientState,
+	}).Error
+	if err != nil {
+		log.Printf("[mailwatch] Failed to save graph subscription of watch %d: %v", watch.ID, err)
+	}
+}
+
+// Enable 为邮箱账户开启监听。已开启时返回现有的监听；被暂停或方式变化时重新开始。
+// 管理器未运行（MAIL_WATCH_ENABLED=false）时只保存设置
+func Enable(account models.EmailAccount, method string) (models.MailWatch, error) {
+	m := current()
+	var watch models.MailWatch
+	err := database.DB.Where("email_account_id = ?", account.ID).First(&watch).Error
+	switch {
+	case err == nil:
+		if watch.Method == method && watch.Status != models.MailWatchStatusSuspended && (m == nil || m.Running(account.ID)) {
+			return watch, nil
+		}
+		if watch.Method != method {
+			watch.Cursor = ""
+		}
+		watch.Method, watch.Status, watch.LastError = method, models.MailWatchStatusStarting, ""
+		if err := database.DB.Save(&watch).Error; err != nil {
+			return watch, err
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		watch = models.MailWatch{
+			UserID:         account.UserID,
+			EmailAccountID: account.ID,
+			Method:         method,
+			EnabledAt:      time.Now(),
+			Status:         models.MailWatchStatusStarting,
+		}
+		if err := database.DB.Create(&watch).Error; err != nil {
+			return watch, err
+		}
+	default:
+		return watch, err
+	}
+
+	if m == nil {
+		watch.Status = models.MailWatchStatusStopped
+		database.DB.Model(&watch).Update("status", watch.Status)
+		return watch, nil
+	}
+	m.start(watch)
+	return watch, nil
+}
+
+// Disable 关闭邮箱账户的监听，删除 Graph 订阅和监听设置。已记录的事件保留到过期
+func Disable(account models.EmailAccount) error {
+	if m := current(); m != nil {
+		m.stop(account.ID)
+	}
+	var watch models.MailWatch
+	err := database.DB.Where("email_account_id = ?", account.ID).First(&watch).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if watch.SubscriptionID != "" {
+		if err := deleteGraphSubscription(account, watch.SubscriptionID); err != nil {
+			log.Printf("[mailwatch] Deleting graph subscription of account %d failed: %v", account.ID, err)
+		}
+	}
+	return database.DB.Delete(&watch).Error
+}
+
+// HandleGraphNotification 处理 Graph 变更通知：clientState 与订阅匹配时立即检查对应账户，返回是否匹配
+func HandleGraphNotification(subscriptionID, clientState string) bool {
+	if subscriptionID == "" || clientState == "" {
+		return false
+	}
+	var watch models.MailWatch
+	if err := database.DB.Where("subscription_id = ?", subscriptionID).First(&watch).Error; err != nil {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(watch.ClientState), []byte(clientState)) != 1 {
+		return false
+	}
+	if m := current(); m != nil {
+		m.Wake(watch.EmailAccountID)
+	}
+	return true
+}
+
+// EventsAfter 返回用户 ID 大于 afterID 的新邮件事件，按 ID 升序
+func EventsAfter(userID, afterID uint, limit int) ([]models.NewMailEvent, error) {
+	events := []models.NewMailEvent{}
+	err := database.DB.Where("user_id = ? AND id > ?", userID, afterID).Order("id").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// PurgeEvents 删除 before 之前记录的新邮件事件
+func PurgeEvents(before time.Time) (int64, error) {
+	result := database.DB.Where("created_at < ?", before).Delete(&models.NewMailEvent{})
+	return result.RowsAffected, result.Error
+}
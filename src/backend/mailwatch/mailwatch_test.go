@@ -0,0 +1,137 @@
+package mailwatch
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/database/dbtest"
+	"email_server/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	max := 10 * time.Minute
+	assert.Equal(t, 5*time.Second, Backoff(1, max))
+	assert.Equal(t, 10*time.Second, Backoff(2, max))
+	assert.Equal(t, 40*time.Second, Backoff(4, max))
+	assert.Equal(t, max, Backoff(20, max))
+	assert.Equal(t, 3*time.Second, Backoff(1, 3*time.Second))
+}
+
+func TestIsAuthError(t *testing.T) {
+	assert.True(t, isAuthError(errors.New("failed to get oauth2 token: expired")))
+	assert.True(t, isAuthError(errors.New("IMAP login failed: NO [AUTHENTICATIONFAILED]")))
+	assert.False(t, isAuthError(errors.New("dial tcp: i/o timeout")))
+}
+
+func setupWatch(t *testing.T, method string) (*Manager, models.EmailAccount, *models.MailWatch) {
+	t.Helper()
+	original := database.DB
+	database.DB = dbtest.Open(t)
+	t.Cleanup(func() { database.DB = original })
+
+	account := models.EmailAccount{UserID: 1, EmailAddress: "watch@example.com"}
+	require.NoError(t, database.DB.Create(&account).Error)
+	watch := models.MailWatch{UserID: 1, EmailAccountID: account.ID, Method: method, EnabledAt: time.Now().Add(-time.Hour), Status: models.MailWatchStatusStarting}
+	require.NoError(t, database.DB.Create(&watch).Error)
+
+	m := NewManager(config.MailWatchConfig{}, "", NewHub())
+	t.Cleanup(m.Stop)
+	return m, account, &watch
+}
+
+func TestPoll_RecordsEachMessageOnce(t *testing.T) {
+	m, account, watch := setupWatch(t, models.MailWatchMethodGmailHistory)
+	events, cancel := m.hub.Subscribe(1)
+	defer cancel()
+
+	var cursors []string
+	original := checkGmailHistory
+	checkGmailHistory = func(emailAccount models.EmailAccount, historyID string) ([]models.Email, string, error) {
+		cursors = append(cursors, historyID)
+		return []models.Email{
+			{MessageID: "gmail_1", Subject: "Hello", From: []models.EmailAddress{{Name: "Ann", Address: "ann@example.com"}}},
+			{MessageID: ""},
+		}, "h2", nil
+	}
+	t.Cleanup(func() { checkGmailHistory = original })
+
+	require.NoError(t, m.poll(account, watch))
+	require.NoError(t, m.poll(account, watch))
+	assert.Equal(t, []string{"", "h2"}, cursors, "下一次检查从保存的位置开始")
+
+	var stored []models.NewMailEvent
+	require.NoError(t, database.DB.Find(&stored).Error)
+	require.Len(t, stored, 1, "同一封邮件只记录一次")
+	assert.Equal(t, "ann@example.com", stored[0].FromAddress)
+	assert.Len(t, events, 1, "重复的邮件不再推送")
+
+	var saved models.MailWatch
+	require.NoError(t, database.DB.First(&saved, watch.ID).Error)
+	assert.Equal(t, "h2", saved.Cursor)
+	assert.Equal(t, models.MailWatchStatusWatching, saved.Status)
+	assert.NotNil(t, saved.LastCheckedAt)
+	assert.NotNil(t, saved.LastEventAt)
+
+	afterFirst, err := EventsAfter(1, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, afterFirst, 1)
+	none, err := EventsAfter(1, stored[0].ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func TestPoll_GraphSkipsMessagesBeforeEnabled(t *testing.T) {
+	m, account, watch := setupWatch(t, models.MailWatchMethodGraphDelta)
+	original := checkGraphDelta
+	checkGraphDelta = func(emailAccount models.EmailAccount, deltaLink string) ([]models.Email, string, error) {
+		return []models.Email{
+			{MessageID: "old", Date: watch.EnabledAt.Add(-time.Minute)},
+			{MessageID: "new", Date: time.Now()},
+		}, "delta2", nil
+	}
+	t.Cleanup(func() { checkGraphDelta = original })
+
+	require.NoError(t, m.poll(account, watch))
+	var stored []models.NewMailEvent
+	require.NoError(t, database.DB.Find(&stored).Error)
+	require.Len(t, stored, 1)
+	assert.Equal(t, "new", stored[0].MessageID)
+}
+
+func TestRun_SuspendsAfterRepeatedAuthFailures(t *testing.T) {
+	m, _, watch := setupWatch(t, models.MailWatchMethodGmailHistory)
+	calls := 0
+	original := checkGmailHistory
+	checkGmailHistory = func(emailAccount models.EmailAccount, historyID string) ([]models.Email, string, error) {
+		calls++
+		return nil, "", errors.New("failed to get oauth2 token: invalid_grant")
+	}
+	t.Cleanup(func() { checkGmailHistory = original })
+
+	// 重试等待时间尽量短
+	m.cfg.MaxBackoffSeconds = 1
+	m.start(*watch)
+	require.Eventually(t, func() bool { return !m.Running(watch.EmailAccountID) }, 10*time.Second, 20*time.Millisecond)
+
+	var saved models.MailWatch
+	require.NoError(t, database.DB.First(&saved, watch.ID).Error)
+	assert.Equal(t, models.MailWatchStatusSuspended, saved.Status)
+	assert.Contains(t, saved.LastError, "oauth2")
+	assert.Equal(t, maxAuthFailures, calls)
+}
+
+func TestHandleGraphNotification(t *testing.T) {
+	_, _, watch := setupWatch(t, models.MailWatchMethodGraphDelta)
+	require.NoError(t, database.DB.Model(watch).Updates(map[string]interface{}{"subscription_id": "sub-1", "client_state": "secret"}).Error)
+
+	assert.True(t, HandleGraphNotification("sub-1", "secret"))
+	assert.False(t, HandleGraphNotification("sub-1", "wrong"))
+	assert.False(t, HandleGraphNotification("sub-2", "secret"))
+	assert.False(t, HandleGraphNotification("sub-1", ""))
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// accountSetupAllowedPaths 需要修改密码或验证邮箱的用户仍可访问的接口
+var accountSetupAllowedPaths = map[string]bool{
+	"/api/v1/users/me":                     true,
+	"/api/v1/users/me/change-password":     true,
+	"/api/v1/users/me/verify-email/resend": true,
+	"/api/v1/auth/logout":                  true,
+}
+
+// EnforceAccountSetup 限制尚未完成账户设置的用户：管理员要求修改密码的用户需先修改密码，
+// 开启邮箱验证时未验证邮箱的用户需先验证。限制期间只能访问个人资料、修改密码、重发验证邮件和登出接口。
+// 需放在 AuthRequired 之后
+func EnforceAccountSetup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if accountSetupAllowedPaths[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		var user models.User
+		err := database.DB.Select("must_change_password", "email_verified_at").Where("id = ?", c.GetInt64("user_id")).First(&user).Error
+		if err != nil {
+			// 用户不存在等情况交给后续处理器处理
+			log.Printf("[EnforceAccountSetup] 查询用户失败: %v", err)
+			c.Next()
+			return
+		}
+		if user.MustChangePassword {
+			utils.SendErrorResponse(c, 403, "请先修改密码")
+			c.Abort()
+			return
+		}
+		if user.EmailVerifiedAt == nil && config.AppConfig.Admin.RequireEmailVerification {
+			utils.SendErrorResponse(c, 403, "请先验证邮箱")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
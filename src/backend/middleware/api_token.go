@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// AuthMethodAPIToken 通过个人 API token 认证时 context 中 auth_method 的值
+const AuthMethodAPIToken = "api_token"
+
+// apiTokenLastUsedInterval 最近使用时间的更新间隔，避免每个请求都写数据库
+const apiTokenLastUsedInterval = time.Minute
+
+// apiTokenScopeRule 路由前缀对应的权限范围：GET 请求需要 read，其余请求需要 write
+type apiTokenScopeRule struct {
+	prefix      string
+	read, write string
+}
+
+// apiTokenScopeRules API token 可以访问的接口。未列出的接口（个人资料、API token 管理、管理后台等）只能通过登录访问
+var apiTokenScopeRules = []apiTokenScopeRule{
+	{"/api/v1/email-accounts", models.ScopeAccountsRead, models.ScopeAccountsWrite},
+	{"/api/v1/platforms", models.ScopeRegistrationsRead, models.ScopeRegistrationsWrite},
+	{"/api/v1/platform-registrations", models.ScopeRegistrationsRead, models.ScopeRegistrationsWrite},
+	{"/api/v1/service-subscriptions", models.ScopeSubscriptionsRead, models.ScopeSubscriptionsWrite},
+	{"/api/v1/inbox", models.ScopeInboxRead, models.ScopeInboxWrite},
+	{"/api/v1/autofill", models.ScopeRegistrationsRead, models.ScopeRegistrationsWrite},
+	{"/api/v1/platform-catalog", models.ScopeRegistrationsRead, models.ScopeRegistrationsWrite},
+	{"/api/v1/favicons", models.ScopeRegistrationsRead, models.ScopeRegistrationsWrite},
+}
+
+// requiredScope 返回 API token 访问该路由所需的权限范围，返回空字符串表示 API token 不能访问
+func requiredScope(method, fullPath string) string {
+	// 查看明文密码（包括历史版本密码）和 TOTP 验证码的接口需要单独授权
+	if method == http.MethodGet && (strings.HasSuffix(fullPath, "/password") || strings.HasSuffix(fullPath, "/totp")) {
+		return models.ScopeSecretsReveal
+	}
+	for _, rule := range apiTokenScopeRules {
+		if fullPath != rule.prefix && !strings.HasPrefix(fullPath, rule.prefix+"/") {
+			continue
+		}
+		if method == http.MethodGet || method == http.MethodHead {
+			return rule.read
+		}
+		return rule.write
+	}
+	return ""
+}
+
+// authenticateAPIToken 校验个人 API token 及其对当前路由的权限，成功时写入用户信息；失败时已写入响应
+func authenticateAPIToken(c *gin.Context, raw string) bool {
+	var token models.APIToken
+	err := database.DB.Where("token_hash = ?", utils.HashToken(raw)).First(&token).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("[AuthMiddleware] 查询 API token 失败: %v", err)
+		}
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "API token 无效或已过期")
+		c.Abort()
+		return false
+	}
+	now := time.Now()
+	if token.IsExpired(now) {
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "API token 无效或已过期")
+		c.Abort()
+		return false
+	}
+	var user models.User
+	if err := database.DB.Select("id", "username", "role", "status").First(&user, token.UserID).Error; err != nil || !user.IsStatusActive() {
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "API token 无效或已过期")
+		c.Abort()
+		return false
+	}
+
+	scope := requiredScope(c.Request.Method, c.FullPath())
+	if scope == "" {
+		utils.SendErrorResponse(c, http.StatusForbidden, "该接口不支持使用 API token 访问")
+		c.Abort()
+		return false
+	}
+	if !token.HasScope(scope) {
+		utils.SendErrorResponse(c, http.StatusForbidden, "API token 缺少权限: "+scope)
+		c.Abort()
+		return false
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenLastUsedInterval {
+		err := database.DB.Model(&models.APIToken{}).Where("id = ?", token.ID).
+			UpdateColumns(map[string]interface{}{"last_used_at": now, "last_used_ip": c.ClientIP()}).Error
+		if err != nil {
+			log.Printf("[AuthMiddleware] 更新 API token %d 最近使用时间失败: %v", token.ID, err)
+		}
+	}
+
+	c.Set("user_id", int64(user.ID))
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("auth_method", AuthMethodAPIToken)
+	c.Set("api_token_id", token.ID)
+	c.Set("api_token_scopes", token.ScopeList())
+	return true
+}
+
+// HasScope 当前请求是否拥有权限范围：登录会话拥有全部权限，API token 只拥有创建时授予的权限。
+// 用于同一接口按参数需要额外权限的情况（如自动填充时返回密码）
+func HasScope(c *gin.Context, scope string) bool {
+	if c.GetString("auth_method") != AuthMethodAPIToken {
+		return true
+	}
+	for _, s := range c.GetStringSlice("api_token_scopes") {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"email_server/database"
+	"email_server/models"
+	"email_server/utils"
+)
+
+// AuthMethodSignedURL 通过附件签名链接认证时 context 中 auth_method 的值
+const AuthMethodSignedURL = "signed_url"
+
+// AttachmentURLAuth 附件下载接口的认证。<img> 和下载链接无法携带 Authorization 头，
+// 带 token 查询参数时校验邮件详情中返回的签名链接，否则与其他接口一样使用 AuthRequired。
+// 需放在 EnforceAccountSetup 之前
+func AttachmentURLAuth() gin.HandlerFunc {
+	auth := AuthRequired()
+	return func(c *gin.Context) {
+		signed := c.Query("token")
+		if signed == "" {
+			auth(c)
+			return
+		}
+
+		accountID, _ := strconv.ParseUint(c.Query("account_id"), 10, 64)
+		userID, tokenVersion, err := utils.ParseAttachmentURLToken(signed, utils.AttachmentURLTarget{
+			AccountID:    uint(accountID),
+			MessageID:    c.Param("messageId"),
+			AttachmentID: c.Param("attachmentId"),
+		})
+		if err != nil {
+			log.Printf("[AttachmentURLAuth] Path: %s, signed url rejected: %v", c.Request.URL.Path, err)
+			utils.SendErrorResponse(c, http.StatusUnauthorized, "附件链接无效或已过期，请重新打开邮件")
+			c.Abort()
+			return
+		}
+
+		if !setSignedURLUser(c, userID, tokenVersion) {
+			utils.SendErrorResponse(c, http.StatusUnauthorized, "附件链接无效或已过期，请重新打开邮件")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ImageProxyURLAuth 邮件远程图片代理接口的认证，只接受邮件详情中返回的签名链接
+func ImageProxyURLAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := strconv.ParseInt(c.Query("u"), 10, 64)
+		tokenVersion, _ := strconv.ParseUint(c.Query("v"), 10, 64)
+		expiresAt, _ := strconv.ParseInt(c.Query("e"), 10, 64)
+		err := utils.VerifyImageProxyURL(utils.ImageProxyClaims{
+			UserID:       userID,
+			TokenVersion: uint(tokenVersion),
+			URL:          c.Query("url"),
+			ExpiresAt:    expiresAt,
+		}, c.Query("sig"))
+		if err != nil || !setSignedURLUser(c, userID, uint(tokenVersion)) {
+			if err != nil {
+				log.Printf("[ImageProxyURLAuth] signed url rejected: %v", err)
+			}
+			utils.SendErrorResponse(c, http.StatusUnauthorized, "图片链接无效或已过期，请重新打开邮件")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// setSignedURLUser 确认签名链接的用户仍处于启用状态且 token_version 未变化，并写入 context
+func setSignedURLUser(c *gin.Context, userID int64, tokenVersion uint) bool {
+	var user models.User
+	err := database.DB.Select("id", "username", "role", "status", "token_version").First(&user, userID).Error
+	if err != nil || !user.IsStatusActive() || user.TokenVersion != tokenVersion {
+		return false
+	}
+	c.Set("user_id", int64(user.ID))
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("auth_method", AuthMethodSignedURL)
+	return true
+}
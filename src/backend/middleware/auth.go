@@ -5,14 +5,25 @@ import (
     "log"
 
     "github.com/gin-gonic/gin"
+    "email_server/database"
+    "email_server/models"
     "email_server/utils"
 )
 
-// AuthRequired 需要登录认证的中间件
+// tokenRevoked token 签发后用户已被删除或重置了密码时返回 true
+func tokenRevoked(claims *utils.Claims) bool {
+    var user models.User
+    if err := database.DB.Select("token_version").Where("id = ?", claims.UserID).First(&user).Error; err != nil {
+        return true
+    }
+    return user.TokenVersion != claims.TokenVersion
+}
+
+// AuthRequired 需要登录认证的中间件，接受登录 JWT 和个人 API token
 func AuthRequired() gin.HandlerFunc {
     return gin.HandlerFunc(func(c *gin.Context) {
+        // 不记录 Authorization 头和 token 内容，避免日志泄露登录凭证
         authHeader := c.GetHeader("Authorization")
-        log.Printf("[AuthMiddleware] Path: %s, Received Authorization Header: %s", c.Request.URL.Path, authHeader)
 
         if authHeader == "" {
             log.Printf("[AuthMiddleware] Path: %s, Authorization Header is missing", c.Request.URL.Path)
@@ -24,21 +35,34 @@ func AuthRequired() gin.HandlerFunc {
         // Bearer token格式
         parts := strings.SplitN(authHeader, " ", 2)
         if !(len(parts) == 2 && parts[0] == "Bearer") {
-            log.Printf("[AuthMiddleware] Path: %s, Authorization Header format is incorrect: %s", c.Request.URL.Path, authHeader)
+            log.Printf("[AuthMiddleware] Path: %s, Authorization Header format is incorrect", c.Request.URL.Path)
             utils.SendErrorResponse(c, 401, "认证格式错误")
             c.Abort()
             return
         }
 
         tokenString := parts[1]
-        log.Printf("[AuthMiddleware] Path: %s, Token to parse: %s", c.Request.URL.Path, tokenString)
+        // 个人 API token 只能访问其权限范围内的接口
+        if strings.HasPrefix(tokenString, models.APITokenPrefix) {
+            if authenticateAPIToken(c, tokenString) {
+                c.Next()
+            }
+            return
+        }
+
         claims, err := utils.ParseToken(tokenString)
         if err != nil {
-            log.Printf("[AuthMiddleware] Path: %s, Token parsing failed. Error: %v. Token: %s", c.Request.URL.Path, err, tokenString)
+            log.Printf("[AuthMiddleware] Path: %s, Token parsing failed. Error: %v", c.Request.URL.Path, err)
             utils.SendErrorResponse(c, 401, "登录已过期，请重新登录")
             c.Abort()
             return
         }
+        if tokenRevoked(claims) {
+            log.Printf("[AuthMiddleware] Path: %s, Token has been revoked. UserID=%d", c.Request.URL.Path, claims.UserID)
+            utils.SendErrorResponse(c, 401, "登录已失效，请重新登录")
+            c.Abort()
+            return
+        }
         log.Printf("[AuthMiddleware] Path: %s, Token parsed successfully. Claims: UserID=%d, Username=%s, Role=%s", c.Request.URL.Path, claims.UserID, claims.Username, claims.Role)
 
         // 将用户信息存储到context中
@@ -69,7 +93,7 @@ func OptionalAuth() gin.HandlerFunc {
         if authHeader != "" {
             parts := strings.SplitN(authHeader, " ", 2)
             if len(parts) == 2 && parts[0] == "Bearer" {
-                if claims, err := utils.ParseToken(parts[1]); err == nil {
+                if claims, err := utils.ParseToken(parts[1]); err == nil && !tokenRevoked(claims) {
                     c.Set("user_id", claims.UserID)
                     c.Set("username", claims.Username)
                     c.Set("role", claims.Role)
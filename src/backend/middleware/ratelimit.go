@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"email_server/ratelimit"
+	"email_server/utils"
+)
+
+// maxPeekBodySize 读取请求体中的限流 key 时最多读取的字节数
+const maxPeekBodySize = 64 << 10
+
+// RateLimitKey 从请求中取出限流 key，返回空字符串表示该请求不按此 key 限流
+type RateLimitKey func(c *gin.Context) string
+
+// ByIP 按客户端 IP 限流
+func ByIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// ByUser 按登录用户限流，需放在 AuthRequired 之后
+func ByUser(c *gin.Context) string {
+	if userID := c.GetInt64("user_id"); userID != 0 {
+		return strconv.FormatInt(userID, 10)
+	}
+	return ""
+}
+
+// ByUserWhen 仅对满足条件的请求按登录用户限流，用于同一接口按参数区分限流规则
+func ByUserWhen(cond func(c *gin.Context) bool) RateLimitKey {
+	return func(c *gin.Context) string {
+		if !cond(c) {
+			return ""
+		}
+		return ByUser(c)
+	}
+}
+
+// ByJSONField 按 JSON 请求体中的字段（如登录用户名）限流，不区分大小写。读取后会还原请求体供处理器使用
+func ByJSONField(field string) RateLimitKey {
+	return func(c *gin.Context) string {
+		if c.Request.Body == nil {
+			return ""
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPeekBodySize))
+		if err != nil {
+			return ""
+		}
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+
+		var fields map[string]interface{}
+		if json.Unmarshal(body, &fields) != nil {
+			return ""
+		}
+		value, _ := fields[field].(string)
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+}
+
+// RateLimit 按 key 对路由（组）限流，超过限制时返回 429 并设置 Retry-After
+func RateLimit(limiter *ratelimit.Limiter, key RateLimitKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+		if allowed, retryAfter := limiter.Allow(k); !allowed {
+			log.Printf("[RateLimit] %s %s 超过限流 %s", c.Request.Method, c.FullPath(), limiter.Rule())
+			utils.SendTooManyRequests(c, retryAfter, "请求过于频繁，请稍后再试")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"email_server/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit_ByJSONFieldKeepsBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.New("test-login", ratelimit.Rule{Limit: 2, Window: time.Minute})
+	r := gin.New()
+	r.POST("/login", RateLimit(limiter, ByJSONField("username")), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	post := func(username string) *httptest.ResponseRecorder {
+		body := `{"username":"` + username + `","password":"x"}`
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"username":"alice"`, "处理器仍能读取完整请求体")
+	assert.Equal(t, http.StatusOK, post("Alice").Code)
+
+	// 用户名不区分大小写计数，超过后返回 429 和 Retry-After
+	w = post("ALICE")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, post("bob").Code)
+}
+
+func TestRateLimit_ByIPIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(name string, trustedProxies []string) *gin.Engine {
+		limiter := ratelimit.New(name, ratelimit.Rule{Limit: 2, Window: time.Minute})
+		r := gin.New()
+		assert.NoError(t, r.SetTrustedProxies(trustedProxies))
+		r.POST("/auth", RateLimit(limiter, ByIP), func(c *gin.Context) { c.Status(http.StatusOK) })
+		return r
+	}
+	post := func(r *gin.Engine, remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest("POST", "/auth", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 未配置可信代理：伪造的 X-Forwarded-For 不会换到新的计数
+	r := newRouter("test-auth-direct", nil)
+	assert.Equal(t, http.StatusOK, post(r, "203.0.113.7:1234", "10.0.0.1"))
+	assert.Equal(t, http.StatusOK, post(r, "203.0.113.7:1234", "10.0.0.2"))
+	assert.Equal(t, http.StatusTooManyRequests, post(r, "203.0.113.7:1234", "10.0.0.3"))
+
+	// 来自可信代理的请求按 X-Forwarded-For 中的客户端 IP 计数
+	r = newRouter("test-auth-proxy", []string{"192.0.2.1"})
+	assert.Equal(t, http.StatusOK, post(r, "192.0.2.1:1234", "198.51.100.1"))
+	assert.Equal(t, http.StatusOK, post(r, "192.0.2.1:1234", "198.51.100.1"))
+	assert.Equal(t, http.StatusTooManyRequests, post(r, "192.0.2.1:1234", "198.51.100.1"))
+	assert.Equal(t, http.StatusOK, post(r, "192.0.2.1:1234", "198.51.100.2"))
+	assert.Equal(t, http.StatusOK, post(r, "203.0.113.7:1234", "198.51.100.3"))
+	assert.Equal(t, http.StatusOK, post(r, "203.0.113.7:1234", "198.51.100.4"))
+	assert.Equal(t, http.StatusTooManyRequests, post(r, "203.0.113.7:1234", "198.51.100.5"), "不可信来源的请求仍按对端地址计数")
+}
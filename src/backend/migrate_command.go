@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"email_server/config"
+	"email_server/database"
+	"email_server/database/migrations"
+)
+
+const migrateUsage = `用法: email_server migrate <命令>
+
+命令:
+  status        显示所有迁移及其执行状态
+  up            执行所有未执行的迁移
+  down [N]      回滚最近执行的 N 个迁移（默认 1）
+  to VERSION    迁移到指定版本（向上执行或向下回滚），0 表示回滚全部可回滚的迁移
+`
+
+// runMigrateCommand 处理 migrate 子命令，SQLite 在修改结构前会自动备份
+func runMigrateCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	cfg := config.AppConfig.Database
+	db, err := database.Open(cfg)
+	if err != nil {
+		log.Fatal("❌ 数据库连接失败:", err)
+	}
+
+	backup := func() {
+		current, err := migrations.Current(db)
+		if err != nil {
+			log.Fatal("❌ 读取迁移状态失败:", err)
+		}
+		path, err := database.BackupSQLite(db, cfg, fmt.Sprintf("v%d", current))
+		if err != nil {
+			log.Fatal("❌ ", err)
+		}
+		if path != "" {
+			log.Printf("💾 已备份数据库: %s", path)
+		}
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrations.List(db)
+		if err != nil {
+			log.Fatal("❌ 读取迁移状态失败:", err)
+		}
+		current, _ := migrations.Current(db)
+		fmt.Printf("数据库驱动: %s，当前版本: %d\n\n", db.Dialector.Name(), current)
+		for _, s := range statuses {
+			applied := "未执行"
+			if s.Applied {
+				applied = "已执行 " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-32s %s\n", s.Version, s.Name, applied)
+		}
+		if current > 0 {
+			if err := migrations.CheckCompatible(db); err != nil {
+				fmt.Println()
+				fmt.Println("⚠️", err)
+			}
+		}
+
+	case "up":
+		if _, err := database.MigrateUp(db, cfg); err != nil {
+			log.Fatal("❌ 数据库迁移失败:", err)
+		}
+		log.Println("✅ 数据库结构已是最新")
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalf("❌ 无效的回滚步数: %s", args[1])
+			}
+		}
+		backup()
+		done, err := migrations.Down(db, steps)
+		if err != nil {
+			log.Fatalf("❌ 已回滚 %d 个迁移后失败: %v", done, err)
+		}
+		log.Printf("✅ 已回滚 %d 个迁移", done)
+
+	case "to":
+		if len(args) < 2 {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			os.Exit(2)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			log.Fatalf("❌ 无效的版本号: %s", args[1])
+		}
+		backup()
+		if err := migrations.To(db, version); err != nil {
+			log.Fatal("❌ 数据库迁移失败:", err)
+		}
+		log.Printf("✅ 数据库已迁移到版本 %d", version)
+
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"time"
+
+	"email_server/imappool"
+)
+
+// 注册模式
+const (
+	RegistrationModeOpen       = "open"        // 任何人都可以注册
+	RegistrationModeInviteOnly = "invite_only" // 只能凭管理员发出的邀请码注册
+	RegistrationModeDisabled   = "disabled"    // 关闭注册，只能由管理员创建用户
+)
+
+// SettingRegistrationMode 系统设置中注册模式的键
+const SettingRegistrationMode = "registration_mode"
+
+// SystemSetting 管理员可在运行时修改的系统设置（键值对）
+type SystemSetting struct {
+	Key       string `gorm:"primaryKey;type:varchar(100)"`
+	Value     string `gorm:"type:varchar(255);not null;default:''"`
+	UpdatedAt time.Time
+}
+
+// Invitation 管理员发出的注册邀请，邀请码只能使用一次
+type Invitation struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Code      string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Email     string     `json:"email" gorm:"type:varchar(255);not null;default:''"` // 为空时任意邮箱可用
+	Role      string     `json:"role" gorm:"type:varchar(20);not null;default:'user'"`
+	CreatedBy uint       `json:"created_by" gorm:"not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	UsedBy    *uint      `json:"used_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Status 邀请状态：pending / used / expired
+func (i *Invitation) Status() string {
+	switch {
+	case i.UsedAt != nil:
+		return "used"
+	case time.Now().After(i.ExpiresAt):
+		return "expired"
+	}
+	return "pending"
+}
+
+// InvitationResponse 返回给管理员的邀请信息，创建时附带邀请码和注册链接
+type InvitationResponse struct {
+	Invitation
+	Status    string `json:"status"`
+	Code      string `json:"code,omitempty"`
+	InviteURL string `json:"invite_url,omitempty"`
+	EmailSent bool   `json:"email_sent,omitempty"`
+}
+
+// CreateInvitationRequest 创建邀请
+type CreateInvitationRequest struct {
+	Email          string `json:"email" binding:"omitempty,email"`
+	Role           string `json:"role"`
+	ExpiresInHours int    `json:"expires_in_hours"` // 默认 72 小时
+}
+
+// AdminCreateUserRequest 管理员创建用户
+type AdminCreateUserRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=20"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password"` // 为空时生成临时密码
+	Role     string `json:"role"`
+	// MustChangePassword 是否要求首次登录后修改密码，默认 true
+	MustChangePassword *bool `json:"must_change_password"`
+}
+
+// AdminCreateUserResponse 创建用户的结果，临时密码只返回这一次
+type AdminCreateUserResponse struct {
+	User              *UserResponse `json:"user"`
+	TemporaryPassword string        `json:"temporary_password,omitempty"`
+}
+
+// AdminUserResponse 管理员用户列表中的用户及其数据统计
+type AdminUserResponse struct {
+	UserResponse
+	EmailAccountCount         int64 `json:"email_account_count"`
+	PlatformRegistrationCount int64 `json:"platform_registration_count"`
+	ServiceSubscriptionCount  int64 `json:"service_subscription_count"`
+
+	FailedLoginAttempts int        `json:"failed_login_attempts"`
+	LockedUntil         *time.Time `json:"locked_until"` // 为空或早于当前时间表示未锁定
+}
+
+// RegistrationSettings 注册设置
+type RegistrationSettings struct {
+	Mode string `json:"registration_mode" binding:"required,oneof=open invite_only disabled"`
+}
+
+// RegistrationInfo 注册页需要的信息
+type RegistrationInfo struct {
+	Mode                      string `json:"registration_mode"`
+	EmailVerificationRequired bool   `json:"email_verification_required"`
+}
+
+// JobStatus 定时任务的运行状态（进程启动后的统计）
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule"`
+	Enabled        bool       `json:"enabled"`
+	Runs           int        `json:"runs"`
+	LastRunAt      *time.Time `json:"last_run_at"`
+	LastDurationMs int64      `json:"last_duration_ms"`
+	LastError      string     `json:"last_error,omitempty"`
+}
+
+// OAuthTokenFailure 刷新或认证失败的邮箱 OAuth 令牌
+type OAuthTokenFailure struct {
+	TokenID      uint       `json:"token_id"`
+	UserID       uint       `json:"user_id"`
+	EmailAddress string     `json:"email_address"`
+	Provider     string     `json:"provider"`
+	FailureCount int        `json:"failure_count"`
+	LastError    string     `json:"last_error"`
+	LastErrorAt  *time.Time `json:"last_error_at"`
+}
+
+// SystemHealthResponse 系统状态
+type SystemHealthResponse struct {
+	Database struct {
+		Driver            string `json:"driver"`
+		SizeBytes         int64  `json:"size_bytes"`
+		SchemaVersion     int64  `json:"schema_version"`
+		PendingMigrations int    `json:"pending_migrations"`
+	} `json:"database"`
+	Counts      map[string]int64 `json:"counts"`
+	Jobs        []JobStatus      `json:"jobs"`
+	OAuthTokens struct {
+		Total    int64               `json:"total"`
+		Failing  int64               `json:"failing"`
+		Failures []OAuthTokenFailure `json:"failures"`
+	} `json:"oauth_tokens"`
+	// IMAPPool IMAP 连接池的连接数和累计计数（不含新邮件监听的 IDLE 连接）
+	IMAPPool imappool.Stats `json:"imap_pool"`
+}
+
+// UserDataExport 删除用户前导出的完整数据，敏感字段保持加密存储时的密文
+type UserDataExport struct {
+	ExportedAt time.Time                           `json:"exported_at"`
+	User       *UserResponse                       `json:"user"`
+	Tables     map[string][]map[string]interface{} `json:"tables"`
+}
+
+// DeleteUserResponse 删除用户的结果
+type DeleteUserResponse struct {
+	ExportFile string `json:"export_file"`
+}
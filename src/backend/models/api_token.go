@@ -0,0 +1,90 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APITokenPrefix 个人 API token 的前缀，用于与登录 JWT 区分
+const APITokenPrefix = "est_"
+
+// API token 权限范围
+const (
+	ScopeAccountsRead       = "accounts:read"       // 查看邮箱账户
+	ScopeAccountsWrite      = "accounts:write"      // 创建、修改、删除邮箱账户
+	ScopeRegistrationsRead  = "registrations:read"  // 查看平台和平台注册信息
+	ScopeRegistrationsWrite = "registrations:write" // 创建、修改、删除平台和平台注册信息
+	ScopeSubscriptionsRead  = "subscriptions:read"  // 查看服务订阅
+	ScopeSubscriptionsWrite = "subscriptions:write" // 创建、修改、删除服务订阅
+	ScopeSecretsReveal      = "secrets:reveal"      // 查看明文密码
+	ScopeInboxRead          = "inbox:read"          // 读取收件箱
+	ScopeInboxWrite         = "inbox:write"         // 修改邮件状态
+)
+
+// APITokenScopes 全部可用的权限范围
+var APITokenScopes = []string{
+	ScopeAccountsRead, ScopeAccountsWrite,
+	ScopeRegistrationsRead, ScopeRegistrationsWrite,
+	ScopeSubscriptionsRead, ScopeSubscriptionsWrite,
+	ScopeSecretsReveal,
+	ScopeInboxRead, ScopeInboxWrite,
+}
+
+// IsValidAPITokenScope 是否为可用的权限范围
+func IsValidAPITokenScope(scope string) bool {
+	for _, s := range APITokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken 用户为脚本、浏览器插件等创建的个人 API token，只能访问其权限范围内的接口。
+// 数据库中只保存 token 的哈希，明文只在创建时返回一次
+type APIToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"not null;index"`
+	Name       string     `json:"name" gorm:"type:varchar(100);not null"`
+	TokenHash  string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Hint       string     `json:"hint" gorm:"type:varchar(20);not null"` // token 开头几位，便于用户辨认
+	Scopes     string     `json:"-" gorm:"type:varchar(500);not null"`   // 以空格分隔
+	ExpiresAt  *time.Time `json:"expires_at"`                            // 为空表示永不过期
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip" gorm:"type:varchar(64);not null;default:''"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ScopeList 权限范围列表
+func (t *APIToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// HasScope 是否授予了权限范围
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired 是否已过期
+func (t *APIToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// APITokenResponse 返回给用户的 API token 信息，创建时附带明文 token
+type APITokenResponse struct {
+	APIToken
+	Scopes []string `json:"scopes"`
+	Token  string   `json:"token,omitempty"`
+}
+
+// CreateAPITokenRequest 创建 API token
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 表示永不过期
+}
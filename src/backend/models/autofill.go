@@ -0,0 +1,68 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// 自动填充匹配方式，按匹配程度从高到低
+const (
+	AutofillMatchExact      = "exact"      // 主机名完全相同
+	AutofillMatchDomain     = "domain"     // 同一可注册域名下的子域名
+	AutofillMatchEquivalent = "equivalent" // 属于同一组等价域名
+	AutofillMatchApp        = "app"        // App ID 相同
+)
+
+// EquivalentDomain 用户自定义的一组等价域名（同一账号体系在多个域名下登录，如 google.com 与 youtube.com）
+type EquivalentDomain struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"-" gorm:"not null;index"`
+	Domains   string    `json:"-" gorm:"type:text;not null"` // 以空格分隔的可注册域名
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DomainList 域名列表
+func (e *EquivalentDomain) DomainList() []string {
+	return strings.Fields(e.Domains)
+}
+
+// EquivalentDomainResponse 等价域名组，内置的组没有 ID
+type EquivalentDomainResponse struct {
+	ID      uint     `json:"id,omitempty"`
+	Domains []string `json:"domains"`
+	BuiltIn bool     `json:"built_in"`
+}
+
+// CreateEquivalentDomainRequest 添加等价域名组
+type CreateEquivalentDomainRequest struct {
+	Domains []string `json:"domains" binding:"required,min=2,max=50"`
+}
+
+// AutofillTOTP 当前的 TOTP 验证码
+type AutofillTOTP struct {
+	Code      string `json:"code"`
+	ExpiresIn int    `json:"expires_in"` // 剩余有效秒数
+}
+
+// AutofillMatch 与页面网址匹配的平台注册信息
+type AutofillMatch struct {
+	RegistrationID uint          `json:"registration_id"`
+	PlatformID     uint          `json:"platform_id"`
+	PlatformName   string        `json:"platform_name"`
+	Match          string        `json:"match"`       // exact / domain / equivalent / app
+	MatchedURL     string        `json:"matched_url"` // 命中的平台网址或 App ID
+	LoginUsername  string        `json:"login_username"`
+	EmailAddress   string        `json:"email_address"`
+	HasPassword    bool          `json:"has_password"`
+	HasTOTP        bool          `json:"has_totp"`
+	Password       string        `json:"password,omitempty"`
+	TOTP           *AutofillTOTP `json:"totp,omitempty"`
+}
+
+// AutofillResponse 自动填充查询结果
+type AutofillResponse struct {
+	Host       string          `json:"host,omitempty"`
+	BaseDomain string          `json:"base_domain,omitempty"`
+	AppID      string          `json:"app_id,omitempty"`
+	Matches    []AutofillMatch `json:"matches"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// CachedEmail 缓存从邮件服务商拉取到的邮件摘要/正文，用于全文搜索
+type CachedEmail struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"not null;index"`
+	EmailAccountID uint   `gorm:"not null;uniqueIndex:uq_cached_email_message,priority:1"`
+	MessageID      string `gorm:"type:varchar(512);not null;uniqueIndex:uq_cached_email_message,priority:2"` // 服务商侧的邮件ID，与收件箱接口返回的 messageId 一致
+	// InternetMessageID 邮件头中的 Message-ID，IMAP 的 UIDVALIDITY 变化导致原ID失效时用于重新定位邮件
+	InternetMessageID string    `gorm:"type:varchar(512);index"`
+	Folder            string    `gorm:"type:varchar(255)"`
+	Subject           string    `gorm:"type:text"`
+	FromName          string    `gorm:"type:varchar(255)"`
+	FromAddress       string    `gorm:"type:varchar(255);index"`
+	Snippet           string    `gorm:"type:text"`
+	Body              string    `gorm:"type:text"` // 纯文本正文，仅在查看过邮件详情后才有
+	Date              time.Time `gorm:"index"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// NewCachedEmail 根据邮件数据构造缓存记录
+func NewCachedEmail(userID, emailAccountID uint, folder string, email Email) CachedEmail {
+	cached := CachedEmail{
+		UserID:            userID,
+		EmailAccountID:    emailAccountID,
+		MessageID:         email.MessageID,
+		InternetMessageID: email.InternetMessageID,
+		Folder:            strings.ToLower(folder),
+		Subject:           email.Subject,
+		Snippet:           email.Snippet,
+		Body:              email.Body,
+		Date:              email.Date,
+	}
+	if len(email.From) > 0 {
+		cached.FromName = email.From[0].Name
+		cached.FromAddress = strings.ToLower(email.From[0].Address)
+	}
+	return cached
+}
@@ -5,7 +5,7 @@ import "time"
 // Email represents the structure for an email message.
 type Email struct {
 	ID            uint           `json:"id"`
-	MessageID     string         `json:"messageId"`
+	MessageID     string         `json:"messageId"` // 服务商侧的邮件ID；IMAP 邮件为编码了文件夹、UIDVALIDITY 和 UID 的不透明ID
 	Subject       string         `json:"subject"`
 	From          []EmailAddress `json:"from"`
 	To            []EmailAddress `json:"to"`
@@ -17,6 +17,25 @@ type Email struct {
 	IsRead        bool           `json:"isRead"`
 	HasAttachment bool           `json:"hasAttachment"`
 	Attachments   []Attachment   `json:"attachments"`
+	PlatformID    uint           `json:"platformId,omitempty"` // 按发件人域名匹配到的平台
+	PlatformName  string         `json:"platformName,omitempty"`
+	// InternetMessageID 邮件头中的 Message-ID（不含尖括号），可能为空
+	InternetMessageID string `json:"internetMessageId,omitempty"`
+	// ThreadID 所属会话的ID：Gmail 为 threadId，Graph 为 conversationId，IMAP 仅在会话接口中返回
+	ThreadID string `json:"threadId,omitempty"`
+	// BlockedResources HTML 正文中被阻止的远程图片、外部样式、脚本和表单
+	BlockedResources []BlockedResource `json:"blockedResources,omitempty"`
+	// RemoteContentAllowed 远程图片已通过图片代理显示（发件人在允许列表中或本次请求允许）
+	RemoteContentAllowed bool `json:"remoteContentAllowed"`
+	// AccountID、AccountEmail 邮件所属的邮箱账户，仅在统一收件箱中返回
+	AccountID    uint   `json:"accountId,omitempty"`
+	AccountEmail string `json:"accountEmail,omitempty"`
+}
+
+// BlockedResource 邮件正文中被阻止的资源
+type BlockedResource struct {
+	Type string `json:"type"` // image / stylesheet / script / form / frame / object / media
+	URL  string `json:"url,omitempty"`
 }
 
 // EmailAddress represents a single email address (name and address).
@@ -27,8 +46,83 @@ type EmailAddress struct {
 
 // Attachment represents an email attachment.
 type Attachment struct {
+	// ID 服务商侧的附件ID：IMAP 和 Gmail 为 MIME 分段编号（如 "2.1"），Graph 为附件ID
+	ID        string `json:"id"`
 	Filename  string `json:"filename"`
 	MimeType  string `json:"mimeType"`
 	Size      int64  `json:"size"`
 	ContentID string `json:"contentId"` // Used for inline images
-}
\ No newline at end of file
+	Inline    bool   `json:"inline"`
+	// URL 下载地址，带有时效的签名，可直接用于 <img> 和下载链接
+	URL string `json:"url,omitempty"`
+}
+
+// 邮件操作类型
+const (
+	MessageActionMarkRead   = "mark_read"
+	MessageActionMarkUnread = "mark_unread"
+	MessageActionFlag       = "flag"   // 加星标
+	MessageActionUnflag     = "unflag" // 取消星标
+	MessageActionMove       = "move"   // 移动到 Folder 指定的文件夹
+	MessageActionArchive    = "archive"
+	MessageActionTrash      = "trash"    // 移到已删除文件夹
+	MessageActionDelete     = "delete"   // 永久删除
+	MessageActionSpam       = "spam"     // 移到垃圾邮件
+	MessageActionNotSpam    = "not_spam" // 从垃圾邮件移回收件箱
+)
+
+// MessageActionTypes 全部邮件操作类型
+var MessageActionTypes = []string{
+	MessageActionMarkRead, MessageActionMarkUnread, MessageActionFlag, MessageActionUnflag,
+	MessageActionMove, MessageActionArchive, MessageActionTrash, MessageActionDelete,
+	MessageActionSpam, MessageActionNotSpam,
+}
+
+// MessageActionRequest 对单封邮件执行操作
+type MessageActionRequest struct {
+	Action string `json:"action" binding:"required"`
+	// Folder 移动的目标文件夹：inbox、archive、trash、spam 等通用名称，或服务商侧的文件夹名称（IMAP）、标签ID（Gmail）、文件夹ID（Graph）
+	Folder string `json:"folder"`
+}
+
+// BatchMessageActionRequest 对同一邮箱账户的多封邮件执行操作
+type BatchMessageActionRequest struct {
+	AccountID  uint     `json:"account_id" binding:"required"`
+	MessageIDs []string `json:"message_ids" binding:"required,min=1,max=100,dive,required"`
+	Action     string   `json:"action" binding:"required"`
+	Folder     string   `json:"folder"`
+}
+
+// MessageActionResult 单封邮件的操作结果
+type MessageActionResult struct {
+	MessageID string `json:"messageId"`
+	// NewMessageID 移动后服务商分配的新ID（IMAP 邮件的 UID 和 Graph 邮件的ID在移动后会变化），未变化或未知时为空
+	NewMessageID string `json:"newMessageId,omitempty"`
+	Error        string `json:"error,omitempty"`
+	// Err 原始错误，供处理函数判断错误类型
+	Err error `json:"-"`
+}
+
+// UnifiedInboxAccount 统一收件箱中单个邮箱账户的获取结果
+type UnifiedInboxAccount struct {
+	AccountID    uint   `json:"accountId"`
+	EmailAddress string `json:"emailAddress"`
+	Count        int    `json:"count"`           // 过滤后的邮件数量
+	Error        string `json:"error,omitempty"` // 获取失败或超时的原因
+}
+
+// EmailThread 会话（一组互相回复的邮件）
+type EmailThread struct {
+	// ID 会话ID：Gmail 为 threadId，Graph 为 conversationId，IMAP 为编码了文件夹和根邮件 Message-ID 的不透明ID
+	ID            string         `json:"id"`
+	Subject       string         `json:"subject"` // 最早一封邮件的主题
+	Snippet       string         `json:"snippet"` // 最新一封邮件的摘要
+	MessageCount  int            `json:"messageCount"`
+	Participants  []EmailAddress `json:"participants"` // 发件人和收件人，按地址去重，按首次出现的顺序排列
+	LatestDate    time.Time      `json:"latestDate"`
+	Unread        bool           `json:"unread"` // 至少有一封未读邮件
+	UnreadCount   int            `json:"unreadCount"`
+	HasAttachment bool           `json:"hasAttachment"`
+	// Messages 会话中的邮件，按日期升序，仅在会话详情中返回
+	Messages []Email `json:"messages,omitempty"`
+}
@@ -5,18 +5,26 @@ import "gorm.io/gorm"
 // EmailAccount 定义了邮箱账户的数据模型
 type EmailAccount struct {
 	gorm.Model
-	UserID            uint   `gorm:"not null;index;uniqueIndex:uq_user_email,priority:1"`             // 外键，关联到 User 模型
-	EmailAddress      string `gorm:"type:varchar(255);not null;uniqueIndex:uq_user_email,priority:2"` // 与UserID组合唯一
-	PasswordEncrypted string `gorm:"type:varchar(255)"`                                               // 加密存储的密码, 允许为空
-	Provider          string `gorm:"type:varchar(100)"`                                               // 邮箱服务商，例如 Gmail, Outlook 等
-	IMAPServer        string `gorm:"type:varchar(255)"`                                               // IMAP 服务器地址
-	IMAPPort          int    `gorm:"type:int"`                                                        // IMAP 服务器端口
-	Notes             string `gorm:"type:text"`                                                       // 备注信息
-	PhoneNumber       string `gorm:"type:varchar(50)"`                                                // 手机号码, 可选
+	UserID            uint   `gorm:"not null;index;uniqueIndex:uq_user_email_active,priority:1,where:deleted_at IS NULL"` // 外键，关联到 User 模型
+	EmailAddress      string `gorm:"type:varchar(255);not null;uniqueIndex:uq_user_email_active,priority:2"`              // 与UserID组合唯一
+	PasswordEncrypted string `gorm:"type:varchar(255)"`                                                                   // 加密存储的密码, 允许为空
+	Provider          string `gorm:"type:varchar(100)"`                                                                   // 邮箱服务商，例如 Gmail, Outlook 等
+	IMAPServer        string `gorm:"type:varchar(255)"`                                                                   // IMAP 服务器地址
+	IMAPPort          int    `gorm:"type:int"`                                                                            // IMAP 服务器端口
+	IMAPSecurity      string `gorm:"type:varchar(16)"`                                                                    // IMAP 加密方式，见 IMAPSecurity* 常量，为空时按端口推断
+	Notes             string `gorm:"type:text"`                                                                           // 备注信息
+	PhoneNumber       string `gorm:"type:varchar(50)"`                                                                    // 手机号码, 可选
 
 	User User `gorm:"foreignKey:UserID"` // 定义关联关系
 }
 
+// IMAP 加密方式
+const (
+	IMAPSecurityTLS      = "tls"      // 连接即 TLS（通常为 993 端口）
+	IMAPSecurityStartTLS = "starttls" // 明文连接后升级为 TLS（通常为 143 端口）
+	IMAPSecurityNone     = "none"     // 不加密，仅用于内网或本地测试服务器
+)
+
 // EmailAccountResponse 用于API响应，不包含敏感信息
 type EmailAccountResponse struct {
 	ID               uint   `json:"id"`
@@ -24,6 +32,7 @@ type EmailAccountResponse struct {
 	Provider         string `json:"provider"`
 	IMAPServer       string `json:"imap_server"`
 	IMAPPort         int    `json:"imap_port"`
+	IMAPSecurity     string `json:"imap_security"`
 	Notes            string `json:"notes"`
 	PhoneNumber      string `json:"phone_number,omitempty"`
 	PlatformCount    int64  `json:"platform_count"` // 添加关联平台数量字段
@@ -42,6 +51,7 @@ func (ea *EmailAccount) ToEmailAccountResponse() EmailAccountResponse {
 		Provider:     ea.Provider,
 		IMAPServer:   ea.IMAPServer,
 		IMAPPort:     ea.IMAPPort,
+		IMAPSecurity: ea.IMAPSecurity,
 		Notes:        ea.Notes,
 		PhoneNumber:  ea.PhoneNumber,
 		HasPassword:  ea.PasswordEncrypted != "", // 检查是否设置了密码
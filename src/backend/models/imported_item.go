@@ -6,9 +6,16 @@ type ImportedLoginItem struct {
 	ItemName     string            `json:"item_name"`     // 条目名称
 	Username     string            `json:"username"`      // 用户名
 	Password     string            `json:"password"`      // 密码 (可选，根据用户选择导入)
-	URL          string            `json:"url"`           // 相关 URL
+	URL          string            `json:"url"`           // 相关 URL（第一个网址）
+	URLs         []ImportedURL     `json:"urls"`          // 全部网址及匹配方式，导入为平台网址
 	Notes        string            `json:"notes"`         // 备注信息
 	Folder       string            `json:"folder"`        // 文件夹名称 (可选)
 	TOTP         string            `json:"totp"`          // TOTP 密钥 (可选)
 	CustomFields map[string]string `json:"custom_fields"` // 自定义字段 (可选)
-}
\ No newline at end of file
+}
+
+// ImportedURL 导入条目中的一个网址
+type ImportedURL struct {
+	URL       string `json:"url"`
+	MatchMode string `json:"match_mode"` // base_domain / host / starts_with / regex
+}
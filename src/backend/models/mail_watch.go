@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// 新邮件监听方式
+const (
+	MailWatchMethodIMAPIdle     = "imap_idle"     // IMAP IDLE 长连接，服务器不支持 IDLE 时定期检查
+	MailWatchMethodGmailHistory = "gmail_history" // 定期调用 Gmail history.list
+	MailWatchMethodGraphDelta   = "graph_delta"   // 定期调用 Graph delta 查询，配置了通知地址时由变更通知触发
+)
+
+// 监听状态
+const (
+	MailWatchStatusStarting  = "starting"
+	MailWatchStatusWatching  = "watching"
+	MailWatchStatusWaiting   = "waiting" // 等待空闲的 IMAP 连接名额
+	MailWatchStatusRetrying  = "retrying"
+	MailWatchStatusStopped   = "stopped"
+	MailWatchStatusSuspended = "suspended" // 授权失效等无法自动恢复的错误，需要用户处理后重新开启
+)
+
+// MailWatch 用户为邮箱账户开启的新邮件监听，每个账户最多一条
+type MailWatch struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	UserID         uint   `json:"-" gorm:"not null;index"`
+	EmailAccountID uint   `json:"accountId" gorm:"not null;uniqueIndex"`
+	Method         string `json:"method" gorm:"type:varchar(20);not null"`
+	// Cursor 上次检查到的位置：IMAP 为 "UIDVALIDITY:UID"，Gmail 为 historyId，Graph 为 deltaLink
+	Cursor string `json:"-" gorm:"type:text"`
+	// EnabledAt 开启时间，早于该时间收到的邮件不产生事件
+	EnabledAt time.Time `json:"enabledAt"`
+	// SubscriptionID、SubscriptionExpiresAt、ClientState Graph 变更通知订阅，未配置通知地址时为空
+	SubscriptionID        string     `json:"-" gorm:"type:varchar(255);index"`
+	SubscriptionExpiresAt *time.Time `json:"-"`
+	ClientState           string     `json:"-" gorm:"type:varchar(64)"`
+	Status                string     `json:"status" gorm:"type:varchar(20)"`
+	LastError             string     `json:"lastError,omitempty" gorm:"type:text"`
+	LastCheckedAt         *time.Time `json:"lastCheckedAt"`
+	LastEventAt           *time.Time `json:"lastEventAt"`
+	CreatedAt             time.Time  `json:"createdAt"`
+	UpdatedAt             time.Time  `json:"updatedAt"`
+}
+
+// NewMailEvent 监听发现的新邮件，同一账户的同一封邮件只记录一次
+type NewMailEvent struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	UserID         uint      `json:"-" gorm:"not null;index"`
+	EmailAccountID uint      `json:"accountId" gorm:"not null;uniqueIndex:uq_new_mail_event,priority:1"`
+	MessageID      string    `json:"messageId" gorm:"type:varchar(512);not null;uniqueIndex:uq_new_mail_event,priority:2"`
+	ThreadID       string    `json:"threadId,omitempty" gorm:"type:varchar(512)"`
+	Subject        string    `json:"subject" gorm:"type:varchar(1000)"`
+	FromName       string    `json:"fromName" gorm:"type:varchar(255)"`
+	FromAddress    string    `json:"fromAddress" gorm:"type:varchar(255)"`
+	Snippet        string    `json:"snippet" gorm:"type:text"`
+	ReceivedAt     time.Time `json:"receivedAt"`
+	CreatedAt      time.Time `json:"createdAt" gorm:"index"`
+}
+
+// UpdateMailWatchRequest 开启或关闭邮箱账户的新邮件监听
+type UpdateMailWatchRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
@@ -29,6 +29,9 @@ type GlobalSearchResultItem struct {
 	Type        string      `json:"type"`         // e.g., "user", "email_account", "platform", "platform_registration", "service_subscription"
 	DisplayName string      `json:"display_name"` // A user-friendly name for the item
 	Details     interface{} `json:"details,omitempty"` // Additional details specific to the item type
+	Score       float64     `json:"score"`              // Relevance score, higher is more relevant
+	Highlight   string      `json:"highlight,omitempty"` // DisplayName with matched terms wrapped in <mark> (HTML-escaped)
+	Snippet     string      `json:"snippet,omitempty"`   // Body excerpt with matched terms wrapped in <mark> (HTML-escaped)
 }
 
 // GlobalSearchResponse defines the structure for the global search API response.
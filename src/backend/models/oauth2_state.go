@@ -10,10 +10,9 @@ type OAuth2State struct {
 	State        string `gorm:"primaryKey"`
 	UserID       uint   // 发起OAuth2流程的用户ID，对登录流程可以为0
 	AccountID    uint   // 用于关联邮箱账户，对登录流程可以为0
-	PKCEVerifier string `gorm:"type:text"` // PKCE验证器，对LinuxDo流程可以为空
+	Provider     string `gorm:"type:varchar(50);not null;default:''"` // 发起流程的提供商名称
+	Nonce        string `gorm:"type:varchar(64);not null;default:''"` // OIDC nonce，用于校验 ID Token
+	PKCEVerifier string `gorm:"type:text"`                            // PKCE验证器，对LinuxDo流程可以为空
 	ExpiresAt    time.Time
 	CreatedAt    time.Time `gorm:"autoCreateTime"`
 }
-
-// 在数据库初始化时，请确保运行了迁移
-// database.DB.AutoMigrate(&models.OAuth2State{})
@@ -1,18 +1,100 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+// OAuth 提供商类型
+const (
+	OAuthProviderTypeOAuth2 = "oauth2" // 普通 OAuth2，需手动配置各端点
+	OAuthProviderTypeOIDC   = "oidc"   // OpenID Connect，通过 IssuerURL 自动发现端点并校验 ID Token
+)
 
 // OAuthProvider stores configuration for each supported OAuth2 provider.
 type OAuthProvider struct {
-	ID                   uint      `gorm:"primaryKey;autoIncrement"`
-	Name                 string    `gorm:"type:varchar(50);not null;unique"` // e.g., 'google', 'microsoft'
-	ClientID             string    `gorm:"type:varchar(255);not null"`
-	ClientSecretEncrypted string    `gorm:"type:varchar(512);not null"`      // Encrypted client secret
-	AuthURL              string    `gorm:"type:varchar(255);not null"`
-	TokenURL             string    `gorm:"type:varchar(255);not null"`
-	Scopes               string    `gorm:"type:text;not null"` // Comma-separated list of scopes
-	IMAPServer           string    `gorm:"type:varchar(255);not null;default:''"`
-	IMAPPort             int       `gorm:"not null;default:0"`
-	CreatedAt            time.Time `gorm:"autoCreateTime"`
-	UpdatedAt            time.Time `gorm:"autoUpdateTime"`
-}
\ No newline at end of file
+	ID                    uint      `gorm:"primaryKey;autoIncrement"`
+	Name                  string    `gorm:"type:varchar(50);not null;unique"` // e.g., 'google', 'microsoft'
+	DisplayName           string    `gorm:"type:varchar(100);not null;default:''"`
+	Type                  string    `gorm:"type:varchar(20);not null;default:'oauth2'"` // oauth2 / oidc
+	IssuerURL             string    `gorm:"type:varchar(255);not null;default:''"`      // OIDC issuer，用于 discovery
+	ClientID              string    `gorm:"type:varchar(255);not null"`
+	ClientSecretEncrypted string    `gorm:"type:varchar(512);not null"` // Encrypted client secret
+	AuthURL               string    `gorm:"type:varchar(255);not null"`
+	TokenURL              string    `gorm:"type:varchar(255);not null"`
+	UserInfoURL           string    `gorm:"type:varchar(255);not null;default:''"`
+	Scopes                string    `gorm:"type:text;not null"` // Comma-separated list of scopes
+	IMAPServer            string    `gorm:"type:varchar(255);not null;default:''"`
+	IMAPPort              int       `gorm:"not null;default:0"`
+	SMTPServer            string    `gorm:"type:varchar(255);not null;default:''"`
+	SMTPPort              int       `gorm:"not null;default:0"`
+	Enabled               bool      `gorm:"not null"` // 停用后不能登录、关联或刷新令牌
+	LoginEnabled          bool      `gorm:"not null"` // 可用于登录本系统
+	MailboxEnabled        bool      `gorm:"not null"` // 可用于关联邮箱 (IMAP/SMTP XOAUTH2)
+	CreatedAt             time.Time `gorm:"autoCreateTime"`
+	UpdatedAt             time.Time `gorm:"autoUpdateTime"`
+}
+
+// ScopeList 拆分 Scopes，兼容逗号和空格分隔
+func (p *OAuthProvider) ScopeList() []string {
+	return strings.FieldsFunc(p.Scopes, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// OAuthProviderResponse 返回给管理员的提供商信息，不包含 client secret
+type OAuthProviderResponse struct {
+	ID              uint      `json:"id"`
+	Name            string    `json:"name"`
+	DisplayName     string    `json:"display_name"`
+	Type            string    `json:"type"`
+	IssuerURL       string    `json:"issuer_url"`
+	ClientID        string    `json:"client_id"`
+	HasClientSecret bool      `json:"has_client_secret"`
+	AuthURL         string    `json:"auth_url"`
+	TokenURL        string    `json:"token_url"`
+	UserInfoURL     string    `json:"user_info_url"`
+	Scopes          []string  `json:"scopes"`
+	IMAPServer      string    `json:"imap_server"`
+	IMAPPort        int       `json:"imap_port"`
+	SMTPServer      string    `json:"smtp_server"`
+	SMTPPort        int       `json:"smtp_port"`
+	Enabled         bool      `json:"enabled"`
+	LoginEnabled    bool      `json:"login_enabled"`
+	MailboxEnabled  bool      `json:"mailbox_enabled"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ToResponse 转换为管理员响应结构
+func (p *OAuthProvider) ToResponse() OAuthProviderResponse {
+	return OAuthProviderResponse{
+		ID:              p.ID,
+		Name:            p.Name,
+		DisplayName:     p.DisplayName,
+		Type:            p.Type,
+		IssuerURL:       p.IssuerURL,
+		ClientID:        p.ClientID,
+		HasClientSecret: p.ClientSecretEncrypted != "",
+		AuthURL:         p.AuthURL,
+		TokenURL:        p.TokenURL,
+		UserInfoURL:     p.UserInfoURL,
+		Scopes:          p.ScopeList(),
+		IMAPServer:      p.IMAPServer,
+		IMAPPort:        p.IMAPPort,
+		SMTPServer:      p.SMTPServer,
+		SMTPPort:        p.SMTPPort,
+		Enabled:         p.Enabled,
+		LoginEnabled:    p.LoginEnabled,
+		MailboxEnabled:  p.MailboxEnabled,
+		CreatedAt:       p.CreatedAt,
+		UpdatedAt:       p.UpdatedAt,
+	}
+}
+
+// PublicOAuthProvider 登录页展示的提供商信息
+type PublicOAuthProvider struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Type        string `json:"type"`
+}
@@ -1,41 +1,124 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"email_server/urlmatch"
+)
 
 // Platform 定义了注册平台的数据模型
 type Platform struct {
 	gorm.Model
-	UserID     uint   `gorm:"not null;uniqueIndex:uq_user_platform_name,priority:1"`                   // 外键，关联到 User 模型
-	Name       string `gorm:"type:varchar(255);not null;uniqueIndex:uq_user_platform_name,priority:2"` // 平台名称, 用户ID和平台名称组合唯一
-	WebsiteURL string `gorm:"type:varchar(255)"`                                                       // 平台官方网址
-	Notes      string `gorm:"type:text"`                                                               // 备注信息
+	UserID     uint   `gorm:"not null;uniqueIndex:uq_user_platform_name_active,priority:1,where:deleted_at IS NULL"` // 外键，关联到 User 模型
+	Name       string `gorm:"type:varchar(255);not null;uniqueIndex:uq_user_platform_name_active,priority:2"`        // 平台名称, 用户ID和平台名称组合唯一
+	WebsiteURL string `gorm:"type:varchar(255)"`                                                                     // 平台官方网址
+	Notes      string `gorm:"type:text"`                                                                             // 备注信息
+	// CatalogPlatformID 关联的平台目录条目，创建时按名称或域名自动关联
+	CatalogPlatformID *uint `gorm:"index"`
+
+	User    User             `gorm:"foreignKey:UserID"`            // 定义关联关系
+	URLs    []PlatformURL    `gorm:"foreignKey:PlatformID"`        // 其他登录网址及匹配规则
+	Catalog *CatalogPlatform `gorm:"foreignKey:CatalogPlatformID"` // 平台目录条目，需要预加载
+}
+
+// PlatformURL 平台的一个网址或 App ID 及其匹配方式，用于搜索、自动填充和按发件人域名识别邮件所属平台。
+// 平台的 WebsiteURL 本身也按 base_domain 参与匹配
+type PlatformURL struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"not null;index"`
+	PlatformID uint   `gorm:"not null;index"`
+	URL        string `gorm:"type:varchar(2048);not null"`
+	MatchMode  string `gorm:"type:varchar(20);not null;default:'base_domain'"` // base_domain / host / starts_with / regex
+	CreatedAt  time.Time
+}
 
-	User User `gorm:"foreignKey:UserID"` // 定义关联关系
+// PlatformURLResponse 平台网址的API响应
+type PlatformURLResponse struct {
+	ID        uint   `json:"id"`
+	URL       string `json:"url"`
+	MatchMode string `json:"match_mode"`
+}
+
+// PlatformURLInput 创建/更新平台时提交的网址
+type PlatformURLInput struct {
+	URL       string `json:"url"`
+	MatchMode string `json:"match_mode"` // 为空时为 base_domain
+}
+
+// Rule 转换为匹配规则
+func (u *PlatformURL) Rule() urlmatch.Rule {
+	return urlmatch.Rule{Pattern: u.URL, Mode: u.MatchMode}
 }
 
 // PlatformResponse 用于API响应
 type PlatformResponse struct {
-	ID                uint   `json:"id"`
-	UserID            uint   `json:"user_id"` // 添加 UserID
-	Name              string `json:"name"`
-	WebsiteURL        string `json:"website_url"`
-	Notes             string `json:"notes"`
-	EmailAccountCount int64  `json:"email_account_count"` // 添加关联邮箱数量字段
-	CreatedAt         string `json:"created_at"`
-	UpdatedAt         string `json:"updated_at"`
+	ID                uint                     `json:"id"`
+	UserID            uint                     `json:"user_id"` // 添加 UserID
+	Name              string                   `json:"name"`
+	WebsiteURL        string                   `json:"website_url"`
+	URLs              []PlatformURLResponse    `json:"urls"` // 其他登录网址及匹配规则，需要预加载 URLs
+	Notes             string                   `json:"notes"`
+	CatalogPlatformID *uint                    `json:"catalog_platform_id"`
+	Catalog           *CatalogPlatformResponse `json:"catalog,omitempty"`   // 平台目录信息（分类、修改密码地址、2FA 等），需要预加载 Catalog
+	FaviconURL        string                   `json:"favicon_url"`         // 服务器缓存的图标
+	EmailAccountCount int64                    `json:"email_account_count"` // 添加关联邮箱数量字段
+	CreatedAt         string                   `json:"created_at"`
+	UpdatedAt         string                   `json:"updated_at"`
 }
 
 // ToPlatformResponse 将 Platform 模型转换为 PlatformResponse
 // 注意：EmailAccountCount 需要在调用此方法前被填充
 func (p *Platform) ToPlatformResponse() PlatformResponse {
-	return PlatformResponse{
-		ID:         p.ID,
-		UserID:     p.UserID, // 添加 UserID
-		Name:       p.Name,
-		WebsiteURL: p.WebsiteURL,
-		Notes:      p.Notes,
+	response := PlatformResponse{
+		ID:                p.ID,
+		UserID:            p.UserID, // 添加 UserID
+		Name:              p.Name,
+		WebsiteURL:        p.WebsiteURL,
+		URLs:              p.urlResponses(),
+		Notes:             p.Notes,
+		CatalogPlatformID: p.CatalogPlatformID,
 		// EmailAccountCount: 0, // 这里暂时不直接赋值，由 handler 处理
 		CreatedAt: p.CreatedAt.Format("2006-01-02 15:04:05"),
 		UpdatedAt: p.UpdatedAt.Format("2006-01-02 15:04:05"),
 	}
+	if p.Catalog != nil {
+		catalog := p.Catalog.ToResponse()
+		response.Catalog = &catalog
+	}
+	response.FaviconURL = FaviconPath(p.iconHost())
+	return response
+}
+
+// iconHost 平台图标对应的主机名：优先使用官方网址，其次是平台目录的主域名
+func (p *Platform) iconHost() string {
+	if addr, ok := urlmatch.Parse(p.WebsiteURL); ok && addr.Host != "" {
+		return addr.Host
+	}
+	if p.Catalog != nil {
+		return p.Catalog.PrimaryDomain()
+	}
+	return ""
+}
+
+// urlResponses 转换平台网址列表
+func (p *Platform) urlResponses() []PlatformURLResponse {
+	urls := make([]PlatformURLResponse, 0, len(p.URLs))
+	for _, u := range p.URLs {
+		urls = append(urls, PlatformURLResponse{ID: u.ID, URL: u.URL, MatchMode: u.MatchMode})
+	}
+	return urls
+}
+
+// MatchRules 平台的全部匹配规则：官方网址（按 base_domain）和其他网址，需要预加载 URLs
+func (p *Platform) MatchRules() []urlmatch.Rule {
+	var rules []urlmatch.Rule
+	if p.WebsiteURL != "" {
+		rules = append(rules, urlmatch.Rule{Pattern: p.WebsiteURL, Mode: urlmatch.ModeBaseDomain})
+	}
+	for i := range p.URLs {
+		rules = append(rules, p.URLs[i].Rule())
+	}
+	return rules
 }
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// 平台目录中 2FA 方式的可选值
+var CatalogTwoFactorMethods = []string{"totp", "sms", "email", "webauthn", "push"}
+
+// 平台目录中计费周期的可选值，与服务订阅的 billing_cycle 一致
+var CatalogBillingCycles = []string{"monthly", "yearly", "onetime", "free"}
+
+// CatalogPlatform 管理员维护的共享平台目录条目。用户创建平台时按名称或域名关联到目录，
+// 以获得规范名称、图标、修改密码地址等信息
+type CatalogPlatform struct {
+	ID                uint   `gorm:"primaryKey"`
+	Name              string `gorm:"type:varchar(100);not null;uniqueIndex"` // 规范名称
+	Domains           string `gorm:"type:text;not null"`                     // 空格分隔的可注册域名，第一个为主域名
+	Category          string `gorm:"type:varchar(50)"`                       // 分类，如 开发、社交、购物
+	IconURL           string `gorm:"type:varchar(2048)"`                     // 图标地址，为空时从主域名获取 favicon
+	SignupURL         string `gorm:"type:varchar(2048)"`                     // 注册地址
+	PasswordChangeURL string `gorm:"type:varchar(2048)"`                     // 修改密码地址
+	TwoFactorMethods  string `gorm:"type:varchar(255)"`                      // 空格分隔的 2FA 方式，为空表示不支持
+	BillingCycles     string `gorm:"type:varchar(255)"`                      // 空格分隔的常见计费周期
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// DomainList 目录条目的域名列表
+func (cp *CatalogPlatform) DomainList() []string {
+	return strings.Fields(cp.Domains)
+}
+
+// PrimaryDomain 主域名，用于获取 favicon
+func (cp *CatalogPlatform) PrimaryDomain() string {
+	if domains := cp.DomainList(); len(domains) > 0 {
+		return domains[0]
+	}
+	return ""
+}
+
+// CatalogPlatformResponse 平台目录条目的API响应
+type CatalogPlatformResponse struct {
+	ID                uint     `json:"id"`
+	Name              string   `json:"name"`
+	Domains           []string `json:"domains"`
+	Category          string   `json:"category"`
+	IconURL           string   `json:"icon_url"`
+	FaviconURL        string   `json:"favicon_url"` // 服务器缓存的图标，客户端无需访问第三方
+	SignupURL         string   `json:"signup_url"`
+	PasswordChangeURL string   `json:"password_change_url"`
+	Supports2FA       bool     `json:"supports_2fa"`
+	TwoFactorMethods  []string `json:"two_factor_methods"`
+	BillingCycles     []string `json:"billing_cycles"`
+}
+
+// ToResponse 转换为API响应
+func (cp *CatalogPlatform) ToResponse() CatalogPlatformResponse {
+	methods := strings.Fields(cp.TwoFactorMethods)
+	return CatalogPlatformResponse{
+		ID:                cp.ID,
+		Name:              cp.Name,
+		Domains:           cp.DomainList(),
+		Category:          cp.Category,
+		IconURL:           cp.IconURL,
+		FaviconURL:        FaviconPath(cp.PrimaryDomain()),
+		SignupURL:         cp.SignupURL,
+		PasswordChangeURL: cp.PasswordChangeURL,
+		Supports2FA:       len(methods) > 0,
+		TwoFactorMethods:  methods,
+		BillingCycles:     strings.Fields(cp.BillingCycles),
+	}
+}
+
+// CatalogPlatformInput 创建/更新平台目录条目的请求体
+type CatalogPlatformInput struct {
+	Name              string   `json:"name" binding:"required,min=1,max=100"`
+	Domains           []string `json:"domains" binding:"required,min=1,max=50"` // 域名或网址，保存为可注册域名
+	Category          string   `json:"category" binding:"max=50"`
+	IconURL           string   `json:"icon_url" binding:"omitempty,url"`
+	SignupURL         string   `json:"signup_url" binding:"omitempty,url"`
+	PasswordChangeURL string   `json:"password_change_url" binding:"omitempty,url"`
+	TwoFactorMethods  []string `json:"two_factor_methods"`
+	BillingCycles     []string `json:"billing_cycles"`
+}
+
+// Favicon 服务器缓存的网站图标，按主机名共享
+type Favicon struct {
+	ID          uint   `gorm:"primaryKey"`
+	Domain      string `gorm:"type:varchar(255);not null;uniqueIndex"`
+	ContentType string `gorm:"type:varchar(100)"`
+	Data        []byte
+	Missing     bool `gorm:"not null;default:false"` // 获取失败，在较短的时间后重试
+	FetchedAt   time.Time
+}
+
+// FaviconPath 主机名对应的图标接口路径，主机名为空时返回空字符串
+func FaviconPath(host string) string {
+	if host == "" {
+		return ""
+	}
+	return "/api/v1/favicons/" + host
+}
@@ -5,13 +5,14 @@ import "gorm.io/gorm"
 // PlatformRegistration 定义了用户邮箱在特定平台上的注册信息
 type PlatformRegistration struct {
 	gorm.Model
-	UserID                 uint    `gorm:"not null;uniqueIndex:uq_user_platform_loginusername,priority:1;uniqueIndex:uq_user_platform_emailaccountid,priority:1"`                             // 外键，关联到 User 模型
-	EmailAccountID         *uint   `gorm:"uniqueIndex:uq_user_platform_emailaccountid,priority:3;constraint:OnDelete:CASCADE"`                                                                // 外键，关联到 EmailAccount 模型 (允许 NULL)
-	PlatformID             uint    `gorm:"not null;uniqueIndex:uq_user_platform_loginusername,priority:2;uniqueIndex:uq_user_platform_emailaccountid,priority:2;constraint:OnDelete:CASCADE"` // 外键，关联到 Platform 模型
-	LoginUsername          *string `gorm:"type:varchar(255);uniqueIndex:uq_user_platform_loginusername,priority:3"`                                                                           // 在该平台的登录用户名/ID (允许为空)
-	LoginPasswordEncrypted string  `gorm:"type:varchar(255)"`                                                                                                                                 // 在该平台的登录密码 (加密存储)
-	Notes                  string  `gorm:"type:text"`                                                                                                                                         // 备注信息
-	PhoneNumber            string  `gorm:"type:varchar(50)"`                                                                                                                                  // 手机号码, 可选
+	UserID                 uint    `gorm:"not null;uniqueIndex:uq_user_platform_loginusername_active,priority:1,where:deleted_at IS NULL;uniqueIndex:uq_user_platform_emailaccountid_active,priority:1,where:deleted_at IS NULL"` // 外键，关联到 User 模型
+	EmailAccountID         *uint   `gorm:"uniqueIndex:uq_user_platform_emailaccountid_active,priority:3;constraint:OnDelete:CASCADE"`                                                                                             // 外键，关联到 EmailAccount 模型 (允许 NULL)
+	PlatformID             uint    `gorm:"not null;uniqueIndex:uq_user_platform_loginusername_active,priority:2;uniqueIndex:uq_user_platform_emailaccountid_active,priority:2;constraint:OnDelete:CASCADE"`                       // 外键，关联到 Platform 模型
+	LoginUsername          *string `gorm:"type:varchar(255);uniqueIndex:uq_user_platform_loginusername_active,priority:3"`                                                                                                        // 在该平台的登录用户名/ID (允许为空)
+	LoginPasswordEncrypted string  `gorm:"type:varchar(255)"`                                                                                                                                                                     // 在该平台的登录密码 (加密存储)
+	Notes                  string  `gorm:"type:text"`                                                                                                                                                                             // 备注信息
+	PhoneNumber            string  `gorm:"type:varchar(50)"`                                                                                                                                                                      // 手机号码, 可选
+	TOTPSecretEncrypted    string  `gorm:"type:varchar(255)"`                                                                                                                                                                     // 两步验证 TOTP 密钥 (加密存储)
 
 	User         User          `gorm:"foreignKey:UserID"`
 	EmailAccount *EmailAccount `gorm:"foreignKey:EmailAccountID"` // 指针类型以匹配可空外键
@@ -31,6 +32,7 @@ type PlatformRegistrationResponse struct {
 	Notes              string `json:"notes"`
 	PhoneNumber        string `json:"phone_number,omitempty"`
 	HasPassword        bool   `json:"has_password"` // 指示是否已设置密码
+	HasTOTP            bool   `json:"has_totp"`     // 指示是否已设置 TOTP 密钥
 	CreatedAt          string `json:"created_at"`
 	UpdatedAt          string `json:"updated_at"`
 }
@@ -66,6 +68,7 @@ func (pr *PlatformRegistration) ToPlatformRegistrationResponse(emailAccount Emai
 		Notes:       pr.Notes,
 		PhoneNumber: pr.PhoneNumber,
 		HasPassword: pr.LoginPasswordEncrypted != "", // 检查是否已设置密码
+		HasTOTP:     pr.TOTPSecretEncrypted != "",
 		CreatedAt:   pr.CreatedAt.Format("2006-01-02 15:04:05"),
 		UpdatedAt:   pr.UpdatedAt.Format("2006-01-02 15:04:05"),
 	}
@@ -93,6 +96,7 @@ func (pr *PlatformRegistration) ToPlatformRegistrationResponseLite() PlatformReg
 		Notes:       pr.Notes,
 		PhoneNumber: pr.PhoneNumber,
 		HasPassword: pr.LoginPasswordEncrypted != "", // 检查是否已设置密码
+		HasTOTP:     pr.TOTPSecretEncrypted != "",
 		CreatedAt:   pr.CreatedAt.Format("2006-01-02 15:04:05"),
 		UpdatedAt:   pr.UpdatedAt.Format("2006-01-02 15:04:05"),
 	}
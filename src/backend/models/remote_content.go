@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// RemoteContentSender 允许显示远程图片的发件人。Sender 为小写的邮箱地址，或以 "@" 开头的域名（如 "@example.com"）表示该域名下的所有发件人
+type RemoteContentSender struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"-" gorm:"not null;uniqueIndex:uq_remote_content_sender,priority:1"`
+	Sender    string    `json:"sender" gorm:"type:varchar(255);not null;uniqueIndex:uq_remote_content_sender,priority:2"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateRemoteContentSenderRequest 允许显示发件人的远程图片
+type CreateRemoteContentSenderRequest struct {
+	// Sender 邮箱地址，或 "@example.com" 表示整个域名
+	Sender string `json:"sender" binding:"required,max=255"`
+}
@@ -0,0 +1,230 @@
+package models
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
+
+// 版本历史所属实体类型
+const (
+	RevisionEntityPlatformRegistration = "platform_registration"
+	RevisionEntityEmailAccount         = "email_account"
+)
+
+// 版本历史动作
+const (
+	RevisionActionUpdate  = "update"
+	RevisionActionRestore = "restore"
+)
+
+// RevisionHistory 记录平台注册/邮箱账户每次更新前的字段快照，敏感字段保持加密状态
+type RevisionHistory struct {
+	gorm.Model
+	UserID            uint   `gorm:"not null;index"`                                                 // 记录所属用户
+	EntityType        string `gorm:"type:varchar(50);not null;index:idx_revision_entity,priority:1"` // platform_registration / email_account
+	EntityID          uint   `gorm:"not null;index:idx_revision_entity,priority:2"`                  // 对应实体ID
+	Action            string `gorm:"type:varchar(20);not null;default:'update'"`                     // update / restore
+	ChangedByID       uint   `gorm:"not null"`                                                       // 执行修改的用户ID
+	ChangedByUsername string `gorm:"type:varchar(255)"`                                              // 执行修改的用户名（冗余存储，便于展示）
+	ChangedFields     string `gorm:"type:text"`                                                      // 本次修改涉及的字段，JSON数组
+	Snapshot          string `gorm:"type:text;not null"`                                             // 修改前的字段快照，JSON
+}
+
+// PlatformRegistrationSnapshot 平台注册信息的可回溯字段
+type PlatformRegistrationSnapshot struct {
+	EmailAccountID         *uint   `json:"email_account_id"`
+	LoginUsername          *string `json:"login_username"`
+	LoginPasswordEncrypted string  `json:"login_password_encrypted"`
+	Notes                  string  `json:"notes"`
+	PhoneNumber            string  `json:"phone_number"`
+	TOTPSecretEncrypted    *string `json:"totp_secret_encrypted,omitempty"` // 旧版本快照中没有该字段，恢复时保持不变
+}
+
+// EmailAccountSnapshot 邮箱账户的可回溯字段
+type EmailAccountSnapshot struct {
+	EmailAddress      string `json:"email_address"`
+	PasswordEncrypted string `json:"password_encrypted"`
+	Provider          string `json:"provider"`
+	IMAPServer        string `json:"imap_server"`
+	IMAPPort          int    `json:"imap_port"`
+	IMAPSecurity      string `json:"imap_security,omitempty"`
+	Notes             string `json:"notes"`
+	PhoneNumber       string `json:"phone_number"`
+}
+
+// RevisionHistoryResponse 用于API响应，不包含任何密文
+type RevisionHistoryResponse struct {
+	ID                uint                   `json:"id"`
+	EntityType        string                 `json:"entity_type"`
+	EntityID          uint                   `json:"entity_id"`
+	Action            string                 `json:"action"`
+	ChangedByID       uint                   `json:"changed_by_id"`
+	ChangedByUsername string                 `json:"changed_by_username"`
+	ChangedFields     []string               `json:"changed_fields"`
+	HasPassword       bool                   `json:"has_password"` // 该版本是否存有密码
+	Values            map[string]interface{} `json:"values"`       // 该版本的非敏感字段值
+	CreatedAt         string                 `json:"created_at"`
+}
+
+// Snapshot 提取平台注册信息的当前快照
+func (pr *PlatformRegistration) Snapshot() PlatformRegistrationSnapshot {
+	totpSecret := pr.TOTPSecretEncrypted
+	return PlatformRegistrationSnapshot{
+		EmailAccountID:         pr.EmailAccountID,
+		LoginUsername:          pr.LoginUsername,
+		LoginPasswordEncrypted: pr.LoginPasswordEncrypted,
+		Notes:                  pr.Notes,
+		PhoneNumber:            pr.PhoneNumber,
+		TOTPSecretEncrypted:    &totpSecret,
+	}
+}
+
+// ApplySnapshot 将快照中的字段写回平台注册信息
+func (pr *PlatformRegistration) ApplySnapshot(s PlatformRegistrationSnapshot) {
+	pr.EmailAccountID = s.EmailAccountID
+	pr.LoginUsername = s.LoginUsername
+	pr.LoginPasswordEncrypted = s.LoginPasswordEncrypted
+	pr.Notes = s.Notes
+	pr.PhoneNumber = s.PhoneNumber
+	if s.TOTPSecretEncrypted != nil {
+		pr.TOTPSecretEncrypted = *s.TOTPSecretEncrypted
+	}
+}
+
+// DiffFields 返回与另一个快照相比发生变化的字段名
+func (s PlatformRegistrationSnapshot) DiffFields(other PlatformRegistrationSnapshot) []string {
+	var changed []string
+	if derefUint(s.EmailAccountID) != derefUint(other.EmailAccountID) {
+		changed = append(changed, "email_account_id")
+	}
+	if derefString(s.LoginUsername) != derefString(other.LoginUsername) {
+		changed = append(changed, "login_username")
+	}
+	if s.LoginPasswordEncrypted != other.LoginPasswordEncrypted {
+		changed = append(changed, "login_password")
+	}
+	if s.Notes != other.Notes {
+		changed = append(changed, "notes")
+	}
+	if s.PhoneNumber != other.PhoneNumber {
+		changed = append(changed, "phone_number")
+	}
+	if s.TOTPSecretEncrypted != nil && other.TOTPSecretEncrypted != nil && *s.TOTPSecretEncrypted != *other.TOTPSecretEncrypted {
+		changed = append(changed, "totp_secret")
+	}
+	return changed
+}
+
+// Snapshot 提取邮箱账户的当前快照
+func (ea *EmailAccount) Snapshot() EmailAccountSnapshot {
+	return EmailAccountSnapshot{
+		EmailAddress:      ea.EmailAddress,
+		PasswordEncrypted: ea.PasswordEncrypted,
+		Provider:          ea.Provider,
+		IMAPServer:        ea.IMAPServer,
+		IMAPPort:          ea.IMAPPort,
+		IMAPSecurity:      ea.IMAPSecurity,
+		Notes:             ea.Notes,
+		PhoneNumber:       ea.PhoneNumber,
+	}
+}
+
+// ApplySnapshot 将快照中的字段写回邮箱账户
+func (ea *EmailAccount) ApplySnapshot(s EmailAccountSnapshot) {
+	ea.EmailAddress = s.EmailAddress
+	ea.PasswordEncrypted = s.PasswordEncrypted
+	ea.Provider = s.Provider
+	ea.IMAPServer = s.IMAPServer
+	ea.IMAPPort = s.IMAPPort
+	ea.IMAPSecurity = s.IMAPSecurity
+	ea.Notes = s.Notes
+	ea.PhoneNumber = s.PhoneNumber
+}
+
+// DiffFields 返回与另一个快照相比发生变化的字段名
+func (s EmailAccountSnapshot) DiffFields(other EmailAccountSnapshot) []string {
+	var changed []string
+	if s.EmailAddress != other.EmailAddress {
+		changed = append(changed, "email_address")
+	}
+	if s.PasswordEncrypted != other.PasswordEncrypted {
+		changed = append(changed, "password")
+	}
+	if s.Provider != other.Provider {
+		changed = append(changed, "provider")
+	}
+	if s.IMAPServer != other.IMAPServer {
+		changed = append(changed, "imap_server")
+	}
+	if s.IMAPPort != other.IMAPPort {
+		changed = append(changed, "imap_port")
+	}
+	if s.IMAPSecurity != other.IMAPSecurity {
+		changed = append(changed, "imap_security")
+	}
+	if s.Notes != other.Notes {
+		changed = append(changed, "notes")
+	}
+	if s.PhoneNumber != other.PhoneNumber {
+		changed = append(changed, "phone_number")
+	}
+	return changed
+}
+
+// ToRevisionHistoryResponse 将 RevisionHistory 转换为不含密文的响应结构
+func (rh *RevisionHistory) ToRevisionHistoryResponse() RevisionHistoryResponse {
+	resp := RevisionHistoryResponse{
+		ID:                rh.ID,
+		EntityType:        rh.EntityType,
+		EntityID:          rh.EntityID,
+		Action:            rh.Action,
+		ChangedByID:       rh.ChangedByID,
+		ChangedByUsername: rh.ChangedByUsername,
+		ChangedFields:     []string{},
+		Values:            map[string]interface{}{},
+		CreatedAt:         rh.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if rh.ChangedFields != "" {
+		_ = json.Unmarshal([]byte(rh.ChangedFields), &resp.ChangedFields)
+	}
+
+	switch rh.EntityType {
+	case RevisionEntityPlatformRegistration:
+		var s PlatformRegistrationSnapshot
+		if err := json.Unmarshal([]byte(rh.Snapshot), &s); err == nil {
+			resp.HasPassword = s.LoginPasswordEncrypted != ""
+			resp.Values["email_account_id"] = derefUint(s.EmailAccountID)
+			resp.Values["login_username"] = derefString(s.LoginUsername)
+			resp.Values["notes"] = s.Notes
+			resp.Values["phone_number"] = s.PhoneNumber
+		}
+	case RevisionEntityEmailAccount:
+		var s EmailAccountSnapshot
+		if err := json.Unmarshal([]byte(rh.Snapshot), &s); err == nil {
+			resp.HasPassword = s.PasswordEncrypted != ""
+			resp.Values["email_address"] = s.EmailAddress
+			resp.Values["provider"] = s.Provider
+			resp.Values["imap_server"] = s.IMAPServer
+			resp.Values["imap_port"] = s.IMAPPort
+			resp.Values["imap_security"] = s.IMAPSecurity
+			resp.Values["notes"] = s.Notes
+			resp.Values["phone_number"] = s.PhoneNumber
+		}
+	}
+	return resp
+}
+
+func derefUint(p *uint) uint {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+func derefString(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
@@ -0,0 +1,339 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 搜索文档对应的实体类型
+const (
+	SearchEntityEmailAccount         = "email_account"
+	SearchEntityPlatform             = "platform"
+	SearchEntityPlatformRegistration = "platform_registration"
+	SearchEntityServiceSubscription  = "service_subscription"
+	SearchEntityEmail                = "email"
+)
+
+// SearchDocument 全文搜索的索引文档，每个可搜索的实体对应一行。
+// 实体的 GORM 钩子负责维护这张表；SQLite 启用 FTS5 时由触发器同步到 search_fts 虚拟表。
+type SearchDocument struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"not null;index"`
+	EntityType     string `gorm:"type:varchar(50);not null;uniqueIndex:uq_search_entity,priority:1"`
+	EntityID       uint   `gorm:"not null;uniqueIndex:uq_search_entity,priority:2"`
+	PlatformID     uint   `gorm:"index"` // 所属平台，平台改名时据此刷新 Platform 列
+	EmailAccountID uint   `gorm:"index"` // 所属邮箱账户
+	Title          string `gorm:"type:text"`
+	Body           string `gorm:"type:text"`
+	Platform       string `gorm:"type:text"` // platform: 过滤字段
+	Tags           string `gorm:"type:text"` // tag: 过滤字段（服务商、订阅状态、计费周期、邮件文件夹等）
+	Sender         string `gorm:"type:text"` // from: 过滤字段（邮件发件人）
+	UpdatedAt      time.Time
+}
+
+// joinNonEmpty 以换行拼接非空字符串
+func joinNonEmpty(parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// newSession 返回复用当前连接/事务但不带任何条件的会话，供钩子中查询关联数据
+func newSession(tx *gorm.DB) *gorm.DB {
+	return tx.Session(&gorm.Session{NewDB: true})
+}
+
+func upsertSearchDocument(tx *gorm.DB, doc *SearchDocument) error {
+	return newSession(tx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "entity_type"}, {Name: "entity_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform_id", "email_account_id", "title", "body", "platform", "tags", "sender", "updated_at"}),
+	}).Create(doc).Error
+}
+
+// RemoveSearchDocuments 删除指定实体的搜索文档
+func RemoveSearchDocuments(tx *gorm.DB, entityType string, ids ...uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return newSession(tx).Where("entity_type = ? AND entity_id IN ?", entityType, ids).Delete(&SearchDocument{}).Error
+}
+
+func platformName(tx *gorm.DB, platformID uint) string {
+	var name string
+	newSession(tx).Model(&Platform{}).Where("id = ?", platformID).Select("name").Scan(&name)
+	return name
+}
+
+func emailAddressOf(tx *gorm.DB, emailAccountID *uint) string {
+	if emailAccountID == nil || *emailAccountID == 0 {
+		return ""
+	}
+	var address string
+	newSession(tx).Model(&EmailAccount{}).Where("id = ?", *emailAccountID).Select("email_address").Scan(&address)
+	return address
+}
+
+// --- 各实体到搜索文档的映射 ---
+
+func (ea *EmailAccount) searchDocument(tx *gorm.DB) *SearchDocument {
+	return &SearchDocument{
+		UserID:         ea.UserID,
+		EntityType:     SearchEntityEmailAccount,
+		EntityID:       ea.ID,
+		EmailAccountID: ea.ID,
+		Title:          ea.EmailAddress,
+		Body:           joinNonEmpty(ea.Notes, ea.PhoneNumber),
+		Tags:           ea.Provider,
+	}
+}
+
+func (p *Platform) searchDocument(tx *gorm.DB) *SearchDocument {
+	var urls []string
+	newSession(tx).Model(&PlatformURL{}).Where("platform_id = ?", p.ID).Order("id").Pluck("url", &urls)
+	return &SearchDocument{
+		UserID:     p.UserID,
+		EntityType: SearchEntityPlatform,
+		EntityID:   p.ID,
+		PlatformID: p.ID,
+		Title:      p.Name,
+		Body:       joinNonEmpty(append([]string{p.WebsiteURL}, append(urls, p.Notes)...)...),
+		Platform:   p.Name,
+	}
+}
+
+func (pr *PlatformRegistration) searchDocument(tx *gorm.DB) *SearchDocument {
+	doc := &SearchDocument{
+		UserID:     pr.UserID,
+		EntityType: SearchEntityPlatformRegistration,
+		EntityID:   pr.ID,
+		PlatformID: pr.PlatformID,
+		Title:      joinNonEmpty(derefString(pr.LoginUsername), emailAddressOf(tx, pr.EmailAccountID)),
+		Body:       joinNonEmpty(pr.Notes, pr.PhoneNumber),
+		Platform:   platformName(tx, pr.PlatformID),
+	}
+	if pr.EmailAccountID != nil {
+		doc.EmailAccountID = *pr.EmailAccountID
+	}
+	return doc
+}
+
+func (ss *ServiceSubscription) searchDocument(tx *gorm.DB) *SearchDocument {
+	var reg PlatformRegistration
+	newSession(tx).Select("id, platform_id, email_account_id").First(&reg, ss.PlatformRegistrationID)
+	doc := &SearchDocument{
+		UserID:     ss.UserID,
+		EntityType: SearchEntityServiceSubscription,
+		EntityID:   ss.ID,
+		PlatformID: reg.PlatformID,
+		Title:      ss.ServiceName,
+		Body:       joinNonEmpty(ss.Description, ss.PaymentMethodNotes),
+		Platform:   platformName(tx, reg.PlatformID),
+		Tags:       joinNonEmpty(ss.Status, ss.BillingCycle),
+	}
+	if reg.EmailAccountID != nil {
+		doc.EmailAccountID = *reg.EmailAccountID
+	}
+	return doc
+}
+
+func (ce *CachedEmail) searchDocument(tx *gorm.DB) *SearchDocument {
+	body := ce.Body
+	if body == "" {
+		body = ce.Snippet
+	}
+	return &SearchDocument{
+		UserID:         ce.UserID,
+		EntityType:     SearchEntityEmail,
+		EntityID:       ce.ID,
+		EmailAccountID: ce.EmailAccountID,
+		Title:          ce.Subject,
+		Body:           body,
+		Tags:           ce.Folder,
+		Sender:         joinNonEmpty(ce.FromName, ce.FromAddress),
+	}
+}
+
+// --- GORM 钩子：保存/删除实体时同步搜索文档 ---
+// 通过 Model(&X{}).Update(...) 进行的批量更新不会带上实体ID，钩子会跳过，调用方需自行调用 SyncSearchDocuments。
+
+func (ea *EmailAccount) AfterSave(tx *gorm.DB) error {
+	if ea.ID == 0 {
+		return nil
+	}
+	if ea.DeletedAt.Valid {
+		return RemoveSearchDocuments(tx, SearchEntityEmailAccount, ea.ID)
+	}
+	if err := upsertSearchDocument(tx, ea.searchDocument(tx)); err != nil {
+		return err
+	}
+	// 注册信息的标题包含邮箱地址，地址变更后需要刷新
+	var regIDs []uint
+	if err := newSession(tx).Model(&PlatformRegistration{}).Where("email_account_id = ?", ea.ID).Pluck("id", &regIDs).Error; err != nil {
+		return err
+	}
+	return SyncSearchDocuments(tx, SearchEntityPlatformRegistration, regIDs)
+}
+
+func (ea *EmailAccount) AfterDelete(tx *gorm.DB) error {
+	if ea.ID == 0 {
+		return nil
+	}
+	return RemoveSearchDocuments(tx, SearchEntityEmailAccount, ea.ID)
+}
+
+func (p *Platform) AfterSave(tx *gorm.DB) error {
+	if p.ID == 0 {
+		return nil
+	}
+	if p.DeletedAt.Valid {
+		return RemoveSearchDocuments(tx, SearchEntityPlatform, p.ID)
+	}
+	if err := upsertSearchDocument(tx, p.searchDocument(tx)); err != nil {
+		return err
+	}
+	// 平台改名后刷新其下注册信息和订阅的 platform 列
+	return newSession(tx).Model(&SearchDocument{}).
+		Where("platform_id = ? AND entity_type IN ?", p.ID, []string{SearchEntityPlatformRegistration, SearchEntityServiceSubscription}).
+		Update("platform", p.Name).Error
+}
+
+func (p *Platform) AfterDelete(tx *gorm.DB) error {
+	if p.ID == 0 {
+		return nil
+	}
+	return RemoveSearchDocuments(tx, SearchEntityPlatform, p.ID)
+}
+
+func (pr *PlatformRegistration) AfterSave(tx *gorm.DB) error {
+	if pr.ID == 0 {
+		return nil
+	}
+	if pr.DeletedAt.Valid {
+		return RemoveSearchDocuments(tx, SearchEntityPlatformRegistration, pr.ID)
+	}
+	return upsertSearchDocument(tx, pr.searchDocument(tx))
+}
+
+func (pr *PlatformRegistration) AfterDelete(tx *gorm.DB) error {
+	if pr.ID == 0 {
+		return nil
+	}
+	return RemoveSearchDocuments(tx, SearchEntityPlatformRegistration, pr.ID)
+}
+
+func (ss *ServiceSubscription) AfterSave(tx *gorm.DB) error {
+	if ss.ID == 0 {
+		return nil
+	}
+	if ss.DeletedAt.Valid {
+		return RemoveSearchDocuments(tx, SearchEntityServiceSubscription, ss.ID)
+	}
+	return upsertSearchDocument(tx, ss.searchDocument(tx))
+}
+
+func (ss *ServiceSubscription) AfterDelete(tx *gorm.DB) error {
+	if ss.ID == 0 {
+		return nil
+	}
+	return RemoveSearchDocuments(tx, SearchEntityServiceSubscription, ss.ID)
+}
+
+func (ce *CachedEmail) AfterSave(tx *gorm.DB) error {
+	// 缓存写入使用 upsert，内存中的结构体可能不是完整的行，因此重新读取
+	var stored CachedEmail
+	if err := newSession(tx).Where("email_account_id = ? AND message_id = ?", ce.EmailAccountID, ce.MessageID).First(&stored).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	return upsertSearchDocument(tx, stored.searchDocument(tx))
+}
+
+func (ce *CachedEmail) AfterDelete(tx *gorm.DB) error {
+	if ce.ID == 0 {
+		return nil
+	}
+	return RemoveSearchDocuments(tx, SearchEntityEmail, ce.ID)
+}
+
+// SyncSearchDocuments 重新生成指定实体的搜索文档；实体不存在或已软删除时删除对应文档。
+// 用于批量更新（如移入/移出回收站）和索引重建等钩子无法覆盖的场景。
+func SyncSearchDocuments(tx *gorm.DB, entityType string, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	found := map[uint]bool{}
+	upsert := func(id uint, doc *SearchDocument) error {
+		found[id] = true
+		return upsertSearchDocument(tx, doc)
+	}
+
+	db := newSession(tx)
+	var err error
+	switch entityType {
+	case SearchEntityEmailAccount:
+		var rows []EmailAccount
+		if err = db.Where("id IN ?", ids).Find(&rows).Error; err == nil {
+			for i := range rows {
+				if err = upsert(rows[i].ID, rows[i].searchDocument(tx)); err != nil {
+					break
+				}
+			}
+		}
+	case SearchEntityPlatform:
+		var rows []Platform
+		if err = db.Where("id IN ?", ids).Find(&rows).Error; err == nil {
+			for i := range rows {
+				if err = upsert(rows[i].ID, rows[i].searchDocument(tx)); err != nil {
+					break
+				}
+			}
+		}
+	case SearchEntityPlatformRegistration:
+		var rows []PlatformRegistration
+		if err = db.Where("id IN ?", ids).Find(&rows).Error; err == nil {
+			for i := range rows {
+				if err = upsert(rows[i].ID, rows[i].searchDocument(tx)); err != nil {
+					break
+				}
+			}
+		}
+	case SearchEntityServiceSubscription:
+		var rows []ServiceSubscription
+		if err = db.Where("id IN ?", ids).Find(&rows).Error; err == nil {
+			for i := range rows {
+				if err = upsert(rows[i].ID, rows[i].searchDocument(tx)); err != nil {
+					break
+				}
+			}
+		}
+	case SearchEntityEmail:
+		var rows []CachedEmail
+		if err = db.Where("id IN ?", ids).Find(&rows).Error; err == nil {
+			for i := range rows {
+				if err = upsert(rows[i].ID, rows[i].searchDocument(tx)); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var missing []uint
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	return RemoveSearchDocuments(tx, entityType, missing...)
+}
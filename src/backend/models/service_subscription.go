@@ -10,13 +10,12 @@ import (
 // ServiceSubscription 定义了用户在特定平台注册下的服务订阅详情
 type ServiceSubscription struct {
 	gorm.Model
-	UserID                 uint    `gorm:"not null;index;uniqueIndex:uq_user_platform_service,priority:1"`                             // 外键，关联到 User 模型
-	PlatformRegistrationID uint    `gorm:"not null;index;constraint:OnDelete:CASCADE;uniqueIndex:uq_user_platform_service,priority:2"` // 外键，关联到 PlatformRegistration 模型
-	ServiceName            string  `gorm:"type:varchar(255);not null;uniqueIndex:uq_user_platform_service,priority:3"`
+	UserID                 uint    `gorm:"not null;index;uniqueIndex:uq_user_platform_service_active,priority:1,where:deleted_at IS NULL"`    // 外键，关联到 User 模型
+	PlatformRegistrationID uint    `gorm:"not null;index;constraint:OnDelete:CASCADE;uniqueIndex:uq_user_platform_service_active,priority:2"` // 外键，关联到 PlatformRegistration 模型
+	ServiceName            string  `gorm:"type:varchar(255);not null;uniqueIndex:uq_user_platform_service_active,priority:3"`
 	Description            string  `gorm:"type:text"`
 	Status                 string  `gorm:"type:varchar(50)"` // e.g., active, cancelled, free_trial, expired
-	Cost                   float64 // 费用金额. For precision, consider decimal type or storing as integer (e.g., cents)
-	// Cost                   decimal.Decimal `gorm:"type:decimal(10,2);"` // Example with shopspring/decimal
+	Cost                   float64 `gorm:"type:decimal(10,2)"` // 费用金额，数据库中以定点小数存储（迁移 0003）
 	BillingCycle       string     `gorm:"type:varchar(50)"` // e.g., monthly, yearly, onetime, free
 	NextRenewalDate    *time.Time `gorm:"type:date"`        // 下次续费日期 (可空)
 	PaymentMethodNotes string     `gorm:"type:text"`        // 支付方式备注
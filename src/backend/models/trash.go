@@ -0,0 +1,29 @@
+package models
+
+// 回收站条目类型，与 /trash/:type 路由参数一致
+const (
+	TrashTypeEmailAccount         = "email_account"
+	TrashTypePlatform             = "platform"
+	TrashTypePlatformRegistration = "platform_registration"
+	TrashTypeServiceSubscription  = "service_subscription"
+)
+
+// IsValidTrashType 判断给定字符串是否为合法的回收站条目类型
+func IsValidTrashType(t string) bool {
+	switch t {
+	case TrashTypeEmailAccount, TrashTypePlatform, TrashTypePlatformRegistration, TrashTypeServiceSubscription:
+		return true
+	}
+	return false
+}
+
+// TrashItemResponse 回收站条目，Dependents 为随该条目一起被删除（级联）的子项
+type TrashItemResponse struct {
+	Type       string              `json:"type"`
+	ID         uint                `json:"id"`
+	Title      string              `json:"title"`              // 展示名称，如邮箱地址、平台名称
+	Subtitle   string              `json:"subtitle,omitempty"` // 辅助信息，如注册信息所属平台
+	DeletedAt  string              `json:"deleted_at"`
+	PurgeAt    string              `json:"purge_at,omitempty"` // 预计被自动永久删除的时间，未启用自动清除时为空
+	Dependents []TrashItemResponse `json:"dependents"`
+}
@@ -12,15 +12,33 @@ type User struct {
 	Username   string `json:"username" gorm:"uniqueIndex:uq_username,priority:1;not null"`
 	Email      string `json:"email" gorm:"uniqueIndex:uq_email,priority:1;not null"`
 	Password   string `json:"-" gorm:""` // Password hash, json:"-" to omit from JSON responses by default, nullable for OAuth users
-	// OAuth2 fields
-	LinuxDoID   *int64  `json:"-" gorm:"uniqueIndex:uq_linuxdo_id,priority:1"`   // LinuxDo user ID, nullable
-	GoogleID    *string `json:"-" gorm:"uniqueIndex:uq_google_id,priority:1"`    // Google user ID, nullable
-	MicrosoftID *string `json:"-" gorm:"uniqueIndex:uq_microsoft_id,priority:1"` // Microsoft user ID, nullable
-	Provider    *string `json:"provider,omitempty"`                              // OAuth provider (e.g., "linuxdo", "google", "microsoft")
+	// OAuth2 fields，外部登录身份见 UserIdentity
+	Provider *string `json:"provider,omitempty"` // 注册时使用的 OAuth provider (e.g., "linuxdo", "google", "microsoft")
 	// Extended fields
 	Role      string     `json:"role" gorm:"default:user"` // 用户角色: admin=管理员, user=普通用户
 	Status    int        `json:"status" gorm:"default:1"`  // 用户状态: 1=激活, 0=封禁
 	LastLogin *time.Time `json:"last_login"`               // 最后登录时间
+	// MustChangePassword 管理员要求用户下次登录后先修改密码
+	MustChangePassword bool `json:"must_change_password" gorm:"not null"`
+	// EmailVerifiedAt 邮箱验证时间，为空表示尚未验证
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// TokenVersion 登录 token 版本，重置密码后递增，使之前签发的 token 全部失效
+	TokenVersion uint `json:"-" gorm:"not null;default:0"`
+	// FailedLoginAttempts 连续登录失败次数，登录成功或管理员解锁后清零
+	FailedLoginAttempts int `json:"-" gorm:"not null;default:0"`
+	// LockedUntil 连续登录失败后账户锁定到该时间
+	LockedUntil *time.Time `json:"-"`
+}
+
+// PasswordResetToken 找回密码时发送到用户邮箱的一次性重置 token，数据库中只保存其哈希
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Email     string    `gorm:"type:varchar(255);not null"` // 发送时的邮箱，用户修改邮箱后 token 失效
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
 }
 
 // 用户角色常量
@@ -41,9 +59,26 @@ type LoginRequest struct {
 }
 
 type RegisterRequest struct {
-	Username string `json:"username" binding:"required,min=3,max=20"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Username   string `json:"username" binding:"required,min=3,max=20"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required,min=6"`
+	InviteCode string `json:"invite_code"` // 仅邀请注册模式下必填
+}
+
+// VerifyEmailRequest 提交邮件中的验证 token
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ForgotPasswordRequest 申请通过邮件重置密码
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest 使用邮件中的 token 设置新密码
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
 }
 
 type ChangePasswordRequest struct {
@@ -67,6 +102,9 @@ type UserResponse struct {
 	LastLogin *time.Time `json:"last_login"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
+
+	MustChangePassword bool       `json:"must_change_password"`
+	EmailVerifiedAt    *time.Time `json:"email_verified_at"`
 }
 
 // OAuth2 related structs
@@ -79,24 +117,6 @@ type OAuth2CallbackRequest struct {
 	State string `json:"state"`
 }
 
-type LinuxDoUserInfo struct {
-	ID       int64  `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Name     string `json:"name"`
-	Avatar   string `json:"avatar_url"`
-}
-
-// MicrosoftUserInfo 定义Microsoft OAuth2用户信息结构
-type MicrosoftUserInfo struct {
-	ID                string `json:"id"`
-	DisplayName       string `json:"displayName"`
-	GivenName         string `json:"givenName"`
-	Surname           string `json:"surname"`
-	UserPrincipalName string `json:"userPrincipalName"`
-	Mail              string `json:"mail"`
-}
-
 // 转换为响应格式（隐藏密码）
 func (u *User) ToResponse() *UserResponse {
 	return &UserResponse{
@@ -109,9 +129,17 @@ func (u *User) ToResponse() *UserResponse {
 		LastLogin: u.LastLogin,
 		CreatedAt: u.CreatedAt,
 		UpdatedAt: u.UpdatedAt,
+
+		MustChangePassword: u.MustChangePassword,
+		EmailVerifiedAt:    u.EmailVerifiedAt,
 	}
 }
 
+// IsLocked 账户是否因连续登录失败处于锁定中
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
 // 检查用户是否为管理员
 func (u *User) IsAdmin() bool {
 	return u.Role == RoleAdmin
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// UserIdentity 用户绑定的外部登录身份，一个用户可以绑定多个提供商的身份
+type UserIdentity struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      uint   `gorm:"not null;index"`
+	Provider    string `gorm:"type:varchar(50);not null;uniqueIndex:uq_identity_provider_subject,priority:1"`  // linuxdo / google / microsoft / 管理员配置的提供商名称
+	Subject     string `gorm:"type:varchar(255);not null;uniqueIndex:uq_identity_provider_subject,priority:2"` // 提供商侧的用户 ID
+	Email       string `gorm:"type:varchar(255);not null;default:''"`                                          // 最近一次登录时提供商返回的邮箱
+	LastLoginAt *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// PendingIdentityLink 外部身份的邮箱与已有账户冲突时暂存的身份，
+// 用户登录原账户证明所有权后凭 Token 确认绑定
+type PendingIdentityLink struct {
+	Token     string    `gorm:"primaryKey;type:varchar(64)"`
+	Provider  string    `gorm:"type:varchar(50);not null"`
+	Subject   string    `gorm:"type:varchar(255);not null"`
+	Email     string    `gorm:"type:varchar(255);not null;default:''"`
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// UserIdentityResponse 返回给用户的已绑定身份
+type UserIdentityResponse struct {
+	ID                  uint       `json:"id"`
+	Provider            string     `json:"provider"`
+	ProviderDisplayName string     `json:"provider_display_name"`
+	Email               string     `json:"email"`
+	LastLoginAt         *time.Time `json:"last_login_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// UserIdentitiesResponse 用户的登录方式：密码以及已绑定的外部身份
+type UserIdentitiesResponse struct {
+	HasPassword bool                   `json:"has_password"`
+	Identities  []UserIdentityResponse `json:"identities"`
+}
@@ -12,6 +12,9 @@ type UserOAuthToken struct {
 	RefreshTokenEncrypted string    `gorm:"type:varchar(2048)"`          // Encrypted refresh token (can be null)
 	TokenType            string    `gorm:"type:varchar(50);default:'Bearer'"`
 	Expiry               time.Time `gorm:"not null"`                      // Expiry date/time of the access token
+	FailureCount         int       `gorm:"not null;default:0"`                     // 连续刷新/认证失败次数，成功后清零
+	LastError            string    `gorm:"type:varchar(500);not null;default:''"` // 最近一次失败的错误信息
+	LastErrorAt          *time.Time                                             // 最近一次失败的时间
 	CreatedAt            time.Time `gorm:"autoCreateTime"`
 	UpdatedAt            time.Time `gorm:"autoUpdateTime"`
 
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// bucket 令牌桶状态
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	rule    Rule
+}
+
+// refill 按经过的时间补充令牌，不超过桶容量
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		rate := float64(b.rule.Limit) / float64(b.rule.Window)
+		b.tokens = math.Min(float64(b.rule.Limit), b.tokens+float64(elapsed)*rate)
+		b.updated = now
+	}
+}
+
+// MemoryStore 进程内的令牌桶存储，多实例部署时各实例分别计数
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// sweepInterval 清理已补满的令牌桶的间隔
+const sweepInterval = 10 * time.Minute
+
+// NewMemoryStore 创建进程内存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+func (s *MemoryStore) Take(key string, rule Rule, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+	b, ok := s.buckets[key]
+	if !ok || b.rule != rule {
+		b = &bucket{tokens: float64(rule.Limit), updated: now, rule: rule}
+		s.buckets[key] = b
+	}
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	// 距离补充满一个令牌还需的时间
+	missing := 1 - b.tokens
+	wait := time.Duration(math.Ceil(missing * float64(rule.Window) / float64(rule.Limit)))
+	return false, wait, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buckets, key)
+	return nil
+}
+
+// sweep 删除已经补满的令牌桶（与新建的桶等价），避免内存随 key 数量无限增长
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.rule.Limit) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package ratelimit 提供基于令牌桶的限流。令牌桶状态保存在 Store 中，默认使用进程内存，
+// 多实例部署时可以替换为共享存储（如 Redis）的实现。
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule 令牌桶规则：桶容量为 Limit，每 Window 匀速补充 Limit 个令牌。
+// 即最多允许突发 Limit 次请求，长期平均不超过每 Window Limit 次。Limit<=0 表示不限流
+type Rule struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Disabled 规则是否不限流
+func (r Rule) Disabled() bool {
+	return r.Limit <= 0 || r.Window <= 0
+}
+
+func (r Rule) String() string {
+	if r.Disabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", r.Limit, r.Window)
+}
+
+// ParseRule 解析 "次数/时间窗口" 格式的规则，例如 "10/1m"、"600/1h"；"off" 或空字符串表示不限流
+func ParseRule(s string) (Rule, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "off" || s == "0" {
+		return Rule{}, nil
+	}
+	limitPart, windowPart, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("限流规则 %q 格式应为 次数/时间窗口，例如 10/1m", s)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(limitPart))
+	if err != nil || limit < 0 {
+		return Rule{}, fmt.Errorf("限流规则 %q 的次数无效", s)
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(windowPart))
+	if err != nil || window <= 0 {
+		return Rule{}, fmt.Errorf("限流规则 %q 的时间窗口无效", s)
+	}
+	return Rule{Limit: limit, Window: window}, nil
+}
+
+// Store 保存令牌桶状态
+type Store interface {
+	// Take 从 key 对应的令牌桶取出一个令牌。令牌不足时返回 false 以及需要等待的时间
+	Take(key string, rule Rule, now time.Time) (allowed bool, retryAfter time.Duration, err error)
+	// Reset 清除 key 的状态，使其恢复为满桶
+	Reset(key string) error
+}
+
+// Default 新建的 Limiter 默认使用的存储，需在创建 Limiter 之前替换
+var Default Store = NewMemoryStore()
+
+// Limiter 按 key（IP、用户名、用户ID 等）限流
+type Limiter struct {
+	name  string
+	rule  Rule
+	store Store
+}
+
+// New 创建使用 Default 存储的限流器，name 用于区分不同限流器的 key
+func New(name string, rule Rule) *Limiter {
+	return &Limiter{name: name, rule: rule, store: Default}
+}
+
+// Rule 限流规则
+func (l *Limiter) Rule() Rule {
+	return l.rule
+}
+
+// Allow 为 key 计一次请求，超过限制时返回 false 以及建议的重试等待时间。
+// 存储出错时放行，避免限流存储故障导致服务不可用
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.rule.Disabled() {
+		return true, 0
+	}
+	allowed, retryAfter, err := l.store.Take(l.name+":"+key, l.rule, time.Now())
+	if err != nil {
+		log.Printf("[ratelimit] %s 限流存储出错，放行请求: %v", l.name, err)
+		return true, 0
+	}
+	return allowed, retryAfter
+}
+
+// Reset 清除 key 的计数
+func (l *Limiter) Reset(key string) {
+	if l == nil || l.rule.Disabled() {
+		return
+	}
+	if err := l.store.Reset(l.name + ":" + key); err != nil {
+		log.Printf("[ratelimit] %s 清除限流状态失败: %v", l.name, err)
+	}
+}
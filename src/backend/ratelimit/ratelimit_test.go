@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("10/1m")
+	require.NoError(t, err)
+	assert.Equal(t, Rule{Limit: 10, Window: time.Minute}, rule)
+
+	rule, err = ParseRule("off")
+	require.NoError(t, err)
+	assert.True(t, rule.Disabled())
+
+	for _, invalid := range []string{"10", "x/1m", "10/abc", "10/0s", "-1/1m"} {
+		_, err := ParseRule(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestMemoryStore_TokenBucket(t *testing.T) {
+	store := NewMemoryStore()
+	rule := Rule{Limit: 3, Window: time.Minute}
+	now := time.Now()
+
+	// 允许突发 Limit 次
+	for i := 0; i < 3; i++ {
+		allowed, _, err := store.Take("k", rule, now)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	allowed, retryAfter, err := store.Take("k", rule, now)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 20*time.Second, retryAfter)
+
+	// 其他 key 不受影响
+	allowed, _, _ = store.Take("other", rule, now)
+	assert.True(t, allowed)
+
+	// 每 20 秒补充一个令牌
+	allowed, _, _ = store.Take("k", rule, now.Add(20*time.Second))
+	assert.True(t, allowed)
+	allowed, _, _ = store.Take("k", rule, now.Add(20*time.Second))
+	assert.False(t, allowed)
+
+	require.NoError(t, store.Reset("k"))
+	allowed, _, _ = store.Take("k", rule, now.Add(20*time.Second))
+	assert.True(t, allowed)
+}
+
+func TestLimiter_DisabledAlwaysAllows(t *testing.T) {
+	limiter := New("test", Rule{})
+	for i := 0; i < 100; i++ {
+		allowed, _ := limiter.Allow("k")
+		require.True(t, allowed)
+	}
+	var nilLimiter *Limiter
+	allowed, _ := nilLimiter.Allow("k")
+	assert.True(t, allowed)
+}
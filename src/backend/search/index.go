@@ -0,0 +1,117 @@
+package search
+
+import (
+	"log"
+	"sync/atomic"
+
+	"email_server/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ftsEnabled 标记当前数据库是否可用 FTS5。
+// go-sqlite3 需要以 -tags sqlite_fts5 编译才包含 FTS5；不可用时退化为进程内匹配。
+var ftsEnabled atomic.Bool
+
+// FullTextEnabled 返回是否正在使用 SQLite FTS5 索引
+func FullTextEnabled() bool {
+	return ftsEnabled.Load()
+}
+
+// search_fts 是 search_documents 的外部内容 FTS5 表，列顺序决定 bm25 权重与 highlight 的列号
+const createFTSTable = `CREATE VIRTUAL TABLE IF NOT EXISTS search_fts USING fts5(
+	title, body, platform, tags, sender,
+	content='search_documents', content_rowid='id',
+	tokenize='unicode61 remove_diacritics 2'
+)`
+
+var ftsTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS search_documents_ai AFTER INSERT ON search_documents BEGIN
+		INSERT INTO search_fts(rowid, title, body, platform, tags, sender)
+		VALUES (new.id, new.title, new.body, new.platform, new.tags, new.sender);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_documents_ad AFTER DELETE ON search_documents BEGIN
+		INSERT INTO search_fts(search_fts, rowid, title, body, platform, tags, sender)
+		VALUES ('delete', old.id, old.title, old.body, old.platform, old.tags, old.sender);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_documents_au AFTER UPDATE ON search_documents BEGIN
+		INSERT INTO search_fts(search_fts, rowid, title, body, platform, tags, sender)
+		VALUES ('delete', old.id, old.title, old.body, old.platform, old.tags, old.sender);
+		INSERT INTO search_fts(rowid, title, body, platform, tags, sender)
+		VALUES (new.id, new.title, new.body, new.platform, new.tags, new.sender);
+	END`,
+}
+
+var ftsTriggerNames = []string{"search_documents_ai", "search_documents_ad", "search_documents_au"}
+
+// Init 准备搜索索引：必要时回填 search_documents，并在 SQLite 支持 FTS5 时建立/重建 search_fts。
+// 需在 AutoMigrate 之后调用。
+func Init(db *gorm.DB) {
+	if err := backfill(db); err != nil {
+		log.Printf("⚠️ 回填搜索文档失败: %v", err)
+	}
+
+	ftsEnabled.Store(false)
+	if db.Dialector.Name() != "sqlite" {
+		log.Println("ℹ️ 当前数据库不支持 FTS5，搜索将使用基础匹配")
+		return
+	}
+
+	// 探测 FTS5 是否可用，失败属于预期情况，不输出 SQL 错误日志
+	if err := db.Session(&gorm.Session{Logger: logger.Discard}).Exec(createFTSTable).Error; err != nil {
+		// 未编译 FTS5 时，指向 search_fts 的触发器会让 search_documents 的所有写入失败，必须移除
+		for _, name := range ftsTriggerNames {
+			db.Exec("DROP TRIGGER IF EXISTS " + name)
+		}
+		log.Printf("⚠️ SQLite 未启用 FTS5 (%v)，搜索将使用基础匹配（每次最多排序 %d 条候选记录，数据量大时较慢且结果可能不完整）；请以 -tags sqlite_fts5 编译以启用全文索引", err, fallbackCandidateLimit)
+		return
+	}
+	for _, stmt := range ftsTriggers {
+		if err := db.Exec(stmt).Error; err != nil {
+			log.Printf("⚠️ 创建搜索索引触发器失败: %v", err)
+			return
+		}
+	}
+	// 触发器可能在未启用 FTS5 的版本运行期间缺失，启动时重建以保证与 search_documents 一致
+	if err := db.Exec("INSERT INTO search_fts(search_fts) VALUES ('rebuild')").Error; err != nil {
+		log.Printf("⚠️ 重建全文索引失败: %v", err)
+		return
+	}
+	ftsEnabled.Store(true)
+	log.Println("✅ 全文搜索索引 (FTS5) 已就绪")
+}
+
+// backfill 为尚未建立搜索文档的实体生成文档（如升级前已存在的数据）
+func backfill(db *gorm.DB) error {
+	sources := []struct {
+		entityType string
+		model      interface{}
+	}{
+		{models.SearchEntityEmailAccount, &models.EmailAccount{}},
+		{models.SearchEntityPlatform, &models.Platform{}},
+		{models.SearchEntityPlatformRegistration, &models.PlatformRegistration{}},
+		{models.SearchEntityServiceSubscription, &models.ServiceSubscription{}},
+		{models.SearchEntityEmail, &models.CachedEmail{}},
+	}
+	for _, src := range sources {
+		var ids []uint
+		indexed := db.Model(&models.SearchDocument{}).Select("entity_id").Where("entity_type = ?", src.entityType)
+		if err := db.Model(src.model).Where("id NOT IN (?)", indexed).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		for start := 0; start < len(ids); start += 200 {
+			end := start + 200
+			if end > len(ids) {
+				end = len(ids)
+			}
+			if err := models.SyncSearchDocuments(db, src.entityType, ids[start:end]); err != nil {
+				return err
+			}
+		}
+		if len(ids) > 0 {
+			log.Printf("🔧 已为 %d 条 %s 生成搜索文档", len(ids), src.entityType)
+		}
+	}
+	return nil
+}
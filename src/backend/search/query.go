@@ -0,0 +1,152 @@
+// Package search 提供跨实体（邮箱账户、平台、注册信息、订阅、缓存邮件）的全文搜索。
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Term 查询中的一个检索词
+type Term struct {
+	Text   string // 小写后的文本
+	Phrase bool   // 双引号包裹的短语
+	Prefix bool   // 以 * 结尾的前缀匹配
+}
+
+// Query 解析后的搜索查询。
+// 语法：空格分隔的词之间为 AND 关系；"多个 词" 为短语；词尾加 * 为前缀匹配；
+// platform:xx、tag:xx、from:xx 分别按平台名、标签（服务商/订阅状态/计费周期/邮件文件夹）、发件人过滤，过滤值同样支持引号与 *；
+// site:网址 按平台的网址匹配规则过滤，由调用方解析为平台 ID 后通过 Options.PlatformIDs 传入。
+type Query struct {
+	Terms     []Term
+	Platforms []Term
+	Tags      []Term
+	Senders   []Term
+	Sites     []string // site: 的原始网址
+}
+
+// IsEmpty 判断查询是否不含任何检索条件
+func (q Query) IsEmpty() bool {
+	return len(q.Terms) == 0 && len(q.Platforms) == 0 && len(q.Tags) == 0 && len(q.Senders) == 0 && len(q.Sites) == 0
+}
+
+// hasSearchableRune 判断文本中是否包含字母或数字，纯标点的词会被忽略
+func hasSearchableRune(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTokens 按空白切分，保留双引号内的空白
+func splitTokens(raw string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inQuote := false
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			cur.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuote:
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+// parseTerm 解析单个检索词（可能带引号或 *）
+func parseTerm(token string) (Term, bool) {
+	t := Term{}
+	if strings.HasSuffix(token, "*") {
+		t.Prefix = true
+		token = strings.TrimRight(token, "*")
+	}
+	if strings.HasPrefix(token, "\"") {
+		token = strings.Trim(token, "\"")
+		t.Phrase = strings.ContainsFunc(token, unicode.IsSpace)
+	}
+	t.Text = strings.ToLower(strings.TrimSpace(token))
+	if !hasSearchableRune(t.Text) {
+		return Term{}, false
+	}
+	return t, true
+}
+
+// Parse 解析用户输入的查询字符串
+func Parse(raw string) Query {
+	var q Query
+	for _, token := range splitTokens(raw) {
+		field := ""
+		if idx := strings.Index(token, ":"); idx > 0 && !strings.HasPrefix(token, "\"") {
+			field = strings.ToLower(token[:idx])
+			switch field {
+			case "platform", "tag", "from":
+				token = token[idx+1:]
+			case "site":
+				if site := strings.Trim(token[idx+1:], "\""); site != "" {
+					q.Sites = append(q.Sites, site)
+				}
+				continue
+			default:
+				field = "" // 未知字段按普通文本处理，例如 "https://..."
+			}
+		}
+
+		term, ok := parseTerm(token)
+		if !ok {
+			continue
+		}
+		switch field {
+		case "platform":
+			q.Platforms = append(q.Platforms, term)
+		case "tag":
+			q.Tags = append(q.Tags, term)
+		case "from":
+			q.Senders = append(q.Senders, term)
+		default:
+			q.Terms = append(q.Terms, term)
+		}
+	}
+	return q
+}
+
+// ftsString 将文本转为 FTS5 字符串字面量
+func ftsString(s string) string {
+	return "\"" + strings.ReplaceAll(s, "\"", "\"\"") + "\""
+}
+
+func (t Term) fts() string {
+	s := ftsString(t.Text)
+	if t.Prefix {
+		s += "*"
+	}
+	return s
+}
+
+// MatchExpression 生成 FTS5 MATCH 表达式，所有条件为 AND 关系
+func (q Query) MatchExpression() string {
+	var parts []string
+	for _, t := range q.Terms {
+		parts = append(parts, t.fts())
+	}
+	for _, f := range []struct {
+		column string
+		terms  []Term
+	}{{"platform", q.Platforms}, {"tags", q.Tags}, {"sender", q.Senders}} {
+		for _, t := range f.terms {
+			parts = append(parts, f.column+" : "+t.fts())
+		}
+	}
+	return strings.Join(parts, " AND ")
+}
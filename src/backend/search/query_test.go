@@ -0,0 +1,30 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	q := Parse(`Invoice "due date" git* platform:GitHub tag:"free trial" from:billing@ex.com https://a.b -`)
+
+	assert.Equal(t, []Term{
+		{Text: "invoice"},
+		{Text: "due date", Phrase: true},
+		{Text: "git", Prefix: true},
+		{Text: "https://a.b"},
+	}, q.Terms)
+	assert.Equal(t, []Term{{Text: "github"}}, q.Platforms)
+	assert.Equal(t, []Term{{Text: "free trial", Phrase: true}}, q.Tags)
+	assert.Equal(t, []Term{{Text: "billing@ex.com"}}, q.Senders)
+
+	assert.Equal(t, `"invoice" AND "due date" AND "git"* AND "https://a.b" AND platform : "github" AND tags : "free trial" AND sender : "billing@ex.com"`, q.MatchExpression())
+	assert.True(t, Parse(` " * - `).IsEmpty())
+
+	q = Parse(`site:https://login.example.com/a site:"" invoice`)
+	assert.Equal(t, []string{"https://login.example.com/a"}, q.Sites)
+	assert.Equal(t, []Term{{Text: "invoice"}}, q.Terms)
+	assert.False(t, Parse("site:example.com").IsEmpty())
+	assert.Empty(t, Parse("site:example.com").MatchExpression())
+}
@@ -0,0 +1,363 @@
+package search
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"email_server/models"
+
+	"gorm.io/gorm"
+)
+
+// 高亮标记在转义 HTML 之后才替换为 <mark>，避免用户数据中的 HTML 被原样输出
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// 各列的相关度权重，顺序与 search_fts 的列一致：title, body, platform, tags, sender
+var columnWeights = [5]float64{10.0, 2.0, 4.0, 2.0, 3.0}
+
+// fallbackCandidateLimit 未启用 FTS5 时最多取出并排序的候选记录数（按更新时间取最新的）
+const fallbackCandidateLimit = 1000
+
+// Hit 一条搜索命中
+type Hit struct {
+	EntityType     string
+	EntityID       uint
+	PlatformID     uint
+	EmailAccountID uint
+	Title          string
+	Platform       string
+	Tags           string
+	Sender         string
+	Score          float64 // 越大越相关
+	TitleHighlight string  // 标题高亮（HTML，匹配部分以 <mark> 包裹）
+	Snippet        string  // 正文摘要高亮（HTML）
+}
+
+// Options 搜索参数
+type Options struct {
+	UserID          uint
+	Types           []string // 为空表示所有类型
+	FilterPlatforms bool     // 为 true 时只返回属于 PlatformIDs 中平台的结果（site: 过滤）
+	PlatformIDs     []uint
+	Page            int
+	PageSize        int
+}
+
+// Search 执行搜索，返回当前页的命中与总命中数
+func Search(db *gorm.DB, q Query, opts Options) ([]Hit, int, error) {
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	if opts.PageSize < 1 {
+		opts.PageSize = 20
+	}
+	if q.IsEmpty() || opts.FilterPlatforms && len(opts.PlatformIDs) == 0 {
+		return []Hit{}, 0, nil
+	}
+	// 只有 site: 过滤时没有可用于 MATCH 的条件
+	if FullTextEnabled() && q.MatchExpression() != "" {
+		return searchFTS(db, q, opts)
+	}
+	return searchFallback(db, q, opts)
+}
+
+// markToHTML 转义文本并将高亮标记替换为 <mark>
+func markToHTML(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, markStart, "<mark>")
+	return strings.ReplaceAll(s, markEnd, "</mark>")
+}
+
+func searchFTS(db *gorm.DB, q Query, opts Options) ([]Hit, int, error) {
+	base := db.Table("search_fts").
+		Joins("JOIN search_documents d ON d.id = search_fts.rowid").
+		Where("search_fts MATCH ?", q.MatchExpression()).
+		Where("d.user_id = ?", opts.UserID)
+	if len(opts.Types) > 0 {
+		base = base.Where("d.entity_type IN ?", opts.Types)
+	}
+	if opts.FilterPlatforms {
+		base = base.Where("d.platform_id IN ?", opts.PlatformIDs)
+	}
+
+	var total int64
+	if err := base.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rows []struct {
+		EntityType     string
+		EntityID       uint
+		PlatformID     uint
+		EmailAccountID uint
+		Title          string
+		Platform       string
+		Tags           string
+		Sender         string
+		Score          float64
+		TitleHighlight string
+		Snippet        string
+	}
+	err := base.Session(&gorm.Session{}).
+		Select(`d.entity_type, d.entity_id, d.platform_id, d.email_account_id, d.title, d.platform, d.tags, d.sender,
+			-bm25(search_fts, ?, ?, ?, ?, ?) AS score,
+			highlight(search_fts, 0, ?, ?) AS title_highlight,
+			snippet(search_fts, 1, ?, ?, '…', 16) AS snippet`,
+			columnWeights[0], columnWeights[1], columnWeights[2], columnWeights[3], columnWeights[4],
+			markStart, markEnd, markStart, markEnd).
+		Order("score DESC, d.updated_at DESC").
+		Limit(opts.PageSize).
+		Offset((opts.Page - 1) * opts.PageSize).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hits := make([]Hit, 0, len(rows))
+	for _, r := range rows {
+		hits = append(hits, Hit{
+			EntityType:     r.EntityType,
+			EntityID:       r.EntityID,
+			PlatformID:     r.PlatformID,
+			EmailAccountID: r.EmailAccountID,
+			Title:          r.Title,
+			Platform:       r.Platform,
+			Tags:           r.Tags,
+			Sender:         r.Sender,
+			Score:          r.Score,
+			TitleHighlight: markToHTML(r.TitleHighlight),
+			Snippet:        markToHTML(r.Snippet),
+		})
+	}
+	return hits, int(total), nil
+}
+
+// --- 未启用 FTS5 时的进程内匹配 ---
+// 与 unicode61 分词保持一致：按字母/数字切分为词，普通词整词匹配，前缀词匹配词首，短语匹配连续的词。
+
+// tokenize 切分为小写的词
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchTerm 判断词序列中是否包含检索词
+func matchTerm(tokens []string, t Term) bool {
+	words := tokenize(t.Text)
+	if len(words) == 0 {
+		return false
+	}
+	for i := 0; i+len(words) <= len(tokens); i++ {
+		ok := true
+		for j, w := range words {
+			last := j == len(words)-1
+			if tokens[i+j] != w && !(last && t.Prefix && strings.HasPrefix(tokens[i+j], w)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenMatchesAny 判断单个词是否命中任一检索词中的某个词，用于高亮
+func tokenMatchesAny(token string, terms []Term) bool {
+	for _, t := range terms {
+		words := tokenize(t.Text)
+		for j, w := range words {
+			if token == w || (t.Prefix && j == len(words)-1 && strings.HasPrefix(token, w)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// highlightText 为命中的词加上高亮标记；window > 0 时截取首个命中附近约 window 个词作为摘要
+func highlightText(text string, terms []Term, window int) string {
+	type span struct{ start, end int }
+	var spans []span
+	var matched []bool
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+			j++
+		}
+		spans = append(spans, span{i, j})
+		matched = append(matched, tokenMatchesAny(strings.ToLower(string(runes[i:j])), terms))
+		i = j
+	}
+
+	from, to := 0, len(runes)
+	if window > 0 && len(spans) > window {
+		first := 0
+		for k, m := range matched {
+			if m {
+				first = k
+				break
+			}
+		}
+		startTok := first - window/2
+		if startTok < 0 {
+			startTok = 0
+		}
+		endTok := startTok + window
+		if endTok > len(spans) {
+			endTok = len(spans)
+			startTok = endTok - window
+		}
+		from, to = spans[startTok].start, spans[endTok-1].end
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for k, sp := range spans {
+		if sp.end <= from || sp.start >= to || !matched[k] {
+			continue
+		}
+		b.WriteString(string(runes[pos:sp.start]))
+		b.WriteString(markStart + string(runes[sp.start:sp.end]) + markEnd)
+		pos = sp.end
+	}
+	b.WriteString(string(runes[pos:to]))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// likeFilter 为检索词的每个词添加 LIKE 条件：每个词都须出现在 columns 中的某一列。
+// 这只是必要条件，用于在数据库中缩小候选范围，精确匹配仍由 matchTerm 完成。
+// SQLite 的 LOWER 只转换 ASCII 字母，含非 ASCII 字符的词不参与预过滤，以免漏掉大小写不同的记录
+func likeFilter(query *gorm.DB, t Term, columns ...string) *gorm.DB {
+	for _, word := range tokenize(t.Text) {
+		if !isASCII(word) {
+			continue
+		}
+		conditions := make([]string, len(columns))
+		args := make([]interface{}, len(columns))
+		for i, col := range columns {
+			conditions[i] = "LOWER(" + col + ") LIKE ?"
+			args[i] = "%" + word + "%"
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+	return query
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// searchFallback 未启用 FTS5 时的搜索：先用 LIKE 在数据库中筛出候选记录，再在内存中精确匹配并排序。
+// 候选记录超过 fallbackCandidateLimit 时只考虑最近更新的部分
+func searchFallback(db *gorm.DB, q Query, opts Options) ([]Hit, int, error) {
+	query := db.Model(&models.SearchDocument{}).Where("user_id = ?", opts.UserID)
+	if len(opts.Types) > 0 {
+		query = query.Where("entity_type IN ?", opts.Types)
+	}
+	if opts.FilterPlatforms {
+		query = query.Where("platform_id IN ?", opts.PlatformIDs)
+	}
+	for _, t := range q.Terms {
+		query = likeFilter(query, t, "title", "body", "platform", "tags", "sender")
+	}
+	for _, t := range q.Platforms {
+		query = likeFilter(query, t, "platform")
+	}
+	for _, t := range q.Tags {
+		query = likeFilter(query, t, "tags")
+	}
+	for _, t := range q.Senders {
+		query = likeFilter(query, t, "sender")
+	}
+	var docs []models.SearchDocument
+	if err := query.Order("updated_at DESC").Limit(fallbackCandidateLimit).Find(&docs).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var hits []Hit
+	for _, d := range docs {
+		columns := [5][]string{tokenize(d.Title), tokenize(d.Body), tokenize(d.Platform), tokenize(d.Tags), tokenize(d.Sender)}
+
+		ok := true
+		for _, f := range []struct {
+			col   int
+			terms []Term
+		}{{2, q.Platforms}, {3, q.Tags}, {4, q.Senders}} {
+			for _, t := range f.terms {
+				if !matchTerm(columns[f.col], t) {
+					ok = false
+				}
+			}
+		}
+		score := 0.0
+		for _, t := range q.Terms {
+			termScore := 0.0
+			for col, tokens := range columns {
+				if matchTerm(tokens, t) {
+					termScore += columnWeights[col]
+				}
+			}
+			if termScore == 0 {
+				ok = false
+				break
+			}
+			score += termScore
+		}
+		if !ok {
+			continue
+		}
+
+		highlightTerms := append(append([]Term{}, q.Terms...), q.Platforms...)
+		hits = append(hits, Hit{
+			EntityType:     d.EntityType,
+			EntityID:       d.EntityID,
+			PlatformID:     d.PlatformID,
+			EmailAccountID: d.EmailAccountID,
+			Title:          d.Title,
+			Platform:       d.Platform,
+			Tags:           d.Tags,
+			Sender:         d.Sender,
+			Score:          score,
+			TitleHighlight: markToHTML(highlightText(d.Title, highlightTerms, 0)),
+			Snippet:        markToHTML(highlightText(d.Body, q.Terms, 16)),
+		})
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+
+	total := len(hits)
+	start := (opts.Page - 1) * opts.PageSize
+	if start > total {
+		start = total
+	}
+	end := start + opts.PageSize
+	if end > total {
+		end = total
+	}
+	return hits[start:end], total, nil
+}
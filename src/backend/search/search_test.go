@@ -0,0 +1,25 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTerm(t *testing.T) {
+	tokens := tokenize("Your GitHub invoice, due-date: Friday")
+
+	assert.True(t, matchTerm(tokens, Term{Text: "github"}))
+	assert.False(t, matchTerm(tokens, Term{Text: "git"}))
+	assert.True(t, matchTerm(tokens, Term{Text: "git", Prefix: true}))
+	assert.True(t, matchTerm(tokens, Term{Text: "due date", Phrase: true}))
+	assert.False(t, matchTerm(tokens, Term{Text: "date due", Phrase: true}))
+}
+
+func TestHighlightText(t *testing.T) {
+	terms := []Term{{Text: "git", Prefix: true}}
+	assert.Equal(t, "&lt;b&gt; &amp; <mark>GitHub</mark>", markToHTML(highlightText("<b> & GitHub", terms, 0)))
+
+	snippet := markToHTML(highlightText("a b c d e f g h github i j k l m n o p", terms, 4))
+	assert.Equal(t, "…g h <mark>github</mark> i…", snippet)
+}
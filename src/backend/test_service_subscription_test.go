@@ -8,32 +8,16 @@ import (
 	"testing"
 
 	"email_server/database"
+	"email_server/database/dbtest"
 	"email_server/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
 )
 
-func setupTestDB() {
-	var err error
-	database.DB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		panic("failed to connect database")
-	}
-
-	// 自动迁移数据表
-	err = database.DB.AutoMigrate(
-		&models.User{},
-		&models.EmailAccount{},
-		&models.Platform{},
-		&models.PlatformRegistration{},
-		&models.ServiceSubscription{},
-	)
-	if err != nil {
-		panic("failed to migrate database")
-	}
+// setupTestDB 打开已迁移的测试数据库，TEST_DB_DRIVER 指定驱动（见 dbtest）
+func setupTestDB(t *testing.T) {
+	database.DB = dbtest.Open(t)
 }
 
 func createTestUser() *models.User {
@@ -50,7 +34,7 @@ func createTestUser() *models.User {
 
 func TestServiceSubscriptionCreation(t *testing.T) {
 	// 设置测试数据库
-	setupTestDB()
+	setupTestDB(t)
 	
 	// 创建测试用户
 	user := createTestUser()
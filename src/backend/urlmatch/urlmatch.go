@@ -0,0 +1,212 @@
+// Package urlmatch 解析网址、App ID 和邮件域名，并按平台网址的匹配规则（可注册域名、主机名、前缀、正则）判断是否匹配。
+// 可注册域名按公共后缀列表计算，因此 a.github.io 与 b.github.io、x.co.uk 与 y.co.uk 互不匹配。
+package urlmatch
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// 匹配方式
+const (
+	ModeBaseDomain = "base_domain" // 可注册域名相同（包括所有子域名），默认
+	ModeHost       = "host"        // 主机名相同（忽略 www. 前缀）
+	ModeStartsWith = "starts_with" // 完整网址以规则开头
+	ModeRegex      = "regex"       // 完整网址匹配正则表达式
+)
+
+// Modes 全部匹配方式
+var Modes = []string{ModeBaseDomain, ModeHost, ModeStartsWith, ModeRegex}
+
+// 匹配结果，按匹配程度从高到低
+const (
+	MatchExact  = "exact"  // 主机名相同，或前缀/正则规则命中
+	MatchDomain = "domain" // 同一可注册域名下的其他子域名
+	MatchApp    = "app"    // App ID 相同
+)
+
+// ErrInvalidRule 规则的网址或正则表达式无效
+var ErrInvalidRule = errors.New("无效的网址匹配规则")
+
+// Address 规范化后的网址或 App ID
+type Address struct {
+	Raw        string // 去掉首尾空白的原始输入
+	Host       string // 小写主机名，App ID 时为空
+	BaseDomain string // 可注册域名（eTLD+1），如 login.example.co.uk -> example.co.uk
+	AppID      string // 非 http(s) 地址（如 androidapp://com.example.app）整体作为 App ID
+}
+
+// Parse 解析网址、裸域名或 App ID。无法识别时返回 false
+func Parse(raw string) (Address, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return Address{}, false
+	}
+	full := raw
+	if idx := strings.Index(raw, "://"); idx > 0 {
+		scheme := strings.ToLower(raw[:idx])
+		if scheme != "http" && scheme != "https" {
+			return Address{Raw: raw, AppID: strings.ToLower(raw)}, true
+		}
+	} else {
+		full = "https://" + raw
+	}
+
+	u, err := url.Parse(full)
+	if err != nil {
+		return Address{}, false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return Address{}, false
+	}
+	return Address{Raw: full, Host: host, BaseDomain: BaseDomain(host)}, true
+}
+
+// BaseDomain 按公共后缀列表返回主机名的可注册域名；IP、localhost 等无法判断时返回主机名本身
+func BaseDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return host
+	}
+	base, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return base
+}
+
+// ValidMode 是否为可用的匹配方式
+func ValidMode(mode string) bool {
+	for _, m := range Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// sameHost 比较主机名时忽略 www. 前缀
+func sameHost(a, b string) bool {
+	return strings.TrimPrefix(a, "www.") == strings.TrimPrefix(b, "www.")
+}
+
+// Rule 平台的一条网址匹配规则
+type Rule struct {
+	Pattern string // 网址、域名、App ID 或正则表达式
+	Mode    string // 匹配方式，为空时按 base_domain 处理
+}
+
+func (r Rule) mode() string {
+	if r.Mode == "" {
+		return ModeBaseDomain
+	}
+	return r.Mode
+}
+
+// Validate 校验规则
+func (r Rule) Validate() error {
+	if !ValidMode(r.mode()) || strings.TrimSpace(r.Pattern) == "" || strings.ContainsAny(r.Pattern, "\r\n") {
+		return ErrInvalidRule
+	}
+	if r.mode() == ModeRegex {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return ErrInvalidRule
+		}
+		return nil
+	}
+	if _, ok := Parse(r.Pattern); !ok {
+		return ErrInvalidRule
+	}
+	return nil
+}
+
+// Match 判断页面地址是否匹配规则，返回匹配结果（exact / domain / app），不匹配时返回空字符串
+func (r Rule) Match(page Address) string {
+	switch r.mode() {
+	case ModeRegex:
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return ""
+		}
+		if re.MatchString(page.Raw) {
+			return MatchExact
+		}
+		return ""
+	case ModeStartsWith:
+		if page.Raw != "" && strings.HasPrefix(strings.ToLower(page.Raw), strings.ToLower(r.normalizedPattern())) {
+			return MatchExact
+		}
+		return ""
+	}
+
+	addr, ok := Parse(r.Pattern)
+	if !ok {
+		return ""
+	}
+	switch {
+	case page.AppID != "" || addr.AppID != "":
+		if page.AppID == addr.AppID {
+			return MatchApp
+		}
+	case sameHost(addr.Host, page.Host):
+		return MatchExact
+	case r.mode() == ModeBaseDomain && addr.BaseDomain == page.BaseDomain:
+		return MatchDomain
+	}
+	return ""
+}
+
+// normalizedPattern 前缀规则省略协议时补上 https://，与 Parse 对页面地址的处理一致
+func (r Rule) normalizedPattern() string {
+	pattern := strings.TrimSpace(r.Pattern)
+	if !strings.Contains(pattern, "://") {
+		pattern = "https://" + pattern
+	}
+	return pattern
+}
+
+// Domain 规则对应的可注册域名，正则和 App ID 规则返回空字符串。用于等价域名匹配
+func (r Rule) Domain() string {
+	if r.mode() == ModeRegex {
+		return ""
+	}
+	addr, _ := Parse(r.Pattern)
+	return addr.BaseDomain
+}
+
+// MatchDomain 判断邮件发件人域名是否属于规则对应的网站：
+// base_domain 比较可注册域名；host 和 starts_with 要求发件域名是规则主机名或其子域名；
+// regex 以 https://<域名>/ 作为网址匹配
+func (r Rule) MatchDomain(domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" {
+		return false
+	}
+	if r.mode() == ModeRegex {
+		return r.Match(Address{Raw: "https://" + domain + "/", Host: domain, BaseDomain: BaseDomain(domain)}) != ""
+	}
+	addr, ok := Parse(r.Pattern)
+	if !ok || addr.Host == "" {
+		return false
+	}
+	if r.mode() == ModeBaseDomain {
+		return BaseDomain(domain) == addr.BaseDomain
+	}
+	host := strings.TrimPrefix(addr.Host, "www.")
+	return domain == host || strings.HasSuffix(domain, "."+host)
+}
+
+// EmailDomain 返回邮件地址 @ 之后的域名
+func EmailDomain(address string) string {
+	idx := strings.LastIndex(address, "@")
+	if idx < 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(address[idx+1:])), ">")
+}
@@ -0,0 +1,75 @@
+package urlmatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParse(t *testing.T, raw string) Address {
+	t.Helper()
+	addr, ok := Parse(raw)
+	if !ok {
+		t.Fatalf("无法解析 %q", raw)
+	}
+	return addr
+}
+
+func TestParse(t *testing.T) {
+	addr := mustParse(t, " https://Login.Example.co.uk:8443/path?q=1 ")
+	assert.Equal(t, "login.example.co.uk", addr.Host)
+	assert.Equal(t, "example.co.uk", addr.BaseDomain)
+
+	assert.Equal(t, "kate.github.io", mustParse(t, "kate.github.io/blog").BaseDomain)
+	assert.Equal(t, "192.168.1.1", mustParse(t, "http://192.168.1.1/admin").BaseDomain)
+	assert.Equal(t, "localhost", mustParse(t, "localhost:8080").BaseDomain)
+	assert.Equal(t, "androidapp://com.example.app", mustParse(t, "androidApp://com.example.app").AppID)
+
+	for _, raw := range []string{"", "https://", "http://[::1"} {
+		_, ok := Parse(raw)
+		assert.False(t, ok, raw)
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	cases := []struct {
+		rule  Rule
+		page  string
+		match string
+	}{
+		{Rule{Pattern: "https://www.example.com/login"}, "https://example.com/", MatchExact},
+		{Rule{Pattern: "example.com"}, "https://shop.example.com/cart", MatchDomain},
+		{Rule{Pattern: "example.com"}, "https://example.org", ""},
+		{Rule{Pattern: "kate.github.io"}, "https://bob.github.io", ""},
+		{Rule{Pattern: "https://login.example.com", Mode: ModeHost}, "https://login.example.com/x", MatchExact},
+		{Rule{Pattern: "https://login.example.com", Mode: ModeHost}, "https://shop.example.com", ""},
+		{Rule{Pattern: "example.com/app/", Mode: ModeStartsWith}, "https://EXAMPLE.com/app/settings", MatchExact},
+		{Rule{Pattern: "https://example.com/app/", Mode: ModeStartsWith}, "https://example.com/other", ""},
+		{Rule{Pattern: `^https://[a-z]+\.example\.com/sso`, Mode: ModeRegex}, "https://eu.example.com/sso/start", MatchExact},
+		{Rule{Pattern: `^https://[a-z]+\.example\.com/sso`, Mode: ModeRegex}, "https://eu.example.com/home", ""},
+		{Rule{Pattern: "androidapp://com.example.app"}, "androidapp://com.example.app", MatchApp},
+		{Rule{Pattern: "androidapp://com.example.app"}, "https://example.app", ""},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.match, tc.rule.Match(mustParse(t, tc.page)), "%+v %s", tc.rule, tc.page)
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	assert.NoError(t, Rule{Pattern: "example.com"}.Validate())
+	assert.NoError(t, Rule{Pattern: `^https://(a|b)\.example\.com`, Mode: ModeRegex}.Validate())
+	assert.ErrorIs(t, Rule{Pattern: "(", Mode: ModeRegex}.Validate(), ErrInvalidRule)
+	assert.ErrorIs(t, Rule{Pattern: "example.com", Mode: "never"}.Validate(), ErrInvalidRule)
+	assert.ErrorIs(t, Rule{Pattern: "https://"}.Validate(), ErrInvalidRule)
+	assert.ErrorIs(t, Rule{Pattern: "a.com\nb.com"}.Validate(), ErrInvalidRule)
+}
+
+func TestRuleMatchDomain(t *testing.T) {
+	assert.True(t, Rule{Pattern: "https://www.github.com/login"}.MatchDomain("noreply.github.com"))
+	assert.False(t, Rule{Pattern: "https://github.com"}.MatchDomain("github.io"))
+	assert.True(t, Rule{Pattern: "https://accounts.example.com", Mode: ModeHost}.MatchDomain("mail.accounts.example.com"))
+	assert.False(t, Rule{Pattern: "https://accounts.example.com", Mode: ModeHost}.MatchDomain("example.com"))
+	assert.True(t, Rule{Pattern: `example\.(com|net)`, Mode: ModeRegex}.MatchDomain("example.net"))
+	assert.False(t, Rule{Pattern: "androidapp://com.example.app"}.MatchDomain("example.app"))
+	assert.Equal(t, "mail.example.com", EmailDomain("No-Reply@Mail.Example.com"))
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"email_server/config"
+)
+
+// AttachmentURLTTL 附件签名链接的有效期，过期后重新打开邮件即可获得新的链接
+const AttachmentURLTTL = time.Hour
+
+// AttachmentURLTarget 签名链接指向的附件
+type AttachmentURLTarget struct {
+	AccountID    uint   `json:"account_id"`
+	MessageID    string `json:"message_id"`
+	AttachmentID string `json:"attachment_id"`
+}
+
+// attachmentURLClaims 附件签名链接的内容，包含 token_version 以便修改密码后旧链接失效
+type attachmentURLClaims struct {
+	UserID       int64 `json:"user_id"`
+	TokenVersion uint  `json:"token_version"`
+	AttachmentURLTarget
+	jwt.RegisteredClaims
+}
+
+// attachmentURLKey 签名链接使用单独的签名密钥，不能当作登录 token 使用
+func attachmentURLKey() []byte {
+	return []byte(config.AppConfig.JWT.SecretKey + "|attachment-url")
+}
+
+// GenerateAttachmentURLToken 生成附件下载链接中的签名 token
+func GenerateAttachmentURLToken(userID int64, tokenVersion uint, target AttachmentURLTarget) (string, error) {
+	now := time.Now()
+	claims := &attachmentURLClaims{
+		UserID:              userID,
+		TokenVersion:        tokenVersion,
+		AttachmentURLTarget: target,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(AttachmentURLTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "email-server",
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(attachmentURLKey())
+}
+
+// ParseAttachmentURLToken 校验签名 token 是否指向 target，返回用户ID和签发时的 token_version
+func ParseAttachmentURLToken(tokenString string, target AttachmentURLTarget) (int64, uint, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &attachmentURLClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return attachmentURLKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return 0, 0, err
+	}
+	claims, ok := token.Claims.(*attachmentURLClaims)
+	if !ok || !token.Valid || claims.UserID == 0 || claims.AttachmentURLTarget != target {
+		return 0, 0, errors.New("无效的附件链接")
+	}
+	return claims.UserID, claims.TokenVersion, nil
+}
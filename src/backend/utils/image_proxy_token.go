@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"email_server/config"
+)
+
+// ImageProxyURLTTL 图片代理签名链接的有效期
+const ImageProxyURLTTL = 24 * time.Hour
+
+// ImageProxyClaims 图片代理链接签名的内容，包含 token_version 以便修改密码后旧链接失效
+type ImageProxyClaims struct {
+	UserID       int64
+	TokenVersion uint
+	URL          string
+	ExpiresAt    int64 // Unix 秒
+}
+
+// imageProxyKey 图片代理使用单独的签名密钥
+func imageProxyKey() []byte {
+	return []byte(config.AppConfig.JWT.SecretKey + "|image-proxy")
+}
+
+// SignImageProxyURL 计算图片代理链接的签名。一封邮件可能包含大量图片，签名使用较短的 HMAC 而不是 JWT
+func SignImageProxyURL(claims ImageProxyClaims) string {
+	mac := hmac.New(sha256.New, imageProxyKey())
+	fmt.Fprintf(mac, "%d|%d|%d|%s", claims.UserID, claims.TokenVersion, claims.ExpiresAt, claims.URL)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyImageProxyURL 校验图片代理链接的签名和有效期
+func VerifyImageProxyURL(claims ImageProxyClaims, signature string) error {
+	if claims.UserID == 0 || claims.URL == "" {
+		return errors.New("无效的图片链接")
+	}
+	if !hmac.Equal([]byte(SignImageProxyURL(claims)), []byte(signature)) {
+		return errors.New("图片链接签名无效")
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return errors.New("图片链接已过期")
+	}
+	return nil
+}
@@ -12,16 +12,19 @@ type Claims struct {
     UserID   int64  `json:"user_id"`
     Username string `json:"username"`
     Role     string `json:"role"`
+    // TokenVersion 签发时用户的 token 版本，与数据库不一致时 token 已被吊销
+    TokenVersion uint `json:"token_version"`
     jwt.RegisteredClaims
 }
 
-func GenerateToken(userID int64, username, role string) (string, error) {
+func GenerateToken(userID int64, username, role string, tokenVersion uint) (string, error) {
     expirationTime := time.Now().Add(time.Duration(config.AppConfig.JWT.ExpiresIn) * time.Hour)
     
     claims := &Claims{
         UserID:   userID,
         Username: username,
         Role:     role,
+        TokenVersion: tokenVersion,
         RegisteredClaims: jwt.RegisteredClaims{
             ExpiresAt: jwt.NewNumericDate(expirationTime),
             IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -60,5 +63,5 @@ func RefreshToken(tokenString string) (string, error) {
         return tokenString, nil
     }
     
-    return GenerateToken(claims.UserID, claims.Username, claims.Role)
+    return GenerateToken(claims.UserID, claims.Username, claims.Role, claims.TokenVersion)
 }
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"strings"
 
@@ -51,3 +53,12 @@ func ValidatePassword(password string) error {
 	// More password strength rules can be added here.
 	return nil
 }
+
+// GenerateTemporaryPassword 生成管理员创建用户时使用的随机临时密码
+func GenerateTemporaryPassword() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
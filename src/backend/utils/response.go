@@ -1,12 +1,15 @@
 package utils
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings" // <-- 添加 strings 包导入
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"email_server/models"
+	"gorm.io/gorm"
 )
 
 // SendSuccessResponse sends a standard success response.
@@ -60,26 +63,19 @@ import (
    }
    
    // IsUniqueConstraintError checks if the error is a unique constraint violation.
-   // This is a basic check for SQLite, a more robust solution might involve checking driver-specific error codes.
+   // The database is opened with TranslateError enabled, so GORM maps the driver error to gorm.ErrDuplicatedKey
+   // for SQLite, PostgreSQL and MySQL alike; the message checks cover connections opened without translation.
    func IsUniqueConstraintError(err error) bool {
     if err == nil {
     	return false
     }
-    // SQLite unique constraint error message often contains "UNIQUE constraint failed"
-    // or "constraint failed: UNIQUE constraint"
-    // For other databases, this check would need to be different.
-    // Example: For PostgreSQL, you might check for pq.ErrorCode("23505")
-    // For MySQL, you might check for *mysql.MySQLError and then errNum == 1062
-    
-    // A common string for SQLite
-    errMsg := err.Error()
-    if strings.Contains(errMsg, "UNIQUE constraint failed") || strings.Contains(errMsg, "constraint failed: UNIQUE constraint") {
+    if errors.Is(err, gorm.ErrDuplicatedKey) {
     	return true
     }
-    // GORM might also wrap errors, so a more generic check might be needed if the above fails.
-    // Sometimes the error might be like "Error 1062: Duplicate entry '...' for key '...'" for MySQL
-    // or "ERROR: duplicate key value violates unique constraint "..." (SQLSTATE 23505)" for PostgreSQL
-    return false
+    errMsg := err.Error()
+    return strings.Contains(errMsg, "UNIQUE constraint failed") || // SQLite
+    	strings.Contains(errMsg, "SQLSTATE 23505") || // PostgreSQL
+    	strings.Contains(errMsg, "Error 1062") // MySQL: Duplicate entry
    }
    
    // Helper function to check if a string contains a substring (case-insensitive for flexibility if needed, but here case-sensitive)
@@ -104,3 +100,13 @@ import (
  }
  return uint(val), nil
   }
+
+// SendTooManyRequests 返回 429 并在 Retry-After 头中给出需要等待的秒数
+func SendTooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	SendErrorResponse(c, http.StatusTooManyRequests, message)
+}
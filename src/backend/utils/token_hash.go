@@ -0,0 +1,13 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashToken 计算随机 token 的 SHA-256，用于在数据库中保存重置密码链接、API token 等凭证，
+// 数据库泄露时无法直接使用。token 本身是高熵随机串，不需要加盐或慢哈希
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
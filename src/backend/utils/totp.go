@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTPPeriod TOTP 验证码的有效周期
+const TOTPPeriod = 30 * time.Second
+
+// totpDigits TOTP 验证码位数
+const totpDigits = 6
+
+// ErrInvalidTOTPSecret TOTP 密钥不是有效的 base32 字符串或 otpauth:// 链接
+var ErrInvalidTOTPSecret = errors.New("无效的 TOTP 密钥")
+
+// NormalizeTOTPSecret 规范化用户输入的 TOTP 密钥：支持 otpauth:// 链接，去掉空格和填充并转为大写
+func NormalizeTOTPSecret(input string) (string, error) {
+	secret := strings.TrimSpace(input)
+	if strings.HasPrefix(strings.ToLower(secret), "otpauth://") {
+		u, err := url.Parse(secret)
+		if err != nil {
+			return "", ErrInvalidTOTPSecret
+		}
+		secret = u.Query().Get("secret")
+	}
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret))
+	if secret == "" {
+		return "", ErrInvalidTOTPSecret
+	}
+	if _, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret); err != nil {
+		return "", ErrInvalidTOTPSecret
+	}
+	return secret, nil
+}
+
+// GenerateTOTP 按 RFC 6238（SHA1、6 位、30 秒）计算 t 时刻的验证码，同时返回验证码剩余有效时间
+func GenerateTOTP(secret string, t time.Time) (string, time.Duration, error) {
+	normalized, err := NormalizeTOTPSecret(secret)
+	if err != nil {
+		return "", 0, err
+	}
+	key, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalized)
+
+	period := int64(TOTPPeriod / time.Second)
+	counter := t.Unix() / period
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	code := fmt.Sprintf("%0*d", totpDigits, value%1000000)
+	remaining := time.Duration(period-t.Unix()%period) * time.Second
+	return code, remaining, nil
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"email_server/config"
+)
+
+// EmailVerificationTTL 邮箱验证链接的有效期
+const EmailVerificationTTL = 24 * time.Hour
+
+// emailVerificationClaims 邮箱验证 token 的内容，包含邮箱以便用户修改邮箱后旧链接失效
+type emailVerificationClaims struct {
+	UserID int64  `json:"user_id"`
+	Email  string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// emailVerificationKey 验证 token 使用与登录 token 不同的签名密钥，避免两者互相冒用
+func emailVerificationKey() []byte {
+	return []byte(config.AppConfig.JWT.SecretKey + "|email-verification")
+}
+
+// GenerateEmailVerificationToken 生成邮箱验证链接中的签名 token
+func GenerateEmailVerificationToken(userID int64, email string) (string, error) {
+	now := time.Now()
+	claims := &emailVerificationClaims{
+		UserID: userID,
+		Email:  email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(EmailVerificationTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "email-server",
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(emailVerificationKey())
+}
+
+// ParseEmailVerificationToken 校验邮箱验证 token，返回用户ID和待验证的邮箱
+func ParseEmailVerificationToken(tokenString string) (int64, string, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &emailVerificationClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return emailVerificationKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return 0, "", err
+	}
+	claims, ok := token.Claims.(*emailVerificationClaims)
+	if !ok || !token.Valid || claims.UserID == 0 {
+		return 0, "", errors.New("无效的验证链接")
+	}
+	return claims.UserID, claims.Email, nil
+}
@@ -58,9 +58,9 @@ mkdir -p "${BACKEND_OUTPUT_DIR}"
 
 echo "INFO: 编译 Go 应用..."
 # 使用 -ldflags 来减小二进制文件大小并移除调试信息
-# CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o "${BACKEND_OUTPUT_DIR}/${BACKEND_APP_NAME}" main.go
+# CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o "${BACKEND_OUTPUT_DIR}/${BACKEND_APP_NAME}" .
 # 默认情况下，为当前操作系统编译
-go build -ldflags="-s -w" -o "${BACKEND_OUTPUT_DIR}/${BACKEND_APP_NAME}" main.go
+go build -tags sqlite_fts5 -ldflags="-s -w" -o "${BACKEND_OUTPUT_DIR}/${BACKEND_APP_NAME}" .
 
 echo "INFO: 后端构建完成。二进制文件位于 ${BACKEND_OUTPUT_DIR}/${BACKEND_APP_NAME}"
 echo "----------------------------------------"
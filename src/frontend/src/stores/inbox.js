@@ -1,9 +1,12 @@
 // stores/inbox.js
 
 import { defineStore } from 'pinia';
-import { getInboxEmails, getEmailDetail } from '@/utils/api';
+import { getInboxEmails, getUnifiedInbox, searchMailbox, getEmailDetail } from '@/utils/api';
 import { useSettingsStore } from './settings';
 
+// UNIFIED_ACCOUNT 作为 selectedAccountId 时显示所有账户的统一收件箱
+export const UNIFIED_ACCOUNT = 'all';
+
 export const useInboxStore = defineStore('inbox', {
   state: () => {
     const settingsStore = useSettingsStore();
@@ -15,8 +18,11 @@ export const useInboxStore = defineStore('inbox', {
       pageSize: settingsStore.getPageSize('inbox'),
       totalEmails: 0,
       hasMore: true,
+      nextCursor: '', // 服务器返回的下一页游标，Gmail/Outlook 账户按游标翻页
       selectedAccountId: null,
       selectedFolder: 'inbox', // 当前选择的文件夹
+      accountErrors: [], // 统一收件箱中获取失败的账户
+      searchQuery: '', // 不为空时列表显示邮箱搜索结果
     };
   },
   getters: {
@@ -40,7 +46,9 @@ export const useInboxStore = defineStore('inbox', {
      this.page = 1;
      this.totalEmails = 0;
      this.hasMore = true;
+     this.nextCursor = '';
      this.error = null;
+     this.accountErrors = [];
      await this.fetchEmails();
    },
 
@@ -50,6 +58,7 @@ export const useInboxStore = defineStore('inbox', {
      this.page = 1;
      this.totalEmails = 0;
      this.hasMore = true;
+     this.nextCursor = '';
      this.error = null;
      await this.fetchEmails();
    },
@@ -76,17 +85,28 @@ export const useInboxStore = defineStore('inbox', {
         this.page = 1;
         this.emails = [];
         this.hasMore = true;
+        this.nextCursor = '';
       }
 
      // stores/inbox.js -> fetchEmails
 
 // ...
+      if (this.selectedAccountId === UNIFIED_ACCOUNT) {
+        await this.fetchUnifiedEmails();
+        return;
+      }
+      if (this.searchQuery) {
+        await this.fetchSearchResults(loadMore);
+        return;
+      }
+
       try {
         const response = await getInboxEmails({
           page: this.page,
           pageSize: this.pageSize,
           account_id: this.selectedAccountId,
-          folder: this.selectedFolder
+          folder: this.selectedFolder,
+          ...(loadMore && this.nextCursor ? { cursor: this.nextCursor } : {})
         });
 
         // ★★★★★ CORE FIX IS HERE ★★★★★
@@ -113,8 +133,11 @@ export const useInboxStore = defineStore('inbox', {
         this.totalEmails = total;
         this.page += 1;
         
-        // Update hasMore status based on the total count
-        if (this.emails.length >= this.totalEmails) {
+        // 优先使用服务器返回的游标判断是否还有更多邮件，旧版本接口按总数判断
+        this.nextCursor = responseData.nextCursor || '';
+        if (typeof responseData.hasMore === 'boolean') {
+          this.hasMore = responseData.hasMore;
+        } else if (this.emails.length >= this.totalEmails) {
           this.hasMore = false;
         }
 
@@ -131,22 +154,68 @@ export const useInboxStore = defineStore('inbox', {
         this.isLoading = false;
       }
     },
+    // 统一收件箱不分页，每个账户返回最新的 pageSize 封邮件
+    async fetchUnifiedEmails() {
+      try {
+        const response = await getUnifiedInbox({ pageSize: this.pageSize, folder: this.selectedFolder });
+        this.emails = response.emails || [];
+        this.totalEmails = response.total || 0;
+        this.accountErrors = (response.accounts || []).filter(account => account.error);
+        this.hasMore = false;
+        this.nextCursor = '';
+      } catch (error) {
+        this.error = error.message || 'An unknown error occurred while fetching emails.';
+        console.error('Error fetching unified inbox:', error);
+      } finally {
+        this.isLoading = false;
+      }
+    },
+    async search(query) {
+      this.searchQuery = query.trim();
+      await this.selectAccount(this.selectedAccountId);
+    },
+    async fetchSearchResults(loadMore) {
+      try {
+        const response = await searchMailbox({
+          account_id: this.selectedAccountId,
+          q: this.searchQuery,
+          folder: this.selectedFolder,
+          pageSize: this.pageSize,
+          ...(loadMore && this.nextCursor ? { cursor: this.nextCursor } : {})
+        });
+        this.emails.push(...(response.emails || []));
+        this.totalEmails = this.emails.length;
+        this.nextCursor = response.nextCursor || '';
+        this.hasMore = !!response.hasMore;
+      } catch (error) {
+        this.error = error.message || 'An unknown error occurred while searching.';
+        console.error('Error searching mailbox:', error);
+      } finally {
+        this.isLoading = false;
+      }
+    },
+    // 邮件所属的账户：统一收件箱中的邮件带有 accountId
+    accountIdFor(messageId) {
+      return this.getEmailById(messageId)?.accountId || this.selectedAccountId;
+    },
     getEmailById(messageId) {
       // Corrected to use the right property from backend response
       return this.emails.find(email => email.messageId === messageId);
     },
 
-    async fetchEmailDetail(messageId) {
+    async fetchEmailDetail(messageId, { remoteContent = false } = {}) {
       console.log('📧 fetchEmailDetail called with messageId:', messageId);
 
-      if (!this.selectedAccountId) {
+      const accountId = this.accountIdFor(messageId);
+      if (!accountId || accountId === UNIFIED_ACCOUNT) {
         throw new Error("Please select an email account.");
       }
 
       try {
-        const response = await getEmailDetail(messageId, {
-          account_id: this.selectedAccountId
-        });
+        const params = { account_id: accountId };
+        // 本次显示远程图片（通过服务器图片代理）
+        if (remoteContent) params.remote_content = 1;
+        const response = await getEmailDetail(messageId, params);
 
         console.log('📧 Email detail response:', response);
 
@@ -241,8 +241,73 @@ export const getInboxEmails = (params = {}) => {
   console.log('🌐 getInboxEmails called with params:', params);
   return emailApi.get('/inbox', { params });
 };
+// 统一收件箱：汇总全部（或 account_ids 指定的）邮箱账户，支持 sender、subject、unread 过滤
+export const getUnifiedInbox = (params = {}) => emailApi.get('/inbox/unified', { params });
+// 邮箱搜索：q 支持 from: to: subject: has:attachment is:unread before: after: 和自由文本
+export const searchMailbox = (params = {}) => emailApi.get('/inbox/search', { params });
+// 会话：按 Gmail threadId / Outlook conversationId / IMAP References 分组，列表按 nextCursor 翻页
+export const getEmailThreads = (params = {}) => emailApi.get('/inbox/threads', { params });
+export const getEmailThread = (threadId, params = {}) => emailApi.get(`/inbox/threads/${encodeURIComponent(threadId)}`, { params });
+// 新邮件监听：enabled 为 true 时开启，状态见 getMailWatches 返回的 watch.status
+export const getMailWatches = () => emailApi.get('/inbox/watches');
+export const updateMailWatch = (accountId, enabled) => emailApi.put(`/inbox/watches/${accountId}`, { enabled });
+export const getNewMailEvents = (sinceId = 0) => emailApi.get('/inbox/new-mail-events', { params: { since_id: sinceId } });
+// 订阅新邮件推送（SSE）。接口需要 Authorization 请求头，所以用 fetch 读取流而不是 EventSource；
+// 断开后按最后收到的事件ID重连补发。返回的函数用于停止订阅
+export const streamNewMailEvents = (onEvent, { retryDelay = 5000 } = {}) => {
+  let lastEventId = 0
+  let controller = null
+  let stopped = false
+  const connect = async () => {
+    controller = new AbortController()
+    try {
+      const authStore = useAuthStore()
+      const response = await fetch(`${API_BASE_URL}/inbox/events?since_id=${lastEventId}`, {
+        headers: { Authorization: `Bearer ${authStore.token}` },
+        signal: controller.signal
+      })
+      if (!response.ok || !response.body) throw new Error(`HTTP ${response.status}`)
+      const reader = response.body.getReader()
+      const decoder = new TextDecoder()
+      let buffer = ''
+      for (;;) {
+        const { value, done } = await reader.read()
+        if (done) break
+        buffer += decoder.decode(value, { stream: true })
+        let index
+        while ((index = buffer.indexOf('\n\n')) >= 0) {
+          const block = buffer.slice(0, index)
+          buffer = buffer.slice(index + 2)
+          const data = block.split('\n').filter(line => line.startsWith('data: ')).map(line => line.slice(6)).join('\n')
+          if (!data) continue
+          const event = JSON.parse(data)
+          lastEventId = Math.max(lastEventId, event.id)
+          onEvent(event)
+        }
+      }
+    } catch (error) {
+      if (stopped) return
+      console.warn('新邮件推送连接断开:', error.message)
+    }
+    if (!stopped) setTimeout(connect, retryDelay)
+  }
+  connect()
+  return () => {
+    stopped = true
+    if (controller) controller.abort()
+  }
+};
 export const getEmailDetail = (messageId, params = {}) => emailApi.get(`/inbox/emails/${messageId}`, { params });
 export const markEmailAsRead = (messageId, params = {}) => emailApi.post(`/inbox/emails/${messageId}/mark-read`, {}, { params });
+// action: mark_read / mark_unread / flag / unflag / move / archive / trash / delete / spam / not_spam，move 需要 folder
+export const performEmailAction = (messageId, accountId, action, folder = '') =>
+  emailApi.post(`/inbox/emails/${messageId}/actions`, { action, folder }, { params: { account_id: accountId } });
+export const batchEmailAction = (accountId, messageIds, action, folder = '') =>
+  emailApi.post('/inbox/actions', { account_id: accountId, message_ids: messageIds, action, folder });
+// 允许显示远程图片的发件人
+export const getRemoteContentSenders = () => emailApi.get('/inbox/remote-content-senders');
+export const addRemoteContentSender = (sender) => emailApi.post('/inbox/remote-content-senders', { sender });
+export const deleteRemoteContentSender = (id) => emailApi.delete(`/inbox/remote-content-senders/${id}`);
 
 // OAuth2 API
 export const oauth2API = {